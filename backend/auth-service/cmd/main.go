@@ -3,9 +3,11 @@ package main
 
 import (
 	"auth-service/pkg/config"
+	"auth-service/pkg/docs"
 	"auth-service/pkg/handlers"
-
-	//"auth-service/pkg/middleware"
+	"auth-service/pkg/middleware"
+	"auth-service/pkg/services"
+	"context"
 	"log"
 
 	"github.com/gin-gonic/gin"
@@ -16,8 +18,16 @@ import (
 // @description Authentication service with OTP and MFA support
 // @host localhost:8080
 // @BasePath /api/v1/auth
+// @securityDefinitions.apikey Bearer
+// @in header
+// @name Authorization
+// @securityDefinitions.apikey Service
+// @in header
+// @name X-Service-Token
 func main() {
-	config.LoadConfig()
+	if err := config.LoadConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
 	if _, err := config.SetupDatabase(); err != nil {
 		log.Fatalf("Failed to set up database: %v", err)
 	}
@@ -25,9 +35,18 @@ func main() {
 		log.Fatalf("Failed to set up Redis: %v", err)
 	}
 
-	r := gin.Default()
+	go services.RunAccountMaintenance(context.Background(), config.Config.Security.PurgeInterval)
+
+	if config.Config.Server.Environment == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	r := gin.New()
 
 	// Middleware
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Logger())
+	r.Use(gin.Recovery())
 	//r.Use(middleware.CORS())
 
 	// Auth routes
@@ -36,12 +55,34 @@ func main() {
 		auth.POST("/register", handlers.Register)
 		auth.POST("/login", handlers.Login)
 		auth.POST("/verify-otp", handlers.VerifyOTP)
-		//auth.POST("/setup-mfa", middleware.AuthRequired(), handlers.SetupMFA)
-		auth.POST("/verify-mfa", handlers.VerifyMFA)
+		auth.POST("/setup-mfa", middleware.AuthRequired(), handlers.SetupMFA)
 		auth.POST("/refresh", handlers.RefreshToken)
 		auth.POST("/forgot-password", handlers.ForgotPassword)
 		auth.POST("/reset-password", handlers.ResetPassword)
-		//auth.GET("/profile", middleware.AuthRequired(), handlers.GetProfile)
+
+		auth.Static("/avatars", config.Config.Uploads.AvatarDir)
+
+		auth.GET("/openapi.json", docs.Spec)
+		auth.GET("/docs", docs.UI)
+		auth.GET("/docs/assets/:file", docs.Asset)
+
+		profile := auth.Group("/profile", middleware.AuthRequired())
+		{
+			profile.GET("", handlers.GetProfile)
+			profile.PATCH("", handlers.UpdateProfile)
+			profile.POST("/avatar", handlers.UploadAvatar)
+			profile.POST("/email", handlers.ChangeEmail)
+			profile.POST("/email/confirm", handlers.ConfirmEmailChange)
+			profile.POST("/password", handlers.ChangePassword)
+			profile.GET("/export", handlers.ExportAccountData)
+			profile.POST("/deletion", handlers.RequestAccountDeletion)
+			profile.DELETE("/deletion", handlers.CancelAccountDeletion)
+		}
+
+		internal := auth.Group("/internal", middleware.ServiceRequired())
+		{
+			internal.GET("/users/:id/contact", handlers.GetUserContact)
+		}
 	}
 
 	log.Fatal(r.Run(":os.Getenv(\"PORT\")"))
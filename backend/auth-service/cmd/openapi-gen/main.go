@@ -0,0 +1,942 @@
+// auth-service/cmd/openapi-gen/main.go
+//
+// openapi-gen builds the OpenAPI 3 document for auth-service from the swag
+// annotations on cmd/main.go and the handlers package. Request and response
+// schemas are derived from the referenced Go types, including their json and
+// binding tags, so the spec cannot drift from the code. Run it through
+// `go generate ./pkg/docs`.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	root := flag.String("root", "", "module root (defaults to the nearest directory containing go.mod)")
+	mainFile := flag.String("main", "cmd/main.go", "file carrying the general API annotations, relative to root")
+	handlersDir := flag.String("handlers", "pkg/handlers", "package carrying the operation annotations, relative to root")
+	out := flag.String("out", "pkg/docs/openapi.json", "output file, relative to root unless absolute")
+	flag.Parse()
+
+	if *root == "" {
+		dir, err := findModuleRoot()
+		if err != nil {
+			log.Fatal(err)
+		}
+		*root = dir
+	}
+
+	g, err := newGenerator(*root)
+	if err != nil {
+		log.Fatal(err)
+	}
+	doc, err := g.build(filepath.Join(*root, *mainFile), filepath.Join(*root, *handlersDir))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	target := *out
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(*root, target)
+	}
+	if err := os.WriteFile(target, append(data, '\n'), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func findModuleRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("go.mod not found")
+		}
+		dir = parent
+	}
+}
+
+func readModulePath(root string) (string, error) {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "module ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "module ")), nil
+		}
+	}
+	return "", fmt.Errorf("module directive not found in go.mod")
+}
+
+// pkgInfo is a parsed package of the module, indexed by type name.
+type pkgInfo struct {
+	dir   string
+	types map[string]*ast.TypeSpec
+	// imports maps a package name used in a file to its directory, per file
+	imports map[*ast.File]map[string]string
+	files   map[*ast.TypeSpec]*ast.File
+}
+
+type generator struct {
+	root       string
+	modulePath string
+	fset       *token.FileSet
+	pkgs       map[string]*pkgInfo
+	schemas    map[string]interface{}
+}
+
+func newGenerator(root string) (*generator, error) {
+	modulePath, err := readModulePath(root)
+	if err != nil {
+		return nil, err
+	}
+	return &generator{
+		root:       root,
+		modulePath: modulePath,
+		fset:       token.NewFileSet(),
+		pkgs:       map[string]*pkgInfo{},
+		schemas:    map[string]interface{}{},
+	}, nil
+}
+
+func (g *generator) loadPackage(dir string) (*pkgInfo, error) {
+	if p, ok := g.pkgs[dir]; ok {
+		return p, nil
+	}
+
+	pkgs, err := parser.ParseDir(g.fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &pkgInfo{
+		dir:     dir,
+		types:   map[string]*ast.TypeSpec{},
+		imports: map[*ast.File]map[string]string{},
+		files:   map[*ast.TypeSpec]*ast.File{},
+	}
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			info.imports[file] = g.fileImports(file)
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					info.types[ts.Name.Name] = ts
+					info.files[ts] = file
+				}
+			}
+		}
+	}
+	g.pkgs[dir] = info
+	return info, nil
+}
+
+// fileImports maps the local names of module-internal imports to directories.
+func (g *generator) fileImports(file *ast.File) map[string]string {
+	imports := map[string]string{}
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if path != g.modulePath && !strings.HasPrefix(path, g.modulePath+"/") {
+			continue
+		}
+		name := filepath.Base(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(path, g.modulePath), "/")
+		imports[name] = filepath.Join(g.root, filepath.FromSlash(rel))
+	}
+	return imports
+}
+
+type operation struct {
+	id          string
+	summary     string
+	description string
+	tags        []string
+	accept      []string
+	produce     []string
+	params      []param
+	responses   []response
+	security    []string
+	path        string
+	method      string
+}
+
+type param struct {
+	name        string
+	in          string
+	typ         string
+	required    bool
+	description string
+}
+
+type response struct {
+	status      string
+	kind        string
+	typ         string
+	description string
+}
+
+var (
+	paramRe    = regexp.MustCompile(`^(\S+)\s+(\S+)\s+(\S+)\s+(true|false)(?:\s+"([^"]*)")?`)
+	responseRe = regexp.MustCompile(`^(\d{3}|default)\s+\{(\w+)\}\s+(\S+)(?:\s+"([^"]*)")?`)
+	routerRe   = regexp.MustCompile(`^(\S+)\s+\[(\w+)\]`)
+)
+
+func (g *generator) build(mainFile, handlersDir string) (map[string]interface{}, error) {
+	info, securitySchemes, err := g.generalInfo(mainFile)
+	if err != nil {
+		return nil, err
+	}
+
+	handlers, err := g.loadPackage(handlersDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*ast.File, 0, len(handlers.imports))
+	for file := range handlers.imports {
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return g.fset.Position(files[i].Pos()).Filename < g.fset.Position(files[j].Pos()).Filename
+	})
+
+	var ops []operation
+	var opFiles []*ast.File
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Doc == nil {
+				continue
+			}
+			op, ok, err := parseOperation(fn.Doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fn.Name.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			if op.id == "" {
+				op.id = lowerFirst(fn.Name.Name)
+			}
+			ops = append(ops, op)
+			opFiles = append(opFiles, file)
+		}
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for i, op := range ops {
+		operation, err := g.renderOperation(handlers, opFiles[i], op)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", op.method, op.path, err)
+		}
+		if paths[op.path] == nil {
+			paths[op.path] = map[string]interface{}{}
+		}
+		paths[op.path][op.method] = operation
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info["info"],
+		"servers": info["servers"],
+		"paths":   paths,
+	}
+	components := map[string]interface{}{
+		"schemas": g.schemas,
+	}
+	if len(securitySchemes) > 0 {
+		components["securitySchemes"] = securitySchemes
+	}
+	doc["components"] = components
+	return doc, nil
+}
+
+func (g *generator) generalInfo(mainFile string) (map[string]interface{}, map[string]interface{}, error) {
+	file, err := parser.ParseFile(g.fset, mainFile, nil, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := map[string]interface{}{}
+	var host, basePath string
+	schemes := map[string]interface{}{}
+	var current map[string]interface{}
+
+	for _, cg := range file.Comments {
+		for _, line := range annotationLines(cg) {
+			key, value := splitAnnotation(line)
+			switch {
+			case key == "@title":
+				info["title"] = value
+			case key == "@version":
+				info["version"] = value
+			case key == "@description":
+				info["description"] = value
+			case key == "@host":
+				host = value
+			case key == "@BasePath":
+				basePath = value
+			case key == "@securityDefinitions.apikey":
+				current = map[string]interface{}{"type": "apiKey"}
+				schemes[value] = current
+			case key == "@in" && current != nil:
+				current["in"] = value
+			case key == "@name" && current != nil:
+				current["name"] = value
+			}
+		}
+	}
+
+	servers := []map[string]interface{}{{"url": basePath}}
+	if host != "" {
+		servers = append(servers, map[string]interface{}{
+			"url":         "http://" + host + basePath,
+			"description": "Local development",
+		})
+	}
+	return map[string]interface{}{"info": info, "servers": servers}, schemes, nil
+}
+
+func annotationLines(cg *ast.CommentGroup) []string {
+	var lines []string
+	for _, c := range cg.List {
+		line := strings.TrimSpace(strings.TrimPrefix(c.Text, "//"))
+		if strings.HasPrefix(line, "@") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func splitAnnotation(line string) (string, string) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.TrimSpace(parts[1])
+}
+
+func parseOperation(doc *ast.CommentGroup) (operation, bool, error) {
+	var op operation
+	for _, line := range annotationLines(doc) {
+		key, value := splitAnnotation(line)
+		switch key {
+		case "@ID":
+			op.id = value
+		case "@Summary":
+			op.summary = value
+		case "@Description":
+			op.description = value
+		case "@Tags":
+			op.tags = splitList(value)
+		case "@Accept":
+			op.accept = splitList(value)
+		case "@Produce":
+			op.produce = splitList(value)
+		case "@Security":
+			op.security = append(op.security, value)
+		case "@Param":
+			m := paramRe.FindStringSubmatch(value)
+			if m == nil {
+				return op, false, fmt.Errorf("malformed @Param %q", value)
+			}
+			op.params = append(op.params, param{
+				name: m[1], in: m[2], typ: m[3], required: m[4] == "true", description: m[5],
+			})
+		case "@Success", "@Failure":
+			m := responseRe.FindStringSubmatch(value)
+			if m == nil {
+				return op, false, fmt.Errorf("malformed %s %q", key, value)
+			}
+			op.responses = append(op.responses, response{
+				status: m[1], kind: m[2], typ: m[3], description: m[4],
+			})
+		case "@Router":
+			m := routerRe.FindStringSubmatch(value)
+			if m == nil {
+				return op, false, fmt.Errorf("malformed @Router %q", value)
+			}
+			op.path = braceParams(m[1])
+			op.method = strings.ToLower(m[2])
+		}
+	}
+	return op, op.path != "", nil
+}
+
+// braceParams converts gin-style ":id" path segments into OpenAPI "{id}".
+func braceParams(path string) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func mimeType(short string) string {
+	switch short {
+	case "json":
+		return "application/json"
+	case "mpfd":
+		return "multipart/form-data"
+	case "x-www-form-urlencoded":
+		return "application/x-www-form-urlencoded"
+	case "plain":
+		return "text/plain"
+	case "html":
+		return "text/html"
+	case "octet-stream":
+		return "application/octet-stream"
+	case "zip":
+		return "application/zip"
+	default:
+		return short
+	}
+}
+
+func (g *generator) renderOperation(pkg *pkgInfo, file *ast.File, op operation) (map[string]interface{}, error) {
+	out := map[string]interface{}{
+		"operationId": op.id,
+	}
+	if op.summary != "" {
+		out["summary"] = op.summary
+	}
+	if op.description != "" {
+		out["description"] = op.description
+	}
+	if len(op.tags) > 0 {
+		out["tags"] = op.tags
+	}
+	if len(op.security) > 0 {
+		var security []map[string][]string
+		for _, s := range op.security {
+			security = append(security, map[string][]string{s: {}})
+		}
+		out["security"] = security
+	}
+
+	accept := op.accept
+	if len(accept) == 0 {
+		accept = []string{"json"}
+	}
+	produce := op.produce
+	if len(produce) == 0 {
+		produce = []string{"json"}
+	}
+
+	var parameters []map[string]interface{}
+	for _, p := range op.params {
+		switch p.in {
+		case "body":
+			schema, err := g.typeSchema(pkg, file, p.typ)
+			if err != nil {
+				return nil, err
+			}
+			content := map[string]interface{}{}
+			for _, a := range accept {
+				content[mimeType(a)] = map[string]interface{}{"schema": schema}
+			}
+			body := map[string]interface{}{
+				"required": p.required,
+				"content":  content,
+			}
+			if p.description != "" {
+				body["description"] = p.description
+			}
+			out["requestBody"] = body
+		case "formData":
+			schema, err := g.typeSchema(pkg, file, p.typ)
+			if err != nil {
+				return nil, err
+			}
+			body, _ := out["requestBody"].(map[string]interface{})
+			if body == nil {
+				body = map[string]interface{}{
+					"content": map[string]interface{}{
+						"multipart/form-data": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type":       "object",
+								"properties": map[string]interface{}{},
+							},
+						},
+					},
+				}
+				out["requestBody"] = body
+			}
+			form := body["content"].(map[string]interface{})["multipart/form-data"].(map[string]interface{})["schema"].(map[string]interface{})
+			form["properties"].(map[string]interface{})[p.name] = schema
+			if p.required {
+				required, _ := form["required"].([]string)
+				form["required"] = append(required, p.name)
+				body["required"] = true
+			}
+		default:
+			schema, err := g.typeSchema(pkg, file, p.typ)
+			if err != nil {
+				return nil, err
+			}
+			param := map[string]interface{}{
+				"name":     p.name,
+				"in":       p.in,
+				"required": p.required || p.in == "path",
+				"schema":   schema,
+			}
+			if p.description != "" {
+				param["description"] = p.description
+			}
+			parameters = append(parameters, param)
+		}
+	}
+	if len(parameters) > 0 {
+		out["parameters"] = parameters
+	}
+
+	responses := map[string]interface{}{}
+	for _, r := range op.responses {
+		description := r.description
+		if description == "" {
+			description = statusText(r.status)
+		}
+		resp := map[string]interface{}{"description": description}
+
+		var schema interface{}
+		if r.kind == "file" {
+			schema = map[string]interface{}{"type": "string", "format": "binary"}
+		} else {
+			var err error
+			if schema, err = g.typeSchema(pkg, file, r.typ); err != nil {
+				return nil, err
+			}
+		}
+		if r.kind == "array" {
+			schema = map[string]interface{}{"type": "array", "items": schema}
+		}
+
+		content := map[string]interface{}{}
+		if strings.HasSuffix(r.typ, "Problem") {
+			content["application/problem+json"] = map[string]interface{}{"schema": schema}
+		} else {
+			for _, p := range produce {
+				content[mimeType(p)] = map[string]interface{}{"schema": schema}
+			}
+		}
+		resp["content"] = content
+		responses[r.status] = resp
+	}
+	out["responses"] = responses
+	return out, nil
+}
+
+func statusText(status string) string {
+	switch status {
+	case "200":
+		return "OK"
+	case "201":
+		return "Created"
+	case "202":
+		return "Accepted"
+	case "204":
+		return "No Content"
+	case "400":
+		return "Bad Request"
+	case "401":
+		return "Unauthorized"
+	case "403":
+		return "Forbidden"
+	case "404":
+		return "Not Found"
+	case "409":
+		return "Conflict"
+	case "413":
+		return "Payload Too Large"
+	case "423":
+		return "Locked"
+	case "500":
+		return "Internal Server Error"
+	default:
+		return "Response"
+	}
+}
+
+// typeSchema resolves an annotation type such as "string", "file",
+// "RegisterRequest" or "api.Problem" into a schema or component reference.
+func (g *generator) typeSchema(pkg *pkgInfo, file *ast.File, name string) (interface{}, error) {
+	if strings.HasPrefix(name, "[]") {
+		items, err := g.typeSchema(pkg, file, name[2:])
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	}
+	if s, ok := primitiveSchema(name); ok {
+		return s, nil
+	}
+	if name == "file" {
+		return map[string]interface{}{"type": "string", "format": "binary"}, nil
+	}
+
+	target := pkg
+	typeName := name
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		dir, ok := pkg.imports[file][name[:i]]
+		if !ok {
+			return nil, fmt.Errorf("unknown package %q", name[:i])
+		}
+		p, err := g.loadPackage(dir)
+		if err != nil {
+			return nil, err
+		}
+		target = p
+		typeName = name[i+1:]
+	}
+	return g.namedSchema(target, typeName)
+}
+
+func (g *generator) namedSchema(pkg *pkgInfo, name string) (interface{}, error) {
+	ts, ok := pkg.types[name]
+	if !ok {
+		return nil, fmt.Errorf("type %s not found in %s", name, pkg.dir)
+	}
+
+	// Aliases and named primitives are inlined rather than referenced
+	if _, isStruct := ts.Type.(*ast.StructType); !isStruct {
+		return g.exprSchema(pkg, pkg.files[ts], ts.Type)
+	}
+
+	ref := map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	if _, done := g.schemas[name]; done {
+		return ref, nil
+	}
+	// Reserve the name first so self-referencing types terminate
+	g.schemas[name] = map[string]interface{}{}
+	schema, err := g.structSchema(pkg, pkg.files[ts], ts.Type.(*ast.StructType))
+	if err != nil {
+		return nil, err
+	}
+	if doc := typeDoc(pkg.files[ts], ts); doc != "" {
+		schema["description"] = doc
+	}
+	g.schemas[name] = schema
+	return ref, nil
+}
+
+func typeDoc(file *ast.File, ts *ast.TypeSpec) string {
+	if ts.Doc != nil {
+		return strings.TrimSpace(ts.Doc.Text())
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Doc == nil || len(gen.Specs) != 1 || gen.Specs[0] != ts {
+			continue
+		}
+		return strings.TrimSpace(gen.Doc.Text())
+	}
+	return ""
+}
+
+func (g *generator) structSchema(pkg *pkgInfo, file *ast.File, st *ast.StructType) (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for _, field := range st.Fields.List {
+		tag := reflectTag(field)
+		jsonName := strings.SplitN(tag.get("json"), ",", 2)[0]
+		if jsonName == "-" {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			// Embedded struct: promote its properties
+			embedded, err := g.exprSchema(pkg, file, field.Type)
+			if err != nil {
+				return nil, err
+			}
+			if ref, ok := embedded.(map[string]interface{})["$ref"].(string); ok {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				if s, ok := g.schemas[name].(map[string]interface{}); ok {
+					for k, v := range s["properties"].(map[string]interface{}) {
+						properties[k] = v
+					}
+					if r, ok := s["required"].([]string); ok {
+						required = append(required, r...)
+					}
+				}
+			}
+			continue
+		}
+
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			name := jsonName
+			if name == "" {
+				name = ident.Name
+			}
+
+			schema, err := g.exprSchema(pkg, file, field.Type)
+			if err != nil {
+				return nil, err
+			}
+			isRequired := applyBinding(&schema, tag.get("binding"))
+			if isRequired {
+				required = append(required, name)
+			}
+			if field.Doc != nil {
+				schema = withDescription(schema, strings.TrimSpace(field.Doc.Text()))
+			} else if field.Comment != nil {
+				schema = withDescription(schema, strings.TrimSpace(field.Comment.Text()))
+			}
+			properties[name] = schema
+		}
+	}
+
+	out := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		out["required"] = required
+	}
+	return out, nil
+}
+
+func withDescription(schema interface{}, description string) interface{} {
+	m, ok := schema.(map[string]interface{})
+	if !ok || description == "" {
+		return schema
+	}
+	if _, isRef := m["$ref"]; isRef {
+		// Siblings of $ref are ignored in OpenAPI 3.0, so wrap it
+		return map[string]interface{}{"allOf": []interface{}{m}, "description": description}
+	}
+	m["description"] = description
+	return m
+}
+
+// applyBinding copies gin binding rules onto the schema and reports whether
+// the field is required.
+func applyBinding(schema *interface{}, binding string) bool {
+	required := false
+	m, _ := (*schema).(map[string]interface{})
+	if _, isRef := m["$ref"]; isRef {
+		m = nil
+	}
+	for _, rule := range splitList(binding) {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "omitempty":
+		case "email":
+			setIf(m, "format", "email")
+		case "url":
+			setIf(m, "format", "uri")
+		case "uuid":
+			setIf(m, "format", "uuid")
+		case "numeric":
+			setIf(m, "pattern", "^[0-9]+$")
+		case "min", "max", "len", "gte", "lte":
+			n, err := strconv.Atoi(arg)
+			if err != nil || m == nil {
+				continue
+			}
+			isString := m["type"] == "string"
+			isArray := m["type"] == "array"
+			switch {
+			case isString && (name == "min" || name == "gte"):
+				m["minLength"] = n
+			case isString && (name == "max" || name == "lte"):
+				m["maxLength"] = n
+			case isString && name == "len":
+				m["minLength"], m["maxLength"] = n, n
+			case isArray && (name == "min" || name == "gte"):
+				m["minItems"] = n
+			case isArray && (name == "max" || name == "lte"):
+				m["maxItems"] = n
+			case name == "min" || name == "gte":
+				m["minimum"] = n
+			case name == "max" || name == "lte":
+				m["maximum"] = n
+			}
+		case "oneof":
+			if m != nil {
+				m["enum"] = strings.Fields(arg)
+			}
+		}
+	}
+	return required
+}
+
+func setIf(m map[string]interface{}, key string, value interface{}) {
+	if m != nil && m["type"] == "string" {
+		m[key] = value
+	}
+}
+
+func (g *generator) exprSchema(pkg *pkgInfo, file *ast.File, expr ast.Expr) (interface{}, error) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if s, ok := primitiveSchema(t.Name); ok {
+			return s, nil
+		}
+		if t.Name == "any" {
+			return map[string]interface{}{}, nil
+		}
+		return g.namedSchema(pkg, t.Name)
+	case *ast.StarExpr:
+		return g.exprSchema(pkg, file, t.X)
+	case *ast.ArrayType:
+		if ident, ok := t.Elt.(*ast.Ident); ok && ident.Name == "byte" {
+			return map[string]interface{}{"type": "string", "format": "byte"}, nil
+		}
+		items, err := g.exprSchema(pkg, file, t.Elt)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case *ast.MapType:
+		values, err := g.exprSchema(pkg, file, t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": values}, nil
+	case *ast.InterfaceType:
+		return map[string]interface{}{}, nil
+	case *ast.StructType:
+		return g.structSchema(pkg, file, t)
+	case *ast.SelectorExpr:
+		qualifier := t.X.(*ast.Ident).Name
+		switch qualifier + "." + t.Sel.Name {
+		case "time.Time":
+			return map[string]interface{}{"type": "string", "format": "date-time"}, nil
+		case "time.Duration":
+			return map[string]interface{}{"type": "integer", "format": "int64"}, nil
+		case "json.RawMessage":
+			return map[string]interface{}{}, nil
+		}
+		dir, ok := pkg.imports[file][qualifier]
+		if !ok {
+			return map[string]interface{}{"type": "object"}, nil
+		}
+		p, err := g.loadPackage(dir)
+		if err != nil {
+			return nil, err
+		}
+		return g.namedSchema(p, t.Sel.Name)
+	default:
+		return map[string]interface{}{}, nil
+	}
+}
+
+func primitiveSchema(name string) (map[string]interface{}, bool) {
+	switch name {
+	case "string":
+		return map[string]interface{}{"type": "string"}, true
+	case "bool", "boolean":
+		return map[string]interface{}{"type": "boolean"}, true
+	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "integer":
+		return map[string]interface{}{"type": "integer"}, true
+	case "int64", "uint64":
+		return map[string]interface{}{"type": "integer", "format": "int64"}, true
+	case "float32", "float64", "number":
+		return map[string]interface{}{"type": "number"}, true
+	default:
+		return nil, false
+	}
+}
+
+type structTag string
+
+func reflectTag(field *ast.Field) structTag {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, _ := strconv.Unquote(field.Tag.Value)
+	return structTag(tag)
+}
+
+// get mirrors reflect.StructTag.Get without needing the runtime type.
+func (t structTag) get(key string) string {
+	tag := string(t)
+	for tag != "" {
+		tag = strings.TrimLeft(tag, " ")
+		i := strings.Index(tag, ":")
+		if i <= 0 || i+1 >= len(tag) || tag[i+1] != '"' {
+			return ""
+		}
+		name := tag[:i]
+		tag = tag[i+1:]
+		j := 1
+		for j < len(tag) && tag[j] != '"' {
+			if tag[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j >= len(tag) {
+			return ""
+		}
+		value, err := strconv.Unquote(tag[:j+1])
+		tag = tag[j+1:]
+		if name == key && err == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
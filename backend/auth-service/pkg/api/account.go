@@ -0,0 +1,45 @@
+// auth-service/pkg/api/account.go
+package api
+
+import "time"
+
+type DeleteAccountRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+type AccountDeletionResponse struct {
+	Message      string    `json:"message"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// ExportSession is a session as it appears in a data export. Tokens are
+// omitted.
+type ExportSession struct {
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ExportLoginEvent struct {
+	Method    string    `json:"method"`
+	Success   bool      `json:"success"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportAuditEntry struct {
+	Action    string    `json:"action"`
+	Changes   any       `json:"changes"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportManifest is the manifest.json at the root of a data export archive.
+type ExportManifest struct {
+	UserID      uint      `json:"user_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Files       []string  `json:"files"`
+}
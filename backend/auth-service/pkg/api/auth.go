@@ -0,0 +1,57 @@
+// auth-service/pkg/api/auth.go
+//
+// Package api holds the request and response bodies of the auth-service
+// HTTP API. It is shared by the handlers, the generated OpenAPI document and
+// the Go client, so it must not import anything beyond the standard library.
+package api
+
+type RegisterRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8"`
+}
+
+type RegisterResponse struct {
+	Message string `json:"message"`
+	UserID  uint   `json:"user_id"`
+}
+
+type VerifyOTPRequest struct {
+	UserID string `json:"user_id" binding:"required,numeric"`
+	Code   string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type VerifyOTPResponse struct {
+	Message string `json:"message"`
+}
+
+type MFASetupResponse struct {
+	Secret string `json:"secret"`
+	QRCode string `json:"qr_code"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	// TOTP code, required for accounts with MFA enabled; without it they
+	// get an mfa_required problem
+	MFACode string `json:"mfa_code" binding:"omitempty,len=6,numeric"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	Code        string `json:"code" binding:"required,len=6,numeric"`
+	NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+type LoginResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
@@ -0,0 +1,23 @@
+// auth-service/pkg/api/events.go
+package api
+
+import "time"
+
+// UserEventsStream is the Redis stream auth-service publishes account
+// lifecycle events to. Consumers should read it with their own consumer
+// group so each service processes every event once.
+const UserEventsStream = "auth:user-events"
+
+// Event types published on UserEventsStream. Each stream entry carries the
+// type in the "type" field and the JSON payload in the "payload" field.
+const (
+	EventUserDeleted = "user.deleted"
+)
+
+// UserDeletedEvent tells other services to purge everything they hold
+// about UserID. The user row in auth-service has already been anonymized.
+type UserDeletedEvent struct {
+	UserID      uint      `json:"user_id"`
+	RequestedAt time.Time `json:"requested_at"`
+	DeletedAt   time.Time `json:"deleted_at"`
+}
@@ -0,0 +1,67 @@
+// auth-service/pkg/api/profile.go
+package api
+
+import "time"
+
+type Profile struct {
+	ID               uint      `json:"id"`
+	Email            string    `json:"email"`
+	PendingEmail     string    `json:"pending_email,omitempty"`
+	EmailVerified    bool      `json:"email_verified"`
+	FirstName        string    `json:"first_name"`
+	LastName         string    `json:"last_name"`
+	Role             string    `json:"role"`
+	Church           string    `json:"church"`
+	MinistryRole     string    `json:"ministry_role"`
+	Country          string    `json:"country"`
+	Language         string    `json:"language"`
+	Bio              string    `json:"bio"`
+	OrdinationStatus string    `json:"ordination_status"`
+	AvatarURL        string    `json:"avatar_url"`
+	MFAEnabled       bool      `json:"mfa_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+	// Set while an account deletion is pending and can still be cancelled
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// UpdateProfileRequest is a partial update: omitted fields are unchanged.
+type UpdateProfileRequest struct {
+	FirstName    *string `json:"first_name" binding:"omitempty,max=100"`
+	LastName     *string `json:"last_name" binding:"omitempty,max=100"`
+	Church       *string `json:"church" binding:"omitempty,max=200"`
+	MinistryRole *string `json:"ministry_role" binding:"omitempty,max=100"`
+	// ISO 3166-1 alpha-2 country code
+	Country *string `json:"country" binding:"omitempty,iso3166_1_alpha2"`
+	// BCP 47 language tag, e.g. "en", "fr", "sw", "pt-BR"
+	Language         *string `json:"language" binding:"omitempty,bcp47_language_tag"`
+	Bio              *string `json:"bio" binding:"omitempty,max=2000"`
+	OrdinationStatus *string `json:"ordination_status" binding:"omitempty,oneof=not_ordained licensed commissioned ordained"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail        string `json:"new_email" binding:"required,email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+type ConfirmEmailRequest struct {
+	Code string `json:"code" binding:"required,len=6,numeric"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,nefield=CurrentPassword"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// UserContact is what other services need to write to a user. It is only
+// served to them, never to users.
+type UserContact struct {
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Language  string `json:"language"`
+}
@@ -0,0 +1,125 @@
+// auth-service/pkg/apperror/errors.go
+package apperror
+
+import (
+	"auth-service/pkg/api"
+	"errors"
+	"net/http"
+)
+
+// Code is the stable, machine-readable identifier clients switch on to
+// localize a failure. Codes are part of the public API: never rename one.
+type Code string
+
+const (
+	CodeValidationFailed   Code = "validation_failed"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeOTPInvalid         Code = "otp_invalid"
+	CodeOTPExpired         Code = "otp_expired"
+	CodeMFARequired        Code = "mfa_required"
+	CodeMFAInvalid         Code = "mfa_invalid"
+	CodeAccountLocked      Code = "account_locked"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeForbidden          Code = "forbidden"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodePayloadTooLarge    Code = "payload_too_large"
+	CodeInternal           Code = "internal_error"
+)
+
+// Error is a domain error that knows how it should be presented over HTTP.
+// Err holds the underlying cause for logging and is never sent to clients.
+type Error struct {
+	Code   Code
+	Status int
+	Title  string
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError describes a single invalid request field.
+type FieldError = api.FieldError
+
+var (
+	ErrValidation         = New(CodeValidationFailed, http.StatusBadRequest, "Request validation failed")
+	ErrInvalidCredentials = New(CodeInvalidCredentials, http.StatusUnauthorized, "Invalid credentials")
+	ErrOTPInvalid         = New(CodeOTPInvalid, http.StatusBadRequest, "Invalid verification code")
+	ErrOTPExpired         = New(CodeOTPExpired, http.StatusBadRequest, "Verification code has expired")
+	ErrMFARequired        = New(CodeMFARequired, http.StatusUnauthorized, "Multi-factor authentication required")
+	ErrMFAInvalid         = New(CodeMFAInvalid, http.StatusUnauthorized, "Invalid MFA code")
+	ErrAccountLocked      = New(CodeAccountLocked, http.StatusLocked, "Account is temporarily locked")
+	ErrUnauthorized       = New(CodeUnauthorized, http.StatusUnauthorized, "Authentication required")
+	ErrForbidden          = New(CodeForbidden, http.StatusForbidden, "Access denied")
+	ErrNotFound           = New(CodeNotFound, http.StatusNotFound, "Resource not found")
+	ErrConflict           = New(CodeConflict, http.StatusConflict, "Resource already exists")
+	ErrPayloadTooLarge    = New(CodePayloadTooLarge, http.StatusRequestEntityTooLarge, "Payload too large")
+	ErrInternal           = New(CodeInternal, http.StatusInternalServerError, "Internal server error")
+)
+
+func New(code Code, status int, title string) *Error {
+	return &Error{Code: code, Status: status, Title: title}
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code) + ": " + e.Title
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches on Code so errors.Is(err, ErrOTPExpired) holds for any copy
+// produced by WithDetail or Wrap.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail returns a copy carrying a client-safe explanation.
+func (e *Error) WithDetail(detail string) *Error {
+	cp := *e
+	cp.Detail = detail
+	return &cp
+}
+
+// WithFields returns a copy carrying per-field validation messages.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	cp := *e
+	cp.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+	return &cp
+}
+
+// Wrap returns a copy recording err as the internal cause.
+func (e *Error) Wrap(err error) *Error {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+// Validation builds a validation_failed error for the given fields.
+func Validation(fields ...FieldError) *Error {
+	return ErrValidation.WithFields(fields...)
+}
+
+// Internal wraps an unexpected error so its message stays server-side.
+func Internal(err error) *Error {
+	return ErrInternal.Wrap(err)
+}
+
+// From converts any error into an *Error, treating unknown errors as
+// internal failures.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
@@ -0,0 +1,116 @@
+// auth-service/pkg/apperror/validation.go
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report fields by their JSON names so clients can map errors to inputs
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// FromBinding turns an error from c.ShouldBind* into a validation_failed
+// error with per-field details, without echoing decoder internals.
+func FromBinding(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fe.Field(),
+				Code:    fe.Tag(),
+				Message: fieldMessage(fe),
+			})
+		}
+		return Validation(fields...).Wrap(err)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return Validation(FieldError{
+			Field:   typeErr.Field,
+			Code:    "type",
+			Message: fmt.Sprintf("must be of type %s", jsonTypeName(typeErr.Type)),
+		}).Wrap(err)
+	}
+
+	if errors.Is(err, io.EOF) {
+		return ErrValidation.WithDetail("Request body is empty").Wrap(err)
+	}
+
+	return ErrValidation.WithDetail("Request body is malformed").Wrap(err)
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "len":
+		return fmt.Sprintf("must be exactly %s characters long", fe.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "eqfield":
+		return fmt.Sprintf("must match %s", fe.Param())
+	case "nefield":
+		return fmt.Sprintf("must differ from %s", fe.Param())
+	case "url":
+		return "must be a valid URL"
+	case "iso3166_1_alpha2":
+		return "must be a two-letter ISO 3166 country code"
+	case "bcp47_language_tag":
+		return "must be a valid BCP 47 language tag"
+	default:
+		return "is invalid"
+	}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
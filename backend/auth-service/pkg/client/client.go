@@ -0,0 +1,251 @@
+// auth-service/pkg/client/client.go
+//
+// Package client is a typed Go client for the auth-service HTTP API, for use
+// by the other backend services and by integration tests. It only depends on
+// the api package and the standard library.
+package client
+
+import (
+	"auth-service/pkg/api"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultBasePath = "/api/v1/auth"
+
+// Client calls auth-service. It is safe for concurrent use.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	token        string
+	serviceToken string
+	requestID    func(ctx context.Context) string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient replaces the default client, which has a 15 second timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = hc
+	}
+}
+
+// WithBearerToken authenticates every request with the given access token.
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithServiceToken authenticates as a backend service, for the internal
+// endpoints such as UserContact.
+func WithServiceToken(token string) Option {
+	return func(c *Client) {
+		c.serviceToken = token
+	}
+}
+
+// WithRequestID propagates a correlation ID from the caller's context as
+// X-Request-ID so auth-service logs line up with the caller's.
+func WithRequestID(fn func(ctx context.Context) string) Option {
+	return func(c *Client) {
+		c.requestID = fn
+	}
+}
+
+// New returns a client for the API rooted at baseURL, which includes the
+// base path, e.g. "http://auth-service:8080" + DefaultBasePath.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithToken returns a copy of the client that authenticates as token.
+func (c *Client) WithToken(token string) *Client {
+	cp := *c
+	cp.token = token
+	return &cp
+}
+
+// Error is returned for any non-2xx response. Problem is populated from the
+// problem+json body when the service sent one.
+type Error struct {
+	StatusCode int
+	Problem    api.Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Code == "" {
+		return fmt.Sprintf("auth-service: HTTP %d", e.StatusCode)
+	}
+	msg := fmt.Sprintf("auth-service: HTTP %d %s: %s", e.StatusCode, e.Problem.Code, e.Problem.Title)
+	if e.Problem.Detail != "" {
+		msg += ": " + e.Problem.Detail
+	}
+	return msg
+}
+
+// ErrorCode returns the machine-readable problem code of err, or "" if err
+// did not come from an auth-service error response.
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Problem.Code
+	}
+	return ""
+}
+
+// Register creates an account and triggers the verification email.
+func (c *Client) Register(ctx context.Context, req api.RegisterRequest) (*api.RegisterResponse, error) {
+	var resp api.RegisterResponse
+	if err := c.do(ctx, http.MethodPost, "/register", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// VerifyOTP confirms the email verification code.
+func (c *Client) VerifyOTP(ctx context.Context, req api.VerifyOTPRequest) (*api.VerifyOTPResponse, error) {
+	var resp api.VerifyOTPResponse
+	if err := c.do(ctx, http.MethodPost, "/verify-otp", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetupMFA enables TOTP for the authenticated user.
+func (c *Client) SetupMFA(ctx context.Context) (*api.MFASetupResponse, error) {
+	var resp api.MFASetupResponse
+	if err := c.do(ctx, http.MethodPost, "/setup-mfa", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Login signs in with email and password, and the TOTP code for accounts
+// with MFA enabled.
+func (c *Client) Login(ctx context.Context, req api.LoginRequest) (*api.LoginResponse, error) {
+	var resp api.LoginResponse
+	if err := c.do(ctx, http.MethodPost, "/login", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair.
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (*api.LoginResponse, error) {
+	var resp api.LoginResponse
+	if err := c.do(ctx, http.MethodPost, "/refresh", api.RefreshTokenRequest{RefreshToken: refreshToken}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ForgotPassword mails a password reset code to the account using email.
+func (c *Client) ForgotPassword(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/forgot-password", api.ForgotPasswordRequest{Email: email}, nil)
+}
+
+// ResetPassword sets a new password with a code from ForgotPassword.
+func (c *Client) ResetPassword(ctx context.Context, req api.ResetPasswordRequest) error {
+	return c.do(ctx, http.MethodPost, "/reset-password", req, nil)
+}
+
+// UserContact looks up where to write to a user. It needs a client made
+// WithServiceToken; deleted users are a 404.
+func (c *Client) UserContact(ctx context.Context, userID uint) (*api.UserContact, error) {
+	var resp api.UserContact
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/internal/users/%d/contact", userID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// OpenAPI fetches the service's OpenAPI document.
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var resp json.RawMessage
+	if err := c.do(ctx, http.MethodGet, "/openapi.json", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	if body == nil {
+		return c.doRaw(ctx, method, path, "", nil, out)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("auth-service: encode request: %w", err)
+	}
+	return c.doRaw(ctx, method, path, "application/json", bytes.NewReader(data), out)
+}
+
+func (c *Client) doRaw(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("auth-service: decode response: %w", err)
+	}
+	return nil
+}
+
+// send adds authentication and correlation headers and performs req.
+func (c *Client) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.serviceToken != "" {
+		req.Header.Set("X-Service-Token", c.serviceToken)
+	}
+	if c.requestID != nil {
+		if id := c.requestID(ctx); id != "" {
+			req.Header.Set("X-Request-ID", id)
+		}
+	}
+	return c.httpClient.Do(req)
+}
+
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" || mediaType == "application/json" {
+		// A body that isn't a problem document still yields a usable Error
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&apiErr.Problem)
+	}
+	return apiErr
+}
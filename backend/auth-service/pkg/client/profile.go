@@ -0,0 +1,110 @@
+// auth-service/pkg/client/profile.go
+package client
+
+import (
+	"auth-service/pkg/api"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+func (c *Client) GetProfile(ctx context.Context) (*api.Profile, error) {
+	var resp api.Profile
+	if err := c.do(ctx, http.MethodGet, "/profile", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) UpdateProfile(ctx context.Context, req api.UpdateProfileRequest) (*api.Profile, error) {
+	var resp api.Profile
+	if err := c.do(ctx, http.MethodPatch, "/profile", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UploadAvatar sends image as the caller's avatar. filename is only used
+// for the multipart envelope; the service sniffs the actual format.
+func (c *Client) UploadAvatar(ctx context.Context, filename string, image io.Reader) (*api.Profile, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("avatar", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, image); err != nil {
+		return nil, fmt.Errorf("auth-service: read avatar: %w", err)
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	var resp api.Profile
+	if err := c.doRaw(ctx, http.MethodPost, "/profile/avatar", form.FormDataContentType(), &body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ChangeEmail(ctx context.Context, req api.ChangeEmailRequest) (*api.MessageResponse, error) {
+	var resp api.MessageResponse
+	if err := c.do(ctx, http.MethodPost, "/profile/email", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ConfirmEmailChange(ctx context.Context, req api.ConfirmEmailRequest) (*api.Profile, error) {
+	var resp api.Profile
+	if err := c.do(ctx, http.MethodPost, "/profile/email/confirm", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) ChangePassword(ctx context.Context, req api.ChangePasswordRequest) (*api.MessageResponse, error) {
+	var resp api.MessageResponse
+	if err := c.do(ctx, http.MethodPost, "/profile/password", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ExportAccountData writes the caller's data export ZIP archive to w.
+func (c *Client) ExportAccountData(ctx context.Context, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/profile/export", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *Client) RequestAccountDeletion(ctx context.Context, req api.DeleteAccountRequest) (*api.AccountDeletionResponse, error) {
+	var resp api.AccountDeletionResponse
+	if err := c.do(ctx, http.MethodPost, "/profile/deletion", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) CancelAccountDeletion(ctx context.Context) (*api.MessageResponse, error) {
+	var resp api.MessageResponse
+	if err := c.do(ctx, http.MethodDelete, "/profile/deletion", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
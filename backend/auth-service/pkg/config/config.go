@@ -3,6 +3,7 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -25,6 +26,9 @@ type Configuration struct {
 	JWT      JWTConfig      `mapstructure:"jwt"`
 	Email    EmailConfig    `mapstructure:"email"`
 	Security SecurityConfig `mapstructure:"security"`
+	Log      LogConfig      `mapstructure:"log"`
+	Uploads  UploadsConfig  `mapstructure:"uploads"`
+	Internal InternalConfig `mapstructure:"internal"`
 }
 
 type ServerConfig struct {
@@ -71,6 +75,29 @@ type SecurityConfig struct {
 	OTPExpiryTime      time.Duration `mapstructure:"otp_expiry_time"`
 	PasswordMinLength  int           `mapstructure:"password_min_length"`
 	MFABackupCodeCount int           `mapstructure:"mfa_backup_code_count"`
+	// Wrong codes after which an OTP is discarded
+	MaxOTPAttempts int `mapstructure:"max_otp_attempts"`
+	// How long a requested account deletion can still be cancelled
+	DeletionGracePeriod time.Duration `mapstructure:"deletion_grace_period"`
+	// How often due deletions are processed and pending events relayed
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+type UploadsConfig struct {
+	AvatarDir     string `mapstructure:"avatar_dir"`
+	AvatarBaseURL string `mapstructure:"avatar_base_url"`
+	MaxAvatarSize int64  `mapstructure:"max_avatar_size"`
+}
+
+type InternalConfig struct {
+	// Shared with the other backend services, which send it as
+	// X-Service-Token to reach the /internal routes. Empty disables them.
+	ServiceToken string `mapstructure:"service_token"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
 }
 
 func LoadConfig() error {
@@ -91,6 +118,10 @@ func LoadConfig() error {
 		return fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if token := os.Getenv("INTERNAL_SERVICE_TOKEN"); token != "" {
+		Config.Internal.ServiceToken = token
+	}
+
 	setupLogger()
 	return nil
 }
@@ -107,4 +138,16 @@ func setupLogger() {
 		})
 		Log.SetLevel(logrus.DebugLevel)
 	}
+
+	if Config.Log.Format == "json" {
+		Log.SetFormatter(&logrus.JSONFormatter{})
+	}
+	if Config.Log.Level != "" {
+		if level, err := logrus.ParseLevel(Config.Log.Level); err == nil {
+			Log.SetLevel(level)
+		}
+	}
+
+	// Scrub credentials before any formatter sees the entry
+	Log.AddHook(&redactHook{})
 }
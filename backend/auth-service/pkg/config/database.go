@@ -47,5 +47,8 @@ func autoMigrate(db *gorm.DB) error {
 		&models.User{},
 		&models.OTP{},
 		&models.Session{},
+		&models.AuditLog{},
+		&models.LoginEvent{},
+		&models.OutboxEvent{},
 	)
 }
@@ -0,0 +1,91 @@
+// auth-service/pkg/handlers/account_handler.go
+package handlers
+
+import (
+	"auth-service/pkg/api"
+	"auth-service/pkg/apperror"
+	"auth-service/pkg/services"
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Export account data
+// @ID exportAccountData
+// @Description Download a ZIP archive of everything auth-service holds about the authenticated user: profile, sessions, login history and audit log.
+// @Tags account
+// @Produce zip
+// @Security Bearer
+// @Success 200 {file} binary
+// @Failure 401 {object} api.Problem
+// @Router /profile/export [get]
+func ExportAccountData(c *gin.Context) {
+	userID := c.GetUint("userID")
+
+	// Build the archive in memory so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	if err := services.ExportUserData(&buf, userID, auditContext(c)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("account-%d-%s.zip", userID, time.Now().UTC().Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// @Summary Request account deletion
+// @ID requestAccountDeletion
+// @Description Schedule the account for deletion after the grace period. All sessions are signed out. Personal data is anonymized when the grace period ends unless the request is cancelled.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.DeleteAccountRequest true "Current password"
+// @Success 202 {object} api.AccountDeletionResponse
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /profile/deletion [post]
+func RequestAccountDeletion(c *gin.Context) {
+	var req api.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	scheduled, err := services.RequestAccountDeletion(c.GetUint("userID"), req.CurrentPassword, auditContext(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, api.AccountDeletionResponse{
+		Message:      "Account scheduled for deletion.",
+		ScheduledFor: scheduled,
+	})
+}
+
+// @Summary Cancel account deletion
+// @ID cancelAccountDeletion
+// @Description Cancel a pending account deletion during the grace period
+// @Tags account
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} api.MessageResponse
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /profile/deletion [delete]
+func CancelAccountDeletion(c *gin.Context) {
+	if err := services.CancelAccountDeletion(c.GetUint("userID"), auditContext(c)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.MessageResponse{
+		Message: "Account deletion cancelled.",
+	})
+}
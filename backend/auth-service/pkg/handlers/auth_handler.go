@@ -2,41 +2,28 @@
 package handlers
 
 import (
+	"auth-service/pkg/api"
+	"auth-service/pkg/apperror"
 	"auth-service/pkg/services"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error"`
-}
-
-type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
-}
-
-type RegisterResponse struct {
-	Message string `json:"message"`
-	UserID  uint   `json:"user_id"`
-}
-
 // @Summary Register new user
+// @ID register
 // @Description Register a new user with email and password
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param user body RegisterRequest true "User registration details"
-// @Success 201 {object} RegisterResponse
-// @Failure 400 {object} ErrorResponse
+// @Param user body api.RegisterRequest true "User registration details"
+// @Success 201 {object} api.RegisterResponse
+// @Failure 400 {object} api.Problem
 // @Router /register [post]
 func Register(c *gin.Context) {
-	var req RegisterRequest
+	var req api.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		// ErrorResponse is a struct, no need to assign it
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		apperror.RespondBinding(c, err)
 		return
 	}
 
@@ -45,156 +32,191 @@ func Register(c *gin.Context) {
 		Password: req.Password,
 	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		apperror.Respond(c, err)
 		return
 	}
 
 	// Generate and send OTP
 	otp, err := services.GenerateOTP(user.ID, "verification")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to generate OTP"})
+		apperror.Respond(c, err)
 		return
 	}
 
 	// Send OTP via email
 	go services.SendVerificationEmail(user.Email, otp.Code)
 
-	c.JSON(http.StatusCreated, RegisterResponse{
+	c.JSON(http.StatusCreated, api.RegisterResponse{
 		Message: "Registration successful. Please verify your email.",
 		UserID:  user.ID,
 	})
 }
 
 // @Summary Verify OTP
-// @Description Verify OTP code sent to email
+// @ID verifyOTP
+// @Description Verify the email with the OTP code sent to it. The code is discarded after security.max_otp_attempts wrong tries.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param data body VerifyOTPRequest true "OTP verification data"
-// @Success 200 {object} VerifyOTPResponse
-// @Failure 400 {object} ErrorResponse
+// @Param data body api.VerifyOTPRequest true "OTP verification data"
+// @Success 200 {object} api.VerifyOTPResponse
+// @Failure 400 {object} api.Problem
 // @Router /verify-otp [post]
 func VerifyOTP(c *gin.Context) {
-	type VerifyOTPRequest struct {
-		UserID string `json:"user_id"`
-		Code   string `json:"code"`
-	}
-	var req VerifyOTPRequest
+	var req api.VerifyOTPRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		// ErrorResponse is already defined, no need to redefine it
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		apperror.RespondBinding(c, err)
 		return
 	}
 
 	if err := services.VerifyOTP(req.UserID, req.Code, "verification"); err != nil {
-		// No need to redefine ErrorResponse
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid or expired OTP"})
+		apperror.Respond(c, err)
 		return
 	}
 
-	type VerifyOTPResponse struct {
-		Message string `json:"message"`
-	}
-	c.JSON(http.StatusOK, VerifyOTPResponse{
+	c.JSON(http.StatusOK, api.VerifyOTPResponse{
 		Message: "Email verified successfully",
 	})
 }
 
 // @Summary Setup MFA
+// @ID setupMFA
 // @Description Setup Multi-Factor Authentication for user
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Security Bearer
-// @Success 200 {object} MFASetupResponse
-// @Failure 401 {object} ErrorResponse
+// @Success 200 {object} api.MFASetupResponse
+// @Failure 401 {object} api.Problem
 // @Router /setup-mfa [post]
 func SetupMFA(c *gin.Context) {
 	userID := c.GetUint("userID")
 
 	secret, qrCode, err := services.SetupMFA(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		apperror.Respond(c, err)
 		return
 	}
 
-	type MFASetupResponse struct {
-		Secret string `json:"secret"`
-		QRCode string `json:"qr_code"`
-	}
-	c.JSON(http.StatusOK, MFASetupResponse{
+	c.JSON(http.StatusOK, api.MFASetupResponse{
 		Secret: secret,
 		QRCode: qrCode,
 	})
 }
 
-// @Summary Verify MFA
-// @Description Verify MFA code during login
+// @Summary Log in
+// @ID login
+// @Description Sign in with email and password, plus the TOTP code for accounts with MFA enabled
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param data body VerifyMFARequest true "MFA verification data"
-// @Success 200 {object} LoginResponse
-// @Failure 401 {object} ErrorResponse
-// @Router /verify-mfa [post]
-func VerifyMFA(c *gin.Context) {
-	type VerifyMFARequest struct {
-		UserID string `json:"user_id"`
-		Code   string `json:"code"`
-	}
-	var req VerifyMFARequest
+// @Param data body api.LoginRequest true "Credentials"
+// @Success 200 {object} api.LoginResponse
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 423 {object} api.Problem
+// @Router /login [post]
+func Login(c *gin.Context) {
+	var req api.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		apperror.RespondBinding(c, err)
 		return
 	}
 
-	userID, err := strconv.ParseUint(req.UserID, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid user ID"})
-		return
-	}
-	tokens, err := services.VerifyMFAAndGenerateTokens(uint(userID), req.Code)
+	tokens, err := services.Login(req.Email, req.Password, req.MFACode, auditContext(c))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid MFA code"})
+		apperror.Respond(c, err)
 		return
 	}
 
-	type LoginResponse struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
-	c.JSON(http.StatusOK, LoginResponse{
+	c.JSON(http.StatusOK, api.LoginResponse{
 		AccessToken:  tokens.AccessToken,
 		RefreshToken: tokens.RefreshToken,
 	})
 }
 
-// RefreshToken handles the token refresh request
+// @Summary Refresh tokens
+// @ID refreshToken
+// @Description Exchange a refresh token for a new token pair. The old refresh token stops working.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body api.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} api.LoginResponse
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /refresh [post]
 func RefreshToken(c *gin.Context) {
-	// Implement the logic to refresh the token
-	c.JSON(http.StatusOK, gin.H{"message": "Token refreshed successfully"})
-}
+	var req api.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
 
-func Login(c *gin.Context) {
-	// Implement login logic here
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful"})
-}
+	tokens, err := services.RefreshTokens(req.RefreshToken)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
 
-// GetProfile handles the request to get the user's profile
-func GetProfile(c *gin.Context) {
-	// Implement the logic to get the user's profile
-	c.JSON(http.StatusOK, gin.H{"message": "Profile retrieved successfully"})
+	c.JSON(http.StatusOK, api.LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
 }
 
-// ForgotPassword handles the forgot password request
+// @Summary Forgot password
+// @ID forgotPassword
+// @Description Mail a password reset code to the address, if an account uses it. The response is the same either way.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body api.ForgotPasswordRequest true "Account email"
+// @Success 202 {object} api.MessageResponse
+// @Failure 400 {object} api.Problem
+// @Router /forgot-password [post]
 func ForgotPassword(c *gin.Context) {
-	// Implement the forgot password logic here
-	c.JSON(http.StatusOK, gin.H{"message": "Forgot password endpoint"})
+	var req api.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	user, otp, err := services.RequestPasswordReset(req.Email)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if otp != nil {
+		go services.SendPasswordResetEmail(user.Email, otp.Code)
+	}
+
+	c.JSON(http.StatusAccepted, api.MessageResponse{
+		Message: "If an account uses this email, a reset code has been sent to it.",
+	})
 }
 
-// ResetPassword handles the password reset request
+// @Summary Reset password
+// @ID resetPassword
+// @Description Set a new password with the code from forgot-password. Signs out all sessions.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param data body api.ResetPasswordRequest true "Reset code and new password"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.Problem
+// @Router /reset-password [post]
 func ResetPassword(c *gin.Context) {
-	// Implement the logic for resetting the password
-	c.JSON(http.StatusOK, gin.H{"message": "Password reset successful"})
+	var req api.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := services.ResetPassword(req.Email, req.Code, req.NewPassword, auditContext(c)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.MessageResponse{Message: "Password has been reset"})
 }
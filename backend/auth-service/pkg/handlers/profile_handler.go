@@ -0,0 +1,341 @@
+// auth-service/pkg/handlers/profile_handler.go
+package handlers
+
+import (
+	"auth-service/pkg/api"
+	"auth-service/pkg/apperror"
+	"auth-service/pkg/config"
+	"auth-service/pkg/middleware"
+	"auth-service/pkg/services"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var avatarExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// @Summary Get profile
+// @ID getProfile
+// @Description Get the authenticated user's profile
+// @Tags profile
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} api.Profile
+// @Failure 401 {object} api.Problem
+// @Router /profile [get]
+func GetProfile(c *gin.Context) {
+	user, err := services.GetProfile(c.GetUint("userID"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIProfile(user))
+}
+
+// @Summary Update profile
+// @ID updateProfile
+// @Description Update the authenticated user's name and ministry details. Omitted fields are unchanged.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.UpdateProfileRequest true "Fields to change"
+// @Success 200 {object} api.Profile
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /profile [patch]
+func UpdateProfile(c *gin.Context) {
+	var req api.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	user, err := services.UpdateProfile(c.GetUint("userID"), services.ProfileUpdate{
+		FirstName:        trimmed(req.FirstName),
+		LastName:         trimmed(req.LastName),
+		Church:           trimmed(req.Church),
+		MinistryRole:     trimmed(req.MinistryRole),
+		Country:          upper(req.Country),
+		Language:         trimmed(req.Language),
+		Bio:              trimmed(req.Bio),
+		OrdinationStatus: req.OrdinationStatus,
+	}, auditContext(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIProfile(user))
+}
+
+// @Summary Upload avatar
+// @ID uploadAvatar
+// @Description Upload a JPEG, PNG or WebP avatar image
+// @Tags profile
+// @Accept mpfd
+// @Produce json
+// @Security Bearer
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} api.Profile
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Router /profile/avatar [post]
+func UploadAvatar(c *gin.Context) {
+	maxSize := config.Config.Uploads.MaxAvatarSize
+	tooLarge := apperror.ErrPayloadTooLarge.WithDetail(fmt.Sprintf("Avatars may be at most %d bytes", maxSize))
+	// Leave headroom for the multipart envelope around the image
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+(1<<16))
+
+	fileHeader, err := c.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			apperror.Respond(c, tooLarge)
+			return
+		}
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "avatar", Code: "required", Message: "is required",
+		}).Wrap(err))
+		return
+	}
+	if fileHeader.Size > maxSize {
+		apperror.Respond(c, tooLarge)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	defer file.Close()
+
+	// Trust the bytes, not the client-supplied Content-Type
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		apperror.Respond(c, err)
+		return
+	}
+	ext, ok := avatarExtensions[http.DetectContentType(head[:n])]
+	if !ok {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "avatar", Code: "mimetype", Message: "must be a JPEG, PNG or WebP image",
+		}))
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	userID := c.GetUint("userID")
+	name, err := avatarFileName(userID, ext)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if err := saveAvatar(file, name); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	url := strings.TrimRight(config.Config.Uploads.AvatarBaseURL, "/") + "/" + name
+	user, err := services.SetAvatar(userID, url, auditContext(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIProfile(user))
+}
+
+// @Summary Request email change
+// @ID changeEmail
+// @Description Start changing the account email. A code is sent to the new address; the change applies once confirmed.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.ChangeEmailRequest true "New email and current password"
+// @Success 202 {object} api.MessageResponse
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /profile/email [post]
+func ChangeEmail(c *gin.Context) {
+	var req api.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	otp, err := services.RequestEmailChange(c.GetUint("userID"), req.NewEmail, req.CurrentPassword, auditContext(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	go services.SendVerificationEmail(services.NormalizeEmail(req.NewEmail), otp.Code)
+
+	c.JSON(http.StatusAccepted, api.MessageResponse{
+		Message: "Verification code sent to the new email address.",
+	})
+}
+
+// @Summary Confirm email change
+// @ID confirmEmailChange
+// @Description Confirm the pending email change with the code sent to the new address
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.ConfirmEmailRequest true "Verification code"
+// @Success 200 {object} api.Profile
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /profile/email/confirm [post]
+func ConfirmEmailChange(c *gin.Context) {
+	var req api.ConfirmEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	user, err := services.ConfirmEmailChange(c.GetUint("userID"), req.Code, auditContext(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIProfile(user))
+}
+
+// @Summary Change password
+// @ID changePassword
+// @Description Change the password. Requires the current password and signs out all sessions.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /profile/password [post]
+func ChangePassword(c *gin.Context) {
+	var req api.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := services.ChangePassword(c.GetUint("userID"), req.CurrentPassword, req.NewPassword, auditContext(c)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.MessageResponse{
+		Message: "Password changed. Please sign in again.",
+	})
+}
+
+func auditContext(c *gin.Context) services.AuditContext {
+	return services.AuditContext{
+		ActorID:   c.GetUint("userID"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		RequestID: middleware.GetRequestID(c),
+	}
+}
+
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := strings.TrimSpace(*s)
+	return &v
+}
+
+func upper(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := strings.ToUpper(strings.TrimSpace(*s))
+	return &v
+}
+
+func avatarFileName(userID uint, ext string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%s%s", userID, hex.EncodeToString(b), ext), nil
+}
+
+func saveAvatar(src io.Reader, name string) error {
+	dir := config.Config.Uploads.AvatarDir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	dst, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// @Summary Get user contact
+// @ID getUserContact
+// @Description Get the current address and name of a user, for services that mail them. Deleted users are not found.
+// @Tags internal
+// @Produce json
+// @Security Service
+// @Param id path int true "User ID"
+// @Success 200 {object} api.UserContact
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /internal/users/{id}/contact [get]
+func GetUserContact(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		apperror.Respond(c, apperror.ErrNotFound.WithDetail("User not found"))
+		return
+	}
+	user, err := services.GetProfile(uint(userID))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.UserContact{
+		ID:        user.ID,
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Language:  user.Language,
+	})
+}
@@ -0,0 +1,71 @@
+// auth-service/pkg/middleware/auth.go
+package middleware
+
+import (
+	"auth-service/pkg/apperror"
+	"auth-service/pkg/config"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthRequired validates the bearer access token issued by
+// services.GenerateTokenPair and stores the caller in the context as
+// "userID" and "role".
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		raw := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || raw == header {
+			apperror.Respond(c, apperror.ErrUnauthorized)
+			return
+		}
+
+		token, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+			}
+			return []byte(os.Getenv("JWT_SECRET")), nil
+		})
+		if err != nil || !token.Valid {
+			apperror.Respond(c, apperror.ErrUnauthorized.WithDetail("Invalid or expired access token").Wrap(err))
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			apperror.Respond(c, apperror.ErrUnauthorized)
+			return
+		}
+		// Refresh tokens carry no role and must not authorize API calls
+		role, hasRole := claims["role"].(string)
+		userID, hasUser := claims["user_id"].(float64)
+		if !hasRole || !hasUser || userID <= 0 {
+			apperror.Respond(c, apperror.ErrUnauthorized.WithDetail("Invalid access token"))
+			return
+		}
+
+		c.Set("userID", uint(userID))
+		c.Set("role", role)
+		c.Next()
+	}
+}
+
+// ServiceRequired admits other backend services, which authenticate with
+// the shared internal.service_token in the X-Service-Token header rather
+// than as a user.
+func ServiceRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expected := config.Config.Internal.ServiceToken
+		got := c.GetHeader("X-Service-Token")
+		if expected == "" || subtle.ConstantTimeCompare([]byte(got), []byte(expected)) != 1 {
+			apperror.Respond(c, apperror.ErrUnauthorized.WithDetail("Invalid service token"))
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+// auth-service/pkg/middleware/logger.go
+package middleware
+
+import (
+	"auth-service/pkg/config"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const loggerKey = "logger"
+
+// Logger writes one structured access log line per request through
+// config.Log and exposes a request-scoped entry to handlers via GetLogger.
+// It must run after RequestID.
+func Logger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		entry := config.Log.WithField("request_id", GetRequestID(c))
+		c.Set(loggerKey, entry)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		fields := logrus.Fields{
+			"method":     c.Request.Method,
+			"route":      route,
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+			"user_agent": c.Request.UserAgent(),
+			"bytes_out":  c.Writer.Size(),
+		}
+		if userID := c.GetUint("userID"); userID != 0 {
+			fields["user_id"] = userID
+		}
+		if len(c.Errors) > 0 {
+			fields["errors"] = c.Errors.ByType(gin.ErrorTypePrivate).String()
+		}
+
+		entry = entry.WithFields(fields)
+		switch status := c.Writer.Status(); {
+		case status >= http.StatusInternalServerError:
+			entry.Error("request completed")
+		case status >= http.StatusBadRequest:
+			entry.Warn("request completed")
+		default:
+			entry.Info("request completed")
+		}
+	}
+}
+
+// GetLogger returns the request-scoped log entry, carrying the request ID
+// and, once authenticated, the user ID. Falls back to config.Log outside
+// of a request.
+func GetLogger(c *gin.Context) *logrus.Entry {
+	if v, ok := c.Get(loggerKey); ok {
+		if entry, ok := v.(*logrus.Entry); ok {
+			if userID := c.GetUint("userID"); userID != 0 {
+				return entry.WithField("user_id", userID)
+			}
+			return entry
+		}
+	}
+	return logrus.NewEntry(config.Log)
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditLog records a security-relevant change to an account. Changes holds
+// a JSON object of field -> {"from", "to"} and never contains secrets.
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	UserID    uint      `gorm:"index;not null"`
+	ActorID   uint
+	Action    string `gorm:"index;not null"`
+	Changes   string `gorm:"type:jsonb"`
+	IP        string
+	UserAgent string
+	RequestID string
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it announces, then relayed to the message bus. PublishedAt stays
+// nil until the relay succeeds.
+type OutboxEvent struct {
+	ID          uint       `gorm:"primarykey"`
+	CreatedAt   time.Time  `gorm:"index"`
+	Type        string     `gorm:"not null"`
+	Payload     string     `gorm:"type:jsonb;not null"`
+	PublishedAt *time.Time `gorm:"index"`
+	Attempts    int
+	LastError   string
+}
@@ -16,14 +16,34 @@ type User struct {
     MFASecret     string
     LastLogin     time.Time
     EmailVerified bool   `gorm:"default:false"`
+
+    // Ministry profile
+    Church           string
+    MinistryRole     string
+    Country          string `gorm:"size:2"`
+    Language         string `gorm:"size:35"`
+    Bio              string `gorm:"type:text"`
+    OrdinationStatus string
+    AvatarURL        string
+
+    // Address awaiting confirmation through an "email-change" OTP
+    PendingEmail string
+
+    // Data-protection erasure: the account is anonymized once
+    // DeletionScheduledAt passes, unless the user cancels first
+    DeletionRequestedAt *time.Time
+    DeletionScheduledAt *time.Time `gorm:"index"`
+    AnonymizedAt        *time.Time
 }
 
 type OTP struct {
     gorm.Model
     UserID    uint
     Code      string
-    Type      string // "verification", "password-reset", "mfa"
+    Type      string // "verification", "password-reset", "mfa", "email-change"
     ExpiresAt time.Time
+    // Wrong codes tried against it
+    Attempts  int `gorm:"not null;default:0"`
 }
 
 type Session struct {
@@ -34,4 +54,13 @@ type Session struct {
     ExpiresAt    time.Time
     Device       string
     IP           string
-}
\ No newline at end of file
+}
+type LoginEvent struct {
+    ID        uint      `gorm:"primarykey"`
+    CreatedAt time.Time `gorm:"index"`
+    UserID    uint      `gorm:"index;not null"`
+    Method    string    // "password", "mfa"
+    Success   bool
+    IP        string
+    UserAgent string
+}
@@ -0,0 +1,217 @@
+// auth-service/pkg/services/account_service.go
+package services
+
+import (
+	"auth-service/pkg/api"
+	"auth-service/pkg/apperror"
+	"auth-service/pkg/config"
+	"auth-service/pkg/models"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RequestAccountDeletion schedules the account for anonymization after the
+// configured grace period and signs it out everywhere. The user can cancel
+// by signing in again and calling CancelAccountDeletion before then.
+func RequestAccountDeletion(userID uint, currentPassword string, actor AuditContext) (time.Time, error) {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !CheckPassword(user.Password, currentPassword) {
+		return time.Time{}, apperror.ErrInvalidCredentials.WithDetail("Current password is incorrect")
+	}
+	if user.DeletionScheduledAt != nil {
+		return *user.DeletionScheduledAt, nil
+	}
+
+	now := time.Now()
+	scheduled := now.Add(config.Config.Security.DeletionGracePeriod)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"deletion_requested_at": &now,
+			"deletion_scheduled_at": &scheduled,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	RecordAudit(userID, "account.deletion_requested", map[string]FieldChange{
+		"deletion_scheduled_at": {From: nil, To: scheduled},
+	}, actor)
+	return scheduled, nil
+}
+
+func CancelAccountDeletion(userID uint, actor AuditContext) error {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return err
+	}
+	if user.DeletionScheduledAt == nil {
+		return apperror.ErrNotFound.WithDetail("No account deletion is pending")
+	}
+
+	if err := config.DB.Model(user).Updates(map[string]interface{}{
+		"deletion_requested_at": nil,
+		"deletion_scheduled_at": nil,
+	}).Error; err != nil {
+		return err
+	}
+
+	RecordAudit(userID, "account.deletion_cancelled", map[string]FieldChange{
+		"deletion_scheduled_at": {From: *user.DeletionScheduledAt, To: nil},
+	}, actor)
+	return nil
+}
+
+// PurgeDueAccounts anonymizes every account whose grace period has passed
+// and returns how many were processed.
+func PurgeDueAccounts() (int, error) {
+	var users []models.User
+	if err := config.DB.
+		Where("deletion_scheduled_at <= ? AND anonymized_at IS NULL", time.Now()).
+		Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for i := range users {
+		if err := anonymizeUser(&users[i]); err != nil {
+			return purged, fmt.Errorf("anonymize user %d: %w", users[i].ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// anonymizeUser strips every piece of personal data from the user row,
+// removes dependent records and soft-deletes the row. The row itself is kept
+// so foreign keys held by other services stay resolvable to "deleted user".
+func anonymizeUser(user *models.User) error {
+	now := time.Now()
+	avatar := user.AvatarURL
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"email":             fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+			"password":          "",
+			"first_name":        "",
+			"last_name":         "",
+			"mfa_enabled":       false,
+			"mfa_secret":        "",
+			"email_verified":    false,
+			"church":            "",
+			"ministry_role":     "",
+			"country":           "",
+			"language":          "",
+			"bio":               "",
+			"ordination_status": "",
+			"avatar_url":        "",
+			"pending_email":     "",
+			"anonymized_at":     &now,
+		}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&models.OTP{}, &models.Session{}, &models.LoginEvent{}} {
+			if err := tx.Unscoped().Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		// Keep the audit trail of what happened, but not who from where
+		if err := tx.Model(&models.AuditLog{}).Where("user_id = ?", user.ID).Updates(map[string]interface{}{
+			"changes":    "{}",
+			"ip":         "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+
+		requestedAt := now
+		if user.DeletionRequestedAt != nil {
+			requestedAt = *user.DeletionRequestedAt
+		}
+		return EnqueueEvent(tx, api.EventUserDeleted, api.UserDeletedEvent{
+			UserID:      user.ID,
+			RequestedAt: requestedAt,
+			DeletedAt:   now,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	removeAvatar(avatar)
+	RecordAudit(user.ID, "account.anonymized", nil, AuditContext{})
+	return nil
+}
+
+func removeAvatar(avatarURL string) {
+	base := strings.TrimRight(config.Config.Uploads.AvatarBaseURL, "/") + "/"
+	if avatarURL == "" || !strings.HasPrefix(avatarURL, base) {
+		return
+	}
+	name := filepath.Base(strings.TrimPrefix(avatarURL, base))
+	path := filepath.Join(config.Config.Uploads.AvatarDir, name)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		config.Log.WithError(err).WithField("path", path).Warn("failed to remove avatar")
+	}
+}
+
+// RunAccountMaintenance processes due deletions, drops expired email
+// changes and relays outbox events every interval until ctx is cancelled.
+func RunAccountMaintenance(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := PurgeDueAccounts(); err != nil {
+			config.Log.WithError(err).Error("account purge failed")
+		} else if n > 0 {
+			config.Log.WithField("count", n).Info("anonymized deleted accounts")
+		}
+		if _, err := ExpirePendingEmails(); err != nil {
+			config.Log.WithError(err).Warn("expiring pending email changes failed")
+		}
+		if _, err := RelayEvents(ctx); err != nil {
+			config.Log.WithError(err).Warn("event relay failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RecordLogin appends to the user's login history.
+func RecordLogin(userID uint, method string, success bool, actor AuditContext) {
+	event := &models.LoginEvent{
+		UserID:    userID,
+		Method:    method,
+		Success:   success,
+		IP:        actor.IP,
+		UserAgent: actor.UserAgent,
+	}
+	if err := config.DB.Create(event).Error; err != nil {
+		config.Log.WithError(err).WithField("user_id", userID).Error("failed to record login")
+	}
+}
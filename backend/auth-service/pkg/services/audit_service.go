@@ -0,0 +1,52 @@
+// auth-service/pkg/services/audit_service.go
+package services
+
+import (
+	"auth-service/pkg/config"
+	"auth-service/pkg/models"
+	"encoding/json"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AuditContext identifies who made a change and from where.
+type AuditContext struct {
+	ActorID   uint
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// FieldChange is the before and after value of an audited field.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// RecordAudit stores an audit entry for userID. Failures are logged rather
+// than returned so auditing never blocks the change it describes.
+func RecordAudit(userID uint, action string, changes map[string]FieldChange, actor AuditContext) {
+	payload := []byte("{}")
+	if len(changes) > 0 {
+		if data, err := json.Marshal(changes); err == nil {
+			payload = data
+		}
+	}
+
+	entry := &models.AuditLog{
+		UserID:    userID,
+		ActorID:   actor.ActorID,
+		Action:    action,
+		Changes:   string(payload),
+		IP:        actor.IP,
+		UserAgent: actor.UserAgent,
+		RequestID: actor.RequestID,
+	}
+	if err := config.DB.Create(entry).Error; err != nil {
+		config.Log.WithError(err).WithFields(logrus.Fields{
+			"user_id":    userID,
+			"action":     action,
+			"request_id": actor.RequestID,
+		}).Error("failed to write audit log")
+	}
+}
@@ -2,20 +2,24 @@
 package services
 
 import (
+	"auth-service/pkg/apperror"
 	"auth-service/pkg/config"
 	"auth-service/pkg/models"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base32"
 	"errors"
 	"fmt"
 	"math/big"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-redis/redis/v8"
 	"github.com/pquerna/otp/totp"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type User struct {
@@ -97,41 +101,32 @@ type TokenPair struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func VerifyMFAAndGenerateTokens(userID uint, code string) (*TokenPair, error) {
-	var user models.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
-		return nil, err
-	}
-
-	// Verify TOTP code
-	valid := totp.Validate(code, user.MFASecret)
-	if !valid {
-		return nil, errors.New("invalid MFA code")
-	}
-
-	// Generate new token pair
-	return GenerateTokenPair(user)
-}
-
 func SendVerificationEmail(email, code string) error {
 	// Implementation for sending email with OTP
 	// You can use any email service like SendGrid, AWS SES, etc.
 	return nil
 }
 
+func SendPasswordResetEmail(email, code string) error {
+	// Implementation for sending the password reset code, through the same
+	// email service as SendVerificationEmail
+	return nil
+}
+
 // Helper function to generate JWT tokens
 func GenerateTokenPair(user models.User) (*TokenPair, error) {
 	// Generate access token
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+		"user_id":  user.ID,
+		"role":     user.Role,
+		"language": user.Language,
+		"exp":      time.Now().Add(15 * time.Minute).Unix(),
 	})
 
 	// Generate refresh token
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": user.ID,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"exp":     time.Now().Add(refreshTokenLifetime).Unix(),
 	})
 
 	accessTokenString, err := accessToken.SignedString([]byte(os.Getenv("JWT_SECRET")))
@@ -151,26 +146,101 @@ func GenerateTokenPair(user models.User) (*TokenPair, error) {
 }
 
 func RegisterUser(req RegisterRequest) (*models.User, error) {
-	// Implement the logic to register a new user
-	// For now, let's return a dummy user
-	if req.Email == "" || req.Password == "" {
-		return nil, errors.New("email and password are required")
+	var fields []apperror.FieldError
+	if req.Email == "" {
+		fields = append(fields, apperror.FieldError{Field: "email", Code: "required", Message: "is required"})
+	}
+	if req.Password == "" {
+		fields = append(fields, apperror.FieldError{Field: "password", Code: "required", Message: "is required"})
+	}
+	if len(fields) > 0 {
+		return nil, apperror.Validation(fields...)
+	}
+
+	email := NormalizeEmail(req.Email)
+	if taken, err := emailTaken(email, 0); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, apperror.ErrConflict.WithDetail("Email is already registered")
+	}
+
+	hash, err := HashPassword(req.Password)
+	if err != nil {
+		return nil, err
 	}
 
 	user := &models.User{
-		// ID:    1, // Remove or replace this line with a valid field
-		Email: req.Email,
+		Email:    email,
+		Password: hash,
+	}
+	if err := config.DB.Create(user).Error; err != nil {
+		return nil, err
 	}
 
 	return user, nil
 }
 
-// VerifyOTP verifies the OTP code for a given user and purpose
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// emailTaken reports whether another account, other than exceptUserID, uses
+// email as its address. Unconfirmed pending addresses do not reserve it, so
+// nobody can lock an owner out of their address by requesting a change to
+// it; ConfirmEmailChange checks again before the change goes through.
+func emailTaken(email string, exceptUserID uint) (bool, error) {
+	var count int64
+	err := config.DB.Model(&models.User{}).
+		Where("email = ? AND id <> ?", email, exceptUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// VerifyOTP checks code against the user's latest OTP for purpose,
+// consuming it on success; a "verification" code also marks their email
+// verified. After security.max_otp_attempts wrong codes the OTP is
+// discarded, so codes cannot be guessed.
 func VerifyOTP(userID string, code string, purpose string) error {
-	// Implement the logic to verify the OTP code
-	// For now, let's assume the OTP is always valid
-	if code == "123456" {
-		return nil
+	var failure error
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var otp models.OTP
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND type = ?", userID, purpose).
+			Order("created_at DESC").
+			First(&otp).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			failure = apperror.ErrOTPInvalid
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if time.Now().After(otp.ExpiresAt) {
+			failure = apperror.ErrOTPExpired
+			return nil
+		}
+		if subtle.ConstantTimeCompare([]byte(code), []byte(otp.Code)) != 1 {
+			// Committed along with the failure, unlike a returned error
+			failure = apperror.ErrOTPInvalid
+			otp.Attempts++
+			if limit := config.Config.Security.MaxOTPAttempts; limit > 0 && otp.Attempts >= limit {
+				failure = apperror.ErrOTPInvalid.WithDetail("Too many wrong codes; request a new one")
+				return tx.Delete(&otp).Error
+			}
+			return tx.Model(&otp).UpdateColumn("attempts", otp.Attempts).Error
+		}
+
+		if err := tx.Delete(&otp).Error; err != nil {
+			return err
+		}
+		if purpose != "verification" {
+			return nil
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("email_verified", true).Error
+	})
+	if err != nil {
+		return err
 	}
-	return errors.New("invalid or expired OTP")
+	return failure
 }
@@ -0,0 +1,71 @@
+// auth-service/pkg/services/event_service.go
+package services
+
+import (
+	"auth-service/pkg/api"
+	"auth-service/pkg/config"
+	"auth-service/pkg/models"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+const maxEventRelayBatch = 100
+
+// EnqueueEvent writes an event to the outbox inside tx, so it is only
+// published if the surrounding change commits.
+func EnqueueEvent(tx *gorm.DB, eventType string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		Type:    eventType,
+		Payload: string(data),
+	}).Error
+}
+
+// RelayEvents publishes pending outbox events to api.UserEventsStream in
+// order. It stops at the first failure so consumers never see events out of
+// order; the rest are retried on the next run.
+func RelayEvents(ctx context.Context) (int, error) {
+	var events []models.OutboxEvent
+	if err := config.DB.
+		Where("published_at IS NULL").
+		Order("id").
+		Limit(maxEventRelayBatch).
+		Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, event := range events {
+		err := config.RedisClient.XAdd(ctx, &redis.XAddArgs{
+			Stream: api.UserEventsStream,
+			Values: map[string]interface{}{
+				"type":     event.Type,
+				"payload":  event.Payload,
+				"event_id": strconv.FormatUint(uint64(event.ID), 10),
+			},
+		}).Err()
+		if err != nil {
+			config.DB.Model(&event).Updates(map[string]interface{}{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			})
+			return published, err
+		}
+
+		now := time.Now()
+		if err := config.DB.Model(&event).Update("published_at", &now).Error; err != nil {
+			// Already on the stream; consumers must tolerate the duplicate
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
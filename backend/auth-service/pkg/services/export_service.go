@@ -0,0 +1,137 @@
+// auth-service/pkg/services/export_service.go
+package services
+
+import (
+	"archive/zip"
+	"auth-service/pkg/api"
+	"auth-service/pkg/config"
+	"auth-service/pkg/models"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ExportProfile is the profile section of a data export. It adds account
+// metadata to api.Profile but never secrets such as the password hash or
+// MFA secret.
+type ExportProfile struct {
+	api.Profile
+	LastLogin           time.Time  `json:"last_login"`
+	DeletionRequestedAt *time.Time `json:"deletion_requested_at,omitempty"`
+}
+
+// ExportUserData writes a ZIP archive of everything auth-service holds about
+// the user to w: profile, sessions, login history and audit trail.
+func ExportUserData(w io.Writer, userID uint, actor AuditContext) error {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return err
+	}
+
+	var sessions []models.Session
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&sessions).Error; err != nil {
+		return err
+	}
+	var logins []models.LoginEvent
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&logins).Error; err != nil {
+		return err
+	}
+	var audits []models.AuditLog
+	if err := config.DB.Where("user_id = ?", userID).Order("created_at").Find(&audits).Error; err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", ExportProfile{
+			Profile:             ToAPIProfile(user),
+			LastLogin:           user.LastLogin,
+			DeletionRequestedAt: user.DeletionRequestedAt,
+		}},
+		{"sessions.json", exportSessions(sessions)},
+		{"login_history.json", exportLogins(logins)},
+		{"audit_log.json", exportAudits(audits)},
+	}
+
+	manifest := api.ExportManifest{UserID: userID, GeneratedAt: time.Now().UTC()}
+	for _, f := range files {
+		manifest.Files = append(manifest.Files, f.name)
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeJSONEntry(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := writeJSONEntry(archive, f.name, f.data); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	RecordAudit(userID, "account.data_exported", nil, actor)
+	return nil
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, data interface{}) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func exportSessions(sessions []models.Session) []api.ExportSession {
+	out := make([]api.ExportSession, 0, len(sessions))
+	for _, s := range sessions {
+		out = append(out, api.ExportSession{
+			Device:    s.Device,
+			IP:        s.IP,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+		})
+	}
+	return out
+}
+
+func exportLogins(logins []models.LoginEvent) []api.ExportLoginEvent {
+	out := make([]api.ExportLoginEvent, 0, len(logins))
+	for _, l := range logins {
+		out = append(out, api.ExportLoginEvent{
+			Method:    l.Method,
+			Success:   l.Success,
+			IP:        l.IP,
+			UserAgent: l.UserAgent,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	return out
+}
+
+func exportAudits(audits []models.AuditLog) []api.ExportAuditEntry {
+	out := make([]api.ExportAuditEntry, 0, len(audits))
+	for _, a := range audits {
+		var changes interface{} = json.RawMessage(a.Changes)
+		if !json.Valid([]byte(a.Changes)) {
+			changes = nil
+		}
+		out = append(out, api.ExportAuditEntry{
+			Action:    a.Action,
+			Changes:   changes,
+			IP:        a.IP,
+			UserAgent: a.UserAgent,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	return out
+}
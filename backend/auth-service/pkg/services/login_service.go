@@ -0,0 +1,220 @@
+// auth-service/pkg/services/login_service.go
+package services
+
+import (
+	"auth-service/pkg/apperror"
+	"auth-service/pkg/config"
+	"auth-service/pkg/models"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pquerna/otp/totp"
+	"gorm.io/gorm"
+)
+
+// refreshTokenLifetime matches the expiry GenerateTokenPair gives refresh
+// tokens, and is how long a session lasts without being refreshed.
+const refreshTokenLifetime = 7 * 24 * time.Hour
+
+// Login checks the password and, for accounts with MFA, the TOTP code, and
+// opens a session. Accounts with MFA get ErrMFARequired until the code is
+// sent along. Too many failed attempts within the lockout duration lock the
+// account with ErrAccountLocked until it has passed.
+func Login(email, password, mfaCode string, actor AuditContext) (*TokenPair, error) {
+	var user models.User
+	if err := config.DB.Where("email = ?", NormalizeEmail(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if until, err := lockedUntil(user.ID); err != nil {
+		return nil, err
+	} else if until != nil {
+		return nil, apperror.ErrAccountLocked.WithDetail(
+			"Too many failed sign-in attempts; try again after " + until.UTC().Format(time.RFC3339))
+	}
+
+	if !CheckPassword(user.Password, password) {
+		RecordLogin(user.ID, "password", false, actor)
+		return nil, apperror.ErrInvalidCredentials
+	}
+	method := "password"
+	if user.MFAEnabled {
+		if mfaCode == "" {
+			return nil, apperror.ErrMFARequired.WithDetail("Send the code from your authenticator app as mfa_code")
+		}
+		method = "mfa"
+		if !totp.Validate(mfaCode, user.MFASecret) {
+			RecordLogin(user.ID, method, false, actor)
+			return nil, apperror.ErrMFAInvalid
+		}
+	}
+
+	tokens, err := GenerateTokenPair(user)
+	if err != nil {
+		return nil, err
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("last_login", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Session{
+			UserID:       user.ID,
+			Token:        tokens.AccessToken,
+			RefreshToken: tokens.RefreshToken,
+			ExpiresAt:    time.Now().Add(refreshTokenLifetime),
+			Device:       actor.UserAgent,
+			IP:           actor.IP,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	RecordLogin(user.ID, method, true, actor)
+	return tokens, nil
+}
+
+// RefreshTokens exchanges the refresh token of a live session for a new
+// token pair. The old refresh token stops working, as do those of sessions
+// ended by a password change or account deletion.
+func RefreshTokens(refreshToken string) (*TokenPair, error) {
+	invalid := apperror.ErrUnauthorized.WithDetail("Invalid or expired refresh token")
+	token, err := jwt.Parse(refreshToken, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, invalid.Wrap(err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, invalid
+	}
+	// Access tokens carry a role and cannot be used to refresh
+	if _, hasRole := claims["role"]; hasRole {
+		return nil, invalid
+	}
+
+	var session models.Session
+	if err := config.DB.Where("refresh_token = ? AND expires_at > ?", refreshToken, time.Now()).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+	var user models.User
+	if err := config.DB.First(&user, session.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, invalid
+		}
+		return nil, err
+	}
+
+	tokens, err := GenerateTokenPair(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.DB.Model(&session).Updates(map[string]interface{}{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_at":    time.Now().Add(refreshTokenLifetime),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RequestPasswordReset returns the OTP to mail to email's account, or nil if
+// no account uses it; callers must not reveal which.
+func RequestPasswordReset(email string) (*models.User, *models.OTP, error) {
+	var user models.User
+	if err := config.DB.Where("email = ?", NormalizeEmail(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+	otp, err := GenerateOTP(user.ID, "password-reset")
+	if err != nil {
+		return nil, nil, err
+	}
+	return &user, otp, nil
+}
+
+// ResetPassword sets a new password with the code from
+// RequestPasswordReset and signs the user out of every session.
+func ResetPassword(email, code, newPassword string, actor AuditContext) error {
+	var user models.User
+	if err := config.DB.Where("email = ?", NormalizeEmail(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return apperror.ErrOTPInvalid
+		}
+		return err
+	}
+	if len(newPassword) < config.Config.Security.PasswordMinLength {
+		return apperror.Validation(apperror.FieldError{
+			Field:   "new_password",
+			Code:    "min",
+			Message: "must be at least " + strconv.Itoa(config.Config.Security.PasswordMinLength) + " characters long",
+		})
+	}
+	if err := VerifyOTP(strconv.FormatUint(uint64(user.ID), 10), code, "password-reset"); err != nil {
+		return err
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("password", hash).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	RecordAudit(user.ID, "password.reset", nil, actor)
+	return nil
+}
+
+// lockedUntil returns when the account unlocks if it has had
+// security.max_login_attempts failed sign-ins since its last successful
+// one, all within security.lockout_duration; nil if it is not locked.
+func lockedUntil(userID uint) (*time.Time, error) {
+	limit := config.Config.Security.MaxLoginAttempts
+	window := config.Config.Security.LockoutDuration
+	if limit <= 0 || window <= 0 {
+		return nil, nil
+	}
+
+	since := time.Now().Add(-window)
+	var lastSuccess models.LoginEvent
+	err := config.DB.Where("user_id = ? AND success", userID).Order("created_at DESC").First(&lastSuccess).Error
+	if err == nil && lastSuccess.CreatedAt.After(since) {
+		since = lastSuccess.CreatedAt
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var failures []models.LoginEvent
+	if err := config.DB.Where("user_id = ? AND NOT success AND created_at > ?", userID, since).
+		Order("created_at DESC").Limit(limit).Find(&failures).Error; err != nil {
+		return nil, err
+	}
+	if len(failures) < limit {
+		return nil, nil
+	}
+	until := failures[0].CreatedAt.Add(window)
+	return &until, nil
+}
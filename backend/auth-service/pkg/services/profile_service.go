@@ -0,0 +1,242 @@
+// auth-service/pkg/services/profile_service.go
+package services
+
+import (
+	"auth-service/pkg/api"
+	"auth-service/pkg/apperror"
+	"auth-service/pkg/config"
+	"auth-service/pkg/models"
+	"errors"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProfileUpdate is a partial update; nil fields are left unchanged.
+type ProfileUpdate struct {
+	FirstName        *string
+	LastName         *string
+	Church           *string
+	MinistryRole     *string
+	Country          *string
+	Language         *string
+	Bio              *string
+	OrdinationStatus *string
+}
+
+func GetProfile(userID uint) (*models.User, error) {
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("User not found")
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ToAPIProfile converts the user row into its public representation.
+func ToAPIProfile(user *models.User) api.Profile {
+	return api.Profile{
+		ID:                  user.ID,
+		Email:               user.Email,
+		PendingEmail:        user.PendingEmail,
+		EmailVerified:       user.EmailVerified,
+		FirstName:           user.FirstName,
+		LastName:            user.LastName,
+		Role:                user.Role,
+		Church:              user.Church,
+		MinistryRole:        user.MinistryRole,
+		Country:             user.Country,
+		Language:            user.Language,
+		Bio:                 user.Bio,
+		OrdinationStatus:    user.OrdinationStatus,
+		AvatarURL:           user.AvatarURL,
+		MFAEnabled:          user.MFAEnabled,
+		CreatedAt:           user.CreatedAt,
+		DeletionScheduledAt: user.DeletionScheduledAt,
+	}
+}
+
+func UpdateProfile(userID uint, update ProfileUpdate, actor AuditContext) (*models.User, error) {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	changes := map[string]FieldChange{}
+	apply := func(column string, current string, next *string) {
+		if next == nil || *next == current {
+			return
+		}
+		columns[column] = *next
+		changes[column] = FieldChange{From: current, To: *next}
+	}
+	apply("first_name", user.FirstName, update.FirstName)
+	apply("last_name", user.LastName, update.LastName)
+	apply("church", user.Church, update.Church)
+	apply("ministry_role", user.MinistryRole, update.MinistryRole)
+	apply("country", user.Country, update.Country)
+	apply("language", user.Language, update.Language)
+	apply("bio", user.Bio, update.Bio)
+	apply("ordination_status", user.OrdinationStatus, update.OrdinationStatus)
+
+	if len(columns) == 0 {
+		return user, nil
+	}
+
+	if err := config.DB.Model(user).Updates(columns).Error; err != nil {
+		return nil, err
+	}
+	RecordAudit(userID, "profile.updated", changes, actor)
+
+	return GetProfile(userID)
+}
+
+func SetAvatar(userID uint, avatarURL string, actor AuditContext) (*models.User, error) {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := user.AvatarURL
+	if err := config.DB.Model(user).Update("avatar_url", avatarURL).Error; err != nil {
+		return nil, err
+	}
+	RecordAudit(userID, "profile.avatar_updated", map[string]FieldChange{
+		"avatar_url": {From: previous, To: avatarURL},
+	}, actor)
+
+	user.AvatarURL = avatarURL
+	return user, nil
+}
+
+// RequestEmailChange parks newEmail as pending and returns the OTP that must
+// be sent to it. The address only changes once ConfirmEmailChange succeeds.
+func RequestEmailChange(userID uint, newEmail, currentPassword string, actor AuditContext) (*models.OTP, error) {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPassword(user.Password, currentPassword) {
+		return nil, apperror.ErrInvalidCredentials.WithDetail("Current password is incorrect")
+	}
+
+	newEmail = NormalizeEmail(newEmail)
+	if newEmail == user.Email {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "new_email", Code: "nefield", Message: "must differ from the current email",
+		})
+	}
+	if taken, err := emailTaken(newEmail, userID); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, apperror.ErrConflict.WithDetail("Email is already registered")
+	}
+
+	if err := config.DB.Model(user).Update("pending_email", newEmail).Error; err != nil {
+		return nil, err
+	}
+	otp, err := GenerateOTP(userID, "email-change")
+	if err != nil {
+		return nil, err
+	}
+
+	RecordAudit(userID, "profile.email_change_requested", map[string]FieldChange{
+		"pending_email": {From: user.PendingEmail, To: newEmail},
+	}, actor)
+	return otp, nil
+}
+
+// ExpirePendingEmails drops pending email changes whose confirmation code
+// has expired, along with the expired codes, and returns how many changes
+// were dropped.
+func ExpirePendingEmails() (int64, error) {
+	now := time.Now()
+	result := config.DB.Model(&models.User{}).
+		Where("pending_email <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM otps WHERE otps.user_id = users.id AND otps.type = ? AND otps.expires_at > ? AND otps.deleted_at IS NULL)",
+			"email-change", now).
+		Update("pending_email", "")
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := config.DB.Where("type = ? AND expires_at <= ?", "email-change", now).Delete(&models.OTP{}).Error; err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+func ConfirmEmailChange(userID uint, code string, actor AuditContext) (*models.User, error) {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.PendingEmail == "" {
+		return nil, apperror.ErrNotFound.WithDetail("No email change is pending")
+	}
+
+	if err := VerifyOTP(strconv.FormatUint(uint64(userID), 10), code, "email-change"); err != nil {
+		return nil, err
+	}
+
+	// Someone may have claimed the address while the code was in flight
+	if taken, err := emailTaken(user.PendingEmail, userID); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, apperror.ErrConflict.WithDetail("Email is already registered")
+	}
+
+	previous, next := user.Email, user.PendingEmail
+	if err := config.DB.Model(user).Updates(map[string]interface{}{
+		"email":          next,
+		"pending_email":  "",
+		"email_verified": true,
+	}).Error; err != nil {
+		return nil, err
+	}
+	RecordAudit(userID, "profile.email_changed", map[string]FieldChange{
+		"email": {From: previous, To: next},
+	}, actor)
+
+	return GetProfile(userID)
+}
+
+// ChangePassword replaces the password after checking the current one and
+// signs the user out of every existing session.
+func ChangePassword(userID uint, currentPassword, newPassword string, actor AuditContext) error {
+	user, err := GetProfile(userID)
+	if err != nil {
+		return err
+	}
+	if !CheckPassword(user.Password, currentPassword) {
+		return apperror.ErrInvalidCredentials.WithDetail("Current password is incorrect")
+	}
+	if len(newPassword) < config.Config.Security.PasswordMinLength {
+		return apperror.Validation(apperror.FieldError{
+			Field:   "new_password",
+			Code:    "min",
+			Message: "must be at least " + strconv.Itoa(config.Config.Security.PasswordMinLength) + " characters long",
+		})
+	}
+
+	hash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", hash).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	RecordAudit(userID, "profile.password_changed", nil, actor)
+	return nil
+}
@@ -0,0 +1,268 @@
+// media-service/cmd/main.go
+package main
+
+import (
+	"context"
+	"log"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/handlers"
+	"shepherdsfold/media-service/pkg/middleware"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @title Church Training Platform Media API
+// @version 1.0
+// @description Catalog, search, resumable uploads, streaming, captions, collections, live sessions and calendar feeds of audio, video and document teaching content
+// @host localhost:8081
+// @BasePath /api/media
+// @securityDefinitions.apikey Bearer
+// @in header
+// @name Authorization
+func main() {
+	if err := config.LoadConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if _, err := config.SetupDatabase(); err != nil {
+		log.Fatalf("Failed to set up database: %v", err)
+	}
+	if _, err := config.SetupRedis(); err != nil {
+		log.Fatalf("Failed to set up Redis: %v", err)
+	}
+	if _, err := config.SetupStorage(); err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+	services.RegisterStorageMaintenance()
+
+	if _, err := config.SetupLicenseKey(); err != nil {
+		log.Fatalf("Failed to set up offline license key: %v", err)
+	}
+	if err := config.SetupStreamSigningKey(); err != nil {
+		log.Fatalf("Failed to set up stream signing key: %v", err)
+	}
+	if err := config.SetupCalendarFeedKey(); err != nil {
+		log.Fatalf("Failed to set up calendar feed key: %v", err)
+	}
+
+	if _, err := config.SetupEncoder(); err != nil {
+		config.Log.WithError(err).Warn("No encoder available; uploaded media will stay queued for processing")
+	} else {
+		services.RegisterMediaProcessing()
+	}
+
+	if transcriber, err := config.SetupTranscriber(); err != nil {
+		config.Log.WithError(err).Warn("Speech-to-text unavailable; automatic captions are disabled")
+	} else if transcriber != nil {
+		services.RegisterCaptionDrafting()
+	}
+
+	if scanner, err := config.SetupScanner(); err != nil {
+		config.Log.WithError(err).Warn("Virus scanner unavailable; attachments will stay pending until it is")
+	} else if scanner != nil {
+		services.RegisterAttachmentScanning()
+	}
+	if previewer, err := config.SetupPreviewer(); err != nil {
+		config.Log.WithError(err).Warn("Document tools unavailable; attachments will have no previews")
+	} else if previewer != nil {
+		services.RegisterAttachmentPreviews()
+	}
+
+	if index, err := config.SetupSearch(); err != nil {
+		config.Log.WithError(err).Warn("Search index unavailable; search is disabled")
+	} else if index != nil {
+		services.RegisterSearchIndexing()
+	}
+
+	if _, err := config.SetupUsers(); err != nil {
+		config.Log.WithError(err).Warn("User directory unavailable; authors will not be told how reviews went")
+	}
+	if mailer, err := config.SetupMailer(); err != nil {
+		config.Log.WithError(err).Warn("Mail unavailable; live session invitations will not be sent")
+	} else if mailer != nil {
+		services.RegisterMailDelivery()
+	}
+
+	if err := services.BackfillScriptureRanges(); err != nil {
+		config.Log.WithError(err).Warn("Could not index the scripture references of existing media")
+	}
+
+	go services.RunUploadMaintenance(context.Background(), config.Config.Uploads.CleanupInterval)
+	go services.RunJobWorkers(context.Background())
+	go services.RunStorageMaintenance(context.Background(), config.Config.Storage.Lifecycle.Interval)
+	go services.RunProgressFlusher(context.Background())
+	go services.RunAnalyticsRollup(context.Background(), config.Config.Analytics.RollupInterval)
+	go services.RunUserEvents(context.Background())
+
+	if config.Config.Server.Environment == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	r := gin.New()
+
+	// Middleware
+	r.Use(middleware.RequestID())
+	r.Use(middleware.Logger())
+	r.Use(gin.Recovery())
+
+	// Media routes
+	media := r.Group("/api/media", middleware.AuthRequired())
+	{
+		media.GET("/content", handlers.ListMedia)
+		media.POST("/content", handlers.CreateMedia)
+		media.GET("/analytics", handlers.GetEngagementReport)
+		media.GET("/reviews", handlers.ListReviewQueue)
+		media.GET("/:id", handlers.GetMedia)
+		media.PUT("/:id", handlers.ReplaceMedia)
+		media.PATCH("/:id", handlers.UpdateMedia)
+		media.DELETE("/:id", handlers.DeleteMedia)
+		media.GET("/:id/playback", handlers.GetPlayback)
+		media.GET("/:id/download", handlers.DownloadMedia)
+		media.GET("/:id/access", handlers.GetMediaAccess)
+		media.PUT("/:id/access", handlers.SetMediaAccess)
+		media.DELETE("/:id/access", handlers.DeleteMediaAccess)
+		media.GET("/:id/analytics", handlers.GetMediaAnalytics)
+		media.GET("/:id/attachments", handlers.ListMediaAttachments)
+		media.POST("/:id/attachments", handlers.AddMediaAttachment)
+		media.GET("/stream/:id", handlers.StreamMedia)
+
+		media.POST("/:id/progress", handlers.RecordHeartbeat)
+		media.GET("/:id/progress", handlers.GetProgress)
+
+		media.GET("/:id/images", handlers.GetMediaImages)
+		media.PUT("/:id/thumbnail", handlers.UploadThumbnail)
+		media.DELETE("/:id/thumbnail", handlers.ResetThumbnail)
+		media.PUT("/:id/poster", handlers.ChoosePoster)
+
+		media.GET("/:id/versions", handlers.ListMediaVersions)
+		media.GET("/:id/versions/:number", handlers.GetMediaVersion)
+		media.POST("/:id/versions/:number/comments", handlers.AddReviewComment)
+		media.POST("/:id/submit", handlers.SubmitMedia)
+		media.POST("/:id/review", handlers.StartReview)
+		media.POST("/:id/approve", handlers.ApproveMedia)
+		media.POST("/:id/reject", handlers.RejectMedia)
+		media.POST("/:id/publish", handlers.PublishMedia)
+
+		media.GET("/:id/audio-tracks", handlers.ListAudioTracks)
+		media.PUT("/:id/audio-tracks/:lang", handlers.UploadAudioTrack)
+		media.PATCH("/:id/audio-tracks/:lang", handlers.UpdateAudioTrack)
+		media.DELETE("/:id/audio-tracks/:lang", handlers.DeleteAudioTrack)
+
+		media.GET("/:id/captions", handlers.ListCaptionTracks)
+		media.GET("/:id/captions/:lang", handlers.DownloadCaptions)
+		media.PUT("/:id/captions/:lang", handlers.UploadCaptions)
+		media.PATCH("/:id/captions/:lang", handlers.UpdateCaptionTrack)
+		media.DELETE("/:id/captions/:lang", handlers.DeleteCaptionTrack)
+		media.POST("/:id/captions/:lang/draft", handlers.DraftCaptions)
+		media.GET("/:id/captions/:lang/cues", handlers.ListCaptionCues)
+		media.POST("/:id/captions/:lang/cues", handlers.AddCaptionCue)
+		media.PATCH("/:id/captions/:lang/cues/:cueID", handlers.UpdateCaptionCue)
+		media.DELETE("/:id/captions/:lang/cues/:cueID", handlers.DeleteCaptionCue)
+		media.GET("/transcripts/search", handlers.SearchTranscripts)
+		media.GET("/search", handlers.SearchMedia)
+		media.GET("/scripture/parse", handlers.ParseScripture)
+		media.POST("/search/reindex", middleware.RequireRole(models.RoleAdmin), handlers.ReindexSearch)
+	}
+
+	offline := r.Group("/api/media/offline", middleware.AuthRequired())
+	{
+		offline.POST("/packages", handlers.CreateOfflinePackage)
+		offline.GET("/packages/:licenseID/download", handlers.DownloadOfflinePackage)
+		offline.GET("/licenses", handlers.ListOfflineLicenses)
+		offline.POST("/licenses/:licenseID/renew", handlers.RenewOfflineLicense)
+		offline.DELETE("/licenses/:licenseID", handlers.RevokeOfflineLicense)
+		offline.POST("/licenses/revoke", middleware.RequireRole(models.RoleAdmin), handlers.RevokeUserOfflineLicenses)
+		offline.GET("/license-key", handlers.GetOfflineLicenseKey)
+	}
+
+	live := r.Group("/api/media/live", middleware.AuthRequired())
+	{
+		live.GET("", handlers.ListLiveSessions)
+		live.POST("", handlers.CreateLiveSession)
+		live.GET("/:sessionID", handlers.GetLiveSession)
+		live.PATCH("/:sessionID", handlers.UpdateLiveSession)
+		live.DELETE("/:sessionID", handlers.DeleteLiveSession)
+		live.POST("/:sessionID/key", handlers.RotateStreamKey)
+		live.POST("/:sessionID/watch", handlers.WatchLiveSession)
+		live.POST("/:sessionID/join", handlers.JoinLiveSession)
+		live.POST("/:sessionID/leave", handlers.LeaveLiveSession)
+		live.GET("/:sessionID/attendance", handlers.ListLiveAttendance)
+		live.GET("/:sessionID/invitees", handlers.ListLiveInvitees)
+		live.PUT("/:sessionID/invitees", handlers.SetLiveInvitees)
+	}
+
+	collections := r.Group("/api/media/collections", middleware.AuthRequired())
+	{
+		collections.GET("", handlers.ListCollections)
+		collections.POST("", handlers.CreateCollection)
+		collections.GET("/:collectionID", handlers.GetCollection)
+		collections.PATCH("/:collectionID", handlers.UpdateCollection)
+		collections.DELETE("/:collectionID", handlers.DeleteCollection)
+		collections.POST("/:collectionID/items", handlers.AddCollectionItems)
+		collections.POST("/:collectionID/items/remove", handlers.RemoveCollectionItems)
+		collections.PUT("/:collectionID/order", handlers.ReorderCollection)
+		collections.GET("/:collectionID/next", handlers.NextUpInCollection)
+		collections.GET("/:collectionID/enrollments", handlers.ListEnrollments)
+		collections.POST("/:collectionID/enrollments", handlers.EnrollUsers)
+		collections.DELETE("/:collectionID/enrollments/:userID", handlers.UnenrollUser)
+		collections.GET("/:collectionID/attachments", handlers.ListCollectionAttachments)
+		collections.POST("/:collectionID/attachments", handlers.AddCollectionAttachment)
+	}
+
+	cohorts := r.Group("/api/media/cohorts", middleware.AuthRequired(), middleware.RequireRole(models.RoleAdmin))
+	{
+		cohorts.GET("", handlers.ListCohorts)
+		cohorts.GET("/:cohort/members", handlers.ListCohortMembers)
+		cohorts.POST("/:cohort/members", handlers.AddCohortMembers)
+		cohorts.DELETE("/:cohort/members/:userID", handlers.RemoveCohortMember)
+	}
+
+	attachments := r.Group("/api/media/attachments", middleware.AuthRequired())
+	{
+		attachments.GET("/:attachmentID", handlers.GetAttachment)
+		attachments.PATCH("/:attachmentID", handlers.UpdateAttachment)
+		attachments.DELETE("/:attachmentID", handlers.DeleteAttachment)
+		attachments.GET("/:attachmentID/download", handlers.DownloadAttachment)
+		attachments.GET("/:attachmentID/pages/:page", handlers.GetAttachmentPage)
+	}
+
+	storage := r.Group("/api/media/storage", middleware.AuthRequired(), middleware.RequireRole(models.RoleAdmin))
+	{
+		storage.GET("/mismatches", handlers.ListStorageMismatches)
+		storage.POST("/reconcile", handlers.ReconcileStorage)
+	}
+
+	// Feed URLs carry their own signature so calendar apps can subscribe
+	calendar := r.Group("/api/media/calendar")
+	{
+		calendar.GET("/feed", middleware.AuthRequired(), handlers.GetCalendarFeed)
+		calendar.GET("/:userID/:token", handlers.FetchCalendarFeed)
+	}
+
+	// nginx-rtmp callbacks carry a shared secret instead of a bearer token
+	r.POST("/api/media/rtmp/callback", handlers.RTMPCallback)
+
+	// Signed stream URLs authorize themselves, so players and CDNs can fetch
+	// them without a bearer token
+	stream := r.Group("/api/media/stream")
+	{
+		stream.GET("/:id/:token/*file", handlers.FetchStream)
+		stream.HEAD("/:id/:token/*file", handlers.FetchStream)
+	}
+
+	// tus resumable uploads; OPTIONS is unauthenticated for discovery
+	upload := r.Group("/api/media/upload", middleware.TusResumable())
+	{
+		upload.OPTIONS("", handlers.UploadOptions)
+		upload.OPTIONS("/:uploadID", handlers.UploadOptions)
+
+		authed := upload.Group("", middleware.AuthRequired())
+		authed.POST("", handlers.CreateUpload)
+		authed.HEAD("/:uploadID", handlers.GetUploadOffset)
+		authed.PATCH("/:uploadID", handlers.PatchUpload)
+		authed.DELETE("/:uploadID", handlers.TerminateUpload)
+	}
+
+	log.Fatal(r.Run(":" + config.Config.Server.Port))
+}
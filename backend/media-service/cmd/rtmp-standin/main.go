@@ -0,0 +1,127 @@
+// media-service/cmd/rtmp-standin/main.go
+//
+// rtmp-standin plays nginx-rtmp's part in a broadcast for local testing:
+// it sends the publish, record_done and publish_done callbacks nginx-rtmp
+// would send, and drops a recording into the recordings directory, so the
+// live flow can be exercised without an RTMP server or encoder.
+//
+//	go run ./cmd/rtmp-standin -key <stream key> -file talk.mp4 -for 30s
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	callback := flag.String("callback", "http://localhost:8081/api/media/rtmp/callback", "media-service callback URL")
+	secret := flag.String("secret", os.Getenv("LIVE_CALLBACK_SECRET"), "live.callback_secret")
+	key := flag.String("key", "", "stream key of the session to publish")
+	file := flag.String("file", "", "video to hand over as the recording; none if empty")
+	recordings := flag.String("recordings", "./data/recordings", "live.recordings_dir")
+	duration := flag.Duration("for", 30*time.Second, "how long to stay on air; interrupt to end early")
+	flag.Parse()
+	if *key == "" {
+		log.Fatal("-key is required")
+	}
+	if *secret == "" {
+		*secret = "change-me-live-callback-secret"
+	}
+
+	endpoint, err := url.Parse(*callback)
+	if err != nil {
+		log.Fatalf("bad -callback: %v", err)
+	}
+	query := endpoint.Query()
+	query.Set("secret", *secret)
+	endpoint.RawQuery = query.Encode()
+
+	clientID := fmt.Sprint(time.Now().Unix() % 100000)
+	notify := func(call, name string, extra url.Values) (string, error) {
+		form := url.Values{
+			"call":     {call},
+			"app":      {"live"},
+			"name":     {name},
+			"clientid": {clientID},
+			"addr":     {"127.0.0.1"},
+		}
+		for k, v := range extra {
+			form[k] = v
+		}
+		client := &http.Client{
+			// nginx-rtmp reads publish redirects itself
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+		resp, err := client.PostForm(endpoint.String(), form)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		switch {
+		case resp.StatusCode >= 300 && resp.StatusCode < 400:
+			return resp.Header.Get("Location"), nil
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return name, nil
+		}
+		return "", fmt.Errorf("%s refused: %s %s", call, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	name, err := notify("publish", *key, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("on air as %q for %s", name, *duration)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	select {
+	case <-time.After(*duration):
+	case <-interrupt:
+	}
+
+	if *file != "" {
+		recording := filepath.Join(*recordings, fmt.Sprintf("%s-%d%s", name, time.Now().Unix(), filepath.Ext(*file)))
+		if err := copyFile(*file, recording); err != nil {
+			log.Fatalf("write recording: %v", err)
+		}
+		if _, err := notify("record_done", name, url.Values{"path": {recording}, "recorder": {"all"}}); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("recorded %s", recording)
+	}
+	if _, err := notify("publish_done", name, nil); err != nil {
+		log.Fatal(err)
+	}
+	log.Print("off air")
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return errors.Join(err, os.Remove(dst))
+	}
+	return out.Close()
+}
@@ -0,0 +1,102 @@
+// media-service/pkg/api/access.go
+package api
+
+import "time"
+
+// Why an item the caller may see is locked
+const (
+	LockAvailableFrom = "available_from"
+	LockDrip          = "drip"
+	LockPrevious      = "previous"
+)
+
+// MediaAccessRequest sets who may see an item and when it unlocks.
+type MediaAccessRequest struct {
+	// Roles and cohorts that may see the item; with both empty, everyone
+	// who can see it may
+	Roles   []string `json:"roles" binding:"max=20,dive,max=50"`
+	Cohorts []string `json:"cohorts" binding:"max=100,dive,max=100"`
+	// A collection callers must be enrolled in to see the item
+	CourseID *uint `json:"course_id" binding:"omitempty,min=1"`
+	// Listed but locked until this time
+	AvailableFrom *time.Time `json:"available_from"`
+	// Hidden after this time
+	AvailableUntil *time.Time `json:"available_until"`
+	// Locked until this many days after enrolling in the course
+	DripDays int `json:"drip_days" binding:"min=0,max=3650"`
+	// Locked until the items before it in the course are completed
+	RequirePrevious bool `json:"require_previous"`
+}
+
+type MediaAccessRule struct {
+	MediaID         uint       `json:"media_id"`
+	Roles           []string   `json:"roles"`
+	Cohorts         []string   `json:"cohorts"`
+	CourseID        *uint      `json:"course_id,omitempty"`
+	AvailableFrom   *time.Time `json:"available_from,omitempty"`
+	AvailableUntil  *time.Time `json:"available_until,omitempty"`
+	DripDays        int        `json:"drip_days"`
+	RequirePrevious bool       `json:"require_previous"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// MediaAccess is what an item's access rule means for the caller.
+type MediaAccess struct {
+	// Locked items are listed and described but cannot be played,
+	// downloaded or kept offline
+	Locked bool `json:"locked"`
+	// available_from, drip or previous
+	Reason string `json:"reason,omitempty"`
+	// When a time lock lifts
+	UnlocksAt *time.Time `json:"unlocks_at,omitempty"`
+	// Items of the course to complete first
+	Prerequisites []uint `json:"prerequisites,omitempty"`
+	// When the item stops being available to the caller
+	AvailableUntil *time.Time `json:"available_until,omitempty"`
+}
+
+// EnrollmentRequest enrolls users in a course.
+type EnrollmentRequest struct {
+	UserIDs []uint `json:"user_ids" binding:"required,min=1,max=1000,dive,min=1"`
+	// When drip schedules start; defaults to now. Users already enrolled
+	// keep their date unless this is given.
+	EnrolledAt *time.Time `json:"enrolled_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+}
+
+type Enrollment struct {
+	CollectionID uint       `json:"collection_id"`
+	UserID       uint       `json:"user_id"`
+	EnrolledAt   time.Time  `json:"enrolled_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+type EnrollmentList struct {
+	Items    []Enrollment `json:"items"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
+// CohortMembersRequest adds users to a cohort.
+type CohortMembersRequest struct {
+	UserIDs []uint `json:"user_ids" binding:"required,min=1,max=1000,dive,min=1"`
+}
+
+type Cohort struct {
+	Name    string `json:"name"`
+	Members int64  `json:"members"`
+}
+
+type CohortMember struct {
+	Cohort  string    `json:"cohort"`
+	UserID  uint      `json:"user_id"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type CohortMemberList struct {
+	Items    []CohortMember `json:"items"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+	Total    int64          `json:"total"`
+}
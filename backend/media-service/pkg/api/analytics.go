@@ -0,0 +1,80 @@
+// media-service/pkg/api/analytics.go
+package api
+
+// Tables of an analytics report that can be exported as CSV
+const (
+	AnalyticsDays      = "days"
+	AnalyticsCohorts   = "cohorts"
+	AnalyticsRetention = "retention"
+)
+
+// EngagementTotals sums up how an item was watched by the viewers a report
+// covers.
+type EngagementTotals struct {
+	UniqueViewers int64 `json:"unique_viewers"`
+	// Times playback started after a pause longer than a few heartbeats
+	Plays        int64   `json:"plays"`
+	WatchSeconds float64 `json:"watch_seconds"`
+	// Average share of the item each viewer has played at least once, 0 to
+	// 100; absent when its length is unknown
+	AveragePercentWatched *float64 `json:"average_percent_watched,omitempty"`
+}
+
+type AnalyticsDay struct {
+	// YYYY-MM-DD, UTC
+	Date string `json:"date"`
+	// Set when broken down by cohort; empty for viewers in none
+	Cohort        *string `json:"cohort,omitempty"`
+	UniqueViewers int64   `json:"unique_viewers"`
+	Plays         int64   `json:"plays"`
+	WatchSeconds  float64 `json:"watch_seconds"`
+}
+
+type AnalyticsCohort struct {
+	// Empty for viewers in no cohort
+	Cohort string `json:"cohort"`
+	EngagementTotals
+}
+
+// RetentionPoint is how many viewers played one second of an item.
+type RetentionPoint struct {
+	Second  int     `json:"second"`
+	Viewers int64   `json:"viewers"`
+	Percent float64 `json:"percent"`
+}
+
+// MediaAnalytics reports how an item was watched between two dates.
+// Viewers count on the days they played it, in the cohorts they were in
+// then; the share watched and retention cover everything those viewers
+// have ever played of it.
+type MediaAnalytics struct {
+	MediaID         uint   `json:"media_id"`
+	Title           string `json:"title"`
+	DurationSeconds int    `json:"duration_seconds"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	// Only viewers in this cohort, if set
+	Cohort    string            `json:"cohort,omitempty"`
+	Totals    EngagementTotals  `json:"totals"`
+	Days      []AnalyticsDay    `json:"days"`
+	Cohorts   []AnalyticsCohort `json:"cohorts"`
+	Retention []RetentionPoint  `json:"retention"`
+}
+
+// EngagementItem is one item's line in an engagement report.
+type EngagementItem struct {
+	MediaID         uint   `json:"media_id"`
+	Title           string `json:"title"`
+	DurationSeconds int    `json:"duration_seconds"`
+	EngagementTotals
+}
+
+type EngagementReport struct {
+	Items    []EngagementItem `json:"items"`
+	From     string           `json:"from"`
+	To       string           `json:"to"`
+	Cohort   string           `json:"cohort,omitempty"`
+	Page     int              `json:"page"`
+	PageSize int              `json:"page_size"`
+	Total    int64            `json:"total"`
+}
@@ -0,0 +1,38 @@
+// media-service/pkg/api/attachments.go
+package api
+
+import "time"
+
+type Attachment struct {
+	ID           uint   `json:"id"`
+	MediaID      *uint  `json:"media_id,omitempty"`
+	CollectionID *uint  `json:"collection_id,omitempty"`
+	Title        string `json:"title"`
+	FileName     string `json:"file_name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	// pending, clean, infected, failed or skipped. Only editors see
+	// attachments that are not clean or skipped.
+	ScanStatus string `json:"scan_status"`
+	// Name of the malware found, for infected attachments
+	ScanSignature string `json:"scan_signature,omitempty"`
+	// pending, ready, unavailable or failed
+	PreviewStatus string `json:"preview_status"`
+	// 0 if unknown
+	PageCount int `json:"page_count"`
+	// Thumbnails of the first pages, in order
+	Pages []string `json:"pages"`
+	// Empty until the file may be downloaded
+	DownloadURL string    `json:"download_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type AttachmentList struct {
+	Attachments []Attachment `json:"attachments"`
+}
+
+// UpdateAttachmentRequest is a partial update: omitted fields are unchanged.
+type UpdateAttachmentRequest struct {
+	Title *string `json:"title" binding:"omitempty,min=1,max=200"`
+}
@@ -0,0 +1,32 @@
+// media-service/pkg/api/audio_tracks.go
+package api
+
+import "time"
+
+type AudioTrack struct {
+	// BCP 47 language tag
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	// Only editors see unpublished tracks
+	Published   bool   `json:"published"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// queued, processing, ready or failed
+	Status string `json:"status"`
+	// Why encoding failed
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AudioTrackList struct {
+	// Language of the item's own audio, which the tracks are alternatives to
+	OriginalLanguage string       `json:"original_language"`
+	Tracks           []AudioTrack `json:"tracks"`
+}
+
+// UpdateAudioTrackRequest is a partial update: omitted fields are unchanged.
+type UpdateAudioTrackRequest struct {
+	Label     *string `json:"label" binding:"omitempty,max=100"`
+	Published *bool   `json:"published"`
+}
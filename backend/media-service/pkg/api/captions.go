@@ -0,0 +1,79 @@
+// media-service/pkg/api/captions.go
+package api
+
+import "time"
+
+type CaptionTrack struct {
+	// BCP 47 language tag
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	// upload or speech
+	Source    string `json:"source"`
+	Published bool   `json:"published"`
+	CueCount  int64  `json:"cue_count"`
+	// Download as WebVTT; add ?format=srt for SubRip
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CaptionTrackList struct {
+	Tracks []CaptionTrack `json:"tracks"`
+}
+
+type CaptionCue struct {
+	ID      uint   `json:"id"`
+	StartMS int64  `json:"start_ms"`
+	EndMS   int64  `json:"end_ms"`
+	Text    string `json:"text"`
+}
+
+type CaptionCueList struct {
+	Track CaptionTrack `json:"track"`
+	Cues  []CaptionCue `json:"cues"`
+}
+
+// UpdateCaptionTrackRequest is a partial update: omitted fields are unchanged.
+type UpdateCaptionTrackRequest struct {
+	Label     *string `json:"label" binding:"omitempty,max=100"`
+	Published *bool   `json:"published"`
+}
+
+// CaptionCueRequest adds a cue, or with PATCH changes the given fields of one.
+type CaptionCueRequest struct {
+	StartMS *int64  `json:"start_ms" binding:"omitempty,min=0"`
+	EndMS   *int64  `json:"end_ms" binding:"omitempty,min=0"`
+	Text    *string `json:"text" binding:"omitempty,min=1,max=1000"`
+}
+
+// Caption is a published track in a playback response.
+type Caption struct {
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	// Shown by default because the item cannot be heard in the preferred
+	// language
+	Default bool `json:"default"`
+	// Signed WebVTT URL for a <track> element or player
+	URL string `json:"url"`
+}
+
+// TranscriptMatch is a cue matching a transcript search.
+type TranscriptMatch struct {
+	MediaID    uint    `json:"media_id"`
+	MediaTitle string  `json:"media_title"`
+	Language   string  `json:"language"`
+	CueID      uint    `json:"cue_id"`
+	StartMS    int64   `json:"start_ms"`
+	EndMS      int64   `json:"end_ms"`
+	Text       string  `json:"text"`
+	Rank       float64 `json:"rank"`
+	// Opens the player at the cue, e.g. /media/12#t=95
+	Link string `json:"link"`
+}
+
+type TranscriptSearchResult struct {
+	Matches  []TranscriptMatch `json:"matches"`
+	Page     int               `json:"page"`
+	PageSize int               `json:"page_size"`
+	Total    int64             `json:"total"`
+}
@@ -0,0 +1,100 @@
+// media-service/pkg/api/collection.go
+package api
+
+import "time"
+
+// Reasons an item is up next
+const (
+	NextUpStart  = "start"
+	NextUpResume = "resume"
+	NextUpNext   = "next"
+)
+
+// CollectionRequest creates a series, playlist or grouping of
+// collections.
+type CollectionRequest struct {
+	// series and collection require the trainer or admin role
+	Kind        string `json:"kind" binding:"required,oneof=series playlist collection"`
+	Title       string `json:"title" binding:"required,max=300"`
+	Description string `json:"description" binding:"max=10000"`
+	// Defaults to private
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public private"`
+	// Keep a public collection hidden until this time
+	PublishAt *time.Time `json:"publish_at"`
+	// Collection to nest this one in, at the end
+	ParentID *uint `json:"parent_id"`
+	// Items to start with, in order
+	MediaIDs []uint `json:"media_ids" binding:"max=1000"`
+}
+
+// UpdateCollectionRequest is a partial update: omitted fields are
+// unchanged.
+type UpdateCollectionRequest struct {
+	Title       *string `json:"title" binding:"omitempty,min=1,max=300"`
+	Description *string `json:"description" binding:"omitempty,max=10000"`
+	Visibility  *string `json:"visibility" binding:"omitempty,oneof=public private"`
+	// A time in the past publishes the collection at once
+	PublishAt *time.Time `json:"publish_at"`
+	// Moves the collection to the end of another; 0 makes it top-level
+	ParentID *uint `json:"parent_id"`
+}
+
+type Collection struct {
+	ID          uint       `json:"id"`
+	Kind        string     `json:"kind"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	OwnerID     uint       `json:"owner_id"`
+	Visibility  string     `json:"visibility"`
+	PublishAt   *time.Time `json:"publish_at,omitempty"`
+	ParentID    *uint      `json:"parent_id,omitempty"`
+	Position    int        `json:"position"`
+	// Items directly in the collection, including any the caller cannot see
+	ItemCount int       `json:"item_count"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CollectionDetail is a collection with the items and sub-collections the
+// caller can see, in order.
+type CollectionDetail struct {
+	Collection
+	Items    []MediaItem  `json:"items"`
+	Children []Collection `json:"children"`
+}
+
+type CollectionList struct {
+	Collections []Collection `json:"collections"`
+	Page        int          `json:"page"`
+	PageSize    int          `json:"page_size"`
+	Total       int64        `json:"total"`
+}
+
+// CollectionItemsRequest adds or removes items in bulk.
+type CollectionItemsRequest struct {
+	MediaIDs []uint `json:"media_ids" binding:"required,min=1,max=1000"`
+	// Where to insert added items, from 0; defaults to the end
+	Position *int `json:"position" binding:"omitempty,min=0"`
+}
+
+// CollectionOrderRequest sets the manual order. Each list, if given, must
+// hold exactly the collection's items or sub-collections.
+type CollectionOrderRequest struct {
+	MediaIDs      []uint `json:"media_ids" binding:"max=1000"`
+	CollectionIDs []uint `json:"collection_ids" binding:"max=1000"`
+}
+
+// CollectionItemsResult reports how many items a bulk operation changed.
+type CollectionItemsResult struct {
+	Changed   int `json:"changed"`
+	ItemCount int `json:"item_count"`
+}
+
+// NextUp is what the caller should play next in a collection.
+type NextUp struct {
+	CollectionID uint `json:"collection_id"`
+	// start (nothing played yet), resume (the last item played is
+	// unfinished) or next
+	Reason string    `json:"reason"`
+	Item   MediaItem `json:"item"`
+}
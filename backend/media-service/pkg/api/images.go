@@ -0,0 +1,46 @@
+// media-service/pkg/api/images.go
+package api
+
+import "time"
+
+const (
+	PosterGenerated = "generated"
+	PosterUploaded  = "upload"
+	PosterFrame     = "frame"
+)
+
+// MediaImages holds signed image URLs. They are shared by every viewer and
+// stay the same for a while so caches can serve them.
+type MediaImages struct {
+	// Poster in each size, keyed by small, medium or large
+	Poster map[string]string `json:"poster,omitempty"`
+	// generated, upload or frame (taken at a chosen time)
+	PosterSource string `json:"poster_source,omitempty"`
+	// WebVTT track of scrubbing previews; each cue is a sprite sheet URL
+	// with an #xywh= fragment selecting the tile
+	ThumbnailsURL string `json:"thumbnails_url,omitempty"`
+	// JSON waveform: duration_seconds and peaks between 0 and 1
+	WaveformURL string    `json:"waveform_url,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// MediaImagesDetail adds the generated poster candidates editors pick from.
+type MediaImagesDetail struct {
+	MediaImages
+	Candidates []PosterCandidate `json:"candidates"`
+}
+
+type PosterCandidate struct {
+	Index     int     `json:"index"`
+	AtSeconds float64 `json:"at_seconds"`
+	// Medium-size preview
+	URL      string `json:"url"`
+	Selected bool   `json:"selected"`
+}
+
+// ChoosePosterRequest picks one of the generated candidates, or asks for a
+// new poster taken at a time in the video. Exactly one must be set.
+type ChoosePosterRequest struct {
+	Candidate *int     `json:"candidate" binding:"omitempty,min=0"`
+	AtSeconds *float64 `json:"at_seconds" binding:"omitempty,min=0"`
+}
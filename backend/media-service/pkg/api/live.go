@@ -0,0 +1,155 @@
+// media-service/pkg/api/live.go
+package api
+
+import "time"
+
+// LiveSessionRequest schedules a live session, or a series of them when
+// it has a recurrence rule.
+type LiveSessionRequest struct {
+	Title       string `json:"title" binding:"required,max=300"`
+	Description string `json:"description" binding:"max=10000"`
+	Cohort      string `json:"cohort" binding:"max=100"`
+	// Start of the first occurrence
+	ScheduledAt time.Time `json:"scheduled_at" binding:"required"`
+	// IANA zone, e.g. America/Chicago; defaults to UTC. Occurrences keep
+	// their wall-clock time in it across daylight saving changes.
+	TimeZone string `json:"time_zone" binding:"max=64"`
+	// RFC 5545 rule such as FREQ=WEEKLY;BYDAY=TU;COUNT=12. DAILY, WEEKLY
+	// and MONTHLY are supported, with INTERVAL, COUNT or UNTIL, and BYDAY
+	// for WEEKLY.
+	RRule string `json:"rrule" binding:"max=200"`
+	// Defaults to 60
+	DurationMinutes int `json:"duration_minutes" binding:"omitempty,min=1,max=1440"`
+	// Defaults to private
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public private"`
+	Language   string `json:"language" binding:"omitempty,bcp47_language_tag"`
+	// Keep the broadcast as a catalog item; defaults to true
+	Record *bool `json:"record"`
+	// Sent an invitation by email
+	Invitees []LiveInvitee `json:"invitees" binding:"max=1000,dive"`
+}
+
+// UpdateLiveSessionRequest is a partial update: omitted fields are
+// unchanged.
+type UpdateLiveSessionRequest struct {
+	Title       *string    `json:"title" binding:"omitempty,min=1,max=300"`
+	Description *string    `json:"description" binding:"omitempty,max=10000"`
+	Cohort      *string    `json:"cohort" binding:"omitempty,max=100"`
+	ScheduledAt *time.Time `json:"scheduled_at"`
+	TimeZone    *string    `json:"time_zone" binding:"omitempty,max=64"`
+	// An empty rule makes the session a one-off
+	RRule           *string `json:"rrule" binding:"omitempty,max=200"`
+	DurationMinutes *int    `json:"duration_minutes" binding:"omitempty,min=1,max=1440"`
+	Visibility      *string `json:"visibility" binding:"omitempty,oneof=public private"`
+	Language        *string `json:"language" binding:"omitempty,bcp47_language_tag"`
+	Record          *bool   `json:"record"`
+	// Only a session that is not on air can be cancelled
+	Cancelled *bool `json:"cancelled"`
+}
+
+type LiveSession struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	HostID      uint      `json:"host_id"`
+	Cohort      string    `json:"cohort"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	TimeZone    string    `json:"time_zone"`
+	RRule       string    `json:"rrule"`
+	// Start of the occurrence under way or next up; absent once a series
+	// is over
+	NextOccurrence  *time.Time `json:"next_occurrence,omitempty"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Visibility      string     `json:"visibility"`
+	Language        string     `json:"language"`
+	Record          bool       `json:"record"`
+	// scheduled, live, ended or cancelled
+	Status    string     `json:"status"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// Current audience; only while live
+	Viewers     int `json:"viewers"`
+	PeakViewers int `json:"peak_viewers"`
+	// HLS playlist; only while live
+	PlaybackURL string `json:"playback_url,omitempty"`
+	// Catalog items made from the recordings
+	RecordingIDs []uint `json:"recording_ids"`
+	// Where to publish; only shown to the host and admins
+	Ingest    *LiveIngest `json:"ingest,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// LiveIngest is what the host enters in their encoder, e.g. OBS.
+type LiveIngest struct {
+	URL       string `json:"url"`
+	StreamKey string `json:"stream_key"`
+}
+
+type LiveSessionList struct {
+	Sessions []LiveSession `json:"sessions"`
+	Page     int           `json:"page"`
+	PageSize int           `json:"page_size"`
+	Total    int64         `json:"total"`
+}
+
+type LiveViewers struct {
+	Viewers int `json:"viewers"`
+}
+
+// LiveInvitee is someone invited to a session. Give the user ID of
+// platform users so they can see a private session and get it in their
+// calendar feed.
+type LiveInvitee struct {
+	Email  string `json:"email" binding:"required,email,max=254"`
+	Name   string `json:"name" binding:"max=200"`
+	UserID uint   `json:"user_id"`
+}
+
+// LiveInviteesRequest replaces a session's invitees. Those added get an
+// invitation and those removed a cancellation.
+type LiveInviteesRequest struct {
+	Invitees []LiveInvitee `json:"invitees" binding:"max=1000,dive"`
+}
+
+type LiveInviteeList struct {
+	Invitees []LiveInvitee `json:"invitees"`
+}
+
+// LiveAttendance is one user's presence at one occurrence.
+type LiveAttendance struct {
+	UserID     uint       `json:"user_id"`
+	Occurrence time.Time  `json:"occurrence"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	LeftAt     *time.Time `json:"left_at,omitempty"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	Seconds    int        `json:"seconds"`
+	// Set for users on the invitee list
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+type LiveAttendanceList struct {
+	Attendance []LiveAttendance `json:"attendance"`
+	Page       int              `json:"page"`
+	PageSize   int              `json:"page_size"`
+	Total      int64            `json:"total"`
+}
+
+// CalendarFeed is the caller's personal iCalendar feed. Anyone with the
+// URL can read it.
+type CalendarFeed struct {
+	URL string `json:"url"`
+}
+
+// RTMPCallback is the form nginx-rtmp posts to its on_publish,
+// on_publish_done, on_play, on_play_done and on_record_done callbacks.
+type RTMPCallback struct {
+	Call     string `form:"call"`
+	App      string `form:"app"`
+	Name     string `form:"name"`
+	ClientID string `form:"clientid"`
+	Addr     string `form:"addr"`
+	// Recorded file; on_record_done only
+	Path string `form:"path"`
+}
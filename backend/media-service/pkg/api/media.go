@@ -0,0 +1,111 @@
+// media-service/pkg/api/media.go
+//
+// Package api holds the request and response bodies of the media-service
+// HTTP API. It must not import anything beyond the standard library.
+package api
+
+import "time"
+
+type MediaItem struct {
+	ID              uint     `json:"id"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	Type            string   `json:"type"`
+	Speaker         string   `json:"speaker"`
+	Series          string   `json:"series"`
+	ScriptureRefs   []string `json:"scripture_refs"`
+	Tags            []string `json:"tags"`
+	Language        string   `json:"language"`
+	DurationSeconds int      `json:"duration_seconds"`
+	Visibility      string   `json:"visibility"`
+	// Hidden from all but its editors until then
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	// Listed, but not playable by others, until then
+	EmbargoUntil *time.Time `json:"embargo_until,omitempty"`
+	OwnerID      uint       `json:"owner_id"`
+	// none, queued, processing, failed or ready
+	ProcessingStatus string `json:"processing_status"`
+	ProcessingError  string `json:"processing_error,omitempty"`
+	// Names of the packaged HLS renditions, e.g. "360p" or "audio"
+	Renditions []string `json:"renditions"`
+	// Signed image URLs; absent until there is a poster, thumbnail track
+	// or waveform
+	Images *MediaImages `json:"images,omitempty"`
+	// The caller's playback progress, on listings and single items
+	Progress *MediaProgress `json:"progress,omitempty"`
+	// Set on items with an access rule, except for their editors
+	Access *MediaAccess `json:"access,omitempty"`
+	// Review state of the newest version: draft, submitted, in_review,
+	// approved, rejected or published
+	ReviewStatus string `json:"review_status"`
+	// Number of the version learners see, 0 if none has been published
+	LiveVersion int       `json:"live_version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// MediaRequest creates an item, or replaces every editable field of one.
+type MediaRequest struct {
+	Title       string `json:"title" binding:"required,max=300"`
+	Description string `json:"description" binding:"max=10000"`
+	Type        string `json:"type" binding:"required,oneof=audio video document"`
+	Speaker     string `json:"speaker" binding:"max=200"`
+	Series      string `json:"series" binding:"max=200"`
+	// References such as "John 3:16", "Rom 8:28-39" or "1 Cor. 13; 15",
+	// in English or another supported language. They are stored in
+	// canonical form, one per passage.
+	ScriptureRefs []string `json:"scripture_refs" binding:"max=50,dive,max=100"`
+	// Numbering of scripture_refs: english (default), hebrew or vulgate
+	Versification string   `json:"versification" binding:"omitempty,oneof=english hebrew vulgate"`
+	Tags          []string `json:"tags" binding:"max=50,dive,max=50"`
+	// BCP 47 language tag, e.g. "en", "fr", "sw", "pt-BR"
+	Language        string `json:"language" binding:"omitempty,bcp47_language_tag"`
+	DurationSeconds int    `json:"duration_seconds" binding:"min=0"`
+	// Defaults to private
+	Visibility string `json:"visibility" binding:"omitempty,oneof=public private"`
+	// Keep a public item hidden until this time
+	PublishAt *time.Time `json:"publish_at"`
+	// List the item but refuse playback, downloads and offline packages
+	// until this time
+	EmbargoUntil *time.Time `json:"embargo_until"`
+}
+
+// UpdateMediaRequest is a partial update: omitted fields are unchanged.
+type UpdateMediaRequest struct {
+	Title         *string   `json:"title" binding:"omitempty,min=1,max=300"`
+	Description   *string   `json:"description" binding:"omitempty,max=10000"`
+	Type          *string   `json:"type" binding:"omitempty,oneof=audio video document"`
+	Speaker       *string   `json:"speaker" binding:"omitempty,max=200"`
+	Series        *string   `json:"series" binding:"omitempty,max=200"`
+	ScriptureRefs *[]string `json:"scripture_refs" binding:"omitempty,max=50,dive,max=100"`
+	// Numbering of scripture_refs: english (default), hebrew or vulgate
+	Versification   string    `json:"versification" binding:"omitempty,oneof=english hebrew vulgate"`
+	Tags            *[]string `json:"tags" binding:"omitempty,max=50,dive,max=50"`
+	Language        *string   `json:"language" binding:"omitempty,bcp47_language_tag"`
+	DurationSeconds *int      `json:"duration_seconds" binding:"omitempty,min=0"`
+	Visibility      *string   `json:"visibility" binding:"omitempty,oneof=public private"`
+	// A time in the past publishes the item, or lifts its embargo, at once
+	PublishAt    *time.Time `json:"publish_at"`
+	EmbargoUntil *time.Time `json:"embargo_until"`
+}
+
+type MediaList struct {
+	Items    []MediaItem `json:"items"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+	Total    int64       `json:"total"`
+}
+
+// ScriptureReference is a passage in canonical form and English
+// numbering. A verse of 0 stands for the whole chapter.
+type ScriptureReference struct {
+	// e.g. "Romans 8:28-30"
+	Reference string `json:"reference"`
+	// e.g. "Rom.8.28-Rom.8.30"
+	OSIS         string `json:"osis"`
+	Book         string `json:"book"`
+	StartChapter int    `json:"start_chapter"`
+	StartVerse   int    `json:"start_verse"`
+	EndChapter   int    `json:"end_chapter"`
+	EndVerse     int    `json:"end_verse"`
+}
@@ -0,0 +1,93 @@
+// media-service/pkg/api/offline.go
+package api
+
+import "time"
+
+const (
+	LicenseActive  = "active"
+	LicenseExpired = "expired"
+	LicenseRevoked = "revoked"
+)
+
+type CreateOfflinePackageRequest struct {
+	// One item for a lesson, or every item of a course
+	MediaIDs []uint `json:"media_ids" binding:"required,min=1,dive,gt=0"`
+	// Stable identifier of the installation the license is bound to
+	DeviceID string `json:"device_id" binding:"required,max=200"`
+	// auto (default) or datasaver
+	Quality string `json:"quality" binding:"omitempty,oneof=auto datasaver"`
+}
+
+type RenewOfflineLicenseRequest struct {
+	DeviceID string `json:"device_id" binding:"required,max=200"`
+}
+
+// RevokeOfflineLicensesRequest revokes a user's licenses, e.g. when a
+// device is lost. With MediaIDs only licenses covering one of those items
+// are revoked.
+type RevokeOfflineLicensesRequest struct {
+	UserID   uint   `json:"user_id" binding:"required"`
+	MediaIDs []uint `json:"media_ids" binding:"omitempty,dive,gt=0"`
+	Reason   string `json:"reason" binding:"max=100"`
+}
+
+type RevokeOfflineLicensesResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+type OfflineLicense struct {
+	ID        uint      `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	MediaIDs  []uint    `json:"media_ids"`
+	Quality   string    `json:"quality"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// active, expired or revoked
+	Status string `json:"status"`
+	// Signed license; only returned when issued or renewed
+	Token string `json:"token,omitempty"`
+	// Bearer-authenticated ZIP of the package; only while active
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// LicenseClaims is the signed body of a license token. Tokens are
+// "<base64url claims JSON>.<base64url Ed25519 signature>"; verify the
+// signature over the first part with the key from getOfflineLicenseKey.
+type LicenseClaims struct {
+	LicenseID uint   `json:"lid"`
+	UserID    uint   `json:"sub"`
+	DeviceID  string `json:"dev"`
+	MediaIDs  []uint `json:"media"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type OfflineLicenseKey struct {
+	Algorithm string `json:"alg"`
+	// Base64 Ed25519 public key
+	PublicKey string `json:"public_key"`
+}
+
+// OfflineManifest is manifest.json at the root of a package.
+type OfflineManifest struct {
+	Version     int                   `json:"version"`
+	LicenseID   uint                  `json:"license_id"`
+	Quality     string                `json:"quality"`
+	GeneratedAt time.Time             `json:"generated_at"`
+	ExpiresAt   time.Time             `json:"expires_at"`
+	Items       []OfflineManifestItem `json:"items"`
+}
+
+type OfflineManifestItem struct {
+	Media MediaItem     `json:"media"`
+	Files []OfflineFile `json:"files"`
+}
+
+type OfflineFile struct {
+	// Path inside the archive
+	Path string `json:"path"`
+	// media, playlist, segment, transcript or attachment
+	Role        string `json:"role"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
@@ -0,0 +1,50 @@
+// media-service/pkg/api/progress.go
+package api
+
+import "time"
+
+// Player events a heartbeat can report
+const (
+	PlaybackPlay      = "play"
+	PlaybackPause     = "pause"
+	PlaybackSeek      = "seek"
+	PlaybackBuffering = "buffering"
+	PlaybackEnded     = "ended"
+	PlaybackHeartbeat = "heartbeat"
+)
+
+// ProgressHeartbeat is sent by players every few seconds while playing,
+// and on pause, seek and end.
+type ProgressHeartbeat struct {
+	PositionSeconds float64 `json:"position_seconds" binding:"min=0"`
+	// As the player sees it; only used if the catalog has no duration
+	DurationSeconds float64 `json:"duration_seconds" binding:"min=0"`
+	// Playback speed; defaults to 1
+	Rate      float64 `json:"rate" binding:"omitempty,gt=0,max=4"`
+	Rendition string  `json:"rendition" binding:"max=32"`
+	// Defaults to heartbeat. A seek's position is where playback jumped to.
+	Event    string `json:"event" binding:"omitempty,oneof=play pause seek buffering ended heartbeat"`
+	DeviceID string `json:"device_id" binding:"max=200"`
+	// Stalls since the previous heartbeat
+	BufferingEvents  int     `json:"buffering_events" binding:"min=0,max=1000"`
+	BufferingSeconds float64 `json:"buffering_seconds" binding:"min=0"`
+}
+
+// MediaProgress is the caller's progress on an item.
+type MediaProgress struct {
+	PositionSeconds float64 `json:"position_seconds"`
+	// Where players should start: the position, or 0 when it was left
+	// near the end
+	ResumeSeconds   float64 `json:"resume_seconds"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Share of the item played at least once, 0 to 100
+	WatchedPercent   float64    `json:"watched_percent"`
+	Completed        bool       `json:"completed"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	Rate             float64    `json:"rate,omitempty"`
+	Rendition        string     `json:"rendition,omitempty"`
+	DeviceID         string     `json:"device_id,omitempty"`
+	BufferingEvents  int        `json:"buffering_events"`
+	BufferingSeconds float64    `json:"buffering_seconds"`
+	LastPlayedAt     *time.Time `json:"last_played_at,omitempty"`
+}
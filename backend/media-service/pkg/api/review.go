@@ -0,0 +1,58 @@
+// media-service/pkg/api/review.go
+package api
+
+import "time"
+
+// MediaVersion is one revision of an item's catalog entry.
+type MediaVersion struct {
+	MediaID uint `json:"media_id"`
+	Number  int  `json:"number"`
+	// draft, submitted, in_review, approved, rejected, published or
+	// superseded
+	Status string `json:"status"`
+	// Whether learners currently see this version
+	Live          bool     `json:"live"`
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Type          string   `json:"type"`
+	Speaker       string   `json:"speaker"`
+	Series        string   `json:"series"`
+	ScriptureRefs []string `json:"scripture_refs"`
+	Tags          []string `json:"tags"`
+	Language      string   `json:"language"`
+	AuthorID      uint     `json:"author_id"`
+	// 0 until a reviewer takes the version up
+	ReviewerID  uint       `json:"reviewer_id,omitempty"`
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	// Oldest first; only on single versions
+	Comments  []ReviewComment `json:"comments,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+type MediaVersionList struct {
+	Versions []MediaVersion `json:"versions"`
+}
+
+type ReviewComment struct {
+	ID       uint `json:"id"`
+	Version  int  `json:"version"`
+	AuthorID uint `json:"author_id"`
+	// The review step the comment came with: submitted, approved or
+	// rejected, or empty for a comment on its own
+	Action    string    `json:"action,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReviewRequest moves a version on to its next review state. A comment
+// is required to reject one.
+type ReviewRequest struct {
+	Comment string `json:"comment" binding:"max=10000"`
+}
+
+type ReviewCommentRequest struct {
+	Body string `json:"body" binding:"required,max=10000"`
+}
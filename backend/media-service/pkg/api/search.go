@@ -0,0 +1,41 @@
+// media-service/pkg/api/search.go
+package api
+
+type SearchResult struct {
+	Hits []SearchHit `json:"hits"`
+	// Matches per value of speaker, language, series and duration. Each
+	// facet's counts leave out its own filter, so they show what choosing
+	// another value would find.
+	Facets map[string][]FacetCount `json:"facets"`
+	// Set when q matched nothing and looked misspelt; the hits are for
+	// this query instead
+	CorrectedQuery string `json:"corrected_query,omitempty"`
+	Page           int    `json:"page"`
+	PageSize       int    `json:"page_size"`
+	Total          int64  `json:"total"`
+}
+
+type SearchHit struct {
+	Item       MediaItem        `json:"item"`
+	Score      float64          `json:"score"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// SearchHighlights are HTML fragments of the fields q matched, with the
+// matched words in <mark> tags. Fields it did not match are omitted.
+type SearchHighlights struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Transcript  string `json:"transcript,omitempty"`
+	Attachments string `json:"attachments,omitempty"`
+}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type ReindexResult struct {
+	// Items queued for indexing
+	Queued int `json:"queued"`
+}
@@ -0,0 +1,24 @@
+// media-service/pkg/api/storage.go
+package api
+
+import "time"
+
+type StorageMismatch struct {
+	// missing, size or orphaned
+	Kind string `json:"kind"`
+	// Absent for content-addressed originals no item uses
+	MediaID      uint   `json:"media_id,omitempty"`
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	ExpectedSize int64  `json:"expected_size,omitempty"`
+}
+
+type StorageMismatchList struct {
+	Items []StorageMismatch `json:"items"`
+	// When the reconciliation that found them finished; absent before the
+	// first one
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	Page      int        `json:"page"`
+	PageSize  int        `json:"page_size"`
+	Total     int64      `json:"total"`
+}
@@ -0,0 +1,75 @@
+// media-service/pkg/api/stream.go
+package api
+
+import "time"
+
+const (
+	QualityAuto = "auto"
+	// Only renditions and downloads suited to 2G/3G connections
+	QualityDataSaver = "datasaver"
+)
+
+// Playback holds signed URLs that work without a bearer token until
+// ExpiresAt. Absent URLs mean that form is not available yet.
+type Playback struct {
+	// auto or datasaver
+	Quality string `json:"quality"`
+	// Progressive download of the original upload, with Range support.
+	// Omitted in data-saver mode.
+	SourceURL   string `json:"source_url,omitempty"`
+	SourceBytes int64  `json:"source_bytes,omitempty"`
+	// HLS master playlist; in data-saver mode it lists only the small renditions
+	HLSURL     string      `json:"hls_url,omitempty"`
+	Renditions []Rendition `json:"renditions"`
+	Downloads  []Download  `json:"downloads"`
+	// Language the HLS stream plays by default: the preferred one if the
+	// item has audio in it, otherwise the original's. Empty if the
+	// original's language is not known.
+	Language string `json:"language"`
+	// The original audio and the published dubs, all of which the HLS
+	// master playlist offers
+	AudioTracks []AudioLanguage `json:"audio_tracks"`
+	// Published caption tracks as WebVTT
+	Captions  []Caption `json:"captions"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AudioLanguage is one language the item can be heard in.
+type AudioLanguage struct {
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	// The item's own audio rather than a dub
+	Original bool `json:"original"`
+	// Selected by default in the HLS stream
+	Default bool `json:"default"`
+	// Audio-only variant playlist of a dub, for clients that switch tracks
+	// themselves. The original's audio is in the renditions.
+	URL string `json:"url,omitempty"`
+}
+
+// Rendition is one HLS variant with its estimated data cost.
+type Rendition struct {
+	Name string `json:"name"`
+	// video or audio
+	Kind        string `json:"kind"`
+	Height      int    `json:"height,omitempty"`
+	BitrateKbps int    `json:"bitrate_kbps"`
+	DataSaver   bool   `json:"data_saver"`
+	// Approximate bytes to play the whole item, from its duration
+	EstimatedBytes int64 `json:"estimated_bytes"`
+	// Approximate megabytes per hour of playback
+	MBPerHour float64 `json:"mb_per_hour"`
+	// Variant playlist, for clients that pick a rendition themselves
+	URL string `json:"url"`
+}
+
+// Download is a standalone audio-only file.
+type Download struct {
+	Name           string  `json:"name"`
+	ContentType    string  `json:"content_type"`
+	BitrateKbps    int     `json:"bitrate_kbps"`
+	DataSaver      bool    `json:"data_saver"`
+	EstimatedBytes int64   `json:"estimated_bytes"`
+	MBPerHour      float64 `json:"mb_per_hour"`
+	URL            string  `json:"url"`
+}
@@ -0,0 +1,140 @@
+// media-service/pkg/apperror/errors.go
+package apperror
+
+import (
+	"errors"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+)
+
+// Code is the stable, machine-readable identifier clients switch on to
+// localize a failure. Codes are part of the public API: never rename one.
+type Code string
+
+const (
+	CodeValidationFailed Code = "validation_failed"
+	CodeUnauthorized     Code = "unauthorized"
+	CodeForbidden        Code = "forbidden"
+	CodeNotFound         Code = "not_found"
+	CodeConflict         Code = "conflict"
+	CodePayloadTooLarge  Code = "payload_too_large"
+	CodeUnsupportedMedia Code = "unsupported_media_type"
+	CodeOffsetMismatch   Code = "offset_mismatch"
+	CodeChecksumMismatch Code = "checksum_mismatch"
+	CodeUploadLocked     Code = "upload_locked"
+	CodeUploadExpired    Code = "upload_expired"
+	CodeUnsupportedTus   Code = "unsupported_tus_version"
+	CodeInvalidSignature Code = "invalid_signature"
+	CodeLinkExpired      Code = "link_expired"
+	CodeNotReady         Code = "not_ready"
+	CodeLicenseRevoked   Code = "license_revoked"
+	CodeEmbargoed        Code = "embargoed"
+	CodeLocked           Code = "locked"
+	CodeNotEnabled       Code = "not_enabled"
+	CodeInternal         Code = "internal_error"
+)
+
+// Error is a domain error that knows how it should be presented over HTTP.
+// Err holds the underlying cause for logging and is never sent to clients.
+type Error struct {
+	Code   Code
+	Status int
+	Title  string
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+// FieldError describes a single invalid request field.
+type FieldError = api.FieldError
+
+var (
+	ErrValidation       = New(CodeValidationFailed, http.StatusBadRequest, "Request validation failed")
+	ErrUnauthorized     = New(CodeUnauthorized, http.StatusUnauthorized, "Authentication required")
+	ErrForbidden        = New(CodeForbidden, http.StatusForbidden, "Access denied")
+	ErrNotFound         = New(CodeNotFound, http.StatusNotFound, "Resource not found")
+	ErrConflict         = New(CodeConflict, http.StatusConflict, "Resource already exists")
+	ErrPayloadTooLarge  = New(CodePayloadTooLarge, http.StatusRequestEntityTooLarge, "Payload too large")
+	ErrUnsupportedMedia = New(CodeUnsupportedMedia, http.StatusUnsupportedMediaType, "Unsupported media type")
+	ErrOffsetMismatch   = New(CodeOffsetMismatch, http.StatusConflict, "Upload offset does not match")
+	// 460 is the status the tus checksum extension defines for mismatches
+	ErrChecksumMismatch = New(CodeChecksumMismatch, 460, "Checksum mismatch")
+	ErrUploadLocked     = New(CodeUploadLocked, http.StatusLocked, "Upload is being written by another request")
+	ErrUploadExpired    = New(CodeUploadExpired, http.StatusGone, "Upload has expired")
+	ErrUnsupportedTus   = New(CodeUnsupportedTus, http.StatusPreconditionFailed, "Unsupported tus protocol version")
+	ErrInvalidSignature = New(CodeInvalidSignature, http.StatusForbidden, "Invalid link signature")
+	ErrLinkExpired      = New(CodeLinkExpired, http.StatusForbidden, "Link has expired")
+	ErrNotReady         = New(CodeNotReady, http.StatusConflict, "Media is not ready for playback")
+	ErrLicenseRevoked   = New(CodeLicenseRevoked, http.StatusGone, "Offline license has been revoked")
+	ErrEmbargoed        = New(CodeEmbargoed, http.StatusForbidden, "Media is under embargo")
+	ErrLocked           = New(CodeLocked, http.StatusForbidden, "Media is not unlocked yet")
+	ErrNotEnabled       = New(CodeNotEnabled, http.StatusNotImplemented, "Feature is not enabled")
+	ErrInternal         = New(CodeInternal, http.StatusInternalServerError, "Internal server error")
+)
+
+func New(code Code, status int, title string) *Error {
+	return &Error{Code: code, Status: status, Title: title}
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code) + ": " + e.Title
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches on Code so errors.Is(err, ErrNotFound) holds for any copy
+// produced by WithDetail or Wrap.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail returns a copy carrying a client-safe explanation.
+func (e *Error) WithDetail(detail string) *Error {
+	cp := *e
+	cp.Detail = detail
+	return &cp
+}
+
+// WithFields returns a copy carrying per-field validation messages.
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	cp := *e
+	cp.Fields = append(append([]FieldError(nil), e.Fields...), fields...)
+	return &cp
+}
+
+// Wrap returns a copy recording err as the internal cause.
+func (e *Error) Wrap(err error) *Error {
+	cp := *e
+	cp.Err = err
+	return &cp
+}
+
+// Validation builds a validation_failed error for the given fields.
+func Validation(fields ...FieldError) *Error {
+	return ErrValidation.WithFields(fields...)
+}
+
+// Internal wraps an unexpected error so its message stays server-side.
+func Internal(err error) *Error {
+	return ErrInternal.Wrap(err)
+}
+
+// From converts any error into an *Error, treating unknown errors as
+// internal failures.
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	return Internal(err)
+}
@@ -0,0 +1,54 @@
+// media-service/pkg/apperror/problem.go
+package apperror
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ProblemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:shepherdsfold:problem:"
+)
+
+// Problem is defined in the api package so the Go client can decode it
+// without pulling in gin.
+type Problem = api.Problem
+
+// NewProblem renders err for the given request path.
+func NewProblem(err *Error, instance string) Problem {
+	return Problem{
+		Type:     problemTypePrefix + string(err.Code),
+		Title:    err.Title,
+		Status:   err.Status,
+		Detail:   err.Detail,
+		Instance: instance,
+		Code:     string(err.Code),
+		Errors:   err.Fields,
+	}
+}
+
+// Respond writes err as problem+json and aborts the request. The full
+// error, including any internal cause, is attached to the gin context so
+// the access log records it.
+func Respond(c *gin.Context, err error) {
+	appErr := From(err)
+	_ = c.Error(err)
+
+	problem := NewProblem(appErr, c.Request.URL.Path)
+	// Set by middleware.RequestID; read from the header to avoid an import cycle
+	problem.RequestID = c.Writer.Header().Get("X-Request-ID")
+
+	c.Header("Content-Type", ProblemContentType)
+	if appErr.Status == http.StatusUnauthorized {
+		c.Header("WWW-Authenticate", `Bearer realm="media-service"`)
+	}
+	c.AbortWithStatusJSON(appErr.Status, problem)
+}
+
+// RespondBinding reports a request binding failure.
+func RespondBinding(c *gin.Context, err error) {
+	Respond(c, FromBinding(err))
+}
@@ -0,0 +1,205 @@
+// media-service/pkg/calendar/ics.go
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// iTIP methods
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+
+	ContentType = "text/calendar; charset=utf-8"
+
+	utcFormat   = "20060102T150405Z"
+	localFormat = "20060102T150405"
+	// Lines are folded at 75 octets, not counting the CRLF
+	maxLine = 75
+	// How far past the last event start VTIMEZONE transitions are listed
+	zoneHorizon = 3 * 365 * 24 * time.Hour
+)
+
+// Calendar is a VCALENDAR object. Method is empty for a feed and set for
+// an iTIP message.
+type Calendar struct {
+	ProdID string
+	Method string
+	Name   string
+	Events []Event
+}
+
+type Event struct {
+	// Stable across updates; with Sequence it lets calendar apps replace
+	// the copy they have
+	UID      string
+	Sequence int
+	Stamp    time.Time
+	// In the location the event is scheduled in
+	Start    time.Time
+	Duration time.Duration
+	// Empty for a one-off event
+	RRule       string
+	Summary     string
+	Description string
+	URL         string
+	Status      string
+	Organizer   Person
+	Attendees   []Person
+}
+
+type Person struct {
+	Name  string
+	Email string
+}
+
+// Write writes the calendar with CRLF line endings, folded and escaped as
+// RFC 5545 requires, including a VTIMEZONE for every zone the events use.
+func Write(w io.Writer, cal *Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", cal.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	if cal.Method != "" {
+		line("METHOD", cal.Method)
+	}
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	for _, tz := range zonesOf(cal.Events) {
+		writeTimezone(bw, tz.loc, tz.from, tz.to)
+	}
+
+	for _, e := range cal.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("SEQUENCE", fmt.Sprint(e.Sequence))
+		line("DTSTAMP", e.Stamp.UTC().Format(utcFormat))
+		writeFolded(bw, dateTime("DTSTART", e.Start))
+		writeFolded(bw, dateTime("DTEND", e.Start.Add(e.Duration)))
+		if e.RRule != "" {
+			line("RRULE", e.RRule)
+		}
+		line("SUMMARY", escapeText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION", escapeText(e.Description))
+		}
+		if e.URL != "" {
+			line("URL", e.URL)
+		}
+		if e.Status != "" {
+			line("STATUS", e.Status)
+		}
+		if e.Organizer.Email != "" {
+			writeFolded(bw, "ORGANIZER"+nameParam(e.Organizer.Name)+":mailto:"+e.Organizer.Email)
+		}
+		for _, a := range e.Attendees {
+			writeFolded(bw, "ATTENDEE;ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE"+
+				nameParam(a.Name)+":mailto:"+a.Email)
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+func dateTime(name string, t time.Time) string {
+	if t.Location() == time.UTC {
+		return name + ":" + t.Format(utcFormat)
+	}
+	return name + ";TZID=" + t.Location().String() + ":" + t.Format(localFormat)
+}
+
+func nameParam(name string) string {
+	if name == "" {
+		return ""
+	}
+	// Parameter values cannot hold DQUOTE; quoting covers ; : and ,
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
+
+func escapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// writeFolded writes one content line, continuing it on lines that start
+// with a space whenever it exceeds maxLine octets. Lines never split
+// inside a UTF-8 sequence.
+func writeFolded(w *bufio.Writer, s string) {
+	limit := maxLine
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		// The leading space counts towards the next line
+		limit = maxLine - 1
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+type zoneSpan struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// zonesOf returns the non-UTC locations of the events, each with the span
+// its VTIMEZONE has to cover.
+func zonesOf(events []Event) []zoneSpan {
+	spans := map[string]*zoneSpan{}
+	for _, e := range events {
+		loc := e.Start.Location()
+		if loc == time.UTC {
+			continue
+		}
+		end := e.Start
+		if e.Stamp.After(end) {
+			end = e.Stamp
+		}
+		if e.RRule != "" {
+			end = end.Add(zoneHorizon)
+		}
+		span, ok := spans[loc.String()]
+		if !ok {
+			spans[loc.String()] = &zoneSpan{loc: loc, from: e.Start, to: end}
+			continue
+		}
+		if e.Start.Before(span.from) {
+			span.from = e.Start
+		}
+		if end.After(span.to) {
+			span.to = end
+		}
+	}
+
+	out := make([]zoneSpan, 0, len(spans))
+	for _, span := range spans {
+		out = append(out, *span)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].loc.String() < out[j].loc.String() })
+	return out
+}
@@ -0,0 +1,265 @@
+// media-service/pkg/calendar/rrule.go
+//
+// Package calendar expands RFC 5545 recurrence rules and writes iCalendar
+// feeds and iTIP (RFC 5546) invitations.
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+// maxIterations bounds expansion of rules that never match, such as the
+// 31st of every second month starting in February.
+const maxIterations = 100000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RRule is the subset of RFC 5545 recurrence rules live sessions use:
+// daily, weekly on given days, or monthly on the start's day of the month,
+// every Interval periods, ending after Count occurrences or at Until.
+type RRule struct {
+	Freq     string
+	Interval int
+	// 0 for no limit
+	Count int
+	// Zero for no end
+	Until time.Time
+	// Weekly only; the start's weekday if empty
+	ByDay []time.Weekday
+}
+
+// ParseRRule parses a rule such as "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10". An
+// "RRULE:" prefix is accepted.
+func ParseRRule(s string) (*RRule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &RRule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly {
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid interval %q", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid count %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return nil, fmt.Errorf("unsupported day %q", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			if strings.ToUpper(value) != "MO" {
+				return nil, errors.New("only WKST=MO is supported")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", name)
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return nil, errors.New("FREQ is required")
+	case r.Count > 0 && !r.Until.IsZero():
+		return nil, errors.New("COUNT and UNTIL cannot both be given")
+	case len(r.ByDay) > 0 && r.Freq != Weekly:
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	sort.Slice(r.ByDay, func(i, j int) bool { return mondayFirst(r.ByDay[i]) < mondayFirst(r.ByDay[j]) })
+	return r, nil
+}
+
+// String formats the rule as it appears after "RRULE:".
+func (r *RRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(utcFormat))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = strings.ToUpper(wd.String()[:2])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Occurrences returns the starts of the occurrences of a series beginning
+// at start that fall in [from, to), at most limit of them. A nil rule is a
+// single occurrence. Occurrences keep start's wall-clock time in its
+// location across daylight saving changes.
+func (r *RRule) Occurrences(start, from, to time.Time, limit int) []time.Time {
+	var out []time.Time
+	emit := func(t time.Time) bool {
+		if !t.Before(from) && t.Before(to) {
+			out = append(out, t)
+		}
+		return len(out) < limit
+	}
+	if r == nil {
+		emit(start)
+		return out
+	}
+
+	n := 0
+	for i := 0; i < maxIterations; i++ {
+		for _, t := range r.period(start, i) {
+			if t.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return out
+			}
+			if !t.Before(to) {
+				return out
+			}
+			n++
+			if !emit(t) {
+				return out
+			}
+			if r.Count > 0 && n >= r.Count {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+// Last returns the start of the last occurrence at or before t, if any.
+func (r *RRule) Last(start, t time.Time) (time.Time, bool) {
+	if r == nil {
+		return start, !start.After(t)
+	}
+	var last time.Time
+	found := false
+	n := 0
+	for i := 0; i < maxIterations; i++ {
+		for _, occ := range r.period(start, i) {
+			if occ.Before(start) {
+				continue
+			}
+			if occ.After(t) || (!r.Until.IsZero() && occ.After(r.Until)) {
+				return last, found
+			}
+			last, found = occ, true
+			n++
+			if r.Count > 0 && n >= r.Count {
+				return last, found
+			}
+		}
+	}
+	return last, found
+}
+
+// period returns the candidate starts of the i-th period of the series.
+func (r *RRule) period(start time.Time, i int) []time.Time {
+	step := i * r.Interval
+	switch r.Freq {
+	case Daily:
+		return []time.Time{addDate(start, 0, step)}
+	case Monthly:
+		if civilDate(start, step, 0).Day() != start.Day() {
+			// No such day this month, e.g. the 31st of April
+			return nil
+		}
+		return []time.Time{addDate(start, step, 0)}
+	default:
+		if len(r.ByDay) == 0 {
+			return []time.Time{addDate(start, 0, 7*step)}
+		}
+		monday := 7*step - mondayFirst(start.Weekday())
+		out := make([]time.Time, len(r.ByDay))
+		for j, wd := range r.ByDay {
+			out[j] = addDate(start, 0, monday+mondayFirst(wd))
+		}
+		return out
+	}
+}
+
+// addDate moves start by months and days, keeping its wall-clock time. A
+// time skipped when the clocks go forward is read with the offset in
+// force before the gap, as RFC 5545 asks, which places it after the gap;
+// AddDate alone would place it before.
+func addDate(start time.Time, months, days int) time.Time {
+	t := start.AddDate(0, months, days)
+	if t.Hour() == start.Hour() && t.Minute() == start.Minute() && t.Second() == start.Second() {
+		return t
+	}
+	y, m, d := civilDate(start, months, days).Date()
+	h, mi, s := start.Clock()
+	_, before := time.Date(y, m, d-1, h, mi, s, start.Nanosecond(), start.Location()).Zone()
+	wall := time.Date(y, m, d, h, mi, s, start.Nanosecond(), time.UTC)
+	return wall.Add(-time.Duration(before) * time.Second).In(start.Location())
+}
+
+// civilDate is the calendar date months and days after start's, at
+// midnight UTC, unaffected by any change of offset.
+func civilDate(start time.Time, months, days int) time.Time {
+	y, m, d := start.Date()
+	return time.Date(y, m+time.Month(months), d+days, 0, 0, 0, 0, time.UTC)
+}
+
+func mondayFirst(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{utcFormat, "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// The whole day counts
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
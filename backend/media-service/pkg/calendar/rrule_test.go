@@ -0,0 +1,290 @@
+// media-service/pkg/calendar/rrule_test.go
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+// at reads a wall-clock time such as "2026-03-03 19:00" in loc.
+func at(t *testing.T, loc *time.Location, s string) time.Time {
+	t.Helper()
+	tm, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func formatTimes(times []time.Time) string {
+	out := make([]string, len(times))
+	for i, tm := range times {
+		out[i] = tm.Format("Mon 2006-01-02 15:04 MST")
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestParseRRule(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY"},
+		{"RRULE:FREQ=WEEKLY;BYDAY=TU,TH;COUNT=10", "FREQ=WEEKLY;COUNT=10;BYDAY=TU,TH"},
+		{"freq=weekly;byday=su,mo,fr;interval=2", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR,SU"},
+		{"FREQ=WEEKLY;INTERVAL=1;WKST=MO", "FREQ=WEEKLY"},
+		{"FREQ=MONTHLY;UNTIL=20261231T235959Z", "FREQ=MONTHLY;UNTIL=20261231T235959Z"},
+		{"FREQ=DAILY;UNTIL=20261231T180000", "FREQ=DAILY;UNTIL=20261231T180000Z"},
+		// A date alone includes the whole day
+		{"FREQ=DAILY;UNTIL=20261231", "FREQ=DAILY;UNTIL=20261231T235959Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := r.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if again, err := ParseRRule(r.String()); err != nil || again.String() != tt.want {
+				t.Errorf("reparsed as %v, err %v", again, err)
+			}
+		})
+	}
+}
+
+func TestParseRRuleErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=HOURLY",
+		"FREQ=WEEKLY;BYDAY=",
+		"FREQ=WEEKLY;BYDAY=TU,XX",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=MONTHLY;BYDAY=MO",
+		"FREQ=DAILY;COUNT=0",
+		"FREQ=DAILY;COUNT=ten",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;UNTIL=2026-12-31",
+		"FREQ=DAILY;COUNT=3;UNTIL=20261231",
+		"FREQ=WEEKLY;WKST=SU",
+		"FREQ=MONTHLY;BYMONTHDAY=1",
+		"FREQ=DAILY;",
+	} {
+		if r, err := ParseRRule(rule); err == nil {
+			t.Errorf("%q parsed as %s", rule, r)
+		}
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	london := mustLocation(t, "Europe/London")
+	sydney := mustLocation(t, "Australia/Sydney")
+	// Clocks went forward at midnight until 2019
+	saoPaulo := mustLocation(t, "America/Sao_Paulo")
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		// Zero for the start
+		from time.Time
+		// Zero for a year after the start
+		to    time.Time
+		limit int
+		want  string
+	}{
+		{
+			name:  "byday with count",
+			rule:  "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=5",
+			start: at(t, time.UTC, "2026-03-03 19:00"),
+			want: "Tue 2026-03-03 19:00 UTC, Thu 2026-03-05 19:00 UTC, Tue 2026-03-10 19:00 UTC, " +
+				"Thu 2026-03-12 19:00 UTC, Tue 2026-03-17 19:00 UTC",
+		},
+		{
+			name:  "byday skips days before the start",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=4",
+			start: at(t, time.UTC, "2026-03-04 06:30"),
+			want: "Wed 2026-03-04 06:30 UTC, Fri 2026-03-06 06:30 UTC, Mon 2026-03-09 06:30 UTC, " +
+				"Wed 2026-03-11 06:30 UTC",
+		},
+		{
+			name:  "byday not including the start's day",
+			rule:  "FREQ=WEEKLY;BYDAY=SU;COUNT=2",
+			start: at(t, time.UTC, "2026-03-04 10:00"),
+			want:  "Sun 2026-03-08 10:00 UTC, Sun 2026-03-15 10:00 UTC",
+		},
+		{
+			name:  "byday every other week",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SA;COUNT=5",
+			start: at(t, time.UTC, "2026-03-07 09:00"),
+			want: "Sat 2026-03-07 09:00 UTC, Mon 2026-03-16 09:00 UTC, Sat 2026-03-21 09:00 UTC, " +
+				"Mon 2026-03-30 09:00 UTC, Sat 2026-04-04 09:00 UTC",
+		},
+		{
+			name:  "until is inclusive",
+			rule:  "FREQ=WEEKLY;UNTIL=20260120T190000Z",
+			start: at(t, time.UTC, "2026-01-06 19:00"),
+			want:  "Tue 2026-01-06 19:00 UTC, Tue 2026-01-13 19:00 UTC, Tue 2026-01-20 19:00 UTC",
+		},
+		{
+			name:  "until just before an occurrence",
+			rule:  "FREQ=WEEKLY;UNTIL=20260120T185959Z",
+			start: at(t, time.UTC, "2026-01-06 19:00"),
+			want:  "Tue 2026-01-06 19:00 UTC, Tue 2026-01-13 19:00 UTC",
+		},
+		{
+			name:  "until a date",
+			rule:  "FREQ=DAILY;UNTIL=20260108",
+			start: at(t, time.UTC, "2026-01-06 21:00"),
+			want:  "Tue 2026-01-06 21:00 UTC, Wed 2026-01-07 21:00 UTC, Thu 2026-01-08 21:00 UTC",
+		},
+		{
+			name:  "until before the start",
+			rule:  "FREQ=DAILY;UNTIL=20260101",
+			start: at(t, time.UTC, "2026-01-06 21:00"),
+			want:  "",
+		},
+		{
+			name:  "monthly skips months without the day",
+			rule:  "FREQ=MONTHLY;COUNT=4",
+			start: at(t, time.UTC, "2026-01-31 10:00"),
+			want: "Sat 2026-01-31 10:00 UTC, Tue 2026-03-31 10:00 UTC, Sun 2026-05-31 10:00 UTC, " +
+				"Fri 2026-07-31 10:00 UTC",
+		},
+		{
+			name:  "count includes occurrences before from",
+			rule:  "FREQ=DAILY;COUNT=5",
+			start: at(t, time.UTC, "2026-01-01 08:00"),
+			from:  at(t, time.UTC, "2026-01-03 00:00"),
+			want:  "Sat 2026-01-03 08:00 UTC, Sun 2026-01-04 08:00 UTC, Mon 2026-01-05 08:00 UTC",
+		},
+		{
+			name:  "window and limit",
+			rule:  "FREQ=DAILY",
+			start: at(t, time.UTC, "2026-01-01 08:00"),
+			from:  at(t, time.UTC, "2026-02-10 08:00"),
+			to:    at(t, time.UTC, "2026-03-01 00:00"),
+			limit: 2,
+			want:  "Tue 2026-02-10 08:00 UTC, Wed 2026-02-11 08:00 UTC",
+		},
+		// Daylight saving: the wall-clock time holds as the offset changes
+		{
+			name:  "weekly across the start of daylight saving",
+			rule:  "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=4",
+			start: at(t, newYork, "2026-03-03 19:00"),
+			want: "Tue 2026-03-03 19:00 EST, Thu 2026-03-05 19:00 EST, Tue 2026-03-10 19:00 EDT, " +
+				"Thu 2026-03-12 19:00 EDT",
+		},
+		{
+			name:  "daily across the end of daylight saving, until a date",
+			rule:  "FREQ=DAILY;UNTIL=20261102",
+			start: at(t, newYork, "2026-10-31 07:30"),
+			want:  "Sat 2026-10-31 07:30 EDT, Sun 2026-11-01 07:30 EST, Mon 2026-11-02 07:30 EST",
+		},
+		{
+			name:  "fortnightly across the end of summer time, until in UTC",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;BYDAY=SA;UNTIL=20261114T090000Z",
+			start: at(t, london, "2026-10-17 09:00"),
+			want:  "Sat 2026-10-17 09:00 BST, Sat 2026-10-31 09:00 GMT, Sat 2026-11-14 09:00 GMT",
+		},
+		{
+			name:  "monthly across the southern hemisphere's change",
+			rule:  "FREQ=MONTHLY;COUNT=3",
+			start: at(t, sydney, "2026-03-15 18:00"),
+			want:  "Sun 2026-03-15 18:00 AEDT, Wed 2026-04-15 18:00 AEST, Fri 2026-05-15 18:00 AEST",
+		},
+		{
+			name:  "daily into the hour skipped by the change",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: at(t, newYork, "2026-03-07 02:30"),
+			want:  "Sat 2026-03-07 02:30 EST, Sun 2026-03-08 03:30 EDT, Mon 2026-03-09 02:30 EDT",
+		},
+		{
+			name:  "weekly into a skipped midnight",
+			rule:  "FREQ=WEEKLY;BYDAY=SA,SU;COUNT=3",
+			start: at(t, saoPaulo, "2018-11-03 00:30"),
+			want:  "Sat 2018-11-03 00:30 -03, Sun 2018-11-04 01:30 -02, Sat 2018-11-10 00:30 -02",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			from, to, limit := tt.from, tt.to, tt.limit
+			if from.IsZero() {
+				from = tt.start
+			}
+			if to.IsZero() {
+				to = tt.start.AddDate(1, 0, 0)
+			}
+			if limit == 0 {
+				limit = 100
+			}
+			if got := formatTimes(r.Occurrences(tt.start, from, to, limit)); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOccurrencesSingle(t *testing.T) {
+	var r *RRule
+	start := at(t, time.UTC, "2026-05-01 10:00")
+	if got := r.Occurrences(start, start.Add(-time.Hour), start.Add(time.Hour), 10); len(got) != 1 || !got[0].Equal(start) {
+		t.Errorf("got %v", got)
+	}
+	if got := r.Occurrences(start, start.Add(time.Minute), start.Add(time.Hour), 10); len(got) != 0 {
+		t.Errorf("got %v after the only occurrence", got)
+	}
+}
+
+func TestLast(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	start := at(t, newYork, "2026-03-03 19:00")
+
+	tests := []struct {
+		name string
+		rule string
+		t    time.Time
+		want string
+	}{
+		{"before the start", "FREQ=WEEKLY;BYDAY=TU,TH", at(t, newYork, "2026-03-03 18:59"), ""},
+		{"at an occurrence", "FREQ=WEEKLY;BYDAY=TU,TH", at(t, newYork, "2026-03-10 19:00"), "Tue 2026-03-10 19:00 EDT"},
+		{"between occurrences", "FREQ=WEEKLY;BYDAY=TU,TH", at(t, newYork, "2026-03-11 12:00"), "Tue 2026-03-10 19:00 EDT"},
+		{"after the count", "FREQ=WEEKLY;BYDAY=TU,TH;COUNT=3", at(t, newYork, "2026-06-01 00:00"), "Tue 2026-03-10 19:00 EDT"},
+		{"after until", "FREQ=WEEKLY;BYDAY=TU,TH;UNTIL=20260306", at(t, newYork, "2026-06-01 00:00"), "Thu 2026-03-05 19:00 EST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if last, ok := r.Last(start, tt.t); ok {
+				got = formatTimes([]time.Time{last})
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
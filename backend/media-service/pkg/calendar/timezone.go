@@ -0,0 +1,91 @@
+// media-service/pkg/calendar/timezone.go
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+)
+
+// transition is a change of UTC offset in a location.
+type transition struct {
+	at         time.Time
+	offsetFrom int
+	offsetTo   int
+	name       string
+	dst        bool
+}
+
+// writeTimezone writes a VTIMEZONE for loc listing the offset in force at
+// from and every change up to to, which is all a calendar app needs to
+// place events in that span. Go's zone data has no rules to copy, so each
+// change is its own observance.
+func writeTimezone(w *bufio.Writer, loc *time.Location, from, to time.Time) {
+	from = from.In(loc)
+	name, offset := from.Zone()
+	initial := transition{
+		// Observances start in the local time before their onset
+		at:         from,
+		offsetFrom: offset,
+		offsetTo:   offset,
+		name:       name,
+		dst:        from.IsDST(),
+	}
+
+	writeFolded(w, "BEGIN:VTIMEZONE")
+	writeFolded(w, "TZID:"+loc.String())
+	for _, t := range append([]transition{initial}, transitions(loc, from, to)...) {
+		kind := "STANDARD"
+		if t.dst {
+			kind = "DAYLIGHT"
+		}
+		onset := t.at.UTC().Add(time.Duration(t.offsetFrom) * time.Second)
+		writeFolded(w, "BEGIN:"+kind)
+		writeFolded(w, "DTSTART:"+onset.Format(localFormat))
+		writeFolded(w, "TZOFFSETFROM:"+formatOffset(t.offsetFrom))
+		writeFolded(w, "TZOFFSETTO:"+formatOffset(t.offsetTo))
+		if t.name != "" {
+			writeFolded(w, "TZNAME:"+t.name)
+		}
+		writeFolded(w, "END:"+kind)
+	}
+	writeFolded(w, "END:VTIMEZONE")
+}
+
+// transitions finds the offset changes in (from, to] by stepping a day at
+// a time and narrowing each change down to the second.
+func transitions(loc *time.Location, from, to time.Time) []transition {
+	var out []transition
+	_, prev := from.In(loc).Zone()
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if _, offset := next.In(loc).Zone(); offset == prev {
+			t = next
+			continue
+		}
+		lo, hi := t, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, offset := mid.In(loc).Zone(); offset == prev {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		at := hi.In(loc)
+		name, offset := at.Zone()
+		out = append(out, transition{at: at, offsetFrom: prev, offsetTo: offset, name: name, dst: at.IsDST()})
+		prev = offset
+		t = hi
+	}
+	return out
+}
+
+func formatOffset(seconds int) string {
+	sign := '+'
+	if seconds < 0 {
+		sign = '-'
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%c%02d%02d", sign, seconds/3600, seconds/60%60)
+}
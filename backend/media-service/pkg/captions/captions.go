@@ -0,0 +1,228 @@
+// media-service/pkg/captions/captions.go
+//
+// Package captions reads and writes WebVTT and SubRip caption files.
+// Only cue timing and text survive a round trip; styling, regions and
+// cue settings are dropped.
+package captions
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatVTT = "vtt"
+	FormatSRT = "srt"
+)
+
+var ContentTypes = map[string]string{
+	FormatVTT: "text/vtt; charset=utf-8",
+	FormatSRT: "application/x-subrip; charset=utf-8",
+}
+
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// ParseError reports the line a caption file stopped making sense at.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("captions: line %d: %s", e.Line, e.Msg)
+}
+
+var ErrEmpty = errors.New("captions: file has no cues")
+
+// DetectFormat tells WebVTT, which must start with "WEBVTT", from SRT.
+func DetectFormat(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if bytes.HasPrefix(data, []byte("WEBVTT")) {
+		return FormatVTT
+	}
+	return FormatSRT
+}
+
+// Parse reads a caption file in either format.
+func Parse(r io.Reader) ([]Cue, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if DetectFormat(data) == FormatVTT {
+		return parse(data, true)
+	}
+	return parse(data, false)
+}
+
+// parse handles both formats, which differ only in the header, the
+// optional cue identifier and the millisecond separator.
+func parse(data []byte, vtt bool) ([]Cue, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var cues []Cue
+	lineNo := 0
+	var block []string
+	blockStart := 0
+
+	flush := func() error {
+		defer func() { block = block[:0] }()
+		if len(block) == 0 {
+			return nil
+		}
+		first := block[0]
+		if vtt && (strings.HasPrefix(first, "WEBVTT") || strings.HasPrefix(first, "NOTE") ||
+			first == "STYLE" || first == "REGION") {
+			return nil
+		}
+
+		// An identifier line may precede the timing line
+		timing := 0
+		if !strings.Contains(first, "-->") {
+			timing = 1
+		}
+		if timing >= len(block) || !strings.Contains(block[timing], "-->") {
+			return &ParseError{Line: blockStart, Msg: "expected a cue timing line"}
+		}
+
+		start, end, err := parseTiming(block[timing])
+		if err != nil {
+			return &ParseError{Line: blockStart + timing, Msg: err.Error()}
+		}
+		text := strings.TrimSpace(strings.Join(block[timing+1:], "\n"))
+		if text == "" {
+			return nil
+		}
+		cues = append(cues, Cue{Start: start, End: end, Text: text})
+		return nil
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if len(block) == 0 {
+			blockStart = lineNo
+		}
+		block = append(block, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(cues) == 0 {
+		return nil, ErrEmpty
+	}
+	return cues, nil
+}
+
+func parseTiming(line string) (time.Duration, time.Duration, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	// WebVTT cue settings follow the end time
+	endFields := strings.Fields(parts[1])
+	if len(endFields) == 0 {
+		return 0, 0, errors.New("missing end time")
+	}
+	end, err := parseTimestamp(endFields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, errors.New("cue ends before it starts")
+	}
+	return start, end, nil
+}
+
+// parseTimestamp accepts [hh:]mm:ss.mmm and hh:mm:ss,mmm. Hours may run
+// past 99; minutes and seconds must be below 60.
+func parseTimestamp(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid timestamp %q", s)
+	s = strings.Replace(s, ",", ".", 1)
+
+	clock, frac, ok := strings.Cut(s, ".")
+	if !ok || len(frac) != 3 || strings.Trim(frac, "0123456789") != "" {
+		return 0, invalid
+	}
+	ms, err := strconv.Atoi(frac)
+	if err != nil {
+		return 0, invalid
+	}
+
+	fields := strings.Split(clock, ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, invalid
+	}
+	var total int
+	for i, f := range fields {
+		if f == "" || strings.Trim(f, "0123456789") != "" {
+			return 0, invalid
+		}
+		n, err := strconv.Atoi(f)
+		if err != nil || (n >= 60 && (len(fields) == 2 || i > 0)) {
+			return 0, invalid
+		}
+		total = total*60 + n
+	}
+	return time.Duration(total)*time.Second + time.Duration(ms)*time.Millisecond, nil
+}
+
+// Write renders cues in format.
+func Write(w io.Writer, format string, cues []Cue) error {
+	switch format {
+	case FormatVTT:
+		return WriteVTT(w, cues)
+	case FormatSRT:
+		return WriteSRT(w, cues)
+	default:
+		return fmt.Errorf("captions: unknown format %q", format)
+	}
+}
+
+func WriteVTT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		fmt.Fprintf(bw, "\n%s --> %s\n%s\n", Timestamp(c.Start, '.'), Timestamp(c.End, '.'), c.Text)
+	}
+	return bw.Flush()
+}
+
+func WriteSRT(w io.Writer, cues []Cue) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range cues {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n%s\n", i+1, Timestamp(c.Start, ','), Timestamp(c.End, ','), c.Text)
+	}
+	return bw.Flush()
+}
+
+// Timestamp formats d as hh:mm:ss followed by sep and milliseconds.
+func Timestamp(d time.Duration, sep byte) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
@@ -0,0 +1,219 @@
+// media-service/pkg/captions/captions_test.go
+package captions
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ts(h, m, s, ms int) time.Duration {
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Cue
+	}{
+		{
+			name: "srt",
+			data: "1\n00:00:01,000 --> 00:00:04,500\nIn the beginning was the Word.\n\n" +
+				"2\n00:00:05,000 --> 00:00:08,250\nAnd the Word was with God,\nand the Word was God.\n",
+			want: []Cue{
+				{ts(0, 0, 1, 0), ts(0, 0, 4, 500), "In the beginning was the Word."},
+				{ts(0, 0, 5, 0), ts(0, 0, 8, 250), "And the Word was with God,\nand the Word was God."},
+			},
+		},
+		{
+			name: "srt with crlf",
+			data: "1\r\n00:00:01,000 --> 00:00:04,500\r\nIn the beginning was the Word.\r\n\r\n" +
+				"2\r\n00:00:05,000 --> 00:00:08,250\r\nAnd the Word was with God,\r\nand the Word was God.\r\n",
+			want: []Cue{
+				{ts(0, 0, 1, 0), ts(0, 0, 4, 500), "In the beginning was the Word."},
+				{ts(0, 0, 5, 0), ts(0, 0, 8, 250), "And the Word was with God,\nand the Word was God."},
+			},
+		},
+		{
+			name: "srt with bom, crlf and no final newline",
+			data: "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nAmen.",
+			want: []Cue{{ts(0, 0, 1, 0), ts(0, 0, 2, 0), "Amen."}},
+		},
+		{
+			name: "srt without identifiers and extra blank lines",
+			data: "\n\n00:00:01,000 --> 00:00:02,000\nGrace\n\n\n\n00:00:03,000 --> 00:00:04,000\nPeace\n\n",
+			want: []Cue{
+				{ts(0, 0, 1, 0), ts(0, 0, 2, 0), "Grace"},
+				{ts(0, 0, 3, 0), ts(0, 0, 4, 0), "Peace"},
+			},
+		},
+		{
+			name: "srt past an hour",
+			data: "812\n01:02:03,456 --> 01:02:07,000\nLet us pray.\n\n" +
+				"813\n10:59:59,999 --> 11:00:00,000\nThe end of a very long vigil.\n\n" +
+				"814\n123:00:00,000 --> 123:00:01,000\nA recording left running.\n",
+			want: []Cue{
+				{ts(1, 2, 3, 456), ts(1, 2, 7, 0), "Let us pray."},
+				{ts(10, 59, 59, 999), ts(11, 0, 0, 0), "The end of a very long vigil."},
+				{ts(123, 0, 0, 0), ts(123, 0, 1, 0), "A recording left running."},
+			},
+		},
+		{
+			name: "srt cue without text",
+			data: "1\n00:00:01,000 --> 00:00:02,000\n\n2\n00:00:03,000 --> 00:00:04,000\nSelah\n",
+			want: []Cue{{ts(0, 0, 3, 0), ts(0, 0, 4, 0), "Selah"}},
+		},
+		{
+			name: "vtt",
+			data: "WEBVTT\n\n00:01.000 --> 00:04.500\nBlessed are the poor in spirit,\n\n" +
+				"intro\n00:05.000 --> 00:08.000 align:start position:10%\nfor theirs is the kingdom of heaven.\n",
+			want: []Cue{
+				{ts(0, 0, 1, 0), ts(0, 0, 4, 500), "Blessed are the poor in spirit,"},
+				{ts(0, 0, 5, 0), ts(0, 0, 8, 0), "for theirs is the kingdom of heaven."},
+			},
+		},
+		{
+			name: "vtt with crlf, header text, notes and styles",
+			data: "WEBVTT - Sermon on the Mount\r\nKind: captions\r\n\r\n" +
+				"NOTE transcribed by volunteers\r\n\r\n" +
+				"STYLE\r\n::cue { color: yellow }\r\n\r\n" +
+				"1\r\n00:00:01.000 --> 00:00:02.000\r\nBlessed are the meek,\r\n\r\n" +
+				"00:02.000 --> 00:03.000\r\nfor they shall inherit the earth.\r\n",
+			want: []Cue{
+				{ts(0, 0, 1, 0), ts(0, 0, 2, 0), "Blessed are the meek,"},
+				{ts(0, 0, 2, 0), ts(0, 0, 3, 0), "for they shall inherit the earth."},
+			},
+		},
+		{
+			name: "vtt past an hour",
+			data: "WEBVTT\n\n59:59.500 --> 1:00:00.500\nAcross the hour\n\n" +
+				"01:30:00.000 --> 01:30:02.000\nAn hour and a half in\n\n" +
+				"100:00:00.000 --> 100:00:02.000\nA hundred hours in\n",
+			want: []Cue{
+				{ts(0, 59, 59, 500), ts(1, 0, 0, 500), "Across the hour"},
+				{ts(1, 30, 0, 0), ts(1, 30, 2, 0), "An hour and a half in"},
+				{ts(100, 0, 0, 0), ts(100, 0, 2, 0), "A hundred hours in"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		line int
+	}{
+		{"no timing line", "1\nIn the beginning\n", 1},
+		{"identifier only", "1\n\n", 1},
+		{"bad timestamp", "1\n00:00:01 --> 00:00:02,000\nAmen\n", 2},
+		{"missing end time", "1\n00:00:01,000 -->\nAmen\n", 2},
+		{"ends before it starts", "1\n00:00:02,000 --> 00:00:01,000\nAmen\n", 2},
+		{"minutes out of range", "1\n00:60:00,000 --> 01:00:01,000\nAmen\n", 2},
+		{"seconds out of range", "WEBVTT\n\n00:60.000 --> 01:01.000\nAmen\n", 3},
+		{"short milliseconds", "WEBVTT\n\n00:01.5 --> 00:02.000\nAmen\n", 3},
+		{"negative", "WEBVTT\n\n-00:01.000 --> 00:02.000\nAmen\n", 3},
+		{"second cue, crlf", "1\r\n00:00:01,000 --> 00:00:02,000\r\nAmen\r\n\r\n2\r\n00:00:03,000 -> 00:00:04,000\r\nAmen\r\n", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cues, err := Parse(strings.NewReader(tt.data))
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("got %+v, err %v; want a parse error", cues, err)
+			}
+			if perr.Line != tt.line {
+				t.Errorf("error at line %d, want %d: %v", perr.Line, tt.line, err)
+			}
+		})
+	}
+
+	for _, data := range []string{"", "WEBVTT\n", "WEBVTT\r\n\r\nNOTE nothing yet\r\n", "1\n00:00:01,000 --> 00:00:02,000\n"} {
+		if _, err := Parse(strings.NewReader(data)); !errors.Is(err, ErrEmpty) {
+			t.Errorf("%q: err %v, want %v", data, err, ErrEmpty)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"WEBVTT\n\n00:01.000 --> 00:02.000\nAmen\n", FormatVTT},
+		{"\ufeffWEBVTT\r\n", FormatVTT},
+		{"1\n00:00:01,000 --> 00:00:02,000\nAmen\n", FormatSRT},
+		{" WEBVTT\n", FormatSRT},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat([]byte(tt.data)); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		sep  byte
+		want string
+	}{
+		{0, '.', "00:00:00.000"},
+		{ts(0, 0, 4, 500), ',', "00:00:04,500"},
+		{ts(1, 2, 3, 456), '.', "01:02:03.456"},
+		{ts(123, 59, 59, 999), ',', "123:59:59,999"},
+	}
+	for _, tt := range tests {
+		if got := Timestamp(tt.d, tt.sep); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	cues := []Cue{
+		{ts(0, 0, 1, 0), ts(0, 0, 4, 500), "Grace to you"},
+		{ts(1, 0, 0, 0), ts(1, 0, 2, 1), "and peace,\nfrom God our Father"},
+		{ts(100, 0, 0, 0), ts(100, 0, 1, 0), "Amen"},
+	}
+	for _, format := range []string{FormatVTT, FormatSRT} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, format, cues); err != nil {
+				t.Fatal(err)
+			}
+			if got := DetectFormat(buf.Bytes()); got != format {
+				t.Errorf("written %s detected as %s", format, got)
+			}
+			// As a Windows editor would save it
+			crlf := strings.ReplaceAll(buf.String(), "\n", "\r\n")
+			got, err := Parse(strings.NewReader(crlf))
+			if err != nil {
+				t.Fatalf("parse: %v\n%s", err, buf.String())
+			}
+			if !reflect.DeepEqual(got, cues) {
+				t.Errorf("got %+v\nwant %+v", got, cues)
+			}
+		})
+	}
+
+	if err := Write(&bytes.Buffer{}, "ttml", cues); err == nil {
+		t.Error("wrote an unknown format")
+	}
+}
@@ -0,0 +1,59 @@
+// media-service/pkg/config/attachments.go
+package config
+
+import (
+	"context"
+	"fmt"
+	"shepherdsfold/media-service/pkg/documents"
+	"shepherdsfold/media-service/pkg/scan"
+)
+
+var (
+	// Scanner checks attachments for malware; nil when scanning is off
+	Scanner scan.Scanner
+	// Previewer renders attachment thumbnails and text; nil when
+	// previews are off
+	Previewer documents.Previewer
+)
+
+func SetupScanner() (scan.Scanner, error) {
+	var s scan.Scanner
+	switch Config.Attachments.Scanner {
+	case "":
+		return nil, nil
+	case "clamav":
+		clamd, err := scan.NewClamdScanner(context.Background(), Config.Attachments.ClamdAddress, Config.Attachments.ScanTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("clamd not available: %w", err)
+		}
+		s = clamd
+	case "fake":
+		s = &scan.FakeScanner{}
+	default:
+		return nil, fmt.Errorf("unknown scanner %q", Config.Attachments.Scanner)
+	}
+
+	Scanner = s
+	return s, nil
+}
+
+func SetupPreviewer() (documents.Previewer, error) {
+	var p documents.Previewer
+	switch Config.Attachments.Previewer {
+	case "":
+		return nil, nil
+	case "command":
+		cmd, err := documents.NewCommandPreviewer(Config.Attachments.PDFToPPMPath, Config.Attachments.PDFToTextPath, Config.Attachments.SofficePath)
+		if err != nil {
+			return nil, fmt.Errorf("document tools not available: %w", err)
+		}
+		p = cmd
+	case "fake":
+		p = &documents.FakePreviewer{}
+	default:
+		return nil, fmt.Errorf("unknown previewer %q", Config.Attachments.Previewer)
+	}
+
+	Previewer = p
+	return p, nil
+}
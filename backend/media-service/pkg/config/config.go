@@ -0,0 +1,404 @@
+// media-service/pkg/config/config.go
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var (
+	DB          *gorm.DB
+	RedisClient *redis.Client
+	Log         *logrus.Logger
+	Config      *Configuration
+)
+
+type Configuration struct {
+	Server      ServerConfig      `mapstructure:"server"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	JWT         JWTConfig         `mapstructure:"jwt"`
+	Log         LogConfig         `mapstructure:"log"`
+	Catalog     CatalogConfig     `mapstructure:"catalog"`
+	Storage     StorageConfig     `mapstructure:"storage"`
+	Uploads     UploadsConfig     `mapstructure:"uploads"`
+	Jobs        JobsConfig        `mapstructure:"jobs"`
+	Transcode   TranscodeConfig   `mapstructure:"transcode"`
+	Streaming   StreamingConfig   `mapstructure:"streaming"`
+	Offline     OfflineConfig     `mapstructure:"offline"`
+	Captions    CaptionsConfig    `mapstructure:"captions"`
+	Speech      SpeechConfig      `mapstructure:"speech"`
+	Images      ImagesConfig      `mapstructure:"images"`
+	Progress    ProgressConfig    `mapstructure:"progress"`
+	Live        LiveConfig        `mapstructure:"live"`
+	Calendar    CalendarConfig    `mapstructure:"calendar"`
+	Mail        MailConfig        `mapstructure:"mail"`
+	Search      SearchConfig      `mapstructure:"search"`
+	Analytics   AnalyticsConfig   `mapstructure:"analytics"`
+	Attachments AttachmentsConfig `mapstructure:"attachments"`
+	Moderation  ModerationConfig  `mapstructure:"moderation"`
+	Users       UsersConfig       `mapstructure:"users"`
+}
+
+type ServerConfig struct {
+	Port         string        `mapstructure:"port"`
+	Environment  string        `mapstructure:"environment"`
+	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+}
+
+type DatabaseConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	DBName   string `mapstructure:"dbname"`
+	SSLMode  string `mapstructure:"sslmode"`
+}
+
+type RedisConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	Password string `mapstructure:"password"`
+	DB       int    `mapstructure:"db"`
+}
+
+// JWTConfig must share its secret with auth-service, which issues the tokens.
+type JWTConfig struct {
+	Secret string `mapstructure:"secret"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level"`
+	Format string `mapstructure:"format"`
+}
+
+type CatalogConfig struct {
+	DefaultPageSize int `mapstructure:"default_page_size"`
+	MaxPageSize     int `mapstructure:"max_page_size"`
+}
+
+type StorageConfig struct {
+	// "local" or "s3"
+	Driver   string   `mapstructure:"driver"`
+	LocalDir string   `mapstructure:"local_dir"`
+	S3       S3Config `mapstructure:"s3"`
+	// Originals at least this large are stored in parts of this size; 0
+	// stores every file in one request. S3 needs at least 5 MiB.
+	PartSize int64 `mapstructure:"part_size"`
+	// Send downloads of originals straight to presigned storage URLs
+	// instead of through the service, where the driver supports them
+	PresignDownloads bool            `mapstructure:"presign_downloads"`
+	Lifecycle        LifecycleConfig `mapstructure:"lifecycle"`
+}
+
+type LifecycleConfig struct {
+	// How often the lifecycle rules run and storage is reconciled with
+	// the catalog; 0 turns both off
+	Interval time.Duration `mapstructure:"interval"`
+	// Originals no item uses are deleted this long after they were stored,
+	// and those of deleted items this long after the deletion, leaving
+	// time for transcoding to finish with them
+	OrphanGrace time.Duration `mapstructure:"orphan_grace"`
+}
+
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint"`
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+	Bucket    string `mapstructure:"bucket"`
+	Region    string `mapstructure:"region"`
+	UseSSL    bool   `mapstructure:"use_ssl"`
+	// Host presigned URLs point at, if clients cannot reach Endpoint
+	PublicEndpoint string `mapstructure:"public_endpoint"`
+}
+
+type UploadsConfig struct {
+	// Partial uploads are assembled here before moving to storage. PATCH
+	// requests for one upload must reach the same instance, or this must be
+	// a shared volume.
+	StagingDir string `mapstructure:"staging_dir"`
+	MaxSize    int64  `mapstructure:"max_size"`
+	// How long an upload may sit idle before it is discarded
+	Expiry          time.Duration `mapstructure:"expiry"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
+
+type JobsConfig struct {
+	Workers      int           `mapstructure:"workers"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	// A job still processing after this long is assumed abandoned by a
+	// crashed worker and is picked up again
+	Lease time.Duration `mapstructure:"lease"`
+}
+
+type TranscodeConfig struct {
+	// "ffmpeg", or "fake" to emit placeholder output without encoding
+	Encoder        string `mapstructure:"encoder"`
+	FFmpegPath     string `mapstructure:"ffmpeg_path"`
+	FFprobePath    string `mapstructure:"ffprobe_path"`
+	SegmentSeconds int    `mapstructure:"segment_seconds"`
+	// Scratch space for sources and encoder output; the OS temp dir if empty
+	WorkDir string `mapstructure:"work_dir"`
+	// Largest recording accepted as a dubbed audio track
+	MaxAudioTrackSize int64 `mapstructure:"max_audio_track_size"`
+}
+
+type StreamingConfig struct {
+	// HMAC key for signed stream URLs; STREAM_SIGNING_KEY overrides it
+	SigningKey string        `mapstructure:"signing_key"`
+	URLTTL     time.Duration `mapstructure:"url_ttl"`
+	// Prefix for signed URLs, e.g. a CDN origin; relative URLs if empty
+	BaseURL string `mapstructure:"base_url"`
+}
+
+type OfflineConfig struct {
+	// Base64 Ed25519 seed signing offline licenses; OFFLINE_LICENSE_KEY
+	// overrides it. The app verifies licenses with the matching public key.
+	LicenseKey string        `mapstructure:"license_key"`
+	LicenseTTL time.Duration `mapstructure:"license_ttl"`
+	MaxItems   int           `mapstructure:"max_items"`
+}
+
+type CaptionsConfig struct {
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	MaxCues     int   `mapstructure:"max_cues"`
+	// Player URL transcript search results link to; {media_id}, {seconds}
+	// and {language} are filled in
+	DeepLinkURL string `mapstructure:"deep_link_url"`
+}
+
+type SpeechConfig struct {
+	// "" to disable automatic captions, "command", or "fake" for a
+	// placeholder draft
+	Engine string `mapstructure:"engine"`
+	// Program and arguments for the command engine; see
+	// speech.CommandTranscriber for the placeholders
+	Command string   `mapstructure:"command"`
+	Args    []string `mapstructure:"args"`
+	// Draft captions in the item's language once it has been processed
+	AutoDraft bool `mapstructure:"auto_draft"`
+}
+
+type ImagesConfig struct {
+	// Poster candidates to extract, as fractions of the duration
+	PosterPositions []float64 `mapstructure:"poster_positions"`
+	// Seconds between scrubbing thumbnails; 0 disables sprites
+	SpriteInterval float64 `mapstructure:"sprite_interval"`
+	SpriteWidth    int     `mapstructure:"sprite_width"`
+	SpriteColumns  int     `mapstructure:"sprite_columns"`
+	SpriteRows     int     `mapstructure:"sprite_rows"`
+	// Points in the waveform JSON; 0 disables it
+	WaveformPeaks int `mapstructure:"waveform_peaks"`
+	// Limits on uploaded thumbnails
+	MaxUploadSize int64 `mapstructure:"max_upload_size"`
+	MaxPixels     int   `mapstructure:"max_pixels"`
+}
+
+type ProgressConfig struct {
+	// Share of an item, in percent, that must have been played for it to
+	// count as completed
+	CompletePercent float64 `mapstructure:"complete_percent"`
+	// Granularity of the watched map. Changing it misreads the maps
+	// already recorded.
+	BucketSeconds float64 `mapstructure:"bucket_seconds"`
+	// Longest heartbeat gap still credited as continuous playback
+	MaxGap time.Duration `mapstructure:"max_gap"`
+	// Resume from the start when stopped this close to the end
+	RestartWithin float64 `mapstructure:"restart_within"`
+	// How often heartbeats cached in Redis are written to Postgres
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// How long an idle item's progress stays cached in Redis
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+type LiveConfig struct {
+	// Sent by nginx-rtmp as ?secret= on its callbacks; LIVE_CALLBACK_SECRET
+	// overrides it. Callbacks are refused while it is empty.
+	CallbackSecret string `mapstructure:"callback_secret"`
+	// How long a handled callback is remembered so that a replay of it is
+	// refused; nginx-rtmp sends each once per connection
+	CallbackReplayWindow time.Duration `mapstructure:"callback_replay_window"`
+	// RTMP application URL hosts point their encoder at
+	IngestURL string `mapstructure:"ingest_url"`
+	// HLS playlist of a live stream; {name} is its playback name
+	PlaybackURL string `mapstructure:"playback_url"`
+	// nginx-rtmp's record_path as mounted in this service
+	RecordingsDir string `mapstructure:"recordings_dir"`
+	// A viewer counts as watching this long after their last ping
+	ViewerTTL time.Duration `mapstructure:"viewer_ttl"`
+	// How long before an occurrence starts attendees may join it
+	JoinEarly time.Duration `mapstructure:"join_early"`
+	// Longest gap between pings still counted as attended
+	AttendanceGap time.Duration `mapstructure:"attendance_gap"`
+}
+
+type CalendarConfig struct {
+	// Signs personal feed URLs; CALENDAR_FEED_KEY overrides it. Changing
+	// it invalidates every feed URL handed out. Feeds are disabled while
+	// it is empty.
+	FeedKey string `mapstructure:"feed_key"`
+	// Public URL of the /api/media/calendar routes, used in feed URLs
+	FeedURL string `mapstructure:"feed_url"`
+	// Page where users join a session; {id} is its ID
+	SessionURL string `mapstructure:"session_url"`
+	// Domain of event UIDs; must not change once invites went out
+	UIDDomain string `mapstructure:"uid_domain"`
+	// How far back one-off sessions stay in feeds
+	FeedPast time.Duration `mapstructure:"feed_past"`
+}
+
+type MailConfig struct {
+	// smtp, fake (keeps messages in memory) or empty to send nothing
+	Driver       string `mapstructure:"driver"`
+	SMTPHost     string `mapstructure:"smtp_host"`
+	SMTPPort     int    `mapstructure:"smtp_port"`
+	SMTPUser     string `mapstructure:"smtp_user"`
+	SMTPPassword string `mapstructure:"smtp_password"`
+	// Sender and iCalendar organizer of invitations
+	FromEmail string `mapstructure:"from_email"`
+	FromName  string `mapstructure:"from_name"`
+}
+
+type SearchConfig struct {
+	// postgres, or empty to turn search off
+	Driver string `mapstructure:"driver"`
+	// Postgres text search configuration, e.g. simple or english.
+	// Reindex after changing it.
+	TextConfig string `mapstructure:"text_config"`
+	// Relative weight of matches in each kind of field, from 0 to 1
+	TitleWeight       float64 `mapstructure:"title_weight"`
+	MetadataWeight    float64 `mapstructure:"metadata_weight"`
+	DescriptionWeight float64 `mapstructure:"description_weight"`
+	TranscriptWeight  float64 `mapstructure:"transcript_weight"`
+	// How alike, from 0 to 1, a known word must be to stand in for a
+	// misspelt one; 0 turns typo correction off
+	Similarity float64 `mapstructure:"similarity"`
+	// Most values listed per facet
+	FacetSize int `mapstructure:"facet_size"`
+}
+
+type AnalyticsConfig struct {
+	// How often playback events are rolled up into the report tables
+	RollupInterval time.Duration `mapstructure:"rollup_interval"`
+	// How far back reports go unless asked for dates
+	DefaultRange time.Duration `mapstructure:"default_range"`
+}
+
+type AttachmentsConfig struct {
+	MaxSize int64 `mapstructure:"max_size"`
+	// "clamav", "fake" (flags only the EICAR test file) or empty to offer
+	// attachments for download unscanned
+	Scanner      string        `mapstructure:"scanner"`
+	ClamdAddress string        `mapstructure:"clamd_address"`
+	ScanTimeout  time.Duration `mapstructure:"scan_timeout"`
+	// "command" for whichever of the tools below are installed, "fake"
+	// for blank pages, or empty to make no previews
+	Previewer     string `mapstructure:"previewer"`
+	PDFToPPMPath  string `mapstructure:"pdftoppm_path"`
+	PDFToTextPath string `mapstructure:"pdftotext_path"`
+	// LibreOffice, to preview slide decks and word processor files
+	SofficePath string `mapstructure:"soffice_path"`
+	// Thumbnails are made of at most this many pages
+	PreviewPages int `mapstructure:"preview_pages"`
+	PreviewWidth int `mapstructure:"preview_width"`
+	// Most bytes of text extracted from each attachment for search
+	MaxText int `mapstructure:"max_text"`
+}
+
+type ModerationConfig struct {
+	// Addresses told when a trainer submits media for review
+	ReviewerEmails []string `mapstructure:"reviewer_emails"`
+}
+
+type UsersConfig struct {
+	// auth (asks auth-service), fake (made-up addresses) or empty to mail
+	// no individual users
+	Driver string `mapstructure:"driver"`
+	// Root of the auth API, e.g. http://auth-service:8080/api/v1/auth
+	AuthURL string `mapstructure:"auth_url"`
+	// auth-service's internal.service_token
+	ServiceToken string `mapstructure:"service_token"`
+	// Consumer group media-service reads auth-service's user events with
+	EventsGroup string `mapstructure:"events_group"`
+}
+
+func LoadConfig() error {
+	viper.SetConfigName("config")
+	viper.SetConfigType("yaml")
+	viper.AddConfigPath(".")
+	viper.AddConfigPath("./config")
+	viper.AddConfigPath("./pkg/config")
+	viper.AddConfigPath("/etc/church-training-platform/media")
+
+	viper.AutomaticEnv()
+
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	Config = &Configuration{}
+	if err := viper.Unmarshal(Config); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	// Same variable auth-service signs with
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		Config.JWT.Secret = secret
+	}
+	if key := os.Getenv("STREAM_SIGNING_KEY"); key != "" {
+		Config.Streaming.SigningKey = key
+	}
+	if key := os.Getenv("OFFLINE_LICENSE_KEY"); key != "" {
+		Config.Offline.LicenseKey = key
+	}
+	if secret := os.Getenv("LIVE_CALLBACK_SECRET"); secret != "" {
+		Config.Live.CallbackSecret = secret
+	}
+	if key := os.Getenv("CALENDAR_FEED_KEY"); key != "" {
+		Config.Calendar.FeedKey = key
+	}
+	if password := os.Getenv("SMTP_PASSWORD"); password != "" {
+		Config.Mail.SMTPPassword = password
+	}
+	// Same variable auth-service checks it against
+	if token := os.Getenv("INTERNAL_SERVICE_TOKEN"); token != "" {
+		Config.Users.ServiceToken = token
+	}
+
+	setupLogger()
+	return nil
+}
+
+func setupLogger() {
+	Log = logrus.New()
+
+	if Config.Server.Environment == "production" {
+		Log.SetFormatter(&logrus.JSONFormatter{})
+		Log.SetLevel(logrus.InfoLevel)
+	} else {
+		Log.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp: true,
+		})
+		Log.SetLevel(logrus.DebugLevel)
+	}
+
+	if Config.Log.Format == "json" {
+		Log.SetFormatter(&logrus.JSONFormatter{})
+	}
+	if Config.Log.Level != "" {
+		if level, err := logrus.ParseLevel(Config.Log.Level); err == nil {
+			Log.SetLevel(level)
+		}
+	}
+
+	// Scrub credentials before any formatter sees the entry
+	Log.AddHook(&redactHook{})
+}
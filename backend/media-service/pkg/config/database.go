@@ -0,0 +1,72 @@
+// media-service/pkg/config/database.go
+package config
+
+import (
+	"fmt"
+
+	"shepherdsfold/media-service/pkg/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func SetupDatabase() (*gorm.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		Config.Database.Host,
+		Config.Database.Port,
+		Config.Database.User,
+		Config.Database.Password,
+		Config.Database.DBName,
+		Config.Database.SSLMode,
+	)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Auto Migrate
+	if err := autoMigrate(db); err != nil {
+		return nil, fmt.Errorf("failed to auto migrate: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database instance: %w", err)
+	}
+
+	// Set connection pool settings
+	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxOpenConns(100)
+
+	DB = db
+	return db, nil
+}
+
+func autoMigrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.MediaItem{},
+		&models.Upload{},
+		&models.ProcessingJob{},
+		&models.OfflineLicense{},
+		&models.CaptionTrack{},
+		&models.CaptionCue{},
+		&models.PlaybackProgress{},
+		&models.LiveSession{},
+		&models.SessionInvitee{},
+		&models.SessionAttendance{},
+		&models.Collection{},
+		&models.CollectionItem{},
+		&models.ScriptureRange{},
+		&models.StorageMismatch{},
+		&models.MediaAccess{},
+		&models.Enrollment{},
+		&models.CohortMember{},
+		&models.MediaDailyViewer{},
+		&models.MediaCoverage{},
+		&models.Attachment{},
+		&models.AudioTrack{},
+		&models.MediaVersion{},
+		&models.ReviewComment{},
+	)
+}
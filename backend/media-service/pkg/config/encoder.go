@@ -0,0 +1,28 @@
+// media-service/pkg/config/encoder.go
+package config
+
+import (
+	"fmt"
+	"shepherdsfold/media-service/pkg/transcode"
+)
+
+var Encoder transcode.Encoder
+
+func SetupEncoder() (transcode.Encoder, error) {
+	var enc transcode.Encoder
+	switch Config.Transcode.Encoder {
+	case "", "ffmpeg":
+		ffmpeg, err := transcode.NewFFmpegEncoder(Config.Transcode.FFmpegPath, Config.Transcode.FFprobePath, Config.Transcode.SegmentSeconds)
+		if err != nil {
+			return nil, fmt.Errorf("ffmpeg not available: %w", err)
+		}
+		enc = ffmpeg
+	case "fake":
+		enc = &transcode.FakeEncoder{}
+	default:
+		return nil, fmt.Errorf("unknown encoder %q", Config.Transcode.Encoder)
+	}
+
+	Encoder = enc
+	return enc, nil
+}
@@ -0,0 +1,37 @@
+// media-service/pkg/config/keys.go
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SetupStreamSigningKey checks the key stream URLs are signed with.
+// Production refuses to start without one of its own; elsewhere a missing
+// or sample key only draws a warning.
+func SetupStreamSigningKey() error {
+	return checkKey("streaming.signing_key", Config.Streaming.SigningKey)
+}
+
+// SetupCalendarFeedKey checks the key personal calendar feed URLs are
+// signed with, as SetupStreamSigningKey does. Outside production an empty
+// key just disables the feeds.
+func SetupCalendarFeedKey() error {
+	if Config.Calendar.FeedKey == "" && Config.Server.Environment != "production" {
+		return nil
+	}
+	return checkKey("calendar.feed_key", Config.Calendar.FeedKey)
+}
+
+// checkKey rejects, in production, a key that is unset or still the
+// "change-me" placeholder config.yaml ships with.
+func checkKey(name, value string) error {
+	if value != "" && !strings.HasPrefix(value, "change-me") {
+		return nil
+	}
+	if Config.Server.Environment == "production" {
+		return fmt.Errorf("%s must be set to a key of your own in production", name)
+	}
+	Log.Warnf("%s is unset or the sample key from config.yaml; anyone can forge what it signs", name)
+	return nil
+}
@@ -0,0 +1,37 @@
+// media-service/pkg/config/license.go
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+)
+
+var LicenseKey ed25519.PrivateKey
+
+// SetupLicenseKey loads the offline license signing key. Outside production
+// a missing key is replaced by a random one, which invalidates issued
+// licenses on restart.
+func SetupLicenseKey() (ed25519.PrivateKey, error) {
+	encoded := Config.Offline.LicenseKey
+	if encoded == "" {
+		if Config.Server.Environment == "production" {
+			return nil, fmt.Errorf("offline.license_key is required in production")
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		Log.Warn("offline.license_key not set; using a temporary key")
+		LicenseKey = key
+		return key, nil
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("offline.license_key must be %d base64-encoded bytes", ed25519.SeedSize)
+	}
+	LicenseKey = ed25519.NewKeyFromSeed(seed)
+	return LicenseKey, nil
+}
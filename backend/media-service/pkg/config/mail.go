@@ -0,0 +1,37 @@
+// media-service/pkg/config/mail.go
+package config
+
+import (
+	"fmt"
+	"shepherdsfold/media-service/pkg/mail"
+)
+
+// Mailer sends notification emails; nil when mail is disabled.
+var Mailer mail.Mailer
+
+func SetupMailer() (mail.Mailer, error) {
+	var m mail.Mailer
+	switch Config.Mail.Driver {
+	case "":
+		return nil, nil
+	case "smtp":
+		if Config.Mail.SMTPHost == "" || Config.Mail.FromEmail == "" {
+			return nil, fmt.Errorf("mail.smtp_host and mail.from_email are required")
+		}
+		m = &mail.SMTPMailer{
+			Host:     Config.Mail.SMTPHost,
+			Port:     Config.Mail.SMTPPort,
+			Username: Config.Mail.SMTPUser,
+			Password: Config.Mail.SMTPPassword,
+			From:     Config.Mail.FromEmail,
+			FromName: Config.Mail.FromName,
+		}
+	case "fake":
+		m = &mail.FakeMailer{}
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", Config.Mail.Driver)
+	}
+
+	Mailer = m
+	return m, nil
+}
@@ -0,0 +1,190 @@
+// media-service/pkg/config/redact.go
+package config
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeys are matched against normalized field names (lowercase,
+// without "_" or "-"), so "StreamKey", "stream_key" and "stream-key" all
+// hit. Storage keys ("key") are object names, not credentials, and stay.
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"cookie":        true,
+	"setcookie":     true,
+	"streamkey":     true,
+	"signingkey":    true,
+	"licensekey":    true,
+	"feedkey":       true,
+	"accesskey":     true,
+}
+
+var sensitiveFragments = []string{"password", "token", "secret"}
+
+// IsSensitiveKey reports whether a log field or struct field name holds a
+// credential that must never reach the logs.
+func IsSensitiveKey(key string) bool {
+	k := strings.ToLower(key)
+	k = strings.NewReplacer("_", "", "-", "").Replace(k)
+	if sensitiveKeys[k] {
+		return true
+	}
+	for _, fragment := range sensitiveFragments {
+		if strings.Contains(k, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns a copy of v with sensitive map keys and struct fields
+// replaced. Structs are flattened into maps keyed by their JSON names.
+func Redact(v interface{}) interface{} {
+	return redactValue(reflect.ValueOf(v), 0)
+}
+
+type redactHook struct{}
+
+func (h *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactHook) Fire(entry *logrus.Entry) error {
+	for key, value := range entry.Data {
+		if IsSensitiveKey(key) {
+			entry.Data[key] = redactedValue
+			continue
+		}
+		if _, isErr := value.(error); isErr {
+			continue
+		}
+		entry.Data[key] = Redact(value)
+	}
+	return nil
+}
+
+func redactValue(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	// Guard against cyclic structures
+	if depth > 8 {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redactValue(v.Elem(), depth+1)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if IsSensitiveKey(key) {
+				out[key] = redactedValue
+				continue
+			}
+			out[key] = redactValue(iter.Value(), depth+1)
+		}
+		return out
+	case reflect.Struct:
+		if !hasSensitiveField(v.Type(), map[reflect.Type]bool{}) {
+			return v.Interface()
+		}
+		out := make(map[string]interface{}, v.NumField())
+		redactStruct(v, out, depth)
+		return out
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct && elem.Kind() != reflect.Map && elem.Kind() != reflect.Interface {
+			return v.Interface()
+		}
+		out := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out[i] = redactValue(v.Index(i), depth+1)
+		}
+		return out
+	default:
+		return v.Interface()
+	}
+}
+
+// redactStruct copies the exported fields of v into out, promoting the fields
+// of embedded structs such as gorm.Model the way encoding/json does.
+func redactStruct(v reflect.Value, out map[string]interface{}, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			redactStruct(v.Field(i), out, depth+1)
+			continue
+		}
+		if IsSensitiveKey(field.Name) || IsSensitiveKey(name) {
+			out[name] = redactedValue
+			continue
+		}
+		out[name] = redactValue(v.Field(i), depth+1)
+	}
+}
+
+// hasSensitiveField lets plain value types such as time.Time pass through
+// untouched so they keep their own JSON encoding.
+func hasSensitiveField(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if IsSensitiveKey(field.Name) || IsSensitiveKey(jsonFieldName(field)) {
+			return true
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && hasSensitiveField(ft, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if tag == "" {
+		return field.Name
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
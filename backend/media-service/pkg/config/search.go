@@ -0,0 +1,38 @@
+// media-service/pkg/config/search.go
+package config
+
+import (
+	"fmt"
+	"shepherdsfold/media-service/pkg/search"
+)
+
+// Search is the catalog's search index; nil when search is disabled.
+var Search search.Index
+
+// SetupSearch must run after SetupDatabase.
+func SetupSearch() (search.Index, error) {
+	var index search.Index
+	switch Config.Search.Driver {
+	case "":
+		return nil, nil
+	case "postgres":
+		pg, err := search.NewPostgres(DB, search.PostgresOptions{
+			TextConfig:        Config.Search.TextConfig,
+			TitleWeight:       Config.Search.TitleWeight,
+			MetadataWeight:    Config.Search.MetadataWeight,
+			DescriptionWeight: Config.Search.DescriptionWeight,
+			TranscriptWeight:  Config.Search.TranscriptWeight,
+			Similarity:        Config.Search.Similarity,
+			FacetSize:         Config.Search.FacetSize,
+		})
+		if err != nil {
+			return nil, err
+		}
+		index = pg
+	default:
+		return nil, fmt.Errorf("unknown search driver %q", Config.Search.Driver)
+	}
+
+	Search = index
+	return index, nil
+}
@@ -0,0 +1,31 @@
+// media-service/pkg/config/speech.go
+package config
+
+import (
+	"fmt"
+	"shepherdsfold/media-service/pkg/speech"
+)
+
+// Transcriber drafts captions; nil when speech-to-text is disabled.
+var Transcriber speech.Transcriber
+
+func SetupTranscriber() (speech.Transcriber, error) {
+	var t speech.Transcriber
+	switch Config.Speech.Engine {
+	case "":
+		return nil, nil
+	case "command":
+		cmd, err := speech.NewCommandTranscriber(Config.Speech.Command, Config.Speech.Args)
+		if err != nil {
+			return nil, fmt.Errorf("speech-to-text command not available: %w", err)
+		}
+		t = cmd
+	case "fake":
+		t = &speech.FakeTranscriber{}
+	default:
+		return nil, fmt.Errorf("unknown speech-to-text engine %q", Config.Speech.Engine)
+	}
+
+	Transcriber = t
+	return t, nil
+}
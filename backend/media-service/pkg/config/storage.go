@@ -0,0 +1,40 @@
+// media-service/pkg/config/storage.go
+package config
+
+import (
+	"context"
+	"fmt"
+	"shepherdsfold/media-service/pkg/storage"
+)
+
+var Storage storage.BlobStore
+
+func SetupStorage() (storage.BlobStore, error) {
+	var (
+		store storage.BlobStore
+		err   error
+	)
+	switch Config.Storage.Driver {
+	case "", "local":
+		store, err = storage.NewLocalStore(Config.Storage.LocalDir)
+	case "s3":
+		s3 := Config.Storage.S3
+		store, err = storage.NewS3Store(context.Background(), storage.S3Config{
+			Endpoint:       s3.Endpoint,
+			AccessKey:      s3.AccessKey,
+			SecretKey:      s3.SecretKey,
+			Bucket:         s3.Bucket,
+			Region:         s3.Region,
+			UseSSL:         s3.UseSSL,
+			PublicEndpoint: s3.PublicEndpoint,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", Config.Storage.Driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up %s storage: %w", Config.Storage.Driver, err)
+	}
+
+	Storage = store
+	return store, nil
+}
@@ -0,0 +1,32 @@
+// media-service/pkg/config/users.go
+package config
+
+import (
+	"fmt"
+	"shepherdsfold/media-service/pkg/users"
+)
+
+// Users resolves user IDs to contact details; nil when no directory is
+// configured, in which case nothing is mailed to individual users.
+var Users users.Directory
+
+func SetupUsers() (users.Directory, error) {
+	var d users.Directory
+	switch Config.Users.Driver {
+	case "":
+		return nil, nil
+	case "auth":
+		dir, err := users.NewAuthDirectory(Config.Users.AuthURL, Config.Users.ServiceToken)
+		if err != nil {
+			return nil, err
+		}
+		d = dir
+	case "fake":
+		d = &users.FakeDirectory{}
+	default:
+		return nil, fmt.Errorf("unknown user directory %q", Config.Users.Driver)
+	}
+
+	Users = d
+	return d, nil
+}
@@ -0,0 +1,172 @@
+// media-service/pkg/documents/command.go
+package documents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CommandPreviewer runs the tools installed on the machine: poppler's
+// pdftoppm for thumbnails and pdftotext for text, and LibreOffice to
+// turn slide decks and word processor files into PDF first. Any of them
+// may be missing, in which case documents get what the others can make.
+type CommandPreviewer struct {
+	PDFToPPM  string
+	PDFToText string
+	Office    string
+}
+
+// NewCommandPreviewer resolves the tools, leaving out those not found. It
+// fails if none is.
+func NewCommandPreviewer(pdftoppm, pdftotext, office string) (*CommandPreviewer, error) {
+	p := &CommandPreviewer{
+		PDFToPPM:  lookPath(pdftoppm),
+		PDFToText: lookPath(pdftotext),
+		Office:    lookPath(office),
+	}
+	if p.PDFToPPM == "" && p.PDFToText == "" {
+		return nil, errors.New("neither pdftoppm nor pdftotext found")
+	}
+	return p, nil
+}
+
+func (p *CommandPreviewer) Preview(ctx context.Context, input, contentType, dir string, opts Options) (*Preview, error) {
+	if IsText(contentType) {
+		text, err := readText(input, opts.MaxText)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Text: text}, nil
+	}
+
+	pdf := input
+	if !IsPDF(contentType) {
+		if p.Office == "" {
+			return nil, ErrUnsupported
+		}
+		var err error
+		if pdf, err = p.convert(ctx, input, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	preview := &Preview{}
+	if p.PDFToText != "" && opts.MaxText > 0 {
+		text := &textBuffer{max: opts.MaxText}
+		if err := run(ctx, dir, text, p.PDFToText, "-enc", "UTF-8", pdf, "-"); err != nil {
+			return nil, err
+		}
+		// pdftotext ends every page with a form feed
+		preview.PageCount = text.pages
+		preview.Text = strings.ReplaceAll(cleanText(text.buf.Bytes()), "\f", "\n")
+	}
+	if p.PDFToPPM != "" && opts.MaxPages > 0 {
+		pages, err := p.render(ctx, pdf, dir, opts)
+		if err != nil {
+			return nil, err
+		}
+		preview.Pages = pages
+		if preview.PageCount == 0 && len(pages) < opts.MaxPages {
+			preview.PageCount = len(pages)
+		}
+	}
+	return preview, nil
+}
+
+// convert turns an office document into a PDF in dir.
+func (p *CommandPreviewer) convert(ctx context.Context, input, dir string) (string, error) {
+	out := filepath.Join(dir, "pdf")
+	// A profile of its own, so conversions can run side by side
+	profile := "-env:UserInstallation=file://" + filepath.ToSlash(filepath.Join(dir, "profile"))
+	if err := run(ctx, dir, nil, p.Office, profile, "--headless", "--norestore",
+		"--convert-to", "pdf", "--outdir", out, input); err != nil {
+		return "", err
+	}
+	matches, _ := filepath.Glob(filepath.Join(out, "*.pdf"))
+	if len(matches) == 0 {
+		return "", errors.New("LibreOffice wrote no PDF")
+	}
+	return matches[0], nil
+}
+
+// render writes thumbnails of the first pages as page-N.jpg.
+func (p *CommandPreviewer) render(ctx context.Context, pdf, dir string, opts Options) ([]string, error) {
+	out := filepath.Join(dir, "pages")
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return nil, err
+	}
+	if err := run(ctx, dir, nil, p.PDFToPPM, "-jpeg", "-jpegopt", "quality=80",
+		"-f", "1", "-l", strconv.Itoa(opts.MaxPages),
+		"-scale-to-x", strconv.Itoa(opts.Width), "-scale-to-y", "-1",
+		pdf, filepath.Join(out, "page")); err != nil {
+		return nil, err
+	}
+
+	// Page numbers are zero-padded to the width of the last page's
+	matches, _ := filepath.Glob(filepath.Join(out, "page-*.jpg"))
+	number := func(name string) int {
+		n, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), "page-"), ".jpg"))
+		return n
+	}
+	sort.Slice(matches, func(i, j int) bool { return number(matches[i]) < number(matches[j]) })
+	return matches, nil
+}
+
+// textBuffer keeps the first max bytes written to it and counts the form
+// feeds in all of them.
+type textBuffer struct {
+	buf   bytes.Buffer
+	max   int
+	pages int
+}
+
+func (t *textBuffer) Write(p []byte) (int, error) {
+	t.pages += bytes.Count(p, []byte{'\f'})
+	if room := t.max - t.buf.Len(); room > 0 {
+		t.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+func run(ctx context.Context, dir string, stdout *textBuffer, path string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = dir
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	cmd.Stderr = &stderr
+	// LibreOffice needs somewhere to write its settings
+	cmd.Env = append(os.Environ(), "HOME="+dir)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w: %s", filepath.Base(path), err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+func lookPath(name string) string {
+	if name == "" {
+		return ""
+	}
+	resolved, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return resolved
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,112 @@
+// media-service/pkg/documents/documents.go
+//
+// Package documents renders page thumbnails of attached handouts, slide
+// decks and other documents and extracts their text for search.
+package documents
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Types are the formats documents may be attached in, by content type,
+// with the extension files of each usually have.
+var Types = map[string]string{
+	"application/pdf": ".pdf",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/vnd.ms-powerpoint":                                             ".ppt",
+	"application/vnd.oasis.opendocument.presentation":                           ".odp",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document":   ".docx",
+	"application/msword":                      ".doc",
+	"application/vnd.oasis.opendocument.text": ".odt",
+	"application/rtf":                         ".rtf",
+	"text/plain":                              ".txt",
+	"text/markdown":                           ".md",
+}
+
+// TypeByName returns the content type of a file name's extension, if it
+// is one of Types.
+func TypeByName(name string) (string, bool) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return "", false
+	}
+	for contentType, e := range Types {
+		if e == ext {
+			return contentType, true
+		}
+	}
+	return "", false
+}
+
+// IsPDF reports whether contentType is a PDF.
+func IsPDF(contentType string) bool {
+	return contentType == "application/pdf"
+}
+
+// IsText reports whether contentType is plain text, which needs no tools
+// to extract.
+func IsText(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/")
+}
+
+// Options tune what a Previewer makes.
+type Options struct {
+	// Most pages to render thumbnails of
+	MaxPages int
+	// Thumbnail width in pixels
+	Width int
+	// Most bytes of text to extract; 0 extracts none
+	MaxText int
+}
+
+// Preview is what a Previewer made of a document.
+type Preview struct {
+	// 0 if unknown
+	PageCount int
+	// Paths of JPEG thumbnails of the first pages, in order
+	Pages []string
+	Text  string
+}
+
+// ErrUnsupported is returned for documents no available tool can read.
+var ErrUnsupported = errors.New("documents: no previewer for this format")
+
+// Previewer renders a document. Thumbnails are written into dir, which
+// the caller removes afterwards.
+type Previewer interface {
+	Preview(ctx context.Context, input, contentType, dir string, opts Options) (*Preview, error)
+}
+
+// readText reads up to max bytes of a plain text document.
+func readText(input string, max int) (string, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, int64(max)))
+	if err != nil {
+		return "", err
+	}
+	return cleanText(data), nil
+}
+
+// cleanText makes extracted text safe to store: valid UTF-8 without the
+// NUL bytes Postgres refuses, and without a rune cut in half at the end.
+func cleanText(data []byte) string {
+	for len(data) > 0 {
+		r, size := utf8.DecodeLastRune(data)
+		if r != utf8.RuneError || size != 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+	text := strings.ToValidUTF8(string(data), "")
+	return strings.TrimSpace(strings.ReplaceAll(text, "\x00", ""))
+}
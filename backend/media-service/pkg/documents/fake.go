@@ -0,0 +1,66 @@
+// media-service/pkg/documents/fake.go
+package documents
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+)
+
+// FakePreviewer draws blank pages and reads only plain text, without
+// running anything, for tests and development machines without poppler.
+type FakePreviewer struct {
+	// Pages each non-text document has; defaults to 3
+	PageCount int
+	// Returned as the text of non-text documents
+	Text string
+	// If set, Preview fails with this error
+	Err error
+}
+
+func (f *FakePreviewer) Preview(ctx context.Context, input, contentType, dir string, opts Options) (*Preview, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if _, err := os.Stat(input); err != nil {
+		return nil, err
+	}
+	if IsText(contentType) {
+		text, err := readText(input, opts.MaxText)
+		if err != nil {
+			return nil, err
+		}
+		return &Preview{Text: text}, nil
+	}
+
+	count := f.PageCount
+	if count <= 0 {
+		count = 3
+	}
+	preview := &Preview{PageCount: count, Text: f.Text}
+	width := max(opts.Width, 1)
+	// A4 portrait
+	page := image.NewGray(image.Rect(0, 0, width, width*297/210))
+	draw.Draw(page, page.Bounds(), &image.Uniform{C: color.Gray{Y: 0xf0}}, image.Point{}, draw.Src)
+	for n := 1; n <= min(count, opts.MaxPages); n++ {
+		name := filepath.Join(dir, fmt.Sprintf("page-%d.jpg", n))
+		out, err := os.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := jpeg.Encode(out, page, nil); err != nil {
+			out.Close()
+			return nil, err
+		}
+		if err := out.Close(); err != nil {
+			return nil, err
+		}
+		preview.Pages = append(preview.Pages, name)
+	}
+	return preview, nil
+}
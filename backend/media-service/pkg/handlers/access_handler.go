@@ -0,0 +1,342 @@
+// media-service/pkg/handlers/access_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get access rule
+// @ID getMediaAccess
+// @Description Get who may see an item and when it unlocks for them. An item without a rule is open to everyone who can see it. Only its owner or an admin may do this.
+// @Tags access
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaAccessRule
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/access [get]
+func GetMediaAccess(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	rule, err := services.GetMediaAccess(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if rule == nil {
+		c.JSON(http.StatusOK, api.MediaAccessRule{MediaID: id, Roles: []string{}, Cohorts: []string{}})
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIMediaAccess(rule))
+}
+
+// @Summary Set access rule
+// @ID setMediaAccess
+// @Description Limit an item to callers with one of some roles or cohorts, to those enrolled in a course, or to a time window, and lock it until a date, a number of days after enrolling, or the earlier items of the course are completed. Replaces any existing rule. Only its owner or an admin may do this.
+// @Tags access
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.MediaAccessRequest true "Access rule"
+// @Success 200 {object} api.MediaAccessRule
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/access [put]
+func SetMediaAccess(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.MediaAccessRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	rule, err := services.SetMediaAccess(viewer(c), id, req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIMediaAccess(rule))
+}
+
+// @Summary Remove access rule
+// @ID deleteMediaAccess
+// @Description Open an item to everyone who can see it. Only its owner or an admin may do this.
+// @Tags access
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/access [delete]
+func DeleteMediaAccess(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteMediaAccess(viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List enrollments
+// @ID listEnrollments
+// @Description List the users enrolled in a course, most recent first. Only the collection's owner or an admin may do this.
+// @Tags access
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Enrollments per page"
+// @Success 200 {object} api.EnrollmentList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/enrollments [get]
+func ListEnrollments(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	enrollments, total, err := services.ListEnrollments(viewer(c), id, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.EnrollmentList{
+		Items:    make([]api.Enrollment, 0, len(enrollments)),
+		Page:     page.Page,
+		PageSize: page.PageSize,
+		Total:    total,
+	}
+	for i := range enrollments {
+		list.Items = append(list.Items, services.ToAPIEnrollment(&enrollments[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Enroll users
+// @ID enrollUsers
+// @Description Enroll users in a collection that items' access rules use as a course. Users already enrolled get the new expiry. Only the collection's owner or an admin may do this.
+// @Tags access
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param data body api.EnrollmentRequest true "Users to enroll"
+// @Success 200 {array} api.Enrollment
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/enrollments [post]
+func EnrollUsers(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.EnrollmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	enrollments, err := services.EnrollUsers(viewer(c), id, req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	out := make([]api.Enrollment, 0, len(enrollments))
+	for i := range enrollments {
+		out = append(out, services.ToAPIEnrollment(&enrollments[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// @Summary Unenroll user
+// @ID unenrollUser
+// @Description Remove a user from a course. Their offline licenses for the items the course gates are revoked. Only the collection's owner or an admin may do this.
+// @Tags access
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param userID path int true "User ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/enrollments/{userID} [delete]
+func UnenrollUser(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 0)
+	if err != nil || userID == 0 {
+		apperror.Respond(c, apperror.ErrNotFound.WithDetail("User is not enrolled in this course"))
+		return
+	}
+
+	if err := services.Unenroll(viewer(c), id, uint(userID)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List cohorts
+// @ID listCohorts
+// @Description List the cohorts that have members, with how many each has. Admin only.
+// @Tags access
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} api.Cohort
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /cohorts [get]
+func ListCohorts(c *gin.Context) {
+	cohorts, err := services.ListCohorts(viewer(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, cohorts)
+}
+
+// @Summary List cohort members
+// @ID listCohortMembers
+// @Description List the users in a cohort, most recently added first. Admin only.
+// @Tags access
+// @Produce json
+// @Security Bearer
+// @Param cohort path string true "Cohort"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Members per page"
+// @Success 200 {object} api.CohortMemberList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /cohorts/{cohort}/members [get]
+func ListCohortMembers(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	members, total, err := services.ListCohortMembers(viewer(c), c.Param("cohort"), page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.CohortMemberList{
+		Items:    make([]api.CohortMember, 0, len(members)),
+		Page:     page.Page,
+		PageSize: page.PageSize,
+		Total:    total,
+	}
+	for i := range members {
+		list.Items = append(list.Items, services.ToAPICohortMember(&members[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Add cohort members
+// @ID addCohortMembers
+// @Description Put users in a cohort, which items' access rules can name. Users already in it are unchanged. Admin only.
+// @Tags access
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param cohort path string true "Cohort"
+// @Param data body api.CohortMembersRequest true "Users to add"
+// @Success 200 {array} api.CohortMember
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /cohorts/{cohort}/members [post]
+func AddCohortMembers(c *gin.Context) {
+	var req api.CohortMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	members, err := services.AddCohortMembers(viewer(c), c.Param("cohort"), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	out := make([]api.CohortMember, 0, len(members))
+	for i := range members {
+		out = append(out, services.ToAPICohortMember(&members[i]))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// @Summary Remove cohort member
+// @ID removeCohortMember
+// @Description Take a user out of a cohort. Items whose access rules name it are hidden from them at once, and their offline licenses for those items are revoked. Admin only.
+// @Tags access
+// @Security Bearer
+// @Param cohort path string true "Cohort"
+// @Param userID path int true "User ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /cohorts/{cohort}/members/{userID} [delete]
+func RemoveCohortMember(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 0)
+	if err != nil || userID == 0 {
+		apperror.Respond(c, apperror.ErrNotFound.WithDetail("User is not in this cohort"))
+		return
+	}
+
+	if err := services.RemoveCohortMember(viewer(c), c.Param("cohort"), uint(userID)); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
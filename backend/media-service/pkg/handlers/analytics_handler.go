@@ -0,0 +1,203 @@
+// media-service/pkg/handlers/analytics_handler.go
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get media analytics
+// @ID getMediaAnalytics
+// @Description How an item was watched between two dates: unique viewers, plays, watch time and average share watched, per day and per cohort, and a per-second retention curve. As CSV, one table at a time. Only its owner or an admin may do this.
+// @Tags analytics
+// @Produce json
+// @Produce text/csv
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param from query string false "First day, YYYY-MM-DD (UTC); defaults to analytics.default_range ago"
+// @Param to query string false "Last day, YYYY-MM-DD (UTC); defaults to today"
+// @Param cohort query string false "Only viewers in this cohort"
+// @Param by query string false "cohort to break each day down by cohort"
+// @Param format query string false "json (default) or csv"
+// @Param table query string false "Table to export as CSV: days (default), cohorts or retention"
+// @Success 200 {object} api.MediaAnalytics
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/analytics [get]
+func GetMediaAnalytics(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	table := c.DefaultQuery("table", api.AnalyticsDays)
+	switch table {
+	case api.AnalyticsDays, api.AnalyticsCohorts, api.AnalyticsRetention:
+	default:
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "table", Code: "oneof", Message: "must be one of: days, cohorts, retention",
+		}))
+		return
+	}
+	csv, err := wantsCSV(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	report, err := services.MediaAnalytics(viewer(c), id, filter)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if !csv {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteAnalyticsCSV(&buf, report, table); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	respondCSV(c, fmt.Sprintf("media-%d-%s-%s-%s.csv", id, table, report.From, report.To), buf.Bytes())
+}
+
+// @Summary Engagement report
+// @ID getEngagementReport
+// @Description How each item the caller owns, or every item for admins, was watched between two dates, most viewers first unless sorted otherwise. Sort by percent_watched to find the lectures students abandon. Items nobody watched are left out. Requires the trainer or admin role.
+// @Tags analytics
+// @Produce json
+// @Produce text/csv
+// @Security Bearer
+// @Param from query string false "First day, YYYY-MM-DD (UTC); defaults to analytics.default_range ago"
+// @Param to query string false "Last day, YYYY-MM-DD (UTC); defaults to today"
+// @Param cohort query string false "Only viewers in this cohort"
+// @Param sort query string false "unique_viewers, plays, watch_seconds, percent_watched or title, prefixed with - for descending"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Items per page"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} api.EngagementReport
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /analytics [get]
+func GetEngagementReport(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	csv, err := wantsCSV(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	items, total, err := services.EngagementReport(viewer(c), filter, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	from, to := filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly)
+	if !csv {
+		c.JSON(http.StatusOK, api.EngagementReport{
+			Items:    items,
+			From:     from,
+			To:       to,
+			Cohort:   filter.Cohort,
+			Page:     page.Page,
+			PageSize: page.PageSize,
+			Total:    total,
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteEngagementCSV(&buf, items); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	respondCSV(c, fmt.Sprintf("engagement-%s-%s.csv", from, to), buf.Bytes())
+}
+
+// analyticsFilter reads from, to, cohort and by, defaulting to the last
+// analytics.default_range.
+func analyticsFilter(c *gin.Context) (services.AnalyticsFilter, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	filter := services.AnalyticsFilter{
+		From:   today.Add(-config.Config.Analytics.DefaultRange).AddDate(0, 0, 1),
+		To:     today,
+		Cohort: c.Query("cohort"),
+	}
+	var fields []apperror.FieldError
+	for _, param := range []struct {
+		name string
+		day  *time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		day, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			fields = append(fields, apperror.FieldError{Field: param.name, Code: "datetime", Message: "must be a date as YYYY-MM-DD"})
+			continue
+		}
+		*param.day = day
+	}
+	switch c.Query("by") {
+	case "":
+	case "cohort":
+		filter.ByCohort = true
+	default:
+		fields = append(fields, apperror.FieldError{Field: "by", Code: "oneof", Message: "must be cohort"})
+	}
+	if len(fields) == 0 && filter.To.Before(filter.From) {
+		fields = append(fields, apperror.FieldError{Field: "to", Code: "gtefield", Message: "must not be before from"})
+	}
+	if len(fields) > 0 {
+		return filter, apperror.Validation(fields...)
+	}
+	return filter, nil
+}
+
+func wantsCSV(c *gin.Context) (bool, error) {
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		return false, nil
+	case "csv":
+		return true, nil
+	default:
+		return false, apperror.Validation(apperror.FieldError{
+			Field: "format", Code: "oneof", Message: "must be one of: json, csv",
+		})
+	}
+}
+
+func respondCSV(c *gin.Context, name string, data []byte) {
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
@@ -0,0 +1,330 @@
+// media-service/pkg/handlers/attachment_handler.go
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List item attachments
+// @ID listMediaAttachments
+// @Description List the documents attached to an item, oldest first. Editors also see attachments still being scanned and those that failed the scan.
+// @Tags attachments
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.AttachmentList
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/attachments [get]
+func ListMediaAttachments(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	respondAttachments(c, services.AttachmentOwner{MediaID: id})
+}
+
+// @Summary Attach document to item
+// @ID addMediaAttachment
+// @Description Attach a PDF, slide deck, word processor or plain text file sent as the request body. It can be downloaded once it passes the virus scan; page thumbnails and text for search follow where the server has the tools. Only the item's editors may do this.
+// @Tags attachments
+// @Accept application/pdf
+// @Accept application/vnd.openxmlformats-officedocument.presentationml.presentation
+// @Accept application/vnd.openxmlformats-officedocument.wordprocessingml.document
+// @Accept text/plain
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param filename query string true "File name, whose extension decides the format"
+// @Param title query string false "Title shown to learners; the file name if empty"
+// @Param data body string true "Document"
+// @Success 201 {object} api.Attachment
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Failure 415 {object} api.Problem
+// @Router /{id}/attachments [post]
+func AddMediaAttachment(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	addAttachment(c, services.AttachmentOwner{MediaID: id})
+}
+
+// @Summary List collection attachments
+// @ID listCollectionAttachments
+// @Description List the documents attached to a collection such as a course module, oldest first. Editors also see attachments still being scanned and those that failed the scan.
+// @Tags attachments
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Success 200 {object} api.AttachmentList
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/attachments [get]
+func ListCollectionAttachments(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	respondAttachments(c, services.AttachmentOwner{CollectionID: id})
+}
+
+// @Summary Attach document to collection
+// @ID addCollectionAttachment
+// @Description Attach a PDF, slide deck, word processor or plain text file sent as the request body to a collection. Only trainers editing the collection may do this.
+// @Tags attachments
+// @Accept application/pdf
+// @Accept application/vnd.openxmlformats-officedocument.presentationml.presentation
+// @Accept application/vnd.openxmlformats-officedocument.wordprocessingml.document
+// @Accept text/plain
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param filename query string true "File name, whose extension decides the format"
+// @Param title query string false "Title shown to learners; the file name if empty"
+// @Param data body string true "Document"
+// @Success 201 {object} api.Attachment
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Failure 415 {object} api.Problem
+// @Router /collections/{collectionID}/attachments [post]
+func AddCollectionAttachment(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	addAttachment(c, services.AttachmentOwner{CollectionID: id})
+}
+
+// @Summary Get attachment
+// @ID getAttachment
+// @Description Get an attachment's scan and preview status, page thumbnails and download URL
+// @Tags attachments
+// @Produce json
+// @Security Bearer
+// @Param attachmentID path int true "Attachment ID"
+// @Success 200 {object} api.Attachment
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /attachments/{attachmentID} [get]
+func GetAttachment(c *gin.Context) {
+	id, err := attachmentID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	attachment, err := services.GetAttachment(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIAttachment(attachment))
+}
+
+// @Summary Update attachment
+// @ID updateAttachment
+// @Description Rename an attachment. Only its editors may do this.
+// @Tags attachments
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param attachmentID path int true "Attachment ID"
+// @Param data body api.UpdateAttachmentRequest true "Fields to change"
+// @Success 200 {object} api.Attachment
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /attachments/{attachmentID} [patch]
+func UpdateAttachment(c *gin.Context) {
+	id, err := attachmentID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.UpdateAttachmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	attachment, err := services.UpdateAttachment(viewer(c), id, req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIAttachment(attachment))
+}
+
+// @Summary Delete attachment
+// @ID deleteAttachment
+// @Description Remove an attachment. Only its editors may do this.
+// @Tags attachments
+// @Security Bearer
+// @Param attachmentID path int true "Attachment ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /attachments/{attachmentID} [delete]
+func DeleteAttachment(c *gin.Context) {
+	id, err := attachmentID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteAttachment(viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Download attachment
+// @ID downloadAttachment
+// @Description Download an attachment that passed its virus scan, or be redirected to a presigned storage URL for it. Attachments of an item are locked along with the item. Supports Range.
+// @Tags attachments
+// @Produce octet-stream
+// @Security Bearer
+// @Param attachmentID path int true "Attachment ID"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 302
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /attachments/{attachmentID}/download [get]
+func DownloadAttachment(c *gin.Context) {
+	id, err := attachmentID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	url, file, err := services.AttachmentDownload(c.Request.Context(), viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	if url != "" {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	defer file.Object.Close()
+
+	c.Header("Content-Type", file.ContentType)
+	c.Header("ETag", file.ETag)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.DownloadName}))
+	http.ServeContent(c.Writer, c.Request, file.Name, file.ModTime, file.Object)
+}
+
+// @Summary Get attachment page
+// @ID getAttachmentPage
+// @Description Get the JPEG thumbnail of one of the first pages of an attachment, from 1
+// @Tags attachments
+// @Produce image/jpeg
+// @Security Bearer
+// @Param attachmentID path int true "Attachment ID"
+// @Param page path int true "Page number, from 1"
+// @Success 200 {file} file
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /attachments/{attachmentID}/pages/{page} [get]
+func GetAttachmentPage(c *gin.Context) {
+	id, err := attachmentID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	page, err := strconv.Atoi(c.Param("page"))
+	if err != nil {
+		apperror.Respond(c, apperror.ErrNotFound.WithDetail("Page preview not found"))
+		return
+	}
+
+	file, err := services.AttachmentPage(c.Request.Context(), viewer(c), id, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	defer file.Object.Close()
+
+	// Page keys are never rewritten, but access is checked per request
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.Header("Content-Type", file.ContentType)
+	c.Header("ETag", file.ETag)
+	http.ServeContent(c.Writer, c.Request, file.Name, file.ModTime, file.Object)
+}
+
+func respondAttachments(c *gin.Context, owner services.AttachmentOwner) {
+	attachments, err := services.ListAttachments(viewer(c), owner)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.AttachmentList{Attachments: make([]api.Attachment, 0, len(attachments))}
+	for i := range attachments {
+		list.Attachments = append(list.Attachments, services.ToAPIAttachment(&attachments[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func addAttachment(c *gin.Context, owner services.AttachmentOwner) {
+	maxSize := config.Config.Attachments.MaxSize
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	attachment, err := services.AddAttachment(c.Request.Context(), viewer(c), owner, services.AttachmentUpload{
+		Title:       c.Query("title"),
+		FileName:    c.Query("filename"),
+		ContentType: c.ContentType(),
+	}, body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Respond(c, apperror.ErrPayloadTooLarge.WithDetail(
+				fmt.Sprintf("Attachments may be at most %d bytes", maxSize)))
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, services.ToAPIAttachment(attachment))
+}
+
+func attachmentID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("attachmentID"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, apperror.ErrNotFound.WithDetail("Attachment not found")
+	}
+	return uint(id), nil
+}
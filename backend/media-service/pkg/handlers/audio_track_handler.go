@@ -0,0 +1,162 @@
+// media-service/pkg/handlers/audio_track_handler.go
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List audio tracks
+// @ID listAudioTracks
+// @Description List an item's dubbed and other-language audio tracks. Unpublished and not yet encoded tracks are only listed for editors.
+// @Tags audio tracks
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.AudioTrackList
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/audio-tracks [get]
+func ListAudioTracks(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list, err := services.ListAudioTracks(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Upload audio track
+// @ID uploadAudioTrack
+// @Description Create or replace the audio track for a language from a recording sent as the request body, such as a dub of the item. It is encoded in the background and then offered in the item's HLS stream; a replaced track keeps playing until then. Only the item's editors may do this.
+// @Tags audio tracks
+// @Accept audio/mpeg
+// @Accept audio/mp4
+// @Accept audio/wav
+// @Accept video/mp4
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param label query string false "Track name shown in players; the language's own name if empty"
+// @Param published query bool false "Offer to learners once encoded (default true)"
+// @Param data body string true "Recording"
+// @Success 202 {object} api.AudioTrack
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Failure 415 {object} api.Problem
+// @Router /{id}/audio-tracks/{lang} [put]
+func UploadAudioTrack(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	published := true
+	if raw := c.Query("published"); raw != "" {
+		if published, err = strconv.ParseBool(raw); err != nil {
+			apperror.Respond(c, apperror.Validation(apperror.FieldError{
+				Field: "published", Code: "boolean", Message: "must be true or false",
+			}))
+			return
+		}
+	}
+
+	maxSize := config.Config.Transcode.MaxAudioTrackSize
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	track, err := services.UploadAudioTrack(c.Request.Context(), viewer(c), id, c.Param("lang"), c.Query("label"), published, c.ContentType(), body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Respond(c, apperror.ErrPayloadTooLarge.WithDetail(
+				fmt.Sprintf("Audio tracks may be at most %d bytes", maxSize)))
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, track)
+}
+
+// @Summary Update audio track
+// @ID updateAudioTrack
+// @Description Rename a track, or publish or withdraw it
+// @Tags audio tracks
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param data body api.UpdateAudioTrackRequest true "Fields to change"
+// @Success 200 {object} api.AudioTrack
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/audio-tracks/{lang} [patch]
+func UpdateAudioTrack(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.UpdateAudioTrackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	track, err := services.UpdateAudioTrack(viewer(c), id, c.Param("lang"), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// @Summary Delete audio track
+// @ID deleteAudioTrack
+// @Description Delete an audio track and its recording
+// @Tags audio tracks
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/audio-tracks/{lang} [delete]
+func DeleteAudioTrack(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteAudioTrack(c.Request.Context(), viewer(c), id, c.Param("lang")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,68 @@
+// media-service/pkg/handlers/calendar_handler.go
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/calendar"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get calendar feed URL
+// @ID getCalendarFeed
+// @Description Get the caller's personal iCalendar feed of the live sessions they host or are invited to, for subscribing in a calendar app. Anyone with the URL can read the feed.
+// @Tags calendar
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} api.CalendarFeed
+// @Failure 401 {object} api.Problem
+// @Failure 501 {object} api.Problem
+// @Router /calendar/feed [get]
+func GetCalendarFeed(c *gin.Context) {
+	url, err := services.CalendarFeedURL(viewer(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CalendarFeed{URL: url})
+}
+
+// @Summary Fetch calendar feed
+// @ID fetchCalendarFeed
+// @Description Fetch a personal iCalendar feed. The URL authorizes itself, so calendar apps need no bearer token.
+// @Tags calendar
+// @Produce text/calendar
+// @Param userID path int true "User ID"
+// @Param token path string true "Feed token, optionally followed by .ics"
+// @Success 200 {string} string "iCalendar feed"
+// @Failure 404 {object} api.Problem
+// @Failure 501 {object} api.Problem
+// @Router /calendar/{userID}/{token} [get]
+func FetchCalendarFeed(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 0)
+	if err != nil {
+		apperror.Respond(c, apperror.ErrNotFound.WithDetail("Calendar feed not found"))
+		return
+	}
+
+	cal, err := services.CalendarFeed(uint(userID), strings.TrimSuffix(c.Param("token"), ".ics"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := calendar.Write(&buf, cal); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, calendar.ContentType, buf.Bytes())
+}
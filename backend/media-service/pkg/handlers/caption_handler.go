@@ -0,0 +1,443 @@
+// media-service/pkg/handlers/caption_handler.go
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/captions"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content types a caption upload may declare; the format itself is detected
+// from the file
+var captionUploadTypes = map[string]bool{
+	"text/vtt":                 true,
+	"application/x-subrip":     true,
+	"text/srt":                 true,
+	"text/plain":               true,
+	"application/octet-stream": true,
+}
+
+// @Summary List caption tracks
+// @ID listCaptionTracks
+// @Description List an item's caption tracks. Unpublished drafts are only listed for editors.
+// @Tags captions
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.CaptionTrackList
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions [get]
+func ListCaptionTracks(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	tracks, err := services.ListCaptionTracks(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CaptionTrackList{Tracks: tracks})
+}
+
+// @Summary Upload captions
+// @ID uploadCaptions
+// @Description Create or replace the caption track for a language from a WebVTT or SRT file sent as the request body. Cue styling and positioning are not kept.
+// @Tags captions
+// @Accept text/vtt
+// @Accept application/x-subrip
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param label query string false "Track name shown in players, e.g. English"
+// @Param published query bool false "Publish immediately (default true)"
+// @Param data body string true "WebVTT or SRT file"
+// @Success 200 {object} api.CaptionTrack
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Failure 415 {object} api.Problem
+// @Router /{id}/captions/{lang} [put]
+func UploadCaptions(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if contentType := c.ContentType(); contentType != "" && !captionUploadTypes[contentType] {
+		apperror.Respond(c, apperror.ErrUnsupportedMedia.WithDetail("Send a WebVTT (text/vtt) or SRT (application/x-subrip) file"))
+		return
+	}
+	published := true
+	if raw := c.Query("published"); raw != "" {
+		if published, err = strconv.ParseBool(raw); err != nil {
+			apperror.Respond(c, apperror.Validation(apperror.FieldError{
+				Field: "published", Code: "boolean", Message: "must be true or false",
+			}))
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, config.Config.Captions.MaxFileSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Respond(c, apperror.ErrPayloadTooLarge.WithDetail(
+				fmt.Sprintf("Caption files may be at most %d bytes", config.Config.Captions.MaxFileSize)))
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	track, err := services.ImportCaptions(viewer(c), id, c.Param("lang"), c.Query("label"), published, bytes.NewReader(body))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// @Summary Download captions
+// @ID downloadCaptions
+// @Description Download a caption track as WebVTT or SRT
+// @Tags captions
+// @Produce text/vtt
+// @Produce application/x-subrip
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param format query string false "vtt (default) or srt"
+// @Success 200 {file} file
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang} [get]
+func DownloadCaptions(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	format := c.DefaultQuery("format", captions.FormatVTT)
+	if format != captions.FormatVTT && format != captions.FormatSRT {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "format", Code: "oneof", Message: "must be one of: vtt, srt",
+		}))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.ExportCaptions(viewer(c), id, c.Param("lang"), format, &buf); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	name := fmt.Sprintf("media-%d-%s.%s", id, c.Param("lang"), format)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": name}))
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, captions.ContentTypes[format], buf.Bytes())
+}
+
+// @Summary Update caption track
+// @ID updateCaptionTrack
+// @Description Rename a track or publish a reviewed draft
+// @Tags captions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param data body api.UpdateCaptionTrackRequest true "Fields to change"
+// @Success 200 {object} api.CaptionTrack
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang} [patch]
+func UpdateCaptionTrack(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.UpdateCaptionTrackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	track, err := services.UpdateCaptionTrack(viewer(c), id, c.Param("lang"), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, track)
+}
+
+// @Summary Delete caption track
+// @ID deleteCaptionTrack
+// @Description Delete a caption track and its cues
+// @Tags captions
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang} [delete]
+func DeleteCaptionTrack(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteCaptionTrack(viewer(c), id, c.Param("lang")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary List caption cues
+// @ID listCaptionCues
+// @Description Get a caption track's cues in play order, for editing
+// @Tags captions
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Success 200 {object} api.CaptionCueList
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang}/cues [get]
+func ListCaptionCues(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	cues, err := services.GetCaptionCues(viewer(c), id, c.Param("lang"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cues)
+}
+
+// @Summary Add caption cue
+// @ID addCaptionCue
+// @Description Insert a cue; start_ms, end_ms and text are required
+// @Tags captions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param data body api.CaptionCueRequest true "Cue"
+// @Success 201 {object} api.CaptionCue
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang}/cues [post]
+func AddCaptionCue(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.CaptionCueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	cue, err := services.AddCaptionCue(viewer(c), id, c.Param("lang"), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, cue)
+}
+
+// @Summary Edit caption cue
+// @ID updateCaptionCue
+// @Description Change the timing or text of a cue; omitted fields are unchanged
+// @Tags captions
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param cueID path int true "Cue ID"
+// @Param data body api.CaptionCueRequest true "Fields to change"
+// @Success 200 {object} api.CaptionCue
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang}/cues/{cueID} [patch]
+func UpdateCaptionCue(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	cue, err := cueID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.CaptionCueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	updated, err := services.UpdateCaptionCue(viewer(c), id, c.Param("lang"), cue, req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// @Summary Delete caption cue
+// @ID deleteCaptionCue
+// @Description Remove a cue from a track
+// @Tags captions
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag"
+// @Param cueID path int true "Cue ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/captions/{lang}/cues/{cueID} [delete]
+func DeleteCaptionCue(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	cue, err := cueID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteCaptionCue(viewer(c), id, c.Param("lang"), cue); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Draft captions automatically
+// @ID draftCaptions
+// @Description Queue speech-to-text for the item's audio. The result is an unpublished draft track to review, edit and publish.
+// @Tags captions
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param lang path string true "BCP 47 language tag spoken in the recording"
+// @Success 202
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Failure 501 {object} api.Problem
+// @Router /{id}/captions/{lang}/draft [post]
+func DraftCaptions(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.RequestCaptionDraft(viewer(c), id, c.Param("lang")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+// @Summary Search transcripts
+// @ID searchTranscripts
+// @Description Find spoken words in published captions, best matches first, with timestamps and links that open the player at each match
+// @Tags captions
+// @Produce json
+// @Security Bearer
+// @Param q query string true "Words to find; supports \"quoted phrases\", OR and -exclusions"
+// @Param language query string false "Only tracks in this BCP 47 language"
+// @Param media_id query int false "Only this item"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Matches per page"
+// @Success 200 {object} api.TranscriptSearchResult
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /transcripts/search [get]
+func SearchTranscripts(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	mediaFilter, err := optionalUint(c, "media_id")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	matches, total, err := services.SearchTranscripts(viewer(c), c.Query("q"), c.Query("language"), mediaFilter, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.TranscriptSearchResult{
+		Matches:  matches,
+		Page:     page.Page,
+		PageSize: page.PageSize,
+		Total:    total,
+	})
+}
+
+func cueID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("cueID"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, apperror.ErrNotFound.WithDetail("Cue not found")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,407 @@
+// media-service/pkg/handlers/collection_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var collectionKinds = map[string]bool{
+	models.CollectionSeries:   true,
+	models.CollectionPlaylist: true,
+	models.CollectionGroup:    true,
+}
+
+// @Summary List collections
+// @ID listCollections
+// @Description List series, playlists and collections visible to the caller, in manual order
+// @Tags collections
+// @Produce json
+// @Security Bearer
+// @Param kind query string false "series, playlist or collection"
+// @Param owner_id query int false "Collections created by this user"
+// @Param parent_id query int false "Sub-collections of this collection; 0 for top-level collections"
+// @Param q query string false "Search titles"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Collections per page"
+// @Success 200 {object} api.CollectionList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /collections [get]
+func ListCollections(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	ownerID, err := optionalUint(c, "owner_id")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	filter := services.CollectionFilter{Kind: c.Query("kind"), OwnerID: ownerID, Query: c.Query("q")}
+	if filter.Kind != "" && !collectionKinds[filter.Kind] {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "kind", Code: "oneof", Message: "must be one of series, playlist, collection",
+		}))
+		return
+	}
+	if _, ok := c.GetQuery("parent_id"); ok {
+		parentID, err := optionalUint(c, "parent_id")
+		if err != nil {
+			apperror.Respond(c, err)
+			return
+		}
+		filter.ParentID = &parentID
+	}
+
+	collections, total, err := services.ListCollections(viewer(c), filter, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	ids := make([]uint, len(collections))
+	for i := range collections {
+		ids[i] = collections[i].ID
+	}
+	counts, err := services.CollectionItemCounts(ids)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.CollectionList{
+		Collections: make([]api.Collection, 0, len(collections)),
+		Page:        page.Page,
+		PageSize:    page.PageSize,
+		Total:       total,
+	}
+	for i := range collections {
+		list.Collections = append(list.Collections, services.ToAPICollection(&collections[i], counts[collections[i].ID]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Create collection
+// @ID createCollection
+// @Description Create a series, playlist or collection, optionally nested in another and filled with items. Anyone may create playlists; series and collections require the trainer or admin role.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.CollectionRequest true "Collection"
+// @Success 201 {object} api.CollectionDetail
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections [post]
+func CreateCollection(c *gin.Context) {
+	var req api.CollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	collection, err := services.CreateCollection(viewer(c), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	respondCollection(c, http.StatusCreated, collection)
+}
+
+// @Summary Get collection
+// @ID getCollection
+// @Description Get a collection with the items and sub-collections the caller can see, in order, and the caller's progress on each item
+// @Tags collections
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Success 200 {object} api.CollectionDetail
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID} [get]
+func GetCollection(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	collection, err := services.GetCollection(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	respondCollection(c, http.StatusOK, collection)
+}
+
+// @Summary Update collection
+// @ID updateCollection
+// @Description Change a collection or move it into another. Only its owner or an admin may do this.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param data body api.UpdateCollectionRequest true "Fields to change"
+// @Success 200 {object} api.CollectionDetail
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID} [patch]
+func UpdateCollection(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.UpdateCollectionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	collection, err := services.UpdateCollection(viewer(c), id, services.CollectionUpdate{
+		Title:       trimmed(req.Title),
+		Description: trimmed(req.Description),
+		Visibility:  req.Visibility,
+		PublishAt:   req.PublishAt,
+		ParentID:    req.ParentID,
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	respondCollection(c, http.StatusOK, collection)
+}
+
+// @Summary Delete collection
+// @ID deleteCollection
+// @Description Delete a collection. Its sub-collections move up to its parent and its items stay in the catalog. Only its owner or an admin may do this.
+// @Tags collections
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID} [delete]
+func DeleteCollection(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteCollection(viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Add items to collection
+// @ID addCollectionItems
+// @Description Insert items, in the order given, at a position or at the end. Items already in the collection stay where they are.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param data body api.CollectionItemsRequest true "Items"
+// @Success 200 {object} api.CollectionItemsResult
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/items [post]
+func AddCollectionItems(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.CollectionItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	added, count, err := services.AddCollectionItems(viewer(c), id, req.MediaIDs, req.Position)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CollectionItemsResult{Changed: added, ItemCount: count})
+}
+
+// @Summary Remove items from collection
+// @ID removeCollectionItems
+// @Description Take items out of a collection; the rest close up. The items stay in the catalog.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param data body api.CollectionItemsRequest true "Items; position is ignored"
+// @Success 200 {object} api.CollectionItemsResult
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/items/remove [post]
+func RemoveCollectionItems(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.CollectionItemsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	removed, count, err := services.RemoveCollectionItems(viewer(c), id, req.MediaIDs)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.CollectionItemsResult{Changed: removed, ItemCount: count})
+}
+
+// @Summary Reorder collection
+// @ID reorderCollection
+// @Description Set the manual order of a collection's items, its sub-collections, or both
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param data body api.CollectionOrderRequest true "New order"
+// @Success 200 {object} api.CollectionDetail
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/order [put]
+func ReorderCollection(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.CollectionOrderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	if err := services.ReorderCollection(viewer(c), id, req.MediaIDs, req.CollectionIDs); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	collection, err := services.GetCollection(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	respondCollection(c, http.StatusOK, collection)
+}
+
+// @Summary Next up in collection
+// @ID nextUpInCollection
+// @Description Pick what the caller should play next, going through the collection's items and then each sub-collection's. Without after, this continues from the item the caller played last.
+// @Tags collections
+// @Produce json
+// @Security Bearer
+// @Param collectionID path int true "Collection ID"
+// @Param after query int false "The item just finished"
+// @Success 200 {object} api.NextUp
+// @Success 204 "Nothing left to play"
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /collections/{collectionID}/next [get]
+func NextUpInCollection(c *gin.Context) {
+	id, err := collectionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	after, err := optionalUint(c, "after")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	next, err := services.NextUp(c.Request.Context(), viewer(c), id, after)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if next == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, next)
+}
+
+// respondCollection writes the collection with the contents the caller
+// can see.
+func respondCollection(c *gin.Context, status int, collection *models.Collection) {
+	items, children, err := services.CollectionContents(viewer(c), collection)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	ids := []uint{collection.ID}
+	for i := range children {
+		ids = append(ids, children[i].ID)
+	}
+	counts, err := services.CollectionItemCounts(ids)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	detail := api.CollectionDetail{
+		Collection: services.ToAPICollection(collection, counts[collection.ID]),
+		Items:      make([]api.MediaItem, 0, len(items)),
+		Children:   make([]api.Collection, 0, len(children)),
+	}
+	for i := range items {
+		detail.Items = append(detail.Items, services.ToAPIMedia(&items[i]))
+	}
+	for i := range children {
+		detail.Children = append(detail.Children, services.ToAPICollection(&children[i], counts[children[i].ID]))
+	}
+	services.AttachProgress(c.Request.Context(), viewer(c), detail.Items)
+	services.AttachAccess(c.Request.Context(), viewer(c), detail.Items)
+	c.JSON(status, detail)
+}
+
+func collectionID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("collectionID"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, apperror.ErrNotFound.WithDetail("Collection not found")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,26 @@
+// media-service/pkg/handlers/helpers.go
+package handlers
+
+import (
+	"shepherdsfold/media-service/pkg/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// viewer identifies the caller from the claims set by middleware.AuthRequired.
+func viewer(c *gin.Context) services.Viewer {
+	return services.Viewer{
+		UserID:   c.GetUint("userID"),
+		Role:     c.GetString("role"),
+		Language: c.GetString("language"),
+	}
+}
+
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := strings.TrimSpace(*s)
+	return &v
+}
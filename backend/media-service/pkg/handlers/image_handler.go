@@ -0,0 +1,163 @@
+// media-service/pkg/handlers/image_handler.go
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get media images
+// @ID getMediaImages
+// @Description Get signed URLs of an item's poster in every size, its scrubbing thumbnail track and audio waveform, plus the generated poster candidates to choose from. The URLs are cacheable until expires_at.
+// @Tags images
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaImagesDetail
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/images [get]
+func GetMediaImages(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	images, err := services.GetMediaImages(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+// @Summary Upload thumbnail
+// @ID uploadThumbnail
+// @Description Replace the item's poster with a JPEG, PNG or GIF image sent as the request body. It is resized into every poster size.
+// @Tags images
+// @Accept image/jpeg
+// @Accept image/png
+// @Accept image/gif
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body string true "Image file"
+// @Success 200 {object} api.MediaImagesDetail
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Failure 415 {object} api.Problem
+// @Router /{id}/thumbnail [put]
+func UploadThumbnail(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, config.Config.Images.MaxUploadSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Respond(c, apperror.ErrPayloadTooLarge.WithDetail(
+				fmt.Sprintf("Thumbnails may be at most %d bytes", config.Config.Images.MaxUploadSize)))
+			return
+		}
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.UploadThumbnail(c.Request.Context(), viewer(c), id, body); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	respondImages(c, id)
+}
+
+// @Summary Reset thumbnail
+// @ID resetThumbnail
+// @Description Remove an uploaded thumbnail or a poster taken at a chosen time, going back to the selected generated candidate
+// @Tags images
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaImagesDetail
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/thumbnail [delete]
+func ResetThumbnail(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.ResetPoster(c.Request.Context(), viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	respondImages(c, id)
+}
+
+// @Summary Choose poster
+// @ID choosePoster
+// @Description Select one of the generated poster candidates, which takes effect at once, or take the poster from the video at_seconds in, which is queued and answered with 202
+// @Tags images
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.ChoosePosterRequest true "Candidate index or time"
+// @Success 200 {object} api.MediaImagesDetail
+// @Success 202
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/poster [put]
+func ChoosePoster(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.ChoosePosterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	queued, err := services.ChoosePoster(c.Request.Context(), viewer(c), id, req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if queued {
+		c.Status(http.StatusAccepted)
+		return
+	}
+	respondImages(c, id)
+}
+
+func respondImages(c *gin.Context, id uint) {
+	images, err := services.GetMediaImages(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
@@ -0,0 +1,506 @@
+// media-service/pkg/handlers/live_handler.go
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var liveStatuses = map[string]bool{
+	models.LiveScheduled: true,
+	models.LiveOnAir:     true,
+	models.LiveEnded:     true,
+	models.LiveCancelled: true,
+}
+
+// @Summary List live sessions
+// @ID listLiveSessions
+// @Description List live sessions visible to the caller, soonest first
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param status query string false "scheduled, live, ended or cancelled"
+// @Param host_id query int false "Sessions hosted by this user"
+// @Param cohort query string false "Sessions for this cohort"
+// @Param from query string false "Only sessions, or series with occurrences, at or after this RFC 3339 time"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Sessions per page"
+// @Success 200 {object} api.LiveSessionList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /live [get]
+func ListLiveSessions(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	hostID, err := optionalUint(c, "host_id")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	filter := services.LiveFilter{Status: c.Query("status"), HostID: hostID, Cohort: c.Query("cohort")}
+	if filter.Status != "" && !liveStatuses[filter.Status] {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "status", Code: "oneof", Message: "must be one of scheduled, live, ended, cancelled",
+		}))
+		return
+	}
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			apperror.Respond(c, apperror.Validation(apperror.FieldError{
+				Field: "from", Code: "datetime", Message: "must be an RFC 3339 time",
+			}))
+			return
+		}
+		filter.From = &from
+	}
+
+	sessions, total, err := services.ListLiveSessions(viewer(c), filter, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.LiveSessionList{
+		Sessions: make([]api.LiveSession, 0, len(sessions)),
+		Page:     page.Page,
+		PageSize: page.PageSize,
+		Total:    total,
+	}
+	for i := range sessions {
+		list.Sessions = append(list.Sessions, services.ToAPILiveSession(c.Request.Context(), viewer(c), &sessions[i]))
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Schedule live session
+// @ID createLiveSession
+// @Description Schedule a live session, or a recurring series of them. Invitees are emailed an iCalendar invitation. The response carries the RTMP ingest URL and stream key for the host's encoder. Requires the trainer or admin role.
+// @Tags live
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.LiveSessionRequest true "Session"
+// @Success 201 {object} api.LiveSession
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /live [post]
+func CreateLiveSession(c *gin.Context) {
+	var req api.LiveSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	session, err := services.CreateLiveSession(viewer(c), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, services.ToAPILiveSession(c.Request.Context(), viewer(c), session))
+}
+
+// @Summary Get live session
+// @ID getLiveSession
+// @Description Get a live session with its playback URL and audience while it is live
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 200 {object} api.LiveSession
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /live/{sessionID} [get]
+func GetLiveSession(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	session, err := services.GetLiveSession(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPILiveSession(c.Request.Context(), viewer(c), session))
+}
+
+// @Summary Update live session
+// @ID updateLiveSession
+// @Description Change, cancel or reinstate a live session. Invitees are emailed an updated invitation or a cancellation. Only its host or an admin may do this.
+// @Tags live
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Param data body api.UpdateLiveSessionRequest true "Fields to change"
+// @Success 200 {object} api.LiveSession
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /live/{sessionID} [patch]
+func UpdateLiveSession(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.UpdateLiveSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	session, err := services.UpdateLiveSession(viewer(c), id, services.LiveSessionUpdate{
+		Title:           trimmed(req.Title),
+		Description:     trimmed(req.Description),
+		Cohort:          trimmed(req.Cohort),
+		ScheduledAt:     req.ScheduledAt,
+		TimeZone:        trimmed(req.TimeZone),
+		RRule:           req.RRule,
+		DurationMinutes: req.DurationMinutes,
+		Visibility:      req.Visibility,
+		Language:        req.Language,
+		Record:          req.Record,
+		Cancelled:       req.Cancelled,
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPILiveSession(c.Request.Context(), viewer(c), session))
+}
+
+// @Summary Delete live session
+// @ID deleteLiveSession
+// @Description Delete a live session that is not on air, with its invitees and attendance. Catalog items made from its recordings are kept.
+// @Tags live
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /live/{sessionID} [delete]
+func DeleteLiveSession(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteLiveSession(viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Rotate stream key
+// @ID rotateStreamKey
+// @Description Replace the session's stream key, e.g. after it leaked. A broadcast already running carries on.
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 200 {object} api.LiveSession
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /live/{sessionID}/key [post]
+func RotateStreamKey(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	session, err := services.RotateStreamKey(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPILiveSession(c.Request.Context(), viewer(c), session))
+}
+
+// @Summary Watch live session
+// @ID watchLiveSession
+// @Description Count the caller in the audience and credit their attendance. Players call this about every 30 seconds while the stream plays.
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 200 {object} api.LiveViewers
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /live/{sessionID}/watch [post]
+func WatchLiveSession(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	viewers, err := services.WatchLiveSession(c.Request.Context(), viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.LiveViewers{Viewers: viewers})
+}
+
+// @Summary Join live session
+// @ID joinLiveSession
+// @Description Record the caller joining the occurrence under way, or one starting within live.join_early
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 200 {object} api.LiveAttendance
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /live/{sessionID}/join [post]
+func JoinLiveSession(c *gin.Context) {
+	recordAttendance(c, services.AttendanceJoin)
+}
+
+// @Summary Leave live session
+// @ID leaveLiveSession
+// @Description Record the caller leaving the current occurrence. Time away is not credited until they join again.
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 200 {object} api.LiveAttendance
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /live/{sessionID}/leave [post]
+func LeaveLiveSession(c *gin.Context) {
+	recordAttendance(c, services.AttendanceLeave)
+}
+
+// @Summary List attendance
+// @ID listLiveAttendance
+// @Description List who attended the session's occurrences, latest first. Only its host or an admin may do this.
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Param occurrence query string false "Start of one occurrence, as an RFC 3339 time"
+// @Param user_id query int false "Attendance of this user"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Rows per page"
+// @Success 200 {object} api.LiveAttendanceList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /live/{sessionID}/attendance [get]
+func ListLiveAttendance(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	userID, err := optionalUint(c, "user_id")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	filter := services.AttendanceFilter{UserID: userID}
+	if raw := c.Query("occurrence"); raw != "" {
+		occurrence, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			apperror.Respond(c, apperror.Validation(apperror.FieldError{
+				Field: "occurrence", Code: "datetime", Message: "must be an RFC 3339 time",
+			}))
+			return
+		}
+		filter.Occurrence = &occurrence
+	}
+
+	rows, total, err := services.ListAttendance(viewer(c), id, filter, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.LiveAttendanceList{
+		Attendance: rows,
+		Page:       page.Page,
+		PageSize:   page.PageSize,
+		Total:      total,
+	})
+}
+
+// @Summary List invitees
+// @ID listLiveInvitees
+// @Description List the session's invitees. Only its host or an admin may do this.
+// @Tags live
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Success 200 {object} api.LiveInviteeList
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /live/{sessionID}/invitees [get]
+func ListLiveInvitees(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	invitees, err := services.ListInvitees(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, inviteeList(invitees))
+}
+
+// @Summary Replace invitees
+// @ID setLiveInvitees
+// @Description Replace the session's invitees, e.g. with a cohort's roster. Those added are emailed an invitation and those removed a cancellation. Only its host or an admin may do this.
+// @Tags live
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param sessionID path int true "Session ID"
+// @Param data body api.LiveInviteesRequest true "Invitees"
+// @Success 200 {object} api.LiveInviteeList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /live/{sessionID}/invitees [put]
+func SetLiveInvitees(c *gin.Context) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.LiveInviteesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	invitees, err := services.SetInvitees(viewer(c), id, req.Invitees)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, inviteeList(invitees))
+}
+
+// RTMPCallback serves nginx-rtmp's on_publish, on_publish_done, on_play,
+// on_play_done and on_record_done. nginx-rtmp authenticates with the
+// shared secret in the query string, and takes any non-2xx answer as a
+// refusal. A successful publish is redirected to the session's playback
+// name; a callback handled before is refused as a replay.
+func RTMPCallback(c *gin.Context) {
+	secret := config.Config.Live.CallbackSecret
+	if secret == "" {
+		apperror.Respond(c, apperror.ErrNotEnabled.WithDetail("Live streaming callbacks are not configured"))
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("secret")), []byte(secret)) != 1 {
+		apperror.Respond(c, apperror.ErrForbidden.WithDetail("Invalid callback secret"))
+		return
+	}
+	var cb api.RTMPCallback
+	if err := c.ShouldBind(&cb); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	rename, err := services.HandleRTMPCallback(c.Request.Context(), cb)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if rename != "" {
+		c.Header("Location", rename)
+		c.Status(http.StatusFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func recordAttendance(c *gin.Context, event string) {
+	id, err := sessionID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	row, err := services.RecordAttendance(viewer(c), id, event)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.LiveAttendance{
+		UserID:     row.UserID,
+		Occurrence: row.Occurrence,
+		JoinedAt:   row.JoinedAt,
+		LeftAt:     row.LeftAt,
+		LastSeenAt: row.LastSeenAt,
+		Seconds:    row.Seconds,
+	})
+}
+
+func inviteeList(invitees []models.SessionInvitee) api.LiveInviteeList {
+	list := api.LiveInviteeList{Invitees: make([]api.LiveInvitee, 0, len(invitees))}
+	for _, invitee := range invitees {
+		list.Invitees = append(list.Invitees, api.LiveInvitee{
+			Email:  invitee.Email,
+			Name:   invitee.Name,
+			UserID: invitee.UserID,
+		})
+	}
+	return list
+}
+
+func sessionID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("sessionID"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, apperror.ErrNotFound.WithDetail("Live session not found")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,189 @@
+// media-service/pkg/handlers/live_handler_test.go
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/testenv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+const testCallbackSecret = "test-callback-secret"
+
+func rtmpServer(t *testing.T) (*gin.Engine, *miniredis.Miniredis) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	testenv.Config(t)
+	redis := testenv.Redis(t)
+	config.Config.Live.CallbackSecret = testCallbackSecret
+
+	r := gin.New()
+	r.POST("/api/media/rtmp/callback", RTMPCallback)
+	return r, redis
+}
+
+// rtmpCallback posts a callback form as nginx-rtmp does, with secret in
+// the query string unless it is empty.
+func rtmpCallback(r http.Handler, secret string, form url.Values) *httptest.ResponseRecorder {
+	target := "/api/media/rtmp/callback"
+	if secret != "" {
+		target += "?secret=" + url.QueryEscape(secret)
+	}
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func callbackForm(call, name, clientID string) url.Values {
+	return url.Values{
+		"call":     {call},
+		"app":      {"live"},
+		"name":     {name},
+		"clientid": {clientID},
+		"addr":     {"203.0.113.7"},
+	}
+}
+
+func TestRTMPCallbackSecret(t *testing.T) {
+	r, _ := rtmpServer(t)
+	// Callbacks the service ignores need no database
+	form := callbackForm("update", "stream-key", "1")
+
+	tests := []struct {
+		name       string
+		configured string
+		secret     string
+		want       int
+	}{
+		{"not configured", "", testCallbackSecret, http.StatusNotImplemented},
+		{"no secret", testCallbackSecret, "", http.StatusForbidden},
+		{"wrong secret", testCallbackSecret, "change-me-live-callback-secret", http.StatusForbidden},
+		{"secret prefix", testCallbackSecret, testCallbackSecret[:len(testCallbackSecret)-1], http.StatusForbidden},
+		{"valid secret", testCallbackSecret, testCallbackSecret, http.StatusNoContent},
+		// Only callbacks the service acts on are checked for replays
+		{"valid secret again", testCallbackSecret, testCallbackSecret, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.Live.CallbackSecret = tt.configured
+			if w := rtmpCallback(r, tt.secret, form); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestRTMPCallbackReplay(t *testing.T) {
+	r, redis := rtmpServer(t)
+	testenv.Database(t)
+	testenv.Storage(t)
+	config.Config.Live.RecordingsDir = t.TempDir()
+	config.Config.Live.CallbackReplayWindow = time.Hour
+
+	session := &models.LiveSession{
+		Title:        "Tuesday Elders Class",
+		HostID:       7,
+		ScheduledAt:  time.Now(),
+		Visibility:   models.VisibilityPublic,
+		StreamKey:    "live_0123456789abcdef",
+		PlaybackName: "tuesday-class",
+		Record:       true,
+	}
+	if err := config.DB.Create(session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	reload := func() *models.LiveSession {
+		t.Helper()
+		var s models.LiveSession
+		if err := config.DB.First(&s, session.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return &s
+	}
+	send := func(form url.Values, want int) *httptest.ResponseRecorder {
+		t.Helper()
+		w := rtmpCallback(r, testCallbackSecret, form)
+		if w.Code != want {
+			t.Fatalf("%s from client %s: status %d, want %d: %s", form.Get("call"), form.Get("clientid"), w.Code, want, w.Body)
+		}
+		return w
+	}
+
+	publish := callbackForm("publish", session.StreamKey, "41")
+	if w := send(publish, http.StatusFound); w.Header().Get("Location") != session.PlaybackName {
+		t.Errorf("publish redirected to %q", w.Header().Get("Location"))
+	}
+	if s := reload(); s.Status != models.LiveOnAir || s.PublisherClientID != "41" {
+		t.Fatalf("after publish: %q by client %q", s.Status, s.PublisherClientID)
+	}
+	send(publish, http.StatusConflict)
+
+	// A recording is imported once, however often its callback arrives
+	recording := filepath.Join(config.Config.Live.RecordingsDir, "tuesday-class-1.flv")
+	if err := os.WriteFile(recording, []byte("flv"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	recordDone := callbackForm("record_done", session.PlaybackName, "41")
+	recordDone.Set("path", "/var/recordings/tuesday-class-1.flv")
+	send(recordDone, http.StatusNoContent)
+	send(recordDone, http.StatusConflict)
+	if s := reload(); len(s.RecordingIDs) != 1 {
+		t.Errorf("recordings %v, want one", s.RecordingIDs)
+	}
+	var items int64
+	config.DB.Model(&models.MediaItem{}).Count(&items)
+	if items != 1 {
+		t.Errorf("%d items, want 1", items)
+	}
+
+	publishDone := callbackForm("publish_done", session.PlaybackName, "41")
+	send(publishDone, http.StatusNoContent)
+	if s := reload(); s.Status != models.LiveEnded {
+		t.Fatalf("after publish_done: %q", s.Status)
+	}
+
+	// Replaying the captured publish does not put the session back on air
+	send(publish, http.StatusConflict)
+	send(publishDone, http.StatusConflict)
+	if s := reload(); s.Status != models.LiveEnded || s.PublisherClientID != "" {
+		t.Errorf("after replays: %q by client %q", s.Status, s.PublisherClientID)
+	}
+
+	// A new connection may publish again
+	send(callbackForm("publish", session.StreamKey, "42"), http.StatusFound)
+	if s := reload(); s.Status != models.LiveOnAir || s.PublisherClientID != "42" {
+		t.Errorf("after reconnecting: %q by client %q", s.Status, s.PublisherClientID)
+	}
+
+	// Refused callbacks are not remembered, so they stay refused for
+	// what they are
+	unknown := callbackForm("publish", "live_not-a-stream-key", "43")
+	send(unknown, http.StatusForbidden)
+	send(unknown, http.StatusForbidden)
+
+	// Handled callbacks are remembered for the replay window only
+	remembered := 0
+	for _, key := range redis.Keys() {
+		if strings.HasPrefix(key, "live:callback:") {
+			remembered++
+			if ttl := redis.TTL(key); ttl != time.Hour {
+				t.Errorf("%s kept for %s, want 1h", key, ttl)
+			}
+		}
+	}
+	if remembered != 4 {
+		t.Errorf("%d callbacks remembered, want 4", remembered)
+	}
+}
@@ -0,0 +1,301 @@
+// media-service/pkg/handlers/media_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List media
+// @ID listMedia
+// @Description List catalog items visible to the caller, newest first unless sorted otherwise, with the caller's playback progress on each
+// @Tags media
+// @Produce json
+// @Security Bearer
+// @Param type query string false "audio, video or document"
+// @Param speaker query string false "Exact speaker name"
+// @Param series query string false "Exact series name"
+// @Param language query string false "BCP 47 language tag"
+// @Param tag query string false "Items carrying this tag"
+// @Param scripture query string false "Items covering any verse of these scripture references, e.g. John 3"
+// @Param versification query string false "Numbering of scripture: english (default), hebrew or vulgate"
+// @Param visibility query string false "public or private"
+// @Param owner_id query int false "Items added by this user"
+// @Param q query string false "Search title and description"
+// @Param sort query string false "created_at, updated_at, title, speaker, series or duration; prefix with - for descending"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Items per page"
+// @Success 200 {object} api.MediaList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /content [get]
+func ListMedia(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	ownerID, err := optionalUint(c, "owner_id")
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	items, total, err := services.ListMedia(viewer(c), services.MediaFilter{
+		Type:          c.Query("type"),
+		Speaker:       c.Query("speaker"),
+		Series:        c.Query("series"),
+		Language:      c.Query("language"),
+		Tag:           c.Query("tag"),
+		Scripture:     c.Query("scripture"),
+		Versification: c.Query("versification"),
+		Visibility:    c.Query("visibility"),
+		OwnerID:       ownerID,
+		Query:         c.Query("q"),
+	}, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.MediaList{
+		Items:    make([]api.MediaItem, 0, len(items)),
+		Page:     page.Page,
+		PageSize: page.PageSize,
+		Total:    total,
+	}
+	for i := range items {
+		list.Items = append(list.Items, services.ToAPIMedia(&items[i]))
+	}
+	services.AttachProgress(c.Request.Context(), viewer(c), list.Items)
+	services.AttachAccess(c.Request.Context(), viewer(c), list.Items)
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Create media
+// @ID createMedia
+// @Description Add an item to the catalog as a draft, hidden from learners until it is reviewed and published. Requires the trainer or admin role.
+// @Tags media
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.MediaRequest true "Catalog entry"
+// @Success 201 {object} api.MediaItem
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /content [post]
+func CreateMedia(c *gin.Context) {
+	var req api.MediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	item, err := services.CreateMedia(viewer(c), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, services.ToAPIMedia(item))
+}
+
+// @Summary Get media
+// @ID getMedia
+// @Description Get a single catalog item with the caller's playback progress and, if it has an access rule, whether it is unlocked for them
+// @Tags media
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaItem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id} [get]
+func GetMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	item, err := services.GetMedia(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	out := []api.MediaItem{services.ToAPIMedia(item)}
+	services.AttachProgress(c.Request.Context(), viewer(c), out)
+	services.AttachAccess(c.Request.Context(), viewer(c), out)
+	c.JSON(http.StatusOK, out[0])
+}
+
+// @Summary Replace media
+// @ID replaceMedia
+// @Description Replace every editable field of a catalog item. On a published item the catalog fields go to a new draft version for review. Only its owner or an admin may do this.
+// @Tags media
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.MediaRequest true "Catalog entry"
+// @Success 200 {object} api.MediaItem
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id} [put]
+func ReplaceMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.MediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	item, err := services.ReplaceMedia(viewer(c), id, req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIMedia(item))
+}
+
+// @Summary Update media
+// @ID updateMedia
+// @Description Change some fields of a catalog item. Omitted fields are unchanged. On a published item the catalog fields go to a new draft version for review.
+// @Tags media
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.UpdateMediaRequest true "Fields to change"
+// @Success 200 {object} api.MediaItem
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id} [patch]
+func UpdateMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.UpdateMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	item, err := services.UpdateMedia(viewer(c), id, services.MediaUpdate{
+		Title:           trimmed(req.Title),
+		Description:     trimmed(req.Description),
+		Type:            req.Type,
+		Speaker:         trimmed(req.Speaker),
+		Series:          trimmed(req.Series),
+		ScriptureRefs:   req.ScriptureRefs,
+		Versification:   req.Versification,
+		Tags:            req.Tags,
+		Language:        req.Language,
+		DurationSeconds: req.DurationSeconds,
+		Visibility:      req.Visibility,
+		PublishAt:       req.PublishAt,
+		EmbargoUntil:    req.EmbargoUntil,
+	})
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPIMedia(item))
+}
+
+// @Summary Delete media
+// @ID deleteMedia
+// @Description Remove a catalog item. Only its owner or an admin may do this.
+// @Tags media
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id} [delete]
+func DeleteMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.DeleteMedia(viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func mediaID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, apperror.ErrNotFound.WithDetail("Media item not found")
+	}
+	return uint(id), nil
+}
+
+// pageParams reads page, page_size and sort, applying the catalog defaults.
+func pageParams(c *gin.Context) (services.Page, error) {
+	page := services.Page{
+		Page:     1,
+		PageSize: config.Config.Catalog.DefaultPageSize,
+		Sort:     c.Query("sort"),
+	}
+	var fields []apperror.FieldError
+	if raw := c.Query("page"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			fields = append(fields, apperror.FieldError{Field: "page", Code: "min", Message: "must be at least 1"})
+		}
+		page.Page = n
+	}
+	if raw := c.Query("page_size"); raw != "" {
+		maxSize := config.Config.Catalog.MaxPageSize
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSize {
+			fields = append(fields, apperror.FieldError{
+				Field: "page_size", Code: "max", Message: "must be between 1 and " + strconv.Itoa(maxSize),
+			})
+		}
+		page.PageSize = n
+	}
+	if len(fields) > 0 {
+		return page, apperror.Validation(fields...)
+	}
+	return page, nil
+}
+
+func optionalUint(c *gin.Context, name string) (uint, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(raw, 10, 0)
+	if err != nil {
+		return 0, apperror.Validation(apperror.FieldError{Field: name, Code: "type", Message: "must be of type number"})
+	}
+	return uint(n), nil
+}
@@ -0,0 +1,215 @@
+// media-service/pkg/handlers/offline_handler.go
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/middleware"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Create offline package
+// @ID createOfflinePackage
+// @Description License a device to keep a lesson or course offline. Returns the signed license and where to download the package.
+// @Tags offline
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.CreateOfflinePackageRequest true "Items, device and quality"
+// @Success 201 {object} api.OfflineLicense
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /offline/packages [post]
+func CreateOfflinePackage(c *gin.Context) {
+	var req api.CreateOfflinePackageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	license, token, err := services.CreateOfflineLicense(c.Request.Context(), viewer(c), req)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, services.ToAPILicense(license, token))
+}
+
+// @Summary Download offline package
+// @ID downloadOfflinePackage
+// @Description Stream the ZIP for an active license: manifest.json, license.txt and the media files
+// @Tags offline
+// @Produce zip
+// @Security Bearer
+// @Param licenseID path int true "License ID"
+// @Success 200 {file} file
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 410 {object} api.Problem
+// @Router /offline/packages/{licenseID}/download [get]
+func DownloadOfflinePackage(c *gin.Context) {
+	id, err := licenseID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="offline-%d.zip"`, id))
+	c.Header("Cache-Control", "no-store")
+	if err := services.WriteOfflinePackage(c.Request.Context(), c.Writer, viewer(c), id); err != nil {
+		if c.Writer.Written() {
+			// Too late for a problem response; the truncated ZIP fails to open
+			middleware.GetLogger(c).WithError(err).Error("offline package aborted")
+			c.Abort()
+			return
+		}
+		c.Header("Content-Disposition", "")
+		apperror.Respond(c, err)
+		return
+	}
+}
+
+// @Summary List offline licenses
+// @ID listOfflineLicenses
+// @Description List the caller's offline licenses. Apps should delete content whose license is revoked.
+// @Tags offline
+// @Produce json
+// @Security Bearer
+// @Success 200 {array} api.OfflineLicense
+// @Failure 401 {object} api.Problem
+// @Router /offline/licenses [get]
+func ListOfflineLicenses(c *gin.Context) {
+	licenses, err := services.ListOfflineLicenses(viewer(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	out := make([]api.OfflineLicense, 0, len(licenses))
+	for i := range licenses {
+		out = append(out, services.ToAPILicense(&licenses[i], ""))
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// @Summary Renew offline license
+// @ID renewOfflineLicense
+// @Description Extend a license from the device it was issued to. Revokes it instead if the caller has lost access to any item or one is under embargo or locked again.
+// @Tags offline
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param licenseID path int true "License ID"
+// @Param data body api.RenewOfflineLicenseRequest true "Device"
+// @Success 200 {object} api.OfflineLicense
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 410 {object} api.Problem
+// @Router /offline/licenses/{licenseID}/renew [post]
+func RenewOfflineLicense(c *gin.Context) {
+	id, err := licenseID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.RenewOfflineLicenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	license, token, err := services.RenewOfflineLicense(c.Request.Context(), viewer(c), id, req.DeviceID)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, services.ToAPILicense(license, token))
+}
+
+// @Summary Revoke offline license
+// @ID revokeOfflineLicense
+// @Description Revoke one of the caller's licenses, or any license as an admin
+// @Tags offline
+// @Security Bearer
+// @Param licenseID path int true "License ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /offline/licenses/{licenseID} [delete]
+func RevokeOfflineLicense(c *gin.Context) {
+	id, err := licenseID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := services.RevokeOfflineLicense(viewer(c), id); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Revoke a user's offline licenses
+// @ID revokeUserOfflineLicenses
+// @Description Revoke every active license of a user, or only those covering the given items, e.g. when a device is lost. Admin only.
+// @Tags offline
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param data body api.RevokeOfflineLicensesRequest true "User and optional items"
+// @Success 200 {object} api.RevokeOfflineLicensesResponse
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /offline/licenses/revoke [post]
+func RevokeUserOfflineLicenses(c *gin.Context) {
+	var req api.RevokeOfflineLicensesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	n, err := services.RevokeUserOfflineLicenses(req.UserID, req.MediaIDs, req.Reason)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.RevokeOfflineLicensesResponse{Revoked: n})
+}
+
+// @Summary Offline license key
+// @ID getOfflineLicenseKey
+// @Description Public key for verifying license tokens offline
+// @Tags offline
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} api.OfflineLicenseKey
+// @Failure 401 {object} api.Problem
+// @Router /offline/license-key [get]
+func GetOfflineLicenseKey(c *gin.Context) {
+	c.JSON(http.StatusOK, services.LicensePublicKey())
+}
+
+func licenseID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("licenseID"), 10, 0)
+	if err != nil || id == 0 {
+		return 0, apperror.ErrNotFound.WithDetail("License not found")
+	}
+	return uint(id), nil
+}
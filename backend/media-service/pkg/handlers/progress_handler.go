@@ -0,0 +1,74 @@
+// media-service/pkg/handlers/progress_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Record playback heartbeat
+// @ID recordPlaybackHeartbeat
+// @Description Report the player's position every 10 to 15 seconds while playing, and on pause, seek and end. Only continuous playback between heartbeats counts towards completion.
+// @Tags progress
+// @Accept json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.ProgressHeartbeat true "Player state"
+// @Success 204
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/progress [post]
+func RecordHeartbeat(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var hb api.ProgressHeartbeat
+	if err := c.ShouldBindJSON(&hb); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+	if hb.Event == "" {
+		hb.Event = api.PlaybackHeartbeat
+	}
+
+	if err := services.RecordHeartbeat(c.Request.Context(), viewer(c), id, hb); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Get playback progress
+// @ID getPlaybackProgress
+// @Description Get where the caller left off in an item on any device, and how much of it they have played
+// @Tags progress
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaProgress
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/progress [get]
+func GetProgress(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	progress, err := services.GetProgress(c.Request.Context(), viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
@@ -0,0 +1,286 @@
+// media-service/pkg/handlers/review_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List review queue
+// @ID listReviewQueue
+// @Description List the versions submitted for review and not yet approved or rejected, those waiting longest first. Only reviewers may do this.
+// @Tags review
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} api.MediaVersionList
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /reviews [get]
+func ListReviewQueue(c *gin.Context) {
+	versions, err := services.ListReviewQueue(viewer(c))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.MediaVersionList{Versions: versions})
+}
+
+// @Summary List versions
+// @ID listMediaVersions
+// @Description List the versions of an item's catalog entry, newest first. Only its editors and reviewers may do this.
+// @Tags review
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaVersionList
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/versions [get]
+func ListMediaVersions(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	versions, err := services.ListMediaVersions(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, api.MediaVersionList{Versions: versions})
+}
+
+// @Summary Get version
+// @ID getMediaVersion
+// @Description Get one version of an item's catalog entry with its review comments
+// @Tags review
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param number path int true "Version number"
+// @Success 200 {object} api.MediaVersion
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/versions/{number} [get]
+func GetMediaVersion(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	number, err := versionNumber(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	version, err := services.GetMediaVersion(viewer(c), id, number)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// @Summary Comment on version
+// @ID addReviewComment
+// @Description Leave a comment on a version without moving it through review
+// @Tags review
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param number path int true "Version number"
+// @Param data body api.ReviewCommentRequest true "Comment"
+// @Success 201 {object} api.ReviewComment
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Router /{id}/versions/{number}/comments [post]
+func AddReviewComment(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	number, err := versionNumber(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.ReviewCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apperror.RespondBinding(c, err)
+		return
+	}
+
+	comment, err := services.AddReviewComment(viewer(c), id, number, req.Body)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// @Summary Submit for review
+// @ID submitMedia
+// @Description Submit the item's draft version, or a rejected one after rework, for review. Reviewers are told by mail. Only the item's editors may do this.
+// @Tags review
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.ReviewRequest false "Note to the reviewers"
+// @Success 200 {object} api.MediaVersion
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/submit [post]
+func SubmitMedia(c *gin.Context) {
+	reviewAction(c, services.SubmitMedia)
+}
+
+// @Summary Start review
+// @ID startReview
+// @Description Take up a submitted version, marking it as in review. Only reviewers other than its author may do this.
+// @Tags review
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaVersion
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/review [post]
+func StartReview(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	version, err := services.StartReview(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// @Summary Approve
+// @ID approveMedia
+// @Description Approve the version under review so it can be published. Its author is told by mail. Only reviewers other than its author may do this.
+// @Tags review
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.ReviewRequest false "Reviewer's comment"
+// @Success 200 {object} api.MediaVersion
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/approve [post]
+func ApproveMedia(c *gin.Context) {
+	reviewAction(c, services.ApproveMedia)
+}
+
+// @Summary Reject
+// @ID rejectMedia
+// @Description Send the version under review back to its author with the changes needed, which the comment must give. Its author is told by mail. Only reviewers other than its author may do this.
+// @Tags review
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param data body api.ReviewRequest true "Changes needed"
+// @Success 200 {object} api.MediaVersion
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/reject [post]
+func RejectMedia(c *gin.Context) {
+	reviewAction(c, services.RejectMedia)
+}
+
+// @Summary Publish
+// @ID publishMedia
+// @Description Put the approved version live in place of the one learners see now. Only the item's editors and reviewers other than the version's author may do this.
+// @Tags review
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Success 200 {object} api.MediaVersion
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/publish [post]
+func PublishMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	version, err := services.PublishMedia(viewer(c), id)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+// reviewAction runs a review step that takes an optional comment.
+func reviewAction(c *gin.Context, step func(services.Viewer, uint, string) (*api.MediaVersion, error)) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	var req api.ReviewRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apperror.RespondBinding(c, err)
+			return
+		}
+	}
+
+	version, err := step(viewer(c), id, req.Comment)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, version)
+}
+
+func versionNumber(c *gin.Context) (int, error) {
+	n, err := strconv.Atoi(c.Param("number"))
+	if err != nil || n <= 0 {
+		return 0, apperror.ErrNotFound.WithDetail("Version not found")
+	}
+	return n, nil
+}
@@ -0,0 +1,32 @@
+// media-service/pkg/handlers/scripture_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Parse scripture references
+// @ID parseScripture
+// @Description Read free-text Bible references, such as "Rom 8:28-30; 1 Cor. 13" or "Salmos 23", as canonical passages in English numbering. Book names and abbreviations are recognised in English, Spanish, French, Portuguese, German and Swahili.
+// @Tags media
+// @Produce json
+// @Security Bearer
+// @Param q query string true "References"
+// @Param versification query string false "Numbering of q: english (default), hebrew or vulgate"
+// @Success 200 {array} api.ScriptureReference
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Router /scripture/parse [get]
+func ParseScripture(c *gin.Context) {
+	refs, err := services.ParseScripture(c.Query("q"), c.Query("versification"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, refs)
+}
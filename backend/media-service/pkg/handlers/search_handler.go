@@ -0,0 +1,75 @@
+// media-service/pkg/handlers/search_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Search media
+// @ID searchMedia
+// @Description Search the titles, descriptions, speakers, series, tags, scripture references and published transcripts of items visible to the caller, with highlighted matches and facet counts. Filters may be repeated to match any of several values. A query that matches nothing is retried with misspelt words corrected.
+// @Tags search
+// @Produce json
+// @Security Bearer
+// @Param q query string false "Web search syntax: quoted phrases, OR and -exclusions; empty lists everything matching the filters"
+// @Param speaker query []string false "Exact speaker name" collectionFormat(multi)
+// @Param language query []string false "BCP 47 language tag" collectionFormat(multi)
+// @Param series query []string false "Exact series name" collectionFormat(multi)
+// @Param type query []string false "audio, video or document" collectionFormat(multi)
+// @Param duration query []string false "short (under 10 minutes), medium (10-30), long (30-60) or extended" collectionFormat(multi)
+// @Param sort query string false "relevance (default when q is given) or newest"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Hits per page"
+// @Success 200 {object} api.SearchResult
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 501 {object} api.Problem
+// @Router /search [get]
+func SearchMedia(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	result, err := services.SearchMedia(c.Request.Context(), viewer(c), services.SearchFilter{
+		Query:     c.Query("q"),
+		Speakers:  c.QueryArray("speaker"),
+		Languages: c.QueryArray("language"),
+		Series:    c.QueryArray("series"),
+		Types:     c.QueryArray("type"),
+		Durations: c.QueryArray("duration"),
+	}, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// @Summary Rebuild search index
+// @ID reindexSearch
+// @Description Queue every catalog item for indexing, e.g. after enabling search or changing its text configuration. Admin only.
+// @Tags search
+// @Produce json
+// @Security Bearer
+// @Success 202 {object} api.ReindexResult
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 501 {object} api.Problem
+// @Router /search/reindex [post]
+func ReindexSearch(c *gin.Context) {
+	queued, err := services.ReindexMedia()
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, api.ReindexResult{Queued: queued})
+}
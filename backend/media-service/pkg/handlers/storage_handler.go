@@ -0,0 +1,85 @@
+// media-service/pkg/handlers/storage_handler.go
+package handlers
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary List storage mismatches
+// @ID listStorageMismatches
+// @Description List what the last reconciliation of the blob store with the catalog found: objects the catalog points at that are missing, originals of the wrong size, and objects nothing points at. Admin only.
+// @Tags storage
+// @Produce json
+// @Security Bearer
+// @Param kind query string false "missing, size or orphaned"
+// @Param page query int false "Page number, from 1"
+// @Param page_size query int false "Mismatches per page"
+// @Success 200 {object} api.StorageMismatchList
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /storage/mismatches [get]
+func ListStorageMismatches(c *gin.Context) {
+	page, err := pageParams(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	kind := c.Query("kind")
+	switch kind {
+	case "", models.MismatchMissing, models.MismatchSize, models.MismatchOrphaned:
+	default:
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "kind", Code: "oneof", Message: "must be one of: missing, size, orphaned",
+		}))
+		return
+	}
+
+	mismatches, total, checkedAt, err := services.ListStorageMismatches(kind, page)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	list := api.StorageMismatchList{
+		Items:     make([]api.StorageMismatch, 0, len(mismatches)),
+		CheckedAt: checkedAt,
+		Page:      page.Page,
+		PageSize:  page.PageSize,
+		Total:     total,
+	}
+	for _, m := range mismatches {
+		list.Items = append(list.Items, api.StorageMismatch{
+			Kind:         m.Kind,
+			MediaID:      m.MediaID,
+			Key:          m.Key,
+			Size:         m.Size,
+			ExpectedSize: m.ExpectedSize,
+		})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// @Summary Reconcile storage
+// @ID reconcileStorage
+// @Description Queue a reconciliation of the blob store with the catalog now rather than at the next storage.lifecycle.interval. Admin only.
+// @Tags storage
+// @Security Bearer
+// @Success 202
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Router /storage/reconcile [post]
+func ReconcileStorage(c *gin.Context) {
+	if err := services.QueueReconciliation(); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,220 @@
+// media-service/pkg/handlers/stream_handler.go
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/services"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cap shared-cache lifetimes well below typical signed URL lifetimes
+const maxStreamCacheAge = 24 * time.Hour
+
+// @Summary Get playback URLs
+// @ID getPlayback
+// @Description Issue signed, expiring URLs for the original file, the HLS stream and audio downloads, with the estimated data cost of each rendition. They are bound to the caller and need no bearer token. The HLS stream offers every published dub and caption track, and starts in the preferred language where the item has audio in it, otherwise in the original with captions in that language if there are any.
+// @Tags streaming
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param quality query string false "auto (default) or datasaver"
+// @Param language query string false "Preferred BCP 47 language, instead of the one in the caller's profile"
+// @Success 200 {object} api.Playback
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/playback [get]
+func GetPlayback(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	quality, err := services.ParseQuality(c.Query("quality"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	v, err := playbackViewer(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	playback, err := services.Playback(c.Request.Context(), v, id, quality)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, playback)
+}
+
+// @Summary Stream media
+// @ID streamMedia
+// @Description Redirect to a signed URL for the original file, or with quality=datasaver to the data-saver HLS playlist
+// @Tags streaming
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param quality query string false "auto (default) or datasaver"
+// @Param language query string false "Preferred BCP 47 language for the HLS playlist, instead of the one in the caller's profile"
+// @Success 302
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /stream/{id} [get]
+func StreamMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	quality, err := services.ParseQuality(c.Query("quality"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	v, err := playbackViewer(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	playback, err := services.Playback(c.Request.Context(), v, id, quality)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	target := playback.SourceURL
+	if quality == api.QualityDataSaver {
+		target = playback.HLSURL
+	}
+	if target == "" {
+		apperror.Respond(c, apperror.ErrNotReady.WithDetail("Data-saver renditions are not ready yet"))
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, target)
+}
+
+// @Summary Download media
+// @ID downloadMedia
+// @Description Redirect to a signed download URL for the original file, which may be a presigned storage URL, or with quality=datasaver to a small audio-only file
+// @Tags streaming
+// @Security Bearer
+// @Param id path int true "Media ID"
+// @Param quality query string false "auto (default) or datasaver"
+// @Param format query string false "Data-saver audio format: m4a (default) or opus"
+// @Success 302
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /{id}/download [get]
+func DownloadMedia(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	quality, err := services.ParseQuality(c.Query("quality"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	format := c.Query("format")
+	if format != "" && format != "m4a" && format != "opus" {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "format", Code: "oneof", Message: "must be one of: m4a, opus",
+		}))
+		return
+	}
+
+	url, err := services.DownloadURL(c.Request.Context(), viewer(c), id, quality, format)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+// @Summary Fetch signed stream
+// @ID fetchStream
+// @Description Serve the original file ("source"), an HLS playlist or segment ("hls/..."), a dubbed audio track's playlist or segment ("audio/...") or an audio download ("downloads/...") through a signed URL from getPlayback. Supports Range and If-Range.
+// @Tags streaming
+// @Produce octet-stream
+// @Param id path int true "Media ID"
+// @Param token path string true "Signature from the playback URL"
+// @Param file path string true "source, hls/ followed by a playlist or segment path, audio/ followed by a dubbed track's, or downloads/ followed by a file name"
+// @Param language query string false "Preferred language a master playlist picks its default audio and captions for"
+// @Param download query bool false "Serve as an attachment"
+// @Param Range header string false "Byte range, e.g. bytes=0-1048575"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 416 {object} api.Problem
+// @Router /stream/{id}/{token}/{file} [get]
+func FetchStream(c *gin.Context) {
+	id, err := mediaID(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	file, err := services.OpenStream(c.Request.Context(), id, c.Param("token"), strings.TrimPrefix(c.Param("file"), "/"), c.Query("language"))
+	if err != nil {
+		c.Header("Cache-Control", "no-store")
+		apperror.Respond(c, err)
+		return
+	}
+	defer file.Object.Close()
+
+	// Stored objects never change, so caches may keep them until the
+	// signature expires
+	maxAge := time.Until(file.ExpiresAt)
+	if maxAge > maxStreamCacheAge {
+		maxAge = maxStreamCacheAge
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(maxAge.Seconds())))
+	c.Header("Content-Type", file.ContentType)
+	c.Header("ETag", file.ETag)
+	if c.Query("download") != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.DownloadName}))
+	}
+
+	// ServeContent handles Range, If-Range, If-None-Match and HEAD
+	http.ServeContent(c.Writer, c.Request, file.Name, file.ModTime, file.Object)
+}
+
+// playbackViewer is the caller, preferring the language asked for in the
+// query to the one in their profile.
+func playbackViewer(c *gin.Context) (services.Viewer, error) {
+	v := viewer(c)
+	if lang := c.Query("language"); lang != "" {
+		parsed, err := services.ParseCaptionLanguage(lang)
+		if err != nil {
+			return v, err
+		}
+		v.Language = parsed
+	}
+	return v, nil
+}
@@ -0,0 +1,237 @@
+// media-service/pkg/handlers/upload_handler.go
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/middleware"
+	"shepherdsfold/media-service/pkg/services"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const tusOffsetContentType = "application/offset+octet-stream"
+
+// @Summary Upload capabilities
+// @ID uploadOptions
+// @Description Report the supported tus version, extensions, checksum algorithms and maximum upload size
+// @Tags uploads
+// @Success 204
+// @Router /upload [options]
+func UploadOptions(c *gin.Context) {
+	algorithms := make([]string, 0, len(services.ChecksumAlgorithms))
+	for name := range services.ChecksumAlgorithms {
+		algorithms = append(algorithms, name)
+	}
+	sort.Strings(algorithms)
+
+	c.Header("Tus-Version", middleware.TusVersion)
+	c.Header("Tus-Extension", "creation,expiration,checksum,termination")
+	c.Header("Tus-Checksum-Algorithm", strings.Join(algorithms, ","))
+	if maxSize := config.Config.Uploads.MaxSize; maxSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(maxSize, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Create upload
+// @ID createUpload
+// @Description Start a tus resumable upload of a catalog item's source file. Upload-Metadata must carry media_id and may carry filename and filetype.
+// @Tags uploads
+// @Security Bearer
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param Upload-Length header int true "Total size in bytes"
+// @Param Upload-Metadata header string true "tus metadata, e.g. media_id MTI=,filename c2VybW9uLm1wNA=="
+// @Success 201
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 403 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 412 {object} api.Problem
+// @Failure 413 {object} api.Problem
+// @Router /upload [post]
+func CreateUpload(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "Upload-Length", Code: "required", Message: "must be a non-negative number of bytes",
+		}))
+		return
+	}
+	rawMetadata := c.GetHeader("Upload-Metadata")
+	metadata, ok := parseUploadMetadata(rawMetadata)
+	if !ok {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "Upload-Metadata", Code: "format", Message: "must be comma-separated keys with base64 values",
+		}))
+		return
+	}
+
+	upload, err := services.CreateUpload(viewer(c), length, metadata, rawMetadata)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// @Summary Upload status
+// @ID getUploadOffset
+// @Description Report how many bytes of the upload have been received
+// @Tags uploads
+// @Security Bearer
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param uploadID path string true "Upload ID"
+// @Success 200
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 410 {object} api.Problem
+// @Router /upload/{uploadID} [head]
+func GetUploadOffset(c *gin.Context) {
+	upload, err := services.GetUpload(viewer(c), c.Param("uploadID"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	if upload.CompletedAt == nil {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+}
+
+// @Summary Upload chunk
+// @ID patchUpload
+// @Description Append bytes at Upload-Offset. With Upload-Checksum the chunk is kept only if it verifies.
+// @Tags uploads
+// @Accept application/offset+octet-stream
+// @Security Bearer
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param Upload-Offset header int true "Offset the chunk starts at"
+// @Param Upload-Checksum header string false "Algorithm and base64 digest of the chunk, e.g. sha1 Kq5sNclPz7QV2+lfQIuc6R7oRu0="
+// @Param uploadID path string true "Upload ID"
+// @Success 204
+// @Failure 400 {object} api.Problem
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Failure 410 {object} api.Problem
+// @Failure 415 {object} api.Problem
+// @Failure 423 {object} api.Problem
+// @Failure 460 {object} api.Problem
+// @Router /upload/{uploadID} [patch]
+func PatchUpload(c *gin.Context) {
+	if c.ContentType() != tusOffsetContentType {
+		apperror.Respond(c, apperror.ErrUnsupportedMedia.WithDetail("Content-Type must be "+tusOffsetContentType))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		apperror.Respond(c, apperror.Validation(apperror.FieldError{
+			Field: "Upload-Offset", Code: "required", Message: "must be a non-negative number of bytes",
+		}))
+		return
+	}
+	checksum, err := parseUploadChecksum(c.GetHeader("Upload-Checksum"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	upload, err := services.AppendUpload(c.Request.Context(), viewer(c), c.Param("uploadID"), offset, c.Request.Body, checksum)
+	if upload != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		if upload.CompletedAt == nil {
+			c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		}
+	}
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary Cancel upload
+// @ID terminateUpload
+// @Description Discard an unfinished upload and the bytes received so far
+// @Tags uploads
+// @Security Bearer
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param uploadID path string true "Upload ID"
+// @Success 204
+// @Failure 401 {object} api.Problem
+// @Failure 404 {object} api.Problem
+// @Failure 409 {object} api.Problem
+// @Router /upload/{uploadID} [delete]
+func TerminateUpload(c *gin.Context) {
+	if err := services.TerminateUpload(viewer(c), c.Param("uploadID")); err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// parseUploadMetadata decodes "key base64value,key2 base64value2". Values
+// are optional.
+func parseUploadMetadata(header string) (map[string]string, bool) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, true
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		switch len(parts) {
+		case 1:
+			metadata[parts[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, false
+			}
+			metadata[parts[0]] = string(value)
+		default:
+			return nil, false
+		}
+	}
+	return metadata, true
+}
+
+// parseUploadChecksum decodes "algorithm base64digest"; an empty header
+// means no checksum.
+func parseUploadChecksum(header string) (*services.Checksum, error) {
+	if header == "" {
+		return nil, nil
+	}
+	parts := strings.Fields(header)
+	invalid := apperror.Validation(apperror.FieldError{
+		Field: "Upload-Checksum", Code: "format", Message: "must be a supported algorithm and a base64 digest",
+	})
+	if len(parts) != 2 {
+		return nil, invalid
+	}
+	if _, ok := services.ChecksumAlgorithms[parts[0]]; !ok {
+		return nil, invalid
+	}
+	sum, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, invalid
+	}
+	return &services.Checksum{Algorithm: parts[0], Sum: sum}, nil
+}
@@ -0,0 +1,346 @@
+// media-service/pkg/handlers/upload_handler_test.go
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/middleware"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/services"
+	"shepherdsfold/media-service/pkg/testenv"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   map[string]string
+		ok     bool
+	}{
+		{"empty", "", map[string]string{}, true},
+		{"blank", "  ", map[string]string{}, true},
+		{"values", "media_id MTI=,filename c2VybW9uLm1wNA==", map[string]string{"media_id": "12", "filename": "sermon.mp4"}, true},
+		{"key without value", "media_id MTI=,is_confidential", map[string]string{"media_id": "12", "is_confidential": ""}, true},
+		{"bad base64", "media_id not-base64!", nil, false},
+		{"too many fields", "media_id MTI= extra", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseUploadMetadata(tt.header)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if tt.ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUploadChecksum(t *testing.T) {
+	sum := sha1.Sum([]byte("chunk"))
+	encoded := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		header  string
+		want    *services.Checksum
+		invalid bool
+	}{
+		{"none", "", nil, false},
+		{"sha1", "sha1 " + encoded, &services.Checksum{Algorithm: "sha1", Sum: sum[:]}, false},
+		{"unsupported algorithm", "crc32 " + encoded, nil, true},
+		{"missing digest", "sha1", nil, true},
+		{"bad base64", "sha1 ***", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseUploadChecksum(tt.header)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("err = %v, want invalid %v", err, tt.invalid)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// tusServer serves the upload routes as cmd/main.go does.
+func tusServer(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	testenv.Setup(t)
+
+	r := gin.New()
+	upload := r.Group("/api/media/upload", middleware.TusResumable())
+	upload.OPTIONS("", UploadOptions)
+	authed := upload.Group("", middleware.AuthRequired())
+	authed.POST("", CreateUpload)
+	authed.HEAD("/:uploadID", GetUploadOffset)
+	authed.PATCH("/:uploadID", PatchUpload)
+	authed.DELETE("/:uploadID", TerminateUpload)
+	return r
+}
+
+// tusRequest sends a tus request as the given bearer token.
+func tusRequest(r http.Handler, method, path, token string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", middleware.TusVersion)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	if method == http.MethodPatch {
+		req.Header.Set("Content-Type", tusOffsetContentType)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func createTestMedia(t *testing.T, ownerID uint) *models.MediaItem {
+	t.Helper()
+	item := &models.MediaItem{Title: "Sermon on the Mount", Type: models.MediaTypeVideo, OwnerID: ownerID}
+	if err := config.DB.Create(item).Error; err != nil {
+		t.Fatalf("create media: %v", err)
+	}
+	return item
+}
+
+func uploadMetadata(mediaID uint) string {
+	return "media_id " + base64.StdEncoding.EncodeToString([]byte(strconv.FormatUint(uint64(mediaID), 10))) +
+		",filename " + base64.StdEncoding.EncodeToString([]byte("sermon.mp4")) +
+		",filetype " + base64.StdEncoding.EncodeToString([]byte("video/mp4"))
+}
+
+// startUpload creates an upload of length bytes and returns its URL.
+func startUpload(t *testing.T, r http.Handler, token string, mediaID uint, length int) string {
+	t.Helper()
+	w := tusRequest(r, http.MethodPost, "/api/media/upload", token, nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": uploadMetadata(mediaID),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	location := w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/api/media/upload/") || w.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("create: Location %q, Upload-Expires %q", location, w.Header().Get("Upload-Expires"))
+	}
+	return location
+}
+
+func TestTusUploadFlow(t *testing.T) {
+	r := tusServer(t)
+	trainer := testenv.Token(t, 7, models.RoleTrainer)
+	item := createTestMedia(t, 7)
+	content := bytes.Repeat([]byte("sermon audio "), 100)
+
+	w := tusRequest(r, http.MethodOptions, "/api/media/upload", "", nil, nil)
+	if w.Code != http.StatusNoContent || !strings.Contains(w.Header().Get("Tus-Extension"), "checksum") {
+		t.Fatalf("options: status %d, Tus-Extension %q", w.Code, w.Header().Get("Tus-Extension"))
+	}
+
+	location := startUpload(t, r, trainer, item.ID, len(content))
+
+	w = tusRequest(r, http.MethodHead, location, trainer, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "0" ||
+		w.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("head: status %d, offset %q, length %q", w.Code, w.Header().Get("Upload-Offset"), w.Header().Get("Upload-Length"))
+	}
+
+	// First chunk with a checksum, the rest without
+	first := content[:500]
+	sum := sha1.Sum(first)
+	w = tusRequest(r, http.MethodPatch, location, trainer, first, map[string]string{
+		"Upload-Offset":   "0",
+		"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:]),
+	})
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "500" {
+		t.Fatalf("patch 1: status %d, offset %q: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+
+	w = tusRequest(r, http.MethodHead, location, trainer, nil, nil)
+	if got := w.Header().Get("Upload-Offset"); got != "500" {
+		t.Fatalf("head after patch 1: offset %q", got)
+	}
+
+	w = tusRequest(r, http.MethodPatch, location, trainer, content[500:], map[string]string{"Upload-Offset": "500"})
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(len(content)) {
+		t.Fatalf("patch 2: status %d, offset %q: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+	if w.Header().Get("Upload-Expires") != "" {
+		t.Error("finished upload still reports Upload-Expires")
+	}
+
+	// Finished: stored, pointed at by the item and queued for processing
+	var stored models.MediaItem
+	if err := config.DB.First(&stored, item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.SourceKey == "" || stored.SourceSize != int64(len(content)) ||
+		stored.SourceContentType != "video/mp4" || stored.ProcessingStatus != models.ProcessingQueued {
+		t.Fatalf("item after upload: key %q size %d type %q status %q",
+			stored.SourceKey, stored.SourceSize, stored.SourceContentType, stored.ProcessingStatus)
+	}
+	obj, err := config.Storage.Open(t.Context(), stored.SourceKey)
+	if err != nil {
+		t.Fatalf("open stored source: %v", err)
+	}
+	defer obj.Close()
+	var got bytes.Buffer
+	if _, err := got.ReadFrom(obj); err != nil || !bytes.Equal(got.Bytes(), content) {
+		t.Fatalf("stored source differs from what was uploaded (err %v)", err)
+	}
+
+	var jobs int64
+	config.DB.Model(&models.ProcessingJob{}).Where("kind = ? AND media_id = ?", services.JobProcessMedia, item.ID).Count(&jobs)
+	if jobs != 1 {
+		t.Errorf("%d processing jobs queued, want 1", jobs)
+	}
+	id := filepath.Base(location)
+	if _, err := os.Stat(filepath.Join(config.Config.Uploads.StagingDir, id)); !os.IsNotExist(err) {
+		t.Errorf("staging file left behind: %v", err)
+	}
+
+	w = tusRequest(r, http.MethodHead, location, trainer, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(len(content)) {
+		t.Errorf("head after finish: status %d, offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	w = tusRequest(r, http.MethodDelete, location, trainer, nil, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("terminating a finished upload: status %d, want 409", w.Code)
+	}
+}
+
+func TestTusUploadErrors(t *testing.T) {
+	r := tusServer(t)
+	owner := testenv.Token(t, 7, models.RoleTrainer)
+	other := testenv.Token(t, 8, models.RoleTrainer)
+	learner := testenv.Token(t, 9, "user")
+	item := createTestMedia(t, 7)
+	location := startUpload(t, r, owner, item.ID, 100)
+
+	t.Run("protocol version", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodHead, location, nil)
+		req.Header.Set("Authorization", owner)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Errorf("status %d, want 412", w.Code)
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			token  string
+			length string
+			meta   string
+			want   int
+		}{
+			{"no token", "", "100", uploadMetadata(item.ID), http.StatusUnauthorized},
+			{"learner", learner, "100", uploadMetadata(item.ID), http.StatusForbidden},
+			{"someone else's private item", other, "100", uploadMetadata(item.ID), http.StatusNotFound},
+			{"no media_id", owner, "100", "", http.StatusBadRequest},
+			{"no length", owner, "", uploadMetadata(item.ID), http.StatusBadRequest},
+			{"too large", owner, strconv.FormatInt(config.Config.Uploads.MaxSize+1, 10), uploadMetadata(item.ID), http.StatusRequestEntityTooLarge},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := tusRequest(r, http.MethodPost, "/api/media/upload", tt.token, nil, map[string]string{
+					"Upload-Length":   tt.length,
+					"Upload-Metadata": tt.meta,
+				})
+				if w.Code != tt.want {
+					t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+				}
+			})
+		}
+	})
+
+	t.Run("someone else's upload", func(t *testing.T) {
+		for _, method := range []string{http.MethodHead, http.MethodPatch, http.MethodDelete} {
+			w := tusRequest(r, method, location, other, []byte("x"), map[string]string{"Upload-Offset": "0"})
+			if w.Code != http.StatusNotFound {
+				t.Errorf("%s: status %d, want 404", method, w.Code)
+			}
+		}
+	})
+
+	t.Run("unknown upload", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPatch, "/api/media/upload/0123456789abcdef", owner, []byte("x"), map[string]string{"Upload-Offset": "0"})
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status %d, want 404", w.Code)
+		}
+	})
+
+	t.Run("offset mismatch", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPatch, location, owner, []byte("abc"), map[string]string{"Upload-Offset": "10"})
+		if w.Code != http.StatusConflict {
+			t.Errorf("status %d, want 409", w.Code)
+		}
+	})
+
+	t.Run("wrong content type", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPatch, location, owner, []byte("abc"), map[string]string{
+			"Upload-Offset": "0",
+			"Content-Type":  "application/octet-stream",
+		})
+		if w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("status %d, want 415", w.Code)
+		}
+	})
+
+	t.Run("checksum mismatch discards the chunk", func(t *testing.T) {
+		sum := sha1.Sum([]byte("something else"))
+		w := tusRequest(r, http.MethodPatch, location, owner, []byte("abc"), map[string]string{
+			"Upload-Offset":   "0",
+			"Upload-Checksum": "sha1 " + base64.StdEncoding.EncodeToString(sum[:]),
+		})
+		if w.Code != 460 {
+			t.Errorf("status %d, want 460", w.Code)
+		}
+		w = tusRequest(r, http.MethodHead, location, owner, nil, nil)
+		if got := w.Header().Get("Upload-Offset"); got != "0" {
+			t.Errorf("offset %q after a bad chunk, want 0", got)
+		}
+	})
+
+	t.Run("chunk past the length", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPatch, location, owner, bytes.Repeat([]byte("x"), 101), map[string]string{"Upload-Offset": "0"})
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("status %d, want 413", w.Code)
+		}
+		w = tusRequest(r, http.MethodHead, location, owner, nil, nil)
+		if got := w.Header().Get("Upload-Offset"); got != "0" {
+			t.Errorf("offset %q after an oversized chunk, want 0", got)
+		}
+	})
+
+	t.Run("terminate", func(t *testing.T) {
+		w := tusRequest(r, http.MethodDelete, location, owner, nil, nil)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status %d, want 204", w.Code)
+		}
+		w = tusRequest(r, http.MethodHead, location, owner, nil, nil)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("head after terminate: status %d, want 404", w.Code)
+		}
+	})
+}
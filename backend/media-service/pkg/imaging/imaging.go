@@ -0,0 +1,149 @@
+// media-service/pkg/imaging/imaging.go
+//
+// Package imaging decodes, resizes and tiles the still images shown for
+// media items: posters, uploaded thumbnails and scrubbing sprites.
+package imaging
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+)
+
+// Size is a named output width; height follows the aspect ratio.
+type Size struct {
+	Name  string
+	Width int
+}
+
+// DefaultSizes cover list thumbnails, cards and full-width posters.
+var DefaultSizes = []Size{
+	{Name: "small", Width: 320},
+	{Name: "medium", Width: 640},
+	{Name: "large", Width: 1280},
+}
+
+const jpegQuality = 82
+
+var (
+	ErrUnsupportedFormat = errors.New("imaging: not a JPEG, PNG or GIF image")
+	ErrTooLarge          = errors.New("imaging: image dimensions are too large")
+)
+
+// Decode reads a JPEG, PNG or GIF image, refusing anything over maxPixels
+// before decoding it so a small file cannot expand into gigabytes.
+func Decode(r io.ReadSeeker, maxPixels int) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupportedFormat
+		}
+		return nil, err
+	}
+	if maxPixels > 0 && cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// DecodeFile decodes the image at path.
+func DecodeFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f, 0)
+}
+
+// Resize scales img to width, keeping its aspect ratio. Images already
+// that narrow are returned as they are rather than upscaled.
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if width <= 0 || b.Dx() <= width {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// WriteJPEG encodes img to path, flattening any transparency onto white.
+func WriteJPEG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := jpeg.Encode(w, flatten(img), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteSizes writes img into dir once per size as "<base><size>.jpg".
+func WriteSizes(img image.Image, dir, base string, sizes []Size) error {
+	for _, s := range sizes {
+		if err := WriteJPEG(filepath.Join(dir, SizeFile(base, s.Name)), Resize(img, s.Width)); err != nil {
+			return fmt.Errorf("write %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// SizeFile is the file name WriteSizes uses for one size.
+func SizeFile(base, size string) string {
+	return base + size + ".jpg"
+}
+
+// Tile lays frames out left to right, top to bottom in a grid columns wide.
+// Every frame is drawn in a cell the size of the first.
+func Tile(frames []image.Image, columns int) image.Image {
+	if len(frames) == 0 || columns <= 0 {
+		return image.NewRGBA(image.Rect(0, 0, 0, 0))
+	}
+	cell := frames[0].Bounds().Size()
+	if len(frames) < columns {
+		columns = len(frames)
+	}
+	rows := (len(frames) + columns - 1) / columns
+	sheet := image.NewRGBA(image.Rect(0, 0, cell.X*columns, cell.Y*rows))
+	for i, f := range frames {
+		x, y := i%columns*cell.X, i/columns*cell.Y
+		draw.ApproxBiLinear.Scale(sheet, image.Rect(x, y, x+cell.X, y+cell.Y), f, f.Bounds(), draw.Src, nil)
+	}
+	return sheet
+}
+
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
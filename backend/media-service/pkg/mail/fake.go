@@ -0,0 +1,33 @@
+// media-service/pkg/mail/fake.go
+package mail
+
+import (
+	"context"
+	"sync"
+)
+
+// FakeMailer keeps messages instead of sending them, for development and
+// tests. If Err is set, Send fails with it.
+type FakeMailer struct {
+	Err error
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *FakeMailer) Send(ctx context.Context, msg Message) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns the messages sent so far.
+func (m *FakeMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
@@ -0,0 +1,125 @@
+// media-service/pkg/mail/mail.go
+//
+// Package mail sends notification emails, including iTIP calendar
+// invitations, through a pluggable Mailer.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// Message is one email to one recipient.
+type Message struct {
+	To      string `json:"to"`
+	ToName  string `json:"to_name,omitempty"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	// An iCalendar object sent as the text/calendar alternative, so mail
+	// clients offer to add or update the event; CalendarMethod is its
+	// METHOD, e.g. REQUEST or CANCEL
+	Calendar       []byte `json:"calendar,omitempty"`
+	CalendarMethod string `json:"calendar_method,omitempty"`
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// SMTPMailer sends through an SMTP relay, with PLAIN auth when a username
+// is set.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	FromName string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	body, err := m.compose(msg)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	addr := m.Host + ":" + strconv.Itoa(m.Port)
+	if err := smtp.SendMail(addr, auth, m.From, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// compose builds a multipart/alternative message with the plain text and,
+// if there is one, the calendar.
+func (m *SMTPMailer) compose(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	header := textproto.MIMEHeader{}
+	header.Set("From", (&mail.Address{Name: m.FromName, Address: m.From}).String())
+	header.Set("To", (&mail.Address{Name: msg.ToName, Address: msg.To}).String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("MIME-Version", "1.0")
+	header.Set("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	var out bytes.Buffer
+	for _, name := range []string{"From", "To", "Subject", "Date", "MIME-Version", "Content-Type"} {
+		fmt.Fprintf(&out, "%s: %s\r\n", name, header.Get(name))
+	}
+	out.WriteString("\r\n")
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	qp := quotedprintable.NewWriter(text)
+	if _, err := qp.Write([]byte(msg.Text)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+
+	if len(msg.Calendar) > 0 {
+		cal, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {fmt.Sprintf("text/calendar; charset=utf-8; method=%s", msg.CalendarMethod)},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(msg.Calendar)
+		for len(encoded) > 76 {
+			cal.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		cal.Write([]byte(encoded + "\r\n"))
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,70 @@
+// media-service/pkg/middleware/auth.go
+package middleware
+
+import (
+	"fmt"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"slices"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// AuthRequired validates the bearer access token issued by auth-service and
+// stores the caller in the context as "userID" and "role", and their
+// preferred language, if their profile has one, as "language". Cohort
+// membership is looked up where an access rule needs it.
+func AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		raw := strings.TrimPrefix(header, "Bearer ")
+		if header == "" || raw == header {
+			apperror.Respond(c, apperror.ErrUnauthorized)
+			return
+		}
+
+		token, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+			}
+			return []byte(config.Config.JWT.Secret), nil
+		})
+		if err != nil || !token.Valid {
+			apperror.Respond(c, apperror.ErrUnauthorized.WithDetail("Invalid or expired access token").Wrap(err))
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			apperror.Respond(c, apperror.ErrUnauthorized)
+			return
+		}
+		// Refresh tokens carry no role and must not authorize API calls
+		role, hasRole := claims["role"].(string)
+		userID, hasUser := claims["user_id"].(float64)
+		if !hasRole || !hasUser || userID <= 0 {
+			apperror.Respond(c, apperror.ErrUnauthorized.WithDetail("Invalid access token"))
+			return
+		}
+
+		c.Set("userID", uint(userID))
+		c.Set("role", role)
+		language, _ := claims["language"].(string)
+		c.Set("language", language)
+		c.Next()
+	}
+}
+
+// RequireRole rejects callers whose role is not one of roles. It must run
+// after AuthRequired.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, c.GetString("role")) {
+			apperror.Respond(c, apperror.ErrForbidden)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,30 @@
+// media-service/pkg/middleware/tus.go
+package middleware
+
+import (
+	"net/http"
+	"shepherdsfold/media-service/pkg/apperror"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	TusVersion = "1.0.0"
+
+	TusResumableHeader = "Tus-Resumable"
+)
+
+// TusResumable marks every response as speaking tus 1.0.0 and rejects
+// requests for any other protocol version. OPTIONS is exempt so clients
+// can discover what we support.
+func TusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(TusResumableHeader, TusVersion)
+		if c.Request.Method != http.MethodOptions && c.GetHeader(TusResumableHeader) != TusVersion {
+			c.Header("Tus-Version", TusVersion)
+			apperror.Respond(c, apperror.ErrUnsupportedTus)
+			return
+		}
+		c.Next()
+	}
+}
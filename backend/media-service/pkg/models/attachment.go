@@ -0,0 +1,59 @@
+// media-service/pkg/models/attachment.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// Virus scan states of an attachment. Only clean and skipped ones can
+	// be downloaded.
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	// Scanning kept failing
+	ScanFailed = "failed"
+	// No scanner is configured
+	ScanSkipped = "skipped"
+
+	// Preview states of an attachment
+	PreviewPending = "pending"
+	PreviewReady   = "ready"
+	// No tool on the server reads the format, or previews are off
+	PreviewUnavailable = "unavailable"
+	PreviewFailed      = "failed"
+)
+
+// Attachment is a handout, slide deck or other document that goes with a
+// catalog item or a collection such as a course module. Exactly one of
+// MediaID and CollectionID is set.
+type Attachment struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    gorm.DeletedAt `gorm:"index"`
+	MediaID      *uint          `gorm:"index"`
+	CollectionID *uint          `gorm:"index"`
+	Title        string         `gorm:"not null"`
+	FileName     string         `gorm:"not null"`
+	ContentType  string         `gorm:"not null"`
+	Size         int64          `gorm:"not null"`
+	SHA256       string         `gorm:"size:64"`
+	// Storage key of the file; emptied when an infected file is removed
+	Key           string
+	ScanStatus    string `gorm:"size:16;not null;default:'pending';index"`
+	ScanSignature string
+	ScannedAt     *time.Time
+	PreviewStatus string `gorm:"size:16;not null;default:'pending'"`
+	// 0 if unknown
+	PageCount int
+	// Storage prefix holding thumbnails of the first PreviewPages pages,
+	// as 1.jpg, 2.jpg...
+	PreviewPrefix string
+	PreviewPages  int
+	// Extracted for search
+	Text      string `gorm:"type:text"`
+	CreatedBy uint
+}
@@ -0,0 +1,28 @@
+// media-service/pkg/models/audio_track.go
+package models
+
+import "time"
+
+// AudioTrack is a dubbed or alternate-language recording of an item's
+// audio, offered in its master playlists alongside the original. Status
+// takes the item's Processing states.
+type AudioTrack struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MediaID   uint   `gorm:"not null;uniqueIndex:idx_audio_tracks_media_language"`
+	Language  string `gorm:"size:35;not null;uniqueIndex:idx_audio_tracks_media_language"`
+	Label     string `gorm:"size:100"`
+	// Drafts are only offered to editors until they are reviewed
+	Published bool `gorm:"not null;default:false"`
+	// Storage key of the uploaded recording
+	SourceKey         string `gorm:"not null"`
+	SourceSize        int64  `gorm:"not null"`
+	SourceContentType string
+	Status            string `gorm:"size:16;not null;default:'queued'"`
+	Error             string `gorm:"type:text"`
+	// Storage prefix holding a variant playlist for each of Renditions
+	HLSPrefix  string
+	Renditions StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	CreatedBy  uint
+}
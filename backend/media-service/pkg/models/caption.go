@@ -0,0 +1,34 @@
+// media-service/pkg/models/caption.go
+package models
+
+import "time"
+
+const (
+	// Where a caption track came from
+	CaptionSourceUpload = "upload"
+	CaptionSourceSpeech = "speech"
+)
+
+// CaptionTrack holds one language's captions for an item.
+type CaptionTrack struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MediaID   uint   `gorm:"not null;uniqueIndex:idx_caption_tracks_media_language"`
+	Language  string `gorm:"size:35;not null;uniqueIndex:idx_caption_tracks_media_language"`
+	Label     string `gorm:"size:100"`
+	Source    string `gorm:"size:16;not null"`
+	// Drafts are only shown to editors until they are reviewed
+	Published bool `gorm:"not null;default:false"`
+	CreatedBy uint
+}
+
+// CaptionCue is one timed line of a track. Its text is full-text indexed
+// for transcript search.
+type CaptionCue struct {
+	ID      uint   `gorm:"primarykey"`
+	TrackID uint   `gorm:"not null;index"`
+	StartMS int64  `gorm:"not null"`
+	EndMS   int64  `gorm:"not null"`
+	Text    string `gorm:"type:text;not null;index:idx_caption_cues_text,type:gin,expression:to_tsvector('simple'\\, text)"`
+}
@@ -0,0 +1,42 @@
+// media-service/pkg/models/collection.go
+package models
+
+import "time"
+
+const (
+	// Kinds of collection
+	CollectionSeries   = "series"
+	CollectionPlaylist = "playlist"
+	// A grouping such as a course whose sub-collections are its modules
+	CollectionGroup = "collection"
+)
+
+// Collection is an ordered set of catalog items, such as a sermon series,
+// a lecture course or a learner's playlist. Collections nest: a course
+// can hold a series per module.
+type Collection struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Kind        string `gorm:"size:16;not null;index"`
+	Title       string `gorm:"not null"`
+	Description string `gorm:"type:text"`
+	OwnerID     uint   `gorm:"not null;index"`
+	Visibility  string `gorm:"size:16;not null;default:'private';index"`
+	// A public collection stays hidden from everyone but its editors
+	// until then
+	PublishAt *time.Time `gorm:"index"`
+	ParentID  *uint      `gorm:"index"`
+	// Order among the parent's sub-collections
+	Position int `gorm:"not null;default:0"`
+}
+
+// CollectionItem places a catalog item in a collection.
+type CollectionItem struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	CollectionID uint `gorm:"not null;uniqueIndex:idx_collection_items_collection_media"`
+	MediaID      uint `gorm:"not null;uniqueIndex:idx_collection_items_collection_media;index"`
+	// 0-based and gapless within the collection
+	Position int `gorm:"not null"`
+}
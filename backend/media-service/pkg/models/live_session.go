@@ -0,0 +1,86 @@
+// media-service/pkg/models/live_session.go
+package models
+
+import "time"
+
+const (
+	// States of a live session
+	LiveScheduled = "scheduled"
+	LiveOnAir     = "live"
+	LiveEnded     = "ended"
+	LiveCancelled = "cancelled"
+)
+
+// LiveSession is a broadcast the host publishes to nginx-rtmp with its
+// stream key. A session with a recurrence rule is a series, such as a
+// weekly class, that keeps its key and playback name across occurrences.
+type LiveSession struct {
+	ID          uint `gorm:"primarykey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string `gorm:"not null"`
+	Description string `gorm:"type:text"`
+	HostID      uint   `gorm:"not null;index"`
+	// Group of trainees the session is for, e.g. "2026 spring elders"
+	Cohort string `gorm:"size:100;index"`
+	// Start of the first occurrence
+	ScheduledAt time.Time `gorm:"not null;index"`
+	// IANA zone occurrences keep their wall-clock time in
+	TimeZone        string `gorm:"size:64;not null;default:'UTC'"`
+	DurationMinutes int    `gorm:"not null;default:60"`
+	// RFC 5545 recurrence rule, e.g. FREQ=WEEKLY;BYDAY=TU; empty for a
+	// one-off session
+	RRule string `gorm:"column:rrule;size:200"`
+	// Start of the last occurrence; nil for a series without end
+	SeriesEndsAt *time.Time
+	// iCalendar SEQUENCE, bumped whenever invitees need an updated invite
+	Sequence   int    `gorm:"not null;default:0"`
+	Visibility string `gorm:"size:16;not null;default:'private'"`
+	Language   string `gorm:"size:35"`
+	// Secret the host's encoder publishes with
+	StreamKey string `gorm:"size:64;not null;uniqueIndex"`
+	// Name nginx-rtmp serves the stream under once published, so the key
+	// never appears in playback URLs
+	PlaybackName string `gorm:"size:32;not null;uniqueIndex"`
+	// Turn recordings into catalog items when the stream ends
+	Record    bool   `gorm:"not null;default:true"`
+	Status    string `gorm:"size:16;not null;default:'scheduled';index"`
+	StartedAt *time.Time
+	EndedAt   *time.Time
+	// nginx-rtmp client of the current publisher
+	PublisherClientID string `gorm:"size:32"`
+	PublisherAddr     string `gorm:"size:64"`
+	PeakViewers       int    `gorm:"not null;default:0"`
+	// Catalog items made from the session's recordings, in order
+	RecordingIDs IDList `gorm:"type:jsonb;not null;default:'[]'"`
+}
+
+// SessionInvitee is someone invited to a live session. Invitees with a
+// user ID may see a private session and find it in their calendar feed.
+type SessionInvitee struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	SessionID uint   `gorm:"not null;uniqueIndex:idx_session_invitees_session_email"`
+	Email     string `gorm:"size:254;not null;uniqueIndex:idx_session_invitees_session_email"`
+	Name      string `gorm:"size:200"`
+	// 0 for guests without an account
+	UserID uint `gorm:"not null;default:0;index"`
+}
+
+// SessionAttendance is one user's presence at one occurrence of a live
+// session, built from join and leave events and watch pings.
+type SessionAttendance struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	SessionID  uint      `gorm:"not null;uniqueIndex:idx_session_attendances_occurrence"`
+	Occurrence time.Time `gorm:"not null;uniqueIndex:idx_session_attendances_occurrence"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_session_attendances_occurrence;index"`
+	JoinedAt   time.Time `gorm:"not null"`
+	// Set while the user is away; cleared when they rejoin
+	LeftAt     *time.Time
+	LastSeenAt time.Time `gorm:"not null"`
+	// Time present, crediting gaps between pings up to
+	// live.attendance_gap
+	Seconds int `gorm:"not null;default:0"`
+}
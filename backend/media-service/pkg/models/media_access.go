@@ -0,0 +1,50 @@
+// media-service/pkg/models/media_access.go
+package models
+
+import "time"
+
+// MediaAccess limits who may see an item and when it unlocks for them, on
+// top of its visibility. Items without one are open to everyone who can
+// see them. Editors of the item are never limited.
+type MediaAccess struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MediaID   uint `gorm:"not null;uniqueIndex"`
+	// Callers with one of these roles or cohorts see the item; with both
+	// empty, everyone does
+	Roles   StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	Cohorts StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	// The course, a collection, callers must be enrolled in to see the item
+	CourseID *uint `gorm:"index"`
+	// Hidden from everyone but its editors after this time
+	AvailableUntil *time.Time
+	// Listed but locked until this time
+	AvailableFrom *time.Time
+	// Locked until this many days after the caller enrolled in the course
+	DripDays int `gorm:"not null;default:0"`
+	// Locked until the caller has completed the items before it in the
+	// course
+	RequirePrevious bool `gorm:"not null;default:false"`
+}
+
+// Enrollment admits a user to a course, a collection that items' access
+// rules can require.
+type Enrollment struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	CollectionID uint `gorm:"not null;uniqueIndex:idx_enrollments_collection_user"`
+	UserID       uint `gorm:"not null;uniqueIndex:idx_enrollments_collection_user;index"`
+	// Drip schedules count from here
+	EnrolledAt time.Time `gorm:"not null"`
+	ExpiresAt  *time.Time
+}
+
+// CohortMember puts a user in a cohort, a group that items' access rules
+// can name. Admins manage membership here; access tokens do not carry it.
+type CohortMember struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Cohort    string `gorm:"size:100;not null;uniqueIndex:idx_cohort_members_cohort_user"`
+	UserID    uint   `gorm:"not null;uniqueIndex:idx_cohort_members_cohort_user;index"`
+}
@@ -0,0 +1,34 @@
+// media-service/pkg/models/media_analytics.go
+package models
+
+import "time"
+
+// MediaDailyViewer is one user's viewing of an item on one UTC day, rolled
+// up from playback events. Reports by date and cohort read these rather
+// than the events.
+type MediaDailyViewer struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	MediaID   uint      `gorm:"not null;uniqueIndex:idx_media_daily_viewers_key,priority:1"`
+	Day       time.Time `gorm:"type:date;not null;uniqueIndex:idx_media_daily_viewers_key,priority:2;index"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_media_daily_viewers_key,priority:3"`
+	// Cohorts the user belonged to when they last played the item that day
+	Cohorts StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	// Times they started playing, after a pause longer than
+	// progress.max_gap
+	Plays int `gorm:"not null;default:0"`
+	// Time spent playing, whatever the speed
+	WatchSeconds float64 `gorm:"not null;default:0"`
+}
+
+// MediaCoverage is which seconds of an item a user has ever played, for
+// retention curves and the share of items watched.
+type MediaCoverage struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	MediaID   uint `gorm:"not null;uniqueIndex:idx_media_coverages_media_user"`
+	UserID    uint `gorm:"not null;uniqueIndex:idx_media_coverages_media_user"`
+	// One bit per second, most significant bit of the first byte first
+	Seconds        []byte
+	WatchedSeconds int `gorm:"not null;default:0"`
+}
@@ -0,0 +1,85 @@
+// media-service/pkg/models/media_item.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MediaTypeAudio    = "audio"
+	MediaTypeVideo    = "video"
+	MediaTypeDocument = "document"
+
+	// Processing states of an item's source file
+	ProcessingNone       = "none"
+	ProcessingQueued     = "queued"
+	ProcessingProcessing = "processing"
+	ProcessingFailed     = "failed"
+	ProcessingReady      = "ready"
+
+	// Where a custom poster came from
+	PosterUpload = "upload"
+	PosterFrame  = "frame"
+
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+
+	// Roles issued by auth-service
+	RoleAdmin   = "admin"
+	RoleTrainer = "trainer"
+)
+
+type MediaItem struct {
+	gorm.Model
+	Title           string     `gorm:"not null"`
+	Description     string     `gorm:"type:text"`
+	Type            string     `gorm:"size:16;not null;index"`
+	Speaker         string     `gorm:"index"`
+	Series          string     `gorm:"index"`
+	ScriptureRefs   StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	Tags            StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	Language        string     `gorm:"size:35;index"`
+	DurationSeconds int
+	Visibility      string `gorm:"size:16;not null;default:'private';index"`
+	// A public item stays hidden from everyone but its editors until then
+	PublishAt *time.Time `gorm:"index"`
+	// Until then the item is listed but cannot be played, downloaded or
+	// packaged for offline use, except by its editors
+	EmbargoUntil *time.Time
+	OwnerID      uint `gorm:"not null;index"`
+	// Storage key of the original upload, empty until one completes
+	SourceKey         string
+	SourceSize        int64
+	SourceContentType string
+	SourceSHA256      string `gorm:"size:64;index"`
+	ProcessingStatus  string `gorm:"size:16;not null;default:'none';index"`
+	ProcessingError   string `gorm:"type:text"`
+	// Storage prefix holding the HLS master playlists and variants, and the
+	// audio downloads below transcode.DownloadsDir
+	HLSPrefix  string
+	Renditions StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	// File names of the packaged audio-only downloads
+	Downloads StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	// Storage prefix of the generated poster candidates, scrubbing sprites
+	// and waveform
+	ImagesPrefix string
+	// Seconds into the item of each generated poster candidate
+	PosterTimes FloatList `gorm:"type:jsonb;not null;default:'[]'"`
+	// Which candidate is the poster, unless PosterPrefix is set
+	PosterIndex int `gorm:"not null;default:0"`
+	// Storage prefix of an uploaded thumbnail or a poster taken at a chosen
+	// time, in every imaging size
+	PosterPrefix string
+	// PosterUpload or PosterFrame when PosterPrefix is set
+	PosterSource string `gorm:"size:16"`
+	SpriteSheets int    `gorm:"not null;default:0"`
+	HasWaveform  bool   `gorm:"not null;default:false"`
+	// Review state of the newest MediaVersion. Items from before review
+	// was introduced count as published.
+	ReviewStatus string `gorm:"size:16;not null;default:'published';index"`
+	// Number of the MediaVersion learners see, or 0 if none has been
+	// published yet
+	LiveVersion int `gorm:"not null;default:0"`
+}
@@ -0,0 +1,59 @@
+// media-service/pkg/models/media_version.go
+package models
+
+import "time"
+
+// Review states of a MediaVersion. An item's ReviewStatus is that of its
+// newest version.
+const (
+	ReviewDraft     = "draft"
+	ReviewSubmitted = "submitted"
+	ReviewInReview  = "in_review"
+	ReviewApproved  = "approved"
+	ReviewRejected  = "rejected"
+	ReviewPublished = "published"
+	// Published once, then replaced by a later version
+	ReviewSuperseded = "superseded"
+)
+
+// MediaVersion is one revision of an item's catalog entry on its way
+// through review. Learners see the item as its last published version
+// left it; edits to a published item wait in a new version until that
+// is approved and published in turn.
+type MediaVersion struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	MediaID   uint   `gorm:"not null;uniqueIndex:idx_media_versions_media_number"`
+	Number    int    `gorm:"not null;uniqueIndex:idx_media_versions_media_number"`
+	Status    string `gorm:"size:16;not null;index"`
+	// The catalog fields as the version would publish them
+	Title         string `gorm:"not null"`
+	Description   string `gorm:"type:text"`
+	Type          string `gorm:"size:16;not null"`
+	Speaker       string
+	Series        string
+	ScriptureRefs StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	Tags          StringList `gorm:"type:jsonb;not null;default:'[]'"`
+	Language      string     `gorm:"size:35"`
+	// Who last edited the version, told by mail how its review went
+	AuthorID    uint `gorm:"not null"`
+	SubmittedAt *time.Time
+	ReviewerID  uint
+	ReviewedAt  *time.Time
+	PublishedAt *time.Time
+	PublishedBy uint
+}
+
+// ReviewComment is a remark on a version by its author or a reviewer.
+// Action is the review step it came with, such as ReviewRejected, or
+// empty for a comment on its own.
+type ReviewComment struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	MediaID   uint   `gorm:"not null;index"`
+	VersionID uint   `gorm:"not null;index"`
+	AuthorID  uint   `gorm:"not null"`
+	Action    string `gorm:"size:16"`
+	Body      string `gorm:"type:text;not null"`
+}
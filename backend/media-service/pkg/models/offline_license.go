@@ -0,0 +1,22 @@
+// media-service/pkg/models/offline_license.go
+package models
+
+import "time"
+
+// OfflineLicense grants one device offline playback of a set of items
+// until ExpiresAt. The app must renew it online before then.
+type OfflineLicense struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	DeviceID  string `gorm:"size:200;not null"`
+	MediaIDs  IDList `gorm:"type:jsonb;not null;default:'[]'"`
+	Quality   string `gorm:"size:16;not null"`
+	ExpiresAt time.Time
+	Renewals  int `gorm:"not null;default:0"`
+	RevokedAt *time.Time
+	// Why the license was revoked, e.g. "user", "admin", "access_lost" or
+	// "account_deleted"
+	RevokeReason string
+}
@@ -0,0 +1,27 @@
+// media-service/pkg/models/playback_progress.go
+package models
+
+import "time"
+
+// PlaybackProgress is where a user last was in an item, on any device, and
+// which parts of it they have played. Heartbeats land in Redis first;
+// rows trail them by up to progress.flush_interval.
+type PlaybackProgress struct {
+	ID              uint `gorm:"primarykey"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          uint    `gorm:"not null;uniqueIndex:idx_playback_progress_user_media"`
+	MediaID         uint    `gorm:"not null;uniqueIndex:idx_playback_progress_user_media;index"`
+	PositionSeconds float64 `gorm:"not null;default:0"`
+	DurationSeconds float64 `gorm:"not null;default:0"`
+	// Bitmap of played progress.bucket_seconds buckets, most significant
+	// bit of the first byte first
+	Watched          []byte
+	Rate             float64 `gorm:"not null;default:1"`
+	Rendition        string  `gorm:"size:32"`
+	DeviceID         string  `gorm:"size:200"`
+	BufferingEvents  int     `gorm:"not null;default:0"`
+	BufferingSeconds float64 `gorm:"not null;default:0"`
+	CompletedAt      *time.Time
+	LastPlayedAt     time.Time `gorm:"index"`
+}
@@ -0,0 +1,28 @@
+// media-service/pkg/models/processing_job.go
+package models
+
+import "time"
+
+const (
+	JobQueued     = "queued"
+	JobProcessing = "processing"
+	JobFailed     = "failed"
+	JobDone       = "done"
+)
+
+// ProcessingJob is a unit of background work on a media item, claimed by
+// workers with SELECT ... FOR UPDATE SKIP LOCKED.
+type ProcessingJob struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Kind       string    `gorm:"size:64;not null;index"`
+	MediaID    uint      `gorm:"index"`
+	Payload    string    `gorm:"type:jsonb;not null;default:'{}'"`
+	Status     string    `gorm:"size:16;not null;default:'queued';index"`
+	Attempts   int       `gorm:"not null;default:0"`
+	RunAfter   time.Time `gorm:"index"`
+	LockedAt   *time.Time
+	FinishedAt *time.Time
+	LastError  string `gorm:"type:text"`
+}
@@ -0,0 +1,12 @@
+// media-service/pkg/models/scripture_range.go
+package models
+
+// ScriptureRange is one passage an item's scripture references cover, as
+// scripture.Range keys in English numbering, so "everything touching
+// John 3" is a range overlap query.
+type ScriptureRange struct {
+	ID       uint `gorm:"primarykey"`
+	MediaID  uint `gorm:"not null;index"`
+	StartKey int  `gorm:"not null;index:idx_scripture_ranges_keys"`
+	EndKey   int  `gorm:"not null;index:idx_scripture_ranges_keys"`
+}
@@ -0,0 +1,29 @@
+// media-service/pkg/models/storage_mismatch.go
+package models
+
+import "time"
+
+// Kinds of storage mismatch
+const (
+	// The catalog points at an object that does not exist
+	MismatchMissing = "missing"
+	// The original's size differs from the one recorded at upload
+	MismatchSize = "size"
+	// An object nothing in the catalog points at
+	MismatchOrphaned = "orphaned"
+)
+
+// StorageMismatch is a disagreement between the catalog and the blob store
+// found by the last storage reconciliation.
+type StorageMismatch struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Kind      string `gorm:"size:16;not null;index"`
+	// 0 for content-addressed originals, which belong to no one item
+	MediaID uint   `gorm:"not null;default:0;index"`
+	Key     string `gorm:"not null"`
+	// Stored size, when the object exists
+	Size int64 `gorm:"not null;default:0"`
+	// Size the catalog expects, when it records one
+	ExpectedSize int64 `gorm:"not null;default:0"`
+}
@@ -0,0 +1,111 @@
+// media-service/pkg/models/string_list.go
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StringList is a []string stored as a jsonb array, so list fields such as
+// tags can be filtered with the @> containment operator.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+func (StringList) GormDataType() string {
+	return "jsonb"
+}
+
+// IDList is a []uint stored as a jsonb array.
+type IDList []uint
+
+func (l IDList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]uint(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (l *IDList) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into IDList", src)
+	}
+	return json.Unmarshal(data, (*[]uint)(l))
+}
+
+func (IDList) GormDataType() string {
+	return "jsonb"
+}
+
+// FloatList is a []float64 stored as a jsonb array.
+type FloatList []float64
+
+func (l FloatList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]float64(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (l *FloatList) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into FloatList", src)
+	}
+	return json.Unmarshal(data, (*[]float64)(l))
+}
+
+func (FloatList) GormDataType() string {
+	return "jsonb"
+}
@@ -0,0 +1,23 @@
+// media-service/pkg/models/upload.go
+package models
+
+import "time"
+
+// Upload tracks a tus resumable upload while its bytes arrive in the
+// staging directory.
+type Upload struct {
+	ID        string `gorm:"primaryKey;size:32"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	OwnerID   uint  `gorm:"not null;index"`
+	MediaID   uint  `gorm:"not null;index"`
+	Length    int64 `gorm:"not null"`
+	// "offset" is reserved in SQL
+	Offset      int64 `gorm:"column:upload_offset;not null;default:0"`
+	Filename    string
+	ContentType string
+	// Raw Upload-Metadata header, echoed back on HEAD
+	Metadata    string    `gorm:"type:text"`
+	ExpiresAt   time.Time `gorm:"index"`
+	CompletedAt *time.Time
+}
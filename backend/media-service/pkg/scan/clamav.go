@@ -0,0 +1,136 @@
+// media-service/pkg/scan/clamav.go
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunk is how much of a file goes in each INSTREAM chunk.
+const clamdChunk = 64 << 10
+
+// ClamdScanner streams files to a ClamAV daemon with the INSTREAM
+// command. Files larger than clamd's StreamMaxLength are refused by the
+// daemon, which Scan reports as an error rather than a verdict.
+type ClamdScanner struct {
+	// host:port, or the path of clamd's Unix socket
+	Address string
+	// Longest a scan may take, including connecting; 0 for no limit
+	// beyond ctx
+	Timeout time.Duration
+}
+
+// NewClamdScanner checks that clamd answers at address.
+func NewClamdScanner(ctx context.Context, address string, timeout time.Duration) (*ClamdScanner, error) {
+	if address == "" {
+		return nil, errors.New("no clamd address configured")
+	}
+	s := &ClamdScanner{Address: address, Timeout: timeout}
+	reply, err := s.command(ctx, "PING", nil)
+	if err != nil {
+		return nil, err
+	}
+	if reply != "PONG" {
+		return nil, fmt.Errorf("clamd: unexpected reply to PING: %q", reply)
+	}
+	return s, nil
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	reply, err := s.command(ctx, "INSTREAM", r)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return Result{Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd: %s", verdict)
+	}
+}
+
+// command sends a null-terminated clamd command, followed by body as
+// INSTREAM chunks if it is not nil, and returns the reply.
+func (s *ClamdScanner) command(ctx context.Context, name string, body io.Reader) (string, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	network := "tcp"
+	if strings.HasPrefix(s.Address, "/") {
+		network = "unix"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, s.Address)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := io.WriteString(conn, "z"+name+"\x00"); err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	if body != nil {
+		if err := writeChunks(conn, body); err != nil {
+			// clamd hangs up on streams over its size limit, after
+			// saying so
+			if reply, readErr := readReply(conn); readErr == nil && reply != "" {
+				return reply, nil
+			}
+			return "", fmt.Errorf("clamd: %w", err)
+		}
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	return reply, nil
+}
+
+// writeChunks sends r as length-prefixed chunks ending with an empty one.
+func writeChunks(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 4+clamdChunk)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(r).ReadString(0)
+	if err != nil && !(errors.Is(err, io.EOF) && reply != "") {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
@@ -0,0 +1,33 @@
+// media-service/pkg/scan/fake.go
+package scan
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EICAR is the industry-standard test string every scanner reports as
+// malware, for checking the quarantine path without real malware.
+const EICAR = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// FakeScanner reports files containing EICAR as infected and everything
+// else as clean, for tests and development machines without ClamAV.
+type FakeScanner struct {
+	// If set, Scan fails with this error
+	Err error
+}
+
+func (f *FakeScanner) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if f.Err != nil {
+		return Result{}, f.Err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Result{}, err
+	}
+	if bytes.Contains(data, []byte(EICAR)) {
+		return Result{Signature: "Eicar-Test-Signature"}, nil
+	}
+	return Result{Clean: true}, nil
+}
@@ -0,0 +1,22 @@
+// media-service/pkg/scan/scan.go
+//
+// Package scan checks uploaded files for malware before anyone else can
+// download them.
+package scan
+
+import (
+	"context"
+	"io"
+)
+
+// Result is a scanner's verdict on a file.
+type Result struct {
+	Clean bool
+	// Name of the signature that matched, when not clean
+	Signature string
+}
+
+// Scanner inspects the bytes of a file.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
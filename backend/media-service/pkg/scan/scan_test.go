@@ -0,0 +1,193 @@
+// media-service/pkg/scan/scan_test.go
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd answers the clamd commands ClamdScanner sends the way ClamAV
+// does: PING with PONG, and INSTREAM with a verdict on the EICAR string.
+type fakeClamd struct {
+	listener net.Listener
+	// Largest stream accepted, as clamd's StreamMaxLength; 0 for no limit
+	maxStream int
+	// Accept connections but never reply
+	hang bool
+}
+
+func startClamd(t *testing.T, clamd *fakeClamd) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clamd.listener = listener
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go clamd.serve(conn)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (c *fakeClamd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	if c.hang {
+		io.Copy(io.Discard, r)
+		return
+	}
+	switch strings.TrimSuffix(command, "\x00") {
+	case "zPING":
+		io.WriteString(conn, "PONG\x00")
+	case "zINSTREAM":
+		var data bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if c.maxStream > 0 && data.Len()+int(size) > c.maxStream {
+				io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+				return
+			}
+			if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+				return
+			}
+		}
+		if bytes.Contains(data.Bytes(), []byte(EICAR)) {
+			io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+		} else {
+			io.WriteString(conn, "stream: OK\x00")
+		}
+	default:
+		io.WriteString(conn, "UNKNOWN COMMAND\x00")
+	}
+}
+
+// closedAddress returns an address nothing listens on.
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
+
+func TestClamdScanner(t *testing.T) {
+	ctx := context.Background()
+	addr := startClamd(t, &fakeClamd{})
+	scanner, err := NewClamdScanner(ctx, addr, 5*time.Second)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+
+	// Spans several INSTREAM chunks, with EICAR across a chunk boundary
+	large := bytes.Repeat([]byte{'.'}, 3*clamdChunk)
+	infectedLarge := append(large[:clamdChunk-10:clamdChunk-10], []byte(EICAR+string(large))...)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		clean     bool
+		signature string
+	}{
+		{"empty", nil, true, ""},
+		{"clean", []byte("Notes on the Sermon on the Mount"), true, ""},
+		{"clean, several chunks", large, true, ""},
+		{"infected", []byte(EICAR), false, "Eicar-Test-Signature"},
+		{"infected, split across chunks", infectedLarge, false, "Eicar-Test-Signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := scanner.Scan(ctx, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			if result.Clean != tt.clean || result.Signature != tt.signature {
+				t.Errorf("got %+v, want clean %v signature %q", result, tt.clean, tt.signature)
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnavailable(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewClamdScanner(ctx, "", time.Second); err == nil {
+		t.Error("connected without an address")
+	}
+	down := closedAddress(t)
+	if _, err := NewClamdScanner(ctx, down, time.Second); err == nil {
+		t.Error("connected to a closed port")
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		timeout time.Duration
+	}{
+		{"not listening", down, time.Second},
+		{"no reply", startClamd(t, &fakeClamd{hang: true}), 200 * time.Millisecond},
+		{"stream too long", startClamd(t, &fakeClamd{maxStream: clamdChunk}), time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := &ClamdScanner{Address: tt.address, Timeout: tt.timeout}
+			result, err := scanner.Scan(ctx, bytes.NewReader(bytes.Repeat([]byte{'.'}, 2*clamdChunk)))
+			if err == nil {
+				t.Fatalf("got verdict %+v, want an error", result)
+			}
+			if result.Clean {
+				t.Error("an error reported the file clean")
+			}
+		})
+	}
+}
+
+func TestFakeScanner(t *testing.T) {
+	errDown := errors.New("scanner down")
+	tests := []struct {
+		name    string
+		scanner *FakeScanner
+		data    string
+		want    Result
+		err     error
+	}{
+		{"clean", &FakeScanner{}, "hymn sheet", Result{Clean: true}, nil},
+		{"infected", &FakeScanner{}, "prefix " + EICAR, Result{Signature: "Eicar-Test-Signature"}, nil},
+		{"unavailable", &FakeScanner{Err: errDown}, "hymn sheet", Result{}, errDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scanner.Scan(context.Background(), strings.NewReader(tt.data))
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("got %+v, err %v; want %+v, err %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
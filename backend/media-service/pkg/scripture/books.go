@@ -0,0 +1,325 @@
+// media-service/pkg/scripture/books.go
+package scripture
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Book is one of the 66 books of the Protestant canon. Number is its
+// position, from 1 for Genesis to 66 for Revelation.
+type Book struct {
+	Number int
+	// OSIS abbreviation, e.g. 1Cor
+	OSIS string
+	// English name used in canonical references
+	Name string
+	// Chapters in the English versification
+	Chapters int
+}
+
+// Books lists the canon in order; Books[n-1] is book n.
+var Books = []Book{
+	{1, "Gen", "Genesis", 50},
+	{2, "Exod", "Exodus", 40},
+	{3, "Lev", "Leviticus", 27},
+	{4, "Num", "Numbers", 36},
+	{5, "Deut", "Deuteronomy", 34},
+	{6, "Josh", "Joshua", 24},
+	{7, "Judg", "Judges", 21},
+	{8, "Ruth", "Ruth", 4},
+	{9, "1Sam", "1 Samuel", 31},
+	{10, "2Sam", "2 Samuel", 24},
+	{11, "1Kgs", "1 Kings", 22},
+	{12, "2Kgs", "2 Kings", 25},
+	{13, "1Chr", "1 Chronicles", 29},
+	{14, "2Chr", "2 Chronicles", 36},
+	{15, "Ezra", "Ezra", 10},
+	{16, "Neh", "Nehemiah", 13},
+	{17, "Esth", "Esther", 10},
+	{18, "Job", "Job", 42},
+	{19, "Ps", "Psalms", 150},
+	{20, "Prov", "Proverbs", 31},
+	{21, "Eccl", "Ecclesiastes", 12},
+	{22, "Song", "Song of Songs", 8},
+	{23, "Isa", "Isaiah", 66},
+	{24, "Jer", "Jeremiah", 52},
+	{25, "Lam", "Lamentations", 5},
+	{26, "Ezek", "Ezekiel", 48},
+	{27, "Dan", "Daniel", 12},
+	{28, "Hos", "Hosea", 14},
+	{29, "Joel", "Joel", 3},
+	{30, "Amos", "Amos", 9},
+	{31, "Obad", "Obadiah", 1},
+	{32, "Jonah", "Jonah", 4},
+	{33, "Mic", "Micah", 7},
+	{34, "Nah", "Nahum", 3},
+	{35, "Hab", "Habakkuk", 3},
+	{36, "Zeph", "Zephaniah", 3},
+	{37, "Hag", "Haggai", 2},
+	{38, "Zech", "Zechariah", 14},
+	{39, "Mal", "Malachi", 4},
+	{40, "Matt", "Matthew", 28},
+	{41, "Mark", "Mark", 16},
+	{42, "Luke", "Luke", 24},
+	{43, "John", "John", 21},
+	{44, "Acts", "Acts", 28},
+	{45, "Rom", "Romans", 16},
+	{46, "1Cor", "1 Corinthians", 16},
+	{47, "2Cor", "2 Corinthians", 13},
+	{48, "Gal", "Galatians", 6},
+	{49, "Eph", "Ephesians", 6},
+	{50, "Phil", "Philippians", 4},
+	{51, "Col", "Colossians", 4},
+	{52, "1Thess", "1 Thessalonians", 5},
+	{53, "2Thess", "2 Thessalonians", 3},
+	{54, "1Tim", "1 Timothy", 6},
+	{55, "2Tim", "2 Timothy", 4},
+	{56, "Titus", "Titus", 3},
+	{57, "Phlm", "Philemon", 1},
+	{58, "Heb", "Hebrews", 13},
+	{59, "Jas", "James", 5},
+	{60, "1Pet", "1 Peter", 5},
+	{61, "2Pet", "2 Peter", 3},
+	{62, "1John", "1 John", 5},
+	{63, "2John", "2 John", 1},
+	{64, "3John", "3 John", 1},
+	{65, "Jude", "Jude", 1},
+	{66, "Rev", "Revelation", 22},
+}
+
+// bookNames holds each book's full names, by language, in canon order.
+// Any unambiguous prefix of a name is accepted too.
+var bookNames = map[string][66]string{
+	"en": {
+		"Genesis", "Exodus", "Leviticus", "Numbers", "Deuteronomy", "Joshua", "Judges", "Ruth",
+		"1 Samuel", "2 Samuel", "1 Kings", "2 Kings", "1 Chronicles", "2 Chronicles", "Ezra",
+		"Nehemiah", "Esther", "Job", "Psalms", "Proverbs", "Ecclesiastes", "Song of Songs", "Isaiah",
+		"Jeremiah", "Lamentations", "Ezekiel", "Daniel", "Hosea", "Joel", "Amos", "Obadiah", "Jonah",
+		"Micah", "Nahum", "Habakkuk", "Zephaniah", "Haggai", "Zechariah", "Malachi",
+		"Matthew", "Mark", "Luke", "John", "Acts", "Romans", "1 Corinthians", "2 Corinthians",
+		"Galatians", "Ephesians", "Philippians", "Colossians", "1 Thessalonians", "2 Thessalonians",
+		"1 Timothy", "2 Timothy", "Titus", "Philemon", "Hebrews", "James", "1 Peter", "2 Peter",
+		"1 John", "2 John", "3 John", "Jude", "Revelation",
+	},
+	"es": {
+		"Génesis", "Éxodo", "Levítico", "Números", "Deuteronomio", "Josué", "Jueces", "Rut",
+		"1 Samuel", "2 Samuel", "1 Reyes", "2 Reyes", "1 Crónicas", "2 Crónicas", "Esdras",
+		"Nehemías", "Ester", "Job", "Salmos", "Proverbios", "Eclesiastés", "Cantares", "Isaías",
+		"Jeremías", "Lamentaciones", "Ezequiel", "Daniel", "Oseas", "Joel", "Amós", "Abdías", "Jonás",
+		"Miqueas", "Nahúm", "Habacuc", "Sofonías", "Hageo", "Zacarías", "Malaquías",
+		"Mateo", "Marcos", "Lucas", "Juan", "Hechos", "Romanos", "1 Corintios", "2 Corintios",
+		"Gálatas", "Efesios", "Filipenses", "Colosenses", "1 Tesalonicenses", "2 Tesalonicenses",
+		"1 Timoteo", "2 Timoteo", "Tito", "Filemón", "Hebreos", "Santiago", "1 Pedro", "2 Pedro",
+		"1 Juan", "2 Juan", "3 Juan", "Judas", "Apocalipsis",
+	},
+	"fr": {
+		"Genèse", "Exode", "Lévitique", "Nombres", "Deutéronome", "Josué", "Juges", "Ruth",
+		"1 Samuel", "2 Samuel", "1 Rois", "2 Rois", "1 Chroniques", "2 Chroniques", "Esdras",
+		"Néhémie", "Esther", "Job", "Psaumes", "Proverbes", "Ecclésiaste", "Cantique des cantiques",
+		"Ésaïe", "Jérémie", "Lamentations", "Ézéchiel", "Daniel", "Osée", "Joël", "Amos", "Abdias",
+		"Jonas", "Michée", "Nahum", "Habacuc", "Sophonie", "Aggée", "Zacharie", "Malachie",
+		"Matthieu", "Marc", "Luc", "Jean", "Actes", "Romains", "1 Corinthiens", "2 Corinthiens",
+		"Galates", "Éphésiens", "Philippiens", "Colossiens", "1 Thessaloniciens", "2 Thessaloniciens",
+		"1 Timothée", "2 Timothée", "Tite", "Philémon", "Hébreux", "Jacques", "1 Pierre", "2 Pierre",
+		"1 Jean", "2 Jean", "3 Jean", "Jude", "Apocalypse",
+	},
+	"pt": {
+		"Gênesis", "Êxodo", "Levítico", "Números", "Deuteronômio", "Josué", "Juízes", "Rute",
+		"1 Samuel", "2 Samuel", "1 Reis", "2 Reis", "1 Crônicas", "2 Crônicas", "Esdras",
+		"Neemias", "Ester", "Jó", "Salmos", "Provérbios", "Eclesiastes", "Cânticos", "Isaías",
+		"Jeremias", "Lamentações", "Ezequiel", "Daniel", "Oseias", "Joel", "Amós", "Obadias", "Jonas",
+		"Miqueias", "Naum", "Habacuque", "Sofonias", "Ageu", "Zacarias", "Malaquias",
+		"Mateus", "Marcos", "Lucas", "João", "Atos", "Romanos", "1 Coríntios", "2 Coríntios",
+		"Gálatas", "Efésios", "Filipenses", "Colossenses", "1 Tessalonicenses", "2 Tessalonicenses",
+		"1 Timóteo", "2 Timóteo", "Tito", "Filemom", "Hebreus", "Tiago", "1 Pedro", "2 Pedro",
+		"1 João", "2 João", "3 João", "Judas", "Apocalipse",
+	},
+	"de": {
+		"1 Mose", "2 Mose", "3 Mose", "4 Mose", "5 Mose", "Josua", "Richter", "Rut",
+		"1 Samuel", "2 Samuel", "1 Könige", "2 Könige", "1 Chronik", "2 Chronik", "Esra",
+		"Nehemia", "Ester", "Hiob", "Psalmen", "Sprüche", "Prediger", "Hoheslied", "Jesaja",
+		"Jeremia", "Klagelieder", "Hesekiel", "Daniel", "Hosea", "Joel", "Amos", "Obadja", "Jona",
+		"Micha", "Nahum", "Habakuk", "Zefanja", "Haggai", "Sacharja", "Maleachi",
+		"Matthäus", "Markus", "Lukas", "Johannes", "Apostelgeschichte", "Römer", "1 Korinther",
+		"2 Korinther", "Galater", "Epheser", "Philipper", "Kolosser", "1 Thessalonicher",
+		"2 Thessalonicher", "1 Timotheus", "2 Timotheus", "Titus", "Philemon", "Hebräer", "Jakobus",
+		"1 Petrus", "2 Petrus", "1 Johannes", "2 Johannes", "3 Johannes", "Judas", "Offenbarung",
+	},
+	"sw": {
+		"Mwanzo", "Kutoka", "Mambo ya Walawi", "Hesabu", "Kumbukumbu la Torati", "Yoshua", "Waamuzi",
+		"Ruthu", "1 Samweli", "2 Samweli", "1 Wafalme", "2 Wafalme", "1 Mambo ya Nyakati",
+		"2 Mambo ya Nyakati", "Ezra", "Nehemia", "Esta", "Ayubu", "Zaburi", "Mithali", "Mhubiri",
+		"Wimbo Ulio Bora", "Isaya", "Yeremia", "Maombolezo", "Ezekieli", "Danieli", "Hosea", "Yoeli",
+		"Amosi", "Obadia", "Yona", "Mika", "Nahumu", "Habakuki", "Sefania", "Hagai", "Zekaria", "Malaki",
+		"Mathayo", "Marko", "Luka", "Yohana", "Matendo ya Mitume", "Warumi", "1 Wakorintho",
+		"2 Wakorintho", "Wagalatia", "Waefeso", "Wafilipi", "Wakolosai", "1 Wathesalonike",
+		"2 Wathesalonike", "1 Timotheo", "2 Timotheo", "Tito", "Filemoni", "Waebrania", "Yakobo",
+		"1 Petro", "2 Petro", "1 Yohana", "2 Yohana", "3 Yohana", "Yuda", "Ufunuo",
+	},
+}
+
+// bookAbbreviations are short forms that are not prefixes of a full name,
+// or that would otherwise be ambiguous, by OSIS ID.
+var bookAbbreviations = map[string][]string{
+	"Gen":    {"Gn", "Ge"},
+	"Exod":   {"Ex", "Exo"},
+	"Lev":    {"Lv"},
+	"Num":    {"Nm", "Nb"},
+	"Deut":   {"Dt"},
+	"Josh":   {"Jos"},
+	"Judg":   {"Jdg", "Jg", "Jdgs"},
+	"Ruth":   {"Rth", "Ru"},
+	"1Sam":   {"1 Sm", "1 Sa"},
+	"2Sam":   {"2 Sm", "2 Sa"},
+	"1Kgs":   {"1 Kgs", "1 Kg", "1 Ki"},
+	"2Kgs":   {"2 Kgs", "2 Kg", "2 Ki"},
+	"1Chr":   {"1 Chr", "1 Ch"},
+	"2Chr":   {"2 Chr", "2 Ch"},
+	"Neh":    {"Ne"},
+	"Esth":   {"Est"},
+	"Job":    {"Jb"},
+	"Ps":     {"Ps", "Psa", "Pss", "Psalm", "Sal", "Sl"},
+	"Prov":   {"Pr", "Prv"},
+	"Eccl":   {"Ecc", "Eccl", "Qoh", "Qoheleth"},
+	"Song":   {"Song", "Song of Solomon", "SoS", "Cant", "Canticles"},
+	"Isa":    {"Is"},
+	"Jer":    {"Je", "Jr"},
+	"Lam":    {"La"},
+	"Ezek":   {"Ezk", "Eze"},
+	"Dan":    {"Dn"},
+	"Hos":    {"Ho"},
+	"Joel":   {"Jl"},
+	"Amos":   {"Am"},
+	"Obad":   {"Ob"},
+	"Jonah":  {"Jon", "Jnh"},
+	"Mic":    {"Mc"},
+	"Nah":    {"Na"},
+	"Hab":    {"Hb"},
+	"Zeph":   {"Zep", "Zp"},
+	"Hag":    {"Hg"},
+	"Zech":   {"Zec", "Zc"},
+	"Mal":    {"Ml"},
+	"Matt":   {"Mt"},
+	"Mark":   {"Mk", "Mrk", "Mr"},
+	"Luke":   {"Lk", "Lc"},
+	"John":   {"Jn", "Jhn", "Joh"},
+	"Acts":   {"Ac", "Hch", "Apg"},
+	"Rom":    {"Rm", "Ro"},
+	"1Cor":   {"1 Co"},
+	"2Cor":   {"2 Co"},
+	"Gal":    {"Ga"},
+	"Phil":   {"Phil", "Php", "Pp", "Flp"},
+	"Col":    {"Col"},
+	"1Thess": {"1 Th", "1 Ts"},
+	"2Thess": {"2 Th", "2 Ts"},
+	"1Tim":   {"1 Ti", "1 Tm"},
+	"2Tim":   {"2 Ti", "2 Tm"},
+	"Titus":  {"Tit"},
+	"Phlm":   {"Phlm", "Phm", "Philem", "Flm"},
+	"Heb":    {"Heb"},
+	"Jas":    {"Jas", "Jm", "Stg", "Jak"},
+	"1Pet":   {"1 Pt", "1 Pe"},
+	"2Pet":   {"2 Pt", "2 Pe"},
+	"1John":  {"1 Jn", "1 Jhn", "1 Jo"},
+	"2John":  {"2 Jn", "2 Jhn", "2 Jo"},
+	"3John":  {"3 Jn", "3 Jhn", "3 Jo"},
+	"Jude":   {"Jude", "Jd"},
+	"Rev":    {"Rev", "Re", "Rv", "Revelations", "Apocalypse", "Offb"},
+}
+
+var (
+	// Normalized full names and abbreviations to book numbers
+	exactNames = map[string]int{}
+	// Normalized full names, for prefix matches
+	fullNames []nameEntry
+)
+
+type nameEntry struct {
+	key  string
+	book int
+}
+
+func init() {
+	for _, b := range Books {
+		exactNames[normalizeName(b.OSIS)] = b.Number
+	}
+	for _, names := range bookNames {
+		for i, name := range names {
+			key := normalizeName(name)
+			exactNames[key] = i + 1
+			fullNames = append(fullNames, nameEntry{key, i + 1})
+		}
+	}
+	for osis, abbrevs := range bookAbbreviations {
+		book, ok := BookByOSIS(osis)
+		if !ok {
+			panic("scripture: unknown book " + osis)
+		}
+		for _, a := range abbrevs {
+			exactNames[normalizeName(a)] = book.Number
+		}
+	}
+}
+
+// BookByOSIS looks up a book by its OSIS abbreviation.
+func BookByOSIS(osis string) (Book, bool) {
+	for _, b := range Books {
+		if b.OSIS == osis {
+			return b, true
+		}
+	}
+	return Book{}, false
+}
+
+// lookupBook resolves a book name, abbreviation or unambiguous prefix of a
+// name in any supported language. It returns 0 if there is no such book.
+func lookupBook(name string) int {
+	key := normalizeName(name)
+	if len(key) < 2 {
+		return 0
+	}
+	if book, ok := exactNames[key]; ok {
+		return book
+	}
+	book := 0
+	for _, e := range fullNames {
+		if strings.HasPrefix(e.key, key) {
+			if book != 0 && book != e.book {
+				return 0
+			}
+			book = e.book
+		}
+	}
+	return book
+}
+
+// ordinals are the ways a numbered book's number is written before its
+// name.
+var ordinals = map[string]string{
+	"i": "1", "ii": "2", "iii": "3",
+	"1st": "1", "2nd": "2", "3rd": "3",
+	"first": "1", "second": "2", "third": "3",
+}
+
+// normalizeName reduces a book name to lowercase letters and digits
+// without accents, with any leading ordinal as a digit: "1. Kön." and
+// "I Kings" become "1kon" and "1kings".
+func normalizeName(name string) string {
+	fields := strings.Fields(strings.ToLower(name))
+	if len(fields) > 1 {
+		if digit, ok := ordinals[strings.TrimSuffix(fields[0], ".")]; ok {
+			fields[0] = digit
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.Join(fields, "")) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,379 @@
+// media-service/pkg/scripture/parse.go
+//
+// Package scripture parses Bible references written in several languages
+// into canonical verse ranges.
+package scripture
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxVerse is the length of the longest chapter, Psalm 119.
+const maxVerse = 176
+
+// ParseError explains why text is not a reference.
+type ParseError struct {
+	Text   string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%q: %s", e.Text, e.Reason)
+}
+
+// Parse reads one or more references, such as "Rom 8:28-30",
+// "1 Cor. 13; 15:1-11", "Jn 3:16, 18" or "Salmos 23", numbered in scheme,
+// and returns them in English numbering. Chapters and verses are separated
+// by ":" or "."; "ff" or "end" after a verse runs to the end of the
+// chapter. In books of one chapter a lone number is a verse.
+func Parse(text string, scheme Scheme) ([]Range, error) {
+	if scheme == "" {
+		scheme = English
+	}
+	if _, ok := schemeShifts[scheme]; !ok && scheme != English {
+		return nil, &ParseError{Text: text, Reason: fmt.Sprintf("unknown versification %q", scheme)}
+	}
+
+	p := &parser{text: text, tokens: lex(text), scheme: scheme}
+	ranges, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if len(ranges) == 0 {
+		return nil, p.fail("no reference")
+	}
+	return ranges, nil
+}
+
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokWord
+	tokColon
+	tokDash
+	tokComma
+	tokSemicolon
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  int
+}
+
+// lex splits text into tokens. A "." between digits separates chapter and
+// verse; anywhere else it ends an abbreviation or ordinal and is dropped.
+// Letters straight after a number, as in "28a" or "2nd", are dropped too.
+func lex(text string) []token {
+	var tokens []token
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+			n, err := strconv.Atoi(string(runes[i:j]))
+			if err != nil {
+				n = -1
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[i:j]), num: n})
+			// Part-verse letters, and the suffix of an ordinal such as "2nd"
+			if j < len(runes) && strings.ContainsRune("abc", runes[j]) &&
+				(j+1 == len(runes) || !unicode.IsLetter(runes[j+1])) {
+				j++
+			} else if j+2 <= len(runes) && isOrdinalSuffix(string(runes[j:j+2])) &&
+				(j+2 == len(runes) || !unicode.IsLetter(runes[j+2])) {
+				j += 2
+			}
+			i = j
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.Is(unicode.Mn, runes[j]) || runes[j] == '\'') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: string(runes[i:j])})
+			i = j
+		case r == ':':
+			tokens = append(tokens, token{kind: tokColon, text: ":"})
+			i++
+		case r == '.':
+			if i > 0 && i+1 < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1]) {
+				tokens = append(tokens, token{kind: tokColon, text: "."})
+			}
+			i++
+		case r == '-' || r == '–' || r == '—' || r == '‐':
+			tokens = append(tokens, token{kind: tokDash, text: "-"})
+			i++
+		case r == ',' || r == '&':
+			tokens = append(tokens, token{kind: tokComma, text: ","})
+			i++
+		case r == ';':
+			tokens = append(tokens, token{kind: tokSemicolon, text: ";"})
+			i++
+		default:
+			tokens = append(tokens, token{kind: tokWord, text: string(r)})
+			i++
+		}
+	}
+	return tokens
+}
+
+// isOrdinalSuffix reports whether s ends an ordinal written in digits.
+func isOrdinalSuffix(s string) bool {
+	switch strings.ToLower(s) {
+	case "st", "nd", "rd":
+		return true
+	}
+	return false
+}
+
+type parser struct {
+	text   string
+	tokens []token
+	pos    int
+	scheme Scheme
+}
+
+func (p *parser) fail(reason string) error {
+	return &ParseError{Text: p.text, Reason: reason}
+}
+
+func (p *parser) peek(offset int) *token {
+	if p.pos+offset < len(p.tokens) {
+		return &p.tokens[p.pos+offset]
+	}
+	return nil
+}
+
+func (p *parser) next() *token {
+	t := p.peek(0)
+	if t != nil {
+		p.pos++
+	}
+	return t
+}
+
+// isWord reports whether t is a word other than one of the keywords
+// that can follow a number.
+func isWord(t *token) bool {
+	if t == nil || t.kind != tokWord {
+		return false
+	}
+	switch strings.ToLower(t.text) {
+	case "ff", "end", "and":
+		return false
+	}
+	return true
+}
+
+func isKeyword(t *token, word string) bool {
+	return t != nil && t.kind == tokWord && strings.EqualFold(t.text, word)
+}
+
+func (p *parser) parse() ([]Range, error) {
+	var ranges []Range
+	book := 0
+	chapter := 0
+	// After a comma, a number continues in the same chapter when the
+	// previous reference had verses
+	verseNext := false
+
+	for p.peek(0) != nil {
+		t := p.peek(0)
+		switch {
+		case t.kind == tokSemicolon:
+			p.next()
+			verseNext = false
+			continue
+		case t.kind == tokComma || isKeyword(t, "and"):
+			p.next()
+			continue
+		case isWord(t) || (t.kind == tokNumber && isWord(p.peek(1))):
+			b, err := p.book()
+			if err != nil {
+				return nil, err
+			}
+			book, chapter, verseNext = b, 0, false
+			if p.atEnd() {
+				// A name alone is the whole book
+				ranges = append(ranges, Range{
+					Start: Verse{book, 1, 0},
+					End:   Verse{book, Books[book-1].Chapters, 0},
+				})
+				continue
+			}
+		}
+		if book == 0 {
+			return nil, p.fail("reference has no book")
+		}
+
+		r, err := p.passage(book, chapter, verseNext)
+		if err != nil {
+			return nil, err
+		}
+		chapter = r.End.Chapter
+		verseNext = r.End.Verse != 0 || r.Start.Verse != 0
+		ranges = append(ranges, Range{
+			Start: toEnglish(p.scheme, r.Start, false),
+			End:   toEnglish(p.scheme, r.End, true),
+		})
+	}
+	return ranges, nil
+}
+
+// atEnd reports whether no more numbers follow for the current book.
+func (p *parser) atEnd() bool {
+	t := p.peek(0)
+	return t == nil || t.kind == tokSemicolon || t.kind == tokComma || isKeyword(t, "and")
+}
+
+// book reads a book name: an optional number, then the longest run of
+// words that names a book.
+func (p *parser) book() (int, error) {
+	start := p.pos
+	var parts []string
+	if t := p.peek(0); t.kind == tokNumber {
+		parts = append(parts, t.text)
+		p.pos++
+	}
+	words := 0
+	for isWord(p.peek(words)) {
+		words++
+	}
+	for n := words; n > 0; n-- {
+		name := parts
+		for _, t := range p.tokens[p.pos : p.pos+n] {
+			name = append(name, t.text)
+		}
+		if book := lookupBook(strings.Join(name, " ")); book != 0 {
+			p.pos += n
+			return book, nil
+		}
+	}
+
+	var name []string
+	for _, t := range p.tokens[start : p.pos+max(words, 1)] {
+		name = append(name, t.text)
+	}
+	return 0, p.fail(fmt.Sprintf("unknown book %q", strings.Join(name, " ")))
+}
+
+// passage reads one chapter, verse or range of either, numbered in the
+// parser's scheme.
+func (p *parser) passage(book, chapter int, verseNext bool) (Range, error) {
+	single := chapterCount(p.scheme, book) == 1
+
+	n, err := p.number()
+	if err != nil {
+		return Range{}, err
+	}
+	var start Verse
+	switch {
+	case p.take(tokColon):
+		v, err := p.number()
+		if err != nil {
+			return Range{}, err
+		}
+		start = Verse{book, n, v}
+	case single:
+		start = Verse{book, 1, n}
+	case verseNext && chapter != 0:
+		start = Verse{book, chapter, n}
+	default:
+		start = Verse{book, n, 0}
+	}
+
+	end := start
+	switch {
+	case p.takeKeyword("ff"):
+		if start.Verse == 0 {
+			return Range{}, p.fail(`"ff" must follow a verse`)
+		}
+		end.Verse = 0
+	case p.take(tokDash):
+		if p.takeKeyword("end") {
+			if start.Verse == 0 {
+				return Range{}, p.fail(`"end" must follow a verse`)
+			}
+			end.Verse = 0
+			break
+		}
+		m, err := p.number()
+		if err != nil {
+			return Range{}, err
+		}
+		switch {
+		case p.take(tokColon):
+			w, err := p.number()
+			if err != nil {
+				return Range{}, err
+			}
+			end = Verse{book, m, w}
+		case start.Verse != 0:
+			end.Verse = m
+		default:
+			end = Verse{book, m, 0}
+		}
+		if end.Verse != 0 && start.Verse == 0 {
+			// "3-4:5" starts at the beginning of chapter 3
+			start.Verse = 1
+		}
+	}
+
+	if err := p.check(start); err != nil {
+		return Range{}, err
+	}
+	if err := p.check(end); err != nil {
+		return Range{}, err
+	}
+	if end.Key(false) < start.Key(true) {
+		return Range{}, p.fail("range ends before it starts")
+	}
+	return Range{Start: start, End: end}, nil
+}
+
+func (p *parser) check(v Verse) error {
+	if chapters := chapterCount(p.scheme, v.Book); v.Chapter < 1 || v.Chapter > chapters {
+		return p.fail(fmt.Sprintf("%s has %d chapters", Books[v.Book-1].Name, chapters))
+	}
+	if v.Verse < 0 || v.Verse > maxVerse {
+		return p.fail(fmt.Sprintf("verse %d does not exist", v.Verse))
+	}
+	return nil
+}
+
+func (p *parser) number() (int, error) {
+	t := p.next()
+	if t == nil {
+		return 0, p.fail("expected a number at the end")
+	}
+	if t.kind != tokNumber || t.num < 1 {
+		return 0, p.fail(fmt.Sprintf("expected a number, found %q", t.text))
+	}
+	return t.num, nil
+}
+
+func (p *parser) take(kind tokenKind) bool {
+	if t := p.peek(0); t != nil && t.kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) takeKeyword(word string) bool {
+	if isKeyword(p.peek(0), word) {
+		p.pos++
+		return true
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// media-service/pkg/scripture/parse_test.go
+package scripture
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func formatRanges(ranges []Range) string {
+	out := make([]string, len(ranges))
+	for i, r := range ranges {
+		out[i] = r.String()
+	}
+	return strings.Join(out, "; ")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text   string
+		scheme Scheme
+		want   string
+	}{
+		// Full names, abbreviations and unambiguous prefixes
+		{"Romans 8:28", "", "Romans 8:28"},
+		{"Rom 8:28-30", "", "Romans 8:28-30"},
+		{"Rm 8:28", "", "Romans 8:28"},
+		{"Jn 3:16", "", "John 3:16"},
+		{"jhn 3.16", "", "John 3:16"},
+		{"Mt 5:3-12", "", "Matthew 5:3-12"},
+		{"Php 2:5-11", "", "Philippians 2:5-11"},
+		{"Phlm 1:6", "", "Philemon 6"},
+		{"Ephes 2:8-9", "", "Ephesians 2:8-9"},
+		{"Ps 23", "", "Psalm 23"},
+		{"Pss 1-2", "", "Psalms 1-2"},
+		{"Song of Solomon 2:4", "", "Song of Songs 2:4"},
+		{"Qoh 3:1", "", "Ecclesiastes 3:1"},
+		{"Rev. 21:4", "", "Revelation 21:4"},
+		{"Gen.", "", "Genesis 1-50"},
+		// Numbered books, with the number written in several ways
+		{"1 Cor. 13", "", "1 Corinthians 13"},
+		{"1Cor 13:4-7", "", "1 Corinthians 13:4-7"},
+		{"I Cor 13:13", "", "1 Corinthians 13:13"},
+		{"First John 4:8", "", "1 John 4:8"},
+		{"1Jn 1:9", "", "1 John 1:9"},
+		{"2nd Tim 3:16", "", "2 Timothy 3:16"},
+		{"III Jn 4", "", "3 John 4"},
+		// Other languages
+		{"Salmos 23", "", "Psalm 23"},
+		{"1. Kön. 19:12", "", "1 Kings 19:12"},
+		{"Offb 21:4", "", "Revelation 21:4"},
+		{"Yohana 3:16", "", "John 3:16"},
+		// Books of one chapter
+		{"Jude 3", "", "Jude 3"},
+		{"Ob 1:4", "", "Obadiah 4"},
+		{"Jude 20-25", "", "Jude 20-25"},
+		// Ranges across chapters
+		{"Gen 1:1-2:3", "", "Genesis 1:1-2:3"},
+		{"Matt 5-7", "", "Matthew 5-7"},
+		{"John 3-4:5", "", "John 3:1-4:5"},
+		{"Ps 119:176-120:2", "", "Psalms 119:176-120:2"},
+		{"Isa 52:13–53:12", "", "Isaiah 52:13-53:12"},
+		{"Rom 8:28ff", "", "Romans 8:28ff"},
+		{"Rom 8:28-end", "", "Romans 8:28ff"},
+		// Lists
+		{"1 Cor. 13; 15:1-11", "", "1 Corinthians 13; 1 Corinthians 15:1-11"},
+		{"Jn 3:16, 18", "", "John 3:16; John 3:18"},
+		{"Mk 1:1 and Lk 1:1-4", "", "Mark 1:1; Luke 1:1-4"},
+		// Other versifications, returned in English numbering
+		{"Mal 3:19-24", Hebrew, "Malachi 4:1-6"},
+		{"Mal 3:18-19", Hebrew, "Malachi 3:18-4:1"},
+		{"Joel 3", Hebrew, "Joel 2:28-32"},
+		{"Ps 22", Vulgate, "Psalm 23"},
+		{"Ps 9:22-23", Vulgate, "Psalm 10:1-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ranges, err := Parse(tt.text, tt.scheme)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := formatRanges(ranges); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text   string
+		scheme Scheme
+		reason string
+	}{
+		{"", "", "no reference"},
+		{"8:28", "", "reference has no book"},
+		{"Ju 1", "", `unknown book "Ju"`},
+		{"Hezekiah 3:1", "", `unknown book "Hezekiah"`},
+		{"Rom 17", "", "Romans has 16 chapters"},
+		{"Mal 4", Hebrew, "Malachi has 3 chapters"},
+		{"Ps 119:177", "", "verse 177 does not exist"},
+		{"Rom 8:30-28", "", "range ends before it starts"},
+		{"Gen 31:55-32", "", "range ends before it starts"},
+		{"Rom 8ff", "", `"ff" must follow a verse`},
+		{"Gen 1:1-", "", "expected a number at the end"},
+		{"Rom 8:", "", "expected a number at the end"},
+		{"Rom 8", "klingon", `unknown versification "klingon"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			ranges, err := Parse(tt.text, tt.scheme)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("got %v, err %v; want a parse error", formatRanges(ranges), err)
+			}
+			if perr.Text != tt.text || perr.Reason != tt.reason {
+				t.Errorf("got %q: %s, want %s", perr.Text, perr.Reason, tt.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// media-service/pkg/scripture/reference.go
+package scripture
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Verse is a point in the text in English numbering. Verse 0 stands for a
+// whole chapter: its start at the start of a range and its end at the end
+// of one.
+type Verse struct {
+	Book    int
+	Chapter int
+	Verse   int
+}
+
+// Range is a passage from Start to End inclusive, within one book.
+type Range struct {
+	Start Verse
+	End   Verse
+}
+
+// Key orders verses across the whole canon. Whole chapters count from
+// before their first verse when start is true and to after their last
+// verse when it is false.
+func (v Verse) Key(start bool) int {
+	verse := v.Verse
+	if verse == 0 && !start {
+		verse = 999
+	}
+	return v.Book*1_000_000 + v.Chapter*1_000 + verse
+}
+
+// Keys are the range's start and end as Verse keys, for storing ranges
+// and finding overlaps in a database.
+func (r Range) Keys() (start, end int) {
+	return r.Start.Key(true), r.End.Key(false)
+}
+
+// Overlaps reports whether the ranges share any verse.
+func (r Range) Overlaps(o Range) bool {
+	rs, re := r.Keys()
+	os, oe := o.Keys()
+	return rs <= oe && os <= re
+}
+
+func (r Range) Book() Book {
+	return Books[r.Start.Book-1]
+}
+
+// String formats the range as a canonical English reference such as
+// "Romans 8:28-30", "1 Corinthians 13", "Genesis 1:1-2:3" or "Jude 5".
+// A range ending with the end of a chapter that starts mid-chapter reads
+// "Romans 8:28ff", or "Genesis 31:55-32:end" across chapters.
+func (r Range) String() string {
+	b := r.Book()
+	s, e := r.Start, r.End
+	name := b.Name
+	if b.Number == 19 && s.Chapter == e.Chapter {
+		name = "Psalm"
+	}
+
+	if b.Chapters == 1 {
+		switch {
+		case s.Verse == 0 && e.Verse == 0:
+			return name
+		case s.Verse == 0:
+			return fmt.Sprintf("%s 1-%d", name, e.Verse)
+		case e.Verse == 0:
+			return fmt.Sprintf("%s %dff", name, s.Verse)
+		case s.Verse == e.Verse:
+			return fmt.Sprintf("%s %d", name, s.Verse)
+		default:
+			return fmt.Sprintf("%s %d-%d", name, s.Verse, e.Verse)
+		}
+	}
+
+	switch {
+	case s.Verse == 0 && e.Verse == 0 && s.Chapter == e.Chapter:
+		return fmt.Sprintf("%s %d", name, s.Chapter)
+	case s.Verse == 0 && e.Verse == 0:
+		return fmt.Sprintf("%s %d-%d", name, s.Chapter, e.Chapter)
+	case s.Chapter == e.Chapter && e.Verse == 0:
+		return fmt.Sprintf("%s %d:%dff", name, s.Chapter, s.Verse)
+	case s.Chapter == e.Chapter && s.Verse == e.Verse:
+		return fmt.Sprintf("%s %d:%d", name, s.Chapter, s.Verse)
+	case s.Chapter == e.Chapter:
+		return fmt.Sprintf("%s %d:%s-%d", name, s.Chapter, verseOrStart(s.Verse), e.Verse)
+	}
+	return fmt.Sprintf("%s %d:%s-%d:%s", name, s.Chapter, verseOrStart(s.Verse), e.Chapter, verseOrEnd(e.Verse))
+}
+
+// OSIS formats the range as an OSIS reference such as "Rom.8.28-Rom.8.30"
+// or "1Cor.13".
+func (r Range) OSIS() string {
+	start := osisVerse(r.Start)
+	if r.Start == r.End {
+		return start
+	}
+	return start + "-" + osisVerse(r.End)
+}
+
+func osisVerse(v Verse) string {
+	s := Books[v.Book-1].OSIS + "." + strconv.Itoa(v.Chapter)
+	if v.Verse != 0 {
+		s += "." + strconv.Itoa(v.Verse)
+	}
+	return s
+}
+
+func verseOrStart(v int) string {
+	if v == 0 {
+		return "1"
+	}
+	return strconv.Itoa(v)
+}
+
+func verseOrEnd(v int) string {
+	if v == 0 {
+		return "end"
+	}
+	return strconv.Itoa(v)
+}
@@ -0,0 +1,145 @@
+// media-service/pkg/scripture/versification.go
+package scripture
+
+// Scheme is a way of numbering chapters and verses. Ranges are always
+// stored in English numbering; Parse converts from the scheme a
+// reference was written in.
+type Scheme string
+
+const (
+	// English Bibles, following the King James Version
+	English Scheme = "english"
+	// The Masoretic Hebrew text, and Bibles translated from it that keep
+	// its numbering
+	Hebrew Scheme = "hebrew"
+	// The Septuagint and Vulgate, and Bibles that follow their Psalm
+	// numbering, such as the Douay-Rheims
+	Vulgate Scheme = "vulgate"
+)
+
+// Schemes lists the supported versification schemes.
+var Schemes = []Scheme{English, Hebrew, Vulgate}
+
+// shift moves verses first to last (0 for the end) of a chapter in some
+// scheme to toChapter in English numbering, adding offset to each verse.
+type shift struct {
+	book, chapter int
+	first, last   int
+	toChapter     int
+	offset        int
+}
+
+// schemeChapters overrides the English chapter counts of books that have
+// a different number of chapters in a scheme.
+var schemeChapters = map[Scheme]map[int]int{
+	Hebrew: {29: 4, 39: 3},
+}
+
+// schemeShifts map the places where a scheme's numbering departs from the
+// English. Hebrew covers the chapter boundaries that differ; the psalm
+// headings it numbers as verses are not shifted. Vulgate covers the Psalm
+// numbering only.
+var schemeShifts = map[Scheme][]shift{
+	Hebrew: {
+		{1, 32, 1, 1, 31, 54}, {1, 32, 2, 0, 32, -1},
+		{2, 7, 26, 29, 8, -25}, {2, 8, 1, 0, 8, 4},
+		{3, 5, 20, 26, 6, -19}, {3, 6, 1, 0, 6, 7},
+		{4, 17, 1, 15, 16, 35}, {4, 17, 16, 0, 17, -15},
+		{5, 13, 1, 1, 12, 31}, {5, 13, 2, 0, 13, -1},
+		{5, 23, 1, 1, 22, 29}, {5, 23, 2, 0, 23, -1},
+		{9, 21, 1, 1, 20, 41}, {9, 21, 2, 0, 21, -1},
+		{9, 24, 1, 1, 23, 28}, {9, 24, 2, 0, 24, -1},
+		{10, 19, 1, 1, 18, 32}, {10, 19, 2, 0, 19, -1},
+		{11, 5, 1, 14, 4, 20}, {11, 5, 15, 0, 5, -14},
+		{13, 5, 27, 41, 6, -26}, {13, 6, 1, 0, 6, 15},
+		{14, 1, 18, 18, 2, -17}, {14, 2, 1, 0, 2, 1},
+		{16, 3, 33, 38, 4, -32}, {16, 4, 1, 0, 4, 6},
+		{16, 10, 1, 1, 9, 37}, {16, 10, 2, 0, 10, -1},
+		{18, 40, 25, 32, 41, -24}, {18, 41, 1, 0, 41, 8},
+		{21, 4, 17, 17, 5, -16}, {21, 5, 1, 0, 5, 1},
+		{22, 7, 1, 1, 6, 12}, {22, 7, 2, 0, 7, -1},
+		{23, 8, 23, 23, 9, -22}, {23, 9, 1, 0, 9, 1},
+		{23, 64, 1, 0, 64, 1},
+		{24, 8, 23, 23, 9, -22}, {24, 9, 1, 0, 9, 1},
+		{26, 21, 1, 5, 20, 44}, {26, 21, 6, 0, 21, -5},
+		{27, 3, 31, 33, 4, -30}, {27, 4, 1, 0, 4, 3},
+		{27, 6, 1, 1, 5, 30}, {27, 6, 2, 0, 6, -1},
+		{28, 2, 1, 2, 1, 9}, {28, 2, 3, 0, 2, -2},
+		{28, 12, 1, 1, 11, 11}, {28, 12, 2, 0, 12, -1},
+		{28, 14, 1, 1, 13, 15}, {28, 14, 2, 0, 14, -1},
+		{29, 3, 1, 5, 2, 27}, {29, 4, 1, 0, 3, 0},
+		{32, 2, 1, 1, 1, 16}, {32, 2, 2, 0, 2, -1},
+		{33, 4, 14, 14, 5, -13}, {33, 5, 1, 0, 5, 1},
+		{34, 2, 1, 1, 1, 14}, {34, 2, 2, 0, 2, -1},
+		{38, 2, 1, 4, 1, 17}, {38, 2, 5, 0, 2, -4},
+		{39, 3, 19, 24, 4, -18},
+	},
+	Vulgate: vulgatePsalms(),
+}
+
+// vulgatePsalms maps the Greek and Latin Psalm numbering, which joins
+// Psalms 9 and 10 and 114 and 115 and splits 116 and 147.
+func vulgatePsalms() []shift {
+	shifts := []shift{
+		// Verse 1 of Psalm 9 is its heading
+		{19, 9, 2, 21, 9, -1}, {19, 9, 22, 0, 10, -21},
+		{19, 113, 1, 8, 114, 0}, {19, 113, 9, 0, 115, -8},
+		{19, 114, 1, 9, 116, 0}, {19, 115, 1, 0, 116, 9},
+		{19, 146, 1, 11, 147, 0}, {19, 147, 1, 0, 147, 11},
+	}
+	for ps := 10; ps <= 112; ps++ {
+		shifts = append(shifts, shift{19, ps, 1, 0, ps + 1, 0})
+	}
+	for ps := 116; ps <= 145; ps++ {
+		shifts = append(shifts, shift{19, ps, 1, 0, ps + 1, 0})
+	}
+	return shifts
+}
+
+// chapterCount is how many chapters book has in scheme.
+func chapterCount(scheme Scheme, book int) int {
+	if n, ok := schemeChapters[scheme][book]; ok {
+		return n
+	}
+	return Books[book-1].Chapters
+}
+
+// toEnglish converts v from scheme's numbering. A whole-chapter verse (0)
+// becomes the first verse of the chapter when end is false, and the last
+// when it is true.
+func toEnglish(scheme Scheme, v Verse, end bool) Verse {
+	var matched *shift
+	for i, s := range schemeShifts[scheme] {
+		if s.book != v.Book || s.chapter != v.Chapter {
+			continue
+		}
+		switch {
+		case v.Verse != 0:
+			if v.Verse >= s.first && (s.last == 0 || v.Verse <= s.last) {
+				matched = &schemeShifts[scheme][i]
+			}
+		case end:
+			// The shift covering the end of the chapter
+			if matched == nil || s.last == 0 || (matched.last != 0 && s.last > matched.last) {
+				matched = &schemeShifts[scheme][i]
+			}
+		case s.first == 1:
+			matched = &schemeShifts[scheme][i]
+		}
+	}
+	if matched == nil {
+		return v
+	}
+
+	s := *matched
+	out := Verse{Book: v.Book, Chapter: s.toChapter}
+	switch {
+	case v.Verse != 0:
+		out.Verse = v.Verse + s.offset
+	case end && s.last != 0:
+		out.Verse = s.last + s.offset
+	case !end && s.offset != 0:
+		out.Verse = s.first + s.offset
+	}
+	return out
+}
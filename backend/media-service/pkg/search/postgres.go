@@ -0,0 +1,393 @@
+// media-service/pkg/search/postgres.go
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresOptions tunes a Postgres index.
+type PostgresOptions struct {
+	// Text search configuration, e.g. simple or english
+	TextConfig string
+	// Rank weights of titles and scripture references, of speakers,
+	// series and tags, of descriptions and of transcripts and attached
+	// documents, from 0 to 1
+	TitleWeight       float64
+	MetadataWeight    float64
+	DescriptionWeight float64
+	TranscriptWeight  float64
+	// Least trigram similarity, from 0 to 1, for a known word to replace a
+	// misspelt one; 0 turns correction off
+	Similarity float64
+	// Most values returned per facet
+	FacetSize int
+}
+
+// Postgres is an Index in the service's own database, using full-text
+// search for matching and ranking and pg_trgm to correct misspellings.
+type Postgres struct {
+	db      *gorm.DB
+	opts    PostgresOptions
+	weights string
+}
+
+// document is a row of search_documents. Tags and scripture references
+// are only needed in the vector.
+type document struct {
+	MediaID         uint   `gorm:"primaryKey;autoIncrement:false"`
+	Title           string `gorm:"not null"`
+	Description     string `gorm:"type:text"`
+	Speaker         string `gorm:"index"`
+	Series          string `gorm:"index"`
+	Language        string `gorm:"size:35;index"`
+	Type            string `gorm:"size:16"`
+	DurationSeconds int
+	Transcript      string `gorm:"type:text"`
+	Attachments     string `gorm:"type:text"`
+	Visibility      string `gorm:"size:16;not null"`
+	OwnerID         uint   `gorm:"not null"`
+	PublishAt       *time.Time
+	CreatedAt       time.Time
+	Vector          string `gorm:"type:tsvector;not null;index:idx_search_documents_vector,type:gin"`
+}
+
+func (document) TableName() string { return "search_documents" }
+
+// term is a word seen in any document, a candidate correction for
+// misspelt query words. Terms outlive the documents they came from.
+type term struct {
+	Term string `gorm:"primaryKey"`
+}
+
+func (term) TableName() string { return "search_terms" }
+
+// NewPostgres creates the index tables in db if needed.
+func NewPostgres(db *gorm.DB, opts PostgresOptions) (*Postgres, error) {
+	if opts.TextConfig == "" {
+		opts.TextConfig = "simple"
+	}
+	if opts.FacetSize <= 0 {
+		opts.FacetSize = 20
+	}
+	if err := db.AutoMigrate(&document{}, &term{}); err != nil {
+		return nil, err
+	}
+	if opts.Similarity > 0 {
+		if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+			return nil, fmt.Errorf("enable pg_trgm: %w", err)
+		}
+		if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_search_terms_trgm ON search_terms USING gist (term gist_trgm_ops)").Error; err != nil {
+			return nil, err
+		}
+	}
+	return &Postgres{
+		db:   db,
+		opts: opts,
+		// ts_rank takes them in D, C, B, A order
+		weights: fmt.Sprintf("{%g,%g,%g,%g}",
+			opts.TranscriptWeight, opts.DescriptionWeight, opts.MetadataWeight, opts.TitleWeight),
+	}, nil
+}
+
+func (p *Postgres) Upsert(ctx context.Context, doc Document) error {
+	weightA := strings.Join(append([]string{doc.Title}, doc.ScriptureRefs...), "\n")
+	weightB := strings.Join(append([]string{doc.Speaker, doc.Series}, doc.Tags...), "\n")
+	weightD := doc.Transcript + "\n" + doc.Attachments
+	cfg := p.opts.TextConfig
+
+	return p.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO search_documents
+			(media_id, title, description, speaker, series, language, type, duration_seconds, transcript,
+			 attachments, visibility, owner_id, publish_at, created_at, vector)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+				setweight(to_tsvector(?::regconfig, ?), 'A') || setweight(to_tsvector(?::regconfig, ?), 'B') ||
+				setweight(to_tsvector(?::regconfig, ?), 'C') || setweight(to_tsvector(?::regconfig, ?), 'D'))
+			ON CONFLICT (media_id) DO UPDATE SET
+				title = EXCLUDED.title, description = EXCLUDED.description, speaker = EXCLUDED.speaker,
+				series = EXCLUDED.series, language = EXCLUDED.language, type = EXCLUDED.type,
+				duration_seconds = EXCLUDED.duration_seconds, transcript = EXCLUDED.transcript,
+				attachments = EXCLUDED.attachments, visibility = EXCLUDED.visibility, owner_id = EXCLUDED.owner_id,
+				publish_at = EXCLUDED.publish_at, created_at = EXCLUDED.created_at, vector = EXCLUDED.vector`,
+			doc.MediaID, doc.Title, doc.Description, doc.Speaker, doc.Series, doc.Language, doc.Type,
+			doc.DurationSeconds, doc.Transcript, doc.Attachments, doc.Visibility, doc.OwnerID, doc.PublishAt, doc.CreatedAt,
+			cfg, weightA, cfg, weightB, cfg, doc.Description, cfg, weightD,
+		).Error; err != nil {
+			return err
+		}
+		if p.opts.Similarity <= 0 {
+			return nil
+		}
+		// Unstemmed, so corrections are words people actually type
+		return tx.Exec(`INSERT INTO search_terms (term)
+			SELECT lexeme FROM unnest(to_tsvector('simple', ?)) WHERE length(lexeme) >= 3
+			ON CONFLICT DO NOTHING`,
+			strings.Join([]string{weightA, weightB, doc.Description, weightD}, "\n"),
+		).Error
+	})
+}
+
+func (p *Postgres) Delete(ctx context.Context, mediaID uint) error {
+	return p.db.WithContext(ctx).Where("media_id = ?", mediaID).Delete(&document{}).Error
+}
+
+func (p *Postgres) Search(ctx context.Context, q Query) (*Result, error) {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	result, err := p.search(ctx, q)
+	if err != nil || result.Total > 0 || q.Text == "" || p.opts.Similarity <= 0 {
+		return result, err
+	}
+
+	corrected, err := p.correct(ctx, q.Text)
+	if err != nil || corrected == q.Text {
+		return result, err
+	}
+	q.Text = corrected
+	retry, err := p.search(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	retry.Corrected = corrected
+	return retry, nil
+}
+
+func (p *Postgres) search(ctx context.Context, q Query) (*Result, error) {
+	result := &Result{Hits: []Hit{}, Facets: map[string][]FacetCount{}}
+	if err := p.matches(ctx, q, "").Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := p.facets(ctx, q, result.Facets); err != nil {
+		return nil, err
+	}
+	if result.Total == 0 {
+		return result, nil
+	}
+
+	page := p.matches(ctx, q, "")
+	if q.Text != "" && q.Sort != SortNewest {
+		page = page.Select("media_id, ts_rank_cd(?::float4[], vector, websearch_to_tsquery(?::regconfig, ?), 32) AS score",
+			p.weights, p.opts.TextConfig, q.Text).
+			Order("score DESC")
+	} else {
+		page = page.Select("media_id, 0 AS score")
+	}
+	if err := page.
+		Order("created_at DESC, media_id").
+		Offset(q.Offset).
+		Limit(q.Limit).
+		Scan(&result.Hits).Error; err != nil {
+		return nil, err
+	}
+	if q.Text == "" {
+		return result, nil
+	}
+	return result, p.highlight(ctx, q.Text, result.Hits)
+}
+
+// matches selects the documents matching q that the caller may see,
+// leaving out the filter of the facet named skip.
+func (p *Postgres) matches(ctx context.Context, q Query, skip string) *gorm.DB {
+	db := p.db.WithContext(ctx).Table("search_documents")
+	if q.Text != "" {
+		db = db.Where("vector @@ websearch_to_tsquery(?::regconfig, ?)", p.opts.TextConfig, q.Text)
+	}
+	if !q.Access.All {
+		// Mirrors the catalog's own visibility rule
+		db = db.Where("((visibility = ? AND (publish_at IS NULL OR publish_at <= ?)) OR owner_id = ?)",
+			"public", time.Now(), q.Access.UserID)
+	}
+	if len(q.Types) > 0 {
+		db = db.Where("type IN ?", q.Types)
+	}
+	if len(q.Speakers) > 0 && skip != FacetSpeaker {
+		db = db.Where("speaker IN ?", q.Speakers)
+	}
+	if len(q.Languages) > 0 && skip != FacetLanguage {
+		db = db.Where("language IN ?", q.Languages)
+	}
+	if len(q.Series) > 0 && skip != FacetSeries {
+		db = db.Where("series IN ?", q.Series)
+	}
+	if len(q.Durations) > 0 && skip != FacetDuration {
+		var conds []string
+		var args []interface{}
+		for _, name := range q.Durations {
+			band, ok := Band(name)
+			if !ok {
+				continue
+			}
+			if band.Max == 0 {
+				conds = append(conds, "duration_seconds >= ?")
+				args = append(args, band.Min)
+			} else {
+				conds = append(conds, "(duration_seconds >= ? AND duration_seconds < ?)")
+				args = append(args, band.Min, band.Max)
+			}
+		}
+		if len(conds) == 0 {
+			conds = []string{"FALSE"}
+		}
+		db = db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	return db
+}
+
+func (p *Postgres) facets(ctx context.Context, q Query, out map[string][]FacetCount) error {
+	for _, facet := range []string{FacetSpeaker, FacetLanguage, FacetSeries} {
+		counts := []FacetCount{}
+		if err := p.matches(ctx, q, facet).
+			Select(facet + " AS value, COUNT(*) AS count").
+			Where(facet + " <> ''").
+			Group(facet).
+			Order("count DESC, value").
+			Limit(p.opts.FacetSize).
+			Scan(&counts).Error; err != nil {
+			return err
+		}
+		out[facet] = counts
+	}
+
+	// Band names and bounds are constants, so they can be inlined
+	var bandCase strings.Builder
+	bandCase.WriteString("CASE")
+	for _, b := range DurationBands {
+		if b.Max == 0 {
+			fmt.Fprintf(&bandCase, " WHEN duration_seconds >= %d THEN '%s'", b.Min, b.Name)
+		} else {
+			fmt.Fprintf(&bandCase, " WHEN duration_seconds >= %d AND duration_seconds < %d THEN '%s'", b.Min, b.Max, b.Name)
+		}
+	}
+	bandCase.WriteString(" END")
+
+	var counts []FacetCount
+	if err := p.matches(ctx, q, FacetDuration).
+		Select(bandCase.String()+" AS value, COUNT(*) AS count").
+		Where("duration_seconds >= ?", DurationBands[0].Min).
+		Group("value").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	// Shortest first rather than by count
+	bands := make([]FacetCount, 0, len(counts))
+	for _, b := range DurationBands {
+		for _, c := range counts {
+			if c.Value == b.Name {
+				bands = append(bands, c)
+			}
+		}
+	}
+	out[FacetDuration] = bands
+	return nil
+}
+
+// highlight fills in the hits' fragments. Fields are HTML escaped before
+// ts_headline adds the <mark> tags.
+func (p *Postgres) highlight(ctx context.Context, text string, hits []Hit) error {
+	ids := make([]uint, len(hits))
+	for i := range hits {
+		ids[i] = hits[i].MediaID
+	}
+	escaped := func(column string) string {
+		return "replace(replace(replace(" + column + ", '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+	}
+	const (
+		whole     = "HighlightAll=true, StartSel=<mark>, StopSel=</mark>"
+		fragments = "MaxFragments=2, MaxWords=25, MinWords=10, FragmentDelimiter=\" … \", StartSel=<mark>, StopSel=</mark>"
+	)
+
+	var rows []struct {
+		MediaID     uint
+		Title       string
+		Description string
+		Transcript  string
+		Attachments string
+	}
+	if err := p.db.WithContext(ctx).Raw(`SELECT media_id,
+			ts_headline(cfg, `+escaped("title")+`, query, '`+whole+`') AS title,
+			ts_headline(cfg, `+escaped("description")+`, query, '`+fragments+`') AS description,
+			ts_headline(cfg, `+escaped("transcript")+`, query, '`+fragments+`') AS transcript,
+			ts_headline(cfg, `+escaped("coalesce(attachments, '')")+`, query, '`+fragments+`') AS attachments
+		FROM search_documents, (SELECT ?::regconfig AS cfg, websearch_to_tsquery(?::regconfig, ?) AS query) AS q
+		WHERE media_id IN ?`,
+		p.opts.TextConfig, p.opts.TextConfig, text, ids,
+	).Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	// ts_headline returns the start of a field that did not match
+	marked := func(s string) string {
+		if strings.Contains(s, "<mark>") {
+			return s
+		}
+		return ""
+	}
+	for _, row := range rows {
+		for i := range hits {
+			if hits[i].MediaID == row.MediaID {
+				hits[i].Title = marked(row.Title)
+				hits[i].Description = marked(row.Description)
+				hits[i].Transcript = marked(row.Transcript)
+				hits[i].Attachments = marked(row.Attachments)
+			}
+		}
+	}
+	return nil
+}
+
+var queryWord = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// correct replaces the words of text that appear in no document with the
+// most similar word that does, if it is similar enough.
+func (p *Postgres) correct(ctx context.Context, text string) (string, error) {
+	replacements := map[string]string{}
+	for _, word := range queryWord.FindAllString(text, -1) {
+		lower := strings.ToLower(word)
+		if _, done := replacements[lower]; done || len([]rune(lower)) < 3 || lower == "or" {
+			continue
+		}
+		replacements[lower] = lower
+
+		var known int64
+		if err := p.db.WithContext(ctx).Model(&term{}).Where("term = ?", lower).Count(&known).Error; err != nil {
+			return "", err
+		}
+		if known > 0 {
+			continue
+		}
+		var best struct {
+			Term       string
+			Similarity float64
+		}
+		err := p.db.WithContext(ctx).Raw(`SELECT term, similarity(term, ?) AS similarity
+			FROM search_terms ORDER BY term <-> ? LIMIT 1`, lower, lower).Scan(&best).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+		if best.Term != "" && best.Similarity >= p.opts.Similarity {
+			replacements[lower] = best.Term
+		}
+	}
+
+	changed := false
+	for from, to := range replacements {
+		changed = changed || from != to
+	}
+	if !changed {
+		return text, nil
+	}
+	return queryWord.ReplaceAllStringFunc(text, func(word string) string {
+		if to, ok := replacements[strings.ToLower(word)]; ok && to != strings.ToLower(word) {
+			return to
+		}
+		return word
+	}), nil
+}
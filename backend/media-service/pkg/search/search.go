@@ -0,0 +1,136 @@
+// media-service/pkg/search/search.go
+//
+// Package search finds catalog items by their metadata and transcripts.
+// The service keeps an Index in sync with the catalog and asks it for
+// ranked, highlighted and faceted results.
+package search
+
+import (
+	"context"
+	"time"
+)
+
+// Index stores one document per catalog item.
+type Index interface {
+	// Upsert adds the document or replaces the one with its MediaID.
+	Upsert(ctx context.Context, doc Document) error
+	// Delete removes the item's document, if any.
+	Delete(ctx context.Context, mediaID uint) error
+	Search(ctx context.Context, q Query) (*Result, error)
+}
+
+// Document is what the index knows about an item.
+type Document struct {
+	MediaID         uint
+	Title           string
+	Description     string
+	Speaker         string
+	Series          string
+	Tags            []string
+	ScriptureRefs   []string
+	Language        string
+	Type            string
+	DurationSeconds int
+	// Text of the item's published captions, in every language
+	Transcript string
+	// Text extracted from the documents attached to the item
+	Attachments string
+	// Copied from the item so results can be limited to what the caller
+	// may see without a join
+	Visibility string
+	OwnerID    uint
+	PublishAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// Facets results can be counted and filtered by
+const (
+	FacetSpeaker  = "speaker"
+	FacetLanguage = "language"
+	FacetSeries   = "series"
+	FacetDuration = "duration"
+)
+
+// Orders of results
+const (
+	SortRelevance = "relevance"
+	SortNewest    = "newest"
+)
+
+// DurationBand is a range of lengths, in seconds, counted as one facet
+// value. Max is exclusive; 0 means unbounded.
+type DurationBand struct {
+	Name string
+	Min  int
+	Max  int
+}
+
+// DurationBands are the values of FacetDuration. Items of unknown length,
+// such as documents, are in none of them.
+var DurationBands = []DurationBand{
+	{Name: "short", Min: 1, Max: 10 * 60},
+	{Name: "medium", Min: 10 * 60, Max: 30 * 60},
+	{Name: "long", Min: 30 * 60, Max: 60 * 60},
+	{Name: "extended", Min: 60 * 60},
+}
+
+// Access limits results to what a caller may see: public items that are
+// published, and the caller's own.
+type Access struct {
+	UserID uint
+	// Admins see everything
+	All bool
+}
+
+type Query struct {
+	// Web search syntax: quoted phrases, OR and -exclusions. Empty lists
+	// everything that matches the filters, newest first.
+	Text string
+	// Each filter matches any of its values; empty matches everything
+	Speakers  []string
+	Languages []string
+	Series    []string
+	Types     []string
+	Durations []string
+	Access    Access
+	Sort      string
+	Offset    int
+	Limit     int
+}
+
+type Result struct {
+	Hits  []Hit
+	Total int64
+	// Counts per value of each facet among the matches. A facet's own
+	// filter is left out of its counts so clients can offer alternatives.
+	Facets map[string][]FacetCount
+	// The query that was run instead when Text matched nothing and looked
+	// misspelt; empty otherwise
+	Corrected string
+}
+
+type Hit struct {
+	MediaID uint
+	Score   float64
+	// Fragments with matched words wrapped in <mark> and the rest HTML
+	// escaped; empty when the field did not match
+	Title       string
+	Description string
+	Transcript  string
+	Attachments string
+}
+
+type FacetCount struct {
+	Value string
+	Count int64
+}
+
+// Band looks up a duration band by name.
+func Band(name string) (DurationBand, bool) {
+	for _, b := range DurationBands {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return DurationBand{}, false
+}
@@ -0,0 +1,506 @@
+// media-service/pkg/services/access_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetMediaAccess returns the access rule of an item the viewer may edit,
+// or nil if everyone who can see it may play it.
+func GetMediaAccess(viewer Viewer, id uint) (*models.MediaAccess, error) {
+	if _, err := editableMedia(viewer, id); err != nil {
+		return nil, err
+	}
+	var rule models.MediaAccess
+	err := config.DB.Where("media_id = ?", id).First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// SetMediaAccess replaces the access rule of an item the viewer may edit.
+func SetMediaAccess(viewer Viewer, id uint, req api.MediaAccessRequest) (*models.MediaAccess, error) {
+	if _, err := editableMedia(viewer, id); err != nil {
+		return nil, err
+	}
+	if req.AvailableFrom != nil && req.AvailableUntil != nil && !req.AvailableUntil.After(*req.AvailableFrom) {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "available_until", Code: "gtfield", Message: "must be after available_from",
+		})
+	}
+	if req.CourseID == nil && (req.DripDays > 0 || req.RequirePrevious) {
+		field := "drip_days"
+		if req.DripDays == 0 {
+			field = "require_previous"
+		}
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: field, Code: "required_with", Message: "needs a course_id",
+		})
+	}
+	if req.CourseID != nil {
+		if _, err := GetCollection(viewer, *req.CourseID); err != nil {
+			if errors.Is(err, apperror.ErrNotFound) {
+				return nil, apperror.Validation(apperror.FieldError{
+					Field: "course_id", Code: "exists", Message: "must be a collection you can see",
+				})
+			}
+			return nil, err
+		}
+	}
+
+	rule := &models.MediaAccess{
+		MediaID:         id,
+		Roles:           cleanList(req.Roles),
+		Cohorts:         cleanList(req.Cohorts),
+		CourseID:        req.CourseID,
+		AvailableFrom:   req.AvailableFrom,
+		AvailableUntil:  req.AvailableUntil,
+		DripDays:        req.DripDays,
+		RequirePrevious: req.RequirePrevious,
+	}
+	err := config.DB.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "media_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"roles", "cohorts", "course_id", "available_from", "available_until",
+				"drip_days", "require_previous", "updated_at",
+			}),
+		},
+		clause.Returning{},
+	).Create(rule).Error
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// DeleteMediaAccess opens an item the viewer may edit to everyone who can
+// see it.
+func DeleteMediaAccess(viewer Viewer, id uint) error {
+	if _, err := editableMedia(viewer, id); err != nil {
+		return err
+	}
+	return config.DB.Where("media_id = ?", id).Delete(&models.MediaAccess{}).Error
+}
+
+// ListEnrollments returns a page of the users enrolled in a course the
+// viewer may edit, most recent first.
+func ListEnrollments(viewer Viewer, collectionID uint, page Page) ([]models.Enrollment, int64, error) {
+	if _, err := editableCollection(viewer, collectionID); err != nil {
+		return nil, 0, err
+	}
+	query := config.DB.Model(&models.Enrollment{}).Where("collection_id = ?", collectionID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var enrollments []models.Enrollment
+	if err := query.
+		Order("enrolled_at DESC").
+		Order("user_id").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&enrollments).Error; err != nil {
+		return nil, 0, err
+	}
+	return enrollments, total, nil
+}
+
+// EnrollUsers enrolls users in a course the viewer may edit. Users already
+// enrolled get the new expiry, and the new enrollment date if one is
+// given.
+func EnrollUsers(viewer Viewer, collectionID uint, req api.EnrollmentRequest) ([]models.Enrollment, error) {
+	if _, err := editableCollection(viewer, collectionID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	enrolledAt := now
+	updates := []string{"expires_at"}
+	if req.EnrolledAt != nil {
+		enrolledAt = *req.EnrolledAt
+		updates = append(updates, "enrolled_at")
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(enrolledAt) {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "expires_at", Code: "gtfield", Message: "must be after the enrollment date",
+		})
+	}
+
+	ids := uniqueIDs(req.UserIDs)
+	enrollments := make([]models.Enrollment, 0, len(ids))
+	for _, userID := range ids {
+		enrollments = append(enrollments, models.Enrollment{
+			CollectionID: collectionID,
+			UserID:       userID,
+			EnrolledAt:   enrolledAt,
+			ExpiresAt:    req.ExpiresAt,
+		})
+	}
+	err := config.DB.Clauses(
+		clause.OnConflict{
+			Columns:   []clause.Column{{Name: "collection_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns(updates),
+		},
+		clause.Returning{},
+	).Create(&enrollments).Error
+	if err != nil {
+		return nil, err
+	}
+	return enrollments, nil
+}
+
+// Unenroll removes a user from a course the viewer may edit and revokes
+// their offline licenses for the items the course gates.
+func Unenroll(viewer Viewer, collectionID, userID uint) error {
+	if _, err := editableCollection(viewer, collectionID); err != nil {
+		return err
+	}
+	result := config.DB.Where("collection_id = ? AND user_id = ?", collectionID, userID).Delete(&models.Enrollment{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.ErrNotFound.WithDetail("User is not enrolled in this course")
+	}
+
+	var gated []uint
+	if err := config.DB.Model(&models.MediaAccess{}).
+		Where("course_id = ?", collectionID).
+		Pluck("media_id", &gated).Error; err != nil {
+		return err
+	}
+	if len(gated) == 0 {
+		return nil
+	}
+	_, err := RevokeUserOfflineLicenses(userID, gated, "unenrolled")
+	return err
+}
+
+// AttachAccess fills in what their access rules mean for the viewer on
+// the listed items. Like progress it is a nicety there, since playback
+// checks again, so failures are only logged.
+func AttachAccess(ctx context.Context, viewer Viewer, items []api.MediaItem) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if !viewer.canEditOwned(item.OwnerID) {
+			ids = append(ids, item.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	e, err := loadEntitlements(viewer, ids)
+	if err == nil {
+		for i := range items {
+			if items[i].Access, err = e.access(ctx, items[i].ID); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		config.Log.WithError(err).WithField("user_id", viewer.UserID).Warn("failed to load media access")
+	}
+}
+
+func ToAPIMediaAccess(rule *models.MediaAccess) api.MediaAccessRule {
+	return api.MediaAccessRule{
+		MediaID:         rule.MediaID,
+		Roles:           nonNil(rule.Roles),
+		Cohorts:         nonNil(rule.Cohorts),
+		CourseID:        rule.CourseID,
+		AvailableFrom:   rule.AvailableFrom,
+		AvailableUntil:  rule.AvailableUntil,
+		DripDays:        rule.DripDays,
+		RequirePrevious: rule.RequirePrevious,
+		UpdatedAt:       rule.UpdatedAt,
+	}
+}
+
+func ToAPIEnrollment(e *models.Enrollment) api.Enrollment {
+	return api.Enrollment{
+		CollectionID: e.CollectionID,
+		UserID:       e.UserID,
+		EnrolledAt:   e.EnrolledAt,
+		ExpiresAt:    e.ExpiresAt,
+	}
+}
+
+// whereEntitled limits query, over media_items, to items whose access rule
+// lets the viewer see them: they hold one of its roles, are a member of
+// one of its cohorts, are enrolled in its course, and it has not expired. Owners see their items
+// regardless, as with visibleRows.
+func whereEntitled(query *gorm.DB, viewer Viewer) *gorm.DB {
+	now := time.Now()
+	return query.Where(`media_items.owner_id = ? OR NOT EXISTS (
+		SELECT 1 FROM media_accesses WHERE media_accesses.media_id = media_items.id AND (
+			media_accesses.available_until <= ?
+			OR (media_accesses.roles <> '[]'::jsonb OR media_accesses.cohorts <> '[]'::jsonb)
+				AND NOT media_accesses.roles @> ?
+				AND NOT EXISTS (SELECT 1 FROM cohort_members WHERE cohort_members.user_id = ?
+					AND media_accesses.cohorts @> jsonb_build_array(cohort_members.cohort))
+			OR media_accesses.course_id IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM enrollments WHERE enrollments.collection_id = media_accesses.course_id
+					AND enrollments.user_id = ? AND (enrollments.expires_at IS NULL OR enrollments.expires_at > ?))))`,
+		viewer.UserID, now, models.StringList{viewer.Role}, viewer.UserID, viewer.UserID, now)
+}
+
+// entitled reports whether item's access rule, if any, lets the viewer
+// see it.
+func entitled(viewer Viewer, item *models.MediaItem) (bool, error) {
+	if viewer.CanEdit(item) {
+		return true, nil
+	}
+	e, err := loadEntitlements(viewer, []uint{item.ID})
+	if err != nil {
+		return false, err
+	}
+	return !e.hides(item.ID), nil
+}
+
+// requireUnlocked refuses to hand out a locked item's media to anyone but
+// its editors. It returns what the item's access rule means for the
+// viewer, or nil if it has none.
+func requireUnlocked(ctx context.Context, viewer Viewer, item *models.MediaItem) (*api.MediaAccess, error) {
+	if viewer.CanEdit(item) {
+		return nil, nil
+	}
+	e, err := loadEntitlements(viewer, []uint{item.ID})
+	if err != nil {
+		return nil, err
+	}
+	access, err := e.access(ctx, item.ID)
+	if err != nil || access == nil || !access.Locked {
+		return access, err
+	}
+
+	switch access.Reason {
+	case api.LockPrevious:
+		return nil, apperror.ErrLocked.WithDetail(fmt.Sprintf("Complete the earlier lessons of the course before %q", item.Title))
+	default:
+		return nil, apperror.ErrLocked.WithDetail(fmt.Sprintf("%q unlocks at %s",
+			item.Title, access.UnlocksAt.UTC().Format(time.RFC3339)))
+	}
+}
+
+// accessEnds returns when the viewer's access to the first of items to
+// become unavailable to them ends, or nil if none does.
+func accessEnds(viewer Viewer, items []*models.MediaItem) (*time.Time, error) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if !viewer.CanEdit(item) {
+			ids = append(ids, item.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	e, err := loadEntitlements(viewer, ids)
+	if err != nil {
+		return nil, err
+	}
+	var ends *time.Time
+	for _, id := range ids {
+		if until := e.until(id); until != nil && (ends == nil || until.Before(*ends)) {
+			ends = until
+		}
+	}
+	return ends, nil
+}
+
+// entitlements holds what decides the viewer's access to some items: their
+// rules and the viewer's enrollments in the courses the rules name.
+type entitlements struct {
+	viewer Viewer
+	now    time.Time
+	rules  map[uint]*models.MediaAccess
+	// Cohorts the viewer is in, looked up only if a rule names any
+	cohorts []string
+	// Active enrollments by course
+	enrollments map[uint]*models.Enrollment
+	// Playable items of each course, in order, once needed
+	courses map[uint][]models.MediaItem
+}
+
+func loadEntitlements(viewer Viewer, ids []uint) (*entitlements, error) {
+	e := &entitlements{
+		viewer:      viewer,
+		now:         time.Now(),
+		rules:       make(map[uint]*models.MediaAccess),
+		enrollments: make(map[uint]*models.Enrollment),
+		courses:     make(map[uint][]models.MediaItem),
+	}
+	var rules []models.MediaAccess
+	if err := config.DB.Where("media_id IN ?", ids).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	var courses []uint
+	namesCohorts := false
+	for i := range rules {
+		e.rules[rules[i].MediaID] = &rules[i]
+		if rules[i].CourseID != nil {
+			courses = append(courses, *rules[i].CourseID)
+		}
+		namesCohorts = namesCohorts || len(rules[i].Cohorts) > 0
+	}
+	if viewer.UserID == 0 {
+		return e, nil
+	}
+	if namesCohorts {
+		if err := config.DB.Model(&models.CohortMember{}).
+			Where("user_id = ?", viewer.UserID).
+			Pluck("cohort", &e.cohorts).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(courses) == 0 {
+		return e, nil
+	}
+
+	var enrollments []models.Enrollment
+	if err := config.DB.
+		Where("user_id = ? AND collection_id IN ?", viewer.UserID, courses).
+		Where("expires_at IS NULL OR expires_at > ?", e.now).
+		Find(&enrollments).Error; err != nil {
+		return nil, err
+	}
+	for i := range enrollments {
+		e.enrollments[enrollments[i].CollectionID] = &enrollments[i]
+	}
+	return e, nil
+}
+
+// hides reports whether the item's rule keeps it from the viewer
+// altogether, matching whereEntitled.
+func (e *entitlements) hides(id uint) bool {
+	rule := e.rules[id]
+	if rule == nil {
+		return false
+	}
+	if rule.AvailableUntil != nil && !rule.AvailableUntil.After(e.now) {
+		return true
+	}
+	if len(rule.Roles) > 0 || len(rule.Cohorts) > 0 {
+		member := slices.Contains(rule.Roles, e.viewer.Role) ||
+			slices.ContainsFunc(rule.Cohorts, func(c string) bool { return slices.Contains(e.cohorts, c) })
+		if !member {
+			return true
+		}
+	}
+	return rule.CourseID != nil && e.enrollments[*rule.CourseID] == nil
+}
+
+// until returns when the viewer's access to the item ends, if it does:
+// when its rule expires or their enrollment in its course does.
+func (e *entitlements) until(id uint) *time.Time {
+	rule := e.rules[id]
+	if rule == nil {
+		return nil
+	}
+	until := rule.AvailableUntil
+	if rule.CourseID != nil {
+		if enrollment := e.enrollments[*rule.CourseID]; enrollment != nil && enrollment.ExpiresAt != nil &&
+			(until == nil || enrollment.ExpiresAt.Before(*until)) {
+			until = enrollment.ExpiresAt
+		}
+	}
+	return until
+}
+
+// access works out whether an item the viewer is entitled to is unlocked
+// for them yet, and until when they may play it.
+func (e *entitlements) access(ctx context.Context, id uint) (*api.MediaAccess, error) {
+	rule := e.rules[id]
+	if rule == nil {
+		return nil, nil
+	}
+	access := &api.MediaAccess{AvailableUntil: e.until(id)}
+	var enrollment *models.Enrollment
+	if rule.CourseID != nil {
+		enrollment = e.enrollments[*rule.CourseID]
+	}
+
+	// The later of the time locks is the one that matters
+	if rule.AvailableFrom != nil && rule.AvailableFrom.After(e.now) {
+		access.Locked, access.Reason, access.UnlocksAt = true, api.LockAvailableFrom, rule.AvailableFrom
+	}
+	if enrollment != nil && rule.DripDays > 0 {
+		unlocks := enrollment.EnrolledAt.AddDate(0, 0, rule.DripDays)
+		if unlocks.After(e.now) && (access.UnlocksAt == nil || unlocks.After(*access.UnlocksAt)) {
+			access.Locked, access.Reason, access.UnlocksAt = true, api.LockDrip, &unlocks
+		}
+	}
+	if access.Locked || !rule.RequirePrevious || rule.CourseID == nil {
+		return access, nil
+	}
+
+	prerequisites, err := e.prerequisites(ctx, *rule.CourseID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(prerequisites) > 0 {
+		access.Locked, access.Reason, access.Prerequisites = true, api.LockPrevious, prerequisites
+	}
+	return access, nil
+}
+
+// prerequisites returns the items before id in the course that the viewer
+// has yet to complete. Documents and items the viewer cannot see do not
+// count.
+func (e *entitlements) prerequisites(ctx context.Context, courseID, id uint) ([]uint, error) {
+	items, ok := e.courses[courseID]
+	if !ok {
+		var course models.Collection
+		err := config.DB.First(&course, courseID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			if items, err = collectionPlaylist(e.viewer, &course, map[uint]bool{}, 1); err != nil {
+				return nil, err
+			}
+		}
+		e.courses[courseID] = items
+	}
+
+	var earlier []uint
+	found := false
+	for i := range items {
+		if items[i].ID == id {
+			found = true
+			break
+		}
+		if items[i].Type != models.MediaTypeDocument {
+			earlier = append(earlier, items[i].ID)
+		}
+	}
+	if !found || len(earlier) == 0 {
+		return nil, nil
+	}
+	progress, err := loadProgress(ctx, e.viewer.UserID, earlier)
+	if err != nil {
+		return nil, err
+	}
+	var pending []uint
+	for _, mediaID := range earlier {
+		if p := progress[mediaID]; p == nil || !p.Completed {
+			pending = append(pending, mediaID)
+		}
+	}
+	return pending, nil
+}
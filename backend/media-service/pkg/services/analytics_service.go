@@ -0,0 +1,644 @@
+// media-service/pkg/services/analytics_service.go
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Heartbeats queue what they played on a Redis list, and RunAnalyticsRollup
+// folds the queue into a row per viewer and day and a map of the seconds
+// each viewer has played. Reports only read those.
+const (
+	analyticsEventsKey = "analytics:events"
+	// Events rolled up per transaction
+	analyticsRollupBatch = 1000
+	// Coverage maps never grow beyond this many seconds
+	maxCoverageSeconds = 1 << 16
+)
+
+// engagementSortColumns whitelists the sort keys of engagement reports.
+var engagementSortColumns = map[string]string{
+	"unique_viewers":  "unique_viewers",
+	"plays":           "plays",
+	"watch_seconds":   "watch_seconds",
+	"percent_watched": "AVG(media_coverages.watched_seconds) / NULLIF(media_items.duration_seconds, 0)",
+	"title":           "media_items.title",
+}
+
+// AnalyticsFilter selects the viewing a report covers.
+type AnalyticsFilter struct {
+	// First and last UTC day, inclusive
+	From time.Time
+	To   time.Time
+	// Only viewers in this cohort, if set
+	Cohort string
+	// Break each day down by cohort
+	ByCohort bool
+}
+
+// analyticsEvent is what one heartbeat adds to the reports.
+type analyticsEvent struct {
+	UserID  uint `json:"u"`
+	MediaID uint `json:"m"`
+	// Unix milliseconds
+	At   int64 `json:"t"`
+	Play bool  `json:"p,omitempty"`
+	// Part of the item played, and the time it took
+	Start float64 `json:"s,omitempty"`
+	End   float64 `json:"e,omitempty"`
+	Watch float64 `json:"w,omitempty"`
+}
+
+// engagementRow is a row of the engagement queries.
+type engagementRow struct {
+	MediaID               uint
+	Title                 string
+	DurationSeconds       int
+	Cohort                string
+	UniqueViewers         int64
+	Plays                 int64
+	WatchSeconds          float64
+	AverageWatchedSeconds *float64
+}
+
+// MediaAnalytics reports how an item the viewer may edit was watched.
+func MediaAnalytics(viewer Viewer, id uint, filter AnalyticsFilter) (*api.MediaAnalytics, error) {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	report := &api.MediaAnalytics{
+		MediaID:         item.ID,
+		Title:           item.Title,
+		DurationSeconds: item.DurationSeconds,
+		From:            filter.From.Format(time.DateOnly),
+		To:              filter.To.Format(time.DateOnly),
+		Cohort:          filter.Cohort,
+		Days:            []api.AnalyticsDay{},
+		Cohorts:         []api.AnalyticsCohort{},
+		Retention:       []api.RetentionPoint{},
+	}
+
+	var totals []engagementRow
+	if err := engagementQuery(analyticsViewers(filter).Where("media_id = ?", id)).
+		Select(engagementColumns).
+		Scan(&totals).Error; err != nil {
+		return nil, err
+	}
+	if len(totals) > 0 {
+		report.Totals = totals[0].totals()
+	}
+
+	days := analyticsViewers(filter).Where("media_id = ?", id)
+	if filter.ByCohort {
+		days = withCohorts(days, filter).
+			Select("day, COALESCE(cohort, '') AS cohort, COUNT(*) AS unique_viewers, SUM(plays) AS plays, SUM(watch_seconds) AS watch_seconds").
+			Group("day, cohort").
+			Order("day").
+			Order("cohort")
+	} else {
+		days = days.
+			Select("day, COUNT(*) AS unique_viewers, SUM(plays) AS plays, SUM(watch_seconds) AS watch_seconds").
+			Group("day").
+			Order("day")
+	}
+	var dayRows []struct {
+		Day time.Time
+		engagementRow
+	}
+	if err := days.Scan(&dayRows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range dayRows {
+		day := api.AnalyticsDay{
+			Date:          row.Day.Format(time.DateOnly),
+			UniqueViewers: row.UniqueViewers,
+			Plays:         row.Plays,
+			WatchSeconds:  roundTenth(row.WatchSeconds),
+		}
+		if filter.ByCohort {
+			day.Cohort = &row.Cohort
+		}
+		report.Days = append(report.Days, day)
+	}
+
+	perCohort := withCohorts(analyticsViewers(filter).Where("media_id = ?", id), filter).
+		Select("user_id, COALESCE(cohort, '') AS cohort, SUM(plays) AS plays, SUM(watch_seconds) AS watch_seconds").
+		Group("user_id, cohort")
+	var cohortRows []engagementRow
+	if err := config.DB.Table("(?) AS v", perCohort).
+		Joins("LEFT JOIN media_coverages ON media_coverages.media_id = ? AND media_coverages.user_id = v.user_id", id).
+		Select("v.cohort, COUNT(*) AS unique_viewers, SUM(v.plays) AS plays, SUM(v.watch_seconds) AS watch_seconds, " +
+			"AVG(media_coverages.watched_seconds) AS average_watched_seconds").
+		Group("v.cohort").
+		Order("v.cohort").
+		Scan(&cohortRows).Error; err != nil {
+		return nil, err
+	}
+	for i := range cohortRows {
+		cohortRows[i].DurationSeconds = item.DurationSeconds
+		report.Cohorts = append(report.Cohorts, api.AnalyticsCohort{
+			Cohort:           cohortRows[i].Cohort,
+			EngagementTotals: cohortRows[i].totals(),
+		})
+	}
+
+	if report.Retention, err = retentionCurve(item, filter); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// EngagementReport returns a page of how the items the viewer may edit
+// were watched, most watched first unless sorted otherwise. Items nobody
+// watched are left out.
+func EngagementReport(viewer Viewer, filter AnalyticsFilter, page Page) ([]api.EngagementItem, int64, error) {
+	if !viewer.CanPublish() {
+		return nil, 0, apperror.ErrForbidden.WithDetail("Only trainers and admins can see engagement reports")
+	}
+	order, err := engagementOrder(page.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+	viewers := func() *gorm.DB {
+		query := analyticsViewers(filter)
+		if !viewer.IsAdmin() {
+			query = query.Where("media_id IN (?)",
+				config.DB.Model(&models.MediaItem{}).Select("id").Where("owner_id = ?", viewer.UserID))
+		}
+		return query
+	}
+
+	var total int64
+	if err := config.DB.Table("(?) AS items", engagementQuery(viewers()).Select("media_items.id")).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var rows []engagementRow
+	if err := engagementQuery(viewers()).
+		Select(engagementColumns).
+		Order(order).
+		Order("media_items.id").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Scan(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]api.EngagementItem, 0, len(rows))
+	for i := range rows {
+		items = append(items, api.EngagementItem{
+			MediaID:          rows[i].MediaID,
+			Title:            rows[i].Title,
+			DurationSeconds:  rows[i].DurationSeconds,
+			EngagementTotals: rows[i].totals(),
+		})
+	}
+	return items, total, nil
+}
+
+// WriteAnalyticsCSV writes one table of an item's report, days, cohorts or
+// retention, as CSV.
+func WriteAnalyticsCSV(w io.Writer, report *api.MediaAnalytics, table string) error {
+	out := csv.NewWriter(w)
+	switch table {
+	case api.AnalyticsCohorts:
+		out.Write([]string{"cohort", "unique_viewers", "plays", "watch_seconds", "average_percent_watched"})
+		for _, c := range report.Cohorts {
+			out.Write(append([]string{c.Cohort}, totalsRecord(c.EngagementTotals)...))
+		}
+	case api.AnalyticsRetention:
+		out.Write([]string{"second", "viewers", "percent"})
+		for _, p := range report.Retention {
+			out.Write([]string{strconv.Itoa(p.Second), strconv.FormatInt(p.Viewers, 10), formatTenth(p.Percent)})
+		}
+	default:
+		out.Write([]string{"date", "cohort", "unique_viewers", "plays", "watch_seconds"})
+		for _, d := range report.Days {
+			cohort := report.Cohort
+			if d.Cohort != nil {
+				cohort = *d.Cohort
+			}
+			out.Write([]string{
+				d.Date, cohort, strconv.FormatInt(d.UniqueViewers, 10), strconv.FormatInt(d.Plays, 10), formatTenth(d.WatchSeconds),
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteEngagementCSV writes an engagement report as CSV.
+func WriteEngagementCSV(w io.Writer, items []api.EngagementItem) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"media_id", "title", "duration_seconds", "unique_viewers", "plays", "watch_seconds", "average_percent_watched"})
+	for _, item := range items {
+		out.Write(append([]string{
+			strconv.FormatUint(uint64(item.MediaID), 10), item.Title, strconv.Itoa(item.DurationSeconds),
+		}, totalsRecord(item.EngagementTotals)...))
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// RunAnalyticsRollup folds queued playback events into the report tables
+// every interval until ctx is cancelled.
+func RunAnalyticsRollup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n, err := RollupAnalytics(ctx); err != nil {
+			config.Log.WithError(err).Error("analytics rollup failed")
+		} else if n > 0 {
+			config.Log.WithField("count", n).Debug("rolled up playback events")
+		}
+	}
+}
+
+// RollupAnalytics folds every queued playback event into the report tables
+// and returns how many it folded. Instances may roll up concurrently; each
+// event is taken by one of them.
+func RollupAnalytics(ctx context.Context) (int, error) {
+	rolled := 0
+	for {
+		raw, err := config.RedisClient.LPopCount(ctx, analyticsEventsKey, analyticsRollupBatch).Result()
+		if errors.Is(err, redis.Nil) || (err == nil && len(raw) == 0) {
+			return rolled, nil
+		}
+		if err != nil {
+			return rolled, err
+		}
+
+		events := make([]analyticsEvent, 0, len(raw))
+		for _, r := range raw {
+			var e analyticsEvent
+			if err := json.Unmarshal([]byte(r), &e); err != nil {
+				config.Log.WithError(err).Warn("dropped malformed playback event")
+				continue
+			}
+			events = append(events, e)
+		}
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			return rollupEvents(tx, events)
+		})
+		if err != nil {
+			// Leave them for the next rollup
+			requeue := make([]interface{}, len(raw))
+			for i, r := range raw {
+				requeue[i] = r
+			}
+			if rerr := config.RedisClient.RPush(ctx, analyticsEventsKey, requeue...).Err(); rerr != nil {
+				config.Log.WithError(rerr).WithField("count", len(raw)).Error("lost playback events")
+			}
+			return rolled, err
+		}
+		rolled += len(events)
+	}
+}
+
+// queueAnalyticsEvent adds what a heartbeat played to the events awaiting
+// rollup. A heartbeat after a pause longer than progress.max_gap starts a
+// new play.
+func queueAnalyticsEvent(ctx context.Context, pipe redis.Pipeliner, viewer Viewer, id uint, state *progressState, hb api.ProgressHeartbeat, rate float64, now time.Time) {
+	event := analyticsEvent{
+		UserID:  viewer.UserID,
+		MediaID: id,
+		At:      now.UnixMilli(),
+		Play:    state.PlayedAt.IsZero() || now.Sub(state.PlayedAt) > config.Config.Progress.MaxGap,
+	}
+	start, end, played := playedSpan(state, hb, rate, now)
+	if played {
+		event.Start, event.End, event.Watch = start, end, (end-start)/rate
+	}
+	if !played && !event.Play {
+		return
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		config.Log.WithError(err).WithField("media_id", id).Warn("failed to queue playback event")
+		return
+	}
+	pipe.RPush(ctx, analyticsEventsKey, data)
+}
+
+// rollupEvents adds events to the daily viewer rows and coverage maps,
+// counting viewers in the cohorts they are in as the events are rolled up.
+// Rows are written in key order so concurrent rollups cannot deadlock.
+func rollupEvents(tx *gorm.DB, events []analyticsEvent) error {
+	type dayKey struct {
+		mediaID, userID uint
+		day             time.Time
+	}
+	type pairKey struct{ mediaID, userID uint }
+
+	userIDs := make([]uint, 0, len(events))
+	for _, e := range events {
+		userIDs = append(userIDs, e.UserID)
+	}
+	var members []models.CohortMember
+	if err := tx.Where("user_id IN ?", userIDs).Order("cohort").Find(&members).Error; err != nil {
+		return err
+	}
+	cohorts := make(map[uint][]string)
+	for _, m := range members {
+		cohorts[m.UserID] = append(cohorts[m.UserID], m.Cohort)
+	}
+
+	now := time.Now()
+	days := make(map[dayKey]*models.MediaDailyViewer)
+	played := make(map[pairKey][]byte)
+	for _, e := range events {
+		key := dayKey{e.MediaID, e.UserID, time.UnixMilli(e.At).UTC().Truncate(24 * time.Hour)}
+		row := days[key]
+		if row == nil {
+			row = &models.MediaDailyViewer{UpdatedAt: now, MediaID: e.MediaID, Day: key.day, UserID: e.UserID}
+			days[key] = row
+		}
+		row.Cohorts = cleanList(cohorts[e.UserID])
+		if e.Play {
+			row.Plays++
+		}
+		if e.End > e.Start {
+			row.WatchSeconds += e.Watch
+			pair := pairKey{e.MediaID, e.UserID}
+			played[pair] = markSeconds(played[pair], e.Start, e.End)
+		}
+	}
+	if len(days) == 0 {
+		return nil
+	}
+
+	rows := make([]models.MediaDailyViewer, 0, len(days))
+	for _, row := range days {
+		rows = append(rows, *row)
+	}
+	slices.SortFunc(rows, func(a, b models.MediaDailyViewer) int {
+		if a.MediaID != b.MediaID {
+			return int(a.MediaID) - int(b.MediaID)
+		}
+		if c := a.Day.Compare(b.Day); c != 0 {
+			return c
+		}
+		return int(a.UserID) - int(b.UserID)
+	})
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "media_id"}, {Name: "day"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"plays":         gorm.Expr("media_daily_viewers.plays + excluded.plays"),
+			"watch_seconds": gorm.Expr("media_daily_viewers.watch_seconds + excluded.watch_seconds"),
+			"cohorts":       gorm.Expr("excluded.cohorts"),
+			"updated_at":    gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&rows).Error; err != nil {
+		return err
+	}
+	if len(played) == 0 {
+		return nil
+	}
+
+	pairs := make([]pairKey, 0, len(played))
+	for pair := range played {
+		pairs = append(pairs, pair)
+	}
+	slices.SortFunc(pairs, func(a, b pairKey) int {
+		if a.mediaID != b.mediaID {
+			return int(a.mediaID) - int(b.mediaID)
+		}
+		return int(a.userID) - int(b.userID)
+	})
+	stubs := make([]models.MediaCoverage, len(pairs))
+	tuples := make([][]interface{}, len(pairs))
+	for i, pair := range pairs {
+		stubs[i] = models.MediaCoverage{UpdatedAt: now, MediaID: pair.mediaID, UserID: pair.userID, Seconds: []byte{}}
+		tuples[i] = []interface{}{pair.mediaID, pair.userID}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stubs).Error; err != nil {
+		return err
+	}
+
+	var coverages []models.MediaCoverage
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("(media_id, user_id) IN ?", tuples).
+		Order("media_id").
+		Order("user_id").
+		Find(&coverages).Error; err != nil {
+		return err
+	}
+	for i := range coverages {
+		c := &coverages[i]
+		seconds := mergeSeconds(c.Seconds, played[pairKey{c.MediaID, c.UserID}])
+		watched := countSeconds(seconds)
+		if watched == c.WatchedSeconds {
+			continue
+		}
+		if err := tx.Model(c).Updates(map[string]interface{}{
+			"seconds":         seconds,
+			"watched_seconds": watched,
+			"updated_at":      now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// analyticsViewers selects the daily viewer rows a report covers.
+func analyticsViewers(filter AnalyticsFilter) *gorm.DB {
+	query := config.DB.Model(&models.MediaDailyViewer{}).
+		Where("day BETWEEN ? AND ?", filter.From.Format(time.DateOnly), filter.To.Format(time.DateOnly))
+	if filter.Cohort != "" {
+		query = query.Where("media_daily_viewers.cohorts @> ?", models.StringList{filter.Cohort})
+	}
+	return query
+}
+
+// withCohorts repeats each daily viewer row for every cohort the viewer
+// was in, as the cohort column, or once with a NULL cohort if in none.
+func withCohorts(query *gorm.DB, filter AnalyticsFilter) *gorm.DB {
+	query = query.Joins("LEFT JOIN LATERAL jsonb_array_elements_text(media_daily_viewers.cohorts) AS c(cohort) ON true")
+	if filter.Cohort != "" {
+		query = query.Where("cohort = ?", filter.Cohort)
+	}
+	return query
+}
+
+const engagementColumns = "media_items.id AS media_id, media_items.title, media_items.duration_seconds, " +
+	"COUNT(*) AS unique_viewers, SUM(v.plays) AS plays, SUM(v.watch_seconds) AS watch_seconds, " +
+	"AVG(media_coverages.watched_seconds) AS average_watched_seconds"
+
+// engagementQuery sums up, per item, the daily viewer rows selected by
+// viewers, to be selected with engagementColumns.
+func engagementQuery(viewers *gorm.DB) *gorm.DB {
+	perUser := viewers.
+		Select("media_id, user_id, SUM(plays) AS plays, SUM(watch_seconds) AS watch_seconds").
+		Group("media_id, user_id")
+	return config.DB.Table("(?) AS v", perUser).
+		Joins("JOIN media_items ON media_items.id = v.media_id AND media_items.deleted_at IS NULL").
+		Joins("LEFT JOIN media_coverages ON media_coverages.media_id = v.media_id AND media_coverages.user_id = v.user_id").
+		Group("media_items.id")
+}
+
+func engagementOrder(sort string) (string, error) {
+	if sort == "" {
+		return "unique_viewers DESC", nil
+	}
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	column, ok := engagementSortColumns[sort]
+	if !ok {
+		return "", apperror.Validation(apperror.FieldError{
+			Field: "sort", Code: "oneof", Message: "must be one of: unique_viewers, plays, watch_seconds, percent_watched, title",
+		})
+	}
+	return column + " " + direction + " NULLS LAST", nil
+}
+
+// retentionCurve counts, for every second of the item, how many of the
+// viewers the filter selects have played it.
+func retentionCurve(item *models.MediaItem, filter AnalyticsFilter) ([]api.RetentionPoint, error) {
+	viewers := analyticsViewers(filter).Where("media_id = ?", item.ID).Select("user_id")
+	var coverages []models.MediaCoverage
+	if err := config.DB.Select("seconds").
+		Where("media_id = ? AND user_id IN (?)", item.ID, viewers).
+		Find(&coverages).Error; err != nil {
+		return nil, err
+	}
+	points := []api.RetentionPoint{}
+	if len(coverages) == 0 {
+		return points, nil
+	}
+
+	length := item.DurationSeconds
+	if length <= 0 {
+		// Unknown; go as far as anyone played
+		for _, c := range coverages {
+			length = max(length, lastSecond(c.Seconds)+1)
+		}
+	}
+	length = min(length, maxCoverageSeconds)
+	counts := make([]int64, length)
+	for _, c := range coverages {
+		for s := range counts {
+			if s/8 >= len(c.Seconds) {
+				break
+			}
+			if c.Seconds[s/8]&(0x80>>(s%8)) != 0 {
+				counts[s]++
+			}
+		}
+	}
+	for s, n := range counts {
+		points = append(points, api.RetentionPoint{
+			Second:  s,
+			Viewers: n,
+			Percent: roundTenth(100 * float64(n) / float64(len(coverages))),
+		})
+	}
+	return points, nil
+}
+
+func (r *engagementRow) totals() api.EngagementTotals {
+	totals := api.EngagementTotals{
+		UniqueViewers: r.UniqueViewers,
+		Plays:         r.Plays,
+		WatchSeconds:  roundTenth(r.WatchSeconds),
+	}
+	if r.AverageWatchedSeconds != nil && r.DurationSeconds > 0 {
+		percent := roundTenth(math.Min(100, 100**r.AverageWatchedSeconds/float64(r.DurationSeconds)))
+		totals.AveragePercentWatched = &percent
+	}
+	return totals
+}
+
+func totalsRecord(t api.EngagementTotals) []string {
+	percent := ""
+	if t.AveragePercentWatched != nil {
+		percent = formatTenth(*t.AveragePercentWatched)
+	}
+	return []string{
+		strconv.FormatInt(t.UniqueViewers, 10), strconv.FormatInt(t.Plays, 10), formatTenth(t.WatchSeconds), percent,
+	}
+}
+
+// markSeconds sets the seconds played from start to end in a coverage
+// map. Like watched buckets, a second counts once playback passes its
+// start.
+func markSeconds(seconds []byte, start, end float64) []byte {
+	from := int(math.Ceil(start))
+	to := min(int(math.Ceil(end))-1, maxCoverageSeconds-1)
+	for s := from; s <= to; s++ {
+		for len(seconds) <= s/8 {
+			seconds = append(seconds, 0)
+		}
+		seconds[s/8] |= 0x80 >> (s % 8)
+	}
+	return seconds
+}
+
+func mergeSeconds(a, b []byte) []byte {
+	if len(b) > len(a) {
+		a, b = b, a
+	}
+	merged := slices.Clone(a)
+	for i := range b {
+		merged[i] |= b[i]
+	}
+	return merged
+}
+
+func countSeconds(seconds []byte) int {
+	n := 0
+	for _, b := range seconds {
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// lastSecond returns the last second set in a coverage map, or -1.
+func lastSecond(seconds []byte) int {
+	for i := len(seconds) - 1; i >= 0; i-- {
+		if seconds[i] != 0 {
+			return i*8 + 7 - bits.TrailingZeros8(seconds[i])
+		}
+	}
+	return -1
+}
+
+func roundTenth(v float64) float64 {
+	return math.Round(v*10) / 10
+}
+
+func formatTenth(v float64) string {
+	return strconv.FormatFloat(roundTenth(v), 'f', -1, 64)
+}
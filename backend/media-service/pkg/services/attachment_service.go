@@ -0,0 +1,694 @@
+// media-service/pkg/services/attachment_service.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/documents"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/scan"
+	"shepherdsfold/media-service/pkg/storage"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Attachment jobs, which belong to the attachment's item if it has one
+const (
+	JobScanAttachment    = "attachments.scan"
+	JobPreviewAttachment = "attachments.preview"
+)
+
+// AttachmentJob is the payload of the attachment jobs.
+type AttachmentJob struct {
+	AttachmentID uint `json:"attachment_id"`
+}
+
+// AttachmentOwner is what an attachment goes with: an item or a
+// collection.
+type AttachmentOwner struct {
+	MediaID      uint
+	CollectionID uint
+}
+
+// AttachmentUpload describes an uploaded document.
+type AttachmentUpload struct {
+	Title    string
+	FileName string
+	// As sent by the client; the file name's extension wins
+	ContentType string
+}
+
+func init() {
+	RegisterBundleContributor(attachmentBundleFiles)
+}
+
+// RegisterAttachmentScanning starts handling JobScanAttachment with
+// config.Scanner.
+func RegisterAttachmentScanning() {
+	RegisterJobHandler(JobScanAttachment, scanAttachment)
+}
+
+// RegisterAttachmentPreviews starts handling JobPreviewAttachment with
+// config.Previewer.
+func RegisterAttachmentPreviews() {
+	RegisterJobHandler(JobPreviewAttachment, previewAttachment)
+}
+
+// ListAttachments returns the owner's attachments the viewer may see:
+// those that passed the virus scan, and all of them for editors.
+func ListAttachments(viewer Viewer, owner AttachmentOwner) ([]models.Attachment, error) {
+	canEdit, err := checkAttachmentOwner(viewer, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	query := config.DB
+	if owner.MediaID != 0 {
+		query = query.Where("media_id = ?", owner.MediaID)
+	} else {
+		query = query.Where("collection_id = ?", owner.CollectionID)
+	}
+	if !canEdit {
+		query = query.Where("key <> '' AND scan_status IN ?", downloadableScans)
+	}
+	var attachments []models.Attachment
+	err = query.Order("created_at, id").Find(&attachments).Error
+	return attachments, err
+}
+
+// AddAttachment stores a document read from r for the owner and queues it
+// for scanning, or for previews if scanning is off. Only the owner's
+// editors may attach documents, and only trainers to collections.
+func AddAttachment(ctx context.Context, viewer Viewer, owner AttachmentOwner, upload AttachmentUpload, r io.Reader) (*models.Attachment, error) {
+	if err := editableAttachmentOwner(viewer, owner); err != nil {
+		return nil, err
+	}
+
+	// Some browsers send the full path of the file
+	name := strings.TrimSpace(path.Base(strings.ReplaceAll(upload.FileName, `\`, "/")))
+	contentType, ok := documents.TypeByName(name)
+	if !ok {
+		contentType = strings.TrimSpace(strings.Split(upload.ContentType, ";")[0])
+		if _, known := documents.Types[contentType]; !known {
+			return nil, apperror.ErrUnsupportedMedia.WithDetail("Attach a PDF, slide deck, word processor or plain text file")
+		}
+	}
+	if name == "." || name == "/" {
+		name = "attachment" + documents.Types[contentType]
+	}
+	title := strings.TrimSpace(upload.Title)
+	if title == "" {
+		title = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	var fields []apperror.FieldError
+	if len(name) > 255 {
+		fields = append(fields, apperror.FieldError{Field: "file", Code: "max", Message: "file name must be at most 255 characters"})
+	}
+	if len(title) > 200 {
+		fields = append(fields, apperror.FieldError{Field: "title", Code: "max", Message: "must be at most 200 characters"})
+	}
+	if len(fields) > 0 {
+		return nil, apperror.Validation(fields...)
+	}
+
+	f, err := os.CreateTemp(config.Config.Transcode.WorkDir, "attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	digest := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, digest), r)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, apperror.Validation(apperror.FieldError{Field: "file", Code: "required", Message: "must not be empty"})
+	}
+	if documents.IsPDF(contentType) {
+		magic := make([]byte, 5)
+		if _, err := f.ReadAt(magic, 0); err != nil || !bytes.Equal(magic, []byte("%PDF-")) {
+			return nil, apperror.ErrUnsupportedMedia.WithDetail("File is not a PDF")
+		}
+	}
+
+	attachment := &models.Attachment{
+		Title:         title,
+		FileName:      name,
+		ContentType:   contentType,
+		Size:          size,
+		SHA256:        hex.EncodeToString(digest.Sum(nil)),
+		ScanStatus:    models.ScanPending,
+		PreviewStatus: models.PreviewPending,
+		CreatedBy:     viewer.UserID,
+	}
+	if owner.MediaID != 0 {
+		attachment.MediaID = &owner.MediaID
+	} else {
+		attachment.CollectionID = &owner.CollectionID
+	}
+	if config.Config.Attachments.Scanner == "" {
+		attachment.ScanStatus = models.ScanSkipped
+	}
+	if config.Previewer == nil {
+		attachment.PreviewStatus = models.PreviewUnavailable
+	}
+	if err := config.DB.Create(attachment).Error; err != nil {
+		return nil, err
+	}
+
+	key := attachmentRoot(attachment.ID) + "source" + documents.Types[contentType]
+	if err := storage.PutFile(ctx, config.Storage, key, f, size, contentType, config.Config.Storage.PartSize); err != nil {
+		if err := config.DB.Unscoped().Delete(attachment).Error; err != nil {
+			config.Log.WithError(err).WithField("attachment_id", attachment.ID).Error("failed to remove unstored attachment")
+		}
+		return nil, err
+	}
+
+	attachment.Key = key
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(attachment).Update("key", key).Error; err != nil {
+			return err
+		}
+		if err := queueAttachmentWork(tx, attachment); err != nil {
+			return err
+		}
+		return publishAttachmentEvent(tx, attachment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// GetAttachment finds an attachment the viewer may see.
+func GetAttachment(viewer Viewer, id uint) (*models.Attachment, error) {
+	attachment, _, err := visibleAttachment(viewer, id)
+	return attachment, err
+}
+
+func UpdateAttachment(viewer Viewer, id uint, req api.UpdateAttachmentRequest) (*models.Attachment, error) {
+	attachment, err := editableAttachment(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.Title == nil {
+		return attachment, nil
+	}
+	title := strings.TrimSpace(*req.Title)
+	if title == "" {
+		return nil, apperror.Validation(apperror.FieldError{Field: "title", Code: "required", Message: "is required"})
+	}
+	attachment.Title = title
+	if err := config.DB.Model(attachment).Update("title", title).Error; err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// DeleteAttachment removes an attachment at once. Its files go with the
+// storage lifecycle rules.
+func DeleteAttachment(viewer Viewer, id uint) error {
+	attachment, err := editableAttachment(viewer, id)
+	if err != nil {
+		return err
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(attachment).Error; err != nil {
+			return err
+		}
+		return publishAttachmentEvent(tx, attachment)
+	})
+}
+
+// AttachmentDownload hands out an attachment that passed its virus scan:
+// as a presigned storage URL where configured and supported, otherwise as
+// a file to serve. Attachments of items are locked along with the item.
+func AttachmentDownload(ctx context.Context, viewer Viewer, id uint) (string, *StreamFile, error) {
+	attachment, err := unlockedAttachment(ctx, viewer, id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if config.Config.Storage.PresignDownloads {
+		url, err := config.Storage.PresignGet(ctx, attachment.Key, config.Config.Streaming.URLTTL, attachment.FileName)
+		if !errors.Is(err, storage.ErrPresignUnsupported) {
+			return url, nil, err
+		}
+	}
+	file, err := openAttachmentObject(ctx, attachment.Key, attachment.ContentType)
+	if err != nil {
+		return "", nil, err
+	}
+	file.Name = attachment.FileName
+	file.DownloadName = attachment.FileName
+	if attachment.SHA256 != "" {
+		file.ETag = `"` + attachment.SHA256 + `"`
+	}
+	return "", file, nil
+}
+
+// AttachmentPage opens the thumbnail of a page, from 1.
+func AttachmentPage(ctx context.Context, viewer Viewer, id uint, page int) (*StreamFile, error) {
+	attachment, err := unlockedAttachment(ctx, viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.PreviewPrefix == "" || page < 1 || page > attachment.PreviewPages {
+		return nil, apperror.ErrNotFound.WithDetail("Page preview not found")
+	}
+	return openAttachmentObject(ctx, fmt.Sprintf("%s%d.jpg", attachment.PreviewPrefix, page), "image/jpeg")
+}
+
+func ToAPIAttachment(attachment *models.Attachment) api.Attachment {
+	out := api.Attachment{
+		ID:            attachment.ID,
+		MediaID:       attachment.MediaID,
+		CollectionID:  attachment.CollectionID,
+		Title:         attachment.Title,
+		FileName:      attachment.FileName,
+		ContentType:   attachment.ContentType,
+		Size:          attachment.Size,
+		ScanStatus:    attachment.ScanStatus,
+		ScanSignature: attachment.ScanSignature,
+		PreviewStatus: attachment.PreviewStatus,
+		PageCount:     attachment.PageCount,
+		Pages:         make([]string, 0, attachment.PreviewPages),
+		CreatedAt:     attachment.CreatedAt,
+		UpdatedAt:     attachment.UpdatedAt,
+	}
+	if attachmentDownloadable(attachment) {
+		out.DownloadURL = fmt.Sprintf("/api/media/attachments/%d/download", attachment.ID)
+		for n := 1; n <= attachment.PreviewPages; n++ {
+			out.Pages = append(out.Pages, fmt.Sprintf("/api/media/attachments/%d/pages/%d", attachment.ID, n))
+		}
+	}
+	return out
+}
+
+// downloadableScans are the scan states whose files may be handed out.
+var downloadableScans = []string{models.ScanClean, models.ScanSkipped}
+
+func attachmentDownloadable(attachment *models.Attachment) bool {
+	return attachment.Key != "" &&
+		(attachment.ScanStatus == models.ScanClean || attachment.ScanStatus == models.ScanSkipped)
+}
+
+// checkAttachmentOwner checks that the viewer may see the owner, and
+// reports whether they may change its attachments.
+func checkAttachmentOwner(viewer Viewer, owner AttachmentOwner) (bool, error) {
+	if owner.MediaID != 0 {
+		item, err := GetMedia(viewer, owner.MediaID)
+		if err != nil {
+			return false, err
+		}
+		return viewer.CanEdit(item), nil
+	}
+	collection, err := GetCollection(viewer, owner.CollectionID)
+	if err != nil {
+		return false, err
+	}
+	return viewer.CanEditCollection(collection) && viewer.CanPublish(), nil
+}
+
+func editableAttachmentOwner(viewer Viewer, owner AttachmentOwner) error {
+	canEdit, err := checkAttachmentOwner(viewer, owner)
+	if err != nil {
+		return err
+	}
+	if !canEdit {
+		return apperror.ErrForbidden.WithDetail("You cannot change the attachments here")
+	}
+	return nil
+}
+
+// visibleAttachment finds an attachment whose owner the viewer may see,
+// hiding those not cleared for download from all but editors, and
+// reports whether the viewer may change it.
+func visibleAttachment(viewer Viewer, id uint) (*models.Attachment, bool, error) {
+	notFound := apperror.ErrNotFound.WithDetail("Attachment not found")
+	var attachment models.Attachment
+	if err := config.DB.First(&attachment, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, notFound
+		}
+		return nil, false, err
+	}
+	canEdit, err := checkAttachmentOwner(viewer, attachmentOwner(&attachment))
+	if errors.Is(err, apperror.ErrNotFound) {
+		return nil, false, notFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !canEdit && !attachmentDownloadable(&attachment) {
+		return nil, false, notFound
+	}
+	return &attachment, canEdit, nil
+}
+
+func editableAttachment(viewer Viewer, id uint) (*models.Attachment, error) {
+	attachment, canEdit, err := visibleAttachment(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canEdit {
+		return nil, apperror.ErrForbidden.WithDetail("You cannot modify this attachment")
+	}
+	return attachment, nil
+}
+
+// unlockedAttachment finds an attachment the viewer may download now.
+func unlockedAttachment(ctx context.Context, viewer Viewer, id uint) (*models.Attachment, error) {
+	attachment, _, err := visibleAttachment(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case attachment.ScanStatus == models.ScanPending:
+		return nil, apperror.ErrNotReady.WithDetail("The attachment is still being scanned for viruses")
+	case !attachmentDownloadable(attachment):
+		return nil, apperror.ErrNotFound.WithDetail("The attachment failed its virus scan and cannot be downloaded")
+	}
+	if attachment.MediaID != nil {
+		item, err := GetMedia(viewer, *attachment.MediaID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkEmbargo(viewer, item); err != nil {
+			return nil, err
+		}
+		if _, err := requireUnlocked(ctx, viewer, item); err != nil {
+			return nil, err
+		}
+	}
+	return attachment, nil
+}
+
+func attachmentOwner(attachment *models.Attachment) AttachmentOwner {
+	var owner AttachmentOwner
+	if attachment.MediaID != nil {
+		owner.MediaID = *attachment.MediaID
+	}
+	if attachment.CollectionID != nil {
+		owner.CollectionID = *attachment.CollectionID
+	}
+	return owner
+}
+
+func openAttachmentObject(ctx context.Context, key, contentType string) (*StreamFile, error) {
+	info, err := config.Storage.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Attachment file not found")
+		}
+		return nil, err
+	}
+	obj, err := config.Storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamFile{
+		Object:      obj,
+		Name:        path.Base(key),
+		Size:        info.Size,
+		ModTime:     info.ModTime,
+		ContentType: contentType,
+		ETag:        fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(fmt.Sprintf("%s:%d", key, info.Size)))),
+	}, nil
+}
+
+// queueAttachmentWork queues what a newly stored attachment needs next.
+func queueAttachmentWork(tx *gorm.DB, attachment *models.Attachment) error {
+	payload := AttachmentJob{AttachmentID: attachment.ID}
+	switch {
+	case attachment.ScanStatus == models.ScanPending:
+		return EnqueueJob(tx, JobScanAttachment, attachmentMediaID(attachment), payload)
+	case attachment.PreviewStatus == models.PreviewPending:
+		return EnqueueJob(tx, JobPreviewAttachment, attachmentMediaID(attachment), payload)
+	}
+	return nil
+}
+
+// publishAttachmentEvent announces a change to an item's attachments,
+// which are part of its search document. Collections have none.
+func publishAttachmentEvent(tx *gorm.DB, attachment *models.Attachment) error {
+	if attachment.MediaID == nil {
+		return nil
+	}
+	return publishEvent(tx, EventAttachmentsChanged, *attachment.MediaID)
+}
+
+func attachmentMediaID(attachment *models.Attachment) uint {
+	if attachment.MediaID == nil {
+		return 0
+	}
+	return *attachment.MediaID
+}
+
+// attachmentText joins the extracted text of an item's downloadable
+// attachments, for its search document.
+func attachmentText(mediaID uint) (string, error) {
+	var texts []string
+	err := config.DB.Model(&models.Attachment{}).
+		Where("media_id = ? AND key <> '' AND scan_status IN ? AND text <> ''", mediaID, downloadableScans).
+		Order("created_at, id").
+		Pluck("text", &texts).Error
+	return strings.Join(texts, "\n"), err
+}
+
+// attachmentBundleFiles adds an item's downloadable attachments to
+// offline packages.
+func attachmentBundleFiles(ctx context.Context, item *models.MediaItem, quality string) ([]BundleFile, error) {
+	var attachments []models.Attachment
+	if err := config.DB.
+		Where("media_id = ? AND key <> '' AND scan_status IN ?", item.ID, downloadableScans).
+		Order("created_at, id").
+		Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	files := make([]BundleFile, 0, len(attachments))
+	for _, a := range attachments {
+		files = append(files, BundleFile{
+			Path:        fmt.Sprintf("attachments/%d/%s", a.ID, a.FileName),
+			Role:        "attachment",
+			ContentType: a.ContentType,
+			Key:         a.Key,
+			Size:        a.Size,
+		})
+	}
+	return files, nil
+}
+
+// scanAttachment checks a stored attachment for malware. Infected files
+// are removed from storage straight away; the attachment stays, marked,
+// so its editors can see what happened.
+func scanAttachment(ctx context.Context, job *models.ProcessingJob) error {
+	attachment, err := jobAttachment(job)
+	if err != nil || attachment == nil || attachment.ScanStatus != models.ScanPending {
+		return err
+	}
+	if config.Scanner == nil {
+		return errors.New("no virus scanner configured")
+	}
+
+	result, err := func() (scan.Result, error) {
+		obj, err := config.Storage.Open(ctx, attachment.Key)
+		if err != nil {
+			return scan.Result{}, err
+		}
+		defer obj.Close()
+		return config.Scanner.Scan(ctx, obj)
+	}()
+	if err != nil {
+		if job.Attempts >= config.Config.Jobs.MaxAttempts {
+			if err := config.DB.Model(attachment).Update("scan_status", models.ScanFailed).Error; err != nil {
+				config.Log.WithError(err).WithField("attachment_id", attachment.ID).Error("failed to record scan status")
+			}
+		}
+		return fmt.Errorf("scan: %w", err)
+	}
+
+	now := time.Now()
+	if !result.Clean {
+		if err := config.Storage.Delete(ctx, attachment.Key); err != nil {
+			return err
+		}
+		config.Log.WithFields(map[string]interface{}{
+			"attachment_id": attachment.ID,
+			"media_id":      job.MediaID,
+			"signature":     result.Signature,
+			"created_by":    attachment.CreatedBy,
+		}).Warn("removed infected attachment")
+		return config.DB.Model(attachment).Updates(map[string]interface{}{
+			"scan_status":    models.ScanInfected,
+			"scan_signature": result.Signature,
+			"scanned_at":     &now,
+			"key":            "",
+			"preview_status": models.PreviewUnavailable,
+		}).Error
+	}
+
+	attachment.ScanStatus = models.ScanClean
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(attachment).Updates(map[string]interface{}{
+			"scan_status": models.ScanClean,
+			"scanned_at":  &now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := queueAttachmentWork(tx, attachment); err != nil {
+			return err
+		}
+		return publishAttachmentEvent(tx, attachment)
+	})
+}
+
+// previewAttachment renders thumbnails of an attachment's first pages and
+// extracts its text for search.
+func previewAttachment(ctx context.Context, job *models.ProcessingJob) error {
+	attachment, err := jobAttachment(job)
+	if err != nil || attachment == nil || !attachmentDownloadable(attachment) {
+		return err
+	}
+	if config.Previewer == nil {
+		return errors.New("no document previewer configured")
+	}
+
+	workDir, err := os.MkdirTemp(config.Config.Transcode.WorkDir, "attachment-job-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	// LibreOffice goes by the extension
+	input := filepath.Join(workDir, "input"+documents.Types[attachment.ContentType])
+	if err := downloadObject(ctx, attachment.Key, input); err != nil {
+		return fmt.Errorf("download attachment: %w", err)
+	}
+	outDir := filepath.Join(workDir, "out")
+	if err := os.Mkdir(outDir, 0o755); err != nil {
+		return err
+	}
+
+	cfg := config.Config.Attachments
+	preview, err := config.Previewer.Preview(ctx, input, attachment.ContentType, outDir, documents.Options{
+		MaxPages: cfg.PreviewPages,
+		Width:    cfg.PreviewWidth,
+		MaxText:  cfg.MaxText,
+	})
+	if errors.Is(err, documents.ErrUnsupported) {
+		return config.DB.Model(attachment).Update("preview_status", models.PreviewUnavailable).Error
+	}
+	if err != nil {
+		if job.Attempts >= config.Config.Jobs.MaxAttempts {
+			if err := config.DB.Model(attachment).Update("preview_status", models.PreviewFailed).Error; err != nil {
+				config.Log.WithError(err).WithField("attachment_id", attachment.ID).Error("failed to record preview status")
+			}
+		}
+		return fmt.Errorf("preview: %w", err)
+	}
+
+	// A new prefix per run, so a repeated job never serves a mix of pages
+	prefix := ""
+	if len(preview.Pages) > 0 {
+		prefix = fmt.Sprintf("%spages/%d/", attachmentRoot(attachment.ID), time.Now().UnixMilli())
+		for i, page := range preview.Pages {
+			if err := putAttachmentPage(ctx, page, fmt.Sprintf("%s%d.jpg", prefix, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(attachment).Updates(map[string]interface{}{
+			"preview_status": models.PreviewReady,
+			"page_count":     preview.PageCount,
+			"preview_prefix": prefix,
+			"preview_pages":  len(preview.Pages),
+			"text":           preview.Text,
+		}).Error; err != nil {
+			return err
+		}
+		return publishAttachmentEvent(tx, attachment)
+	})
+	if err != nil {
+		return err
+	}
+	if attachment.PreviewPrefix != "" && attachment.PreviewPrefix != prefix {
+		deleteImagePrefix(ctx, attachment.PreviewPrefix)
+	}
+	return nil
+}
+
+func putAttachmentPage(ctx context.Context, name, key string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return config.Storage.Put(ctx, key, f, fi.Size(), "image/jpeg")
+}
+
+// jobAttachment loads the attachment of an attachment job; nil if it was
+// deleted meanwhile.
+func jobAttachment(job *models.ProcessingJob) (*models.Attachment, error) {
+	var payload AttachmentJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	var attachment models.Attachment
+	if err := config.DB.First(&attachment, payload.AttachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// attachmentRoot is the storage prefix of everything kept for an
+// attachment.
+func attachmentRoot(id uint) string {
+	return fmt.Sprintf("attachments/%d/", id)
+}
+
+// removeAttachments deletes the files and rows of attachments removed, or
+// whose item was deleted, before cutoff.
+func removeAttachments(ctx context.Context, cutoff time.Time) (int, error) {
+	var ids []uint
+	if err := config.DB.Unscoped().Model(&models.Attachment{}).
+		Where("deleted_at < ? OR media_id IN (SELECT id FROM media_items WHERE deleted_at < ?)", cutoff, cutoff).
+		Order("id").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if err := storage.DeletePrefix(ctx, config.Storage, attachmentRoot(id)); err != nil {
+			return 0, err
+		}
+		if err := config.DB.Unscoped().Delete(&models.Attachment{}, id).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
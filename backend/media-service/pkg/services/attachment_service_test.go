@@ -0,0 +1,189 @@
+// media-service/pkg/services/attachment_service_test.go
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/scan"
+	"shepherdsfold/media-service/pkg/testenv"
+	"strings"
+	"testing"
+)
+
+var (
+	attachmentEditor  = Viewer{UserID: 7, Role: models.RoleTrainer}
+	attachmentLearner = Viewer{UserID: 20, Role: "user"}
+)
+
+// addScannedAttachment attaches content to a public item with scanning on
+// and the given scanner, and returns the attachment awaiting its scan.
+func addScannedAttachment(t *testing.T, scanner scan.Scanner, content string) *models.Attachment {
+	t.Helper()
+	testenv.Setup(t)
+	config.Config.Attachments.Scanner = "fake"
+	config.Scanner = scanner
+	config.Previewer = nil
+	RegisterAttachmentScanning()
+
+	item := &models.MediaItem{
+		Title:      "Leading a Small Group",
+		Type:       models.MediaTypeVideo,
+		OwnerID:    attachmentEditor.UserID,
+		Visibility: models.VisibilityPublic,
+	}
+	if err := config.DB.Create(item).Error; err != nil {
+		t.Fatalf("create media: %v", err)
+	}
+	attachment, err := AddAttachment(context.Background(), attachmentEditor, AttachmentOwner{MediaID: item.ID},
+		AttachmentUpload{FileName: "handout.txt"}, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if attachment.ScanStatus != models.ScanPending {
+		t.Fatalf("scan status %q, want %q", attachment.ScanStatus, models.ScanPending)
+	}
+	return attachment
+}
+
+func reloadAttachment(t *testing.T, id uint) *models.Attachment {
+	t.Helper()
+	var attachment models.Attachment
+	if err := config.DB.First(&attachment, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &attachment
+}
+
+// downloadErr tries to download the attachment as viewer, and returns the
+// error or the bytes served.
+func downloadErr(t *testing.T, viewer Viewer, id uint) (string, error) {
+	t.Helper()
+	_, file, err := AttachmentDownload(context.Background(), viewer, id)
+	if err != nil {
+		return "", err
+	}
+	defer file.Object.Close()
+	data, err := io.ReadAll(file.Object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), nil
+}
+
+func TestScanAttachmentClean(t *testing.T) {
+	content := "Questions for discussion"
+	attachment := addScannedAttachment(t, &scan.FakeScanner{}, content)
+
+	// Nobody but its editors sees it until it is scanned
+	if _, err := GetAttachment(attachmentLearner, attachment.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("learner before scan: err %v, want %v", err, apperror.ErrNotFound)
+	}
+	if _, err := downloadErr(t, attachmentEditor, attachment.ID); !errors.Is(err, apperror.ErrNotReady) {
+		t.Errorf("editor download before scan: err %v, want %v", err, apperror.ErrNotReady)
+	}
+
+	if job := runNextJob(t); job.Kind != JobScanAttachment || job.Status != models.JobDone {
+		t.Fatalf("scan job %s %q: %s", job.Kind, job.Status, job.LastError)
+	}
+	got := reloadAttachment(t, attachment.ID)
+	if got.ScanStatus != models.ScanClean || got.ScannedAt == nil || got.Key == "" {
+		t.Errorf("after scan: status %q, scanned %v, key %q", got.ScanStatus, got.ScannedAt, got.Key)
+	}
+	if data, err := downloadErr(t, attachmentLearner, attachment.ID); err != nil || data != content {
+		t.Errorf("learner download: %q, err %v", data, err)
+	}
+}
+
+func TestScanAttachmentInfected(t *testing.T) {
+	attachment := addScannedAttachment(t, &scan.FakeScanner{}, "handout "+scan.EICAR)
+	ctx := context.Background()
+
+	if job := runNextJob(t); job.Status != models.JobDone {
+		t.Fatalf("scan job %q: %s", job.Status, job.LastError)
+	}
+
+	got := reloadAttachment(t, attachment.ID)
+	if got.ScanStatus != models.ScanInfected || got.ScanSignature != "Eicar-Test-Signature" ||
+		got.Key != "" || got.PreviewStatus != models.PreviewUnavailable {
+		t.Errorf("after scan: status %q, signature %q, key %q, preview %q",
+			got.ScanStatus, got.ScanSignature, got.Key, got.PreviewStatus)
+	}
+	// Quarantined: the file itself is gone from storage
+	if objects, err := config.Storage.List(ctx, ""); err != nil || len(objects) != 0 {
+		t.Errorf("stored after quarantine: %v, err %v", objects, err)
+	}
+
+	// Never served, not even to its editors, who can still see what
+	// happened
+	for _, viewer := range []Viewer{attachmentLearner, attachmentEditor, {UserID: 1, Role: models.RoleAdmin}} {
+		if _, err := downloadErr(t, viewer, attachment.ID); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("download as %s: err %v, want %v", viewer.Role, err, apperror.ErrNotFound)
+		}
+		if _, err := AttachmentPage(ctx, viewer, attachment.ID, 1); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("page as %s: err %v, want %v", viewer.Role, err, apperror.ErrNotFound)
+		}
+	}
+	if _, err := GetAttachment(attachmentLearner, attachment.ID); !errors.Is(err, apperror.ErrNotFound) {
+		t.Errorf("learner get: err %v, want %v", err, apperror.ErrNotFound)
+	}
+	shown, err := GetAttachment(attachmentEditor, attachment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := ToAPIAttachment(shown); out.DownloadURL != "" || out.ScanStatus != models.ScanInfected {
+		t.Errorf("editor sees %+v", out)
+	}
+
+	listed, err := ListAttachments(attachmentLearner, attachmentOwner(attachment))
+	if err != nil || len(listed) != 0 {
+		t.Errorf("learner list: %v, err %v", listed, err)
+	}
+	item := &models.MediaItem{}
+	item.ID = *attachment.MediaID
+	files, err := attachmentBundleFiles(ctx, item, "")
+	if err != nil || len(files) != 0 {
+		t.Errorf("offline bundle: %v, err %v", files, err)
+	}
+}
+
+func TestScanAttachmentScannerUnavailable(t *testing.T) {
+	content := "Prayer list"
+	scanner := &scan.FakeScanner{Err: errors.New("clamd: connection refused")}
+	attachment := addScannedAttachment(t, scanner, content)
+	config.Config.Jobs.MaxAttempts = 2
+
+	// Retried while attempts remain, and held back in the meantime
+	job := runNextJob(t)
+	if job.Status != models.JobQueued || !strings.Contains(job.LastError, "connection refused") {
+		t.Fatalf("job after first failure: %q, %q", job.Status, job.LastError)
+	}
+	if got := reloadAttachment(t, attachment.ID); got.ScanStatus != models.ScanPending {
+		t.Errorf("status after first failure %q", got.ScanStatus)
+	}
+	if _, err := downloadErr(t, attachmentEditor, attachment.ID); !errors.Is(err, apperror.ErrNotReady) {
+		t.Errorf("download while pending: err %v, want %v", err, apperror.ErrNotReady)
+	}
+
+	// Then given up on: unscanned files are never served
+	config.DB.Model(job).Update("run_after", job.CreatedAt)
+	if job := runNextJob(t); job.Status != models.JobFailed {
+		t.Fatalf("job after last failure: %q", job.Status)
+	}
+	got := reloadAttachment(t, attachment.ID)
+	if got.ScanStatus != models.ScanFailed {
+		t.Errorf("status after last failure %q", got.ScanStatus)
+	}
+	for _, viewer := range []Viewer{attachmentLearner, attachmentEditor} {
+		if _, err := downloadErr(t, viewer, attachment.ID); !errors.Is(err, apperror.ErrNotFound) {
+			t.Errorf("download as %s: err %v, want %v", viewer.Role, err, apperror.ErrNotFound)
+		}
+	}
+
+	if next, err := claimJob(); err != nil || next != nil {
+		t.Errorf("failed scan claimed again: %+v, err %v", next, err)
+	}
+}
@@ -0,0 +1,253 @@
+// media-service/pkg/services/attendance_service.go
+package services
+
+import (
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/calendar"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Attendance events
+const (
+	AttendanceJoin  = "join"
+	AttendanceLeave = "leave"
+	// A watch ping from the player
+	AttendancePing = "ping"
+)
+
+// AttendanceFilter narrows ListAttendance. Empty fields match everything.
+type AttendanceFilter struct {
+	Occurrence *time.Time
+	UserID     uint
+}
+
+// RecordAttendance notes the viewer joining, leaving or still watching
+// the session's current occurrence. Time since the viewer was last seen
+// is credited unless they had left, up to live.attendance_gap.
+func RecordAttendance(viewer Viewer, id uint, event string) (*models.SessionAttendance, error) {
+	session, err := GetLiveSession(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	return recordAttendance(session, viewer.UserID, event)
+}
+
+func recordAttendance(session *models.LiveSession, userID uint, event string) (*models.SessionAttendance, error) {
+	now := time.Now()
+	occ, ok := currentOccurrence(session, now)
+	if !ok {
+		return nil, apperror.ErrNotReady.WithDetail("No occurrence of the session is under way")
+	}
+
+	row := &models.SessionAttendance{
+		SessionID:  session.ID,
+		Occurrence: occ.UTC(),
+		UserID:     userID,
+		JoinedAt:   now,
+		LastSeenAt: now,
+	}
+	var leftAt interface{}
+	if event == AttendanceLeave {
+		row.LeftAt = &now
+		leftAt = now
+	}
+	credit := gorm.Expr(
+		"session_attendances.seconds + CASE WHEN session_attendances.left_at IS NULL THEN "+
+			"LEAST(?, GREATEST(0, EXTRACT(EPOCH FROM (? - session_attendances.last_seen_at))))::int ELSE 0 END",
+		int(config.Config.Live.AttendanceGap.Seconds()), now)
+
+	err := config.DB.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "session_id"}, {Name: "occurrence"}, {Name: "user_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"seconds":      credit,
+				"last_seen_at": now,
+				"left_at":      leftAt,
+				"updated_at":   now,
+			}),
+		},
+		clause.Returning{},
+	).Create(row).Error
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// ListAttendance returns a page of the session's attendance, latest
+// occurrence first, for its host.
+func ListAttendance(viewer Viewer, id uint, filter AttendanceFilter, page Page) ([]api.LiveAttendance, int64, error) {
+	if _, err := hostedSession(viewer, id); err != nil {
+		return nil, 0, err
+	}
+
+	query := config.DB.Model(&models.SessionAttendance{}).Where("session_id = ?", id)
+	if filter.Occurrence != nil {
+		query = query.Where("occurrence = ?", filter.Occurrence.UTC())
+	}
+	if filter.UserID != 0 {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var rows []models.SessionAttendance
+	if err := query.
+		Order("occurrence DESC").
+		Order("joined_at").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&rows).Error; err != nil {
+		return nil, 0, err
+	}
+
+	userIDs := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		userIDs = append(userIDs, row.UserID)
+	}
+	var invitees []models.SessionInvitee
+	if err := config.DB.Where("session_id = ? AND user_id IN ?", id, userIDs).Find(&invitees).Error; err != nil {
+		return nil, 0, err
+	}
+	byUser := make(map[uint]models.SessionInvitee, len(invitees))
+	for _, invitee := range invitees {
+		byUser[invitee.UserID] = invitee
+	}
+
+	out := make([]api.LiveAttendance, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, api.LiveAttendance{
+			UserID:     row.UserID,
+			Occurrence: row.Occurrence,
+			JoinedAt:   row.JoinedAt,
+			LeftAt:     row.LeftAt,
+			LastSeenAt: row.LastSeenAt,
+			Seconds:    row.Seconds,
+			Email:      byUser[row.UserID].Email,
+			Name:       byUser[row.UserID].Name,
+		})
+	}
+	return out, total, nil
+}
+
+// ListInvitees returns the session's invitees to its host.
+func ListInvitees(viewer Viewer, id uint) ([]models.SessionInvitee, error) {
+	if _, err := hostedSession(viewer, id); err != nil {
+		return nil, err
+	}
+	var invitees []models.SessionInvitee
+	if err := config.DB.Where("session_id = ?", id).Order("email").Find(&invitees).Error; err != nil {
+		return nil, err
+	}
+	return invitees, nil
+}
+
+// SetInvitees replaces the session's invitees. Those added are sent an
+// invitation and those removed a cancellation; invitees whose name or
+// user ID changed are updated quietly.
+func SetInvitees(viewer Viewer, id uint, invitees []api.LiveInvitee) ([]models.SessionInvitee, error) {
+	session, err := hostedSession(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return replaceInvitees(tx, session, invitees)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ListInvitees(viewer, id)
+}
+
+// replaceInvitees makes invitees the session's invitee list in tx and
+// queues the invitations and cancellations that follow.
+func replaceInvitees(tx *gorm.DB, session *models.LiveSession, invitees []api.LiveInvitee) error {
+	var existing []models.SessionInvitee
+	if err := tx.Where("session_id = ?", session.ID).Find(&existing).Error; err != nil {
+		return err
+	}
+	current := make(map[string]models.SessionInvitee, len(existing))
+	for _, invitee := range existing {
+		current[invitee.Email] = invitee
+	}
+
+	wanted := map[string]bool{}
+	var added []models.SessionInvitee
+	for _, in := range invitees {
+		email := strings.ToLower(strings.TrimSpace(in.Email))
+		if wanted[email] {
+			continue
+		}
+		wanted[email] = true
+		row := models.SessionInvitee{
+			SessionID: session.ID,
+			Email:     email,
+			Name:      strings.TrimSpace(in.Name),
+			UserID:    in.UserID,
+		}
+		if old, ok := current[email]; ok {
+			if old.Name != row.Name || old.UserID != row.UserID {
+				if err := tx.Model(&old).Updates(map[string]interface{}{
+					"name":    row.Name,
+					"user_id": row.UserID,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		added = append(added, row)
+	}
+
+	var removed []models.SessionInvitee
+	for email, invitee := range current {
+		if !wanted[email] {
+			removed = append(removed, invitee)
+		}
+	}
+	if len(removed) > 0 {
+		if err := tx.Delete(&removed).Error; err != nil {
+			return err
+		}
+	}
+	if len(added) > 0 {
+		if err := tx.Create(&added).Error; err != nil {
+			return err
+		}
+	}
+
+	// Sessions that are over or cancelled need no invitations
+	if _, upcoming := NextOccurrence(session, time.Now()); !upcoming {
+		return nil
+	}
+	messages, err := invitations(session, calendar.MethodRequest, false, added)
+	if err != nil {
+		return err
+	}
+	cancellations, err := invitations(session, calendar.MethodCancel, false, removed)
+	if err != nil {
+		return err
+	}
+	return queueMail(tx, append(messages, cancellations...)...)
+}
+
+// isInvited reports whether userID is on the session's invitee list.
+func isInvited(sessionID, userID uint) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	var count int64
+	err := config.DB.Model(&models.SessionInvitee{}).
+		Where("session_id = ? AND user_id = ?", sessionID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,598 @@
+// media-service/pkg/services/audio_track_service.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/transcode"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+	"gorm.io/gorm"
+)
+
+// JobProcessAudioTrack is enqueued once an audio track has a new recording.
+const JobProcessAudioTrack = "audio_tracks.process"
+
+// AudioTrackJob is the payload of JobProcessAudioTrack.
+type AudioTrackJob struct {
+	TrackID   uint   `json:"track_id"`
+	SourceKey string `json:"source_key"`
+}
+
+// The audio-only rung a dub is offered at in each master playlist,
+// matching what the variants there carry
+const (
+	dubRendition          = "audio"
+	dataSaverDubRendition = "audio-low"
+)
+
+// ListAudioTracks returns the item's dubbed audio tracks the viewer may
+// see: published ones, and drafts too for editors.
+func ListAudioTracks(viewer Viewer, mediaID uint) (*api.AudioTrackList, error) {
+	item, err := GetMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := config.DB.Where("media_id = ?", item.ID)
+	if !viewer.CanEdit(item) {
+		query = query.Where("published AND hls_prefix <> ''")
+	}
+	var tracks []models.AudioTrack
+	if err := query.Order("language").Find(&tracks).Error; err != nil {
+		return nil, err
+	}
+
+	list := &api.AudioTrackList{
+		OriginalLanguage: item.Language,
+		Tracks:           make([]api.AudioTrack, 0, len(tracks)),
+	}
+	for i := range tracks {
+		list.Tracks = append(list.Tracks, ToAPIAudioTrack(&tracks[i]))
+	}
+	return list, nil
+}
+
+// UploadAudioTrack creates or replaces the item's audio track for lang
+// with a recording in any format the encoder reads, and queues it for
+// encoding. A replaced track keeps playing its previous recording until
+// the new one is ready.
+func UploadAudioTrack(ctx context.Context, viewer Viewer, mediaID uint, lang, label string, published bool, contentType string, r io.Reader) (*api.AudioTrack, error) {
+	item, err := editableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if item.Type == models.MediaTypeDocument {
+		return nil, apperror.ErrValidation.WithDetail("Documents have no audio to add a language to")
+	}
+	lang, err = ParseCaptionLanguage(lang)
+	if err != nil {
+		return nil, err
+	}
+	if item.Language != "" && lang == item.Language {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "language", Code: "ne", Message: "is the language of the item's own audio",
+		})
+	}
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	if contentType != "" && contentType != "application/octet-stream" &&
+		!strings.HasPrefix(contentType, "audio/") && !strings.HasPrefix(contentType, "video/") {
+		return nil, apperror.ErrUnsupportedMedia.WithDetail("Send an audio recording, or a video whose audio is the track")
+	}
+
+	f, err := os.CreateTemp(config.Config.Transcode.WorkDir, "audio-track-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	size, err := io.Copy(f, r)
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, apperror.Validation(apperror.FieldError{Field: "file", Code: "required", Message: "must not be empty"})
+	}
+
+	key := fmt.Sprintf("%ssource-%d", audioTrackRoot(item.ID, lang), time.Now().UnixNano())
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		key += exts[0]
+	}
+	if err := storage.PutFile(ctx, config.Storage, key, f, size, contentType, config.Config.Storage.PartSize); err != nil {
+		return nil, err
+	}
+
+	var track models.AudioTrack
+	var previousKey string
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("media_id = ? AND language = ?", item.ID, lang).First(&track).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			track = models.AudioTrack{MediaID: item.ID, Language: lang, CreatedBy: viewer.UserID}
+		case err != nil:
+			return err
+		}
+		previousKey = track.SourceKey
+
+		if label = strings.TrimSpace(label); label != "" {
+			track.Label = label
+		}
+		track.Published = published
+		track.SourceKey = key
+		track.SourceSize = size
+		track.SourceContentType = contentType
+		track.Status = models.ProcessingQueued
+		track.Error = ""
+		if err := tx.Save(&track).Error; err != nil {
+			return err
+		}
+		return EnqueueJob(tx, JobProcessAudioTrack, item.ID, AudioTrackJob{TrackID: track.ID, SourceKey: key})
+	})
+	if err != nil {
+		config.Storage.Delete(ctx, key)
+		return nil, err
+	}
+
+	// A job for the previous recording sees it was replaced and stops
+	if previousKey != "" {
+		if err := config.Storage.Delete(ctx, previousKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			config.Log.WithError(err).WithField("key", previousKey).Warn("failed to remove replaced audio track")
+		}
+	}
+
+	out := ToAPIAudioTrack(&track)
+	return &out, nil
+}
+
+func UpdateAudioTrack(viewer Viewer, mediaID uint, lang string, req api.UpdateAudioTrackRequest) (*api.AudioTrack, error) {
+	track, err := editableAudioTrack(viewer, mediaID, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	if req.Label != nil {
+		track.Label = strings.TrimSpace(*req.Label)
+		columns["label"] = track.Label
+	}
+	if req.Published != nil {
+		track.Published = *req.Published
+		columns["published"] = track.Published
+	}
+	if len(columns) > 0 {
+		if err := config.DB.Model(track).Updates(columns).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	out := ToAPIAudioTrack(track)
+	return &out, nil
+}
+
+// DeleteAudioTrack removes the track for lang and its files.
+func DeleteAudioTrack(ctx context.Context, viewer Viewer, mediaID uint, lang string) error {
+	track, err := editableAudioTrack(viewer, mediaID, lang)
+	if err != nil {
+		return err
+	}
+	if err := config.DB.Delete(track).Error; err != nil {
+		return err
+	}
+	if err := storage.DeletePrefix(ctx, config.Storage, audioTrackRoot(track.MediaID, track.Language)); err != nil {
+		config.Log.WithError(err).WithField("media_id", track.MediaID).Warn("failed to remove audio track files")
+	}
+	return nil
+}
+
+func ToAPIAudioTrack(track *models.AudioTrack) api.AudioTrack {
+	return api.AudioTrack{
+		Language:    track.Language,
+		Label:       track.Label,
+		Published:   track.Published,
+		ContentType: track.SourceContentType,
+		Size:        track.SourceSize,
+		Status:      track.Status,
+		Error:       track.Error,
+		CreatedAt:   track.CreatedAt,
+		UpdatedAt:   track.UpdatedAt,
+	}
+}
+
+// processAudioTrack encodes a track's recording into the audio-only rungs
+// under a prefix unique to the job, then swaps it in.
+func processAudioTrack(ctx context.Context, job *models.ProcessingJob) error {
+	var payload AudioTrackJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	var track models.AudioTrack
+	if err := config.DB.First(&track, payload.TrackID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Deleted while queued
+			return nil
+		}
+		return err
+	}
+	if track.SourceKey != payload.SourceKey {
+		// A newer recording replaced this one and has its own job
+		return nil
+	}
+	setAudioTrackStatus(track.ID, models.ProcessingProcessing, "")
+
+	prefix := fmt.Sprintf("%shls/%d/", audioTrackRoot(track.MediaID, track.Language), job.ID)
+	result, err := packageAudioTrack(ctx, &track, prefix)
+	if err != nil {
+		status := models.ProcessingQueued
+		if job.Attempts >= config.Config.Jobs.MaxAttempts {
+			status = models.ProcessingFailed
+		}
+		setAudioTrackStatus(track.ID, status, err.Error())
+		return err
+	}
+
+	names := make(models.StringList, 0, len(result.Renditions))
+	for _, r := range result.Renditions {
+		names = append(names, r.Name)
+	}
+	res := config.DB.Model(&models.AudioTrack{}).
+		Where("id = ? AND source_key = ?", track.ID, payload.SourceKey).
+		Updates(map[string]interface{}{
+			"status":     models.ProcessingReady,
+			"error":      "",
+			"hls_prefix": prefix,
+			"renditions": names,
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		// Replaced or deleted while encoding
+		storage.DeletePrefix(ctx, config.Storage, prefix)
+		return res.Error
+	}
+
+	if track.HLSPrefix != "" && track.HLSPrefix != prefix {
+		if err := storage.DeletePrefix(ctx, config.Storage, track.HLSPrefix); err != nil {
+			config.Log.WithError(err).WithField("prefix", track.HLSPrefix).Warn("failed to remove old audio track renditions")
+		}
+	}
+	return nil
+}
+
+func packageAudioTrack(ctx context.Context, track *models.AudioTrack, prefix string) (*transcode.Result, error) {
+	if config.Encoder == nil {
+		return nil, errors.New("no encoder configured")
+	}
+	workDir, err := os.MkdirTemp(config.Config.Transcode.WorkDir, "audio-track-job-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	source := filepath.Join(workDir, "source")
+	if err := downloadObject(ctx, track.SourceKey, source); err != nil {
+		return nil, fmt.Errorf("download source: %w", err)
+	}
+	outDir := filepath.Join(workDir, "hls")
+	result, err := transcode.PackageAudioTrack(ctx, config.Encoder, source, outDir, transcode.DefaultLadder)
+	if err != nil {
+		return nil, err
+	}
+	if err := uploadDir(ctx, outDir, prefix); err != nil {
+		storage.DeletePrefix(ctx, config.Storage, prefix)
+		return nil, fmt.Errorf("store renditions: %w", err)
+	}
+	return result, nil
+}
+
+func setAudioTrackStatus(id uint, status, message string) {
+	if err := config.DB.Model(&models.AudioTrack{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status": status,
+		"error":  message,
+	}).Error; err != nil {
+		config.Log.WithError(err).WithField("audio_track_id", id).Error("failed to record audio track status")
+	}
+}
+
+// languageChoice is what an item offers to hear and read it in, and the
+// defaults picked for a viewer's preferred language.
+type languageChoice struct {
+	dubs     []models.AudioTrack
+	captions []models.CaptionTrack
+	// Language the stream starts in; the original's unless a dub matches
+	// the preference
+	audio string
+	// Index into dubs of the default audio, or -1 for the original
+	dub int
+	// Index into captions of the track shown by default, or -1 for none
+	caption int
+}
+
+// chooseLanguages picks defaults for preferred, a BCP 47 tag that may be
+// empty. A close match is good enough: a viewer preferring "pt" gets a
+// "pt-BR" dub. When the item cannot be heard in the preferred language,
+// the original plays with captions in it, if there are any.
+func chooseLanguages(item *models.MediaItem, preferred string, captions []models.CaptionTrack) (*languageChoice, error) {
+	var dubs []models.AudioTrack
+	if err := config.DB.Where("media_id = ? AND published AND hls_prefix <> ''", item.ID).
+		Order("language").
+		Find(&dubs).Error; err != nil {
+		return nil, err
+	}
+
+	choice := &languageChoice{dubs: dubs, captions: captions, audio: item.Language, dub: -1, caption: -1}
+	want, err := language.Parse(preferred)
+	if preferred == "" || err != nil {
+		return choice, nil
+	}
+
+	heard := make([]string, 0, len(dubs)+1)
+	if item.Language != "" {
+		heard = append(heard, item.Language)
+	}
+	for _, d := range dubs {
+		heard = append(heard, d.Language)
+	}
+	if i, ok := matchLanguage(want, heard); ok {
+		choice.audio = heard[i]
+		if item.Language != "" {
+			i--
+		}
+		choice.dub = i
+		return choice, nil
+	}
+
+	read := make([]string, 0, len(captions))
+	for _, c := range captions {
+		read = append(read, c.Language)
+	}
+	if i, ok := matchLanguage(want, read); ok {
+		choice.caption = i
+	}
+	return choice, nil
+}
+
+// matchLanguage returns the index of the tag among available that serves
+// want, if any does.
+func matchLanguage(want language.Tag, available []string) (int, bool) {
+	if len(available) == 0 {
+		return 0, false
+	}
+	tags := make([]language.Tag, 0, len(available))
+	for _, a := range available {
+		tags = append(tags, language.Make(a))
+	}
+	_, i, confidence := language.NewMatcher(tags).Match(want)
+	return i, confidence != language.No
+}
+
+// version changes whenever a track the master playlist lists changes, so
+// cached copies are never stale.
+func (l *languageChoice) version() int64 {
+	var v int64
+	for _, d := range l.dubs {
+		v = max(v, d.UpdatedAt.UnixMilli())
+	}
+	for _, c := range l.captions {
+		v = max(v, c.UpdatedAt.UnixMilli())
+	}
+	return v
+}
+
+// audioLanguages lists the original and the dubs for a playback response.
+func (l *languageChoice) audioLanguages(item *models.MediaItem, base string, dataSaver bool) []api.AudioLanguage {
+	out := make([]api.AudioLanguage, 0, len(l.dubs)+1)
+	out = append(out, api.AudioLanguage{
+		Language: item.Language,
+		Label:    languageLabel(item.Language, ""),
+		Original: true,
+		Default:  l.dub < 0,
+	})
+	for i := range l.dubs {
+		rung, ok := dubRung(&l.dubs[i], dataSaver)
+		if !ok {
+			continue
+		}
+		out = append(out, api.AudioLanguage{
+			Language: l.dubs[i].Language,
+			Label:    languageLabel(l.dubs[i].Language, l.dubs[i].Label),
+			Default:  l.dub == i,
+			URL:      base + "/" + audioTrackStreamPath(&l.dubs[i], rung),
+		})
+	}
+	return out
+}
+
+// alternates lists what the master playlist offers besides its variants.
+// URIs climb out of "hls/" to the other files below the signed prefix.
+func (l *languageChoice) alternates(item *models.MediaItem, dataSaver bool) []transcode.Alternate {
+	var out []transcode.Alternate
+	if len(l.dubs) > 0 {
+		out = append(out, transcode.Alternate{
+			Type:     transcode.MediaAudio,
+			Language: item.Language,
+			Name:     languageLabel(item.Language, ""),
+			Default:  l.dub < 0,
+		})
+	}
+	for i := range l.dubs {
+		rung, ok := dubRung(&l.dubs[i], dataSaver)
+		if !ok {
+			continue
+		}
+		out = append(out, transcode.Alternate{
+			Type:     transcode.MediaAudio,
+			Language: l.dubs[i].Language,
+			Name:     languageLabel(l.dubs[i].Language, l.dubs[i].Label),
+			Default:  l.dub == i,
+			URI:      "../" + audioTrackStreamPath(&l.dubs[i], rung),
+		})
+	}
+	for i := range l.captions {
+		out = append(out, transcode.Alternate{
+			Type:     transcode.MediaSubtitles,
+			Language: l.captions[i].Language,
+			Name:     languageLabel(l.captions[i].Language, l.captions[i].Label),
+			Default:  l.caption == i,
+			URI:      "../" + captionPlaylistPath(&l.captions[i]),
+		})
+	}
+	return out
+}
+
+// masterPlaylistURL is the signed master playlist URL for a playback
+// response, naming the preferred language the defaults are picked for.
+func masterPlaylistURL(base, master, preferred string, choice *languageChoice) string {
+	u := base + "/hls/" + master
+	if len(choice.dubs) == 0 && len(choice.captions) == 0 {
+		return u
+	}
+	query := url.Values{"v": {strconv.FormatInt(choice.version(), 10)}}
+	if preferred != "" {
+		query.Set("language", preferred)
+	}
+	return u + "?" + query.Encode()
+}
+
+// openMasterPlaylist serves a stored master playlist with the item's dubs
+// and published captions added as alternates.
+func openMasterPlaylist(ctx context.Context, item *models.MediaItem, key, preferred string) (*StreamFile, error) {
+	captions, err := publishedCaptions(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	choice, err := chooseLanguages(item, preferred, captions)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := config.Storage.Open(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Stream not found")
+		}
+		return nil, err
+	}
+	master, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	data := transcode.AddAlternates(master, choice.alternates(item, path.Base(key) == transcode.DataSaverPlaylist))
+	sum := sha256.Sum256(data)
+	return &StreamFile{
+		Object:       nopCloser{bytes.NewReader(data)},
+		Name:         path.Base(key),
+		Size:         int64(len(data)),
+		ModTime:      time.UnixMilli(max(choice.version(), item.UpdatedAt.UnixMilli())),
+		ContentType:  packagedContentTypes[".m3u8"],
+		ETag:         `"` + base64.RawURLEncoding.EncodeToString(sum[:12]) + `"`,
+		DownloadName: fmt.Sprintf("media-%d-%s", item.ID, path.Base(key)),
+	}, nil
+}
+
+// audioTrackKey maps the part of audioTrackStreamPath after "audio/" to
+// the storage key of a published dub's playlist or segment.
+func audioTrackKey(mediaID uint, file string) (string, error) {
+	notFound := apperror.ErrNotFound.WithDetail("Audio track not found")
+	parts := strings.SplitN(file, "/", 3)
+	if len(parts) != 3 {
+		return "", notFound
+	}
+	rel := path.Clean("/" + parts[2])
+	if rel == "/" {
+		return "", notFound
+	}
+
+	var track models.AudioTrack
+	if err := config.DB.Where("media_id = ? AND language = ? AND published AND hls_prefix <> ''", mediaID, parts[1]).
+		First(&track).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", notFound
+		}
+		return "", err
+	}
+	return track.HLSPrefix + strings.TrimPrefix(rel, "/"), nil
+}
+
+// audioTrackStreamPath is where a dub's variant playlist for rung is served
+// below a signed stream URL. The version changes whenever the track does.
+func audioTrackStreamPath(track *models.AudioTrack, rung string) string {
+	return fmt.Sprintf("audio/%d/%s/%s", track.UpdatedAt.UnixMilli(), track.Language, path.Join(rung, transcode.VariantPlaylist))
+}
+
+// dubRung picks the rung of track that goes with the variants of the full
+// or the data-saver master playlist.
+func dubRung(track *models.AudioTrack, dataSaver bool) (string, bool) {
+	rung := dubRendition
+	if dataSaver {
+		rung = dataSaverDubRendition
+	}
+	return rung, slices.Contains(track.Renditions, rung)
+}
+
+// languageLabel is the track name players show: the editor's label, or
+// the language's name in that language.
+func languageLabel(tag, label string) string {
+	if label != "" {
+		return label
+	}
+	parsed, err := language.Parse(tag)
+	if tag == "" || err != nil {
+		return "Original"
+	}
+	name := display.Self.Name(parsed)
+	if name == "" {
+		return tag
+	}
+	// Menus capitalize names even where the language itself does not
+	first, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(first)) + name[size:]
+}
+
+func editableAudioTrack(viewer Viewer, mediaID uint, lang string) (*models.AudioTrack, error) {
+	item, err := editableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	notFound := apperror.ErrNotFound.WithDetail("Audio track not found")
+	lang, err = ParseCaptionLanguage(lang)
+	if err != nil {
+		return nil, notFound
+	}
+	var track models.AudioTrack
+	if err := config.DB.Where("media_id = ? AND language = ?", item.ID, lang).First(&track).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound
+		}
+		return nil, err
+	}
+	return &track, nil
+}
+
+// audioTrackRoot is the storage prefix of everything stored for a track.
+func audioTrackRoot(mediaID uint, lang string) string {
+	return fmt.Sprintf("media/%d/audio/%s/", mediaID, lang)
+}
@@ -0,0 +1,313 @@
+// media-service/pkg/services/calendar_service.go
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/calendar"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/mail"
+	"shepherdsfold/media-service/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	calendarProdID = "-//Shepherd's Fold//Media Service//EN"
+	// Bounds the number of events in one feed
+	maxFeedSessions = 500
+	// Open-ended searches for occurrences stop this far ahead
+	occurrenceHorizon = 100 * 365 * 24 * time.Hour
+)
+
+// sessionSchedule is when a session's occurrences fall.
+type sessionSchedule struct {
+	// First occurrence, in the session's time zone
+	start    time.Time
+	duration time.Duration
+	// nil for a one-off session
+	rule *calendar.RRule
+}
+
+// parseSchedule validates a session's time zone and recurrence rule and
+// works out when the series ends.
+func parseSchedule(start time.Time, timeZone, rrule string) (sessionSchedule, *time.Time, error) {
+	var sched sessionSchedule
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil || timeZone == "" || timeZone == "Local" {
+		return sched, nil, apperror.Validation(apperror.FieldError{
+			Field: "time_zone", Code: "timezone", Message: "must be an IANA time zone such as Europe/London",
+		})
+	}
+	sched.start = start.In(loc)
+	if rrule == "" {
+		return sched, &start, nil
+	}
+
+	rule, err := calendar.ParseRRule(rrule)
+	if err != nil {
+		return sched, nil, apperror.Validation(apperror.FieldError{
+			Field: "rrule", Code: "rrule", Message: err.Error(),
+		})
+	}
+	sched.rule = rule
+	if len(rule.Occurrences(sched.start, sched.start, sched.start.Add(occurrenceHorizon), 1)) == 0 {
+		return sched, nil, apperror.Validation(apperror.FieldError{
+			Field: "rrule", Code: "rrule", Message: "has no occurrences after scheduled_at",
+		})
+	}
+	if rule.Count == 0 && rule.Until.IsZero() {
+		return sched, nil, nil
+	}
+	last, _ := rule.Last(sched.start, sched.start.Add(occurrenceHorizon))
+	last = last.UTC()
+	return sched, &last, nil
+}
+
+// scheduleOf returns the stored schedule of s, which was validated when
+// it was saved.
+func scheduleOf(s *models.LiveSession) sessionSchedule {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	sched := sessionSchedule{
+		start:    s.ScheduledAt.In(loc),
+		duration: time.Duration(s.DurationMinutes) * time.Minute,
+	}
+	if s.RRule != "" {
+		if rule, err := calendar.ParseRRule(s.RRule); err == nil {
+			sched.rule = rule
+		}
+	}
+	return sched
+}
+
+// next returns the start of the occurrence under way at t or the first
+// one after it.
+func (sched sessionSchedule) next(t time.Time) (time.Time, bool) {
+	occ := sched.rule.Occurrences(sched.start, t.Add(-sched.duration), t.Add(occurrenceHorizon), 1)
+	if len(occ) == 0 {
+		return time.Time{}, false
+	}
+	return occ[0], true
+}
+
+// nearest returns the occurrence starting closest to t.
+func (sched sessionSchedule) nearest(t time.Time) (time.Time, bool) {
+	prev, hasPrev := sched.rule.Last(sched.start, t)
+	next := sched.rule.Occurrences(sched.start, t, t.Add(occurrenceHorizon), 1)
+	switch {
+	case len(next) == 0:
+		return prev, hasPrev
+	case !hasPrev || next[0].Sub(t) < t.Sub(prev):
+		return next[0], true
+	default:
+		return prev, true
+	}
+}
+
+// NextOccurrence is the start of the session's occurrence under way or
+// next up, if the session is not cancelled or over.
+func NextOccurrence(s *models.LiveSession, now time.Time) (time.Time, bool) {
+	if s.Status == models.LiveCancelled {
+		return time.Time{}, false
+	}
+	if s.Status == models.LiveEnded && s.RRule == "" {
+		return time.Time{}, false
+	}
+	return scheduleOf(s).next(now)
+}
+
+// currentOccurrence is the occurrence attendance at now counts towards:
+// the one being broadcast, or one starting within live.join_early or not
+// yet over.
+func currentOccurrence(s *models.LiveSession, now time.Time) (time.Time, bool) {
+	sched := scheduleOf(s)
+	if s.Status == models.LiveOnAir && s.StartedAt != nil {
+		// The host may go on air early or run over
+		if occ, ok := sched.nearest(*s.StartedAt); ok {
+			return occ, true
+		}
+		return sched.start, true
+	}
+	if s.Status == models.LiveCancelled {
+		return time.Time{}, false
+	}
+	occ, ok := sched.nearest(now)
+	if !ok || now.Before(occ.Add(-config.Config.Live.JoinEarly)) || !now.Before(occ.Add(sched.duration)) {
+		return time.Time{}, false
+	}
+	return occ, true
+}
+
+// CalendarFeedURL is the viewer's personal iCalendar feed. The URL is its
+// own credential, so calendar apps can subscribe without a token.
+func CalendarFeedURL(viewer Viewer) (string, error) {
+	if config.Config.Calendar.FeedKey == "" {
+		return "", apperror.ErrNotEnabled.WithDetail("Calendar feeds are not configured")
+	}
+	return fmt.Sprintf("%s/%d/%s.ics", strings.TrimRight(config.Config.Calendar.FeedURL, "/"),
+		viewer.UserID, feedToken(viewer.UserID)), nil
+}
+
+// CalendarFeed returns the sessions userID hosts or is invited to, if
+// token is their feed token. Recurring sessions are listed in full;
+// one-off sessions once they are older than calendar.feed_past drop out.
+func CalendarFeed(userID uint, token string) (*calendar.Calendar, error) {
+	key := config.Config.Calendar.FeedKey
+	if key == "" {
+		return nil, apperror.ErrNotEnabled.WithDetail("Calendar feeds are not configured")
+	}
+	if userID == 0 || !hmac.Equal([]byte(token), []byte(feedToken(userID))) {
+		return nil, apperror.ErrNotFound.WithDetail("Calendar feed not found")
+	}
+
+	var sessions []models.LiveSession
+	if err := config.DB.
+		Where("host_id = ? OR id IN (?)", userID,
+			config.DB.Model(&models.SessionInvitee{}).Select("session_id").Where("user_id = ?", userID)).
+		Where("rrule <> '' OR scheduled_at >= ?", time.Now().Add(-config.Config.Calendar.FeedPast)).
+		Order("scheduled_at").
+		Order("id").
+		Limit(maxFeedSessions).
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+
+	cal := &calendar.Calendar{
+		ProdID: calendarProdID,
+		Name:   "Live sessions",
+		Events: make([]calendar.Event, 0, len(sessions)),
+	}
+	now := time.Now()
+	for i := range sessions {
+		cal.Events = append(cal.Events, sessionEvent(&sessions[i], now))
+	}
+	return cal, nil
+}
+
+// invitations renders an iTIP message per invitee, announcing a change
+// to an earlier invitation if update is set. Each lists only its
+// recipient as attendee, so invitees do not see each other's addresses.
+func invitations(s *models.LiveSession, method string, update bool, invitees []models.SessionInvitee) ([]mail.Message, error) {
+	now := time.Now()
+	subject := "Invitation: " + s.Title
+	switch {
+	case method == calendar.MethodCancel:
+		subject = "Cancelled: " + s.Title
+	case update:
+		subject = "Updated invitation: " + s.Title
+	}
+	text := invitationText(s, method)
+
+	messages := make([]mail.Message, 0, len(invitees))
+	for _, invitee := range invitees {
+		event := sessionEvent(s, now)
+		event.Attendees = []calendar.Person{{Name: invitee.Name, Email: invitee.Email}}
+		if method == calendar.MethodCancel {
+			event.Status = calendar.StatusCancelled
+		}
+		var buf bytes.Buffer
+		if err := calendar.Write(&buf, &calendar.Calendar{
+			ProdID: calendarProdID,
+			Method: method,
+			Events: []calendar.Event{event},
+		}); err != nil {
+			return nil, err
+		}
+		messages = append(messages, mail.Message{
+			To:             invitee.Email,
+			ToName:         invitee.Name,
+			Subject:        subject,
+			Text:           text,
+			Calendar:       buf.Bytes(),
+			CalendarMethod: method,
+		})
+	}
+	return messages, nil
+}
+
+// queueInvitations mails the session's current invitees about a change to
+// it, in tx.
+func queueInvitations(tx *gorm.DB, s *models.LiveSession, method string) error {
+	if config.Mailer == nil {
+		return nil
+	}
+	var invitees []models.SessionInvitee
+	if err := tx.Where("session_id = ?", s.ID).Order("id").Find(&invitees).Error; err != nil {
+		return err
+	}
+	messages, err := invitations(s, method, true, invitees)
+	if err != nil {
+		return err
+	}
+	return queueMail(tx, messages...)
+}
+
+func invitationText(s *models.LiveSession, method string) string {
+	var b strings.Builder
+	if method == calendar.MethodCancel {
+		fmt.Fprintf(&b, "%s has been cancelled.\n", s.Title)
+		return b.String()
+	}
+
+	sched := scheduleOf(s)
+	fmt.Fprintf(&b, "%s\n\n", s.Title)
+	fmt.Fprintf(&b, "When: %s", sched.start.Format("Monday 2 January 2006, 15:04 MST"))
+	if s.TimeZone != "UTC" {
+		fmt.Fprintf(&b, " (%s)", s.TimeZone)
+	}
+	b.WriteString("\n")
+	if s.RRule != "" {
+		fmt.Fprintf(&b, "Repeats: %s\n", s.RRule)
+	}
+	fmt.Fprintf(&b, "Duration: %d minutes\n", s.DurationMinutes)
+	if url := sessionURL(s.ID); url != "" {
+		fmt.Fprintf(&b, "Join: %s\n", url)
+	}
+	if s.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", s.Description)
+	}
+	return b.String()
+}
+
+func sessionEvent(s *models.LiveSession, now time.Time) calendar.Event {
+	sched := scheduleOf(s)
+	event := calendar.Event{
+		UID:         fmt.Sprintf("live-%d@%s", s.ID, config.Config.Calendar.UIDDomain),
+		Sequence:    s.Sequence,
+		Stamp:       now,
+		Start:       sched.start,
+		Duration:    sched.duration,
+		Summary:     s.Title,
+		Description: s.Description,
+		URL:         sessionURL(s.ID),
+		Status:      calendar.StatusConfirmed,
+		Organizer:   calendar.Person{Name: config.Config.Mail.FromName, Email: config.Config.Mail.FromEmail},
+	}
+	if sched.rule != nil {
+		event.RRule = sched.rule.String()
+	}
+	if s.Status == models.LiveCancelled {
+		event.Status = calendar.StatusCancelled
+	}
+	return event
+}
+
+func sessionURL(id uint) string {
+	return strings.ReplaceAll(config.Config.Calendar.SessionURL, "{id}", strconv.FormatUint(uint64(id), 10))
+}
+
+func feedToken(userID uint) string {
+	mac := hmac.New(sha256.New, []byte(config.Config.Calendar.FeedKey))
+	fmt.Fprintf(mac, "calendar-feed:%d", userID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
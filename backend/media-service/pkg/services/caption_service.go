@@ -0,0 +1,795 @@
+// media-service/pkg/services/caption_service.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/captions"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/transcode"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+	"gorm.io/gorm"
+)
+
+// JobDraftCaptions asks the speech-to-text engine for a draft track.
+const JobDraftCaptions = "captions.draft"
+
+// DraftCaptionsJob is the payload of JobDraftCaptions.
+type DraftCaptionsJob struct {
+	Language  string `json:"language"`
+	CreatedBy uint   `json:"created_by"`
+}
+
+// Transcripts are indexed with the "simple" configuration, which lowercases
+// but does not stem, because tracks come in many languages.
+const transcriptVector = "to_tsvector('simple', caption_cues.text)"
+
+func init() {
+	RegisterBundleContributor(captionBundleFiles)
+}
+
+// RegisterCaptionDrafting starts handling JobDraftCaptions with
+// config.Transcriber.
+func RegisterCaptionDrafting() {
+	RegisterJobHandler(JobDraftCaptions, draftCaptions)
+}
+
+// ParseCaptionLanguage validates a BCP 47 tag and returns its canonical
+// form, so "pt-br" and "pt-BR" name the same track.
+func ParseCaptionLanguage(tag string) (string, error) {
+	parsed, err := language.Parse(tag)
+	if err != nil || tag == "" {
+		return "", apperror.Validation(apperror.FieldError{
+			Field: "language", Code: "bcp47_language_tag", Message: "must be a valid BCP 47 language tag",
+		})
+	}
+	return parsed.String(), nil
+}
+
+// ListCaptionTracks returns the item's tracks the viewer may see: published
+// ones, and drafts too for editors.
+func ListCaptionTracks(viewer Viewer, mediaID uint) ([]api.CaptionTrack, error) {
+	item, err := GetMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := config.DB.Where("media_id = ?", item.ID)
+	if !viewer.CanEdit(item) {
+		query = query.Where("published")
+	}
+	var tracks []models.CaptionTrack
+	if err := query.Order("language").Find(&tracks).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(tracks))
+	for _, t := range tracks {
+		ids = append(ids, t.ID)
+	}
+	var counts []struct {
+		TrackID uint
+		Count   int64
+	}
+	if len(ids) > 0 {
+		if err := config.DB.Model(&models.CaptionCue{}).
+			Select("track_id, COUNT(*) AS count").
+			Where("track_id IN ?", ids).
+			Group("track_id").
+			Scan(&counts).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	out := make([]api.CaptionTrack, 0, len(tracks))
+	for i := range tracks {
+		var n int64
+		for _, c := range counts {
+			if c.TrackID == tracks[i].ID {
+				n = c.Count
+			}
+		}
+		out = append(out, ToAPICaptionTrack(&tracks[i], n))
+	}
+	return out, nil
+}
+
+// ImportCaptions replaces the item's track for lang with a WebVTT or SRT
+// file. Imported tracks are published unless asked otherwise.
+func ImportCaptions(viewer Viewer, mediaID uint, lang, label string, published bool, r io.Reader) (*api.CaptionTrack, error) {
+	item, err := editableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	lang, err = ParseCaptionLanguage(lang)
+	if err != nil {
+		return nil, err
+	}
+
+	cues, err := captions.Parse(r)
+	if err != nil {
+		var parseErr *captions.ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			return nil, apperror.ErrValidation.WithDetail("Caption file is not valid WebVTT or SRT: " + parseErr.Error())
+		case errors.Is(err, captions.ErrEmpty):
+			return nil, apperror.ErrValidation.WithDetail("Caption file has no cues")
+		}
+		return nil, err
+	}
+
+	track := &models.CaptionTrack{
+		MediaID:   item.ID,
+		Language:  lang,
+		Label:     strings.TrimSpace(label),
+		Source:    models.CaptionSourceUpload,
+		Published: published,
+		CreatedBy: viewer.UserID,
+	}
+	if err := replaceCaptionTrack(track, cues); err != nil {
+		return nil, err
+	}
+	out := ToAPICaptionTrack(track, int64(len(cues)))
+	return &out, nil
+}
+
+// ExportCaptions writes the track for lang to w as WebVTT or SRT.
+func ExportCaptions(viewer Viewer, mediaID uint, lang, format string, w io.Writer) error {
+	track, err := visibleCaptionTrack(viewer, mediaID, lang)
+	if err != nil {
+		return err
+	}
+	cues, err := trackCues(track.ID)
+	if err != nil {
+		return err
+	}
+	return captions.Write(w, format, toCaptionCues(cues))
+}
+
+// GetCaptionCues returns the track for lang with its cues in play order.
+func GetCaptionCues(viewer Viewer, mediaID uint, lang string) (*api.CaptionCueList, error) {
+	track, err := visibleCaptionTrack(viewer, mediaID, lang)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := trackCues(track.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &api.CaptionCueList{
+		Track: ToAPICaptionTrack(track, int64(len(cues))),
+		Cues:  make([]api.CaptionCue, 0, len(cues)),
+	}
+	for i := range cues {
+		out.Cues = append(out.Cues, toAPICaptionCue(&cues[i]))
+	}
+	return out, nil
+}
+
+func UpdateCaptionTrack(viewer Viewer, mediaID uint, lang string, req api.UpdateCaptionTrackRequest) (*api.CaptionTrack, error) {
+	track, err := editableCaptionTrack(viewer, mediaID, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	if req.Label != nil {
+		track.Label = strings.TrimSpace(*req.Label)
+		columns["label"] = track.Label
+	}
+	if req.Published != nil {
+		track.Published = *req.Published
+		columns["published"] = track.Published
+	}
+	if len(columns) > 0 {
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(track).Updates(columns).Error; err != nil {
+				return err
+			}
+			return publishEvent(tx, EventCaptionsChanged, track.MediaID)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.CaptionCue{}).Where("track_id = ?", track.ID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	out := ToAPICaptionTrack(track, count)
+	return &out, nil
+}
+
+func DeleteCaptionTrack(viewer Viewer, mediaID uint, lang string) error {
+	track, err := editableCaptionTrack(viewer, mediaID, lang)
+	if err != nil {
+		return err
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("track_id = ?", track.ID).Delete(&models.CaptionCue{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(track).Error; err != nil {
+			return err
+		}
+		return publishEvent(tx, EventCaptionsChanged, track.MediaID)
+	})
+}
+
+// AddCaptionCue inserts a cue into the track for lang.
+func AddCaptionCue(viewer Viewer, mediaID uint, lang string, req api.CaptionCueRequest) (*api.CaptionCue, error) {
+	track, err := editableCaptionTrack(viewer, mediaID, lang)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []apperror.FieldError
+	if req.StartMS == nil {
+		fields = append(fields, apperror.FieldError{Field: "start_ms", Code: "required", Message: "is required"})
+	}
+	if req.EndMS == nil {
+		fields = append(fields, apperror.FieldError{Field: "end_ms", Code: "required", Message: "is required"})
+	}
+	if req.Text == nil {
+		fields = append(fields, apperror.FieldError{Field: "text", Code: "required", Message: "is required"})
+	}
+	if len(fields) > 0 {
+		return nil, apperror.Validation(fields...)
+	}
+
+	cue := &models.CaptionCue{TrackID: track.ID}
+	if err := applyCueRequest(cue, req); err != nil {
+		return nil, err
+	}
+	if maxCues := config.Config.Captions.MaxCues; maxCues > 0 {
+		var count int64
+		if err := config.DB.Model(&models.CaptionCue{}).Where("track_id = ?", track.ID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count >= int64(maxCues) {
+			return nil, apperror.ErrValidation.WithDetail(fmt.Sprintf("A track may have at most %d cues", maxCues))
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(cue).Error; err != nil {
+			return err
+		}
+		return touchCaptionTrack(tx, track)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := toAPICaptionCue(cue)
+	return &out, nil
+}
+
+// UpdateCaptionCue changes the given fields of one cue.
+func UpdateCaptionCue(viewer Viewer, mediaID uint, lang string, cueID uint, req api.CaptionCueRequest) (*api.CaptionCue, error) {
+	track, cue, err := editableCaptionCue(viewer, mediaID, lang, cueID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyCueRequest(cue, req); err != nil {
+		return nil, err
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(cue).Updates(map[string]interface{}{
+			"start_ms": cue.StartMS,
+			"end_ms":   cue.EndMS,
+			"text":     cue.Text,
+		}).Error; err != nil {
+			return err
+		}
+		return touchCaptionTrack(tx, track)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := toAPICaptionCue(cue)
+	return &out, nil
+}
+
+func DeleteCaptionCue(viewer Viewer, mediaID uint, lang string, cueID uint) error {
+	track, cue, err := editableCaptionCue(viewer, mediaID, lang, cueID)
+	if err != nil {
+		return err
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(cue).Error; err != nil {
+			return err
+		}
+		return touchCaptionTrack(tx, track)
+	})
+}
+
+// RequestCaptionDraft queues speech-to-text for the item in lang. The
+// draft replaces an existing track only if that track is itself an
+// unpublished draft.
+func RequestCaptionDraft(viewer Viewer, mediaID uint, lang string) error {
+	item, err := editableMedia(viewer, mediaID)
+	if err != nil {
+		return err
+	}
+	lang, err = ParseCaptionLanguage(lang)
+	if err != nil {
+		return err
+	}
+	if _, ok := jobHandler(JobDraftCaptions); !ok {
+		return apperror.ErrNotEnabled.WithDetail("Automatic captions are not enabled on this server")
+	}
+	if item.Type == models.MediaTypeDocument {
+		return apperror.ErrValidation.WithDetail("Documents have no audio to caption")
+	}
+	if item.SourceKey == "" {
+		return apperror.ErrNotReady.WithDetail("No file has been uploaded for this item")
+	}
+
+	var existing models.CaptionTrack
+	err = config.DB.Where("media_id = ? AND language = ?", item.ID, lang).First(&existing).Error
+	switch {
+	case err == nil:
+		if existing.Published || existing.Source != models.CaptionSourceSpeech {
+			return apperror.ErrConflict.WithDetail("A reviewed caption track exists for this language; delete it first")
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	}
+
+	return EnqueueJob(config.DB, JobDraftCaptions, item.ID, DraftCaptionsJob{Language: lang, CreatedBy: viewer.UserID})
+}
+
+// queueAutoDraft drafts captions in the item's language after processing,
+// when enabled and no track exists for it yet.
+func queueAutoDraft(item *models.MediaItem) {
+	if !config.Config.Speech.AutoDraft || item.Type == models.MediaTypeDocument || item.Language == "" {
+		return
+	}
+	if _, ok := jobHandler(JobDraftCaptions); !ok {
+		return
+	}
+	lang, err := ParseCaptionLanguage(item.Language)
+	if err != nil {
+		return
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.CaptionTrack{}).
+		Where("media_id = ? AND language = ?", item.ID, lang).
+		Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	if err := EnqueueJob(config.DB, JobDraftCaptions, item.ID, DraftCaptionsJob{Language: lang}); err != nil {
+		config.Log.WithError(err).WithField("media_id", item.ID).Warn("failed to queue caption draft")
+	}
+}
+
+// SearchTranscripts finds cues matching q in the published captions of items
+// the viewer may see, best matches first. q accepts web search syntax:
+// quoted phrases, OR and -exclusions.
+func SearchTranscripts(viewer Viewer, q, lang string, mediaID uint, page Page) ([]api.TranscriptMatch, int64, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return nil, 0, apperror.Validation(apperror.FieldError{Field: "q", Code: "required", Message: "is required"})
+	}
+
+	query := config.DB.Table("caption_cues").
+		Joins("JOIN caption_tracks ON caption_tracks.id = caption_cues.track_id").
+		Joins("JOIN media_items ON media_items.id = caption_tracks.media_id AND media_items.deleted_at IS NULL").
+		Where(transcriptVector+" @@ websearch_to_tsquery('simple', ?)", q)
+	if !viewer.IsAdmin() {
+		query = query.Where("(media_items.visibility = ? AND (media_items.publish_at IS NULL OR media_items.publish_at <= ?) "+
+			"AND caption_tracks.published) OR media_items.owner_id = ?",
+			models.VisibilityPublic, time.Now(), viewer.UserID)
+	}
+	if lang != "" {
+		canonical, err := ParseCaptionLanguage(lang)
+		if err != nil {
+			return nil, 0, err
+		}
+		query = query.Where("caption_tracks.language = ?", canonical)
+	}
+	if mediaID != 0 {
+		query = query.Where("caption_tracks.media_id = ?", mediaID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	matches := []api.TranscriptMatch{}
+	if err := query.
+		Select("caption_tracks.media_id, media_items.title AS media_title, caption_tracks.language, "+
+			"caption_cues.id AS cue_id, caption_cues.start_ms, caption_cues.end_ms, caption_cues.text, "+
+			"ts_rank("+transcriptVector+", websearch_to_tsquery('simple', ?)) AS rank", q).
+		Order("rank DESC, caption_tracks.media_id, caption_cues.start_ms").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Scan(&matches).Error; err != nil {
+		return nil, 0, err
+	}
+	for i := range matches {
+		matches[i].Link = TranscriptLink(matches[i].MediaID, matches[i].Language, matches[i].StartMS)
+	}
+	return matches, total, nil
+}
+
+// TranscriptLink deep-links into the player at startMS using the configured
+// captions.deep_link_url.
+func TranscriptLink(mediaID uint, lang string, startMS int64) string {
+	return strings.NewReplacer(
+		"{media_id}", strconv.FormatUint(uint64(mediaID), 10),
+		"{seconds}", strconv.FormatInt(startMS/1000, 10),
+		"{language}", lang,
+	).Replace(config.Config.Captions.DeepLinkURL)
+}
+
+// publishedCaptions lists the item's published tracks for playback.
+func publishedCaptions(mediaID uint) ([]models.CaptionTrack, error) {
+	var tracks []models.CaptionTrack
+	err := config.DB.Where("media_id = ? AND published", mediaID).Order("language").Find(&tracks).Error
+	return tracks, err
+}
+
+// captionStreamPath is where a track is served below a signed stream URL.
+// The version changes on every edit so cached copies are never stale.
+func captionStreamPath(track *models.CaptionTrack) string {
+	return fmt.Sprintf("captions/%d/%s.vtt", track.UpdatedAt.UnixMilli(), track.Language)
+}
+
+// captionPlaylistPath is where HLS players find a track, as the single
+// segment of a subtitle playlist next to captionStreamPath.
+func captionPlaylistPath(track *models.CaptionTrack) string {
+	return strings.TrimSuffix(captionStreamPath(track), ".vtt") + ".m3u8"
+}
+
+// openCaptionStream renders a published track for OpenStream, as WebVTT
+// or as its subtitle playlist. file is the part of captionStreamPath or
+// captionPlaylistPath after "captions/".
+func openCaptionStream(mediaID uint, file string) (*StreamFile, error) {
+	notFound := apperror.ErrNotFound.WithDetail("Captions not found")
+	_, name, ok := strings.Cut(file, "/")
+	lang, isVTT := strings.CutSuffix(name, ".vtt")
+	lang, isPlaylist := strings.CutSuffix(lang, ".m3u8")
+	if !ok || isVTT == isPlaylist {
+		return nil, notFound
+	}
+
+	var track models.CaptionTrack
+	if err := config.DB.Where("media_id = ? AND language = ? AND published", mediaID, lang).First(&track).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound
+		}
+		return nil, err
+	}
+	cues, err := trackCues(track.ID)
+	if err != nil {
+		return nil, err
+	}
+	if isPlaylist {
+		return captionPlaylist(mediaID, &track, cues)
+	}
+
+	var buf bytes.Buffer
+	if err := captions.WriteVTT(&buf, toCaptionCues(cues)); err != nil {
+		return nil, err
+	}
+	return &StreamFile{
+		Object:       nopCloser{bytes.NewReader(buf.Bytes())},
+		Name:         lang + ".vtt",
+		Size:         int64(buf.Len()),
+		ModTime:      track.UpdatedAt,
+		ContentType:  captions.ContentTypes[captions.FormatVTT],
+		ETag:         fmt.Sprintf(`"captions-%d-%d"`, track.ID, track.UpdatedAt.UnixMilli()),
+		DownloadName: fmt.Sprintf("media-%d-%s.vtt", mediaID, lang),
+	}, nil
+}
+
+// captionPlaylist presents a track as one segment lasting the whole item,
+// or until its last cue if the item's duration is not known.
+func captionPlaylist(mediaID uint, track *models.CaptionTrack, cues []models.CaptionCue) (*StreamFile, error) {
+	var item models.MediaItem
+	if err := config.DB.Select("id", "duration_seconds").First(&item, mediaID).Error; err != nil {
+		return nil, err
+	}
+	seconds := float64(item.DurationSeconds)
+	for _, c := range cues {
+		seconds = max(seconds, float64(c.EndMS)/1000)
+	}
+
+	var buf bytes.Buffer
+	if err := transcode.WriteSubtitlePlaylist(&buf, track.Language+".vtt", seconds); err != nil {
+		return nil, err
+	}
+	return &StreamFile{
+		Object:       nopCloser{bytes.NewReader(buf.Bytes())},
+		Name:         track.Language + ".m3u8",
+		Size:         int64(buf.Len()),
+		ModTime:      track.UpdatedAt,
+		ContentType:  packagedContentTypes[".m3u8"],
+		ETag:         fmt.Sprintf(`"captions-%d-%d-%d"`, track.ID, track.UpdatedAt.UnixMilli(), item.DurationSeconds),
+		DownloadName: fmt.Sprintf("media-%d-%s.m3u8", mediaID, track.Language),
+	}, nil
+}
+
+// captionBundleFiles adds published captions to offline packages.
+func captionBundleFiles(ctx context.Context, item *models.MediaItem, quality string) ([]BundleFile, error) {
+	tracks, err := publishedCaptions(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]BundleFile, 0, len(tracks))
+	for i := range tracks {
+		cues, err := trackCues(tracks[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := captions.WriteVTT(&buf, toCaptionCues(cues)); err != nil {
+			return nil, err
+		}
+		files = append(files, BundleFile{
+			Path:        "captions/" + tracks[i].Language + ".vtt",
+			Role:        "captions",
+			ContentType: captions.ContentTypes[captions.FormatVTT],
+			Data:        buf.Bytes(),
+		})
+	}
+	return files, nil
+}
+
+func draftCaptions(ctx context.Context, job *models.ProcessingJob) error {
+	var payload DraftCaptionsJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	if config.Transcriber == nil {
+		return errors.New("no speech-to-text engine configured")
+	}
+
+	var item models.MediaItem
+	if err := config.DB.First(&item, job.MediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if item.SourceKey == "" {
+		return nil
+	}
+
+	workDir, err := os.MkdirTemp(config.Config.Transcode.WorkDir, "captions-job-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	// The packaged audio download is far smaller than a video source and
+	// all the engine needs
+	key := item.SourceKey
+	if item.HLSPrefix != "" && slices.Contains(item.Downloads, "audio.m4a") {
+		key = item.HLSPrefix + transcode.DownloadsDir + "/audio.m4a"
+	}
+	input := filepath.Join(workDir, "input")
+	if err := downloadObject(ctx, key, input); err != nil {
+		return fmt.Errorf("download audio: %w", err)
+	}
+
+	cues, err := config.Transcriber.Transcribe(ctx, input, payload.Language)
+	if err != nil {
+		return fmt.Errorf("transcribe: %w", err)
+	}
+
+	var existing models.CaptionTrack
+	err = config.DB.Where("media_id = ? AND language = ?", item.ID, payload.Language).First(&existing).Error
+	if err == nil && (existing.Published || existing.Source != models.CaptionSourceSpeech) {
+		// Someone supplied reviewed captions while the draft was running
+		return nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	return replaceCaptionTrack(&models.CaptionTrack{
+		MediaID:   item.ID,
+		Language:  payload.Language,
+		Source:    models.CaptionSourceSpeech,
+		CreatedBy: payload.CreatedBy,
+	}, cues)
+}
+
+// replaceCaptionTrack creates or overwrites the track for track.MediaID and
+// track.Language with cues, filling in track's ID.
+func replaceCaptionTrack(track *models.CaptionTrack, cues []captions.Cue) error {
+	if maxCues := config.Config.Captions.MaxCues; maxCues > 0 && len(cues) > maxCues {
+		return apperror.ErrValidation.WithDetail(fmt.Sprintf("A track may have at most %d cues", maxCues))
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var existing models.CaptionTrack
+		err := tx.Where("media_id = ? AND language = ?", track.MediaID, track.Language).First(&existing).Error
+		switch {
+		case err == nil:
+			track.ID = existing.ID
+			track.CreatedAt = existing.CreatedAt
+			if track.Label == "" {
+				track.Label = existing.Label
+			}
+			if err := tx.Save(track).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("track_id = ?", track.ID).Delete(&models.CaptionCue{}).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(track).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		rows := make([]models.CaptionCue, 0, len(cues))
+		for _, c := range cues {
+			rows = append(rows, models.CaptionCue{
+				TrackID: track.ID,
+				StartMS: c.Start.Milliseconds(),
+				EndMS:   c.End.Milliseconds(),
+				Text:    c.Text,
+			})
+		}
+		if len(rows) > 0 {
+			if err := tx.CreateInBatches(rows, 500).Error; err != nil {
+				return err
+			}
+		}
+		return publishEvent(tx, EventCaptionsChanged, track.MediaID)
+	})
+}
+
+func ToAPICaptionTrack(track *models.CaptionTrack, cueCount int64) api.CaptionTrack {
+	return api.CaptionTrack{
+		Language:  track.Language,
+		Label:     track.Label,
+		Source:    track.Source,
+		Published: track.Published,
+		CueCount:  cueCount,
+		URL:       fmt.Sprintf("/api/media/%d/captions/%s", track.MediaID, track.Language),
+		CreatedAt: track.CreatedAt,
+		UpdatedAt: track.UpdatedAt,
+	}
+}
+
+func toAPICaptionCue(cue *models.CaptionCue) api.CaptionCue {
+	return api.CaptionCue{
+		ID:      cue.ID,
+		StartMS: cue.StartMS,
+		EndMS:   cue.EndMS,
+		Text:    cue.Text,
+	}
+}
+
+func toCaptionCues(cues []models.CaptionCue) []captions.Cue {
+	out := make([]captions.Cue, 0, len(cues))
+	for _, c := range cues {
+		out = append(out, captions.Cue{
+			Start: time.Duration(c.StartMS) * time.Millisecond,
+			End:   time.Duration(c.EndMS) * time.Millisecond,
+			Text:  c.Text,
+		})
+	}
+	return out
+}
+
+func trackCues(trackID uint) ([]models.CaptionCue, error) {
+	var cues []models.CaptionCue
+	err := config.DB.Where("track_id = ?", trackID).Order("start_ms, id").Find(&cues).Error
+	return cues, err
+}
+
+// visibleCaptionTrack finds the track for lang, hiding drafts from viewers
+// who cannot edit the item.
+func visibleCaptionTrack(viewer Viewer, mediaID uint, lang string) (*models.CaptionTrack, error) {
+	item, err := GetMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	track, err := findCaptionTrack(item.ID, lang)
+	if err != nil {
+		return nil, err
+	}
+	if !track.Published && !viewer.CanEdit(item) {
+		return nil, apperror.ErrNotFound.WithDetail("Caption track not found")
+	}
+	return track, nil
+}
+
+func editableCaptionTrack(viewer Viewer, mediaID uint, lang string) (*models.CaptionTrack, error) {
+	item, err := editableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return findCaptionTrack(item.ID, lang)
+}
+
+func editableCaptionCue(viewer Viewer, mediaID uint, lang string, cueID uint) (*models.CaptionTrack, *models.CaptionCue, error) {
+	track, err := editableCaptionTrack(viewer, mediaID, lang)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cue models.CaptionCue
+	if err := config.DB.Where("id = ? AND track_id = ?", cueID, track.ID).First(&cue).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, apperror.ErrNotFound.WithDetail("Cue not found")
+		}
+		return nil, nil, err
+	}
+	return track, &cue, nil
+}
+
+func findCaptionTrack(mediaID uint, lang string) (*models.CaptionTrack, error) {
+	lang, err := ParseCaptionLanguage(lang)
+	if err != nil {
+		return nil, apperror.ErrNotFound.WithDetail("Caption track not found")
+	}
+	var track models.CaptionTrack
+	if err := config.DB.Where("media_id = ? AND language = ?", mediaID, lang).First(&track).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Caption track not found")
+		}
+		return nil, err
+	}
+	return &track, nil
+}
+
+func applyCueRequest(cue *models.CaptionCue, req api.CaptionCueRequest) error {
+	if req.StartMS != nil {
+		cue.StartMS = *req.StartMS
+	}
+	if req.EndMS != nil {
+		cue.EndMS = *req.EndMS
+	}
+	if req.Text != nil {
+		cue.Text = strings.TrimSpace(*req.Text)
+	}
+	if cue.Text == "" {
+		return apperror.Validation(apperror.FieldError{Field: "text", Code: "required", Message: "is required"})
+	}
+	if cue.EndMS <= cue.StartMS {
+		return apperror.Validation(apperror.FieldError{Field: "end_ms", Code: "gtfield", Message: "must be after start_ms"})
+	}
+	return nil
+}
+
+// touchCaptionTrack bumps the track's version after a cue edit and
+// announces the change.
+func touchCaptionTrack(tx *gorm.DB, track *models.CaptionTrack) error {
+	if err := tx.Model(track).Update("updated_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return publishEvent(tx, EventCaptionsChanged, track.MediaID)
+}
+
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,124 @@
+// media-service/pkg/services/cohort_service.go
+package services
+
+import (
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// ListCohorts returns every cohort with members and how many it has.
+func ListCohorts(viewer Viewer) ([]api.Cohort, error) {
+	if !viewer.IsAdmin() {
+		return nil, apperror.ErrForbidden.WithDetail("Only admins can manage cohorts")
+	}
+	cohorts := []api.Cohort{}
+	err := config.DB.Model(&models.CohortMember{}).
+		Select("cohort AS name, COUNT(*) AS members").
+		Group("cohort").
+		Order("cohort").
+		Scan(&cohorts).Error
+	return cohorts, err
+}
+
+// ListCohortMembers returns a page of a cohort's members, most recently
+// added first.
+func ListCohortMembers(viewer Viewer, cohort string, page Page) ([]models.CohortMember, int64, error) {
+	cohort, err := managedCohort(viewer, cohort)
+	if err != nil {
+		return nil, 0, err
+	}
+	query := config.DB.Model(&models.CohortMember{}).Where("cohort = ?", cohort)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var members []models.CohortMember
+	if err := query.
+		Order("created_at DESC").
+		Order("user_id").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&members).Error; err != nil {
+		return nil, 0, err
+	}
+	return members, total, nil
+}
+
+// AddCohortMembers puts users in a cohort, creating it if it has no
+// members yet. Users already in it are left as they are.
+func AddCohortMembers(viewer Viewer, cohort string, req api.CohortMembersRequest) ([]models.CohortMember, error) {
+	cohort, err := managedCohort(viewer, cohort)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := uniqueIDs(req.UserIDs)
+	members := make([]models.CohortMember, 0, len(ids))
+	for _, userID := range ids {
+		members = append(members, models.CohortMember{Cohort: cohort, UserID: userID})
+	}
+	if err := config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error; err != nil {
+		return nil, err
+	}
+	if err := config.DB.Where("cohort = ? AND user_id IN ?", cohort, []uint(ids)).Order("user_id").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// RemoveCohortMember takes a user out of a cohort and revokes their
+// offline licenses for the items whose access rules name it.
+func RemoveCohortMember(viewer Viewer, cohort string, userID uint) error {
+	cohort, err := managedCohort(viewer, cohort)
+	if err != nil {
+		return err
+	}
+	result := config.DB.Where("cohort = ? AND user_id = ?", cohort, userID).Delete(&models.CohortMember{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return apperror.ErrNotFound.WithDetail("User is not in this cohort")
+	}
+
+	var gated []uint
+	if err := config.DB.Model(&models.MediaAccess{}).
+		Where("cohorts @> ?", models.StringList{cohort}).
+		Pluck("media_id", &gated).Error; err != nil {
+		return err
+	}
+	if len(gated) == 0 {
+		return nil
+	}
+	_, err = RevokeUserOfflineLicenses(userID, gated, "left_cohort")
+	return err
+}
+
+func ToAPICohortMember(m *models.CohortMember) api.CohortMember {
+	return api.CohortMember{
+		Cohort:  m.Cohort,
+		UserID:  m.UserID,
+		AddedAt: m.CreatedAt,
+	}
+}
+
+// managedCohort checks the viewer may manage cohorts and returns the
+// cohort's name trimmed.
+func managedCohort(viewer Viewer, cohort string) (string, error) {
+	if !viewer.IsAdmin() {
+		return "", apperror.ErrForbidden.WithDetail("Only admins can manage cohorts")
+	}
+	cohort = strings.TrimSpace(cohort)
+	if cohort == "" || len(cohort) > 100 {
+		return "", apperror.Validation(apperror.FieldError{
+			Field: "cohort", Code: "max", Message: "must be 1 to 100 characters long",
+		})
+	}
+	return cohort, nil
+}
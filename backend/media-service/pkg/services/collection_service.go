@@ -0,0 +1,669 @@
+// media-service/pkg/services/collection_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxCollectionItems = 1000
+	// Levels of nesting, counting the top-level collection
+	maxCollectionDepth = 5
+)
+
+// CollectionFilter narrows ListCollections. Empty fields match everything.
+type CollectionFilter struct {
+	Kind    string
+	OwnerID uint
+	// Sub-collections of this collection; 0 for top-level collections
+	ParentID *uint
+	// Case-insensitive match against the title
+	Query string
+}
+
+// CollectionUpdate is a partial update; nil fields are left unchanged.
+type CollectionUpdate struct {
+	Title       *string
+	Description *string
+	Visibility  *string
+	PublishAt   *time.Time
+	// 0 makes the collection top-level
+	ParentID *uint
+}
+
+// ListCollections returns the page of collections matching filter that
+// viewer may see, in manual order, along with the total number of
+// matches.
+func ListCollections(viewer Viewer, filter CollectionFilter, page Page) ([]models.Collection, int64, error) {
+	query := config.DB.Model(&models.Collection{})
+	if !viewer.IsAdmin() {
+		query = query.Where(visibleRows("collections"), models.VisibilityPublic, time.Now(), viewer.UserID)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("owner_id = ?", filter.OwnerID)
+	}
+	if filter.ParentID != nil {
+		if *filter.ParentID == 0 {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *filter.ParentID)
+		}
+	}
+	if filter.Query != "" {
+		query = query.Where("title ILIKE ?", "%"+escapeLike(filter.Query)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var collections []models.Collection
+	if err := query.
+		Order("position").
+		Order("title").
+		Order("id").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&collections).Error; err != nil {
+		return nil, 0, err
+	}
+	return collections, total, nil
+}
+
+func GetCollection(viewer Viewer, id uint) (*models.Collection, error) {
+	var collection models.Collection
+	if err := config.DB.First(&collection, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Collection not found")
+		}
+		return nil, err
+	}
+	if !viewer.CanViewCollection(&collection) {
+		return nil, apperror.ErrNotFound.WithDetail("Collection not found")
+	}
+	return &collection, nil
+}
+
+func CreateCollection(viewer Viewer, req api.CollectionRequest) (*models.Collection, error) {
+	if req.Kind != models.CollectionPlaylist && !viewer.CanPublish() {
+		return nil, apperror.ErrForbidden.WithDetail("Only trainers and admins can create series and collections")
+	}
+
+	collection := &models.Collection{
+		Kind:        req.Kind,
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		OwnerID:     viewer.UserID,
+		Visibility:  req.Visibility,
+		PublishAt:   req.PublishAt,
+	}
+	if collection.Visibility == "" {
+		collection.Visibility = models.VisibilityPrivate
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if req.ParentID != nil && *req.ParentID != 0 {
+			position, err := nestingPosition(tx, viewer, 0, *req.ParentID)
+			if err != nil {
+				return err
+			}
+			collection.ParentID = req.ParentID
+			collection.Position = position
+		}
+		if err := tx.Create(collection).Error; err != nil {
+			return err
+		}
+		_, err := addCollectionItems(tx, viewer, collection.ID, req.MediaIDs, nil)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+func UpdateCollection(viewer Viewer, id uint, update CollectionUpdate) (*models.Collection, error) {
+	collection, err := editableCollection(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	if update.Title != nil {
+		columns["title"] = *update.Title
+	}
+	if update.Description != nil {
+		columns["description"] = *update.Description
+	}
+	if update.Visibility != nil {
+		columns["visibility"] = *update.Visibility
+	}
+	if update.PublishAt != nil {
+		columns["publish_at"] = *update.PublishAt
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if update.ParentID != nil {
+			switch {
+			case *update.ParentID == 0:
+				columns["parent_id"] = nil
+				columns["position"] = 0
+			case collection.ParentID == nil || *collection.ParentID != *update.ParentID:
+				position, err := nestingPosition(tx, viewer, id, *update.ParentID)
+				if err != nil {
+					return err
+				}
+				columns["parent_id"] = *update.ParentID
+				columns["position"] = position
+			}
+		}
+		if len(columns) == 0 {
+			return nil
+		}
+		return tx.Model(collection).Updates(columns).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCollection(viewer, id)
+}
+
+// DeleteCollection removes a collection. Its sub-collections move up to
+// its parent; the items in it stay in the catalog.
+func DeleteCollection(viewer Viewer, id uint) error {
+	collection, err := editableCollection(viewer, id)
+	if err != nil {
+		return err
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Collection{}).
+			Where("parent_id = ?", id).
+			Update("parent_id", collection.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("collection_id = ?", id).Delete(&models.CollectionItem{}).Error; err != nil {
+			return err
+		}
+		// Their files go with the storage lifecycle rules
+		if err := tx.Where("collection_id = ?", id).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(collection).Error
+	})
+}
+
+// CollectionContents returns the items and sub-collections of c that
+// viewer may see, in order.
+func CollectionContents(viewer Viewer, c *models.Collection) ([]models.MediaItem, []models.Collection, error) {
+	items := config.DB.Model(&models.MediaItem{}).
+		Joins("JOIN collection_items ON collection_items.media_id = media_items.id").
+		Where("collection_items.collection_id = ?", c.ID)
+	children := config.DB.Model(&models.Collection{}).Where("parent_id = ?", c.ID)
+	if !viewer.IsAdmin() {
+		items = whereEntitled(items.Where(visibleRows("media_items"), models.VisibilityPublic, time.Now(), viewer.UserID), viewer)
+		children = children.Where(visibleRows("collections"), models.VisibilityPublic, time.Now(), viewer.UserID)
+	}
+
+	var media []models.MediaItem
+	if err := items.Order("collection_items.position").Find(&media).Error; err != nil {
+		return nil, nil, err
+	}
+	var subs []models.Collection
+	if err := children.Order("position").Order("id").Find(&subs).Error; err != nil {
+		return nil, nil, err
+	}
+	return media, subs, nil
+}
+
+// CollectionItemCounts returns how many items each of the collections
+// holds directly.
+func CollectionItemCounts(ids []uint) (map[uint]int, error) {
+	var rows []struct {
+		CollectionID uint
+		Count        int
+	}
+	if err := config.DB.Model(&models.CollectionItem{}).
+		Select("collection_id, COUNT(*) AS count").
+		Where("collection_id IN ?", ids).
+		Group("collection_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		counts[row.CollectionID] = row.Count
+	}
+	return counts, nil
+}
+
+// AddCollectionItems inserts the items viewer may see at position, or at
+// the end, in the order given. Items already in the collection stay
+// where they are. It returns how many were added and the new item count.
+func AddCollectionItems(viewer Viewer, id uint, mediaIDs []uint, position *int) (int, int, error) {
+	if _, err := editableCollection(viewer, id); err != nil {
+		return 0, 0, err
+	}
+	var added, count int
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		order, err := addCollectionItems(tx, viewer, id, mediaIDs, position)
+		if err != nil {
+			return err
+		}
+		count = len(order.next)
+		added = count - len(order.current)
+		return nil
+	})
+	return added, count, err
+}
+
+// RemoveCollectionItems takes the items out of the collection, closing
+// up the order. It returns how many were removed and the new item count.
+func RemoveCollectionItems(viewer Viewer, id uint, mediaIDs []uint) (int, int, error) {
+	if _, err := editableCollection(viewer, id); err != nil {
+		return 0, 0, err
+	}
+	var removed, count int
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		current, err := lockItemOrder(tx, id)
+		if err != nil {
+			return err
+		}
+		drop := make(map[uint]bool, len(mediaIDs))
+		for _, mediaID := range mediaIDs {
+			drop[mediaID] = true
+		}
+		order := itemOrder{current: current}
+		for _, mediaID := range current {
+			if !drop[mediaID] {
+				order.next = append(order.next, mediaID)
+			}
+		}
+		removed = len(current) - len(order.next)
+		count = len(order.next)
+		if removed == 0 {
+			return nil
+		}
+		if err := tx.Where("collection_id = ? AND media_id IN ?", id, mediaIDs).
+			Delete(&models.CollectionItem{}).Error; err != nil {
+			return err
+		}
+		return order.write(tx, id)
+	})
+	return removed, count, err
+}
+
+// ReorderCollection sets the manual order of the collection's items and
+// of its sub-collections. Each list must hold exactly what is there now;
+// an empty list leaves that order as it is.
+func ReorderCollection(viewer Viewer, id uint, mediaIDs, collectionIDs []uint) error {
+	if _, err := editableCollection(viewer, id); err != nil {
+		return err
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if len(mediaIDs) > 0 {
+			current, err := lockItemOrder(tx, id)
+			if err != nil {
+				return err
+			}
+			if !samePermutation(current, mediaIDs) {
+				return apperror.Validation(apperror.FieldError{
+					Field: "media_ids", Code: "permutation", Message: "must list every item in the collection once",
+				})
+			}
+			if err := (itemOrder{current: current, next: mediaIDs}).write(tx, id); err != nil {
+				return err
+			}
+		}
+
+		if len(collectionIDs) > 0 {
+			var children []uint
+			if err := tx.Model(&models.Collection{}).Where("parent_id = ?", id).
+				Order("position").Order("id").Pluck("id", &children).Error; err != nil {
+				return err
+			}
+			if !samePermutation(children, collectionIDs) {
+				return apperror.Validation(apperror.FieldError{
+					Field: "collection_ids", Code: "permutation", Message: "must list every sub-collection once",
+				})
+			}
+			for i, childID := range collectionIDs {
+				if err := tx.Model(&models.Collection{}).Where("id = ?", childID).
+					Update("position", i).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// NextUp picks what viewer should play next in the collection, going
+// through its items and then each sub-collection's in order. Without
+// after it continues from the item viewer played last: that item again if
+// unfinished, otherwise the next one not yet completed. It returns nil
+// when there is nothing left.
+func NextUp(ctx context.Context, viewer Viewer, id, after uint) (*api.NextUp, error) {
+	collection, err := GetCollection(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := collectionPlaylist(viewer, collection, map[uint]bool{}, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(items))
+	for i := range items {
+		ids[i] = items[i].ID
+	}
+	progress, err := loadProgress(ctx, viewer.UserID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	pick, reason := -1, api.NextUpNext
+	if after != 0 {
+		for i := range items {
+			if items[i].ID == after {
+				pick = i + 1
+				break
+			}
+		}
+		if pick < 0 {
+			return nil, apperror.Validation(apperror.FieldError{
+				Field: "after", Code: "in_collection", Message: "must be an item in the collection",
+			})
+		}
+	} else {
+		last := -1
+		for i, mediaID := range ids {
+			p := progress[mediaID]
+			if p == nil || p.LastPlayedAt == nil {
+				continue
+			}
+			if last < 0 || p.LastPlayedAt.After(*progress[ids[last]].LastPlayedAt) {
+				last = i
+			}
+		}
+		switch {
+		case last < 0:
+			pick, reason = 0, api.NextUpStart
+		case !progress[ids[last]].Completed:
+			pick, reason = last, api.NextUpResume
+		default:
+			pick = len(items)
+			for i := last + 1; i < len(items); i++ {
+				if p := progress[ids[i]]; p == nil || !p.Completed {
+					pick = i
+					break
+				}
+			}
+		}
+	}
+	if pick >= len(items) {
+		return nil, nil
+	}
+
+	out := []api.MediaItem{ToAPIMedia(&items[pick])}
+	out[0].Progress = progress[out[0].ID]
+	AttachAccess(ctx, viewer, out)
+	return &api.NextUp{CollectionID: id, Reason: reason, Item: out[0]}, nil
+}
+
+// ToAPICollection converts the collection into its public representation.
+func ToAPICollection(c *models.Collection, itemCount int) api.Collection {
+	return api.Collection{
+		ID:          c.ID,
+		Kind:        c.Kind,
+		Title:       c.Title,
+		Description: c.Description,
+		OwnerID:     c.OwnerID,
+		Visibility:  c.Visibility,
+		PublishAt:   c.PublishAt,
+		ParentID:    c.ParentID,
+		Position:    c.Position,
+		ItemCount:   itemCount,
+		CreatedAt:   c.CreatedAt,
+		UpdatedAt:   c.UpdatedAt,
+	}
+}
+
+// itemOrder is a collection's media IDs before and after a change.
+type itemOrder struct {
+	current []uint
+	next    []uint
+}
+
+// write stores the positions of next for the rows that already exist,
+// moving only those whose position changed.
+func (o itemOrder) write(tx *gorm.DB, id uint) error {
+	for i, mediaID := range o.next {
+		if i < len(o.current) && o.current[i] == mediaID {
+			continue
+		}
+		if err := tx.Model(&models.CollectionItem{}).
+			Where("collection_id = ? AND media_id = ?", id, mediaID).
+			Update("position", i).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addCollectionItems inserts mediaIDs into the collection in tx.
+func addCollectionItems(tx *gorm.DB, viewer Viewer, id uint, mediaIDs []uint, position *int) (itemOrder, error) {
+	current, err := lockItemOrder(tx, id)
+	if err != nil {
+		return itemOrder{}, err
+	}
+	order := itemOrder{current: current, next: current}
+
+	present := make(map[uint]bool, len(current))
+	for _, mediaID := range current {
+		present[mediaID] = true
+	}
+	var adding []uint
+	for _, mediaID := range mediaIDs {
+		if !present[mediaID] {
+			present[mediaID] = true
+			adding = append(adding, mediaID)
+		}
+	}
+	if len(adding) == 0 {
+		return order, nil
+	}
+	if len(current)+len(adding) > maxCollectionItems {
+		return order, apperror.Validation(apperror.FieldError{
+			Field: "media_ids", Code: "max", Message: fmt.Sprintf("a collection holds at most %d items", maxCollectionItems),
+		})
+	}
+
+	var items []models.MediaItem
+	if err := tx.Where("id IN ?", adding).Find(&items).Error; err != nil {
+		return order, err
+	}
+	visible := make(map[uint]bool, len(items))
+	for i := range items {
+		visible[items[i].ID] = viewer.CanView(&items[i])
+	}
+	for _, mediaID := range adding {
+		if !visible[mediaID] {
+			return order, apperror.Validation(apperror.FieldError{
+				Field: "media_ids", Code: "exists", Message: fmt.Sprintf("media item %d not found", mediaID),
+			})
+		}
+	}
+
+	at := len(current)
+	if position != nil && *position < at {
+		at = *position
+	}
+	order.next = make([]uint, 0, len(current)+len(adding))
+	order.next = append(order.next, current[:at]...)
+	order.next = append(order.next, adding...)
+	order.next = append(order.next, current[at:]...)
+
+	rows := make([]models.CollectionItem, len(adding))
+	for i, mediaID := range adding {
+		rows[i] = models.CollectionItem{CollectionID: id, MediaID: mediaID, Position: at + i}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return order, err
+	}
+	// Items after the insertion point move down
+	if at < len(current) {
+		if err := tx.Model(&models.CollectionItem{}).
+			Where("collection_id = ? AND media_id IN ?", id, current[at:]).
+			Update("position", gorm.Expr("position + ?", len(adding))).Error; err != nil {
+			return order, err
+		}
+	}
+	return order, nil
+}
+
+// lockItemOrder locks the collection against concurrent changes in tx and
+// returns its media IDs in order.
+func lockItemOrder(tx *gorm.DB, id uint) ([]uint, error) {
+	var collection models.Collection
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&collection, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Collection not found")
+		}
+		return nil, err
+	}
+	var ids []uint
+	err := tx.Model(&models.CollectionItem{}).
+		Where("collection_id = ?", id).
+		Order("position").
+		Pluck("media_id", &ids).Error
+	return ids, err
+}
+
+// nestingPosition checks that the collection id (0 for a new one) may go
+// into parentID and returns its position there, at the end.
+func nestingPosition(tx *gorm.DB, viewer Viewer, id, parentID uint) (int, error) {
+	if _, err := editableCollection(viewer, parentID); err != nil {
+		return 0, err
+	}
+
+	// Walk up from the new parent, refusing cycles and deep nesting
+	depth := 1
+	for ancestor := &parentID; ancestor != nil; depth++ {
+		if *ancestor == id {
+			return 0, apperror.Validation(apperror.FieldError{
+				Field: "parent_id", Code: "cycle", Message: "cannot be the collection itself or one inside it",
+			})
+		}
+		var c models.Collection
+		if err := tx.Select("id, parent_id").First(&c, *ancestor).Error; err != nil {
+			return 0, err
+		}
+		ancestor = c.ParentID
+	}
+	height, err := subtreeHeight(tx, id)
+	if err != nil {
+		return 0, err
+	}
+	if depth+height > maxCollectionDepth+1 {
+		return 0, apperror.Validation(apperror.FieldError{
+			Field: "parent_id", Code: "depth", Message: fmt.Sprintf("collections nest at most %d deep", maxCollectionDepth),
+		})
+	}
+
+	var siblings int64
+	if err := tx.Model(&models.Collection{}).Where("parent_id = ?", parentID).Count(&siblings).Error; err != nil {
+		return 0, err
+	}
+	return int(siblings), nil
+}
+
+// subtreeHeight counts the levels of the collection and those below it;
+// 1 for a new collection.
+func subtreeHeight(tx *gorm.DB, id uint) (int, error) {
+	height := 1
+	level := []uint{id}
+	for id != 0 && height <= maxCollectionDepth {
+		var children []uint
+		if err := tx.Model(&models.Collection{}).Where("parent_id IN ?", level).Pluck("id", &children).Error; err != nil {
+			return 0, err
+		}
+		if len(children) == 0 {
+			break
+		}
+		height++
+		level = children
+	}
+	return height, nil
+}
+
+// collectionPlaylist flattens the collection into the items viewer may
+// see: its own, then each sub-collection's, each item once.
+func collectionPlaylist(viewer Viewer, c *models.Collection, seen map[uint]bool, depth int) ([]models.MediaItem, error) {
+	items, children, err := CollectionContents(viewer, c)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.MediaItem
+	for i := range items {
+		if !seen[items[i].ID] {
+			seen[items[i].ID] = true
+			out = append(out, items[i])
+		}
+	}
+	if depth >= maxCollectionDepth {
+		return out, nil
+	}
+	for i := range children {
+		sub, err := collectionPlaylist(viewer, &children[i], seen, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, sub...)
+	}
+	return out, nil
+}
+
+func editableCollection(viewer Viewer, id uint) (*models.Collection, error) {
+	collection, err := GetCollection(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.CanEditCollection(collection) {
+		return nil, apperror.ErrForbidden.WithDetail("You cannot modify this collection")
+	}
+	return collection, nil
+}
+
+// samePermutation reports whether b holds exactly the IDs of a, each once.
+func samePermutation(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[uint]int, len(a))
+	for _, id := range a {
+		count[id]++
+	}
+	for _, id := range b {
+		if count[id] == 0 {
+			return false
+		}
+		count[id]--
+	}
+	return true
+}
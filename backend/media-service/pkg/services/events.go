@@ -0,0 +1,61 @@
+// media-service/pkg/services/events.go
+package services
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Domain events about catalog items
+const (
+	EventMediaCreated = "media.created"
+	// Catalog fields, visibility or publishing dates changed
+	EventMediaUpdated = "media.updated"
+	EventMediaDeleted = "media.deleted"
+	// Processing finished and may have filled in the duration
+	EventMediaProcessed = "media.processed"
+	// A caption track was added, edited, published or removed
+	EventCaptionsChanged = "captions.changed"
+	// An attachment was added, cleared by the virus scan, previewed or
+	// removed
+	EventAttachmentsChanged = "attachments.changed"
+)
+
+type Event struct {
+	Kind    string
+	MediaID uint
+}
+
+// EventHandler reacts to an event inside the transaction that caused it,
+// so work it queues with EnqueueJob only happens if the change commits.
+// Returning an error rolls the change back.
+type EventHandler func(tx *gorm.DB, event Event) error
+
+var (
+	eventHandlersMu sync.RWMutex
+	eventHandlers   = map[string][]EventHandler{}
+)
+
+// Subscribe adds a handler for each of the event kinds.
+func Subscribe(handler EventHandler, kinds ...string) {
+	eventHandlersMu.Lock()
+	defer eventHandlersMu.Unlock()
+	for _, kind := range kinds {
+		eventHandlers[kind] = append(eventHandlers[kind], handler)
+	}
+}
+
+// publishEvent runs the handlers subscribed to kind, in order.
+func publishEvent(tx *gorm.DB, kind string, mediaID uint) error {
+	eventHandlersMu.RLock()
+	handlers := eventHandlers[kind]
+	eventHandlersMu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(tx, Event{Kind: kind, MediaID: mediaID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,299 @@
+// media-service/pkg/services/image_service.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/imaging"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/transcode"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JobPosterFrame takes a poster from the video at a chosen time.
+const JobPosterFrame = "media.poster"
+
+// PosterFrameJob is the payload of JobPosterFrame.
+type PosterFrameJob struct {
+	SourceKey string  `json:"source_key"`
+	AtSeconds float64 `json:"at_seconds"`
+}
+
+// MediaImages signs the item's image URLs, or returns nil if it has none.
+// URLs carry no user, so one item's URLs are the same for every viewer.
+func MediaImages(item *models.MediaItem) *api.MediaImages {
+	images := &api.MediaImages{}
+	expires := imageURLExpiry()
+	base := StreamBaseURL(item.ID, SignStream(item.ID, 0, expires)) + "/images/"
+
+	if keys := posterKeys(item); keys != nil {
+		images.Poster = make(map[string]string, len(keys))
+		for size, key := range keys {
+			images.Poster[size] = base + imageRel(item.ID, key)
+		}
+		images.PosterSource = api.PosterGenerated
+		if item.PosterPrefix != "" {
+			images.PosterSource = item.PosterSource
+		}
+	}
+	if item.ImagesPrefix != "" && item.SpriteSheets > 0 {
+		images.ThumbnailsURL = base + imageRel(item.ID, item.ImagesPrefix+transcode.ThumbnailTrack)
+	}
+	if item.ImagesPrefix != "" && item.HasWaveform {
+		images.WaveformURL = base + imageRel(item.ID, item.ImagesPrefix+transcode.WaveformFile)
+	}
+
+	if images.Poster == nil && images.ThumbnailsURL == "" && images.WaveformURL == "" {
+		return nil
+	}
+	images.ExpiresAt = expires
+	return images
+}
+
+// GetMediaImages returns the item's images along with the generated poster
+// candidates.
+func GetMediaImages(viewer Viewer, id uint) (*api.MediaImagesDetail, error) {
+	item, err := GetMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &api.MediaImagesDetail{Candidates: []api.PosterCandidate{}}
+	if images := MediaImages(item); images != nil {
+		detail.MediaImages = *images
+	}
+	if item.ImagesPrefix == "" {
+		return detail, nil
+	}
+
+	expires := imageURLExpiry()
+	base := StreamBaseURL(item.ID, SignStream(item.ID, 0, expires)) + "/images/"
+	for i, at := range item.PosterTimes {
+		key := item.ImagesPrefix + imaging.SizeFile(transcode.PosterBase(i), "medium")
+		detail.Candidates = append(detail.Candidates, api.PosterCandidate{
+			Index:     i,
+			AtSeconds: at,
+			URL:       base + imageRel(item.ID, key),
+			Selected:  item.PosterPrefix == "" && i == item.PosterIndex,
+		})
+	}
+	return detail, nil
+}
+
+// UploadThumbnail makes an uploaded JPEG, PNG or GIF the item's poster,
+// resized into every imaging size.
+func UploadThumbnail(ctx context.Context, viewer Viewer, id uint, data []byte) error {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return err
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), config.Config.Images.MaxPixels)
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		return apperror.ErrUnsupportedMedia.WithDetail("Thumbnails must be JPEG, PNG or GIF images")
+	case errors.Is(err, imaging.ErrTooLarge):
+		return apperror.ErrPayloadTooLarge.WithDetail("Thumbnail dimensions are too large")
+	case err != nil:
+		return apperror.ErrValidation.WithDetail("Thumbnail image could not be decoded").Wrap(err)
+	}
+
+	prefix := fmt.Sprintf("media/%d/images/upload-%d/", item.ID, time.Now().UnixNano())
+	if err := storePoster(ctx, img, prefix); err != nil {
+		return err
+	}
+	if err := setPoster(ctx, item, prefix, models.PosterUpload); err != nil {
+		storage.DeletePrefix(ctx, config.Storage, prefix)
+		return err
+	}
+	return nil
+}
+
+// ChoosePoster selects a generated candidate, which takes effect at once,
+// or queues a poster taken at a chosen time, reporting true if it did.
+func ChoosePoster(ctx context.Context, viewer Viewer, id uint, req api.ChoosePosterRequest) (bool, error) {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return false, err
+	}
+	if (req.Candidate == nil) == (req.AtSeconds == nil) {
+		return false, apperror.ErrValidation.WithDetail("Give either candidate or at_seconds")
+	}
+
+	if req.Candidate != nil {
+		if *req.Candidate >= len(item.PosterTimes) {
+			return false, apperror.Validation(apperror.FieldError{
+				Field: "candidate", Code: "max", Message: fmt.Sprintf("must be less than %d", len(item.PosterTimes)),
+			})
+		}
+		item.PosterIndex = *req.Candidate
+		if err := config.DB.Model(item).Update("poster_index", item.PosterIndex).Error; err != nil {
+			return false, err
+		}
+		return false, setPoster(ctx, item, "", "")
+	}
+
+	if item.Type != models.MediaTypeVideo || item.SourceKey == "" {
+		return false, apperror.ErrNotReady.WithDetail("Only uploaded videos have frames to take a poster from")
+	}
+	if item.DurationSeconds > 0 && *req.AtSeconds >= float64(item.DurationSeconds) {
+		return false, apperror.Validation(apperror.FieldError{
+			Field: "at_seconds", Code: "max", Message: fmt.Sprintf("must be less than %d", item.DurationSeconds),
+		})
+	}
+	return true, EnqueueJob(config.DB, JobPosterFrame, item.ID, PosterFrameJob{
+		SourceKey: item.SourceKey,
+		AtSeconds: *req.AtSeconds,
+	})
+}
+
+// ResetPoster drops an uploaded or chosen-frame poster, going back to the
+// selected generated candidate.
+func ResetPoster(ctx context.Context, viewer Viewer, id uint) error {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return err
+	}
+	if item.PosterPrefix == "" {
+		return nil
+	}
+	return setPoster(ctx, item, "", "")
+}
+
+func extractPoster(ctx context.Context, job *models.ProcessingJob) error {
+	var payload PosterFrameJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	var item models.MediaItem
+	if err := config.DB.First(&item, job.MediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if item.SourceKey != payload.SourceKey {
+		// The video was replaced; its frames no longer exist
+		return nil
+	}
+
+	workDir, err := os.MkdirTemp(config.Config.Transcode.WorkDir, "poster-job-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	source := filepath.Join(workDir, "source")
+	if err := downloadObject(ctx, item.SourceKey, source); err != nil {
+		return fmt.Errorf("download source: %w", err)
+	}
+	frame := filepath.Join(workDir, "frame.jpg")
+	if err := config.Encoder.Frame(ctx, source, frame, payload.AtSeconds); err != nil {
+		return err
+	}
+	img, err := imaging.DecodeFile(frame)
+	if err != nil {
+		return err
+	}
+
+	prefix := fmt.Sprintf("media/%d/images/frame-%d/", item.ID, job.ID)
+	if err := storePoster(ctx, img, prefix); err != nil {
+		return err
+	}
+	return setPoster(ctx, &item, prefix, models.PosterFrame)
+}
+
+// storePoster writes img in every imaging size under prefix.
+func storePoster(ctx context.Context, img image.Image, prefix string) error {
+	dir, err := os.MkdirTemp(config.Config.Transcode.WorkDir, "poster-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	if err := imaging.WriteSizes(img, dir, "", imaging.DefaultSizes); err != nil {
+		return err
+	}
+	if err := uploadDir(ctx, dir, prefix); err != nil {
+		storage.DeletePrefix(ctx, config.Storage, prefix)
+		return fmt.Errorf("store poster: %w", err)
+	}
+	return nil
+}
+
+// setPoster points the item at a custom poster under prefix, or back at the
+// generated candidates if prefix is empty, removing the one it replaces.
+func setPoster(ctx context.Context, item *models.MediaItem, prefix, source string) error {
+	old := item.PosterPrefix
+	item.PosterPrefix, item.PosterSource = prefix, source
+	if err := config.DB.Model(item).Updates(map[string]interface{}{
+		"poster_prefix": prefix,
+		"poster_source": source,
+	}).Error; err != nil {
+		return err
+	}
+	if old != prefix {
+		deleteImagePrefix(ctx, old)
+	}
+	return nil
+}
+
+func deleteImagePrefix(ctx context.Context, prefix string) {
+	if prefix == "" {
+		return
+	}
+	if err := storage.DeletePrefix(ctx, config.Storage, prefix); err != nil {
+		config.Log.WithError(err).WithField("prefix", prefix).Warn("failed to remove old images")
+	}
+}
+
+// posterKeys maps each imaging size to the storage key of the item's
+// poster, or returns nil if it has none.
+func posterKeys(item *models.MediaItem) map[string]string {
+	var base string
+	switch {
+	case item.PosterPrefix != "":
+		base = item.PosterPrefix
+	case item.ImagesPrefix != "" && item.PosterIndex < len(item.PosterTimes):
+		base = item.ImagesPrefix + transcode.PosterBase(item.PosterIndex)
+	default:
+		return nil
+	}
+	keys := make(map[string]string, len(imaging.DefaultSizes))
+	for _, s := range imaging.DefaultSizes {
+		keys[s.Name] = imaging.SizeFile(base, s.Name)
+	}
+	return keys
+}
+
+// imageRel is a key's path below the item's images, as served by
+// OpenStream.
+func imageRel(mediaID uint, key string) string {
+	return strings.TrimPrefix(key, imagesRoot(mediaID))
+}
+
+func imagesRoot(mediaID uint) string {
+	return fmt.Sprintf("media/%d/images/", mediaID)
+}
+
+// imageURLExpiry fixes image URL expiry to windows of the stream URL TTL, so
+// the URLs in catalog listings stay identical between requests and browser
+// and CDN caches keep hitting. Each URL is valid for one to two TTLs.
+func imageURLExpiry() time.Time {
+	ttl := config.Config.Streaming.URLTTL
+	return time.Now().Truncate(ttl).Add(2 * ttl)
+}
@@ -0,0 +1,202 @@
+// media-service/pkg/services/job_service.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobProcessMedia is enqueued once an item has a new source file.
+const JobProcessMedia = "media.process"
+
+// JobHandler runs one job. Returning an error schedules a retry until the
+// attempt limit is reached.
+type JobHandler func(ctx context.Context, job *models.ProcessingJob) error
+
+var (
+	jobHandlersMu sync.RWMutex
+	jobHandlers   = map[string]JobHandler{}
+)
+
+// RegisterJobHandler sets the handler for a job kind. Workers only claim
+// kinds that have a handler, so jobs queued before their stage is deployed
+// wait rather than fail.
+func RegisterJobHandler(kind string, handler JobHandler) {
+	jobHandlersMu.Lock()
+	defer jobHandlersMu.Unlock()
+	jobHandlers[kind] = handler
+}
+
+func jobHandler(kind string) (JobHandler, bool) {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+	h, ok := jobHandlers[kind]
+	return h, ok
+}
+
+func registeredJobKinds() []string {
+	jobHandlersMu.RLock()
+	defer jobHandlersMu.RUnlock()
+	kinds := make([]string, 0, len(jobHandlers))
+	for kind := range jobHandlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// EnqueueJob queues a job inside tx, so it only runs if the surrounding
+// change commits.
+func EnqueueJob(tx *gorm.DB, kind string, mediaID uint, payload interface{}) error {
+	data := []byte("{}")
+	if payload != nil {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	return tx.Create(&models.ProcessingJob{
+		Kind:     kind,
+		MediaID:  mediaID,
+		Payload:  string(data),
+		Status:   models.JobQueued,
+		RunAfter: time.Now(),
+	}).Error
+}
+
+// RunJobWorkers starts the configured number of workers and blocks until
+// ctx is cancelled.
+func RunJobWorkers(ctx context.Context) {
+	workers := config.Config.Jobs.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runJobWorker(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func runJobWorker(ctx context.Context) {
+	interval := config.Config.Jobs.PollInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	for {
+		job, err := claimJob()
+		if err != nil {
+			config.Log.WithError(err).Error("failed to claim job")
+		}
+		if job != nil {
+			runJob(ctx, job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// claimJob marks the oldest runnable job as processing and returns it, or
+// nil if there is nothing to do.
+func claimJob() (*models.ProcessingJob, error) {
+	kinds := registeredJobKinds()
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	var job models.ProcessingJob
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("kind IN ?", kinds).
+			Where("(status = ? AND run_after <= ?) OR (status = ? AND locked_at < ?)",
+				models.JobQueued, now, models.JobProcessing, now.Add(-config.Config.Jobs.Lease)).
+			Order("id").
+			First(&job).Error
+		if err != nil {
+			return err
+		}
+
+		job.Status = models.JobProcessing
+		job.Attempts++
+		job.LockedAt = &now
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":    job.Status,
+			"attempts":  job.Attempts,
+			"locked_at": job.LockedAt,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func runJob(ctx context.Context, job *models.ProcessingJob) {
+	log := config.Log.WithFields(map[string]interface{}{
+		"job_id":   job.ID,
+		"kind":     job.Kind,
+		"media_id": job.MediaID,
+		"attempt":  job.Attempts,
+	})
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		handler, ok := jobHandler(job.Kind)
+		if !ok {
+			return fmt.Errorf("no handler for job kind %q", job.Kind)
+		}
+		return handler(ctx, job)
+	}()
+
+	now := time.Now()
+	columns := map[string]interface{}{"locked_at": nil}
+	switch {
+	case err == nil:
+		columns["status"] = models.JobDone
+		columns["finished_at"] = &now
+		columns["last_error"] = ""
+		log.Info("job finished")
+	case job.Attempts >= config.Config.Jobs.MaxAttempts:
+		columns["status"] = models.JobFailed
+		columns["finished_at"] = &now
+		columns["last_error"] = err.Error()
+		log.WithError(err).Error("job failed permanently")
+	default:
+		// Back off 1, 4, 9... minutes between attempts
+		backoff := time.Duration(job.Attempts*job.Attempts) * time.Minute
+		columns["status"] = models.JobQueued
+		columns["run_after"] = now.Add(backoff)
+		columns["last_error"] = err.Error()
+		log.WithError(err).Warn("job failed, will retry")
+	}
+
+	if err := config.DB.Model(job).Updates(columns).Error; err != nil {
+		log.WithError(err).Error("failed to record job result")
+	}
+}
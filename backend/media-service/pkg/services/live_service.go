@@ -0,0 +1,744 @@
+// media-service/pkg/services/live_service.go
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/calendar"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobImportRecording moves a finished live recording into storage and
+// queues it for processing like an upload.
+const JobImportRecording = "live.recording"
+
+// ImportRecordingJob is the payload of JobImportRecording.
+type ImportRecordingJob struct {
+	SessionID uint `json:"session_id"`
+	// File name below live.recordings_dir
+	File string `json:"file"`
+}
+
+// nginx-rtmp callback kinds
+const (
+	rtmpPublish     = "publish"
+	rtmpPublishDone = "publish_done"
+	rtmpPlay        = "play"
+	rtmpPlayDone    = "play_done"
+	rtmpRecordDone  = "record_done"
+)
+
+func init() {
+	// Recordings only need storage, so they are imported whether or not
+	// this instance can encode
+	RegisterJobHandler(JobImportRecording, importRecording)
+}
+
+// LiveFilter narrows ListLiveSessions. Empty fields match everything.
+type LiveFilter struct {
+	Status string
+	HostID uint
+	Cohort string
+	// Only one-off sessions scheduled at or after this time and series
+	// with occurrences left then
+	From *time.Time
+}
+
+// LiveSessionUpdate is a partial update; nil fields are left unchanged.
+type LiveSessionUpdate struct {
+	Title           *string
+	Description     *string
+	Cohort          *string
+	ScheduledAt     *time.Time
+	TimeZone        *string
+	RRule           *string
+	DurationMinutes *int
+	Visibility      *string
+	Language        *string
+	Record          *bool
+	Cancelled       *bool
+}
+
+// ListLiveSessions returns the page of sessions matching filter that
+// viewer may see, soonest first, along with the total number of matches.
+// Private sessions are visible to their invitees.
+func ListLiveSessions(viewer Viewer, filter LiveFilter, page Page) ([]models.LiveSession, int64, error) {
+	query := config.DB.Model(&models.LiveSession{})
+	if !viewer.IsAdmin() {
+		query = query.Where("visibility = ? OR host_id = ? OR id IN (?)", models.VisibilityPublic, viewer.UserID,
+			config.DB.Model(&models.SessionInvitee{}).Select("session_id").Where("user_id = ?", viewer.UserID))
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.HostID != 0 {
+		query = query.Where("host_id = ?", filter.HostID)
+	}
+	if filter.Cohort != "" {
+		query = query.Where("cohort = ?", filter.Cohort)
+	}
+	if filter.From != nil {
+		query = query.Where("(rrule = '' AND scheduled_at >= ?) OR (rrule <> '' AND (series_ends_at IS NULL OR series_ends_at >= ?))",
+			*filter.From, *filter.From)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var sessions []models.LiveSession
+	if err := query.
+		Order("scheduled_at").
+		Order("id").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&sessions).Error; err != nil {
+		return nil, 0, err
+	}
+	return sessions, total, nil
+}
+
+func GetLiveSession(viewer Viewer, id uint) (*models.LiveSession, error) {
+	var session models.LiveSession
+	if err := config.DB.First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Live session not found")
+		}
+		return nil, err
+	}
+	if !viewer.CanViewSession(&session) {
+		invited, err := isInvited(session.ID, viewer.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !invited {
+			return nil, apperror.ErrNotFound.WithDetail("Live session not found")
+		}
+	}
+	return &session, nil
+}
+
+func CreateLiveSession(viewer Viewer, req api.LiveSessionRequest) (*models.LiveSession, error) {
+	if !viewer.CanPublish() {
+		return nil, apperror.ErrForbidden.WithDetail("Only trainers and admins can schedule live sessions")
+	}
+	timeZone := req.TimeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+	rrule := strings.TrimSpace(req.RRule)
+	_, seriesEnd, err := parseSchedule(req.ScheduledAt, timeZone, rrule)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := randomHex(20)
+	if err != nil {
+		return nil, err
+	}
+	name, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	session := &models.LiveSession{
+		Title:           strings.TrimSpace(req.Title),
+		Description:     strings.TrimSpace(req.Description),
+		HostID:          viewer.UserID,
+		Cohort:          strings.TrimSpace(req.Cohort),
+		ScheduledAt:     req.ScheduledAt,
+		TimeZone:        timeZone,
+		RRule:           rrule,
+		DurationMinutes: req.DurationMinutes,
+		SeriesEndsAt:    seriesEnd,
+		Visibility:      req.Visibility,
+		Language:        req.Language,
+		StreamKey:       key,
+		PlaybackName:    name,
+		Record:          req.Record == nil || *req.Record,
+		Status:          models.LiveScheduled,
+	}
+	if session.Visibility == "" {
+		session.Visibility = models.VisibilityPrivate
+	}
+	if session.DurationMinutes == 0 {
+		session.DurationMinutes = 60
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		return replaceInvitees(tx, session, req.Invitees)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func UpdateLiveSession(viewer Viewer, id uint, update LiveSessionUpdate) (*models.LiveSession, error) {
+	session, err := hostedSession(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	if update.Title != nil {
+		columns["title"] = *update.Title
+	}
+	if update.Description != nil {
+		columns["description"] = *update.Description
+	}
+	if update.Cohort != nil {
+		columns["cohort"] = *update.Cohort
+	}
+	if update.DurationMinutes != nil {
+		columns["duration_minutes"] = *update.DurationMinutes
+	}
+	if update.ScheduledAt != nil || update.TimeZone != nil || update.RRule != nil {
+		start, timeZone, rrule := session.ScheduledAt, session.TimeZone, session.RRule
+		if update.ScheduledAt != nil {
+			start = *update.ScheduledAt
+		}
+		if update.TimeZone != nil {
+			timeZone = *update.TimeZone
+		}
+		if update.RRule != nil {
+			rrule = strings.TrimSpace(*update.RRule)
+		}
+		_, seriesEnd, err := parseSchedule(start, timeZone, rrule)
+		if err != nil {
+			return nil, err
+		}
+		columns["scheduled_at"] = start
+		columns["time_zone"] = timeZone
+		columns["rrule"] = rrule
+		columns["series_ends_at"] = seriesEnd
+	}
+	if update.Visibility != nil {
+		columns["visibility"] = *update.Visibility
+	}
+	if update.Language != nil {
+		columns["language"] = *update.Language
+	}
+	if update.Record != nil {
+		columns["record"] = *update.Record
+	}
+	if update.Cancelled != nil {
+		switch {
+		case *update.Cancelled && session.Status == models.LiveOnAir:
+			return nil, apperror.ErrConflict.WithDetail("A session cannot be cancelled while it is live")
+		case *update.Cancelled && session.Status != models.LiveCancelled:
+			columns["status"] = models.LiveCancelled
+		case session.Status == models.LiveCancelled:
+			columns["status"] = models.LiveScheduled
+		}
+	}
+
+	if len(columns) == 0 {
+		return session, nil
+	}
+
+	// Invitees get a new invitation when something on it changes, and a
+	// cancellation or reinstatement when the status does
+	method := ""
+	switch status, ok := columns["status"]; {
+	case ok && status == models.LiveCancelled:
+		method = calendar.MethodCancel
+	case ok:
+		method = calendar.MethodRequest
+	default:
+		for _, name := range []string{"title", "description", "scheduled_at", "time_zone", "rrule", "duration_minutes"} {
+			if _, ok := columns[name]; ok {
+				method = calendar.MethodRequest
+				break
+			}
+		}
+	}
+	if method != "" {
+		columns["sequence"] = gorm.Expr("sequence + 1")
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(session).Updates(columns).Error; err != nil {
+			return err
+		}
+		if method == "" {
+			return nil
+		}
+		var updated models.LiveSession
+		if err := tx.First(&updated, id).Error; err != nil {
+			return err
+		}
+		if _, upcoming := NextOccurrence(&updated, time.Now()); !upcoming && method == calendar.MethodRequest {
+			return nil
+		}
+		return queueInvitations(tx, &updated, method)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetLiveSession(viewer, id)
+}
+
+// DeleteLiveSession removes a session that is not on air, along with its
+// invitees and attendance. Invitees of upcoming occurrences are sent a
+// cancellation. Items made from its recordings stay in the catalog.
+func DeleteLiveSession(viewer Viewer, id uint) error {
+	session, err := hostedSession(viewer, id)
+	if err != nil {
+		return err
+	}
+	if session.Status == models.LiveOnAir {
+		return apperror.ErrConflict.WithDetail("A session cannot be deleted while it is live")
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if _, upcoming := NextOccurrence(session, time.Now()); upcoming {
+			session.Sequence++
+			if err := queueInvitations(tx, session, calendar.MethodCancel); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("session_id = ?", id).Delete(&models.SessionInvitee{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("session_id = ?", id).Delete(&models.SessionAttendance{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(session).Error
+	})
+}
+
+// RotateStreamKey gives the session a new stream key. A broadcast already
+// running on the old key carries on.
+func RotateStreamKey(viewer Viewer, id uint) (*models.LiveSession, error) {
+	session, err := hostedSession(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	key, err := randomHex(20)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.DB.Model(session).Update("stream_key", key).Error; err != nil {
+		return nil, err
+	}
+	session.StreamKey = key
+	return session, nil
+}
+
+// WatchLiveSession counts the viewer as watching for live.viewer_ttl,
+// credits their attendance and returns the current audience. Players ping
+// it while the stream plays.
+func WatchLiveSession(ctx context.Context, viewer Viewer, id uint) (int, error) {
+	session, err := GetLiveSession(viewer, id)
+	if err != nil {
+		return 0, err
+	}
+	if session.Status != models.LiveOnAir {
+		return 0, apperror.ErrNotReady.WithDetail("The session is not live")
+	}
+
+	now := time.Now()
+	key := liveViewersKey(id)
+	pipe := config.RedisClient.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.Unix()), Member: viewer.UserID})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-config.Config.Live.ViewerTTL).Unix(), 10))
+	pipe.Expire(ctx, key, config.Config.Live.ViewerTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	if _, err := recordAttendance(session, viewer.UserID, AttendancePing); err != nil {
+		return 0, err
+	}
+
+	viewers, err := LiveViewerCount(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if viewers > session.PeakViewers {
+		if err := config.DB.Model(&models.LiveSession{}).
+			Where("id = ? AND peak_viewers < ?", id, viewers).
+			Update("peak_viewers", viewers).Error; err != nil {
+			return 0, err
+		}
+	}
+	return viewers, nil
+}
+
+// LiveViewerCount is the number of signed-in viewers who pinged within
+// live.viewer_ttl plus the RTMP players connected to nginx-rtmp.
+func LiveViewerCount(ctx context.Context, id uint) (int, error) {
+	since := time.Now().Add(-config.Config.Live.ViewerTTL).Unix()
+	pipe := config.RedisClient.Pipeline()
+	pings := pipe.ZCount(ctx, liveViewersKey(id), strconv.FormatInt(since, 10), "+inf")
+	players := pipe.SCard(ctx, livePlayersKey(id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(pings.Val() + players.Val()), nil
+}
+
+// HandleRTMPCallback answers an nginx-rtmp callback. Any error makes
+// nginx-rtmp drop the connection. For publish it returns the playback
+// name the stream is to be renamed to.
+//
+// nginx-rtmp sends each callback once per connection, so one handled
+// before is a captured request being replayed, which could put an ended
+// session back on air or import a recording twice. It is refused.
+func HandleRTMPCallback(ctx context.Context, cb api.RTMPCallback) (string, error) {
+	switch cb.Call {
+	case rtmpPublish, rtmpPublishDone, rtmpPlay, rtmpPlayDone, rtmpRecordDone:
+	default:
+		// Callbacks this service has no use for are allowed through
+		return "", nil
+	}
+
+	key, err := claimRTMPCallback(ctx, cb)
+	if err != nil {
+		return "", err
+	}
+	rename, err := handleRTMPCallback(ctx, cb)
+	if err != nil {
+		// A failed callback changed nothing, so repeating it is harmless
+		if err := config.RedisClient.Del(ctx, key).Err(); err != nil {
+			config.Log.WithError(err).WithField("call", cb.Call).Warn("failed to forget refused callback")
+		}
+	}
+	return rename, err
+}
+
+// claimRTMPCallback records the callback as handled for
+// live.callback_replay_window and returns the key it is recorded under,
+// or ErrConflict if it already was.
+func claimRTMPCallback(ctx context.Context, cb api.RTMPCallback) (string, error) {
+	sum := sha256.Sum256([]byte(strings.Join([]string{cb.Call, cb.App, cb.Name, cb.ClientID, cb.Path}, "\x00")))
+	key := "live:callback:" + hex.EncodeToString(sum[:])
+	window := config.Config.Live.CallbackReplayWindow
+	if window <= 0 {
+		window = 24 * time.Hour
+	}
+	fresh, err := config.RedisClient.SetNX(ctx, key, time.Now().Unix(), window).Result()
+	if err != nil {
+		return "", err
+	}
+	if !fresh {
+		return "", apperror.ErrConflict.WithDetail("Callback already handled")
+	}
+	return key, nil
+}
+
+func handleRTMPCallback(ctx context.Context, cb api.RTMPCallback) (string, error) {
+	switch cb.Call {
+	case rtmpPublish:
+		return startBroadcast(cb)
+	case rtmpPublishDone:
+		return "", endBroadcast(ctx, cb)
+	case rtmpPlay, rtmpPlayDone:
+		session, err := sessionByStreamName(cb.Name)
+		if err != nil {
+			return "", err
+		}
+		if cb.Call == rtmpPlayDone {
+			return "", config.RedisClient.SRem(ctx, livePlayersKey(session.ID), cb.ClientID).Err()
+		}
+		if session.Status != models.LiveOnAir || session.Visibility != models.VisibilityPublic {
+			return "", apperror.ErrForbidden.WithDetail("Stream is not available")
+		}
+		return "", config.RedisClient.SAdd(ctx, livePlayersKey(session.ID), cb.ClientID).Err()
+	default: // rtmpRecordDone
+		return "", queueRecording(cb)
+	}
+}
+
+// ToAPILiveSession converts the session into its public representation.
+// The stream key is only included for its host and admins.
+func ToAPILiveSession(ctx context.Context, viewer Viewer, session *models.LiveSession) api.LiveSession {
+	out := api.LiveSession{
+		ID:              session.ID,
+		Title:           session.Title,
+		Description:     session.Description,
+		HostID:          session.HostID,
+		Cohort:          session.Cohort,
+		ScheduledAt:     session.ScheduledAt,
+		TimeZone:        session.TimeZone,
+		RRule:           session.RRule,
+		DurationMinutes: session.DurationMinutes,
+		Visibility:      session.Visibility,
+		Language:        session.Language,
+		Record:          session.Record,
+		Status:          session.Status,
+		StartedAt:       session.StartedAt,
+		EndedAt:         session.EndedAt,
+		PeakViewers:     session.PeakViewers,
+		RecordingIDs:    []uint(session.RecordingIDs),
+		CreatedAt:       session.CreatedAt,
+		UpdatedAt:       session.UpdatedAt,
+	}
+	if next, ok := NextOccurrence(session, time.Now()); ok {
+		next = next.UTC()
+		out.NextOccurrence = &next
+	}
+	if out.RecordingIDs == nil {
+		out.RecordingIDs = []uint{}
+	}
+	if session.Status == models.LiveOnAir {
+		out.PlaybackURL = strings.ReplaceAll(config.Config.Live.PlaybackURL, "{name}", session.PlaybackName)
+		viewers, err := LiveViewerCount(ctx, session.ID)
+		if err != nil {
+			config.Log.WithError(err).WithField("session_id", session.ID).Warn("failed to count live viewers")
+		}
+		out.Viewers = viewers
+	}
+	if viewer.CanHost(session) {
+		out.Ingest = &api.LiveIngest{URL: config.Config.Live.IngestURL, StreamKey: session.StreamKey}
+	}
+	return out
+}
+
+// startBroadcast authenticates a publisher by stream key and marks the
+// session live.
+func startBroadcast(cb api.RTMPCallback) (string, error) {
+	var session models.LiveSession
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("stream_key = ?", cb.Name).First(&session).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return apperror.ErrForbidden.WithDetail("Unknown stream key")
+			}
+			return err
+		}
+		switch session.Status {
+		case models.LiveCancelled:
+			return apperror.ErrForbidden.WithDetail("The session was cancelled")
+		case models.LiveOnAir:
+			if session.PublisherClientID != "" && session.PublisherClientID != cb.ClientID {
+				return apperror.ErrConflict.WithDetail("The session is already being published")
+			}
+		}
+
+		now := time.Now()
+		columns := map[string]interface{}{
+			"status":              models.LiveOnAir,
+			"ended_at":            nil,
+			"publisher_client_id": cb.ClientID,
+			"publisher_addr":      cb.Addr,
+		}
+		// A reconnect carries on the broadcast; a series' next occurrence
+		// starts a new one
+		if session.StartedAt == nil || session.Status == models.LiveScheduled {
+			columns["started_at"] = now
+		}
+		return tx.Model(&session).Updates(columns).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	config.Log.WithField("session_id", session.ID).WithField("addr", cb.Addr).Info("live session started")
+	return session.PlaybackName, nil
+}
+
+// endBroadcast marks the session ended when its publisher disconnects,
+// or scheduled again if it is a series with occurrences to come.
+// Publishing again with the key puts it back on air.
+func endBroadcast(ctx context.Context, cb api.RTMPCallback) error {
+	session, err := sessionByStreamName(cb.Name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	status := models.LiveEnded
+	if session.RRule != "" {
+		// Any occurrence starting from now on
+		if _, ok := scheduleOf(session).next(now.Add(time.Duration(session.DurationMinutes) * time.Minute)); ok {
+			status = models.LiveScheduled
+		}
+	}
+	result := config.DB.Model(&models.LiveSession{}).
+		Where("id = ? AND status = ? AND publisher_client_id = ?", session.ID, models.LiveOnAir, cb.ClientID).
+		Updates(map[string]interface{}{
+			"status":              status,
+			"ended_at":            now,
+			"publisher_client_id": "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// A stale publisher, replaced by a reconnect
+		return nil
+	}
+	if err := config.RedisClient.Del(ctx, liveViewersKey(session.ID), livePlayersKey(session.ID)).Err(); err != nil {
+		config.Log.WithError(err).WithField("session_id", session.ID).Warn("failed to clear live viewers")
+	}
+	config.Log.WithField("session_id", session.ID).Info("live session ended")
+	return nil
+}
+
+// queueRecording adds a catalog item for a finished recording and queues
+// the import of its file.
+func queueRecording(cb api.RTMPCallback) error {
+	session, err := sessionByStreamName(cb.Name)
+	if err != nil {
+		return err
+	}
+	// nginx-rtmp may see the recordings under another mount point
+	file := filepath.Base(cb.Path)
+	fi, err := os.Stat(filepath.Join(config.Config.Live.RecordingsDir, file))
+	if err != nil || fi.Size() == 0 || !session.Record {
+		// Nothing worth keeping, e.g. an encoder that connected and left
+		config.Log.WithField("session_id", session.ID).WithField("file", file).Info("skipping live recording")
+		return nil
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var locked models.LiveSession
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, session.ID).Error; err != nil {
+			return err
+		}
+		title := locked.Title
+		if n := len(locked.RecordingIDs); n > 0 {
+			title = fmt.Sprintf("%s (part %d)", title, n+1)
+		}
+		item := &models.MediaItem{
+			Title:            title,
+			Description:      locked.Description,
+			Type:             models.MediaTypeVideo,
+			Language:         locked.Language,
+			Visibility:       locked.Visibility,
+			OwnerID:          locked.HostID,
+			ProcessingStatus: models.ProcessingQueued,
+			// Learners saw it live, so the recording is not held for review
+			ReviewStatus: models.ReviewPublished,
+		}
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if err := publishEvent(tx, EventMediaCreated, item.ID); err != nil {
+			return err
+		}
+		if err := tx.Model(&locked).Update("recording_ids", append(locked.RecordingIDs, item.ID)).Error; err != nil {
+			return err
+		}
+		return EnqueueJob(tx, JobImportRecording, item.ID, ImportRecordingJob{SessionID: locked.ID, File: file})
+	})
+}
+
+func importRecording(ctx context.Context, job *models.ProcessingJob) error {
+	var payload ImportRecordingJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	name := filepath.Join(config.Config.Live.RecordingsDir, filepath.Base(payload.File))
+
+	var item models.MediaItem
+	if err := config.DB.First(&item, job.MediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Deleted before the import ran
+			os.Remove(name)
+			return nil
+		}
+		return err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// nginx-rtmp records FLV
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = "video/x-flv"
+	}
+	key, sum, err := storeOriginal(ctx, f, fi.Size(), contentType)
+	if err != nil {
+		return fmt.Errorf("store recording: %w", err)
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"source_key":          key,
+			"source_size":         fi.Size(),
+			"source_content_type": contentType,
+			"source_sha256":       sum,
+			"processing_status":   models.ProcessingQueued,
+			"processing_error":    "",
+		}).Error; err != nil {
+			return err
+		}
+		return EnqueueJob(tx, JobProcessMedia, item.ID, ProcessMediaJob{SourceKey: key})
+	})
+	if err != nil {
+		return err
+	}
+
+	f.Close()
+	if err := os.Remove(name); err != nil {
+		config.Log.WithError(err).WithField("file", name).Warn("failed to remove imported recording")
+	}
+	return nil
+}
+
+// sessionByStreamName finds a session by the name nginx-rtmp reports,
+// which is the playback name once publish has renamed the stream.
+func sessionByStreamName(name string) (*models.LiveSession, error) {
+	var session models.LiveSession
+	if err := config.DB.Where("playback_name = ? OR stream_key = ?", name, name).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Unknown stream")
+		}
+		return nil, err
+	}
+	return &session, nil
+}
+
+func hostedSession(viewer Viewer, id uint) (*models.LiveSession, error) {
+	session, err := GetLiveSession(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.CanHost(session) {
+		return nil, apperror.ErrForbidden.WithDetail("You cannot modify this live session")
+	}
+	return session, nil
+}
+
+func liveViewersKey(id uint) string {
+	return fmt.Sprintf("live:%d:viewers", id)
+}
+
+func livePlayersKey(id uint) string {
+	return fmt.Sprintf("live:%d:players", id)
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
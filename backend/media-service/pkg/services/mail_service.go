@@ -0,0 +1,95 @@
+// media-service/pkg/services/mail_service.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/mail"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/users"
+
+	"gorm.io/gorm"
+)
+
+// JobSendMail delivers one email through config.Mailer. Its payload is a
+// mail.Message.
+const JobSendMail = "mail.send"
+
+// JobSendUserMail delivers one email to a user, looking up their address
+// in config.Users only when it is sent. Its payload is a UserMailJob.
+const JobSendUserMail = "mail.send_user"
+
+// UserMailJob is a message whose recipient is the user with UserID; the
+// message's To and ToName are filled in at delivery.
+type UserMailJob struct {
+	UserID  uint         `json:"user_id"`
+	Message mail.Message `json:"message"`
+}
+
+// RegisterMailDelivery starts handling JobSendMail and JobSendUserMail
+// with config.Mailer.
+func RegisterMailDelivery() {
+	RegisterJobHandler(JobSendMail, sendMail)
+	RegisterJobHandler(JobSendUserMail, sendUserMail)
+}
+
+// queueMail enqueues a delivery job per message in tx, so mail only goes
+// out for changes that were committed. Nothing is queued while mail is
+// disabled.
+func queueMail(tx *gorm.DB, messages ...mail.Message) error {
+	if config.Mailer == nil {
+		return nil
+	}
+	for _, msg := range messages {
+		if err := EnqueueJob(tx, JobSendMail, 0, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendMail(ctx context.Context, job *models.ProcessingJob) error {
+	var msg mail.Message
+	if err := json.Unmarshal([]byte(job.Payload), &msg); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	if config.Mailer == nil {
+		return errors.New("no mailer configured")
+	}
+	return config.Mailer.Send(ctx, msg)
+}
+
+// queueUserMail enqueues msg for the user with userID in tx. Nothing is
+// queued while mail or the user directory is disabled.
+func queueUserMail(tx *gorm.DB, userID uint, msg mail.Message) error {
+	if config.Mailer == nil || config.Users == nil || userID == 0 {
+		return nil
+	}
+	return EnqueueJob(tx, JobSendUserMail, 0, UserMailJob{UserID: userID, Message: msg})
+}
+
+func sendUserMail(ctx context.Context, job *models.ProcessingJob) error {
+	var payload UserMailJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+	if config.Mailer == nil || config.Users == nil {
+		return errors.New("no mailer or user directory configured")
+	}
+	contact, err := config.Users.Contact(ctx, payload.UserID)
+	if errors.Is(err, users.ErrNotFound) {
+		// Deleted since; there is nobody to tell
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	msg := payload.Message
+	msg.To = contact.Email
+	msg.ToName = contact.Name()
+	return config.Mailer.Send(ctx, msg)
+}
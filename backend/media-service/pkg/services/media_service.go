@@ -0,0 +1,461 @@
+// media-service/pkg/services/media_service.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/scripture"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MediaFilter narrows ListMedia. Empty fields match everything.
+type MediaFilter struct {
+	Type     string
+	Speaker  string
+	Series   string
+	Language string
+	Tag      string
+	// Items covering any verse of these references
+	Scripture string
+	// Scheme the Scripture references are numbered in; English if empty
+	Versification string
+	Visibility    string
+	OwnerID       uint
+	// Case-insensitive match against title and description
+	Query string
+}
+
+// Page selects a window of a sorted listing.
+type Page struct {
+	Page     int
+	PageSize int
+	// Column to sort by, prefixed with "-" for descending
+	Sort string
+}
+
+// mediaSortColumns whitelists the sort keys clients may use.
+var mediaSortColumns = map[string]string{
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+	"title":      "title",
+	"speaker":    "speaker",
+	"series":     "series",
+	"duration":   "duration_seconds",
+}
+
+// MediaUpdate is a partial update; nil fields are left unchanged.
+type MediaUpdate struct {
+	Title         *string
+	Description   *string
+	Type          *string
+	Speaker       *string
+	Series        *string
+	ScriptureRefs *[]string
+	// Scheme the ScriptureRefs are numbered in; English if empty
+	Versification   string
+	Tags            *[]string
+	Language        *string
+	DurationSeconds *int
+	Visibility      *string
+	// A time in the past publishes or lifts the embargo at once
+	PublishAt    *time.Time
+	EmbargoUntil *time.Time
+}
+
+// ListMedia returns the page of items matching filter that viewer may see,
+// along with the total number of matches.
+func ListMedia(viewer Viewer, filter MediaFilter, page Page) ([]models.MediaItem, int64, error) {
+	query := config.DB.Model(&models.MediaItem{})
+	if !viewer.IsAdmin() {
+		query = query.Where(visibleRows("media_items"), models.VisibilityPublic, time.Now(), viewer.UserID)
+		query = whereEntitled(query, viewer)
+	}
+
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Speaker != "" {
+		query = query.Where("speaker = ?", filter.Speaker)
+	}
+	if filter.Series != "" {
+		query = query.Where("series = ?", filter.Series)
+	}
+	if filter.Language != "" {
+		query = query.Where("language = ?", filter.Language)
+	}
+	if filter.Visibility != "" {
+		query = query.Where("visibility = ?", filter.Visibility)
+	}
+	if filter.OwnerID != 0 {
+		query = query.Where("owner_id = ?", filter.OwnerID)
+	}
+	if filter.Tag != "" {
+		query = query.Where("tags @> ?", models.StringList{filter.Tag})
+	}
+	if filter.Scripture != "" {
+		scheme, err := scriptureScheme(filter.Versification)
+		if err != nil {
+			return nil, 0, err
+		}
+		ranges, err := scripture.Parse(filter.Scripture, scheme)
+		if err != nil {
+			return nil, 0, scriptureError("scripture", err)
+		}
+		query = query.Where("id IN (?)", scriptureOverlap(ranges))
+	}
+	if filter.Query != "" {
+		like := "%" + escapeLike(filter.Query) + "%"
+		query = query.Where("title ILIKE ? OR description ILIKE ?", like, like)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	order, err := mediaOrder(page.Sort)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var items []models.MediaItem
+	if err := query.
+		Order(order).
+		Order("id").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+func GetMedia(viewer Viewer, id uint) (*models.MediaItem, error) {
+	var item models.MediaItem
+	if err := config.DB.First(&item, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Media item not found")
+		}
+		return nil, err
+	}
+	// Hide private items, and those the viewer is not entitled to, rather
+	// than admit they exist
+	if !viewer.CanView(&item) {
+		return nil, apperror.ErrNotFound.WithDetail("Media item not found")
+	}
+	ok, err := entitled(viewer, &item)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apperror.ErrNotFound.WithDetail("Media item not found")
+	}
+	return &item, nil
+}
+
+func CreateMedia(viewer Viewer, req api.MediaRequest) (*models.MediaItem, error) {
+	if !viewer.CanPublish() {
+		return nil, apperror.ErrForbidden.WithDetail("Only trainers and admins can add media")
+	}
+
+	// Learners only see it once a reviewer has approved it and it is
+	// published
+	item := &models.MediaItem{OwnerID: viewer.UserID, ReviewStatus: models.ReviewDraft}
+	ranges, err := applyMediaRequest(item, req)
+	if err != nil {
+		return nil, err
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+		if _, err := newVersion(tx, viewer, item); err != nil {
+			return err
+		}
+		if err := replaceScriptureRanges(tx, item.ID, ranges); err != nil {
+			return err
+		}
+		return publishEvent(tx, EventMediaCreated, item.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ReplaceMedia overwrites every editable field of the item. On a live
+// item the catalog fields go to its draft version instead.
+func ReplaceMedia(viewer Viewer, id uint, req api.MediaRequest) (*models.MediaItem, error) {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+
+	next := *item
+	ranges, err := applyMediaRequest(&next, req)
+	if err != nil {
+		return nil, err
+	}
+	live := isLive(item)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := draftChanges(tx, viewer, item, itemCatalog(&next)); err != nil {
+			return err
+		}
+		if live {
+			columns := map[string]interface{}{
+				"duration_seconds": next.DurationSeconds,
+				"visibility":       next.Visibility,
+				"publish_at":       next.PublishAt,
+				"embargo_until":    next.EmbargoUntil,
+			}
+			if err := tx.Model(item).Updates(columns).Error; err != nil {
+				return err
+			}
+			item.DurationSeconds = next.DurationSeconds
+			item.Visibility = next.Visibility
+			item.PublishAt = next.PublishAt
+			item.EmbargoUntil = next.EmbargoUntil
+		} else {
+			next.ReviewStatus = item.ReviewStatus
+			*item = next
+			if err := tx.Save(item).Error; err != nil {
+				return err
+			}
+			if err := replaceScriptureRanges(tx, item.ID, ranges); err != nil {
+				return err
+			}
+		}
+		return publishEvent(tx, EventMediaUpdated, item.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// UpdateMedia applies a partial update. On a live item changes to the
+// catalog fields go to its draft version instead.
+func UpdateMedia(viewer Viewer, id uint, update MediaUpdate) (*models.MediaItem, error) {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{}
+	setString := func(column string, next *string) {
+		if next != nil {
+			columns[column] = *next
+		}
+	}
+	setString("title", update.Title)
+	setString("description", update.Description)
+	setString("type", update.Type)
+	setString("speaker", update.Speaker)
+	setString("series", update.Series)
+	setString("language", update.Language)
+	setString("visibility", update.Visibility)
+	var ranges []scripture.Range
+	if update.ScriptureRefs != nil {
+		refs, parsed, err := parseScriptureRefs(*update.ScriptureRefs, update.Versification)
+		if err != nil {
+			return nil, err
+		}
+		columns["scripture_refs"] = refs
+		ranges = parsed
+	}
+	if update.Tags != nil {
+		columns["tags"] = cleanList(*update.Tags)
+	}
+	if update.DurationSeconds != nil {
+		columns["duration_seconds"] = *update.DurationSeconds
+	}
+	if update.PublishAt != nil {
+		columns["publish_at"] = *update.PublishAt
+	}
+	if update.EmbargoUntil != nil {
+		columns["embargo_until"] = *update.EmbargoUntil
+	}
+
+	if len(columns) == 0 {
+		return item, nil
+	}
+	live := isLive(item)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := draftChanges(tx, viewer, item, columns); err != nil {
+			return err
+		}
+		if live {
+			for _, column := range catalogColumns {
+				delete(columns, column)
+			}
+			if len(columns) == 0 {
+				return nil
+			}
+		}
+		if err := tx.Model(item).Updates(columns).Error; err != nil {
+			return err
+		}
+		if update.ScriptureRefs != nil && !live {
+			if err := replaceScriptureRanges(tx, item.ID, ranges); err != nil {
+				return err
+			}
+		}
+		return publishEvent(tx, EventMediaUpdated, item.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetMedia(viewer, id)
+}
+
+func DeleteMedia(viewer Viewer, id uint) error {
+	item, err := editableMedia(viewer, id)
+	if err != nil {
+		return err
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(item).Error; err != nil {
+			return err
+		}
+		return publishEvent(tx, EventMediaDeleted, item.ID)
+	})
+}
+
+// ToAPIMedia converts the catalog row into its public representation.
+func ToAPIMedia(item *models.MediaItem) api.MediaItem {
+	return api.MediaItem{
+		ID:               item.ID,
+		Title:            item.Title,
+		Description:      item.Description,
+		Type:             item.Type,
+		Speaker:          item.Speaker,
+		Series:           item.Series,
+		ScriptureRefs:    nonNil(item.ScriptureRefs),
+		Tags:             nonNil(item.Tags),
+		Language:         item.Language,
+		DurationSeconds:  item.DurationSeconds,
+		Visibility:       item.Visibility,
+		PublishAt:        item.PublishAt,
+		EmbargoUntil:     item.EmbargoUntil,
+		OwnerID:          item.OwnerID,
+		ProcessingStatus: item.ProcessingStatus,
+		ProcessingError:  item.ProcessingError,
+		Renditions:       nonNil(item.Renditions),
+		Images:           MediaImages(item),
+		ReviewStatus:     item.ReviewStatus,
+		LiveVersion:      item.LiveVersion,
+		CreatedAt:        item.CreatedAt,
+		UpdatedAt:        item.UpdatedAt,
+	}
+}
+
+func editableMedia(viewer Viewer, id uint) (*models.MediaItem, error) {
+	item, err := GetMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.CanEdit(item) {
+		return nil, apperror.ErrForbidden.WithDetail("You cannot modify this media item")
+	}
+	return item, nil
+}
+
+// applyMediaRequest copies req onto item and returns the passages its
+// scripture references cover.
+func applyMediaRequest(item *models.MediaItem, req api.MediaRequest) ([]scripture.Range, error) {
+	refs, ranges, err := parseScriptureRefs(req.ScriptureRefs, req.Versification)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Title = strings.TrimSpace(req.Title)
+	item.Description = strings.TrimSpace(req.Description)
+	item.Type = req.Type
+	item.Speaker = strings.TrimSpace(req.Speaker)
+	item.Series = strings.TrimSpace(req.Series)
+	item.ScriptureRefs = refs
+	item.Tags = cleanList(req.Tags)
+	item.Language = req.Language
+	item.DurationSeconds = req.DurationSeconds
+	item.Visibility = req.Visibility
+	if item.Visibility == "" {
+		item.Visibility = models.VisibilityPrivate
+	}
+	item.PublishAt = req.PublishAt
+	item.EmbargoUntil = req.EmbargoUntil
+	return ranges, nil
+}
+
+// visibleRows is the condition that matches the rows of table, which is
+// media_items or collections, that CanView or CanViewCollection allow.
+// Its arguments are VisibilityPublic, the current time and the viewer's
+// user ID.
+func visibleRows(table string) string {
+	released := "%[1]s.visibility = ? AND (%[1]s.publish_at IS NULL OR %[1]s.publish_at <= ?)"
+	if table == "media_items" {
+		// As isLive
+		released += fmt.Sprintf(" AND (%%[1]s.review_status = '%s' OR %%[1]s.live_version > 0)", models.ReviewPublished)
+	}
+	return fmt.Sprintf("("+released+") OR %[1]s.owner_id = ?", table)
+}
+
+// checkEmbargo refuses to hand out an embargoed item's media to anyone
+// but its editors.
+func checkEmbargo(viewer Viewer, item *models.MediaItem) error {
+	if item.EmbargoUntil == nil || !item.EmbargoUntil.After(time.Now()) || viewer.CanEdit(item) {
+		return nil
+	}
+	return apperror.ErrEmbargoed.WithDetail(fmt.Sprintf("%q is under embargo until %s",
+		item.Title, item.EmbargoUntil.UTC().Format(time.RFC3339)))
+}
+
+func mediaOrder(sort string) (string, error) {
+	if sort == "" {
+		return "created_at DESC", nil
+	}
+	direction := "ASC"
+	if strings.HasPrefix(sort, "-") {
+		direction = "DESC"
+		sort = sort[1:]
+	}
+	column, ok := mediaSortColumns[sort]
+	if !ok {
+		return "", apperror.Validation(apperror.FieldError{
+			Field: "sort", Code: "oneof", Message: "must be one of: created_at, updated_at, title, speaker, series, duration",
+		})
+	}
+	return column + " " + direction, nil
+}
+
+// cleanList trims entries and drops blanks and duplicates, keeping order.
+func cleanList(values []string) models.StringList {
+	out := make(models.StringList, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	return out
+}
+
+func nonNil(values models.StringList) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
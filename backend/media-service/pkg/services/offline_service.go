@@ -0,0 +1,525 @@
+// media-service/pkg/services/offline_service.go
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/transcode"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const offlineManifestVersion = 1
+
+// BundleFile is a file an offline package carries for one item.
+type BundleFile struct {
+	// Path relative to the item's folder in the archive
+	Path        string
+	Role        string
+	ContentType string
+	// Storage key to copy from; Data is used when empty
+	Key  string
+	Data []byte
+	Size int64
+}
+
+// BundleContributor adds files such as transcripts or attachments to an
+// item's part of an offline package.
+type BundleContributor func(ctx context.Context, item *models.MediaItem, quality string) ([]BundleFile, error)
+
+var (
+	bundleContributorsMu sync.RWMutex
+	bundleContributors   []BundleContributor
+)
+
+func RegisterBundleContributor(contributor BundleContributor) {
+	bundleContributorsMu.Lock()
+	defer bundleContributorsMu.Unlock()
+	bundleContributors = append(bundleContributors, contributor)
+}
+
+// CreateOfflineLicense licenses the viewer's device to keep the items
+// offline. Every item must be visible to the viewer and ready to package.
+func CreateOfflineLicense(ctx context.Context, viewer Viewer, req api.CreateOfflinePackageRequest) (*models.OfflineLicense, string, error) {
+	ids := uniqueIDs(req.MediaIDs)
+	if maxItems := config.Config.Offline.MaxItems; maxItems > 0 && len(ids) > maxItems {
+		return nil, "", apperror.Validation(apperror.FieldError{
+			Field: "media_ids", Code: "max", Message: fmt.Sprintf("must contain at most %d items", maxItems),
+		})
+	}
+	quality := req.Quality
+	if quality == "" {
+		quality = api.QualityAuto
+	}
+
+	items := make([]*models.MediaItem, 0, len(ids))
+	for _, id := range ids {
+		item, err := GetMedia(viewer, id)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := checkEmbargo(viewer, item); err != nil {
+			return nil, "", err
+		}
+		if _, err := requireUnlocked(ctx, viewer, item); err != nil {
+			return nil, "", err
+		}
+		if _, err := mediaBundleFiles(ctx, item, quality); err != nil {
+			return nil, "", err
+		}
+		items = append(items, item)
+	}
+	expires, err := licenseExpiry(viewer, items)
+	if err != nil {
+		return nil, "", err
+	}
+
+	license := &models.OfflineLicense{
+		UserID:    viewer.UserID,
+		DeviceID:  req.DeviceID,
+		MediaIDs:  ids,
+		Quality:   quality,
+		ExpiresAt: expires,
+	}
+	if err := config.DB.Create(license).Error; err != nil {
+		return nil, "", err
+	}
+	return license, SignLicense(license), nil
+}
+
+func ListOfflineLicenses(viewer Viewer) ([]models.OfflineLicense, error) {
+	var licenses []models.OfflineLicense
+	err := config.DB.Where("user_id = ?", viewer.UserID).Order("id DESC").Find(&licenses).Error
+	return licenses, err
+}
+
+// RenewOfflineLicense extends a license for the device it was issued to.
+// If the viewer has since lost access to any item, or it has been
+// embargoed or locked again, the license is revoked instead so the app
+// deletes the content.
+func RenewOfflineLicense(ctx context.Context, viewer Viewer, id uint, deviceID string) (*models.OfflineLicense, string, error) {
+	license, err := getOfflineLicense(viewer, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if license.RevokedAt != nil {
+		return nil, "", apperror.ErrLicenseRevoked
+	}
+	if license.DeviceID != deviceID {
+		return nil, "", apperror.ErrForbidden.WithDetail("License is bound to another device")
+	}
+
+	items := make([]*models.MediaItem, 0, len(license.MediaIDs))
+	for _, mediaID := range license.MediaIDs {
+		item, err := GetMedia(viewer, mediaID)
+		if err == nil {
+			err = checkEmbargo(viewer, item)
+		}
+		if err == nil {
+			_, err = requireUnlocked(ctx, viewer, item)
+		}
+		if err != nil {
+			if !errors.Is(err, apperror.ErrNotFound) && !errors.Is(err, apperror.ErrEmbargoed) &&
+				!errors.Is(err, apperror.ErrLocked) {
+				return nil, "", err
+			}
+			if err := revokeLicense(license, "access_lost"); err != nil {
+				return nil, "", err
+			}
+			return nil, "", apperror.ErrLicenseRevoked.WithDetail("You no longer have access to every item in this package")
+		}
+		items = append(items, item)
+	}
+
+	if license.ExpiresAt, err = licenseExpiry(viewer, items); err != nil {
+		return nil, "", err
+	}
+	license.Renewals++
+	if err := config.DB.Model(license).Updates(map[string]interface{}{
+		"expires_at": license.ExpiresAt,
+		"renewals":   license.Renewals,
+	}).Error; err != nil {
+		return nil, "", err
+	}
+	return license, SignLicense(license), nil
+}
+
+// RevokeOfflineLicense ends a license early. The holder or an admin may.
+func RevokeOfflineLicense(viewer Viewer, id uint) error {
+	license, err := getOfflineLicense(viewer, id)
+	if err != nil {
+		return err
+	}
+	if license.RevokedAt != nil {
+		return nil
+	}
+	reason := "user"
+	if license.UserID != viewer.UserID {
+		reason = "admin"
+	}
+	return revokeLicense(license, reason)
+}
+
+// RevokeUserOfflineLicenses revokes a user's active licenses, limited to
+// those covering any of mediaIDs if given, and returns how many.
+func RevokeUserOfflineLicenses(userID uint, mediaIDs []uint, reason string) (int64, error) {
+	if reason == "" {
+		reason = "admin"
+	}
+	query := config.DB.Model(&models.OfflineLicense{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID)
+	if len(mediaIDs) > 0 {
+		covers := config.DB.Where("media_ids @> ?", models.IDList{mediaIDs[0]})
+		for _, id := range mediaIDs[1:] {
+			covers = covers.Or("media_ids @> ?", models.IDList{id})
+		}
+		query = query.Where(covers)
+	}
+
+	now := time.Now()
+	result := query.Updates(map[string]interface{}{
+		"revoked_at":    &now,
+		"revoke_reason": reason,
+	})
+	return result.RowsAffected, result.Error
+}
+
+// licenseExpiry returns when a license for items issued now expires: after
+// offline.license_ttl, or when the viewer's access to one of them ends if
+// that is sooner.
+func licenseExpiry(viewer Viewer, items []*models.MediaItem) (time.Time, error) {
+	expires := time.Now().Add(config.Config.Offline.LicenseTTL)
+	ends, err := accessEnds(viewer, items)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ends != nil && ends.Before(expires) {
+		expires = *ends
+	}
+	return expires.Truncate(time.Second), nil
+}
+
+// LicenseStatus reports whether a license is active, expired or revoked.
+func LicenseStatus(license *models.OfflineLicense) string {
+	switch {
+	case license.RevokedAt != nil:
+		return api.LicenseRevoked
+	case time.Now().After(license.ExpiresAt):
+		return api.LicenseExpired
+	default:
+		return api.LicenseActive
+	}
+}
+
+// ToAPILicense converts the license row into its public representation,
+// attaching token if one was just signed.
+func ToAPILicense(license *models.OfflineLicense, token string) api.OfflineLicense {
+	out := api.OfflineLicense{
+		ID:        license.ID,
+		DeviceID:  license.DeviceID,
+		MediaIDs:  []uint(license.MediaIDs),
+		Quality:   license.Quality,
+		IssuedAt:  license.CreatedAt,
+		ExpiresAt: license.ExpiresAt,
+		Status:    LicenseStatus(license),
+		Token:     token,
+	}
+	if out.MediaIDs == nil {
+		out.MediaIDs = []uint{}
+	}
+	if out.Status == api.LicenseActive {
+		out.DownloadURL = fmt.Sprintf("/api/media/offline/packages/%d/download", license.ID)
+	}
+	return out
+}
+
+// SignLicense returns the license token the app stores with the package.
+func SignLicense(license *models.OfflineLicense) string {
+	claims, _ := json.Marshal(api.LicenseClaims{
+		LicenseID: license.ID,
+		UserID:    license.UserID,
+		DeviceID:  license.DeviceID,
+		MediaIDs:  license.MediaIDs,
+		IssuedAt:  time.Now().Unix(),
+		ExpiresAt: license.ExpiresAt.Unix(),
+	})
+	body := base64.RawURLEncoding.EncodeToString(claims)
+	sig := ed25519.Sign(config.LicenseKey, []byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// LicensePublicKey is what apps verify license tokens with.
+func LicensePublicKey() api.OfflineLicenseKey {
+	return api.OfflineLicenseKey{
+		Algorithm: "Ed25519",
+		PublicKey: base64.StdEncoding.EncodeToString(config.LicenseKey.Public().(ed25519.PublicKey)),
+	}
+}
+
+// WriteOfflinePackage streams the ZIP for an active license to w:
+// manifest.json, license.txt and a media/<id>/ folder per item.
+func WriteOfflinePackage(ctx context.Context, w io.Writer, viewer Viewer, licenseID uint) error {
+	license, err := getOfflineLicense(viewer, licenseID)
+	if err != nil {
+		return err
+	}
+	switch LicenseStatus(license) {
+	case api.LicenseRevoked:
+		return apperror.ErrLicenseRevoked
+	case api.LicenseExpired:
+		return apperror.ErrForbidden.WithDetail("License has expired; renew it first")
+	}
+
+	manifest := api.OfflineManifest{
+		Version:     offlineManifestVersion,
+		LicenseID:   license.ID,
+		Quality:     license.Quality,
+		GeneratedAt: time.Now().UTC(),
+		ExpiresAt:   license.ExpiresAt,
+	}
+	var entries []BundleFile
+	for _, mediaID := range license.MediaIDs {
+		item, err := GetMedia(viewer, mediaID)
+		if err != nil {
+			return err
+		}
+		if err := checkEmbargo(viewer, item); err != nil {
+			return err
+		}
+		if _, err := requireUnlocked(ctx, viewer, item); err != nil {
+			return err
+		}
+		files, err := mediaBundleFiles(ctx, item, license.Quality)
+		if err != nil {
+			return err
+		}
+
+		entry := api.OfflineManifestItem{Media: ToAPIMedia(item)}
+		for _, f := range files {
+			f.Path = path.Join("media", fmt.Sprint(item.ID), f.Path)
+			if f.Key == "" {
+				f.Size = int64(len(f.Data))
+			}
+			entry.Files = append(entry.Files, api.OfflineFile{
+				Path:        f.Path,
+				Role:        f.Role,
+				ContentType: f.ContentType,
+				Size:        f.Size,
+			})
+			entries = append(entries, f)
+		}
+		manifest.Items = append(manifest.Items, entry)
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeJSONEntry(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	if err := writeZipEntry(archive, "license.txt", zip.Deflate, strings.NewReader(SignLicense(license))); err != nil {
+		return err
+	}
+	for _, f := range entries {
+		if err := copyBundleFile(ctx, archive, f); err != nil {
+			return fmt.Errorf("package %s: %w", f.Path, err)
+		}
+	}
+	return archive.Close()
+}
+
+// mediaBundleFiles picks what to package for item: the source of a
+// document, or one HLS rendition (an audio file in data-saver mode for
+// audio items) of audio and video, plus whatever contributors add.
+func mediaBundleFiles(ctx context.Context, item *models.MediaItem, quality string) ([]BundleFile, error) {
+	var files []BundleFile
+	switch {
+	case item.Type == models.MediaTypeDocument:
+		if item.SourceKey == "" {
+			return nil, apperror.ErrNotReady.WithDetail(fmt.Sprintf("Media item %d has no file yet", item.ID))
+		}
+		name := "source"
+		if exts, _ := mime.ExtensionsByType(item.SourceContentType); len(exts) > 0 {
+			name += exts[0]
+		}
+		files = append(files, BundleFile{
+			Path:        name,
+			Role:        "media",
+			ContentType: item.SourceContentType,
+			Key:         item.SourceKey,
+			Size:        item.SourceSize,
+		})
+	case item.ProcessingStatus != models.ProcessingReady || item.HLSPrefix == "":
+		return nil, apperror.ErrNotReady.WithDetail(fmt.Sprintf("Media item %d is still processing", item.ID))
+	case quality == api.QualityDataSaver && item.Type == models.MediaTypeAudio && slices.Contains(item.Downloads, "audio.m4a"):
+		key := item.HLSPrefix + transcode.DownloadsDir + "/audio.m4a"
+		info, err := config.Storage.Stat(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, BundleFile{
+			Path:        "audio.m4a",
+			Role:        "media",
+			ContentType: "audio/mp4",
+			Key:         key,
+			Size:        info.Size,
+		})
+	default:
+		name := offlineRendition(item.Renditions, quality)
+		prefix := item.HLSPrefix + name + "/"
+		objects, err := config.Storage.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			rel := strings.TrimPrefix(obj.Key, prefix)
+			role := "segment"
+			if rel == transcode.VariantPlaylist {
+				role = "playlist"
+			}
+			files = append(files, BundleFile{
+				Path:        path.Join("hls", name, rel),
+				Role:        role,
+				ContentType: packagedContentTypes[path.Ext(rel)],
+				Key:         obj.Key,
+				Size:        obj.Size,
+			})
+		}
+	}
+
+	bundleContributorsMu.RLock()
+	contributors := slices.Clone(bundleContributors)
+	bundleContributorsMu.RUnlock()
+	for _, contribute := range contributors {
+		extra, err := contribute(ctx, item, quality)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, extra...)
+	}
+	return files, nil
+}
+
+// offlineRendition picks the rendition to download: in data-saver mode the
+// smallest data-saver video (audio only if there is no video), otherwise the
+// best up to 360p, which is plenty on a phone and keeps packages small.
+func offlineRendition(available models.StringList, quality string) string {
+	const maxOfflineHeight = 360
+
+	var best *transcode.Rendition
+	for _, name := range available {
+		r, ok := transcode.LookupRendition(name)
+		if !ok {
+			continue
+		}
+		if quality == api.QualityDataSaver {
+			if !r.DataSaver {
+				continue
+			}
+			if best == nil ||
+				(best.AudioOnly() && !r.AudioOnly()) ||
+				(best.AudioOnly() == r.AudioOnly() && r.Bitrate() < best.Bitrate()) {
+				best = &r
+			}
+		} else if r.Height <= maxOfflineHeight && (best == nil || r.Bitrate() > best.Bitrate()) {
+			best = &r
+		}
+	}
+
+	if best == nil {
+		if len(available) > 0 {
+			return available[0]
+		}
+		return ""
+	}
+	return best.Name
+}
+
+func getOfflineLicense(viewer Viewer, id uint) (*models.OfflineLicense, error) {
+	var license models.OfflineLicense
+	if err := config.DB.First(&license, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("License not found")
+		}
+		return nil, err
+	}
+	if license.UserID != viewer.UserID && !viewer.IsAdmin() {
+		return nil, apperror.ErrNotFound.WithDetail("License not found")
+	}
+	return &license, nil
+}
+
+func revokeLicense(license *models.OfflineLicense, reason string) error {
+	now := time.Now()
+	license.RevokedAt = &now
+	license.RevokeReason = reason
+	return config.DB.Model(license).Updates(map[string]interface{}{
+		"revoked_at":    license.RevokedAt,
+		"revoke_reason": reason,
+	}).Error
+}
+
+func copyBundleFile(ctx context.Context, archive *zip.Writer, f BundleFile) error {
+	if f.Key == "" {
+		return writeZipEntry(archive, f.Path, zip.Deflate, bytes.NewReader(f.Data))
+	}
+	obj, err := config.Storage.Open(ctx, f.Key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	// Media is already compressed
+	return writeZipEntry(archive, f.Path, zip.Store, obj)
+}
+
+func writeZipEntry(archive *zip.Writer, name string, method uint16, r io.Reader) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+func writeJSONEntry(archive *zip.Writer, name string, data interface{}) error {
+	entry, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(entry)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func uniqueIDs(ids []uint) models.IDList {
+	out := make(models.IDList, 0, len(ids))
+	for _, id := range ids {
+		if !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
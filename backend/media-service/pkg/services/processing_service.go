@@ -0,0 +1,260 @@
+// media-service/pkg/services/processing_service.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/imaging"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/transcode"
+
+	"gorm.io/gorm"
+)
+
+var packagedContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".opus": "audio/ogg",
+	".m4a":  "audio/mp4",
+	".jpg":  "image/jpeg",
+	".vtt":  "text/vtt; charset=utf-8",
+	".json": "application/json",
+}
+
+// RegisterMediaProcessing starts handling JobProcessMedia, JobPosterFrame
+// and JobProcessAudioTrack with config.Encoder. Until it is called, those
+// jobs stay queued.
+func RegisterMediaProcessing() {
+	RegisterJobHandler(JobProcessMedia, processMedia)
+	RegisterJobHandler(JobPosterFrame, extractPoster)
+	RegisterJobHandler(JobProcessAudioTrack, processAudioTrack)
+}
+
+// HLSMasterKey returns the storage key of the item's master playlist, or ""
+// if it has not been packaged.
+func HLSMasterKey(item *models.MediaItem) string {
+	if item.HLSPrefix == "" {
+		return ""
+	}
+	return path.Join(item.HLSPrefix, transcode.MasterPlaylist)
+}
+
+func processMedia(ctx context.Context, job *models.ProcessingJob) error {
+	var payload ProcessMediaJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	var item models.MediaItem
+	if err := config.DB.First(&item, job.MediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Deleted while queued
+			return nil
+		}
+		return err
+	}
+	if item.SourceKey != payload.SourceKey {
+		// A newer upload replaced this source and has its own job
+		return nil
+	}
+
+	setProcessingStatus(item.ID, models.ProcessingProcessing, "")
+
+	out, err := packageMedia(ctx, &item, job)
+	if err != nil {
+		status := models.ProcessingQueued
+		if job.Attempts >= config.Config.Jobs.MaxAttempts {
+			status = models.ProcessingFailed
+		}
+		setProcessingStatus(item.ID, status, err.Error())
+		return err
+	}
+
+	columns := map[string]interface{}{
+		"processing_status": models.ProcessingReady,
+		"processing_error":  "",
+		"hls_prefix":        out.prefix,
+		"renditions":        models.StringList{},
+		"downloads":         models.StringList{},
+	}
+	if result := out.result; result != nil {
+		names := make(models.StringList, 0, len(result.Renditions))
+		for _, r := range result.Renditions {
+			names = append(names, r.Name)
+		}
+		columns["renditions"] = names
+		downloads := make(models.StringList, 0, len(result.AudioFiles))
+		for _, f := range result.AudioFiles {
+			downloads = append(downloads, f.Name)
+		}
+		columns["downloads"] = downloads
+		if item.DurationSeconds == 0 {
+			columns["duration_seconds"] = int(result.Probe.DurationSeconds + 0.5)
+		}
+	}
+	if visuals := out.visuals; visuals != nil {
+		columns["images_prefix"] = out.imagesPrefix
+		columns["poster_times"] = models.FloatList(visuals.PosterTimes)
+		columns["poster_index"] = 0
+		columns["sprite_sheets"] = visuals.SpriteSheets
+		columns["has_waveform"] = visuals.Waveform
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(columns).Error; err != nil {
+			return err
+		}
+		return publishEvent(tx, EventMediaProcessed, item.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	if item.HLSPrefix != "" && item.HLSPrefix != out.prefix {
+		if err := storage.DeletePrefix(ctx, config.Storage, item.HLSPrefix); err != nil {
+			config.Log.WithError(err).WithField("prefix", item.HLSPrefix).Warn("failed to remove old renditions")
+		}
+	}
+	if out.visuals != nil && item.ImagesPrefix != "" && item.ImagesPrefix != out.imagesPrefix {
+		if err := storage.DeletePrefix(ctx, config.Storage, item.ImagesPrefix); err != nil {
+			config.Log.WithError(err).WithField("prefix", item.ImagesPrefix).Warn("failed to remove old images")
+		}
+	}
+
+	queueAutoDraft(&item)
+	return nil
+}
+
+// packaged is what packageMedia stored for an item.
+type packaged struct {
+	result *transcode.Result
+	prefix string
+	// Nil if the images could not be generated
+	visuals      *transcode.Visuals
+	imagesPrefix string
+}
+
+// packageMedia transcodes the item's source into an HLS ladder and stores
+// it under a prefix unique to this job, so a half-written ladder never
+// replaces a good one, then generates its images. Documents need no
+// packaging.
+func packageMedia(ctx context.Context, item *models.MediaItem, job *models.ProcessingJob) (*packaged, error) {
+	if item.Type == models.MediaTypeDocument {
+		return &packaged{}, nil
+	}
+	if config.Encoder == nil {
+		return nil, errors.New("no encoder configured")
+	}
+
+	workDir, err := os.MkdirTemp(config.Config.Transcode.WorkDir, "media-job-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	source := filepath.Join(workDir, "source")
+	if err := downloadObject(ctx, item.SourceKey, source); err != nil {
+		return nil, fmt.Errorf("download source: %w", err)
+	}
+
+	outDir := filepath.Join(workDir, "hls")
+	result, err := transcode.Package(ctx, config.Encoder, source, outDir, transcode.DefaultLadder, transcode.DefaultAudioFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("media/%d/hls/%d/", item.ID, job.ID)
+	if err := uploadDir(ctx, outDir, prefix); err != nil {
+		storage.DeletePrefix(ctx, config.Storage, prefix)
+		return nil, fmt.Errorf("store renditions: %w", err)
+	}
+	out := &packaged{result: result, prefix: prefix}
+
+	// Images are a nicety; playback must not wait on them
+	imagesDir := filepath.Join(workDir, "images")
+	visuals, err := transcode.GenerateVisuals(ctx, config.Encoder, source, imagesDir, result.Probe, visualOptions())
+	if err == nil {
+		out.imagesPrefix = fmt.Sprintf("media/%d/images/%d/", item.ID, job.ID)
+		if err = uploadDir(ctx, imagesDir, out.imagesPrefix); err != nil {
+			storage.DeletePrefix(ctx, config.Storage, out.imagesPrefix)
+		}
+	}
+	if err != nil {
+		config.Log.WithError(err).WithField("media_id", item.ID).Warn("failed to generate images")
+		return out, nil
+	}
+	out.visuals = visuals
+	return out, nil
+}
+
+func visualOptions() transcode.VisualOptions {
+	cfg := config.Config.Images
+	return transcode.VisualOptions{
+		PosterPositions: cfg.PosterPositions,
+		PosterSizes:     imaging.DefaultSizes,
+		SpriteInterval:  cfg.SpriteInterval,
+		SpriteWidth:     cfg.SpriteWidth,
+		SpriteColumns:   cfg.SpriteColumns,
+		SpriteRows:      cfg.SpriteRows,
+		WaveformPeaks:   cfg.WaveformPeaks,
+	}
+}
+
+func setProcessingStatus(mediaID uint, status, message string) {
+	if err := config.DB.Model(&models.MediaItem{}).Where("id = ?", mediaID).Updates(map[string]interface{}{
+		"processing_status": status,
+		"processing_error":  message,
+	}).Error; err != nil {
+		config.Log.WithError(err).WithField("media_id", mediaID).Error("failed to record processing status")
+	}
+}
+
+func downloadObject(ctx context.Context, key, dst string) error {
+	src, err := config.Storage.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// uploadDir stores every file below dir under prefix, keeping relative paths.
+func uploadDir(ctx context.Context, dir, prefix string) error {
+	return filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(rel)
+		return config.Storage.Put(ctx, key, f, fi.Size(), packagedContentTypes[filepath.Ext(name)])
+	})
+}
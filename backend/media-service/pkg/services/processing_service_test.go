@@ -0,0 +1,193 @@
+// media-service/pkg/services/processing_service_test.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/testenv"
+	"shepherdsfold/media-service/pkg/transcode"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupProcessing gives the test a video item with a stored source, a
+// processing job for it and a fake encoder to run it with.
+func setupProcessing(t *testing.T) (*models.MediaItem, *transcode.FakeEncoder) {
+	t.Helper()
+	testenv.Setup(t)
+	enc := &transcode.FakeEncoder{}
+	config.Encoder = enc
+	RegisterMediaProcessing()
+
+	source := []byte("not really video")
+	key := storage.ContentKey("0f1e2d3c")
+	if err := config.Storage.Put(context.Background(), key, bytes.NewReader(source), int64(len(source)), "video/mp4"); err != nil {
+		t.Fatal(err)
+	}
+	item := &models.MediaItem{
+		Title:            "Feeding of the Five Thousand",
+		Type:             models.MediaTypeVideo,
+		OwnerID:          7,
+		SourceKey:        key,
+		ProcessingStatus: models.ProcessingQueued,
+	}
+	if err := config.DB.Create(item).Error; err != nil {
+		t.Fatalf("create media: %v", err)
+	}
+	if err := EnqueueJob(config.DB, JobProcessMedia, item.ID, ProcessMediaJob{SourceKey: key}); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	return item, enc
+}
+
+// runNextJob claims and runs the next runnable job as a worker would, and
+// returns it as recorded afterwards.
+func runNextJob(t *testing.T) *models.ProcessingJob {
+	t.Helper()
+	job, err := claimJob()
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	if job == nil {
+		t.Fatal("no job to run")
+	}
+	runJob(context.Background(), job)
+	var after models.ProcessingJob
+	if err := config.DB.First(&after, job.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &after
+}
+
+func reloadMedia(t *testing.T, id uint) *models.MediaItem {
+	t.Helper()
+	var item models.MediaItem
+	if err := config.DB.First(&item, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &item
+}
+
+func TestProcessMedia(t *testing.T) {
+	item, _ := setupProcessing(t)
+	ctx := context.Background()
+
+	job := runNextJob(t)
+	if job.Status != models.JobDone || job.Attempts != 1 || job.FinishedAt == nil || job.LockedAt != nil {
+		t.Errorf("job after run: status %q, attempts %d, finished %v, locked %v", job.Status, job.Attempts, job.FinishedAt, job.LockedAt)
+	}
+
+	got := reloadMedia(t, item.ID)
+	if got.ProcessingStatus != models.ProcessingReady || got.ProcessingError != "" {
+		t.Errorf("item status %q, error %q", got.ProcessingStatus, got.ProcessingError)
+	}
+	wantPrefix := fmt.Sprintf("media/%d/hls/%d/", item.ID, job.ID)
+	if got.HLSPrefix != wantPrefix {
+		t.Errorf("hls prefix %q, want %q", got.HLSPrefix, wantPrefix)
+	}
+	wantRenditions := models.StringList{"144p", "240p", "360p", "720p", "audio-low", "audio"}
+	if !reflect.DeepEqual(got.Renditions, wantRenditions) {
+		t.Errorf("renditions %v, want %v", got.Renditions, wantRenditions)
+	}
+	if !reflect.DeepEqual(got.Downloads, models.StringList{"audio.opus", "audio.m4a"}) {
+		t.Errorf("downloads %v", got.Downloads)
+	}
+	if got.DurationSeconds != 60 {
+		t.Errorf("duration %d, want 60", got.DurationSeconds)
+	}
+	if got.ImagesPrefix != fmt.Sprintf("media/%d/images/%d/", item.ID, job.ID) {
+		t.Errorf("images prefix %q", got.ImagesPrefix)
+	}
+
+	for _, key := range []string{
+		HLSMasterKey(got),
+		path.Join(got.HLSPrefix, transcode.DataSaverPlaylist),
+		path.Join(got.HLSPrefix, "720p", transcode.VariantPlaylist),
+		path.Join(got.HLSPrefix, "720p", "segment_00005.ts"),
+		path.Join(got.HLSPrefix, "audio-low", transcode.VariantPlaylist),
+		path.Join(got.HLSPrefix, transcode.DownloadsDir, "audio.opus"),
+		path.Join(got.ImagesPrefix, transcode.WaveformFile),
+	} {
+		if _, err := config.Storage.Stat(ctx, key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	// Reprocessing swaps in a new ladder and removes the old one
+	if err := EnqueueJob(config.DB, JobProcessMedia, item.ID, ProcessMediaJob{SourceKey: item.SourceKey}); err != nil {
+		t.Fatal(err)
+	}
+	again := runNextJob(t)
+	if again.Status != models.JobDone {
+		t.Fatalf("second job %q: %s", again.Status, again.LastError)
+	}
+	if got2 := reloadMedia(t, item.ID); got2.HLSPrefix == got.HLSPrefix {
+		t.Error("reprocessing kept the old prefix")
+	}
+	if _, err := config.Storage.Stat(ctx, HLSMasterKey(got)); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("old master playlist: err %v, want %v", err, storage.ErrNotFound)
+	}
+}
+
+func TestProcessMediaFailure(t *testing.T) {
+	item, enc := setupProcessing(t)
+	config.Config.Jobs.MaxAttempts = 2
+	enc.Err = errors.New("encoder crashed")
+
+	// The first failure is retried later
+	job := runNextJob(t)
+	if job.Status != models.JobQueued || job.Attempts != 1 || !job.RunAfter.After(time.Now()) ||
+		!strings.Contains(job.LastError, "encoder crashed") {
+		t.Errorf("job after first failure: status %q, attempts %d, run after %v, error %q",
+			job.Status, job.Attempts, job.RunAfter, job.LastError)
+	}
+	got := reloadMedia(t, item.ID)
+	if got.ProcessingStatus != models.ProcessingQueued || !strings.Contains(got.ProcessingError, "encoder crashed") {
+		t.Errorf("item after first failure: status %q, error %q", got.ProcessingStatus, got.ProcessingError)
+	}
+	if got.HLSPrefix != "" {
+		t.Errorf("failed job set hls prefix %q", got.HLSPrefix)
+	}
+	if next, err := claimJob(); err != nil || next != nil {
+		t.Fatalf("job claimed before its backoff: %+v, err %v", next, err)
+	}
+	if objects, err := config.Storage.List(context.Background(), fmt.Sprintf("media/%d/hls/", item.ID)); err != nil || len(objects) != 0 {
+		t.Errorf("failed job left renditions: %v, err %v", objects, err)
+	}
+
+	// The last attempt fails for good
+	config.DB.Model(job).Update("run_after", time.Now().Add(-time.Second))
+	job = runNextJob(t)
+	if job.Status != models.JobFailed || job.Attempts != 2 || job.FinishedAt == nil {
+		t.Errorf("job after last failure: status %q, attempts %d, finished %v", job.Status, job.Attempts, job.FinishedAt)
+	}
+	if got := reloadMedia(t, item.ID); got.ProcessingStatus != models.ProcessingFailed {
+		t.Errorf("item after last failure: status %q", got.ProcessingStatus)
+	}
+	if next, err := claimJob(); err != nil || next != nil {
+		t.Errorf("failed job claimed again: %+v, err %v", next, err)
+	}
+}
+
+func TestProcessMediaReplacedSource(t *testing.T) {
+	item, enc := setupProcessing(t)
+	config.DB.Model(item).Update("source_key", storage.ContentKey("a1b2c3d4"))
+
+	job := runNextJob(t)
+	if job.Status != models.JobDone {
+		t.Errorf("job for a replaced source %q: %s", job.Status, job.LastError)
+	}
+	if len(enc.Encoded) != 0 {
+		t.Errorf("encoded %d renditions of a replaced source", len(enc.Encoded))
+	}
+	if got := reloadMedia(t, item.ID); got.ProcessingStatus != models.ProcessingQueued || got.HLSPrefix != "" {
+		t.Errorf("item status %q, prefix %q", got.ProcessingStatus, got.HLSPrefix)
+	}
+}
@@ -0,0 +1,523 @@
+// media-service/pkg/services/progress_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Heartbeats only touch Redis: a hash of the latest state and a bitmap of
+// played buckets per user and item, plus a set of the pairs changed since
+// the last flush. RunProgressFlusher writes those pairs to Postgres.
+const (
+	progressDirtyKey = "progress:dirty"
+	// Pairs written to Postgres per statement
+	progressFlushBatch = 200
+	// Bitmaps never grow beyond this many buckets, whatever positions
+	// players send
+	maxProgressBuckets = 1 << 16
+)
+
+// progressState is one user's progress on one item, read from either store.
+type progressState struct {
+	Position         float64
+	Duration         float64
+	Rate             float64
+	Rendition        string
+	DeviceID         string
+	BufferingEvents  int
+	BufferingSeconds float64
+	PlayedAt         time.Time
+	CompletedAt      *time.Time
+	WatchedBuckets   int64
+}
+
+// RecordHeartbeat stores a player heartbeat. Only the first heartbeat for
+// an item after its cache expired reads Postgres; the rest cost one Redis
+// read and one pipelined write.
+func RecordHeartbeat(ctx context.Context, viewer Viewer, id uint, hb api.ProgressHeartbeat) error {
+	cfg := config.Config.Progress
+	key, watchedKey := progressKeys(viewer.UserID, id)
+
+	fields, err := config.RedisClient.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	var state *progressState
+	if len(fields) == 0 {
+		// Access is checked when the cache is filled, so at least once
+		// per progress.cache_ttl
+		if state, err = cacheProgress(ctx, viewer, id); err != nil {
+			return err
+		}
+	} else {
+		state = parseProgress(fields)
+	}
+
+	now := time.Now()
+	rate := hb.Rate
+	if rate == 0 {
+		rate = 1
+	}
+	duration := state.Duration
+	if duration == 0 {
+		duration = hb.DurationSeconds
+	}
+
+	update := map[string]interface{}{
+		"position":  hb.PositionSeconds,
+		"duration":  duration,
+		"rate":      rate,
+		"played_at": now.UnixMilli(),
+	}
+	if hb.Rendition != "" {
+		update["rendition"] = hb.Rendition
+	}
+	if hb.DeviceID != "" {
+		update["device"] = hb.DeviceID
+	}
+
+	pipe := config.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key, update)
+	if hb.BufferingEvents > 0 {
+		pipe.HIncrBy(ctx, key, "buffering_events", int64(hb.BufferingEvents))
+	}
+	if hb.BufferingSeconds > 0 {
+		pipe.HIncrByFloat(ctx, key, "buffering_seconds", hb.BufferingSeconds)
+	}
+	if from, to, ok := playedBuckets(state, hb, rate, now); ok {
+		for b := from; b <= to; b++ {
+			pipe.SetBit(ctx, watchedKey, b, 1)
+		}
+	}
+	queueAnalyticsEvent(ctx, pipe, viewer, id, state, hb, rate, now)
+	watched := pipe.BitCount(ctx, watchedKey, nil)
+	pipe.Expire(ctx, key, cfg.CacheTTL)
+	pipe.Expire(ctx, watchedKey, cfg.CacheTTL)
+	pipe.SAdd(ctx, progressDirtyKey, progressMember(viewer.UserID, id))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if state.CompletedAt == nil && watchedPercent(watched.Val(), duration) >= cfg.CompletePercent {
+		return config.RedisClient.HSetNX(ctx, key, "completed_at", now.UnixMilli()).Err()
+	}
+	return nil
+}
+
+// GetProgress returns the viewer's progress on an item, all zero if they
+// have not played it.
+func GetProgress(ctx context.Context, viewer Viewer, id uint) (*api.MediaProgress, error) {
+	item, err := GetMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	progress, err := loadProgress(ctx, viewer.UserID, []uint{id})
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := progress[id]; ok {
+		return p, nil
+	}
+	return &api.MediaProgress{DurationSeconds: float64(item.DurationSeconds)}, nil
+}
+
+// AttachProgress fills in the viewer's progress on the listed items they
+// have played. Progress is a nicety there, so failures are only logged.
+func AttachProgress(ctx context.Context, viewer Viewer, items []api.MediaItem) {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if item.Type != models.MediaTypeDocument {
+			ids = append(ids, item.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	progress, err := loadProgress(ctx, viewer.UserID, ids)
+	if err != nil {
+		config.Log.WithError(err).WithField("user_id", viewer.UserID).Warn("failed to load playback progress")
+		return
+	}
+	for i := range items {
+		items[i].Progress = progress[items[i].ID]
+	}
+}
+
+// RunProgressFlusher writes cached heartbeats to Postgres every
+// progress.flush_interval until ctx is cancelled.
+func RunProgressFlusher(ctx context.Context) {
+	interval := config.Config.Progress.FlushInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n, err := FlushProgress(ctx); err != nil {
+			config.Log.WithError(err).Error("progress flush failed")
+		} else if n > 0 {
+			config.Log.WithField("count", n).Debug("flushed playback progress")
+		}
+	}
+}
+
+// FlushProgress writes every pair changed since the last flush to Postgres
+// and returns how many it wrote. Instances may flush concurrently; each
+// pair is taken by one of them.
+func FlushProgress(ctx context.Context) (int, error) {
+	written := 0
+	for {
+		members, err := config.RedisClient.SPopN(ctx, progressDirtyKey, progressFlushBatch).Result()
+		if err != nil {
+			return written, err
+		}
+		if len(members) == 0 {
+			return written, nil
+		}
+
+		rows, err := cachedProgressRows(ctx, members)
+		if err == nil && len(rows) > 0 {
+			err = config.DB.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "user_id"}, {Name: "media_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{
+					"updated_at", "position_seconds", "duration_seconds", "watched", "rate", "rendition",
+					"device_id", "buffering_events", "buffering_seconds", "completed_at", "last_played_at",
+				}),
+			}).Create(&rows).Error
+		}
+		if err != nil {
+			// Leave them for the next flush
+			requeue := make([]interface{}, len(members))
+			for i, m := range members {
+				requeue[i] = m
+			}
+			if rerr := config.RedisClient.SAdd(ctx, progressDirtyKey, requeue...).Err(); rerr != nil {
+				config.Log.WithError(rerr).WithField("count", len(members)).Error("lost playback progress")
+			}
+			return written, err
+		}
+		written += len(rows)
+	}
+}
+
+// cacheProgress checks the viewer may play the item and copies its
+// progress, if any, from Postgres to Redis.
+func cacheProgress(ctx context.Context, viewer Viewer, id uint) (*progressState, error) {
+	item, err := GetMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Type == models.MediaTypeDocument {
+		return nil, apperror.ErrValidation.WithDetail("Documents have no playback progress")
+	}
+
+	state := &progressState{Duration: float64(item.DurationSeconds), Rate: 1}
+	var row models.PlaybackProgress
+	err = config.DB.Where("user_id = ? AND media_id = ?", viewer.UserID, id).First(&row).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		state = rowProgress(&row)
+		if item.DurationSeconds > 0 {
+			state.Duration = float64(item.DurationSeconds)
+		}
+	}
+
+	fields := map[string]interface{}{
+		"position":          state.Position,
+		"duration":          state.Duration,
+		"rate":              state.Rate,
+		"rendition":         state.Rendition,
+		"device":            state.DeviceID,
+		"buffering_events":  state.BufferingEvents,
+		"buffering_seconds": state.BufferingSeconds,
+	}
+	if !state.PlayedAt.IsZero() {
+		fields["played_at"] = state.PlayedAt.UnixMilli()
+	}
+	if state.CompletedAt != nil {
+		fields["completed_at"] = state.CompletedAt.UnixMilli()
+	}
+
+	key, watchedKey := progressKeys(viewer.UserID, id)
+	ttl := config.Config.Progress.CacheTTL
+	pipe := config.RedisClient.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, ttl)
+	if len(row.Watched) > 0 {
+		pipe.Set(ctx, watchedKey, row.Watched, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// loadProgress reads the user's progress on the items, preferring Redis,
+// which is never behind Postgres. Items never played are left out.
+func loadProgress(ctx context.Context, userID uint, ids []uint) (map[uint]*api.MediaProgress, error) {
+	hashes := make([]*redis.StringStringMapCmd, len(ids))
+	counts := make([]*redis.IntCmd, len(ids))
+	pipe := config.RedisClient.Pipeline()
+	for i, id := range ids {
+		key, watchedKey := progressKeys(userID, id)
+		hashes[i] = pipe.HGetAll(ctx, key)
+		counts[i] = pipe.BitCount(ctx, watchedKey, nil)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	progress := make(map[uint]*api.MediaProgress, len(ids))
+	var uncached []uint
+	for i, id := range ids {
+		fields := hashes[i].Val()
+		if _, played := fields["played_at"]; !played {
+			// Not cached, or cached from Postgres with nothing played
+			uncached = append(uncached, id)
+			continue
+		}
+		state := parseProgress(fields)
+		state.WatchedBuckets = counts[i].Val()
+		progress[id] = state.toAPI()
+	}
+	if len(uncached) == 0 {
+		return progress, nil
+	}
+
+	var rows []models.PlaybackProgress
+	if err := config.DB.Where("user_id = ? AND media_id IN ?", userID, uncached).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		progress[rows[i].MediaID] = rowProgress(&rows[i]).toAPI()
+	}
+	return progress, nil
+}
+
+// cachedProgressRows reads the dirty pairs back from Redis as rows. Pairs
+// whose cache has expired since are skipped.
+func cachedProgressRows(ctx context.Context, members []string) ([]models.PlaybackProgress, error) {
+	type pair struct {
+		userID, mediaID uint
+		hash            *redis.StringStringMapCmd
+		watched         *redis.StringCmd
+	}
+	pairs := make([]pair, 0, len(members))
+	pipe := config.RedisClient.Pipeline()
+	for _, m := range members {
+		userID, mediaID, ok := parseProgressMember(m)
+		if !ok {
+			continue
+		}
+		key, watchedKey := progressKeys(userID, mediaID)
+		pairs = append(pairs, pair{
+			userID:  userID,
+			mediaID: mediaID,
+			hash:    pipe.HGetAll(ctx, key),
+			watched: pipe.Get(ctx, watchedKey),
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	now := time.Now()
+	rows := make([]models.PlaybackProgress, 0, len(pairs))
+	for _, p := range pairs {
+		fields := p.hash.Val()
+		if _, played := fields["played_at"]; !played {
+			continue
+		}
+		state := parseProgress(fields)
+		watched, _ := p.watched.Bytes()
+		rows = append(rows, models.PlaybackProgress{
+			CreatedAt:        now,
+			UpdatedAt:        now,
+			UserID:           p.userID,
+			MediaID:          p.mediaID,
+			PositionSeconds:  state.Position,
+			DurationSeconds:  state.Duration,
+			Watched:          watched,
+			Rate:             state.Rate,
+			Rendition:        state.Rendition,
+			DeviceID:         state.DeviceID,
+			BufferingEvents:  state.BufferingEvents,
+			BufferingSeconds: state.BufferingSeconds,
+			CompletedAt:      state.CompletedAt,
+			LastPlayedAt:     state.PlayedAt,
+		})
+	}
+	return rows, nil
+}
+
+// playedSpan returns the part of the item played between the previous
+// heartbeat and this one. Nothing counts across a seek, or when the
+// position moved further than the player could have played it in the time
+// between.
+func playedSpan(state *progressState, hb api.ProgressHeartbeat, rate float64, now time.Time) (float64, float64, bool) {
+	if hb.Event == api.PlaybackSeek || state.PlayedAt.IsZero() {
+		return 0, 0, false
+	}
+	cfg := config.Config.Progress
+	gap := now.Sub(state.PlayedAt)
+	if gap > cfg.MaxGap {
+		gap = cfg.MaxGap
+	}
+	advance := hb.PositionSeconds - state.Position
+	if advance <= 0 || advance > gap.Seconds()*rate*1.25+cfg.BucketSeconds {
+		return 0, 0, false
+	}
+	return state.Position, hb.PositionSeconds, true
+}
+
+// playedBuckets returns the buckets of the watched map played between the
+// previous heartbeat and this one.
+func playedBuckets(state *progressState, hb api.ProgressHeartbeat, rate float64, now time.Time) (int64, int64, bool) {
+	start, end, ok := playedSpan(state, hb, rate, now)
+	if !ok {
+		return 0, 0, false
+	}
+
+	// A bucket counts once playback passes its start, so consecutive
+	// heartbeats never count one twice
+	bucket := config.Config.Progress.BucketSeconds
+	from := int64(math.Ceil(start / bucket))
+	to := int64(math.Ceil(end/bucket)) - 1
+	if to >= maxProgressBuckets {
+		to = maxProgressBuckets - 1
+	}
+	return from, to, from <= to
+}
+
+// watchedPercent is the share of an item's buckets played, 0 if its length
+// is unknown.
+func watchedPercent(buckets int64, duration float64) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	total := math.Ceil(duration / config.Config.Progress.BucketSeconds)
+	return math.Min(100, math.Round(1000*float64(buckets)/total)/10)
+}
+
+func (s *progressState) toAPI() *api.MediaProgress {
+	p := &api.MediaProgress{
+		PositionSeconds:  s.Position,
+		ResumeSeconds:    s.Position,
+		DurationSeconds:  s.Duration,
+		WatchedPercent:   watchedPercent(s.WatchedBuckets, s.Duration),
+		Completed:        s.CompletedAt != nil,
+		CompletedAt:      s.CompletedAt,
+		Rate:             s.Rate,
+		Rendition:        s.Rendition,
+		DeviceID:         s.DeviceID,
+		BufferingEvents:  s.BufferingEvents,
+		BufferingSeconds: s.BufferingSeconds,
+	}
+	if s.Duration > 0 && s.Duration-s.Position <= config.Config.Progress.RestartWithin {
+		p.ResumeSeconds = 0
+	}
+	if !s.PlayedAt.IsZero() {
+		playedAt := s.PlayedAt
+		p.LastPlayedAt = &playedAt
+	}
+	return p
+}
+
+func parseProgress(fields map[string]string) *progressState {
+	float := func(name string) float64 {
+		v, _ := strconv.ParseFloat(fields[name], 64)
+		return v
+	}
+	millis := func(name string) *time.Time {
+		v, err := strconv.ParseInt(fields[name], 10, 64)
+		if err != nil {
+			return nil
+		}
+		t := time.UnixMilli(v)
+		return &t
+	}
+
+	state := &progressState{
+		Position:         float("position"),
+		Duration:         float("duration"),
+		Rate:             float("rate"),
+		Rendition:        fields["rendition"],
+		DeviceID:         fields["device"],
+		BufferingEvents:  int(float("buffering_events")),
+		BufferingSeconds: float("buffering_seconds"),
+		CompletedAt:      millis("completed_at"),
+	}
+	if playedAt := millis("played_at"); playedAt != nil {
+		state.PlayedAt = *playedAt
+	}
+	return state
+}
+
+func rowProgress(row *models.PlaybackProgress) *progressState {
+	var watched int64
+	for _, b := range row.Watched {
+		watched += int64(bits.OnesCount8(b))
+	}
+	return &progressState{
+		Position:         row.PositionSeconds,
+		Duration:         row.DurationSeconds,
+		Rate:             row.Rate,
+		Rendition:        row.Rendition,
+		DeviceID:         row.DeviceID,
+		BufferingEvents:  row.BufferingEvents,
+		BufferingSeconds: row.BufferingSeconds,
+		PlayedAt:         row.LastPlayedAt,
+		CompletedAt:      row.CompletedAt,
+		WatchedBuckets:   watched,
+	}
+}
+
+func progressKeys(userID, mediaID uint) (key, watchedKey string) {
+	key = fmt.Sprintf("progress:%d:%d", userID, mediaID)
+	return key, key + ":watched"
+}
+
+func progressMember(userID, mediaID uint) string {
+	return fmt.Sprintf("%d:%d", userID, mediaID)
+}
+
+func parseProgressMember(member string) (userID, mediaID uint, ok bool) {
+	u, m, found := strings.Cut(member, ":")
+	if !found {
+		return 0, 0, false
+	}
+	user, err := strconv.ParseUint(u, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	media, err := strconv.ParseUint(m, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint(user), uint(media), true
+}
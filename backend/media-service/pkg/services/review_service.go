@@ -0,0 +1,548 @@
+// media-service/pkg/services/review_service.go
+package services
+
+import (
+	"errors"
+	"fmt"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/mail"
+	"shepherdsfold/media-service/pkg/models"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// catalogColumns are the fields a MediaVersion holds. Changes to them on a
+// live item wait in its open version until that is published; the other
+// fields, such as visibility and the publishing dates, apply at once.
+var catalogColumns = []string{"title", "description", "type", "speaker", "series", "scripture_refs", "tags", "language"}
+
+// openReviewStates are those of a version that has not been published.
+// An item has at most one such version, its newest.
+var openReviewStates = []string{
+	models.ReviewDraft, models.ReviewSubmitted, models.ReviewInReview, models.ReviewApproved, models.ReviewRejected,
+}
+
+// ListMediaVersions returns an item's versions, newest first. Only its
+// editors and reviewers may see them.
+func ListMediaVersions(viewer Viewer, mediaID uint) ([]api.MediaVersion, error) {
+	item, err := reviewableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []models.MediaVersion
+	if err := config.DB.Where("media_id = ?", item.ID).Order("number DESC").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	out := make([]api.MediaVersion, 0, len(versions))
+	for i := range versions {
+		out = append(out, ToAPIMediaVersion(&versions[i], item.LiveVersion))
+	}
+	return out, nil
+}
+
+// GetMediaVersion returns one version of an item with its review comments.
+func GetMediaVersion(viewer Viewer, mediaID uint, number int) (*api.MediaVersion, error) {
+	item, err := reviewableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := mediaVersion(item.ID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []models.ReviewComment
+	if err := config.DB.Where("version_id = ?", version.ID).Order("id").Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	out := ToAPIMediaVersion(version, item.LiveVersion)
+	for i := range comments {
+		out.Comments = append(out.Comments, toAPIReviewComment(&comments[i], version.Number))
+	}
+	return &out, nil
+}
+
+// ListReviewQueue returns the versions awaiting a reviewer, those
+// submitted longest ago first.
+func ListReviewQueue(viewer Viewer) ([]api.MediaVersion, error) {
+	if !viewer.CanReview() {
+		return nil, apperror.ErrForbidden.WithDetail("Only reviewers can see the review queue")
+	}
+
+	var versions []models.MediaVersion
+	if err := config.DB.
+		Joins("JOIN media_items ON media_items.id = media_versions.media_id AND media_items.deleted_at IS NULL").
+		Where("media_versions.status IN ?", []string{models.ReviewSubmitted, models.ReviewInReview}).
+		Order("media_versions.submitted_at").
+		Order("media_versions.id").
+		Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	out := make([]api.MediaVersion, 0, len(versions))
+	for i := range versions {
+		out = append(out, ToAPIMediaVersion(&versions[i], 0))
+	}
+	return out, nil
+}
+
+// SubmitMedia asks reviewers to look at the item's draft, or at a
+// rejected version once it has been reworked, and mails them about it.
+func SubmitMedia(viewer Viewer, mediaID uint, comment string) (*api.MediaVersion, error) {
+	item, err := editableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return reviewStep(viewer, item, models.ReviewSubmitted, comment,
+		[]string{models.ReviewDraft, models.ReviewRejected},
+		func(tx *gorm.DB, v *models.MediaVersion) error {
+			now := time.Now()
+			v.SubmittedAt = &now
+			v.ReviewerID = 0
+			v.ReviewedAt = nil
+			v.AuthorID = viewer.UserID
+			return queueMail(tx, reviewerMail(item, v, comment)...)
+		})
+}
+
+// StartReview records that the viewer has taken up a submitted version,
+// so other reviewers can leave it to them.
+func StartReview(viewer Viewer, mediaID uint) (*api.MediaVersion, error) {
+	item, err := reviewingMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return reviewStep(viewer, item, models.ReviewInReview, "",
+		[]string{models.ReviewSubmitted},
+		func(tx *gorm.DB, v *models.MediaVersion) error {
+			if err := notOwnVersion(viewer, v); err != nil {
+				return err
+			}
+			v.ReviewerID = viewer.UserID
+			return nil
+		})
+}
+
+// ApproveMedia clears a submitted version for publishing and tells its
+// author.
+func ApproveMedia(viewer Viewer, mediaID uint, comment string) (*api.MediaVersion, error) {
+	item, err := reviewingMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return reviewStep(viewer, item, models.ReviewApproved, comment,
+		[]string{models.ReviewSubmitted, models.ReviewInReview},
+		func(tx *gorm.DB, v *models.MediaVersion) error {
+			if err := notOwnVersion(viewer, v); err != nil {
+				return err
+			}
+			now := time.Now()
+			v.ReviewerID = viewer.UserID
+			v.ReviewedAt = &now
+			return queueUserMail(tx, v.AuthorID, authorMail(v, "Approved: "+v.Title,
+				fmt.Sprintf("Version %d of %q has been approved and can now be published.\n", v.Number, v.Title), comment))
+		})
+}
+
+// RejectMedia sends a submitted version back to its author with the
+// changes the reviewer asks for.
+func RejectMedia(viewer Viewer, mediaID uint, comment string) (*api.MediaVersion, error) {
+	if strings.TrimSpace(comment) == "" {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "comment", Code: "required", Message: "must say what needs to change",
+		})
+	}
+	item, err := reviewingMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return reviewStep(viewer, item, models.ReviewRejected, comment,
+		[]string{models.ReviewSubmitted, models.ReviewInReview},
+		func(tx *gorm.DB, v *models.MediaVersion) error {
+			if err := notOwnVersion(viewer, v); err != nil {
+				return err
+			}
+			now := time.Now()
+			v.ReviewerID = viewer.UserID
+			v.ReviewedAt = &now
+			return queueUserMail(tx, v.AuthorID, authorMail(v, "Changes requested: "+v.Title,
+				fmt.Sprintf("Version %d of %q was not approved. The reviewer wrote:\n", v.Number, v.Title), comment))
+		})
+}
+
+// PublishMedia puts an approved version live: its catalog fields replace
+// the item's, and the version learners saw until now is superseded.
+// Its editors and reviewers other than its author may do this.
+func PublishMedia(viewer Viewer, mediaID uint) (*api.MediaVersion, error) {
+	item, err := reviewableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	return reviewStep(viewer, item, models.ReviewPublished, "",
+		[]string{models.ReviewApproved},
+		func(tx *gorm.DB, v *models.MediaVersion) error {
+			if err := notOwnVersion(viewer, v); err != nil {
+				return err
+			}
+			// Stored references are canonical, in English numbering
+			refs, ranges, err := parseScriptureRefs(v.ScriptureRefs, "")
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&models.MediaVersion{}).
+				Where("media_id = ? AND status = ?", item.ID, models.ReviewPublished).
+				Update("status", models.ReviewSuperseded).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(item).Updates(map[string]interface{}{
+				"title":          v.Title,
+				"description":    v.Description,
+				"type":           v.Type,
+				"speaker":        v.Speaker,
+				"series":         v.Series,
+				"scripture_refs": refs,
+				"tags":           v.Tags,
+				"language":       v.Language,
+				"live_version":   v.Number,
+			}).Error; err != nil {
+				return err
+			}
+			item.LiveVersion = v.Number
+			if err := replaceScriptureRanges(tx, item.ID, ranges); err != nil {
+				return err
+			}
+			now := time.Now()
+			v.PublishedAt = &now
+			v.PublishedBy = viewer.UserID
+			if err := publishEvent(tx, EventMediaUpdated, item.ID); err != nil {
+				return err
+			}
+			return queueUserMail(tx, v.AuthorID, authorMail(v, "Published: "+v.Title,
+				fmt.Sprintf("Version %d of %q is now live.\n", v.Number, v.Title), ""))
+		})
+}
+
+// AddReviewComment leaves a remark on a version without moving it on.
+func AddReviewComment(viewer Viewer, mediaID uint, number int, body string) (*api.ReviewComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "body", Code: "required", Message: "is required",
+		})
+	}
+	item, err := reviewableMedia(viewer, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := mediaVersion(item.ID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &models.ReviewComment{MediaID: item.ID, VersionID: version.ID, AuthorID: viewer.UserID, Body: body}
+	if err := config.DB.Create(comment).Error; err != nil {
+		return nil, err
+	}
+	out := toAPIReviewComment(comment, version.Number)
+	return &out, nil
+}
+
+func ToAPIMediaVersion(v *models.MediaVersion, liveVersion int) api.MediaVersion {
+	return api.MediaVersion{
+		MediaID:       v.MediaID,
+		Number:        v.Number,
+		Status:        v.Status,
+		Live:          v.Number == liveVersion,
+		Title:         v.Title,
+		Description:   v.Description,
+		Type:          v.Type,
+		Speaker:       v.Speaker,
+		Series:        v.Series,
+		ScriptureRefs: nonNil(v.ScriptureRefs),
+		Tags:          nonNil(v.Tags),
+		Language:      v.Language,
+		AuthorID:      v.AuthorID,
+		ReviewerID:    v.ReviewerID,
+		SubmittedAt:   v.SubmittedAt,
+		ReviewedAt:    v.ReviewedAt,
+		PublishedAt:   v.PublishedAt,
+		CreatedAt:     v.CreatedAt,
+		UpdatedAt:     v.UpdatedAt,
+	}
+}
+
+func toAPIReviewComment(c *models.ReviewComment, number int) api.ReviewComment {
+	return api.ReviewComment{
+		ID:        c.ID,
+		Version:   number,
+		AuthorID:  c.AuthorID,
+		Action:    c.Action,
+		Body:      c.Body,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+// reviewStep moves the item's open version from one of the states in from
+// to status, records comment against it, and lets then fill in the rest
+// before the version is saved, all in one transaction.
+func reviewStep(viewer Viewer, item *models.MediaItem, status, comment string, from []string, then func(tx *gorm.DB, v *models.MediaVersion) error) (*api.MediaVersion, error) {
+	var version *models.MediaVersion
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(item, item.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		if version, err = openVersion(tx, item.ID); err != nil {
+			return err
+		}
+		if version == nil {
+			return apperror.ErrConflict.WithDetail("There are no changes awaiting review")
+		}
+		if !slices.Contains(from, version.Status) {
+			return apperror.ErrConflict.WithDetail(fmt.Sprintf("Version %d is %s", version.Number, strings.ReplaceAll(version.Status, "_", " ")))
+		}
+
+		version.Status = status
+		if err := then(tx, version); err != nil {
+			return err
+		}
+		if err := tx.Save(version).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(item).Update("review_status", status).Error; err != nil {
+			return err
+		}
+		if comment = strings.TrimSpace(comment); comment == "" {
+			return nil
+		}
+		return tx.Create(&models.ReviewComment{
+			MediaID:   item.ID,
+			VersionID: version.ID,
+			AuthorID:  viewer.UserID,
+			Action:    status,
+			Body:      comment,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := ToAPIMediaVersion(version, item.LiveVersion)
+	return &out, nil
+}
+
+// draftChanges records changes to catalog columns in the item's open
+// version and sends that back to draft, withdrawing it from review. If
+// there is none, one is opened from the item as it stands, unless the
+// changes leave a live item as it is.
+func draftChanges(tx *gorm.DB, viewer Viewer, item *models.MediaItem, columns map[string]interface{}) error {
+	changes := map[string]interface{}{}
+	for column, value := range columns {
+		if slices.Contains(catalogColumns, column) {
+			changes[column] = value
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	// Serializes version numbering
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.MediaItem{}, item.ID).Error; err != nil {
+		return err
+	}
+
+	version, err := openVersion(tx, item.ID)
+	if err != nil {
+		return err
+	}
+	if version == nil {
+		if isLive(item) && sameCatalog(itemCatalog(item), changes) {
+			return nil
+		}
+		if version, err = newVersion(tx, viewer, item); err != nil {
+			return err
+		}
+	} else if sameCatalog(versionCatalog(version), changes) {
+		return nil
+	}
+
+	changes["status"] = models.ReviewDraft
+	changes["author_id"] = viewer.UserID
+	changes["submitted_at"] = nil
+	changes["reviewer_id"] = 0
+	changes["reviewed_at"] = nil
+	if err := tx.Model(version).Updates(changes).Error; err != nil {
+		return err
+	}
+	item.ReviewStatus = models.ReviewDraft
+	return tx.Model(item).UpdateColumn("review_status", models.ReviewDraft).Error
+}
+
+// newVersion opens the next version of item, starting from its catalog
+// fields. The first edit of an item published before versions were kept
+// records what learners have seen all along as a version of its own.
+func newVersion(tx *gorm.DB, viewer Viewer, item *models.MediaItem) (*models.MediaVersion, error) {
+	var last int
+	if err := tx.Model(&models.MediaVersion{}).Where("media_id = ?", item.ID).
+		Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+		return nil, err
+	}
+
+	if isLive(item) && item.LiveVersion == 0 {
+		live := snapshotVersion(item)
+		live.Number = last + 1
+		live.Status = models.ReviewPublished
+		live.AuthorID = item.OwnerID
+		published := item.UpdatedAt
+		live.PublishedAt = &published
+		if err := tx.Create(live).Error; err != nil {
+			return nil, err
+		}
+		last = live.Number
+		item.LiveVersion = last
+		if err := tx.Model(item).UpdateColumn("live_version", last).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	version := snapshotVersion(item)
+	version.Number = last + 1
+	version.Status = models.ReviewDraft
+	version.AuthorID = viewer.UserID
+	if err := tx.Create(version).Error; err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// openVersion returns the item's version that has yet to be published, or
+// nil if there is none.
+func openVersion(tx *gorm.DB, mediaID uint) (*models.MediaVersion, error) {
+	var version models.MediaVersion
+	err := tx.Where("media_id = ? AND status IN ?", mediaID, openReviewStates).Order("number DESC").First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func mediaVersion(mediaID uint, number int) (*models.MediaVersion, error) {
+	var version models.MediaVersion
+	if err := config.DB.Where("media_id = ? AND number = ?", mediaID, number).First(&version).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Version not found")
+		}
+		return nil, err
+	}
+	return &version, nil
+}
+
+func snapshotVersion(item *models.MediaItem) *models.MediaVersion {
+	return &models.MediaVersion{
+		MediaID:       item.ID,
+		Title:         item.Title,
+		Description:   item.Description,
+		Type:          item.Type,
+		Speaker:       item.Speaker,
+		Series:        item.Series,
+		ScriptureRefs: item.ScriptureRefs,
+		Tags:          item.Tags,
+		Language:      item.Language,
+	}
+}
+
+// itemCatalog and versionCatalog key the catalog fields by column.
+func itemCatalog(item *models.MediaItem) map[string]interface{} {
+	return versionCatalog(snapshotVersion(item))
+}
+
+func versionCatalog(v *models.MediaVersion) map[string]interface{} {
+	return map[string]interface{}{
+		"title":          v.Title,
+		"description":    v.Description,
+		"type":           v.Type,
+		"speaker":        v.Speaker,
+		"series":         v.Series,
+		"scripture_refs": v.ScriptureRefs,
+		"tags":           v.Tags,
+		"language":       v.Language,
+	}
+}
+
+// sameCatalog reports whether changes would leave the catalog fields in
+// current as they are.
+func sameCatalog(current, changes map[string]interface{}) bool {
+	for column, value := range changes {
+		if list, ok := value.(models.StringList); ok {
+			old, _ := current[column].(models.StringList)
+			if !slices.Equal(list, old) {
+				return false
+			}
+		} else if value != current[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// reviewableMedia loads an item for one of its editors or a reviewer.
+func reviewableMedia(viewer Viewer, id uint) (*models.MediaItem, error) {
+	item, err := GetMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if !viewer.CanEdit(item) && !viewer.CanReview() {
+		return nil, apperror.ErrForbidden.WithDetail("Only the item's editors and reviewers can see its review")
+	}
+	return item, nil
+}
+
+// reviewingMedia loads an item for a reviewer.
+func reviewingMedia(viewer Viewer, id uint) (*models.MediaItem, error) {
+	if !viewer.CanReview() {
+		return nil, apperror.ErrForbidden.WithDetail("Only reviewers can approve or reject media")
+	}
+	return GetMedia(viewer, id)
+}
+
+// notOwnVersion refuses review steps by the version's author, so every
+// version is approved and published by someone other than who wrote it.
+func notOwnVersion(viewer Viewer, v *models.MediaVersion) error {
+	if v.AuthorID == viewer.UserID {
+		return apperror.ErrForbidden.WithDetail("You cannot review or publish your own version")
+	}
+	return nil
+}
+
+// reviewerMail tells the configured reviewers about a submitted version.
+func reviewerMail(item *models.MediaItem, v *models.MediaVersion, comment string) []mail.Message {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Version %d of %q (media item %d) has been submitted for review.\n", v.Number, v.Title, item.ID)
+	if comment = strings.TrimSpace(comment); comment != "" {
+		fmt.Fprintf(&b, "\nThe author wrote:\n\n%s\n", comment)
+	}
+
+	var messages []mail.Message
+	for _, to := range config.Config.Moderation.ReviewerEmails {
+		if to = strings.TrimSpace(to); to != "" {
+			messages = append(messages, mail.Message{To: to, Subject: "Review requested: " + v.Title, Text: b.String()})
+		}
+	}
+	return messages
+}
+
+// authorMail tells the version's author how its review went. It is sent
+// with queueUserMail, which finds their address.
+func authorMail(v *models.MediaVersion, subject, text, comment string) mail.Message {
+	if comment = strings.TrimSpace(comment); comment != "" {
+		text += "\n" + comment + "\n"
+	}
+	return mail.Message{Subject: subject, Text: text}
+}
@@ -0,0 +1,156 @@
+// media-service/pkg/services/scripture_service.go
+package services
+
+import (
+	"errors"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/scripture"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ParseScripture reads references written in the named versification
+// scheme, English by default, as canonical passages.
+func ParseScripture(text, versification string) ([]api.ScriptureReference, error) {
+	scheme, err := scriptureScheme(versification)
+	if err != nil {
+		return nil, err
+	}
+	ranges, err := scripture.Parse(text, scheme)
+	if err != nil {
+		return nil, scriptureError("q", err)
+	}
+
+	refs := make([]api.ScriptureReference, 0, len(ranges))
+	for _, r := range ranges {
+		refs = append(refs, api.ScriptureReference{
+			Reference:    r.String(),
+			OSIS:         r.OSIS(),
+			Book:         r.Book().Name,
+			StartChapter: r.Start.Chapter,
+			StartVerse:   r.Start.Verse,
+			EndChapter:   r.End.Chapter,
+			EndVerse:     r.End.Verse,
+		})
+	}
+	return refs, nil
+}
+
+// BackfillScriptureRanges indexes the passages of items tagged before
+// references were parsed, rewriting their references in canonical form.
+// Items whose references do not parse keep them as they are and are
+// logged.
+func BackfillScriptureRanges() error {
+	var items []models.MediaItem
+	result := config.DB.
+		Where("scripture_refs <> '[]'::jsonb").
+		Where("NOT EXISTS (SELECT 1 FROM scripture_ranges WHERE scripture_ranges.media_id = media_items.id)").
+		FindInBatches(&items, 200, func(*gorm.DB, int) error {
+			for i := range items {
+				item := &items[i]
+				refs, ranges, err := parseScriptureRefs(item.ScriptureRefs, "")
+				if err != nil {
+					config.Log.WithError(err).WithField("media_id", item.ID).Warn("Scripture references not indexed")
+					continue
+				}
+				err = config.DB.Transaction(func(tx *gorm.DB) error {
+					if err := tx.Model(item).UpdateColumn("scripture_refs", refs).Error; err != nil {
+						return err
+					}
+					if err := replaceScriptureRanges(tx, item.ID, ranges); err != nil {
+						return err
+					}
+					return publishEvent(tx, EventMediaUpdated, item.ID)
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	return result.Error
+}
+
+// parseScriptureRefs reads refs, written in the named versification
+// scheme, into canonical English references and the passages they cover.
+// One reference may name several passages, as in "John 3:16, 18".
+func parseScriptureRefs(refs []string, versification string) (models.StringList, []scripture.Range, error) {
+	scheme, err := scriptureScheme(versification)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var canonical []string
+	var ranges []scripture.Range
+	for _, ref := range cleanList(refs) {
+		parsed, err := scripture.Parse(ref, scheme)
+		if err != nil {
+			return nil, nil, scriptureError("scripture_refs", err)
+		}
+		for _, r := range parsed {
+			canonical = append(canonical, r.String())
+			ranges = append(ranges, r)
+		}
+	}
+	return cleanList(canonical), ranges, nil
+}
+
+// replaceScriptureRanges stores ranges as the passages the item covers.
+func replaceScriptureRanges(tx *gorm.DB, mediaID uint, ranges []scripture.Range) error {
+	if err := tx.Where("media_id = ?", mediaID).Delete(&models.ScriptureRange{}).Error; err != nil {
+		return err
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	rows := make([]models.ScriptureRange, 0, len(ranges))
+	for _, r := range ranges {
+		start, end := r.Keys()
+		rows = append(rows, models.ScriptureRange{MediaID: mediaID, StartKey: start, EndKey: end})
+	}
+	return tx.Create(&rows).Error
+}
+
+// scriptureOverlap selects the IDs of items covering any verse of ranges.
+func scriptureOverlap(ranges []scripture.Range) *gorm.DB {
+	overlap := config.DB
+	for i, r := range ranges {
+		start, end := r.Keys()
+		if i == 0 {
+			overlap = overlap.Where("start_key <= ? AND end_key >= ?", end, start)
+		} else {
+			overlap = overlap.Or("start_key <= ? AND end_key >= ?", end, start)
+		}
+	}
+	return config.DB.Model(&models.ScriptureRange{}).Select("media_id").Where(overlap)
+}
+
+func scriptureScheme(name string) (scripture.Scheme, error) {
+	if name == "" {
+		return scripture.English, nil
+	}
+	names := make([]string, 0, len(scripture.Schemes))
+	for _, s := range scripture.Schemes {
+		if string(s) == name {
+			return s, nil
+		}
+		names = append(names, string(s))
+	}
+	return "", apperror.Validation(apperror.FieldError{
+		Field: "versification", Code: "oneof", Message: "must be one of: " + strings.Join(names, ", "),
+	})
+}
+
+func scriptureError(field string, err error) error {
+	var parseErr *scripture.ParseError
+	if !errors.As(err, &parseErr) {
+		return err
+	}
+	return apperror.Validation(apperror.FieldError{
+		Field: field, Code: "scripture", Message: parseErr.Error(),
+	})
+}
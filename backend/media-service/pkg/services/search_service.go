@@ -0,0 +1,240 @@
+// media-service/pkg/services/search_service.go
+package services
+
+import (
+	"context"
+	"errors"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/search"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// JobIndexMedia brings an item's search document in line with the
+// catalog, removing it if the item is gone.
+const JobIndexMedia = "search.index"
+
+// SearchFilter narrows SearchMedia. Each list matches any of its values.
+type SearchFilter struct {
+	Query     string
+	Speakers  []string
+	Languages []string
+	Series    []string
+	Types     []string
+	// Names of search.DurationBands
+	Durations []string
+}
+
+// RegisterSearchIndexing keeps config.Search in sync with the catalog.
+func RegisterSearchIndexing() {
+	RegisterJobHandler(JobIndexMedia, indexMedia)
+	Subscribe(queueIndexing,
+		EventMediaCreated, EventMediaUpdated, EventMediaDeleted, EventMediaProcessed,
+		EventCaptionsChanged, EventAttachmentsChanged)
+}
+
+// SearchMedia finds the items matching filter that viewer may see, best
+// matches first unless page.Sort is search.SortNewest.
+func SearchMedia(ctx context.Context, viewer Viewer, filter SearchFilter, page Page) (*api.SearchResult, error) {
+	if config.Search == nil {
+		return nil, apperror.ErrNotEnabled.WithDetail("Search is not enabled on this server")
+	}
+
+	var fields []apperror.FieldError
+	if page.Sort != "" && page.Sort != search.SortRelevance && page.Sort != search.SortNewest {
+		fields = append(fields, apperror.FieldError{Field: "sort", Code: "oneof", Message: "must be one of: relevance, newest"})
+	}
+	for _, name := range filter.Durations {
+		if _, ok := search.Band(name); !ok {
+			names := make([]string, len(search.DurationBands))
+			for i, b := range search.DurationBands {
+				names[i] = b.Name
+			}
+			fields = append(fields, apperror.FieldError{
+				Field: "duration", Code: "oneof", Message: "must be one of: " + strings.Join(names, ", "),
+			})
+			break
+		}
+	}
+	if len(fields) > 0 {
+		return nil, apperror.Validation(fields...)
+	}
+
+	found, err := config.Search.Search(ctx, search.Query{
+		Text:      filter.Query,
+		Speakers:  filter.Speakers,
+		Languages: filter.Languages,
+		Series:    filter.Series,
+		Types:     filter.Types,
+		Durations: filter.Durations,
+		Access:    search.Access{UserID: viewer.UserID, All: viewer.IsAdmin()},
+		Sort:      page.Sort,
+		Offset:    (page.Page - 1) * page.PageSize,
+		Limit:     page.PageSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(found.Hits))
+	for i, hit := range found.Hits {
+		ids[i] = hit.MediaID
+	}
+	var items []models.MediaItem
+	if len(ids) > 0 {
+		query := config.DB.Where("id IN ?", ids)
+		if !viewer.IsAdmin() {
+			// Access rules are not indexed
+			query = whereEntitled(query, viewer)
+		}
+		if err := query.Find(&items).Error; err != nil {
+			return nil, err
+		}
+	}
+	byID := make(map[uint]*models.MediaItem, len(items))
+	for i := range items {
+		byID[items[i].ID] = &items[i]
+	}
+
+	// The index may lag behind the catalog, so the item decides
+	visible := make([]api.MediaItem, 0, len(found.Hits))
+	hits := make([]api.SearchHit, 0, len(found.Hits))
+	for _, hit := range found.Hits {
+		item, ok := byID[hit.MediaID]
+		if !ok || !viewer.CanView(item) {
+			continue
+		}
+		visible = append(visible, ToAPIMedia(item))
+		hits = append(hits, api.SearchHit{
+			Score: hit.Score,
+			Highlights: api.SearchHighlights{
+				Title:       hit.Title,
+				Description: hit.Description,
+				Transcript:  hit.Transcript,
+				Attachments: hit.Attachments,
+			},
+		})
+	}
+	AttachProgress(ctx, viewer, visible)
+	AttachAccess(ctx, viewer, visible)
+	for i := range hits {
+		hits[i].Item = visible[i]
+	}
+
+	result := &api.SearchResult{
+		Hits:           hits,
+		Facets:         make(map[string][]api.FacetCount, len(found.Facets)),
+		CorrectedQuery: found.Corrected,
+		Page:           page.Page,
+		PageSize:       page.PageSize,
+		Total:          found.Total,
+	}
+	for facet, counts := range found.Facets {
+		values := make([]api.FacetCount, 0, len(counts))
+		for _, c := range counts {
+			values = append(values, api.FacetCount{Value: c.Value, Count: c.Count})
+		}
+		result.Facets[facet] = values
+	}
+	return result, nil
+}
+
+// ReindexMedia queues every item, deleted ones included, for indexing, to
+// fill a new index or repair a stale one.
+func ReindexMedia() (int, error) {
+	if config.Search == nil {
+		return 0, apperror.ErrNotEnabled.WithDetail("Search is not enabled on this server")
+	}
+
+	var ids []uint
+	if err := config.DB.Unscoped().Model(&models.MediaItem{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	queued := 0
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			if err := queueIndexing(tx, Event{MediaID: id}); err != nil {
+				return err
+			}
+			queued++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return queued, nil
+}
+
+// queueIndexing schedules a reindex of the event's item unless one is
+// already waiting, which will pick up this change as well.
+func queueIndexing(tx *gorm.DB, event Event) error {
+	var waiting int64
+	if err := tx.Model(&models.ProcessingJob{}).
+		Where("kind = ? AND media_id = ? AND status = ?", JobIndexMedia, event.MediaID, models.JobQueued).
+		Count(&waiting).Error; err != nil {
+		return err
+	}
+	if waiting > 0 {
+		return nil
+	}
+	return EnqueueJob(tx, JobIndexMedia, event.MediaID, nil)
+}
+
+func indexMedia(ctx context.Context, job *models.ProcessingJob) error {
+	if config.Search == nil {
+		return errors.New("search is disabled")
+	}
+
+	var item models.MediaItem
+	if err := config.DB.First(&item, job.MediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return config.Search.Delete(ctx, job.MediaID)
+		}
+		return err
+	}
+
+	tracks, err := publishedCaptions(item.ID)
+	if err != nil {
+		return err
+	}
+	var transcript strings.Builder
+	for i := range tracks {
+		cues, err := trackCues(tracks[i].ID)
+		if err != nil {
+			return err
+		}
+		for _, cue := range cues {
+			transcript.WriteString(cue.Text)
+			transcript.WriteByte('\n')
+		}
+	}
+
+	attachments, err := attachmentText(item.ID)
+	if err != nil {
+		return err
+	}
+
+	return config.Search.Upsert(ctx, search.Document{
+		MediaID:         item.ID,
+		Title:           item.Title,
+		Description:     item.Description,
+		Speaker:         item.Speaker,
+		Series:          item.Series,
+		Tags:            item.Tags,
+		ScriptureRefs:   item.ScriptureRefs,
+		Language:        item.Language,
+		Type:            item.Type,
+		DurationSeconds: item.DurationSeconds,
+		Transcript:      transcript.String(),
+		Attachments:     attachments,
+		Visibility:      item.Visibility,
+		OwnerID:         item.OwnerID,
+		PublishAt:       item.PublishAt,
+		CreatedAt:       item.CreatedAt,
+	})
+}
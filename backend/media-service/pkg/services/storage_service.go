@@ -0,0 +1,451 @@
+// media-service/pkg/services/storage_service.go
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/transcode"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Storage maintenance jobs, which belong to no item
+const (
+	JobApplyLifecycle   = "storage.lifecycle"
+	JobReconcileStorage = "storage.reconcile"
+)
+
+// RegisterStorageMaintenance sets up the lifecycle and reconciliation
+// jobs.
+func RegisterStorageMaintenance() {
+	RegisterJobHandler(JobApplyLifecycle, applyLifecycle)
+	RegisterJobHandler(JobReconcileStorage, reconcileStorage)
+}
+
+// RunStorageMaintenance queues the lifecycle and reconciliation jobs every
+// interval until ctx is cancelled. A zero interval turns them off.
+func RunStorageMaintenance(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, kind := range []string{JobApplyLifecycle, JobReconcileStorage} {
+			if err := queueStorageJob(kind); err != nil {
+				config.Log.WithError(err).WithField("kind", kind).Error("failed to queue storage maintenance")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// QueueReconciliation asks for storage to be reconciled with the catalog
+// now, unless a reconciliation is already waiting or running.
+func QueueReconciliation() error {
+	return queueStorageJob(JobReconcileStorage)
+}
+
+// ListStorageMismatches returns a page of what the last reconciliation
+// found, optionally of one kind, and when it finished.
+func ListStorageMismatches(kind string, page Page) ([]models.StorageMismatch, int64, *time.Time, error) {
+	query := config.DB.Model(&models.StorageMismatch{})
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, nil, err
+	}
+	var mismatches []models.StorageMismatch
+	if err := query.
+		Order("media_id").
+		Order("key").
+		Offset((page.Page - 1) * page.PageSize).
+		Limit(page.PageSize).
+		Find(&mismatches).Error; err != nil {
+		return nil, 0, nil, err
+	}
+
+	var last models.ProcessingJob
+	err := config.DB.
+		Where("kind = ? AND status = ?", JobReconcileStorage, models.JobDone).
+		Order("finished_at DESC").
+		First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, nil, err
+	}
+	return mismatches, total, last.FinishedAt, nil
+}
+
+// storeOriginal copies an uploaded or recorded file into content-addressed
+// storage and returns its key and SHA-256 digest. Content some item
+// already uses is not stored twice.
+func storeOriginal(ctx context.Context, f *os.File, size int64, contentType string) (string, string, error) {
+	digest := sha256.New()
+	if _, err := io.Copy(digest, io.NewSectionReader(f, 0, size)); err != nil {
+		return "", "", err
+	}
+	sum := hex.EncodeToString(digest.Sum(nil))
+	key := storage.ContentKey(sum)
+
+	// Only trust a blob an item points at: an unused one may be about to
+	// be removed by the lifecycle rules, and storing it again restarts its
+	// grace period
+	var users int64
+	if err := config.DB.Model(&models.MediaItem{}).
+		Where("source_key = ?", key).
+		Count(&users).Error; err != nil {
+		return "", "", err
+	}
+	if users > 0 {
+		info, err := config.Storage.Stat(ctx, key)
+		if err == nil && info.Size == size {
+			return key, sum, nil
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return "", "", err
+		}
+	}
+
+	if err := storage.PutFile(ctx, config.Storage, key, f, size, contentType, config.Config.Storage.PartSize); err != nil {
+		return "", "", err
+	}
+	return key, sum, nil
+}
+
+// presignedSource returns a presigned storage URL downloading the item's
+// original, or storage.ErrPresignUnsupported.
+func presignedSource(ctx context.Context, id uint) (string, error) {
+	var item models.MediaItem
+	if err := config.DB.Select("id", "source_key", "source_content_type").First(&item, id).Error; err != nil {
+		return "", err
+	}
+	return config.Storage.PresignGet(ctx, item.SourceKey, config.Config.Streaming.URLTTL,
+		defaultDownloadName(item.ID, item.SourceContentType))
+}
+
+func queueStorageJob(kind string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var pending int64
+		if err := tx.Model(&models.ProcessingJob{}).
+			Where("kind = ? AND status IN ?", kind, []string{models.JobQueued, models.JobProcessing}).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return nil
+		}
+		return EnqueueJob(tx, kind, 0, nil)
+	})
+}
+
+// applyLifecycle removes files nothing needs any more: everything stored
+// for items and attachments deleted more than the grace period ago, and
+// content-addressed originals no item uses that were stored before it and
+// that no queued or running job is about to read. Replaced uploads become unused originals,
+// so they go once the grace period, which covers transcoding the
+// replacement, has passed.
+func applyLifecycle(ctx context.Context, job *models.ProcessingJob) error {
+	cutoff := time.Now().Add(-config.Config.Storage.Lifecycle.OrphanGrace)
+	log := config.Log.WithField("job_id", job.ID)
+
+	var deleted []models.MediaItem
+	if err := config.DB.Unscoped().
+		Select("id").
+		Where("deleted_at < ?", cutoff).
+		Where("source_key <> '' OR hls_prefix <> '' OR images_prefix <> '' OR poster_prefix <> ''").
+		Find(&deleted).Error; err != nil {
+		return err
+	}
+	for _, item := range deleted {
+		// Content-addressed originals may have other users; the next rule
+		// removes them once they have none
+		if err := storage.DeletePrefix(ctx, config.Storage, fmt.Sprintf("media/%d/", item.ID)); err != nil {
+			return err
+		}
+		if err := config.DB.Unscoped().Model(&item).UpdateColumns(map[string]interface{}{
+			"source_key":    "",
+			"hls_prefix":    "",
+			"images_prefix": "",
+			"poster_prefix": "",
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	attachments, err := removeAttachments(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+
+	blobs, err := config.Storage.List(ctx, storage.ContentPrefix)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	for _, blob := range blobs {
+		if blob.ModTime.After(cutoff) {
+			continue
+		}
+		var users int64
+		if err := config.DB.Unscoped().Model(&models.MediaItem{}).
+			Where("source_key = ?", blob.Key).
+			Count(&users).Error; err != nil {
+			return err
+		}
+		if users == 0 {
+			if err := config.DB.Model(&models.ProcessingJob{}).
+				Where("status IN ? AND payload->>'source_key' = ?",
+					[]string{models.JobQueued, models.JobProcessing}, blob.Key).
+				Count(&users).Error; err != nil {
+				return err
+			}
+		}
+		if users > 0 {
+			continue
+		}
+		if err := config.Storage.Delete(ctx, blob.Key); err != nil {
+			return err
+		}
+		removed++
+	}
+
+	if len(deleted) > 0 || attachments > 0 || removed > 0 {
+		log.WithFields(map[string]interface{}{
+			"deleted_media": len(deleted),
+			"attachments":   attachments,
+			"blobs":         removed,
+		}).Info("removed orphaned media files")
+	}
+	return nil
+}
+
+// reconcileStorage compares the catalog with the blob store and records
+// what disagrees, replacing the previous run's findings: originals and
+// master playlists the catalog points at that are missing, originals of
+// the wrong size, the same for attachments, and objects older than the
+// lifecycle grace period that nothing points at.
+func reconcileStorage(ctx context.Context, job *models.ProcessingJob) error {
+	cutoff := time.Now().Add(-config.Config.Storage.Lifecycle.OrphanGrace)
+	var found []models.StorageMismatch
+
+	var items []models.MediaItem
+	if err := config.DB.Unscoped().
+		Select("id", "deleted_at", "source_key", "source_size", "processing_status", "hls_prefix", "images_prefix", "poster_prefix").
+		Find(&items).Error; err != nil {
+		return err
+	}
+	live := make(map[uint]*models.MediaItem, len(items))
+	used := make(map[string]bool)
+	for i := range items {
+		item := &items[i]
+		if item.SourceKey != "" {
+			used[item.SourceKey] = true
+		}
+		if item.DeletedAt.Valid {
+			continue
+		}
+		live[item.ID] = item
+
+		if item.SourceKey != "" {
+			info, err := config.Storage.Stat(ctx, item.SourceKey)
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				found = append(found, models.StorageMismatch{
+					Kind: models.MismatchMissing, MediaID: item.ID, Key: item.SourceKey, ExpectedSize: item.SourceSize,
+				})
+			case err != nil:
+				return err
+			case info.Size != item.SourceSize:
+				found = append(found, models.StorageMismatch{
+					Kind: models.MismatchSize, MediaID: item.ID, Key: item.SourceKey,
+					Size: info.Size, ExpectedSize: item.SourceSize,
+				})
+			}
+		}
+		if item.ProcessingStatus == models.ProcessingReady && item.HLSPrefix != "" {
+			key := item.HLSPrefix + transcode.MasterPlaylist
+			if _, err := config.Storage.Stat(ctx, key); errors.Is(err, storage.ErrNotFound) {
+				found = append(found, models.StorageMismatch{Kind: models.MismatchMissing, MediaID: item.ID, Key: key})
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	blobs, err := config.Storage.List(ctx, storage.ContentPrefix)
+	if err != nil {
+		return err
+	}
+	for _, blob := range blobs {
+		if !used[blob.Key] && blob.ModTime.Before(cutoff) {
+			found = append(found, models.StorageMismatch{Kind: models.MismatchOrphaned, Key: blob.Key, Size: blob.Size})
+		}
+	}
+
+	// Dubbed audio tracks are stored below their item's prefix
+	var tracks []models.AudioTrack
+	if err := config.DB.Select("media_id", "source_key", "hls_prefix").Find(&tracks).Error; err != nil {
+		return err
+	}
+	trackKeys := make(map[uint][]string)
+	for _, t := range tracks {
+		trackKeys[t.MediaID] = append(trackKeys[t.MediaID], t.SourceKey, t.HLSPrefix)
+	}
+
+	objects, err := config.Storage.List(ctx, "media/")
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if obj.ModTime.After(cutoff) {
+			// Possibly written by a job that has not committed yet
+			continue
+		}
+		id, ok := idFromKey(obj.Key, "media/")
+		item := live[id]
+		if ok && item != nil && (obj.Key == item.SourceKey ||
+			hasPrefix(obj.Key, item.HLSPrefix) || hasPrefix(obj.Key, item.ImagesPrefix) || hasPrefix(obj.Key, item.PosterPrefix) ||
+			hasAnyPrefix(obj.Key, trackKeys[id])) {
+			continue
+		}
+		found = append(found, models.StorageMismatch{Kind: models.MismatchOrphaned, MediaID: id, Key: obj.Key, Size: obj.Size})
+	}
+
+	attachments, err := reconcileAttachments(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	found = append(found, attachments...)
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&models.StorageMismatch{}).Error; err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(found, 500).Error
+	})
+	if err != nil {
+		return err
+	}
+	if len(found) > 0 {
+		config.Log.WithFields(map[string]interface{}{
+			"job_id":     job.ID,
+			"mismatches": len(found),
+		}).Warn("storage does not match the catalog")
+	}
+	return nil
+}
+
+// reconcileAttachments finds attachment files that are missing or of the
+// wrong size, and objects under the attachments' prefix older than cutoff
+// that no attachment points at.
+func reconcileAttachments(ctx context.Context, cutoff time.Time) ([]models.StorageMismatch, error) {
+	var found []models.StorageMismatch
+
+	var attachments []models.Attachment
+	if err := config.DB.Select("id", "media_id", "key", "size", "preview_prefix").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	live := make(map[uint]*models.Attachment, len(attachments))
+	for i := range attachments {
+		a := &attachments[i]
+		live[a.ID] = a
+		if a.Key == "" {
+			continue
+		}
+		info, err := config.Storage.Stat(ctx, a.Key)
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			found = append(found, models.StorageMismatch{
+				Kind: models.MismatchMissing, MediaID: attachmentMediaID(a), Key: a.Key, ExpectedSize: a.Size,
+			})
+		case err != nil:
+			return nil, err
+		case info.Size != a.Size:
+			found = append(found, models.StorageMismatch{
+				Kind: models.MismatchSize, MediaID: attachmentMediaID(a), Key: a.Key,
+				Size: info.Size, ExpectedSize: a.Size,
+			})
+		}
+	}
+
+	objects, err := config.Storage.List(ctx, "attachments/")
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if obj.ModTime.After(cutoff) {
+			continue
+		}
+		id, ok := idFromKey(obj.Key, "attachments/")
+		a := live[id]
+		if ok && a != nil && (obj.Key == a.Key || hasPrefix(obj.Key, a.PreviewPrefix)) {
+			continue
+		}
+		var mediaID uint
+		if a != nil {
+			mediaID = attachmentMediaID(a)
+		}
+		found = append(found, models.StorageMismatch{Kind: models.MismatchOrphaned, MediaID: mediaID, Key: obj.Key, Size: obj.Size})
+	}
+	return found, nil
+}
+
+// idFromKey reads the ID after prefix from a key such as
+// "media/42/hls/7/..." or "attachments/9/source.pdf".
+func idFromKey(key, prefix string) (uint, bool) {
+	rest, ok := strings.CutPrefix(key, prefix)
+	if !ok {
+		return 0, false
+	}
+	id, _, _ := strings.Cut(rest, "/")
+	n, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return 0, false
+	}
+	return uint(n), true
+}
+
+func hasPrefix(key, prefix string) bool {
+	return prefix != "" && strings.HasPrefix(key, prefix)
+}
+
+func hasAnyPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if hasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultDownloadName(mediaID uint, contentType string) string {
+	name := fmt.Sprintf("media-%d", mediaID)
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		name += exts[0]
+	}
+	return name
+}
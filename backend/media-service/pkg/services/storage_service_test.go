@@ -0,0 +1,317 @@
+// media-service/pkg/services/storage_service_test.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/testenv"
+	"testing"
+	"time"
+)
+
+// countingStore counts writes, to tell a reused blob from a stored one.
+type countingStore struct {
+	storage.BlobStore
+	puts, multiparts int
+}
+
+func (s *countingStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	s.puts++
+	return s.BlobStore.Put(ctx, key, r, size, contentType)
+}
+
+func (s *countingStore) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	s.multiparts++
+	return s.BlobStore.CreateMultipart(ctx, key, contentType)
+}
+
+// agedStore lists every object as stored two days ago unless it is fresh,
+// so the lifecycle grace period can be tested without waiting for it.
+type agedStore struct {
+	storage.BlobStore
+	fresh map[string]bool
+}
+
+func (s *agedStore) List(ctx context.Context, prefix string) ([]storage.Info, error) {
+	objects, err := s.BlobStore.List(ctx, prefix)
+	for i := range objects {
+		if !s.fresh[objects[i].Key] {
+			objects[i].ModTime = time.Now().Add(-48 * time.Hour)
+		}
+	}
+	return objects, err
+}
+
+func setupAgedStorage(t *testing.T) *agedStore {
+	t.Helper()
+	testenv.Setup(t)
+	store := &agedStore{BlobStore: config.Storage, fresh: map[string]bool{}}
+	config.Storage = store
+	config.Config.Storage.Lifecycle.OrphanGrace = time.Hour
+	return store
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func putObject(t *testing.T, key string, data []byte) {
+	t.Helper()
+	if err := config.Storage.Put(context.Background(), key, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+}
+
+// putBlob stores data content-addressed and returns its key.
+func putBlob(t *testing.T, data string) string {
+	t.Helper()
+	key := storage.ContentKey(sha256Hex([]byte(data)))
+	putObject(t, key, []byte(data))
+	return key
+}
+
+func objectExists(t *testing.T, key string) bool {
+	t.Helper()
+	_, err := config.Storage.Stat(context.Background(), key)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("stat %s: %v", key, err)
+	}
+	return err == nil
+}
+
+func createStoredMedia(t *testing.T, sourceKey string, size int64) *models.MediaItem {
+	t.Helper()
+	item := &models.MediaItem{
+		Title:      "The Prodigal Son",
+		Type:       models.MediaTypeAudio,
+		OwnerID:    7,
+		SourceKey:  sourceKey,
+		SourceSize: size,
+	}
+	if err := config.DB.Create(item).Error; err != nil {
+		t.Fatalf("create media: %v", err)
+	}
+	return item
+}
+
+func deleteMediaAt(t *testing.T, item *models.MediaItem, at time.Time) {
+	t.Helper()
+	if err := config.DB.Model(item).UpdateColumn("deleted_at", at).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreOriginalDeduplicates(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	store := &countingStore{BlobStore: config.Storage}
+	config.Storage = store
+
+	content := []byte("Blessed are the peacemakers, for they shall be called children of God.")
+	name := filepath.Join(t.TempDir(), "upload")
+	if err := os.WriteFile(name, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	size := int64(len(content))
+	sum := sha256Hex(content)
+
+	store1 := func(want int) string {
+		t.Helper()
+		key, gotSum, err := storeOriginal(ctx, f, size, "audio/mpeg")
+		if err != nil {
+			t.Fatalf("store: %v", err)
+		}
+		if key != storage.ContentKey(sum) || gotSum != sum {
+			t.Fatalf("stored as %q with digest %q", key, gotSum)
+		}
+		if store.puts != want {
+			t.Fatalf("%d puts, want %d", store.puts, want)
+		}
+		return key
+	}
+
+	key := store1(1)
+	// No item uses the blob, so it is stored again rather than trusted
+	store1(2)
+
+	createStoredMedia(t, key, size)
+	store1(2)
+
+	// A lost or truncated blob is replaced even though an item uses it
+	if err := store.BlobStore.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	store1(3)
+	if err := store.BlobStore.Put(ctx, key, bytes.NewReader(content[:10]), 10, ""); err != nil {
+		t.Fatal(err)
+	}
+	store1(4)
+	if info, err := store.Stat(ctx, key); err != nil || info.Size != size {
+		t.Errorf("blob after repair: %+v, err %v", info, err)
+	}
+
+	// Large originals go up in parts
+	config.Config.Storage.PartSize = 16
+	if err := store.BlobStore.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	store1(4)
+	if store.multiparts != 1 {
+		t.Errorf("%d multipart uploads, want 1", store.multiparts)
+	}
+	obj, err := store.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer obj.Close()
+	if got, _ := io.ReadAll(obj); !bytes.Equal(got, content) {
+		t.Errorf("multipart upload stored %q", got)
+	}
+}
+
+func TestApplyLifecycle(t *testing.T) {
+	store := setupAgedStorage(t)
+	ctx := context.Background()
+
+	used := putBlob(t, "used by a live item")
+	live := createStoredMedia(t, used, 19)
+	liveMaster := fmt.Sprintf("media/%d/hls/4/master.m3u8", live.ID)
+	putObject(t, liveMaster, []byte("#EXTM3U\n"))
+
+	// Deleted within the grace period: may still be restored
+	restorable := putBlob(t, "deleted ten minutes ago")
+	recent := createStoredMedia(t, restorable, 19)
+	deleteMediaAt(t, recent, time.Now().Add(-10*time.Minute))
+
+	gone := putBlob(t, "deleted long ago")
+	old := createStoredMedia(t, gone, 16)
+	oldRenditions := fmt.Sprintf("media/%d/hls/2/", old.ID)
+	putObject(t, oldRenditions+"master.m3u8", []byte("#EXTM3U\n"))
+	config.DB.Model(old).UpdateColumn("hls_prefix", oldRenditions)
+	deleteMediaAt(t, old, time.Now().Add(-2*time.Hour))
+
+	unused := putBlob(t, "replaced upload")
+	fresh := putBlob(t, "uploaded a minute ago")
+	store.fresh[fresh] = true
+	queued := putBlob(t, "waiting for its job")
+	if err := EnqueueJob(config.DB, JobProcessMedia, live.ID, ProcessMediaJob{SourceKey: queued}); err != nil {
+		t.Fatal(err)
+	}
+	finished := putBlob(t, "its job already ran")
+	if err := config.DB.Create(&models.ProcessingJob{
+		Kind: JobProcessMedia, MediaID: live.ID, Status: models.JobDone,
+		Payload: fmt.Sprintf(`{"source_key": %q}`, finished),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := applyLifecycle(ctx, &models.ProcessingJob{}); err != nil {
+		t.Fatalf("lifecycle: %v", err)
+	}
+
+	for _, key := range []string{used, restorable, fresh, queued, liveMaster} {
+		if !objectExists(t, key) {
+			t.Errorf("%s removed", key)
+		}
+	}
+	for _, key := range []string{gone, unused, finished, oldRenditions + "master.m3u8"} {
+		if objectExists(t, key) {
+			t.Errorf("%s kept", key)
+		}
+	}
+
+	var cleared models.MediaItem
+	if err := config.DB.Unscoped().First(&cleared, old.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cleared.SourceKey != "" || cleared.HLSPrefix != "" {
+		t.Errorf("deleted item still points at %q and %q", cleared.SourceKey, cleared.HLSPrefix)
+	}
+}
+
+func TestReconcileStorage(t *testing.T) {
+	store := setupAgedStorage(t)
+	ctx := context.Background()
+
+	intact := createStoredMedia(t, putBlob(t, "intact"), 6)
+	intactRenditions := fmt.Sprintf("media/%d/hls/1/", intact.ID)
+	putObject(t, intactRenditions+"master.m3u8", []byte("#EXTM3U\n"))
+	config.DB.Model(intact).UpdateColumns(map[string]interface{}{
+		"hls_prefix":        intactRenditions,
+		"processing_status": models.ProcessingReady,
+	})
+	stale := fmt.Sprintf("media/%d/hls/0/index.m3u8", intact.ID)
+	putObject(t, stale, []byte("#EXTM3U\n"))
+
+	lostKey := storage.ContentKey(sha256Hex([]byte("never stored")))
+	lost := createStoredMedia(t, lostKey, 12)
+	shortKey := putBlob(t, "short")
+	short := createStoredMedia(t, shortKey, 999)
+	unpackaged := createStoredMedia(t, putBlob(t, "unpackaged"), 10)
+	config.DB.Model(unpackaged).UpdateColumns(map[string]interface{}{
+		"hls_prefix":        fmt.Sprintf("media/%d/hls/3/", unpackaged.ID),
+		"processing_status": models.ProcessingReady,
+	})
+	unpackagedMaster := fmt.Sprintf("media/%d/hls/3/master.m3u8", unpackaged.ID)
+
+	orphan := putBlob(t, "orphan")
+	store.fresh[putBlob(t, "still uploading")] = true
+	putObject(t, "media/999/source", []byte("gone"))
+
+	// Findings of the previous run are replaced
+	config.DB.Create(&models.StorageMismatch{Kind: models.MismatchMissing, Key: "media/1/old"})
+
+	before, _ := config.Storage.List(ctx, "")
+	if err := reconcileStorage(ctx, &models.ProcessingJob{}); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+
+	want := map[string]models.StorageMismatch{
+		lostKey:            {Kind: models.MismatchMissing, MediaID: lost.ID, Key: lostKey, ExpectedSize: 12},
+		shortKey:           {Kind: models.MismatchSize, MediaID: short.ID, Key: shortKey, Size: 5, ExpectedSize: 999},
+		unpackagedMaster:   {Kind: models.MismatchMissing, MediaID: unpackaged.ID, Key: unpackagedMaster},
+		orphan:             {Kind: models.MismatchOrphaned, Key: orphan, Size: 6},
+		stale:              {Kind: models.MismatchOrphaned, MediaID: intact.ID, Key: stale, Size: 8},
+		"media/999/source": {Kind: models.MismatchOrphaned, MediaID: 999, Key: "media/999/source", Size: 4},
+	}
+	var found []models.StorageMismatch
+	if err := config.DB.Find(&found).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range found {
+		w, ok := want[m.Key]
+		if !ok {
+			t.Errorf("unexpected mismatch %+v", m)
+			continue
+		}
+		if m.Kind != w.Kind || m.MediaID != w.MediaID || m.Size != w.Size || m.ExpectedSize != w.ExpectedSize {
+			t.Errorf("%s: got %+v, want %+v", m.Key, m, w)
+		}
+		delete(want, m.Key)
+	}
+	for key := range want {
+		t.Errorf("mismatch for %s not found", key)
+	}
+
+	// Reconciling only reports; it never removes anything
+	after, _ := config.Storage.List(ctx, "")
+	if len(after) != len(before) {
+		t.Errorf("%d objects before reconciling, %d after", len(before), len(after))
+	}
+}
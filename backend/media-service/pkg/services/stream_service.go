@@ -0,0 +1,376 @@
+// media-service/pkg/services/stream_service.go
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"path"
+	"shepherdsfold/media-service/pkg/api"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/transcode"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StreamGrant is what a valid stream token vouches for.
+type StreamGrant struct {
+	MediaID   uint
+	UserID    uint
+	ExpiresAt time.Time
+}
+
+// StreamFile is an open stored file ready to be served.
+type StreamFile struct {
+	Object      storage.Object
+	Name        string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+	ExpiresAt   time.Time
+	// Suggested file name when saved as an attachment
+	DownloadName string
+}
+
+// ParseQuality validates a quality query parameter, defaulting to auto.
+func ParseQuality(quality string) (string, error) {
+	switch quality {
+	case "", api.QualityAuto:
+		return api.QualityAuto, nil
+	case api.QualityDataSaver:
+		return api.QualityDataSaver, nil
+	default:
+		return "", apperror.Validation(apperror.FieldError{
+			Field: "quality", Code: "oneof", Message: "must be one of: auto, datasaver",
+		})
+	}
+}
+
+// Playback signs stream URLs for an item the viewer may see. In data-saver
+// mode only the renditions and downloads marked DataSaver are offered. The
+// viewer's preferred language picks the audio and captions the HLS stream
+// starts with.
+func Playback(ctx context.Context, viewer Viewer, id uint, quality string) (*api.Playback, error) {
+	item, err := GetMedia(viewer, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkEmbargo(viewer, item); err != nil {
+		return nil, err
+	}
+	access, err := requireUnlocked(ctx, viewer, item)
+	if err != nil {
+		return nil, err
+	}
+	if item.SourceKey == "" {
+		return nil, apperror.ErrNotReady.WithDetail("No file has been uploaded for this item")
+	}
+
+	dataSaver := quality == api.QualityDataSaver
+	expires := time.Now().Add(config.Config.Streaming.URLTTL).Truncate(time.Second)
+	// Links must not outlive the viewer's access
+	if access != nil && access.AvailableUntil != nil && access.AvailableUntil.Before(expires) {
+		expires = access.AvailableUntil.Truncate(time.Second)
+	}
+	base := StreamBaseURL(item.ID, SignStream(item.ID, viewer.UserID, expires))
+	seconds := float64(item.DurationSeconds)
+
+	playback := &api.Playback{
+		Quality:     quality,
+		Renditions:  []api.Rendition{},
+		Downloads:   []api.Download{},
+		AudioTracks: []api.AudioLanguage{},
+		Captions:    []api.Caption{},
+		ExpiresAt:   expires,
+	}
+	if !dataSaver {
+		playback.SourceURL = base + "/source"
+		playback.SourceBytes = item.SourceSize
+	}
+
+	tracks, err := publishedCaptions(item.ID)
+	if err != nil {
+		return nil, err
+	}
+	languages, err := chooseLanguages(item, viewer.Language, tracks)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tracks {
+		playback.Captions = append(playback.Captions, api.Caption{
+			Language: tracks[i].Language,
+			Label:    tracks[i].Label,
+			Default:  languages.caption == i,
+			URL:      base + "/" + captionStreamPath(&tracks[i]),
+		})
+	}
+	// Until it is packaged, the item can only be heard as uploaded
+	playback.Language = item.Language
+	if item.ProcessingStatus != models.ProcessingReady || item.HLSPrefix == "" {
+		return playback, nil
+	}
+	playback.Language = languages.audio
+	playback.AudioTracks = languages.audioLanguages(item, base, dataSaver)
+
+	for _, name := range item.Renditions {
+		r, ok := transcode.LookupRendition(name)
+		if !ok || (dataSaver && !r.DataSaver) {
+			continue
+		}
+		kind := "video"
+		if r.AudioOnly() {
+			kind = "audio"
+		}
+		playback.Renditions = append(playback.Renditions, api.Rendition{
+			Name:           r.Name,
+			Kind:           kind,
+			Height:         r.Height,
+			BitrateKbps:    r.Bitrate(),
+			DataSaver:      r.DataSaver,
+			EstimatedBytes: transcode.EstimatedBytes(r.Bitrate(), seconds),
+			MBPerHour:      mbPerHour(r.Bitrate()),
+			URL:            base + "/hls/" + path.Join(r.Name, transcode.VariantPlaylist),
+		})
+	}
+	for _, name := range item.Downloads {
+		f, ok := transcode.LookupAudioFile(name)
+		if !ok || (dataSaver && !f.DataSaver) {
+			continue
+		}
+		playback.Downloads = append(playback.Downloads, api.Download{
+			Name:           f.Name,
+			ContentType:    f.ContentType,
+			BitrateKbps:    f.Bitrate,
+			DataSaver:      f.DataSaver,
+			EstimatedBytes: transcode.EstimatedBytes(f.Bitrate, seconds),
+			MBPerHour:      mbPerHour(f.Bitrate),
+			URL:            base + "/" + path.Join(transcode.DownloadsDir, f.Name),
+		})
+	}
+
+	master := transcode.MasterPlaylist
+	if dataSaver {
+		master = transcode.DataSaverPlaylist
+	}
+	if len(playback.Renditions) > 0 {
+		playback.HLSURL = masterPlaylistURL(base, master, viewer.Language, languages)
+	}
+	return playback, nil
+}
+
+// DownloadURL picks the signed URL a download request should go to: the
+// original file, or in data-saver mode the audio file in the requested
+// format (an extension such as "opus" or "m4a"; m4a plays nearly everywhere,
+// so it is the default). With storage.presign_downloads the original is
+// fetched straight from storage where the driver allows it.
+func DownloadURL(ctx context.Context, viewer Viewer, id uint, quality, format string) (string, error) {
+	playback, err := Playback(ctx, viewer, id, quality)
+	if err != nil {
+		return "", err
+	}
+	if quality != api.QualityDataSaver {
+		if config.Config.Storage.PresignDownloads {
+			url, err := presignedSource(ctx, id)
+			if !errors.Is(err, storage.ErrPresignUnsupported) {
+				return url, err
+			}
+		}
+		return playback.SourceURL + "?download=1", nil
+	}
+
+	if format == "" {
+		format = "m4a"
+	}
+	for _, d := range playback.Downloads {
+		if path.Ext(d.Name) == "."+format {
+			return d.URL + "?download=1", nil
+		}
+	}
+	return "", apperror.ErrNotReady.WithDetail("No data-saver download in that format is available yet")
+}
+
+func mbPerHour(kbps int) float64 {
+	mb := float64(transcode.EstimatedBytes(kbps, 3600)) / 1e6
+	return math.Round(mb*10) / 10
+}
+
+// StreamBaseURL is the signed URL prefix for an item. The token sits in the
+// path rather than the query so relative URIs inside HLS playlists resolve
+// to URLs that still carry it.
+func StreamBaseURL(mediaID uint, token string) string {
+	return fmt.Sprintf("%s/api/media/stream/%d/%s",
+		strings.TrimRight(config.Config.Streaming.BaseURL, "/"), mediaID, token)
+}
+
+// SignStream returns a token granting userID access to mediaID's streams
+// until expires, in the form "<user>.<unix expiry>.<signature>".
+func SignStream(mediaID, userID uint, expires time.Time) string {
+	exp := expires.Unix()
+	return fmt.Sprintf("%d.%d.%s", userID, exp,
+		base64.RawURLEncoding.EncodeToString(streamSignature(mediaID, userID, exp)))
+}
+
+// VerifyStreamToken checks a token produced by SignStream for mediaID.
+func VerifyStreamToken(mediaID uint, token string) (StreamGrant, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return StreamGrant{}, apperror.ErrInvalidSignature
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 0)
+	if err != nil {
+		return StreamGrant{}, apperror.ErrInvalidSignature
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return StreamGrant{}, apperror.ErrInvalidSignature
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, streamSignature(mediaID, uint(userID), exp)) {
+		return StreamGrant{}, apperror.ErrInvalidSignature
+	}
+
+	expires := time.Unix(exp, 0)
+	if time.Now().After(expires) {
+		return StreamGrant{}, apperror.ErrLinkExpired
+	}
+	return StreamGrant{MediaID: mediaID, UserID: uint(userID), ExpiresAt: expires}, nil
+}
+
+// OpenStream verifies token and opens file for mediaID: "source" for the
+// original upload, "hls/<path>" for a packaged playlist or segment,
+// "downloads/<name>" for an audio-only download, "images/<path>" for a
+// poster, sprite sheet, thumbnail track or waveform,
+// "audio/<version>/<lang>/<path>" for a dubbed audio track's playlist or
+// segment, or "captions/<version>/<lang>.vtt" for a published caption track
+// and ".m3u8" for its subtitle playlist. Master playlists pick their default
+// audio and captions for the preferred language, which may be empty.
+func OpenStream(ctx context.Context, mediaID uint, token, file, preferred string) (*StreamFile, error) {
+	grant, err := VerifyStreamToken(mediaID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if rest, ok := strings.CutPrefix(file, "captions/"); ok {
+		f, err := openCaptionStream(mediaID, rest)
+		if err != nil {
+			return nil, err
+		}
+		f.ExpiresAt = grant.ExpiresAt
+		return f, nil
+	}
+
+	var item models.MediaItem
+	if err := config.DB.First(&item, mediaID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Media item not found")
+		}
+		return nil, err
+	}
+
+	var key, contentType, etag, downloadName string
+	switch {
+	case file == "source":
+		if item.SourceKey == "" {
+			return nil, apperror.ErrNotFound.WithDetail("No file has been uploaded for this item")
+		}
+		key, contentType = item.SourceKey, item.SourceContentType
+		if item.SourceSHA256 != "" {
+			etag = `"` + item.SourceSHA256 + `"`
+		}
+	case strings.HasPrefix(file, "hls/"):
+		rel := path.Clean("/" + strings.TrimPrefix(file, "hls/"))
+		if item.HLSPrefix == "" || rel == "/" || strings.HasPrefix(rel, "/"+transcode.DownloadsDir+"/") {
+			return nil, apperror.ErrNotFound.WithDetail("Stream not found")
+		}
+		key = item.HLSPrefix + strings.TrimPrefix(rel, "/")
+		if rel == "/"+transcode.MasterPlaylist || rel == "/"+transcode.DataSaverPlaylist {
+			f, err := openMasterPlaylist(ctx, &item, key, preferred)
+			if err != nil {
+				return nil, err
+			}
+			f.ExpiresAt = grant.ExpiresAt
+			return f, nil
+		}
+		contentType = packagedContentTypes[path.Ext(rel)]
+	case strings.HasPrefix(file, "audio/"):
+		if key, err = audioTrackKey(item.ID, strings.TrimPrefix(file, "audio/")); err != nil {
+			return nil, err
+		}
+		contentType = packagedContentTypes[path.Ext(key)]
+	case strings.HasPrefix(file, "images/"):
+		rel := path.Clean("/" + strings.TrimPrefix(file, "images/"))
+		if rel == "/" {
+			return nil, apperror.ErrNotFound.WithDetail("Image not found")
+		}
+		key = imagesRoot(item.ID) + strings.TrimPrefix(rel, "/")
+		contentType = packagedContentTypes[path.Ext(rel)]
+	case strings.HasPrefix(file, transcode.DownloadsDir+"/"):
+		name := strings.TrimPrefix(file, transcode.DownloadsDir+"/")
+		if item.HLSPrefix == "" || !slices.Contains(item.Downloads, name) {
+			return nil, apperror.ErrNotFound.WithDetail("Download not found")
+		}
+		key = item.HLSPrefix + transcode.DownloadsDir + "/" + name
+		contentType = packagedContentTypes[path.Ext(name)]
+		downloadName = fmt.Sprintf("media-%d-%s", item.ID, name)
+	default:
+		return nil, apperror.ErrNotFound.WithDetail("Stream not found")
+	}
+
+	info, err := config.Storage.Stat(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Stream not found")
+		}
+		return nil, err
+	}
+	obj, err := config.Storage.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if etag == "" {
+		// Keys are never rewritten in place, so key and size identify content
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d", key, info.Size)))
+		etag = `"` + base64.RawURLEncoding.EncodeToString(sum[:12]) + `"`
+	}
+
+	if downloadName == "" {
+		downloadName = defaultDownloadName(item.ID, contentType)
+	}
+
+	return &StreamFile{
+		Object:       obj,
+		Name:         path.Base(key),
+		Size:         info.Size,
+		ModTime:      info.ModTime,
+		ContentType:  contentType,
+		ETag:         etag,
+		ExpiresAt:    grant.ExpiresAt,
+		DownloadName: downloadName,
+	}, nil
+}
+
+func streamSignature(mediaID, userID uint, exp int64) []byte {
+	mac := hmac.New(sha256.New, []byte(config.Config.Streaming.SigningKey))
+	fmt.Fprintf(mac, "stream:%d:%d:%d", mediaID, userID, exp)
+	return mac.Sum(nil)
+}
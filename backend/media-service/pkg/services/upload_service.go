@@ -0,0 +1,394 @@
+// media-service/pkg/services/upload_service.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"strconv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChecksumAlgorithms are the tus Upload-Checksum algorithms we accept.
+var ChecksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// Checksum is a parsed Upload-Checksum header.
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ProcessMediaJob is the payload of JobProcessMedia.
+type ProcessMediaJob struct {
+	UploadID  string `json:"upload_id"`
+	SourceKey string `json:"source_key"`
+}
+
+// uploadLocks serializes PATCH requests per upload. Staging files are local
+// to this instance, so an in-process lock is sufficient.
+var uploadLocks sync.Map
+
+// CreateUpload registers a new upload of length bytes for the media item
+// named by the media_id metadata entry.
+func CreateUpload(viewer Viewer, length int64, metadata map[string]string, rawMetadata string) (*models.Upload, error) {
+	if !viewer.CanPublish() {
+		return nil, apperror.ErrForbidden.WithDetail("Only trainers and admins can upload media")
+	}
+	if maxSize := config.Config.Uploads.MaxSize; maxSize > 0 && length > maxSize {
+		return nil, apperror.ErrPayloadTooLarge.WithDetail(fmt.Sprintf("Uploads may be at most %d bytes", maxSize))
+	}
+
+	mediaID, err := strconv.ParseUint(metadata["media_id"], 10, 0)
+	if err != nil || mediaID == 0 {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field: "Upload-Metadata", Code: "required", Message: "must include the media_id of the catalog item",
+		})
+	}
+	if _, err := editableMedia(viewer, uint(mediaID)); err != nil {
+		return nil, err
+	}
+
+	id, err := newUploadID()
+	if err != nil {
+		return nil, err
+	}
+	upload := &models.Upload{
+		ID:          id,
+		OwnerID:     viewer.UserID,
+		MediaID:     uint(mediaID),
+		Length:      length,
+		Filename:    filepath.Base(metadata["filename"]),
+		ContentType: metadata["filetype"],
+		Metadata:    rawMetadata,
+		ExpiresAt:   time.Now().Add(config.Config.Uploads.Expiry),
+	}
+
+	if err := os.MkdirAll(config.Config.Uploads.StagingDir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(stagingPath(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := config.DB.Create(upload).Error; err != nil {
+		os.Remove(stagingPath(id))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// GetUpload returns an upload the viewer started.
+func GetUpload(viewer Viewer, id string) (*models.Upload, error) {
+	var upload models.Upload
+	if err := config.DB.Where("id = ?", id).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apperror.ErrNotFound.WithDetail("Upload not found")
+		}
+		return nil, err
+	}
+	if upload.OwnerID != viewer.UserID && !viewer.IsAdmin() {
+		return nil, apperror.ErrNotFound.WithDetail("Upload not found")
+	}
+	if upload.CompletedAt == nil && time.Now().After(upload.ExpiresAt) {
+		return nil, apperror.ErrUploadExpired
+	}
+	return &upload, nil
+}
+
+// AppendUpload writes body to the upload at offset. Without a checksum,
+// bytes received before a dropped connection are kept so the client can
+// resume after them; with one, a chunk is kept only if it verifies. Once the
+// last byte arrives the file is moved to storage and processing is queued.
+func AppendUpload(ctx context.Context, viewer Viewer, id string, offset int64, body io.Reader, checksum *Checksum) (*models.Upload, error) {
+	// Only uploads the viewer may write to get a lock, so unknown IDs
+	// cannot grow uploadLocks
+	if _, err := GetUpload(viewer, id); err != nil {
+		return nil, err
+	}
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, apperror.ErrUploadLocked
+	}
+	defer mu.Unlock()
+
+	// Read it again now that no other chunk can move the offset
+	upload, err := GetUpload(viewer, id)
+	if err != nil {
+		uploadLocks.Delete(id)
+		return nil, err
+	}
+	if upload.CompletedAt != nil {
+		// Finished while this request waited for the lock
+		uploadLocks.Delete(id)
+	}
+	if upload.CompletedAt != nil || offset != upload.Offset {
+		return nil, apperror.ErrOffsetMismatch.WithDetail(fmt.Sprintf("Upload is at offset %d", upload.Offset))
+	}
+
+	f, err := os.OpenFile(stagingPath(id), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = f
+	var h hash.Hash
+	if checksum != nil {
+		h = ChecksumAlgorithms[checksum.Algorithm]()
+		w = io.MultiWriter(f, h)
+	}
+
+	remaining := upload.Length - offset
+	n, copyErr := io.Copy(w, io.LimitReader(body, remaining))
+	if copyErr == nil && n == remaining {
+		// Anything beyond the declared length is a client bug
+		var extra [1]byte
+		if m, _ := body.Read(extra[:]); m > 0 {
+			copyErr = apperror.ErrPayloadTooLarge.WithDetail("Chunk extends past Upload-Length")
+		}
+	}
+
+	if checksum != nil && copyErr == nil && !bytes.Equal(h.Sum(nil), checksum.Sum) {
+		copyErr = apperror.ErrChecksumMismatch
+	}
+	// Unverifiable and oversized chunks are discarded whole
+	if copyErr != nil && (checksum != nil || errors.Is(copyErr, apperror.ErrPayloadTooLarge)) {
+		if err := f.Truncate(offset); err != nil {
+			return nil, err
+		}
+		return nil, copyErr
+	}
+
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+
+	upload.Offset = offset + n
+	upload.ExpiresAt = time.Now().Add(config.Config.Uploads.Expiry)
+	if err := config.DB.Model(upload).Updates(map[string]interface{}{
+		"upload_offset": upload.Offset,
+		"expires_at":    upload.ExpiresAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+	if copyErr != nil {
+		return upload, copyErr
+	}
+
+	if upload.Offset == upload.Length {
+		if err := finishUpload(ctx, upload); err != nil {
+			return nil, err
+		}
+		uploadLocks.Delete(id)
+	}
+	return upload, nil
+}
+
+// TerminateUpload discards an unfinished upload.
+func TerminateUpload(viewer Viewer, id string) error {
+	upload, err := GetUpload(viewer, id)
+	if err != nil && !errors.Is(err, apperror.ErrUploadExpired) {
+		return err
+	}
+	if upload != nil && upload.CompletedAt != nil {
+		return apperror.ErrConflict.WithDetail("Upload has already completed")
+	}
+	return removeUpload(id)
+}
+
+// FinishStalledUploads retries finishing uploads whose last byte arrived but
+// whose move into storage failed, and returns how many it finished. Uploads
+// a client is writing to are left alone.
+func FinishStalledUploads(ctx context.Context) (int, error) {
+	var uploads []models.Upload
+	if err := config.DB.Where("completed_at IS NULL AND upload_offset = length AND expires_at >= ?", time.Now()).
+		Find(&uploads).Error; err != nil {
+		return 0, err
+	}
+
+	finished := 0
+	for i := range uploads {
+		upload := &uploads[i]
+		lock, _ := uploadLocks.LoadOrStore(upload.ID, &sync.Mutex{})
+		mu := lock.(*sync.Mutex)
+		if !mu.TryLock() {
+			continue
+		}
+		err := finishUpload(ctx, upload)
+		mu.Unlock()
+		if err != nil {
+			config.Log.WithError(err).WithField("upload_id", upload.ID).Warn("retrying upload finish failed")
+			continue
+		}
+		uploadLocks.Delete(upload.ID)
+		finished++
+	}
+	return finished, nil
+}
+
+// ExpireUploads discards unfinished uploads that have sat idle past their
+// expiry and returns how many were removed.
+func ExpireUploads() (int, error) {
+	var ids []string
+	if err := config.DB.Model(&models.Upload{}).
+		Where("completed_at IS NULL AND expires_at < ?", time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := removeUpload(id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// RunUploadMaintenance finishes stalled uploads and expires abandoned ones
+// every interval until ctx is cancelled.
+func RunUploadMaintenance(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := FinishStalledUploads(ctx); err != nil {
+			config.Log.WithError(err).Error("finishing stalled uploads failed")
+		} else if n > 0 {
+			config.Log.WithField("count", n).Info("finished stalled uploads")
+		}
+		if n, err := ExpireUploads(); err != nil {
+			config.Log.WithError(err).Error("upload expiry failed")
+		} else if n > 0 {
+			config.Log.WithField("count", n).Info("expired abandoned uploads")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// finishUpload moves the assembled file into storage, points the media item
+// at it and queues processing.
+func finishUpload(ctx context.Context, upload *models.Upload) error {
+	f, err := os.Open(stagingPath(upload.ID))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	contentType := upload.ContentType
+	if contentType == "" {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(f, head)
+		contentType = http.DetectContentType(head[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	key, sum, err := storeOriginal(ctx, f, upload.Length, contentType)
+	if err != nil {
+		return fmt.Errorf("store upload %s: %w", upload.ID, err)
+	}
+
+	var previousKey string
+	now := time.Now()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var item models.MediaItem
+		if err := tx.Select("source_key").First(&item, upload.MediaID).Error; err != nil {
+			return err
+		}
+		previousKey = item.SourceKey
+
+		if err := tx.Model(&models.MediaItem{}).Where("id = ?", upload.MediaID).Updates(map[string]interface{}{
+			"source_key":          key,
+			"source_size":         upload.Length,
+			"source_content_type": contentType,
+			"source_sha256":       sum,
+			"processing_status":   models.ProcessingQueued,
+			"processing_error":    "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(upload).Update("completed_at", &now).Error; err != nil {
+			return err
+		}
+		return EnqueueJob(tx, JobProcessMedia, upload.MediaID, ProcessMediaJob{
+			UploadID:  upload.ID,
+			SourceKey: key,
+		})
+	})
+	if err != nil {
+		// The lifecycle rules remove the original if nothing else uses it
+		return err
+	}
+	upload.CompletedAt = &now
+
+	// Content-addressed originals are left to the lifecycle rules, which
+	// wait for the new upload to be transcoded
+	if previousKey != "" && previousKey != key && !storage.IsContentKey(previousKey) {
+		if err := config.Storage.Delete(ctx, previousKey); err != nil {
+			config.Log.WithError(err).WithField("key", previousKey).Warn("failed to remove replaced source")
+		}
+	}
+	if err := os.Remove(stagingPath(upload.ID)); err != nil {
+		config.Log.WithError(err).WithField("upload_id", upload.ID).Warn("failed to remove staging file")
+	}
+	return nil
+}
+
+func removeUpload(id string) error {
+	if err := os.Remove(stagingPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	uploadLocks.Delete(id)
+	return config.DB.Where("id = ?", id).Delete(&models.Upload{}).Error
+}
+
+func stagingPath(id string) string {
+	return filepath.Join(config.Config.Uploads.StagingDir, id)
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,177 @@
+// media-service/pkg/services/upload_service_test.go
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"shepherdsfold/media-service/pkg/apperror"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"shepherdsfold/media-service/pkg/storage"
+	"shepherdsfold/media-service/pkg/testenv"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// flakyStore fails every write while down, as storage does during an
+// outage.
+type flakyStore struct {
+	storage.BlobStore
+	down bool
+}
+
+var errStorageDown = errors.New("storage unavailable")
+
+func (s *flakyStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if s.down {
+		return errStorageDown
+	}
+	return s.BlobStore.Put(ctx, key, r, size, contentType)
+}
+
+func (s *flakyStore) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	if s.down {
+		return "", errStorageDown
+	}
+	return s.BlobStore.CreateMultipart(ctx, key, contentType)
+}
+
+func createTestMedia(t *testing.T, ownerID uint) *models.MediaItem {
+	t.Helper()
+	item := &models.MediaItem{Title: "Sermon on the Mount", Type: models.MediaTypeAudio, OwnerID: ownerID}
+	if err := config.DB.Create(item).Error; err != nil {
+		t.Fatalf("create media: %v", err)
+	}
+	return item
+}
+
+func TestFinishStalledUploads(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+	store := &flakyStore{BlobStore: config.Storage, down: true}
+	config.Storage = store
+
+	trainer := Viewer{UserID: 7, Role: models.RoleTrainer}
+	item := createTestMedia(t, trainer.UserID)
+	content := bytes.Repeat([]byte("psalm 23 "), 200)
+	upload, err := CreateUpload(trainer, int64(len(content)), map[string]string{
+		"media_id": strconv.FormatUint(uint64(item.ID), 10),
+		"filetype": "audio/mpeg",
+	}, "")
+	if err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	// The last byte arrives while storage is down
+	if _, err := AppendUpload(ctx, trainer, upload.ID, 0, bytes.NewReader(content), nil); !errors.Is(err, errStorageDown) {
+		t.Fatalf("append with storage down: err %v, want %v", err, errStorageDown)
+	}
+	stalled, err := GetUpload(trainer, upload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stalled.Offset != stalled.Length || stalled.CompletedAt != nil {
+		t.Fatalf("stalled upload at %d of %d, completed %v", stalled.Offset, stalled.Length, stalled.CompletedAt)
+	}
+
+	if n, err := FinishStalledUploads(ctx); err != nil || n != 0 {
+		t.Fatalf("retry while storage is down: finished %d, err %v", n, err)
+	}
+
+	// A client still writing to the upload holds its lock
+	lock, _ := uploadLocks.LoadOrStore(upload.ID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	store.down = false
+	n, err := FinishStalledUploads(ctx)
+	lock.(*sync.Mutex).Unlock()
+	if err != nil || n != 0 {
+		t.Fatalf("retry of a locked upload: finished %d, err %v", n, err)
+	}
+
+	if n, err := FinishStalledUploads(ctx); err != nil || n != 1 {
+		t.Fatalf("retry once storage is back: finished %d, err %v", n, err)
+	}
+
+	digest := sha256.Sum256(content)
+	sum := hex.EncodeToString(digest[:])
+	var stored models.MediaItem
+	if err := config.DB.First(&stored, item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.SourceKey != storage.ContentKey(sum) || stored.SourceSHA256 != sum ||
+		stored.ProcessingStatus != models.ProcessingQueued {
+		t.Errorf("item after retry: key %q sha256 %q status %q", stored.SourceKey, stored.SourceSHA256, stored.ProcessingStatus)
+	}
+	if info, err := config.Storage.Stat(ctx, stored.SourceKey); err != nil || info.Size != int64(len(content)) {
+		t.Errorf("stored source: %+v, err %v", info, err)
+	}
+
+	var finished models.Upload
+	if err := config.DB.First(&finished, "id = ?", upload.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if finished.CompletedAt == nil {
+		t.Error("upload not marked completed")
+	}
+	var jobs int64
+	config.DB.Model(&models.ProcessingJob{}).Where("kind = ? AND media_id = ?", JobProcessMedia, item.ID).Count(&jobs)
+	if jobs != 1 {
+		t.Errorf("%d processing jobs queued, want 1", jobs)
+	}
+	if _, err := os.Stat(stagingPath(upload.ID)); !os.IsNotExist(err) {
+		t.Errorf("staging file left behind: %v", err)
+	}
+
+	if n, err := FinishStalledUploads(ctx); err != nil || n != 0 {
+		t.Errorf("second retry: finished %d, err %v", n, err)
+	}
+}
+
+func TestAppendUploadOwnershipAndOffset(t *testing.T) {
+	testenv.Setup(t)
+	ctx := context.Background()
+
+	owner := Viewer{UserID: 7, Role: models.RoleTrainer}
+	item := createTestMedia(t, owner.UserID)
+	upload, err := CreateUpload(owner, 10, map[string]string{"media_id": strconv.FormatUint(uint64(item.ID), 10)}, "")
+	if err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		viewer Viewer
+		id     string
+		offset int64
+		want   error
+	}{
+		{"another trainer", Viewer{UserID: 8, Role: models.RoleTrainer}, upload.ID, 0, apperror.ErrNotFound},
+		{"unknown upload", owner, "0123456789abcdef", 0, apperror.ErrNotFound},
+		{"ahead of the offset", owner, upload.ID, 5, apperror.ErrOffsetMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AppendUpload(ctx, tt.viewer, tt.id, tt.offset, bytes.NewReader([]byte("abc")), nil)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// Refused writers must not leave locks behind for IDs they named
+	if _, ok := uploadLocks.Load("0123456789abcdef"); ok {
+		t.Error("unknown upload got a lock")
+	}
+
+	// An admin may resume it
+	admin := Viewer{UserID: 1, Role: models.RoleAdmin}
+	if got, err := AppendUpload(ctx, admin, upload.ID, 0, bytes.NewReader([]byte("abc")), nil); err != nil || got.Offset != 3 {
+		t.Fatalf("admin append: %+v, err %v", got, err)
+	}
+}
@@ -0,0 +1,184 @@
+// media-service/pkg/services/user_event_service.go
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"shepherdsfold/media-service/pkg/config"
+	"shepherdsfold/media-service/pkg/models"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// The stream and event auth-service publishes account lifecycle events
+// with; see its api package.
+const (
+	userEventsStream = "auth:user-events"
+	eventUserDeleted = "user.deleted"
+	// How long to wait after failing to read or handle an event
+	userEventsRetryDelay = 5 * time.Second
+)
+
+// userDeletedEvent is the payload of eventUserDeleted.
+type userDeletedEvent struct {
+	UserID uint `json:"user_id"`
+}
+
+// RunUserEvents consumes auth-service's user events in the
+// users.events_group consumer group until ctx is cancelled. An event that
+// fails is retried, before any later ones, until it succeeds.
+func RunUserEvents(ctx context.Context) {
+	group := config.Config.Users.EventsGroup
+	if group == "" {
+		group = "media-service"
+	}
+	consumer, _ := os.Hostname()
+	if consumer == "" {
+		consumer = "media-service"
+	}
+
+	err := config.RedisClient.XGroupCreateMkStream(ctx, userEventsStream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		config.Log.WithError(err).Error("cannot join the user events group; deleted users will not be purged")
+		return
+	}
+
+	// Start with whatever this consumer read but never acknowledged
+	from := "0"
+	for ctx.Err() == nil {
+		streams, err := config.RedisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: consumer,
+			Streams:  []string{userEventsStream, from},
+			Count:    10,
+			Block:    5 * time.Second,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				config.Log.WithError(err).Error("reading user events failed")
+				select {
+				case <-ctx.Done():
+				case <-time.After(userEventsRetryDelay):
+				}
+			}
+			continue
+		}
+
+		failed := false
+		var messages []redis.XMessage
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+		for _, msg := range messages {
+			if err := handleUserEvent(ctx, msg); err != nil {
+				config.Log.WithError(err).WithField("event_id", msg.ID).Error("handling user event failed")
+				failed = true
+				break
+			}
+			if err := config.RedisClient.XAck(ctx, userEventsStream, group, msg.ID).Err(); err != nil {
+				config.Log.WithError(err).WithField("event_id", msg.ID).Warn("acknowledging user event failed")
+			}
+		}
+
+		switch {
+		case failed:
+			from = "0"
+			select {
+			case <-ctx.Done():
+			case <-time.After(userEventsRetryDelay):
+			}
+		case from == "0" && len(messages) == 0:
+			// Caught up on the backlog; wait for new events
+			from = ">"
+		}
+	}
+}
+
+func handleUserEvent(ctx context.Context, msg redis.XMessage) error {
+	kind, _ := msg.Values["type"].(string)
+	if kind != eventUserDeleted {
+		return nil
+	}
+	payload, _ := msg.Values["payload"].(string)
+	var event userDeletedEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil || event.UserID == 0 {
+		// Retrying cannot fix it
+		config.Log.WithError(err).WithField("event_id", msg.ID).Warn("skipping malformed user.deleted event")
+		return nil
+	}
+	return PurgeUser(ctx, event.UserID)
+}
+
+// PurgeUser forgets a deleted user. What they did as a learner goes:
+// progress, enrollments, cohort memberships, invitations, attendance and
+// unfinished uploads, and their offline licenses are revoked. What they
+// wrote stays with the catalog but no longer names them: the versions they
+// authored, reviewed or published and their review comments. Items and
+// collections they own are left to an admin to hand over, and analytics
+// keep the bare ID, which auth-service no longer links to anyone.
+func PurgeUser(ctx context.Context, userID uint) error {
+	var uploads []string
+	if err := config.DB.Model(&models.Upload{}).
+		Where("owner_id = ? AND completed_at IS NULL", userID).
+		Pluck("id", &uploads).Error; err != nil {
+		return err
+	}
+	for _, id := range uploads {
+		if err := removeUpload(id); err != nil {
+			return err
+		}
+	}
+
+	if err := purgeCachedProgress(ctx, userID); err != nil {
+		return err
+	}
+	if _, err := RevokeUserOfflineLicenses(userID, nil, "account_deleted"); err != nil {
+		return err
+	}
+
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{
+			&models.PlaybackProgress{}, &models.Enrollment{}, &models.CohortMember{},
+			&models.SessionInvitee{}, &models.SessionAttendance{},
+		} {
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, column := range []string{"author_id", "reviewer_id", "published_by"} {
+			if err := tx.Model(&models.MediaVersion{}).Where(column+" = ?", userID).
+				UpdateColumn(column, 0).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&models.ReviewComment{}).Where("author_id = ?", userID).
+			UpdateColumn("author_id", 0).Error
+	})
+}
+
+// purgeCachedProgress drops the user's progress from Redis, so the flusher
+// cannot write it back after the rows are gone.
+func purgeCachedProgress(ctx context.Context, userID uint) error {
+	iter := config.RedisClient.Scan(ctx, 0, fmt.Sprintf("progress:%d:*", userID), 500).Iterator()
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return config.RedisClient.Del(ctx, keys...).Err()
+}
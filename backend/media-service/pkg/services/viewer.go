@@ -0,0 +1,94 @@
+// media-service/pkg/services/viewer.go
+package services
+
+import (
+	"shepherdsfold/media-service/pkg/models"
+	"time"
+)
+
+// Viewer is the authenticated caller as identified by the auth-service JWT.
+// The zero value is an anonymous caller.
+type Viewer struct {
+	UserID uint
+	Role   string
+	// Preferred language from the caller's profile, as a BCP 47 tag; empty
+	// if they have not chosen one
+	Language string
+}
+
+func (v Viewer) IsAdmin() bool {
+	return v.Role == models.RoleAdmin
+}
+
+// CanPublish reports whether the viewer may add items to the catalog.
+func (v Viewer) CanPublish() bool {
+	return v.Role == models.RoleAdmin || v.Role == models.RoleTrainer
+}
+
+// CanReview reports whether the viewer may approve or reject media
+// submitted for review.
+func (v Viewer) CanReview() bool {
+	return v.IsAdmin()
+}
+
+// CanView reports whether the viewer may see item. Until a version of it
+// has been published only its editors may.
+func (v Viewer) CanView(item *models.MediaItem) bool {
+	return (item.Visibility == models.VisibilityPublic && released(item.PublishAt) && isLive(item)) || v.CanEdit(item)
+}
+
+// CanEdit reports whether the viewer may change or delete item.
+func (v Viewer) CanEdit(item *models.MediaItem) bool {
+	return v.canEditOwned(item.OwnerID)
+}
+
+func (v Viewer) canEditOwned(ownerID uint) bool {
+	if v.IsAdmin() {
+		return true
+	}
+	return v.UserID != 0 && v.UserID == ownerID && v.CanPublish()
+}
+
+// CanViewCollection reports whether the viewer may see c. Its items are
+// still subject to CanView.
+func (v Viewer) CanViewCollection(c *models.Collection) bool {
+	return (c.Visibility == models.VisibilityPublic && released(c.PublishAt)) || v.CanEditCollection(c)
+}
+
+// CanEditCollection reports whether the viewer may change c. Anyone may
+// keep playlists; series and groupings belong to trainers.
+func (v Viewer) CanEditCollection(c *models.Collection) bool {
+	if v.IsAdmin() {
+		return true
+	}
+	if v.UserID == 0 || v.UserID != c.OwnerID {
+		return false
+	}
+	return c.Kind == models.CollectionPlaylist || v.CanPublish()
+}
+
+// CanViewSession reports whether the viewer may see and watch a live
+// session.
+func (v Viewer) CanViewSession(s *models.LiveSession) bool {
+	return s.Visibility == models.VisibilityPublic || v.CanHost(s)
+}
+
+// CanHost reports whether the viewer may change a live session and see
+// its stream key.
+func (v Viewer) CanHost(s *models.LiveSession) bool {
+	if v.IsAdmin() {
+		return true
+	}
+	return v.UserID != 0 && v.UserID == s.HostID && v.CanPublish()
+}
+
+// isLive reports whether a version of item has been published.
+func isLive(item *models.MediaItem) bool {
+	return item.ReviewStatus == models.ReviewPublished || item.LiveVersion > 0
+}
+
+// released reports whether a publish-at time has passed; nil means
+// published straight away.
+func released(publishAt *time.Time) bool {
+	return publishAt == nil || !publishAt.After(time.Now())
+}
@@ -0,0 +1,31 @@
+// media-service/pkg/speech/fake.go
+package speech
+
+import (
+	"context"
+	"os"
+	"shepherdsfold/media-service/pkg/captions"
+	"time"
+)
+
+// FakeTranscriber returns fixed cues without listening to anything, for
+// tests and development machines without a speech-to-text engine.
+type FakeTranscriber struct {
+	// Returned by Transcribe; defaults to a single placeholder cue
+	Cues []captions.Cue
+	// If set, Transcribe fails with this error
+	Err error
+}
+
+func (f *FakeTranscriber) Transcribe(ctx context.Context, input, language string) ([]captions.Cue, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if _, err := os.Stat(input); err != nil {
+		return nil, err
+	}
+	if len(f.Cues) == 0 {
+		return []captions.Cue{{Start: 0, End: 5 * time.Second, Text: "[automatic captions placeholder]"}}, nil
+	}
+	return f.Cues, nil
+}
@@ -0,0 +1,99 @@
+// media-service/pkg/speech/speech.go
+//
+// Package speech drafts captions from recorded audio. Drafts are a starting
+// point for a human editor, never published as-is.
+package speech
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/captions"
+	"strings"
+)
+
+// Transcriber turns the audio of a media file into timed cues. language is
+// a BCP 47 tag; engines that detect the language may ignore it.
+type Transcriber interface {
+	Transcribe(ctx context.Context, input, language string) ([]captions.Cue, error)
+}
+
+// CommandTranscriber runs an external speech-to-text program such as
+// whisper or whisper.cpp. In Args, {input} and {language} are replaced with
+// the media file and language. If the program writes a WebVTT or SRT file,
+// pass it {output_dir} or {output}, a path in that directory without an
+// extension; otherwise captions are read from stdout.
+type CommandTranscriber struct {
+	Path string
+	Args []string
+}
+
+func NewCommandTranscriber(path string, args []string) (*CommandTranscriber, error) {
+	if path == "" {
+		return nil, errors.New("no speech-to-text command configured")
+	}
+	resolved, err := exec.LookPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return &CommandTranscriber{Path: resolved, Args: args}, nil
+}
+
+func (t *CommandTranscriber) Transcribe(ctx context.Context, input, language string) ([]captions.Cue, error) {
+	dir, err := os.MkdirTemp("", "speech-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	replacer := strings.NewReplacer(
+		"{input}", input,
+		"{language}", language,
+		"{output_dir}", dir,
+		"{output}", filepath.Join(dir, "captions"),
+	)
+	args := make([]string, len(t.Args))
+	toFile := false
+	for i, arg := range t.Args {
+		toFile = toFile || strings.Contains(arg, "{output")
+		args[i] = replacer.Replace(arg)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Path, args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(t.Path), err, lastLine(stderr.String()))
+	}
+
+	if !toFile {
+		return captions.Parse(&stdout)
+	}
+	for _, pattern := range []string{"*.vtt", "*.srt"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, pattern))
+		if len(matches) == 0 {
+			continue
+		}
+		f, err := os.Open(matches[0])
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return captions.Parse(f)
+	}
+	return nil, errors.New("speech-to-text command wrote no caption file")
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
@@ -0,0 +1,290 @@
+// media-service/pkg/storage/local.go
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps objects as files under a root directory. Content types
+// are not persisted; Stat derives them from the key's extension. Parts of
+// multipart uploads wait under root/.multipart until they are joined.
+type LocalStore struct {
+	root string
+}
+
+func NewLocalStore(root string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStore{root: root}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("storage: wrote %d bytes, expected %d", n, size)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *LocalStore) Open(ctx context.Context, key string) (Object, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (Info, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return Info{}, err
+	}
+	fi, err := os.Stat(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{
+		Key:         key,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		ModTime:     fi.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]Info, error) {
+	// Only walk the deepest directory the prefix names
+	start := s.root
+	if dir := path.Dir(path.Clean("/" + prefix + "x")); dir != "/" {
+		start = filepath.Join(s.root, filepath.FromSlash(dir))
+	}
+
+	var objects []Info
+	err := filepath.WalkDir(start, func(name string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && name == start {
+			return fs.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && name == filepath.Join(s.root, multipartDir) {
+			return fs.SkipDir
+		}
+		// Skip directories and in-flight Put temporaries
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".put-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Info{
+			Key:         key,
+			Size:        fi.Size(),
+			ContentType: mime.TypeByExtension(path.Ext(key)),
+			ModTime:     fi.ModTime(),
+		})
+		return nil
+	})
+	return objects, err
+}
+
+// multipartDir holds the parts of unfinished multipart uploads, one
+// directory per upload.
+const multipartDir = ".multipart"
+
+func (s *LocalStore) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(id)
+	if err := os.MkdirAll(filepath.Join(s.root, multipartDir, uploadID), 0o755); err != nil {
+		return "", err
+	}
+	return uploadID, nil
+}
+
+func (s *LocalStore) UploadPart(ctx context.Context, key, uploadID string, n int, r io.Reader, size int64) (Part, error) {
+	dir, err := s.multipartPath(uploadID)
+	if err != nil {
+		return Part{}, err
+	}
+	if n < 1 {
+		return Part{}, fmt.Errorf("storage: invalid part number %d", n)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".put-*")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Part{}, ErrNotFound
+		}
+		return Part{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	digest := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, digest), r)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("storage: wrote %d bytes, expected %d", written, size)
+	}
+	if err != nil {
+		tmp.Close()
+		return Part{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Part{}, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(n))); err != nil {
+		return Part{}, err
+	}
+	return Part{Number: n, ETag: hex.EncodeToString(digest.Sum(nil)), Size: written}, nil
+}
+
+func (s *LocalStore) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	dir, err := s.multipartPath(uploadID)
+	if err != nil {
+		return err
+	}
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = func() error {
+		for _, part := range parts {
+			f, err := os.Open(filepath.Join(dir, strconv.Itoa(part.Number)))
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("storage: part %d of upload %s was not uploaded", part.Number, uploadID)
+			}
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(tmp, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+			if n != part.Size {
+				return fmt.Errorf("storage: part %d of upload %s has %d bytes, expected %d", part.Number, uploadID, n, part.Size)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStore) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	dir, err := s.multipartPath(uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// PresignGet is unsupported: local files are only reachable through the
+// service.
+func (s *LocalStore) PresignGet(ctx context.Context, key string, ttl time.Duration, downloadName string) (string, error) {
+	return "", ErrPresignUnsupported
+}
+
+func (s *LocalStore) multipartPath(uploadID string) (string, error) {
+	if _, err := hex.DecodeString(uploadID); err != nil || uploadID == "" {
+		return "", fmt.Errorf("storage: invalid upload ID %q", uploadID)
+	}
+	return filepath.Join(s.root, multipartDir, uploadID), nil
+}
+
+// path maps key below the root. Cleaning it as an absolute path first means
+// ".." segments can never climb out of the root.
+func (s *LocalStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,184 @@
+// media-service/pkg/storage/s3.go
+package storage
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+type S3Config struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+	// Host clients reach the bucket on, when Endpoint is only reachable
+	// from inside the deployment; presigned URLs are signed for it. Set
+	// Region too, or signing asks the bucket for it.
+	PublicEndpoint string
+}
+
+// S3Store keeps objects in an S3-compatible bucket: AWS S3, or MinIO in
+// development.
+type S3Store struct {
+	client *minio.Client
+	// Signs presigned URLs for the public endpoint
+	presigner *minio.Client
+	bucket    string
+}
+
+// NewS3Store connects to the endpoint and creates the bucket if it does not
+// exist yet.
+func NewS3Store(ctx context.Context, cfg S3Config) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	presigner := client
+	if cfg.PublicEndpoint != "" {
+		presigner, err = minio.New(cfg.PublicEndpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+			Secure: cfg.UseSSL,
+			Region: cfg.Region,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Store{client: client, presigner: presigner, bucket: cfg.Bucket}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (Object, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, mapS3Error(err)
+	}
+	// GetObject is lazy; stat now so a missing key fails here, not on Read
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, mapS3Error(err)
+	}
+	return obj, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (Info, error) {
+	oi, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Info{}, mapS3Error(err)
+	}
+	return Info{
+		Key:         key,
+		Size:        oi.Size,
+		ContentType: oi.ContentType,
+		ModTime:     oi.LastModified,
+	}, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	return mapS3Error(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Info, error) {
+	var objects []Info
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, Info{
+			Key:         obj.Key,
+			Size:        obj.Size,
+			ContentType: obj.ContentType,
+			ModTime:     obj.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+func (s *S3Store) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	core := minio.Core{Client: s.client}
+	return core.NewMultipartUpload(ctx, s.bucket, key, minio.PutObjectOptions{ContentType: contentType})
+}
+
+func (s *S3Store) UploadPart(ctx context.Context, key, uploadID string, n int, r io.Reader, size int64) (Part, error) {
+	core := minio.Core{Client: s.client}
+	part, err := core.PutObjectPart(ctx, s.bucket, key, uploadID, n, r, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return Part{}, mapS3Error(err)
+	}
+	return Part{Number: part.PartNumber, ETag: part.ETag, Size: part.Size}, nil
+}
+
+func (s *S3Store) CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error {
+	core := minio.Core{Client: s.client}
+	complete := make([]minio.CompletePart, 0, len(parts))
+	for _, p := range parts {
+		complete = append(complete, minio.CompletePart{PartNumber: p.Number, ETag: p.ETag})
+	}
+	_, err := core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, complete, minio.PutObjectOptions{})
+	return mapS3Error(err)
+}
+
+func (s *S3Store) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	err := core.AbortMultipartUpload(ctx, s.bucket, key, uploadID)
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return nil
+	}
+	return err
+}
+
+func (s *S3Store) PresignGet(ctx context.Context, key string, ttl time.Duration, downloadName string) (string, error) {
+	params := url.Values{}
+	if downloadName != "" {
+		params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	}
+	u, err := s.presigner.PresignedGetObject(ctx, s.bucket, key, ttl, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func mapS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchUpload":
+		return ErrNotFound
+	}
+	return err
+}
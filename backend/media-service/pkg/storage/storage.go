@@ -0,0 +1,141 @@
+// media-service/pkg/storage/storage.go
+//
+// Package storage abstracts where media bytes live. Keys are slash-separated
+// paths such as "media/42/source/<upload>"; backends map them onto a
+// directory tree or an S3 bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("storage: object not found")
+	// Returned by PresignGet when the backend cannot hand out direct URLs;
+	// callers serve the object themselves instead
+	ErrPresignUnsupported = errors.New("storage: presigned URLs not supported")
+)
+
+// Object is an open stored object. Both backends support seeking so objects
+// can be served with byte ranges.
+type Object interface {
+	io.ReadSeekCloser
+}
+
+type Info struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	// From 1
+	Number int
+	ETag   string
+	Size   int64
+}
+
+// BlobStore is where media bytes live.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any existing
+	// object. size may be -1 if unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (Object, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Info, error)
+
+	// CreateMultipart starts an upload to key assembled from parts, and
+	// returns its upload ID. Nothing is visible under key until
+	// CompleteMultipart.
+	CreateMultipart(ctx context.Context, key, contentType string) (string, error)
+	// UploadPart stores part number n (from 1) of an upload. Uploading the
+	// same number again replaces the part.
+	UploadPart(ctx context.Context, key, uploadID string, n int, r io.Reader, size int64) (Part, error)
+	// CompleteMultipart joins parts, in order, into key.
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []Part) error
+	// AbortMultipart discards an upload and its parts.
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+
+	// PresignGet returns a URL that fetches key directly from the backend
+	// until ttl passes, saved as downloadName if that is not empty, or
+	// ErrPresignUnsupported.
+	PresignGet(ctx context.Context, key string, ttl time.Duration, downloadName string) (string, error)
+}
+
+// ContentPrefix holds the content-addressed blobs.
+const ContentPrefix = "blobs/sha256/"
+
+// ContentKey is where the content-addressed blob with the given hex SHA-256
+// digest is stored. Objects with the same content share the key.
+func ContentKey(sha256Hex string) string {
+	return path.Join(ContentPrefix, sha256Hex[:2], sha256Hex)
+}
+
+// IsContentKey reports whether key was made by ContentKey.
+func IsContentKey(key string) bool {
+	return strings.HasPrefix(key, ContentPrefix)
+}
+
+// PutFile stores size bytes of r under key. Files of at least partSize
+// bytes go up as a multipart upload in parts of partSize, each retried on
+// its own, so a dropped connection near the end of a large recording does
+// not restart it; partSize <= 0 always uses Put.
+func PutFile(ctx context.Context, s BlobStore, key string, r io.ReaderAt, size int64, contentType string, partSize int64) error {
+	if partSize <= 0 || size < partSize {
+		return s.Put(ctx, key, io.NewSectionReader(r, 0, size), size, contentType)
+	}
+
+	uploadID, err := s.CreateMultipart(ctx, key, contentType)
+	if err != nil {
+		return err
+	}
+	var parts []Part
+	for offset, n := int64(0), 1; offset < size; offset, n = offset+partSize, n+1 {
+		length := min(partSize, size-offset)
+		var part Part
+		for attempt := 1; ; attempt++ {
+			part, err = s.UploadPart(ctx, key, uploadID, n, io.NewSectionReader(r, offset, length), length)
+			if err == nil || attempt == partAttempts || ctx.Err() != nil {
+				break
+			}
+		}
+		if err != nil {
+			s.AbortMultipart(context.WithoutCancel(ctx), key, uploadID)
+			return fmt.Errorf("storage: upload part %d of %s: %w", n, key, err)
+		}
+		parts = append(parts, part)
+	}
+	if err := s.CompleteMultipart(ctx, key, uploadID, parts); err != nil {
+		s.AbortMultipart(context.WithoutCancel(ctx), key, uploadID)
+		return err
+	}
+	return nil
+}
+
+// partAttempts is how many times PutFile tries each part.
+const partAttempts = 3
+
+// DeletePrefix removes every object under prefix.
+func DeletePrefix(ctx context.Context, s BlobStore, prefix string) error {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if err := s.Delete(ctx, obj.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// media-service/pkg/transcode/fake.go
+package transcode
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FakeEncoder produces structurally valid but empty HLS output, plain grey
+// frames and a synthetic waveform without running anything, for tests and
+// development machines without ffmpeg.
+type FakeEncoder struct {
+	// Returned by Probe; defaults to a one-minute 1080p video with audio
+	Result Probe
+	// If set, Encode fails with this error
+	Err error
+
+	mu      sync.Mutex
+	Encoded []Rendition
+}
+
+var defaultFakeProbe = Probe{
+	DurationSeconds: 60,
+	Width:           1920,
+	Height:          1080,
+	HasVideo:        true,
+	HasAudio:        true,
+}
+
+func (f *FakeEncoder) Probe(ctx context.Context, input string) (Probe, error) {
+	if _, err := os.Stat(input); err != nil {
+		return Probe{}, err
+	}
+	return f.probe(), nil
+}
+
+func (f *FakeEncoder) Encode(ctx context.Context, input, dir string, r Rendition, source Probe) error {
+	if f.Err != nil {
+		return f.Err
+	}
+
+	const segmentSeconds = 10
+	segments := int(math.Ceil(source.DurationSeconds / segmentSeconds))
+	playlist := fmt.Sprintf("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-MEDIA-SEQUENCE:0\n", segmentSeconds)
+	remaining := source.DurationSeconds
+	for i := 0; i < segments; i++ {
+		name := fmt.Sprintf("segment_%05d.ts", i)
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			return err
+		}
+		playlist += fmt.Sprintf("#EXTINF:%.3f,\n%s\n", math.Min(remaining, segmentSeconds), name)
+		remaining -= segmentSeconds
+	}
+	playlist += "#EXT-X-ENDLIST\n"
+	if err := os.WriteFile(filepath.Join(dir, VariantPlaylist), []byte(playlist), 0o644); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	f.Encoded = append(f.Encoded, r)
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *FakeEncoder) EncodeAudio(ctx context.Context, input, output string, file AudioFile) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	return os.WriteFile(output, nil, 0o644)
+}
+
+func (f *FakeEncoder) Frame(ctx context.Context, input, output string, seconds float64) error {
+	if f.Err != nil {
+		return f.Err
+	}
+	probe := f.probe()
+	return writeGreyJPEG(output, probe.Width, probe.Height)
+}
+
+func (f *FakeEncoder) Frames(ctx context.Context, input, dir string, interval float64, width int) ([]string, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	probe := f.probe()
+	height := width * 9 / 16
+	if probe.Width > 0 {
+		height = width * probe.Height / probe.Width
+	}
+
+	var paths []string
+	for i := 0; float64(i)*interval < probe.DurationSeconds; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("frame_%05d.jpg", i+1))
+		if err := writeGreyJPEG(name, width, height); err != nil {
+			return nil, err
+		}
+		paths = append(paths, name)
+	}
+	return paths, nil
+}
+
+func (f *FakeEncoder) Peaks(ctx context.Context, input string, count int) ([]float64, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	fine := make([]float64, count)
+	for i := range fine {
+		fine[i] = 0.5 + 0.5*math.Sin(float64(i)/7)
+	}
+	return bucketPeaks(fine, count), nil
+}
+
+func (f *FakeEncoder) probe() Probe {
+	if f.Result == (Probe{}) {
+		return defaultFakeProbe
+	}
+	return f.Result
+}
+
+func writeGreyJPEG(name string, width, height int) error {
+	if width <= 0 || height <= 0 {
+		width, height = 1280, 720
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(file, img, nil); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
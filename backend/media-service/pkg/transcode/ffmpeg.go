@@ -0,0 +1,247 @@
+// media-service/pkg/transcode/ffmpeg.go
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// FFmpegEncoder shells out to local ffmpeg and ffprobe binaries.
+type FFmpegEncoder struct {
+	FFmpegPath  string
+	FFprobePath string
+	// Target segment length; keyframes are forced on these boundaries so
+	// every rendition segments identically
+	SegmentSeconds int
+}
+
+// NewFFmpegEncoder resolves the binaries, from PATH when given bare names,
+// and fails if either is missing.
+func NewFFmpegEncoder(ffmpeg, ffprobe string, segmentSeconds int) (*FFmpegEncoder, error) {
+	ffmpegPath, err := exec.LookPath(ffmpeg)
+	if err != nil {
+		return nil, err
+	}
+	ffprobePath, err := exec.LookPath(ffprobe)
+	if err != nil {
+		return nil, err
+	}
+	if segmentSeconds <= 0 {
+		segmentSeconds = 6
+	}
+	return &FFmpegEncoder{
+		FFmpegPath:     ffmpegPath,
+		FFprobePath:    ffprobePath,
+		SegmentSeconds: segmentSeconds,
+	}, nil
+}
+
+func (e *FFmpegEncoder) Probe(ctx context.Context, input string) (Probe, error) {
+	out, err := e.run(ctx, e.FFprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+		input,
+	)
+	if err != nil {
+		return Probe{}, err
+	}
+
+	var parsed struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+			// Set on cover art embedded in audio files
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return Probe{}, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+
+	var probe Probe
+	probe.DurationSeconds, _ = strconv.ParseFloat(parsed.Format.Duration, 64)
+	for _, s := range parsed.Streams {
+		switch s.CodecType {
+		case "video":
+			if s.Disposition.AttachedPic == 0 && !probe.HasVideo {
+				probe.HasVideo = true
+				probe.Width, probe.Height = s.Width, s.Height
+			}
+		case "audio":
+			probe.HasAudio = true
+		}
+	}
+	return probe, nil
+}
+
+func (e *FFmpegEncoder) Encode(ctx context.Context, input, dir string, r Rendition, source Probe) error {
+	seg := strconv.Itoa(e.SegmentSeconds)
+	args := []string{"-hide_banner", "-nostdin", "-y", "-i", input}
+
+	if r.AudioOnly() {
+		args = append(args, "-vn")
+	} else {
+		args = append(args,
+			"-map", "0:v:0",
+			"-vf", fmt.Sprintf("scale=%d:%d", OutputWidth(source, r.Height), r.Height),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-profile:v", "main",
+			"-b:v", fmt.Sprintf("%dk", r.VideoBitrate),
+			"-maxrate", fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			"-bufsize", fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+			"-force_key_frames", "expr:gte(t,n_forced*"+seg+")",
+			"-sc_threshold", "0",
+		)
+		if source.HasAudio {
+			args = append(args, "-map", "0:a:0")
+		}
+	}
+	if source.HasAudio {
+		channels := "2"
+		if r.Mono {
+			channels = "1"
+		}
+		args = append(args,
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", r.AudioBitrate),
+			"-ac", channels,
+		)
+	}
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", seg,
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "segment_%05d.ts"),
+		filepath.Join(dir, VariantPlaylist),
+	)
+
+	_, err := e.run(ctx, e.FFmpegPath, args...)
+	return err
+}
+
+func (e *FFmpegEncoder) EncodeAudio(ctx context.Context, input, output string, f AudioFile) error {
+	args := []string{"-hide_banner", "-nostdin", "-y", "-i", input, "-vn", "-ac", "1"}
+	switch f.Codec {
+	case "opus":
+		// The voip profile favours intelligibility of speech at low bitrates
+		args = append(args, "-c:a", "libopus", "-application", "voip")
+	case "aac":
+		args = append(args, "-c:a", "aac", "-movflags", "+faststart")
+	default:
+		return fmt.Errorf("unsupported audio codec %q", f.Codec)
+	}
+	args = append(args, "-b:a", fmt.Sprintf("%dk", f.Bitrate), output)
+
+	_, err := e.run(ctx, e.FFmpegPath, args...)
+	return err
+}
+
+func (e *FFmpegEncoder) Frame(ctx context.Context, input, output string, seconds float64) error {
+	_, err := e.run(ctx, e.FFmpegPath,
+		"-hide_banner", "-nostdin", "-y",
+		// Seeking before -i is fast and frame-accurate when re-encoding
+		"-ss", strconv.FormatFloat(seconds, 'f', 3, 64),
+		"-i", input,
+		"-frames:v", "1",
+		"-q:v", "2",
+		output,
+	)
+	return err
+}
+
+func (e *FFmpegEncoder) Frames(ctx context.Context, input, dir string, interval float64, width int) ([]string, error) {
+	_, err := e.run(ctx, e.FFmpegPath,
+		"-hide_banner", "-nostdin", "-y",
+		"-i", input,
+		"-an",
+		"-vf", fmt.Sprintf("fps=1/%s,scale=%d:-2", strconv.FormatFloat(interval, 'f', -1, 64), width),
+		"-q:v", "5",
+		filepath.Join(dir, "frame_%05d.jpg"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "frame_*.jpg"))
+	sort.Strings(paths)
+	return paths, err
+}
+
+// Peaks decodes the audio to 8 kHz mono and keeps the loudest sample of
+// every 10ms before bucketing, so memory stays small for long recordings.
+func (e *FFmpegEncoder) Peaks(ctx context.Context, input string, count int) ([]float64, error) {
+	const blockSamples = 80
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.FFmpegPath,
+		"-hide_banner", "-nostdin",
+		"-i", input,
+		"-vn", "-ac", "1", "-ar", "8000",
+		"-f", "s16le", "-",
+	)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var fine []float64
+	buf := make([]byte, blockSamples*2)
+	for {
+		n, readErr := io.ReadFull(stdout, buf)
+		if n >= 2 {
+			var peak float64
+			for i := 0; i+1 < n; i += 2 {
+				sample := int16(binary.LittleEndian.Uint16(buf[i:]))
+				peak = math.Max(peak, math.Abs(float64(sample))/32768)
+			}
+			fine = append(fine, peak)
+		}
+		if readErr != nil {
+			break
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(e.FFmpegPath), err, lastLine(stderr.Bytes()))
+	}
+	return bucketPeaks(fine, count), nil
+}
+
+func (e *FFmpegEncoder) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", filepath.Base(name), err, lastLine(stderr.Bytes()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// lastLine keeps error messages short; ffmpeg puts the cause last.
+func lastLine(b []byte) string {
+	b = bytes.TrimSpace(b)
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		return string(b[i+1:])
+	}
+	return string(b)
+}
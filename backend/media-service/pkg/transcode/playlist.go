@@ -0,0 +1,150 @@
+// media-service/pkg/transcode/playlist.go
+package transcode
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strings"
+)
+
+const (
+	codecH264Main = "avc1.4d401f"
+	codecAACLC    = "mp4a.40.2"
+
+	// Types of alternate rendition
+	MediaAudio     = "AUDIO"
+	MediaSubtitles = "SUBTITLES"
+)
+
+// Group IDs the variants refer to their alternates by
+var alternateGroups = map[string]string{
+	MediaAudio:     "audio",
+	MediaSubtitles: "subs",
+}
+
+// Alternate is an EXT-X-MEDIA rendition offered with every variant: the
+// audio in another language, or a subtitle track.
+type Alternate struct {
+	// MediaAudio or MediaSubtitles
+	Type string
+	// BCP 47 tag; may be empty for the original audio
+	Language string
+	// Shown in the player's track menu
+	Name string
+	// Played or shown unless the viewer picks another
+	Default bool
+	// Media playlist relative to the master playlist. Empty for the audio
+	// muxed into the variants themselves.
+	URI string
+}
+
+// Bandwidth is the peak bits per second advertised for r, with headroom
+// for container overhead.
+func Bandwidth(r Rendition) int {
+	return r.Bitrate() * 1100
+}
+
+// WriteMasterPlaylist writes the HLS master playlist pointing at each
+// rendition's variant playlist.
+func WriteMasterPlaylist(w io.Writer, renditions []Rendition, probe Probe) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	fmt.Fprintln(bw, "#EXT-X-VERSION:3")
+	fmt.Fprintln(bw, "#EXT-X-INDEPENDENT-SEGMENTS")
+	for _, r := range renditions {
+		if r.AudioOnly() {
+			fmt.Fprintf(bw, "#EXT-X-STREAM-INF:BANDWIDTH=%d,CODECS=\"%s\"\n", Bandwidth(r), codecAACLC)
+		} else {
+			codecs := codecH264Main
+			if probe.HasAudio {
+				codecs += "," + codecAACLC
+			}
+			fmt.Fprintf(bw, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"\n",
+				Bandwidth(r), OutputWidth(probe, r.Height), r.Height, codecs)
+		}
+		fmt.Fprintln(bw, path.Join(r.Name, VariantPlaylist))
+	}
+	return bw.Flush()
+}
+
+// AddAlternates rewrites a master playlist written by WriteMasterPlaylist
+// so that every variant offers alternates. At most one alternate of each
+// type should be Default.
+func AddAlternates(master []byte, alternates []Alternate) []byte {
+	if len(alternates) == 0 {
+		return master
+	}
+	var media, groups bytes.Buffer
+	hasGroup := map[string]bool{}
+	for _, a := range alternates {
+		group := alternateGroups[a.Type]
+		fmt.Fprintf(&media, "#EXT-X-MEDIA:TYPE=%s,GROUP-ID=\"%s\"", a.Type, group)
+		if a.Language != "" {
+			fmt.Fprintf(&media, ",LANGUAGE=\"%s\"", quotable(a.Language))
+		}
+		fmt.Fprintf(&media, ",NAME=\"%s\",DEFAULT=%s,AUTOSELECT=YES", quotable(a.Name), yesNo(a.Default))
+		if a.URI != "" {
+			fmt.Fprintf(&media, ",URI=\"%s\"", quotable(a.URI))
+		}
+		media.WriteByte('\n')
+		if !hasGroup[a.Type] {
+			hasGroup[a.Type] = true
+			fmt.Fprintf(&groups, ",%s=\"%s\"", a.Type, group)
+		}
+	}
+
+	var out bytes.Buffer
+	inserted := false
+	for _, line := range strings.SplitAfter(string(master), "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(trimmed, "#EXT-X-STREAM-INF:") {
+			if !inserted {
+				out.Write(media.Bytes())
+				inserted = true
+			}
+			out.WriteString(trimmed)
+			out.Write(groups.Bytes())
+			out.WriteByte('\n')
+			continue
+		}
+		out.WriteString(line)
+	}
+	return out.Bytes()
+}
+
+// WriteSubtitlePlaylist writes a media playlist presenting a whole WebVTT
+// file at uri as the single segment of a track lasting seconds, which is
+// how HLS players expect subtitles.
+func WriteSubtitlePlaylist(w io.Writer, uri string, seconds float64) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	fmt.Fprintln(bw, "#EXT-X-VERSION:3")
+	fmt.Fprintf(bw, "#EXT-X-TARGETDURATION:%d\n", int(math.Max(1, math.Ceil(seconds))))
+	fmt.Fprintln(bw, "#EXT-X-MEDIA-SEQUENCE:0")
+	fmt.Fprintln(bw, "#EXT-X-PLAYLIST-TYPE:VOD")
+	fmt.Fprintf(bw, "#EXTINF:%.3f,\n", seconds)
+	fmt.Fprintln(bw, uri)
+	fmt.Fprintln(bw, "#EXT-X-ENDLIST")
+	return bw.Flush()
+}
+
+// quotable drops what a quoted playlist attribute cannot hold.
+func quotable(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
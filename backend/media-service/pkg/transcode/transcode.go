@@ -0,0 +1,283 @@
+// media-service/pkg/transcode/transcode.go
+//
+// Package transcode packages source media into an HLS rendition ladder.
+// The actual encoding sits behind Encoder so the pipeline can run against
+// ffmpeg in production and FakeEncoder in tests and on machines without it.
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	MasterPlaylist = "master.m3u8"
+	// Master playlist restricted to the DataSaver rungs
+	DataSaverPlaylist = "master-datasaver.m3u8"
+	VariantPlaylist   = "index.m3u8"
+	// Subdirectory holding the standalone audio files
+	DownloadsDir = "downloads"
+)
+
+var (
+	// ErrNoStreams is returned for input with neither audio nor video.
+	ErrNoStreams = errors.New("transcode: input has no audio or video stream")
+	// ErrNoAudio is returned for an audio track without audio.
+	ErrNoAudio = errors.New("transcode: input has no audio stream")
+)
+
+// Rendition is one rung of the ladder. Height zero means audio only.
+type Rendition struct {
+	Name string
+	// Output height in pixels; width follows the source aspect ratio
+	Height int
+	// Kilobits per second
+	VideoBitrate int
+	AudioBitrate int
+	// Downmix to mono; speech loses little and it halves the audio cost
+	Mono bool
+	// Included in the data-saver master playlist for 2G/3G viewers
+	DataSaver bool
+}
+
+func (r Rendition) AudioOnly() bool {
+	return r.Height == 0
+}
+
+// Bitrate is the combined nominal bitrate in kilobits per second.
+func (r Rendition) Bitrate() int {
+	return r.VideoBitrate + r.AudioBitrate
+}
+
+// DefaultLadder suits low-bandwidth viewers first: the audio-only rungs let
+// a sermon keep playing when video cannot.
+var DefaultLadder = []Rendition{
+	{Name: "144p", Height: 144, VideoBitrate: 120, AudioBitrate: 32, Mono: true, DataSaver: true},
+	{Name: "240p", Height: 240, VideoBitrate: 400, AudioBitrate: 64, DataSaver: true},
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "audio-low", AudioBitrate: 32, Mono: true, DataSaver: true},
+	{Name: "audio", AudioBitrate: 64},
+}
+
+// LookupRendition finds a DefaultLadder rung by name.
+func LookupRendition(name string) (Rendition, bool) {
+	for _, r := range DefaultLadder {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Rendition{}, false
+}
+
+// AudioFile is a standalone audio-only download, for listening offline or
+// over connections too poor even for HLS.
+type AudioFile struct {
+	// File name, including extension
+	Name        string
+	Codec       string
+	Bitrate     int
+	ContentType string
+	DataSaver   bool
+}
+
+// DefaultAudioFiles are mono speech encodings: Opus for the smallest files,
+// AAC for players without Opus support.
+var DefaultAudioFiles = []AudioFile{
+	{Name: "audio.opus", Codec: "opus", Bitrate: 24, ContentType: "audio/ogg", DataSaver: true},
+	{Name: "audio.m4a", Codec: "aac", Bitrate: 48, ContentType: "audio/mp4", DataSaver: true},
+}
+
+// LookupAudioFile finds a DefaultAudioFiles entry by name.
+func LookupAudioFile(name string) (AudioFile, bool) {
+	for _, f := range DefaultAudioFiles {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return AudioFile{}, false
+}
+
+// EstimatedBytes is the expected transfer for seconds of media at
+// kbps kilobits per second.
+func EstimatedBytes(kbps int, seconds float64) int64 {
+	return int64(float64(kbps) * 1000 / 8 * seconds)
+}
+
+// Probe describes the source media.
+type Probe struct {
+	DurationSeconds float64
+	Width           int
+	Height          int
+	HasVideo        bool
+	HasAudio        bool
+}
+
+type Encoder interface {
+	Probe(ctx context.Context, input string) (Probe, error)
+	// Encode writes one HLS variant of input into dir: VariantPlaylist and
+	// its segments.
+	Encode(ctx context.Context, input, dir string, rendition Rendition, source Probe) error
+	// EncodeAudio writes a standalone audio file to output.
+	EncodeAudio(ctx context.Context, input, output string, file AudioFile) error
+	// Frame writes the video frame at seconds to output as a full-size JPEG.
+	Frame(ctx context.Context, input, output string, seconds float64) error
+	// Frames writes a JPEG every interval seconds into dir, scaled to width,
+	// and returns their paths in order.
+	Frames(ctx context.Context, input, dir string, interval float64, width int) ([]string, error)
+	// Peaks returns count peak amplitudes between 0 and 1, spread evenly
+	// over the audio.
+	Peaks(ctx context.Context, input string, count int) ([]float64, error)
+}
+
+// Result describes a packaged ladder.
+type Result struct {
+	Probe      Probe
+	Renditions []Rendition
+	AudioFiles []AudioFile
+}
+
+// Package probes input, encodes every applicable rendition of ladder into
+// its own subdirectory of outDir and writes the master playlists, then
+// encodes audioFiles into DownloadsDir. Video rungs taller than the source
+// are skipped rather than upscaled, though the smallest video rung is
+// always kept.
+func Package(ctx context.Context, enc Encoder, input, outDir string, ladder []Rendition, audioFiles []AudioFile) (*Result, error) {
+	probe, err := enc.Probe(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("probe: %w", err)
+	}
+	if !probe.HasVideo && !probe.HasAudio {
+		return nil, ErrNoStreams
+	}
+
+	renditions := SelectRenditions(ladder, probe)
+	for _, r := range renditions {
+		dir := filepath.Join(outDir, r.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(ctx, input, dir, r, probe); err != nil {
+			return nil, fmt.Errorf("encode %s: %w", r.Name, err)
+		}
+	}
+
+	if err := writePlaylistFile(filepath.Join(outDir, MasterPlaylist), renditions, probe); err != nil {
+		return nil, err
+	}
+	var dataSaver []Rendition
+	for _, r := range renditions {
+		if r.DataSaver {
+			dataSaver = append(dataSaver, r)
+		}
+	}
+	if len(dataSaver) > 0 {
+		if err := writePlaylistFile(filepath.Join(outDir, DataSaverPlaylist), dataSaver, probe); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{Probe: probe, Renditions: renditions}
+	if probe.HasAudio && len(audioFiles) > 0 {
+		dir := filepath.Join(outDir, DownloadsDir)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		for _, f := range audioFiles {
+			if err := enc.EncodeAudio(ctx, input, filepath.Join(dir, f.Name), f); err != nil {
+				return nil, fmt.Errorf("encode %s: %w", f.Name, err)
+			}
+			result.AudioFiles = append(result.AudioFiles, f)
+		}
+	}
+	return result, nil
+}
+
+// PackageAudioTrack encodes a dubbed or alternate-language audio track
+// into the audio-only rungs of ladder, each in its own subdirectory of
+// outDir, for master playlists to offer alongside the variants.
+func PackageAudioTrack(ctx context.Context, enc Encoder, input, outDir string, ladder []Rendition) (*Result, error) {
+	probe, err := enc.Probe(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("probe: %w", err)
+	}
+	if !probe.HasAudio {
+		return nil, ErrNoAudio
+	}
+	// Cover art and any picture must not end up in the segments
+	probe.HasVideo, probe.Width, probe.Height = false, 0, 0
+
+	result := &Result{Probe: probe}
+	for _, r := range ladder {
+		if !r.AudioOnly() {
+			continue
+		}
+		dir := filepath.Join(outDir, r.Name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+		if err := enc.Encode(ctx, input, dir, r, probe); err != nil {
+			return nil, fmt.Errorf("encode %s: %w", r.Name, err)
+		}
+		result.Renditions = append(result.Renditions, r)
+	}
+	return result, nil
+}
+
+func writePlaylistFile(name string, renditions []Rendition, probe Probe) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := WriteMasterPlaylist(f, renditions, probe); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SelectRenditions picks the rungs of ladder that make sense for probe.
+func SelectRenditions(ladder []Rendition, probe Probe) []Rendition {
+	var selected []Rendition
+	var smallestVideo *Rendition
+	for i, r := range ladder {
+		switch {
+		case r.AudioOnly():
+			if probe.HasAudio {
+				selected = append(selected, r)
+			}
+		case probe.HasVideo:
+			if smallestVideo == nil || r.Height < smallestVideo.Height {
+				smallestVideo = &ladder[i]
+			}
+			if r.Height <= probe.Height {
+				selected = append(selected, r)
+			}
+		}
+	}
+
+	hasVideo := false
+	for _, r := range selected {
+		if !r.AudioOnly() {
+			hasVideo = true
+			break
+		}
+	}
+	if !hasVideo && smallestVideo != nil {
+		selected = append([]Rendition{*smallestVideo}, selected...)
+	}
+	return selected
+}
+
+// OutputWidth scales the source width to height, rounded to an even number
+// as H.264 requires.
+func OutputWidth(probe Probe, height int) int {
+	if probe.Height == 0 {
+		return height * 16 / 9 &^ 1
+	}
+	w := probe.Width * height / probe.Height
+	return (w + 1) &^ 1
+}
@@ -0,0 +1,197 @@
+// media-service/pkg/transcode/transcode_test.go
+package transcode
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func renditionNames(renditions []Rendition) []string {
+	names := make([]string, len(renditions))
+	for i, r := range renditions {
+		names[i] = r.Name
+	}
+	return names
+}
+
+func TestSelectRenditions(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe Probe
+		want  []string
+	}{
+		{"1080p", Probe{Height: 1080, Width: 1920, HasVideo: true, HasAudio: true},
+			[]string{"144p", "240p", "360p", "720p", "audio-low", "audio"}},
+		{"no upscaling", Probe{Height: 360, Width: 640, HasVideo: true, HasAudio: true},
+			[]string{"144p", "240p", "360p", "audio-low", "audio"}},
+		{"smaller than every rung", Probe{Height: 120, Width: 160, HasVideo: true, HasAudio: true},
+			[]string{"144p", "audio-low", "audio"}},
+		{"silent video", Probe{Height: 240, Width: 426, HasVideo: true},
+			[]string{"144p", "240p"}},
+		{"audio only", Probe{HasAudio: true},
+			[]string{"audio-low", "audio"}},
+		{"nothing", Probe{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renditionNames(SelectRenditions(DefaultLadder, tt.probe))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageLayout(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "source")
+	if err := os.WriteFile(input, []byte("not really video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	enc := &FakeEncoder{Result: Probe{DurationSeconds: 25, Width: 640, Height: 360, HasVideo: true, HasAudio: true}}
+
+	result, err := Package(context.Background(), enc, input, out, DefaultLadder, DefaultAudioFiles)
+	if err != nil {
+		t.Fatalf("package: %v", err)
+	}
+	want := []string{"144p", "240p", "360p", "audio-low", "audio"}
+	if got := renditionNames(result.Renditions); !reflect.DeepEqual(got, want) {
+		t.Errorf("renditions %v, want %v", got, want)
+	}
+	if got := renditionNames(enc.Encoded); !reflect.DeepEqual(got, want) {
+		t.Errorf("encoded %v, want %v", got, want)
+	}
+
+	// Each rung has its variant playlist and 10-second segments
+	for _, name := range want {
+		playlist, err := os.ReadFile(filepath.Join(out, name, VariantPlaylist))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasSuffix(string(playlist), "#EXT-X-ENDLIST\n") {
+			t.Errorf("%s playlist not terminated:\n%s", name, playlist)
+		}
+		for _, segment := range []string{"segment_00000.ts", "segment_00001.ts", "segment_00002.ts"} {
+			if !strings.Contains(string(playlist), segment) {
+				t.Errorf("%s playlist misses %s", name, segment)
+			}
+			if _, err := os.Stat(filepath.Join(out, name, segment)); err != nil {
+				t.Errorf("%s: %v", name, err)
+			}
+		}
+		if !strings.Contains(string(playlist), "#EXTINF:5.000,") {
+			t.Errorf("%s playlist lacks the short last segment:\n%s", name, playlist)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "720p")); !os.IsNotExist(err) {
+		t.Errorf("720p packaged for a 360p source: %v", err)
+	}
+
+	master, err := os.ReadFile(filepath.Join(out, MasterPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`#EXT-X-STREAM-INF:BANDWIDTH=167200,RESOLUTION=256x144,CODECS="avc1.4d401f,mp4a.40.2"`,
+		"144p/index.m3u8",
+		"360p/index.m3u8",
+		`#EXT-X-STREAM-INF:BANDWIDTH=70400,CODECS="mp4a.40.2"`,
+		"audio/index.m3u8",
+	} {
+		if !strings.Contains(string(master), line+"\n") {
+			t.Errorf("master playlist lacks %q:\n%s", line, master)
+		}
+	}
+
+	dataSaver, err := os.ReadFile(filepath.Join(out, DataSaverPlaylist))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"144p", "240p", "audio-low"} {
+		if !strings.Contains(string(dataSaver), name+"/"+VariantPlaylist) {
+			t.Errorf("data-saver playlist lacks %s:\n%s", name, dataSaver)
+		}
+	}
+	for _, name := range []string{"360p", "audio/"} {
+		if strings.Contains(string(dataSaver), name) {
+			t.Errorf("data-saver playlist offers %s:\n%s", name, dataSaver)
+		}
+	}
+
+	for _, f := range DefaultAudioFiles {
+		if _, err := os.Stat(filepath.Join(out, DownloadsDir, f.Name)); err != nil {
+			t.Errorf("download %s: %v", f.Name, err)
+		}
+	}
+	if len(result.AudioFiles) != len(DefaultAudioFiles) {
+		t.Errorf("%d audio files, want %d", len(result.AudioFiles), len(DefaultAudioFiles))
+	}
+}
+
+func TestPackageFailures(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "source")
+	if err := os.WriteFile(input, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	errEncoder := errors.New("encoder crashed")
+
+	tests := []struct {
+		name  string
+		enc   *FakeEncoder
+		input string
+		want  error
+	}{
+		{"missing input", &FakeEncoder{}, filepath.Join(t.TempDir(), "missing"), os.ErrNotExist},
+		{"no streams", &FakeEncoder{Result: Probe{DurationSeconds: 5}}, input, ErrNoStreams},
+		{"encoder error", &FakeEncoder{Err: errEncoder}, input, errEncoder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			_, err := Package(context.Background(), tt.enc, tt.input, out, DefaultLadder, DefaultAudioFiles)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err %v, want %v", err, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(out, MasterPlaylist)); !os.IsNotExist(err) {
+				t.Errorf("master playlist written after a failure: %v", err)
+			}
+		})
+	}
+}
+
+func TestPackageAudioTrack(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "dub")
+	if err := os.WriteFile(input, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+
+	result, err := PackageAudioTrack(context.Background(), &FakeEncoder{}, input, out, DefaultLadder)
+	if err != nil {
+		t.Fatalf("package: %v", err)
+	}
+	want := []string{"audio-low", "audio"}
+	if got := renditionNames(result.Renditions); !reflect.DeepEqual(got, want) {
+		t.Errorf("renditions %v, want %v", got, want)
+	}
+	if result.Probe.HasVideo {
+		t.Error("audio track kept its picture")
+	}
+	entries, err := os.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Errorf("%d directories written, want %d", len(entries), len(want))
+	}
+
+	silent := &FakeEncoder{Result: Probe{DurationSeconds: 5, HasVideo: true, Height: 720, Width: 1280}}
+	if _, err := PackageAudioTrack(context.Background(), silent, input, t.TempDir(), DefaultLadder); !errors.Is(err, ErrNoAudio) {
+		t.Errorf("silent track: err %v, want %v", err, ErrNoAudio)
+	}
+}
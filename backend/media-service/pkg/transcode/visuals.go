@@ -0,0 +1,214 @@
+// media-service/pkg/transcode/visuals.go
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"shepherdsfold/media-service/pkg/captions"
+	"shepherdsfold/media-service/pkg/imaging"
+	"time"
+)
+
+const (
+	// WebVTT track pointing each scrubbing interval at a sprite tile
+	ThumbnailTrack = "thumbnails.vtt"
+	SpritesDir     = "sprites"
+	WaveformFile   = "waveform.json"
+)
+
+// VisualOptions controls GenerateVisuals.
+type VisualOptions struct {
+	// Poster candidates, as fractions of the duration
+	PosterPositions []float64
+	PosterSizes     []imaging.Size
+	// Seconds between scrubbing thumbnails
+	SpriteInterval float64
+	SpriteWidth    int
+	// Thumbnails per sprite sheet row and column
+	SpriteColumns int
+	SpriteRows    int
+	WaveformPeaks int
+}
+
+// Visuals describes what GenerateVisuals wrote.
+type Visuals struct {
+	// Seconds into the media of each poster candidate
+	PosterTimes  []float64
+	SpriteSheets int
+	Waveform     bool
+}
+
+// Waveform is the JSON written to WaveformFile.
+type Waveform struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Peak amplitudes between 0 and 1, evenly spaced over the duration
+	Peaks []float64 `json:"peaks"`
+}
+
+// PosterBase is the file name prefix of poster candidate i, which
+// imaging.WriteSizes completes with the size name.
+func PosterBase(i int) string {
+	return fmt.Sprintf("poster-%d-", i)
+}
+
+// SpriteSheet is the path of sprite sheet n below the visuals directory.
+func SpriteSheet(n int) string {
+	return fmt.Sprintf("%s/sprite-%03d.jpg", SpritesDir, n)
+}
+
+// GenerateVisuals writes the images for input into dir: poster candidates
+// in each size, sprite sheets with ThumbnailTrack for video, and the
+// WaveformFile for anything with audio.
+func GenerateVisuals(ctx context.Context, enc Encoder, input, dir string, probe Probe, opts VisualOptions) (*Visuals, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	scratch, err := os.MkdirTemp(dir, ".frames-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	visuals := &Visuals{}
+	if probe.HasVideo {
+		for i, pos := range opts.PosterPositions {
+			at := posterTime(pos, probe.DurationSeconds)
+			frame := filepath.Join(scratch, fmt.Sprintf("poster-%d.jpg", i))
+			if err := enc.Frame(ctx, input, frame, at); err != nil {
+				return nil, fmt.Errorf("poster at %.1fs: %w", at, err)
+			}
+			img, err := imaging.DecodeFile(frame)
+			if err != nil {
+				return nil, fmt.Errorf("poster at %.1fs: %w", at, err)
+			}
+			if err := imaging.WriteSizes(img, dir, PosterBase(i), opts.PosterSizes); err != nil {
+				return nil, err
+			}
+			visuals.PosterTimes = append(visuals.PosterTimes, at)
+		}
+
+		if opts.SpriteInterval > 0 && opts.SpriteWidth > 0 && opts.SpriteColumns > 0 && opts.SpriteRows > 0 {
+			sheets, err := writeSprites(ctx, enc, input, dir, scratch, opts)
+			if err != nil {
+				return nil, fmt.Errorf("sprites: %w", err)
+			}
+			visuals.SpriteSheets = sheets
+		}
+	}
+
+	if probe.HasAudio && opts.WaveformPeaks > 0 {
+		peaks, err := enc.Peaks(ctx, input, opts.WaveformPeaks)
+		if err != nil {
+			return nil, fmt.Errorf("waveform: %w", err)
+		}
+		data, err := json.Marshal(Waveform{DurationSeconds: probe.DurationSeconds, Peaks: peaks})
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(dir, WaveformFile), data, 0o644); err != nil {
+			return nil, err
+		}
+		visuals.Waveform = true
+	}
+	return visuals, nil
+}
+
+// writeSprites tiles frames taken every SpriteInterval into sheets and
+// writes the ThumbnailTrack that maps each interval to its tile.
+func writeSprites(ctx context.Context, enc Encoder, input, dir, scratch string, opts VisualOptions) (int, error) {
+	frameDir := filepath.Join(scratch, "sprites")
+	if err := os.MkdirAll(frameDir, 0o755); err != nil {
+		return 0, err
+	}
+	paths, err := enc.Frames(ctx, input, frameDir, opts.SpriteInterval, opts.SpriteWidth)
+	if err != nil {
+		return 0, err
+	}
+	if len(paths) == 0 {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Join(dir, SpritesDir), 0o755); err != nil {
+		return 0, err
+	}
+
+	perSheet := opts.SpriteColumns * opts.SpriteRows
+	interval := time.Duration(opts.SpriteInterval * float64(time.Second))
+	var cues []captions.Cue
+	sheets := 0
+	for start := 0; start < len(paths); start += perSheet {
+		end := min(start+perSheet, len(paths))
+		frames := make([]image.Image, 0, end-start)
+		for _, p := range paths[start:end] {
+			img, err := imaging.DecodeFile(p)
+			if err != nil {
+				return 0, err
+			}
+			frames = append(frames, img)
+		}
+
+		name := SpriteSheet(sheets)
+		if err := imaging.WriteJPEG(filepath.Join(dir, name), imaging.Tile(frames, opts.SpriteColumns)); err != nil {
+			return 0, err
+		}
+		cell := frames[0].Bounds().Size()
+		for i := range frames {
+			n := start + i
+			x, y := i%opts.SpriteColumns*cell.X, i/opts.SpriteColumns*cell.Y
+			cues = append(cues, captions.Cue{
+				Start: time.Duration(n) * interval,
+				End:   time.Duration(n+1) * interval,
+				Text:  fmt.Sprintf("%s#xywh=%d,%d,%d,%d", name, x, y, cell.X, cell.Y),
+			})
+		}
+		sheets++
+	}
+
+	f, err := os.Create(filepath.Join(dir, ThumbnailTrack))
+	if err != nil {
+		return 0, err
+	}
+	if err := captions.WriteVTT(f, cues); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return sheets, f.Close()
+}
+
+// posterTime converts a fraction of the duration to seconds, staying clear
+// of the very end where there may be no frame to decode.
+func posterTime(fraction, duration float64) float64 {
+	at := fraction * duration
+	if at > duration-1 {
+		at = duration - 1
+	}
+	return math.Max(0, math.Round(at*10)/10)
+}
+
+// bucketPeaks reduces fine-grained peaks to count values by taking the
+// maximum of each bucket, then normalizes them so the loudest is 1.
+func bucketPeaks(fine []float64, count int) []float64 {
+	out := make([]float64, count)
+	if len(fine) == 0 || count <= 0 {
+		return out
+	}
+	var loudest float64
+	for i := range out {
+		lo := i * len(fine) / count
+		hi := max((i+1)*len(fine)/count, lo+1)
+		for _, v := range fine[lo:min(hi, len(fine))] {
+			out[i] = math.Max(out[i], v)
+		}
+		loudest = math.Max(loudest, out[i])
+	}
+	if loudest > 0 {
+		for i := range out {
+			out[i] = math.Round(out[i]/loudest*1000) / 1000
+		}
+	}
+	return out
+}
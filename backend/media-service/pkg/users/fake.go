@@ -0,0 +1,24 @@
+// media-service/pkg/users/fake.go
+package users
+
+import (
+	"context"
+	"fmt"
+)
+
+// FakeDirectory answers from Contacts, for development and tests. Users not
+// in it get a made-up address; if Err is set, every lookup fails with it.
+type FakeDirectory struct {
+	Contacts map[uint]Contact
+	Err      error
+}
+
+func (d *FakeDirectory) Contact(ctx context.Context, userID uint) (*Contact, error) {
+	if d.Err != nil {
+		return nil, d.Err
+	}
+	if contact, ok := d.Contacts[userID]; ok {
+		return &contact, nil
+	}
+	return &Contact{ID: userID, Email: fmt.Sprintf("user-%d@shepherdsfold.local", userID)}, nil
+}
@@ -0,0 +1,85 @@
+// media-service/pkg/users/users.go
+//
+// Package users looks up the accounts auth-service keeps, so that nothing
+// about a user beyond their ID has to be copied into media-service.
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned for users that do not exist or were deleted.
+var ErrNotFound = errors.New("user not found")
+
+// Contact is where and how to write to a user.
+type Contact struct {
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Language  string `json:"language"`
+}
+
+// Name is the contact's full name, or empty if they gave none.
+func (c *Contact) Name() string {
+	return strings.TrimSpace(c.FirstName + " " + c.LastName)
+}
+
+// Directory resolves user IDs to their current contact details.
+type Directory interface {
+	Contact(ctx context.Context, userID uint) (*Contact, error)
+}
+
+// AuthDirectory asks auth-service's internal API, authenticating with the
+// shared service token.
+type AuthDirectory struct {
+	// Root of the auth API, e.g. http://auth-service:8080/api/v1/auth
+	BaseURL      string
+	ServiceToken string
+	HTTPClient   *http.Client
+}
+
+func NewAuthDirectory(baseURL, serviceToken string) (*AuthDirectory, error) {
+	if baseURL == "" || serviceToken == "" {
+		return nil, errors.New("auth-service URL and service token are required")
+	}
+	return &AuthDirectory{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		ServiceToken: serviceToken,
+		HTTPClient:   &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+func (d *AuthDirectory) Contact(ctx context.Context, userID uint) (*Contact, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/internal/users/%d/contact", d.BaseURL, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Service-Token", d.ServiceToken)
+
+	resp, err := d.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("auth-service: contact of user %d: %s", userID, resp.Status)
+	}
+	var contact Contact
+	if err := json.NewDecoder(resp.Body).Decode(&contact); err != nil {
+		return nil, fmt.Errorf("auth-service: decode contact: %w", err)
+	}
+	return &contact, nil
+}